@@ -26,7 +26,9 @@ private const val MAX_BUFFER_SIZE = 2 * 1024 * 1024
 @Component
 class EngineClient(
     @Value("\${app.engine.url}")
-    private val engineUrl: String
+    private val engineUrl: String,
+    @Value("\${app.engine.token:}")
+    private val engineToken: String = ""
 ) {
     private val exchangeStrategies = ExchangeStrategies.builder()
         .codecs { it.defaultCodecs().maxInMemorySize(MAX_BUFFER_SIZE) }
@@ -35,6 +37,7 @@ class EngineClient(
     private val webClient = WebClient.builder()
         .baseUrl(engineUrl)
         .exchangeStrategies(exchangeStrategies)
+        .apply { if (engineToken.isNotBlank()) defaultHeader("Authorization", "Bearer $engineToken") }
         .build()
 
     /**
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/homebrain/engine/internal/connector"
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+// Config holds where the engine keeps its files and where it listens. The
+// defaults match the container layout; STATE_PATH, AUTOMATIONS_PATH,
+// API_PORT and the API_TLS_* settings (environment or config file) override
+// them, and command-line flags override both.
+type Config struct {
+	AutomationsPath string // Automation files, lib/ and group subdirectories
+	StatePath       string // State database file
+	APIPort         int
+	TLSCertPath     string // PEM certificate; with TLSKeyPath the API serves HTTPS
+	TLSKeyPath      string
+	TLSSelfSigned   bool // Serve HTTPS with a certificate generated under StateDir
+}
+
+// StateDir is the directory of the state database, which also holds the
+// Starlark program cache and per-automation data files by default
+func (c Config) StateDir() string {
+	return filepath.Dir(c.StatePath)
+}
+
+// APIAddr is the listen address of the HTTP API
+func (c Config) APIAddr() string {
+	return fmt.Sprintf(":%d", c.APIPort)
+}
+
+// TLS reports whether the HTTP API is served over HTTPS
+func (c Config) TLS() bool {
+	return c.TLSCertPath != "" || c.TLSSelfSigned
+}
+
+// loadConfig reads settings through getenv, then flags from args
+func loadConfig(args []string, getenv func(string) string) (Config, error) {
+	cfg := Config{
+		AutomationsPath: "/app/automations",
+		StatePath:       "/app/state/homebrain.db",
+		APIPort:         9000,
+	}
+	if v := getenv("AUTOMATIONS_PATH"); v != "" {
+		cfg.AutomationsPath = v
+	}
+	if v := getenv("STATE_PATH"); v != "" {
+		cfg.StatePath = v
+	}
+	if v := getenv("API_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid API_PORT %q", v)
+		}
+		cfg.APIPort = port
+	}
+	cfg.TLSCertPath = getenv("API_TLS_CERT")
+	cfg.TLSKeyPath = getenv("API_TLS_KEY")
+	switch v := getenv("API_TLS"); v {
+	case "", "off":
+	case "self-signed":
+		cfg.TLSSelfSigned = true
+	default:
+		return cfg, fmt.Errorf("invalid API_TLS %q (want self-signed or off)", v)
+	}
+
+	flags := flag.NewFlagSet("engine", flag.ContinueOnError)
+	flags.StringVar(&cfg.AutomationsPath, "automations", cfg.AutomationsPath, "automations directory")
+	flags.StringVar(&cfg.StatePath, "state", cfg.StatePath, "state database file")
+	flags.IntVar(&cfg.APIPort, "port", cfg.APIPort, "HTTP API port")
+	flags.StringVar(&cfg.TLSCertPath, "tls-cert", cfg.TLSCertPath, "TLS certificate for the HTTP API (PEM)")
+	flags.StringVar(&cfg.TLSKeyPath, "tls-key", cfg.TLSKeyPath, "TLS private key for the HTTP API (PEM)")
+	flags.BoolVar(&cfg.TLSSelfSigned, "tls-self-signed", cfg.TLSSelfSigned, "serve the HTTP API with a generated self-signed certificate")
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+	if flags.NArg() > 0 {
+		return cfg, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	if cfg.APIPort < 1 || cfg.APIPort > 65535 {
+		return cfg, fmt.Errorf("API port %d out of range", cfg.APIPort)
+	}
+	if (cfg.TLSCertPath == "") != (cfg.TLSKeyPath == "") {
+		return cfg, fmt.Errorf("TLS certificate and key must be set together")
+	}
+	if cfg.TLSSelfSigned && cfg.TLSCertPath != "" {
+		return cfg, fmt.Errorf("a TLS certificate and a self-signed certificate are mutually exclusive")
+	}
+	return cfg, nil
+}
+
+// mqttBrokers reads the additional brokers from MQTT_BROKERS, a list of
+// name=url pairs, with MQTT_<NAME>_USERNAME, _PASSWORD, _CA_CERT,
+// _CLIENT_CERT, _CLIENT_KEY and _TLS_INSECURE for each
+func mqttBrokers(getenv func(string) string) (map[string]mqtt.Config, error) {
+	brokers := make(map[string]mqtt.Config)
+	for _, entry := range connector.ParseList(getenv("MQTT_BROKERS")) {
+		name, url, ok := strings.Cut(entry, "=")
+		name, url = strings.TrimSpace(name), strings.TrimSpace(url)
+		if !ok || name == "" || url == "" {
+			return nil, fmt.Errorf("invalid MQTT_BROKERS entry %q (want name=url)", entry)
+		}
+		if _, dup := brokers[name]; dup {
+			return nil, fmt.Errorf("broker %s is listed twice in MQTT_BROKERS", name)
+		}
+		prefix := "MQTT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		brokers[name] = mqtt.Config{
+			Broker:             url,
+			Username:           getenv(prefix + "USERNAME"),
+			Password:           getenv(prefix + "PASSWORD"),
+			CACert:             getenv(prefix + "CA_CERT"),
+			ClientCert:         getenv(prefix + "CLIENT_CERT"),
+			ClientKey:          getenv(prefix + "CLIENT_KEY"),
+			InsecureSkipVerify: getenv(prefix+"TLS_INSECURE") == "true",
+		}
+	}
+	return brokers, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name: "container defaults",
+			want: Config{AutomationsPath: "/app/automations", StatePath: "/app/state/homebrain.db", APIPort: 9000},
+		},
+		{
+			name: "environment",
+			env:  map[string]string{"AUTOMATIONS_PATH": "../automations", "STATE_PATH": "/tmp/hb/state.db", "API_PORT": "9100"},
+			want: Config{AutomationsPath: "../automations", StatePath: "/tmp/hb/state.db", APIPort: 9100},
+		},
+		{
+			name: "flags override environment",
+			args: []string{"-automations", "./automations", "-port", "9200"},
+			env:  map[string]string{"AUTOMATIONS_PATH": "../automations", "API_PORT": "9100"},
+			want: Config{AutomationsPath: "./automations", StatePath: "/app/state/homebrain.db", APIPort: 9200},
+		},
+		{
+			name: "tls certificate",
+			env:  map[string]string{"API_TLS_CERT": "/certs/engine.crt", "API_TLS_KEY": "/certs/engine.key"},
+			want: Config{AutomationsPath: "/app/automations", StatePath: "/app/state/homebrain.db", APIPort: 9000, TLSCertPath: "/certs/engine.crt", TLSKeyPath: "/certs/engine.key"},
+		},
+		{
+			name: "self-signed flag",
+			args: []string{"-tls-self-signed"},
+			want: Config{AutomationsPath: "/app/automations", StatePath: "/app/state/homebrain.db", APIPort: 9000, TLSSelfSigned: true},
+		},
+		{name: "bad port variable", env: map[string]string{"API_PORT": "http"}, wantErr: true},
+		{name: "certificate without key", env: map[string]string{"API_TLS_CERT": "/certs/engine.crt"}, wantErr: true},
+		{name: "certificate and self-signed", env: map[string]string{"API_TLS": "self-signed", "API_TLS_CERT": "a", "API_TLS_KEY": "b"}, wantErr: true},
+		{name: "bad tls mode", env: map[string]string{"API_TLS": "on"}, wantErr: true},
+		{name: "port out of range", args: []string{"-port", "70000"}, wantErr: true},
+		{name: "stray argument", args: []string{"serve"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadConfig(tt.args, func(key string) string { return tt.env[key] })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("loadConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	cfg := Config{StatePath: "/tmp/hb/state.db", APIPort: 9100}
+	if cfg.StateDir() != "/tmp/hb" || cfg.APIAddr() != ":9100" || cfg.TLS() {
+		t.Errorf("StateDir() = %q, APIAddr() = %q, TLS() = %v", cfg.StateDir(), cfg.APIAddr(), cfg.TLS())
+	}
+}
+
+func TestMQTTBrokers(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    map[string]mqtt.Config
+		wantErr bool
+	}{
+		{name: "none", want: map[string]mqtt.Config{}},
+		{
+			name: "with credentials",
+			env: map[string]string{
+				"MQTT_BROKERS":            "cloud=mqtts://broker.example.com, garage-pi = tcp://10.0.0.5",
+				"MQTT_CLOUD_USERNAME":     "home",
+				"MQTT_CLOUD_PASSWORD":     "secret",
+				"MQTT_GARAGE_PI_CA_CERT":  "/certs/ca.pem",
+				"MQTT_GARAGE_PI_USERNAME": "pi",
+			},
+			want: map[string]mqtt.Config{
+				"cloud":     {Broker: "mqtts://broker.example.com", Username: "home", Password: "secret"},
+				"garage-pi": {Broker: "tcp://10.0.0.5", Username: "pi", CACert: "/certs/ca.pem"},
+			},
+		},
+		{name: "missing url", env: map[string]string{"MQTT_BROKERS": "cloud"}, wantErr: true},
+		{name: "listed twice", env: map[string]string{"MQTT_BROKERS": "cloud=a,cloud=b"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mqttBrokers(func(key string) string { return tt.env[key] })
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
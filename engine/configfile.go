@@ -0,0 +1,361 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/homebrain/engine/internal/secrets"
+)
+
+// defaultConfigFile is read unless CONFIG_FILE names another file. Without
+// it the engine is configured by environment variables alone.
+const defaultConfigFile = "/app/config.yaml"
+
+// configSettings are the environment variables the config file can set. Its
+// keys are their lowercase names, optionally split into sections at any "_":
+// "log: {level: debug}" and "log_level: debug" both set LOG_LEVEL.
+var configSettings = []string{
+	"AGENT_APPROVAL", "API_PORT", "API_TLS", "API_TLS_CERT", "API_TLS_KEY", "API_TOKENS",
+	"AUTOMATIONS_PATH", "AUTOMATION_DATA_DIR", "AUTOMATION_DATA_LIMIT", "CONFLICT_WINDOW",
+	"GIT_SYNC_BRANCH", "GIT_SYNC_INTERVAL", "GIT_SYNC_REPO",
+	"GPIO_BASE", "GPIO_INPUTS", "GPIO_OUTPUTS", "GPIO_POLL_INTERVAL",
+	"HANDLER_MAX_STEPS", "HANDLER_TIMEOUT", "HIGH_PRIORITY_WORKERS", "HOME_LATITUDE", "HOME_LONGITUDE",
+	"KAFKA_BROKERS", "KAFKA_GROUP_ID", "KAFKA_TOPICS",
+	"LOG_FILE", "LOG_FILE_BACKUPS", "LOG_FILE_MAX_MB", "LOG_FORMAT", "LOG_LEVEL", "LOG_PERSIST", "LOG_PERSIST_MAX",
+	"LOOP_GUARD", "LOOP_MAX_DEPTH", "LOOP_WINDOW",
+	"MQTT_BROKER", "MQTT_BROKERS", "MQTT_CA_CERT", "MQTT_CLIENT_CERT", "MQTT_CLIENT_KEY", "MQTT_PASSWORD",
+	"MQTT_STATUS_OFFLINE", "MQTT_STATUS_ONLINE", "MQTT_STATUS_TOPIC", "MQTT_TLS_INSECURE", "MQTT_USERNAME",
+	"NATS_SUBJECTS", "NATS_URL", "NOTIFY_DEFAULT", "NTFY_TOKEN", "NTFY_TOPIC", "NTFY_URL", "NTP_SERVER",
+	"PRESENCE_FILE", "PROFILES", "PROFILE_TOPIC", "PUBLISH_THROTTLE", "PUSHOVER_TOKEN", "PUSHOVER_USER",
+	"RETAINED_PAYLOAD_BYTES", "SECRETS_FILE",
+	"SMTP_FROM", "SMTP_HOST", "SMTP_PASSWORD", "SMTP_PORT", "SMTP_TLS", "SMTP_TO", "SMTP_USERNAME",
+	"STARLARK_CACHE_DIR", "STATE_PATH", "STATE_SEED", "STATE_SEED_TIMEOUT", "STRICT_PERMISSIONS",
+	"TELEGRAM_BOT_TOKEN", "TELEGRAM_CHAT_ID", "TOPIC_RETENTION",
+	"WARMUP_MAX", "WARMUP_MODE", "WARMUP_QUIET",
+	"WATCHDOG", "WATCHDOG_INTERVAL", "WATCHDOG_RESTART", "WATCHDOG_THRESHOLD",
+	"WEBHOOK_SECRETS", "WORKERS",
+}
+
+// configAliases are config file keys that don't spell their variable
+var configAliases = map[string]string{
+	"LOCATION_LATITUDE":  "HOME_LATITUDE",
+	"LOCATION_LONGITUDE": "HOME_LONGITUDE",
+}
+
+// configPairs are settings holding name<sep>value lists, which the config
+// file can write as a mapping
+var configPairs = map[string]string{
+	"API_TOKENS":       "=",
+	"GPIO_INPUTS":      ":",
+	"PUBLISH_THROTTLE": "=",
+	"STATE_SEED":       "=",
+	"WEBHOOK_SECRETS":  "=",
+}
+
+// reloadableSettings are applied when the config file changes; other
+// changes wait for a restart
+var reloadableSettings = map[string]bool{
+	"CONFLICT_WINDOW": true,
+	"LOG_LEVEL":       true,
+	"LOOP_GUARD":      true,
+	"LOOP_MAX_DEPTH":  true,
+	"LOOP_WINDOW":     true,
+}
+
+// brokerSettings are the keys of an entry under mqtt.brokers, each setting
+// MQTT_<NAME>_<KEY> (see mqttBrokers)
+var brokerSettings = map[string]bool{
+	"username": true, "password": true, "ca_cert": true, "client_cert": true, "client_key": true, "tls_insecure": true,
+}
+
+// settings are the values of the config file, with environment variables
+// taking precedence
+type settings struct {
+	path    string            // Config file, read again on reload
+	found   bool              // The file existed
+	values  map[string]string // Variable name → value from the file
+	getenv  func(string) string
+	environ []string
+}
+
+// loadSettings reads the config file at path. A missing file yields empty
+// settings. "!secret name" values are looked up in the secrets store
+// (SECRETS_FILE and HOMEBRAIN_SECRET_* variables).
+func loadSettings(path string, getenv func(string) string, environ []string) (*settings, error) {
+	s := &settings{path: path, values: make(map[string]string), getenv: getenv, environ: environ}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	s.found = true
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return s, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid config file %s: want a mapping of settings", path)
+	}
+
+	// Secret references resolve against the secrets file the config names,
+	// so find it first; the second pass reports any errors
+	probe := &settings{values: make(map[string]string)}
+	probe.parse(root, "", func(string) (string, error) { return "", nil })
+	secretsFile := getenv("SECRETS_FILE")
+	if secretsFile == "" {
+		secretsFile = probe.values["SECRETS_FILE"]
+	}
+	if secretsFile == "" {
+		secretsFile = "/app/secrets.yaml"
+	}
+	var store *secrets.Store
+	lookup := func(name string) (string, error) {
+		if store == nil {
+			var err error
+			if store, err = secrets.Load(secretsFile, environ); err != nil {
+				return "", err
+			}
+		}
+		value, ok := store.Get(name)
+		if !ok {
+			return "", fmt.Errorf("unknown secret %q", name)
+		}
+		return value, nil
+	}
+	if err := s.parse(root, "", lookup); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// parse adds the settings in a mapping whose keys are prefixed with prefix
+func (s *settings) parse(node *yaml.Node, prefix string, lookup func(string) (string, error)) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		name := prefix + strings.ToUpper(key)
+		if alias, ok := configAliases[name]; ok {
+			name = alias
+		}
+
+		switch {
+		case name == "MQTT_BROKERS" && value.Kind == yaml.MappingNode:
+			if err := s.parseBrokers(value, lookup); err != nil {
+				return err
+			}
+		case value.Kind == yaml.MappingNode && configPairs[name] == "":
+			if err := s.parse(value, name+"_", lookup); err != nil {
+				return err
+			}
+		case !slices.Contains(configSettings, name):
+			return fmt.Errorf("line %d: unknown setting %s", node.Content[i].Line, strings.ToLower(name))
+		default:
+			text, err := settingValue(value, configPairs[name], lookup)
+			if err != nil {
+				return fmt.Errorf("line %d: %s: %w", value.Line, strings.ToLower(name), err)
+			}
+			s.values[name] = text
+		}
+	}
+	return nil
+}
+
+// parseBrokers turns mqtt.brokers, a mapping of broker name to url and
+// credentials, into MQTT_BROKERS and the MQTT_<NAME>_* settings
+func (s *settings) parseBrokers(node *yaml.Node, lookup func(string) (string, error)) error {
+	var entries []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, broker := node.Content[i].Value, node.Content[i+1]
+		if broker.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: broker %s: want a mapping with url", broker.Line, name)
+		}
+		prefix := "MQTT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		url := ""
+		for j := 0; j+1 < len(broker.Content); j += 2 {
+			key, value := broker.Content[j].Value, broker.Content[j+1]
+			text, err := settingValue(value, "", lookup)
+			if err != nil {
+				return fmt.Errorf("line %d: broker %s: %s: %w", value.Line, name, key, err)
+			}
+			switch {
+			case key == "url":
+				url = text
+			case brokerSettings[key]:
+				s.values[prefix+strings.ToUpper(key)] = text
+			default:
+				return fmt.Errorf("line %d: broker %s: unknown setting %s", broker.Content[j].Line, name, key)
+			}
+		}
+		entries = append(entries, name+"="+url)
+	}
+	s.values["MQTT_BROKERS"] = strings.Join(entries, ",")
+	return nil
+}
+
+// settingValue formats a config value the way its environment variable is
+// written: lists are comma-separated, mappings (for configPairs) are
+// name<sep>value lists and "!secret name" is the secret's value
+func settingValue(node *yaml.Node, sep string, lookup func(string) (string, error)) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!secret" {
+			return lookup(node.Value)
+		}
+		if node.Tag == "!!null" {
+			return "", nil
+		}
+		return node.Value, nil
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("list items must be plain values")
+			}
+			text, err := settingValue(item, "", lookup)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	case yaml.MappingNode:
+		if sep == "" {
+			return "", fmt.Errorf("want a plain value or a list")
+		}
+		pairs := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i+1].Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("%s: want a plain value", node.Content[i].Value)
+			}
+			text, err := settingValue(node.Content[i+1], "", lookup)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, node.Content[i].Value+sep+text)
+		}
+		return strings.Join(pairs, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value")
+}
+
+// Getenv returns an environment variable, or the config file's value for it
+// when the variable is unset
+func (s *settings) Getenv(key string) string {
+	if v := s.getenv(key); v != "" {
+		return v
+	}
+	return s.values[key]
+}
+
+// changed lists the settings whose value differs in next, sorted
+func (s *settings) changed(next *settings) []string {
+	var names []string
+	for _, values := range []map[string]string{s.values, next.values} {
+		for name := range values {
+			if s.Getenv(name) != next.Getenv(name) && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reload re-reads the config file and applies the reloadable settings that
+// changed. It returns the settings now in effect: the old ones if the file
+// is invalid.
+func (s *settings) reload(level *slog.LevelVar, r reloadTarget) *settings {
+	next, err := loadSettings(s.path, s.getenv, s.environ)
+	if err != nil {
+		slog.Error("Config file not reloaded", "error", err)
+		return s
+	}
+	changed := s.changed(next)
+	if len(changed) == 0 {
+		return next
+	}
+	var restart []string
+	for _, name := range changed {
+		if !reloadableSettings[name] {
+			restart = append(restart, name)
+		}
+	}
+	applyReloadable(next.Getenv, level, r)
+	slog.Info("Config file reloaded", "changed", changed)
+	if len(restart) > 0 {
+		slog.Warn("Config changes take effect after a restart", "settings", restart)
+	}
+	return next
+}
+
+// reloadTarget is the part of the runner that reloadable settings apply to
+type reloadTarget interface {
+	SetConflictWindow(window time.Duration)
+	SetLoopGuard(window time.Duration, maxDepth int, breakLoops bool)
+}
+
+// applyReloadable applies the settings that can change while the engine
+// runs. Unset settings go back to their defaults; invalid ones are logged and
+// use the default too.
+func applyReloadable(getenv func(string) string, level *slog.LevelVar, r reloadTarget) {
+	level.Set(parseLogLevel(getenv("LOG_LEVEL")))
+
+	var conflictWindow time.Duration
+	if v := getenv("CONFLICT_WINDOW"); v != "" {
+		if window, err := time.ParseDuration(v); err == nil && window > 0 {
+			conflictWindow = window
+		} else {
+			slog.Error("Invalid CONFLICT_WINDOW", "value", v)
+		}
+	}
+	r.SetConflictWindow(conflictWindow)
+
+	// Runtime publish/subscribe loop guard: LOOP_GUARD=break drops runaway chains
+	var loopWindow time.Duration
+	if v := getenv("LOOP_WINDOW"); v != "" {
+		if window, err := time.ParseDuration(v); err == nil && window > 0 {
+			loopWindow = window
+		} else {
+			slog.Error("Invalid LOOP_WINDOW", "value", v)
+		}
+	}
+	var loopMaxDepth int
+	if v := getenv("LOOP_MAX_DEPTH"); v != "" {
+		if depth, err := strconv.Atoi(v); err == nil && depth > 0 {
+			loopMaxDepth = depth
+		} else {
+			slog.Error("Invalid LOOP_MAX_DEPTH", "value", v)
+		}
+	}
+	r.SetLoopGuard(loopWindow, loopMaxDepth, getenv("LOOP_GUARD") == "break")
+}
+
+// parseLogLevel reads LOG_LEVEL; anything but debug, warn and error is info
+func parseLogLevel(value string) slog.Level {
+	switch value {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
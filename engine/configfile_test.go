@@ -0,0 +1,201 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/runner"
+)
+
+func TestLoadSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		env     map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "sections and flat keys",
+			config: `
+automations_path: /srv/automations
+api:
+  port: 9100
+mqtt:
+  broker: tcp://mosquitto:1883
+  tls_insecure: true
+log:
+  level: debug
+  persist: true
+watchdog: off
+watchdog_interval: 5s
+location:
+  latitude: 52.52
+  longitude: 13.405
+profiles: [home, away, vacation]
+`,
+			want: map[string]string{
+				"AUTOMATIONS_PATH": "/srv/automations", "API_PORT": "9100", "MQTT_BROKER": "tcp://mosquitto:1883",
+				"MQTT_TLS_INSECURE": "true", "LOG_LEVEL": "debug", "LOG_PERSIST": "true", "WATCHDOG": "off",
+				"WATCHDOG_INTERVAL": "5s", "HOME_LATITUDE": "52.52", "HOME_LONGITUDE": "13.405", "PROFILES": "home,away,vacation",
+			},
+		},
+		{
+			name: "mappings and brokers",
+			config: `
+api:
+  tokens:
+    agent: admin:s3cret
+gpio:
+  inputs:
+    17: gpio/doorbell
+mqtt:
+  brokers:
+    cloud:
+      url: mqtts://cloud:8883
+      username: homebrain
+      password: !secret cloud_password
+`,
+			want: map[string]string{
+				"API_TOKENS": "agent=admin:s3cret", "GPIO_INPUTS": "17:gpio/doorbell", "MQTT_BROKERS": "cloud=mqtts://cloud:8883",
+				"MQTT_CLOUD_USERNAME": "homebrain", "MQTT_CLOUD_PASSWORD": "hunter2",
+			},
+		},
+		{
+			name:   "environment overrides the file",
+			config: "log_level: debug\nmqtt_broker: tcp://mosquitto:1883\n",
+			env:    map[string]string{"LOG_LEVEL": "warn"},
+			want:   map[string]string{"LOG_LEVEL": "warn", "MQTT_BROKER": "tcp://mosquitto:1883"},
+		},
+		{name: "unknown setting", config: "log:\n  levle: debug\n", wantErr: "line 2: unknown setting log_levle"},
+		{name: "unknown secret", config: "smtp_password: !secret nope\n", wantErr: `unknown secret "nope"`},
+		{name: "mapping for a plain setting", config: "profiles: {home: 1}\n", wantErr: "unknown setting profiles_home"},
+		{name: "unknown broker setting", config: "mqtt:\n  brokers:\n    cloud: {url: x, user: y}\n", wantErr: "unknown setting user"},
+		{name: "not a mapping", config: "- log_level\n", wantErr: "want a mapping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "secrets.yaml"), []byte("cloud_password: hunter2\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			env := map[string]string{"SECRETS_FILE": filepath.Join(dir, "secrets.yaml")}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+
+			s, err := loadSettings(path, func(key string) string { return env[key] }, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadSettings() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for name := range tt.want {
+				got[name] = s.Getenv(name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("settings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSettings_MissingFile(t *testing.T) {
+	s, err := loadSettings(filepath.Join(t.TempDir(), "config.yaml"), func(key string) string { return "env" }, nil)
+	if err != nil || s.found || s.Getenv("LOG_LEVEL") != "env" {
+		t.Errorf("loadSettings() = %+v, %v", s, err)
+	}
+}
+
+func TestSettingsReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(config string) {
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	noEnv := func(string) string { return "" }
+	write("log_level: info\napi_port: 9000\n")
+	s, err := loadSettings(path, noEnv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var level slog.LevelVar
+	r := runner.New(nil, nil)
+
+	write("log_level: debug\napi_port: 9100\nloop_guard: break\n")
+	next := s.reload(&level, r)
+	if got := s.changed(next); !slices.Equal(got, []string{"API_PORT", "LOG_LEVEL", "LOOP_GUARD"}) {
+		t.Errorf("changed = %v", got)
+	}
+	if level.Level() != slog.LevelDebug {
+		t.Errorf("log level = %v, want debug", level.Level())
+	}
+
+	// An invalid file keeps the settings in effect
+	write("log_level: [\n")
+	if again := next.reload(&level, r); again != next {
+		t.Error("invalid config file replaced the settings")
+	}
+}
+
+// loopGuardRecorder records the settings applyReloadable passes on
+type loopGuardRecorder struct {
+	conflictWindow time.Duration
+	loopWindow     time.Duration
+	loopMaxDepth   int
+	breakLoops     bool
+}
+
+func (g *loopGuardRecorder) SetConflictWindow(window time.Duration) { g.conflictWindow = window }
+
+func (g *loopGuardRecorder) SetLoopGuard(window time.Duration, maxDepth int, breakLoops bool) {
+	g.loopWindow, g.loopMaxDepth, g.breakLoops = window, maxDepth, breakLoops
+}
+
+func TestSettingsReload_RemovedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(config string) {
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	noEnv := func(string) string { return "" }
+	write("conflict_window: 10s\nloop:\n  window: 2s\n  max_depth: 8\n  guard: break\n")
+	s, err := loadSettings(path, noEnv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var level slog.LevelVar
+	var got loopGuardRecorder
+	applyReloadable(s.Getenv, &level, &got)
+	if want := (loopGuardRecorder{10 * time.Second, 2 * time.Second, 8, true}); got != want {
+		t.Fatalf("applied %+v, want %+v", got, want)
+	}
+
+	// Removed settings go back to their defaults, shown as zero here
+	write("loop_window: fast\n")
+	next := s.reload(&level, &got)
+	if changed := s.changed(next); !slices.Equal(changed, []string{"CONFLICT_WINDOW", "LOOP_GUARD", "LOOP_MAX_DEPTH", "LOOP_WINDOW"}) {
+		t.Errorf("changed = %v", changed)
+	}
+	if got != (loopGuardRecorder{}) {
+		t.Errorf("applied %+v after removing the settings, want defaults", got)
+	}
+}
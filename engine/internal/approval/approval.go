@@ -0,0 +1,283 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RoleAgent marks code written by an LLM agent rather than a person
+const RoleAgent = "agent"
+
+// PendingDir is the subdirectory of the automations directory holding staged
+// submissions. The watcher skips it, so nothing in it runs.
+const PendingDir = "pending"
+
+// extensions are the automation file extensions, Starlark and declarative YAML
+// (blueprint instances among them)
+var extensions = []string{".star", ".auto.yaml"}
+
+var (
+	// ErrNotFound is returned for operations on unknown submission IDs
+	ErrNotFound = errors.New("pending automation not found")
+
+	// ErrNotDeployed is returned when deleting an automation that has no file
+	ErrNotDeployed = errors.New("automation not found")
+
+	// ErrApprovalRequired is returned when an agent deletes an automation while
+	// approval is required
+	ErrApprovalRequired = errors.New("agents cannot delete automations while approval is required")
+)
+
+// Submission is automation code waiting for human approval
+type Submission struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	Code        string    `json:"code"`
+	Role        string    `json:"role"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	Replaces    bool      `json:"replaces"` // A deployed automation with this filename exists
+}
+
+// Queue writes automation files into the automations directory, staging agent
+// submissions in PendingDir when approval is required
+type Queue struct {
+	dir             string
+	requireApproval bool
+	mu              sync.Mutex
+}
+
+// New creates a queue for the given automations directory
+func New(dir string, requireApproval bool) (*Queue, error) {
+	if err := os.MkdirAll(filepath.Join(dir, PendingDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create pending directory: %w", err)
+	}
+	return &Queue{dir: dir, requireApproval: requireApproval}, nil
+}
+
+// Submit deploys code under filename, or stages it when the author has the
+// agent role and approval is required. It reports whether the code is pending.
+// A new submission for the same automation replaces the staged one.
+func (q *Queue) Submit(filename, code, role string) (Submission, bool, error) {
+	id, err := automationID(filename)
+	if err != nil {
+		return Submission{}, false, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	sub := Submission{
+		ID:          id,
+		Filename:    filename,
+		Code:        code,
+		Role:        role,
+		SubmittedAt: time.Now(),
+		Replaces:    q.deployed(filename),
+	}
+
+	if role != RoleAgent || !q.requireApproval {
+		return sub, false, q.deploy(filename, code)
+	}
+
+	data, err := json.MarshalIndent(sub, "", "  ")
+	if err != nil {
+		return Submission{}, false, err
+	}
+	if err := writeFileAtomic(q.pendingPath(id), data); err != nil {
+		return Submission{}, false, err
+	}
+	return sub, true, nil
+}
+
+// List returns all pending submissions, oldest first
+func (q *Queue) List() ([]Submission, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(q.dir, PendingDir))
+	if err != nil {
+		return nil, err
+	}
+
+	subs := []Submission{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		id, err := url.PathUnescape(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		sub, err := q.read(id)
+		if err != nil {
+			continue
+		}
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].SubmittedAt.Before(subs[j].SubmittedAt)
+	})
+	return subs, nil
+}
+
+// Get returns a pending submission
+func (q *Queue) Get(id string) (Submission, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.read(id)
+}
+
+// Approve deploys a pending submission into the automations directory, where
+// the watcher picks it up
+func (q *Queue) Approve(id string) (Submission, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	sub, err := q.read(id)
+	if err != nil {
+		return Submission{}, err
+	}
+	if err := q.deploy(sub.Filename, sub.Code); err != nil {
+		return Submission{}, err
+	}
+	if err := os.Remove(q.pendingPath(id)); err != nil {
+		return Submission{}, err
+	}
+	return sub, nil
+}
+
+// Reject discards a pending submission
+func (q *Queue) Reject(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.read(id); err != nil {
+		return err
+	}
+	return os.Remove(q.pendingPath(id))
+}
+
+// Delete removes a deployed automation file; the watcher unloads it. Agents
+// may not delete automations while approval is required.
+func (q *Queue) Delete(id, role string) error {
+	if role == RoleAgent && q.requireApproval {
+		return ErrApprovalRequired
+	}
+	if _, err := automationID(id + ".star"); err != nil {
+		return fmt.Errorf("%w: %s", ErrNotDeployed, id)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, ext := range extensions {
+		err := os.Remove(filepath.Join(q.dir, filepath.FromSlash(id+ext)))
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotDeployed, id)
+}
+
+func (q *Queue) read(id string) (Submission, error) {
+	if !validID(id) {
+		return Submission{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	data, err := os.ReadFile(q.pendingPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Submission{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Submission{}, err
+	}
+
+	var sub Submission
+	if err := json.Unmarshal(data, &sub); err != nil {
+		return Submission{}, fmt.Errorf("corrupt pending automation %s: %w", id, err)
+	}
+	return sub, nil
+}
+
+func (q *Queue) deploy(filename, code string) error {
+	path := filepath.Join(q.dir, filepath.FromSlash(filename))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(code))
+}
+
+func (q *Queue) deployed(filename string) bool {
+	_, err := os.Stat(filepath.Join(q.dir, filepath.FromSlash(filename)))
+	return err == nil
+}
+
+// pendingPath escapes the "/" of grouped automation IDs so all submissions
+// are files directly inside PendingDir
+func (q *Queue) pendingPath(id string) string {
+	return filepath.Join(q.dir, PendingDir, url.PathEscape(id)+".json")
+}
+
+// writeFileAtomic writes through a hidden temp file so the watcher never sees
+// a half-written automation
+func writeFileAtomic(path string, data []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// automationID checks that filename names a Starlark or declarative
+// automation, either top-level or in a group directory
+// ("lighting/hallway.star"), and returns its ID. Groups can't be hidden or be
+// the lib, blueprints or pending directories.
+func automationID(filename string) (string, error) {
+	parts := strings.Split(filename, "/")
+	for i, part := range parts {
+		if part == "" || strings.HasPrefix(part, ".") || strings.Contains(part, `\`) {
+			return "", fmt.Errorf("invalid filename %q", filename)
+		}
+		if i < len(parts)-1 && (part == "lib" || part == "blueprints" || part == PendingDir) {
+			return "", fmt.Errorf("invalid filename %q: %s/ is not an automation group", filename, part)
+		}
+	}
+	var id string
+	for _, ext := range extensions {
+		if strings.HasSuffix(filename, ext) && !strings.HasSuffix(filename, ".lib.star") {
+			id = strings.TrimSuffix(filename, ext)
+		}
+	}
+	if id == "" {
+		return "", fmt.Errorf("invalid filename %q: automations must end in .star or .auto.yaml", filename)
+	}
+	if !validID(id) {
+		return "", fmt.Errorf("invalid filename %q", filename)
+	}
+	return id, nil
+}
+
+// validID reports whether id is a relative automation ID without empty, "."
+// or ".." path elements
+func validID(id string) bool {
+	if strings.Contains(id, `\`) {
+		return false
+	}
+	for _, part := range strings.Split(id, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package approval
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSubmitStagesAgentCode(t *testing.T) {
+	dir := t.TempDir()
+	q, err := New(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, pending, err := q.Submit("lights.star", "def on_message(t, p, ctx): pass", RoleAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending || sub.ID != "lights" {
+		t.Fatalf("Submit() = %+v, pending=%v", sub, pending)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "lights.star")); !os.IsNotExist(err) {
+		t.Fatal("agent code deployed before approval")
+	}
+
+	subs, err := q.List()
+	if err != nil || len(subs) != 1 || subs[0].Code != "def on_message(t, p, ctx): pass" {
+		t.Fatalf("List() = %+v, %v", subs, err)
+	}
+
+	if _, err := q.Approve("lights"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "lights.star"))
+	if err != nil || string(data) != "def on_message(t, p, ctx): pass" {
+		t.Fatalf("approved file = %q, %v", data, err)
+	}
+	if _, err := q.Get("lights"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after approve error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSubmitDeploysDirectly(t *testing.T) {
+	tests := []struct {
+		name            string
+		role            string
+		requireApproval bool
+	}{
+		{"human", "human", true},
+		{"agent without approval", RoleAgent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			q, err := New(dir, tt.requireApproval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, pending, err := q.Submit("a.star", "x = 1", tt.role)
+			if err != nil || pending {
+				t.Fatalf("Submit() pending=%v err=%v", pending, err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "a.star")); err != nil {
+				t.Errorf("file not deployed: %v", err)
+			}
+		})
+	}
+}
+
+func TestReject(t *testing.T) {
+	q, err := New(t.TempDir(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := q.Submit("a.star", "x = 1", RoleAgent); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Reject("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Reject("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Reject() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSubmitRejectsBadFilenames(t *testing.T) {
+	q, err := New(t.TempDir(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "../a.star", "lib/a.lib.star", "a.lib.star", "a.py", ".star", ".hidden.star", "lib/a.star", "blueprints/a.star", "pending/a.star", "a.yaml", "lighting//a.star", "lighting/.git/a.star", "/a.star"} {
+		if _, _, err := q.Submit(name, "x = 1", RoleAgent); err == nil {
+			t.Errorf("Submit(%q) succeeded, want error", name)
+		}
+	}
+}
+
+func TestSubmitGrouped(t *testing.T) {
+	dir := t.TempDir()
+	q, err := New(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, pending, err := q.Submit("lighting/hallway.star", "x = 1", RoleAgent)
+	if err != nil || !pending || sub.ID != "lighting/hallway" {
+		t.Fatalf("Submit() = %+v, pending=%v, err=%v", sub, pending, err)
+	}
+	if subs, err := q.List(); err != nil || len(subs) != 1 || subs[0].ID != "lighting/hallway" {
+		t.Fatalf("List() = %+v, %v", subs, err)
+	}
+	if _, err := q.Approve("lighting/hallway"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "lighting", "hallway.star")); err != nil {
+		t.Fatalf("grouped automation not deployed: %v", err)
+	}
+
+	if err := q.Delete("lighting/hallway", "human"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "lighting", "hallway.star")); !os.IsNotExist(err) {
+		t.Error("grouped automation file still exists")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	dir := t.TempDir()
+	q, err := New(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := q.Submit("lights.star", "code", "human"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Delete("lights", RoleAgent); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("agent Delete() error = %v, want ErrApprovalRequired", err)
+	}
+	if err := q.Delete("lights", "human"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "lights.star")); !os.IsNotExist(err) {
+		t.Error("automation file still exists")
+	}
+
+	if _, _, err := q.Submit("kitchen_motion.auto.yaml", "blueprint: motion_light", "human"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Delete("kitchen_motion", "human"); err != nil {
+		t.Fatalf("Delete(declarative) error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kitchen_motion.auto.yaml")); !os.IsNotExist(err) {
+		t.Error("declarative automation file still exists")
+	}
+
+	for _, id := range []string{"lights", "../lights", "utils.lib", ""} {
+		if err := q.Delete(id, "human"); !errors.Is(err, ErrNotDeployed) {
+			t.Errorf("Delete(%q) error = %v, want ErrNotDeployed", id, err)
+		}
+	}
+}
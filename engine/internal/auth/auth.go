@@ -0,0 +1,332 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// Token scopes. Admin includes read; agent includes admin except token
+// management, and marks the caller as the LLM agent.
+const (
+	ScopeRead  = "read"  // GET routes and side-effect-free POSTs such as /validate
+	ScopeAdmin = "admin" // Everything else, including issuing tokens
+	ScopeAgent = "agent" // Admin routes as the agent, whose changes may need approval
+)
+
+var (
+	// ErrTokenExists is returned when issuing a token under a name in use
+	ErrTokenExists = errors.New("a token with this name already exists")
+
+	// ErrTokenNotFound is returned when revoking a token that doesn't exist
+	ErrTokenNotFound = errors.New("token not found")
+
+	// ErrStaticToken is returned when revoking a token from API_TOKENS
+	ErrStaticToken = errors.New("token is configured in API_TOKENS")
+)
+
+// validName is the form of token names
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Token is an API token without its secret
+type Token struct {
+	Name    string     `json:"name"`
+	Scope   string     `json:"scope"`
+	Static  bool       `json:"static"` // From API_TOKENS rather than issued through the API
+	Created *time.Time `json:"created,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+	hash    string
+}
+
+// allows reports whether the token grants scope
+func (t Token) allows(scope string) bool {
+	return t.Scope == ScopeAdmin || t.Scope == scope || t.Scope == ScopeAgent && scope == ScopeRead
+}
+
+// allowsRoute reports whether the token may use path, a route needing scope
+func (t Token) allowsRoute(scope, path string) bool {
+	if t.Scope == ScopeAgent && scope == ScopeAdmin {
+		return !strings.HasPrefix(path, "/auth/")
+	}
+	return t.allows(scope)
+}
+
+// tokenKey is the request context key of the authenticated Token
+type tokenKey struct{}
+
+// FromContext returns the token that authenticated a request, if the
+// middleware checked one
+func FromContext(ctx context.Context) (Token, bool) {
+	t, ok := ctx.Value(tokenKey{}).(Token)
+	return t, ok
+}
+
+// TokenStore persists issued tokens
+type TokenStore interface {
+	SaveAPIToken(token state.APIToken) error
+	DeleteAPIToken(name string) (bool, error)
+	ListAPITokens() ([]state.APIToken, error)
+}
+
+// Authenticator checks bearer tokens against the static tokens and the issued
+// ones. Without static tokens authentication is off and every request passes.
+type Authenticator struct {
+	mu     sync.RWMutex
+	tokens map[string]Token // By name
+	store  TokenStore       // nil keeps issued tokens in memory only
+	now    func() time.Time
+}
+
+// ParseTokens parses API_TOKENS, "name=scope:secret,...", into static tokens
+func ParseTokens(s string) ([]Token, error) {
+	var tokens []Token
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(item, "=")
+		scope, secret, ok2 := strings.Cut(spec, ":")
+		name, scope = strings.TrimSpace(name), strings.TrimSpace(scope)
+		if !ok || !ok2 || !validName.MatchString(name) || secret == "" {
+			return nil, fmt.Errorf("invalid API token %q (want name=scope:secret)", item)
+		}
+		if err := checkScope(scope); err != nil {
+			return nil, fmt.Errorf("API token %s: %w", name, err)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("API token %s is defined twice", name)
+		}
+		seen[name] = true
+		tokens = append(tokens, Token{Name: name, Scope: scope, Static: true, hash: hash(secret)})
+	}
+	return tokens, nil
+}
+
+func checkScope(scope string) error {
+	if scope != ScopeRead && scope != ScopeAdmin && scope != ScopeAgent {
+		return fmt.Errorf("unknown scope %q (want %s, %s or %s)", scope, ScopeRead, ScopeAdmin, ScopeAgent)
+	}
+	return nil
+}
+
+// New creates an authenticator from the static tokens and those issued
+// earlier into store
+func New(static []Token, store TokenStore) (*Authenticator, error) {
+	a := &Authenticator{tokens: make(map[string]Token), store: store, now: time.Now}
+	for _, t := range static {
+		a.tokens[t.Name] = t
+	}
+	if store == nil {
+		return a, nil
+	}
+	issued, err := store.ListAPITokens()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range issued {
+		if _, clash := a.tokens[t.Name]; clash {
+			continue // API_TOKENS wins
+		}
+		created := t.Created
+		a.tokens[t.Name] = Token{Name: t.Name, Scope: t.Scope, Created: &created, Expires: t.Expires, hash: t.Hash}
+	}
+	return a, nil
+}
+
+// Enabled reports whether requests must carry a token
+func (a *Authenticator) Enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, t := range a.tokens {
+		if t.Static {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate returns the token with the given secret, if it exists and
+// hasn't expired
+func (a *Authenticator) Authenticate(secret string) (Token, bool) {
+	if secret == "" {
+		return Token{}, false
+	}
+	h := hash(secret)
+	now := a.now()
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.hash), []byte(h)) != 1 {
+			continue
+		}
+		if t.Expires != nil && !now.Before(*t.Expires) {
+			return Token{}, false
+		}
+		return t, true
+	}
+	return Token{}, false
+}
+
+// Issue creates a token and returns it with its secret, which is not stored
+// and can't be shown again. A positive ttl makes the token expire.
+func (a *Authenticator) Issue(name, scope string, ttl time.Duration) (Token, string, error) {
+	if !validName.MatchString(name) {
+		return Token{}, "", fmt.Errorf("invalid token name %q (letters, digits, '_', '.' and '-', at most 64)", name)
+	}
+	if err := checkScope(scope); err != nil {
+		return Token{}, "", err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return Token{}, "", err
+	}
+	secret := "hb_" + hex.EncodeToString(buf)
+
+	now := a.now()
+	t := Token{Name: name, Scope: scope, Created: &now, hash: hash(secret)}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		t.Expires = &expires
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, exists := a.tokens[name]; exists {
+		return Token{}, "", ErrTokenExists
+	}
+	if a.store != nil {
+		err := a.store.SaveAPIToken(state.APIToken{Name: name, Scope: scope, Hash: t.hash, Created: now, Expires: t.Expires})
+		if err != nil {
+			return Token{}, "", err
+		}
+	}
+	a.tokens[name] = t
+	return t, secret, nil
+}
+
+// Revoke deletes an issued token
+func (a *Authenticator) Revoke(name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.tokens[name]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	if t.Static {
+		return ErrStaticToken
+	}
+	if a.store != nil {
+		if _, err := a.store.DeleteAPIToken(name); err != nil {
+			return err
+		}
+	}
+	delete(a.tokens, name)
+	return nil
+}
+
+// List returns all tokens without their secrets, ordered by name
+func (a *Authenticator) List() []Token {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	list := make([]Token, 0, len(a.tokens))
+	for _, t := range a.tokens {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// readPOSTs are POST routes without side effects, allowed with a read token
+var readPOSTs = []string{"/dry-run", "/validate", "/lint", "/grafana/"}
+
+// RequiredScope returns the scope a request needs, or "" for public routes:
+// the health check and incoming webhooks, which carry their own signatures.
+// Automation hooks without a secret check for a token themselves.
+func RequiredScope(method, path string) string {
+	switch {
+	case path == "/health":
+		return ""
+	case method == http.MethodPost && (strings.HasPrefix(path, "/webhooks/") || strings.HasPrefix(path, "/hooks/")):
+		return ""
+	case strings.HasPrefix(path, "/auth/"):
+		return ScopeAdmin
+	case method == http.MethodGet || method == http.MethodHead:
+		return ScopeRead
+	case method == http.MethodPost:
+		for _, p := range readPOSTs {
+			if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+				return ScopeRead
+			}
+		}
+		if strings.HasPrefix(path, "/automations/") && strings.HasSuffix(path, "/test") {
+			return ScopeRead // Tests run in the sandbox
+		}
+	}
+	return ScopeAdmin
+}
+
+// Middleware rejects requests without a token granting the route's scope:
+// 401 for a missing or unknown token, 403 for a read token on an admin route.
+// The token is read from "Authorization: Bearer <secret>", or from the
+// access_token query parameter for clients such as EventSource that can't
+// set headers.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		scope := RequiredScope(req.Method, req.URL.Path)
+		if scope == "" || !a.Enabled() {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		t, ok := a.Authenticate(requestSecret(req))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="homebrain"`)
+			http.Error(w, "Missing or invalid API token", http.StatusUnauthorized)
+			return
+		}
+		if !t.allowsRoute(scope, req.URL.Path) {
+			http.Error(w, fmt.Sprintf("Token %s has scope %s; this route needs %s", t.Name, t.Scope, scope), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), tokenKey{}, t)))
+	})
+}
+
+// Allows reports whether the request may use a route needing scope. It is
+// for handlers of public routes that need a token only in some cases.
+func (a *Authenticator) Allows(req *http.Request, scope string) bool {
+	if !a.Enabled() {
+		return true
+	}
+	t, ok := a.Authenticate(requestSecret(req))
+	return ok && t.allows(scope)
+}
+
+// requestSecret reads the token from the Authorization header or the
+// access_token query parameter
+func requestSecret(req *http.Request) string {
+	secret, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		secret = req.URL.Query().Get("access_token")
+	}
+	return strings.TrimSpace(secret)
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
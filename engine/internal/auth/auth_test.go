@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+func TestParseTokens(t *testing.T) {
+	tokens, err := ParseTokens("dashboard=read:abc, agent=admin:d:e,,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0].Name != "dashboard" || tokens[0].Scope != ScopeRead || !tokens[0].Static || tokens[1].hash != hash("d:e") {
+		t.Fatalf("tokens = %+v", tokens)
+	}
+
+	for _, bad := range []string{"noequals", "x=read", "x=read:", "x=write:s", "=read:s", "a b=read:s", "x=read:a,x=admin:b", "x=human:s"} {
+		if _, err := ParseTokens(bad); err == nil {
+			t.Errorf("ParseTokens(%q) should fail", bad)
+		}
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"GET", "/health", ""},
+		{"POST", "/webhooks/github_push", ""},
+		{"POST", "/hooks/doorbell", ""},
+		{"GET", "/global-state", ScopeRead},
+		{"GET", "/library/utils", ScopeRead},
+		{"HEAD", "/automations", ScopeRead},
+		{"POST", "/validate", ScopeRead},
+		{"POST", "/grafana/query", ScopeRead},
+		{"POST", "/automations/hallway/test", ScopeRead},
+		{"POST", "/automations", ScopeAdmin},
+		{"POST", "/automations/hallway/trigger", ScopeAdmin},
+		{"PUT", "/flags/beta", ScopeAdmin},
+		{"DELETE", "/topics/a/b", ScopeAdmin},
+		{"GET", "/auth/tokens", ScopeAdmin},
+	}
+	for _, tt := range tests {
+		if got := RequiredScope(tt.method, tt.path); got != tt.want {
+			t.Errorf("RequiredScope(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func newTestAuthenticator(t *testing.T, static string) *Authenticator {
+	t.Helper()
+	store, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	tokens, err := ParseTokens(static)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(tokens, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestMiddleware(t *testing.T) {
+	a := newTestAuthenticator(t, "dashboard=read:r3ad,admin=admin:adm1n,agent=agent:ag3nt")
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name         string
+		method, path string
+		header       string
+		want         int
+	}{
+		{"public", "GET", "/health", "", http.StatusOK},
+		{"no token", "GET", "/global-state", "", http.StatusUnauthorized},
+		{"wrong token", "GET", "/global-state", "Bearer nope", http.StatusUnauthorized},
+		{"not bearer", "GET", "/global-state", "Basic r3ad", http.StatusUnauthorized},
+		{"read on read route", "GET", "/global-state", "Bearer r3ad", http.StatusOK},
+		{"read on admin route", "POST", "/automations", "Bearer r3ad", http.StatusForbidden},
+		{"admin on admin route", "POST", "/automations", "Bearer adm1n", http.StatusOK},
+		{"agent on read route", "GET", "/global-state", "Bearer ag3nt", http.StatusOK},
+		{"agent on admin route", "POST", "/automations", "Bearer ag3nt", http.StatusOK},
+		{"agent on token route", "GET", "/auth/tokens", "Bearer ag3nt", http.StatusForbidden},
+		{"query parameter", "GET", "/global-state/stream?access_token=r3ad", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_TokenOnContext(t *testing.T) {
+	a := newTestAuthenticator(t, "agent=agent:ag3nt")
+	var got Token
+	var ok bool
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got, ok = FromContext(req.Context())
+	}))
+
+	req := httptest.NewRequest("POST", "/pending/hallway/approve", nil)
+	req.Header.Set("Authorization", "Bearer ag3nt")
+	req.Header.Set("X-Role", "human")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !ok || got.Name != "agent" || got.Scope != ScopeAgent {
+		t.Errorf("FromContext() = %+v, %v", got, ok)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	if ok {
+		t.Error("public routes should carry no token")
+	}
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("FromContext found a token outside a request")
+	}
+}
+
+func TestAllows(t *testing.T) {
+	a := newTestAuthenticator(t, "dashboard=read:r3ad,admin=admin:adm1n")
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"/hooks/doorbell", false},
+		{"/hooks/doorbell?access_token=r3ad", false},
+		{"/hooks/doorbell?access_token=adm1n", true},
+	}
+	for _, tt := range tests {
+		if got := a.Allows(httptest.NewRequest("POST", tt.target, nil), ScopeAdmin); got != tt.want {
+			t.Errorf("Allows(%s) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+	if !newTestAuthenticator(t, "").Allows(httptest.NewRequest("POST", "/hooks/doorbell", nil), ScopeAdmin) {
+		t.Error("Allows should pass every request while authentication is off")
+	}
+}
+
+func TestMiddleware_DisabledWithoutStaticTokens(t *testing.T) {
+	a := newTestAuthenticator(t, "")
+	if _, _, err := a.Issue("ci", ScopeRead, 0); err != nil {
+		t.Fatal(err)
+	}
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/automations", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want auth off", rec.Code)
+	}
+}
+
+func TestIssueAndRevoke(t *testing.T) {
+	a := newTestAuthenticator(t, "admin=admin:adm1n")
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	token, secret, err := a.Issue("grafana", ScopeRead, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Expires == nil || !token.Expires.Equal(now.Add(time.Hour)) || len(secret) < 32 {
+		t.Fatalf("token = %+v, secret = %q", token, secret)
+	}
+	if got, ok := a.Authenticate(secret); !ok || got.Name != "grafana" || got.Scope != ScopeRead {
+		t.Errorf("Authenticate = %+v, %v", got, ok)
+	}
+
+	if _, _, err := a.Issue("grafana", ScopeRead, 0); err != ErrTokenExists {
+		t.Errorf("duplicate Issue error = %v", err)
+	}
+	if _, _, err := a.Issue("admin", ScopeRead, 0); err != ErrTokenExists {
+		t.Errorf("Issue over a static token error = %v", err)
+	}
+	if _, _, err := a.Issue("x", "write", 0); err == nil {
+		t.Error("Issue with unknown scope should fail")
+	}
+
+	// Issued tokens survive a restart
+	b, err := New(nil, a.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Authenticate(secret); !ok {
+		t.Error("issued token lost after restart")
+	}
+
+	// Expired
+	a.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if _, ok := a.Authenticate(secret); ok {
+		t.Error("expired token accepted")
+	}
+
+	if err := a.Revoke("admin"); err != ErrStaticToken {
+		t.Errorf("Revoke static error = %v", err)
+	}
+	if err := a.Revoke("grafana"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Revoke("grafana"); err != ErrTokenNotFound {
+		t.Errorf("second Revoke error = %v", err)
+	}
+	if list := a.List(); len(list) != 1 || list[0].Name != "admin" {
+		t.Errorf("List = %+v", list)
+	}
+}
@@ -0,0 +1,33 @@
+package connector
+
+import (
+	"strings"
+)
+
+// InjectFunc delivers an incoming message to the engine's dispatch path
+type InjectFunc func(topic string, payload []byte)
+
+// Connector bridges an external message system (NATS, Kafka) into the engine.
+// Incoming messages are injected under "<name>/<subject>"; outgoing messages
+// are sent with ctx.publish(..., sink="<name>").
+type Connector interface {
+	Name() string
+	Publish(subject string, payload []byte) error
+	Close() error
+}
+
+// InternalTopic returns the topic automations subscribe to for an external subject
+func InternalTopic(name, subject string) string {
+	return name + "/" + subject
+}
+
+// ParseList splits a comma-separated list of subjects, ignoring blanks
+func ParseList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,30 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{"telemetry.>", []string{"telemetry.>"}},
+		{"a, b ,,c", []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		result := ParseList(tt.input)
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("ParseList(%q) = %v, want %v", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestInternalTopic(t *testing.T) {
+	if got := InternalTopic("nats", "telemetry.power"); got != "nats/telemetry.power" {
+		t.Errorf("InternalTopic = %q, want nats/telemetry.power", got)
+	}
+}
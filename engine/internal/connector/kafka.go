@@ -0,0 +1,85 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka bridges Kafka topics into the engine
+type Kafka struct {
+	readers []*kafka.Reader
+	writer  *kafka.Writer
+	cancel  context.CancelFunc
+}
+
+// NewKafka starts a consumer group reader per topic and a writer for publishing
+func NewKafka(brokers []string, groupID string, topics []string, inject InjectFunc) (*Kafka, error) {
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("at least one Kafka broker is required")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k := &Kafka{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Balancer:     &kafka.LeastBytes{},
+			BatchTimeout: 10 * time.Millisecond,
+		},
+		cancel: cancel,
+	}
+
+	for _, topic := range topics {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			GroupID: groupID,
+			Topic:   topic,
+		})
+		k.readers = append(k.readers, reader)
+		go k.consume(ctx, reader, inject)
+	}
+	return k, nil
+}
+
+func (k *Kafka) consume(ctx context.Context, reader *kafka.Reader, inject InjectFunc) {
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			slog.Warn("Kafka read failed", "topic", reader.Config().Topic, "error", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		inject(InternalTopic("kafka", msg.Topic), msg.Value)
+	}
+}
+
+// Name returns the sink name used by ctx.publish
+func (k *Kafka) Name() string {
+	return "kafka"
+}
+
+// Publish writes a message to a Kafka topic
+func (k *Kafka) Publish(topic string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := k.writer.WriteMessages(ctx, kafka.Message{Topic: topic, Value: payload}); err != nil {
+		return fmt.Errorf("failed to publish to Kafka topic %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Close stops consumers and flushes the writer
+func (k *Kafka) Close() error {
+	k.cancel()
+	for _, reader := range k.readers {
+		reader.Close()
+	}
+	return k.writer.Close()
+}
@@ -0,0 +1,63 @@
+package connector
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS bridges NATS subjects into the engine
+type NATS struct {
+	conn *nats.Conn
+	subs []*nats.Subscription
+}
+
+// NewNATS connects to a NATS server and subscribes to the given subjects
+// (wildcards such as "telemetry.>" are supported)
+func NewNATS(url string, subjects []string, inject InjectFunc) (*NATS, error) {
+	conn, err := nats.Connect(url,
+		nats.Name("homebrain-engine"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			slog.Warn("NATS connection lost", "error", err)
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			slog.Info("NATS reconnected")
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	n := &NATS{conn: conn}
+	for _, subject := range subjects {
+		sub, err := conn.Subscribe(subject, func(msg *nats.Msg) {
+			inject(InternalTopic("nats", msg.Subject), msg.Data)
+		})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to subscribe to NATS subject %s: %w", subject, err)
+		}
+		n.subs = append(n.subs, sub)
+	}
+	return n, nil
+}
+
+// Name returns the sink name used by ctx.publish
+func (n *NATS) Name() string {
+	return "nats"
+}
+
+// Publish sends a message to a NATS subject
+func (n *NATS) Publish(subject string, payload []byte) error {
+	if err := n.conn.Publish(subject, payload); err != nil {
+		return fmt.Errorf("failed to publish to NATS subject %s: %w", subject, err)
+	}
+	return nil
+}
+
+// Close drains subscriptions and closes the connection
+func (n *NATS) Close() error {
+	return n.conn.Drain()
+}
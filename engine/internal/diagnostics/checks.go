@@ -0,0 +1,154 @@
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/homebrain/engine/internal/mqtt"
+	"github.com/homebrain/engine/internal/runner"
+)
+
+// brokerProbeTopic carries the broker round-trip probe
+const brokerProbeTopic = "homebrain/diagnostics/ping"
+
+// stateProbeKey is written and cleared by the state store check
+const stateProbeKey = "homebrain.diagnostics.probe"
+
+// Broker is the part of the MQTT client used by the broker check
+type Broker interface {
+	IsConnected() bool
+	Subscribe(topic string, handler mqtt.MessageHandler) error
+	Unsubscribe(topic string) error
+	Publish(topic string, payload []byte, opts mqtt.PublishOptions) error
+}
+
+// brokerMu keeps concurrent broker checks from unsubscribing each other's probe
+var brokerMu sync.Mutex
+
+// BrokerRoundTrip publishes a probe message and times how long it takes to
+// come back through a subscription
+func BrokerRoundTrip(broker Broker) Check {
+	return Check{Name: "mqtt_broker", Run: func(ctx context.Context) Result {
+		if !broker.IsConnected() {
+			return Result{Status: StatusFail, Detail: "not connected to the broker"}
+		}
+
+		brokerMu.Lock()
+		defer brokerMu.Unlock()
+		nonce := strconv.FormatInt(time.Now().UnixNano(), 10)
+		received := make(chan struct{}, 1)
+		err := broker.Subscribe(brokerProbeTopic, func(topic string, payload []byte) {
+			if string(payload) != nonce {
+				return
+			}
+			select {
+			case received <- struct{}{}:
+			default: // QoS 1 may deliver twice
+			}
+		})
+		if err != nil {
+			return Result{Status: StatusFail, Detail: err.Error()}
+		}
+		defer broker.Unsubscribe(brokerProbeTopic)
+
+		start := time.Now()
+		if err := broker.Publish(brokerProbeTopic, []byte(nonce), mqtt.PublishOptions{QoS: mqtt.DefaultQoS}); err != nil {
+			return Result{Status: StatusFail, Detail: err.Error()}
+		}
+		select {
+		case <-received:
+			latency := time.Since(start)
+			return Result{Status: StatusOK, LatencyMs: ms(latency), Detail: "publish/subscribe round trip " + latency.Round(time.Microsecond).String()}
+		case <-ctx.Done():
+			return Result{Status: StatusFail, Detail: "probe message never came back"}
+		}
+	}, Probe: true}
+}
+
+// StateStore is the part of the state store used by the state check
+type StateStore interface {
+	SetGlobalState(key string, value any) error
+	GetGlobalState(key string) (any, error)
+	ClearGlobalState(key string) error
+}
+
+// StateReadWrite writes, reads back and clears a probe key, timing the round trip
+func StateReadWrite(store StateStore) Check {
+	return Check{Name: "state_store", Run: func(ctx context.Context) Result {
+		nonce := strconv.FormatInt(time.Now().UnixNano(), 10)
+		start := time.Now()
+		if err := store.SetGlobalState(stateProbeKey, nonce); err != nil {
+			return Result{Status: StatusFail, Detail: "write failed: " + err.Error()}
+		}
+		written := time.Since(start)
+		value, err := store.GetGlobalState(stateProbeKey)
+		latency := time.Since(start)
+		store.ClearGlobalState(stateProbeKey)
+		if err != nil {
+			return Result{Status: StatusFail, Detail: "read failed: " + err.Error()}
+		}
+		if value != nonce {
+			return Result{Status: StatusFail, Detail: fmt.Sprintf("read back %v, wrote %s", value, nonce)}
+		}
+		return Result{
+			Status:    StatusOK,
+			LatencyMs: ms(latency),
+			Detail:    fmt.Sprintf("write %s, read %s", written.Round(time.Microsecond), (latency - written).Round(time.Microsecond)),
+		}
+	}, Probe: true}
+}
+
+// LoadError is an automation file that failed to load
+type LoadError struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// AutomationLoadErrors fails when any automation file failed to load
+func AutomationLoadErrors(list func() []LoadError) Check {
+	return Check{Name: "automations", Run: func(ctx context.Context) Result {
+		errs := list()
+		if len(errs) == 0 {
+			return Result{Status: StatusOK, Detail: "all automation files loaded"}
+		}
+		return Result{Status: StatusFail, Detail: fmt.Sprintf("%d automation file(s) failed to load", len(errs)), Data: errs}
+	}}
+}
+
+// AdditionalBrokers warns while any of the additional MQTT brokers is
+// disconnected; automations on the main broker keep working
+func AdditionalBrokers(list func() []mqtt.BrokerStatus) Check {
+	return Check{Name: "mqtt_brokers", Run: func(ctx context.Context) Result {
+		brokers := list()
+		var down []string
+		for _, b := range brokers {
+			if !b.Connected {
+				down = append(down, b.Name)
+			}
+		}
+		if len(down) > 0 {
+			return Result{Status: StatusWarn, Detail: "not connected to " + strings.Join(down, ", "), Data: brokers}
+		}
+		return Result{Status: StatusOK, Detail: fmt.Sprintf("%d additional broker(s) connected", len(brokers)), Data: brokers}
+	}}
+}
+
+// WatchdogStalls fails while the watchdog reports a stalled subsystem,
+// including the goroutine stacks captured when the stall was detected
+func WatchdogStalls(list func() []runner.Stall) Check {
+	return Check{Name: "watchdog", Run: func(ctx context.Context) Result {
+		stalls := list()
+		if len(stalls) == 0 {
+			return Result{Status: StatusOK, Detail: "dispatch, scheduler and MQTT callbacks responsive"}
+		}
+		names := make([]string, len(stalls))
+		for i, s := range stalls {
+			names[i] = s.Subsystem
+		}
+		return Result{Status: StatusFail, Detail: "stalled: " + strings.Join(names, ", "), Data: stalls}
+	}}
+}
@@ -0,0 +1,104 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultNTPServer is queried for the clock skew check
+	DefaultNTPServer = "pool.ntp.org"
+
+	// Skew beyond these thresholds warns, or fails: cron schedules, timers and
+	// TLS certificate checks all depend on the local clock
+	clockSkewWarn = time.Second
+	clockSkewFail = 30 * time.Second
+)
+
+// ntpEpochOffset is the number of seconds between 1900 (NTP) and 1970 (Unix)
+const ntpEpochOffset = 2208988800
+
+// ClockSkew compares the local clock with an NTP server. An empty server skips the check.
+func ClockSkew(server string) Check {
+	return Check{Name: "clock_skew", Run: func(ctx context.Context) Result {
+		if server == "" {
+			return Result{Status: StatusSkipped, Detail: "no NTP server configured"}
+		}
+		skew, rtt, err := queryNTP(ctx, server)
+		if err != nil {
+			// An unreachable NTP server says nothing about the clock itself
+			return Result{Status: StatusWarn, Detail: fmt.Sprintf("could not query %s: %v", server, err)}
+		}
+		status := StatusOK
+		abs := skew.Abs()
+		switch {
+		case abs > clockSkewFail:
+			status = StatusFail
+		case abs > clockSkewWarn:
+			status = StatusWarn
+		}
+		return Result{
+			Status:    status,
+			LatencyMs: ms(rtt),
+			Detail:    fmt.Sprintf("local clock is %s off %s", skew.Round(time.Millisecond), server),
+			Data:      map[string]float64{"skew_ms": ms(skew)},
+		}
+	}}
+}
+
+// queryNTP sends one SNTP (RFC 4330) request and returns how far the local
+// clock is ahead of the server (negative if behind) and the round-trip time
+func queryNTP(ctx context.Context, server string) (time.Duration, time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // LI 0, version 4, mode 3 (client)
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, 0, err
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return 0, 0, err
+	}
+	received := time.Now()
+	if n < 48 {
+		return 0, 0, fmt.Errorf("short NTP response (%d bytes)", n)
+	}
+	if mode := resp[0] & 0x07; mode != 4 {
+		return 0, 0, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+	if resp[1] == 0 {
+		return 0, 0, fmt.Errorf("NTP server sent a kiss-of-death packet")
+	}
+
+	serverReceived := ntpTime(resp[32:40])
+	serverSent := ntpTime(resp[40:48])
+	// Clock offset per RFC 4330: ((T2 - T1) + (T3 - T4)) / 2, negated so that
+	// a positive skew means the local clock is ahead
+	offset := (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	rtt := received.Sub(sent) - serverSent.Sub(serverReceived)
+	return -offset, rtt, nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:]))
+	return time.Unix(seconds, fraction*1e9>>32)
+}
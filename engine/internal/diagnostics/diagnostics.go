@@ -0,0 +1,114 @@
+package diagnostics
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Check statuses, from best to worst
+const (
+	StatusOK      = "ok"
+	StatusSkipped = "skipped" // The check doesn't apply to this setup
+	StatusWarn    = "warn"
+	StatusFail    = "fail"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Detail     string  `json:"detail,omitempty"`
+	LatencyMs  float64 `json:"latency_ms,omitempty"` // Measured round trip, for checks that time one
+	DurationMs float64 `json:"duration_ms"`
+	Data       any     `json:"data,omitempty"`
+}
+
+// Check is one named self-test
+type Check struct {
+	Name  string
+	Run   func(ctx context.Context) Result
+	Probe bool // Publishes or writes something, so it only runs on request
+}
+
+// Report is the outcome of a diagnostics run. Status is the worst check status.
+type Report struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	Checks []Result  `json:"checks"`
+}
+
+// Run executes the checks concurrently, giving each up to timeout. Checks
+// still running when it expires are reported as failed.
+func Run(ctx context.Context, checks []Check, timeout time.Duration) Report {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Time: time.Now(), Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = runCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if severity(result.Status) > severity(report.Status) {
+			report.Status = result.Status
+		}
+	}
+	if report.Status == StatusSkipped {
+		report.Status = StatusOK
+	}
+	return report
+}
+
+// WithoutProbes returns checks with every probe replaced by one reporting it
+// skipped, for reports that must not touch the broker or the state store
+func WithoutProbes(checks []Check) []Check {
+	result := make([]Check, len(checks))
+	for i, check := range checks {
+		if check.Probe {
+			check = Check{Name: check.Name, Run: func(context.Context) Result {
+				return Result{Status: StatusSkipped, Detail: "live probe, only run on request"}
+			}}
+		}
+		result[i] = check
+	}
+	return result
+}
+
+func runCheck(ctx context.Context, check Check) Result {
+	start := time.Now()
+	done := make(chan Result, 1)
+	go func() { done <- check.Run(ctx) }()
+
+	var result Result
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result = Result{Status: StatusFail, Detail: "timed out"}
+	}
+	result.Name = check.Name
+	result.DurationMs = ms(time.Since(start))
+	return result
+}
+
+func severity(status string) int {
+	switch status {
+	case StatusSkipped:
+		return 1
+	case StatusWarn:
+		return 2
+	case StatusFail:
+		return 3
+	}
+	return 0
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
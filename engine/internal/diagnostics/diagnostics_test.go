@@ -0,0 +1,281 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/mqtt"
+	"github.com/homebrain/engine/internal/runner"
+)
+
+func TestRun_WorstStatusWins(t *testing.T) {
+	fixed := func(name, status string) Check {
+		return Check{Name: name, Run: func(context.Context) Result { return Result{Status: status} }}
+	}
+	slow := Check{Name: "slow", Run: func(ctx context.Context) Result {
+		time.Sleep(time.Second)
+		return Result{Status: StatusOK}
+	}}
+
+	tests := []struct {
+		name   string
+		checks []Check
+		want   string
+	}{
+		{"all ok", []Check{fixed("a", StatusOK), fixed("b", StatusOK)}, StatusOK},
+		{"skipped counts as ok", []Check{fixed("a", StatusOK), fixed("b", StatusSkipped)}, StatusOK},
+		{"warn", []Check{fixed("a", StatusWarn), fixed("b", StatusSkipped)}, StatusWarn},
+		{"fail", []Check{fixed("a", StatusWarn), fixed("b", StatusFail)}, StatusFail},
+		{"timeout fails", []Check{fixed("a", StatusOK), slow}, StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Run(context.Background(), tt.checks, 50*time.Millisecond)
+			if report.Status != tt.want {
+				t.Errorf("Status = %q, want %q (%+v)", report.Status, tt.want, report.Checks)
+			}
+			for i, result := range report.Checks {
+				if result.Name != tt.checks[i].Name {
+					t.Errorf("Checks[%d].Name = %q, want %q", i, result.Name, tt.checks[i].Name)
+				}
+			}
+		})
+	}
+}
+
+func TestWithoutProbes(t *testing.T) {
+	probed := false
+	checks := []Check{
+		{Name: "probe", Probe: true, Run: func(context.Context) Result { probed = true; return Result{Status: StatusFail} }},
+		{Name: "disk", Run: func(context.Context) Result { return Result{Status: StatusWarn} }},
+	}
+	report := Run(context.Background(), WithoutProbes(checks), time.Second)
+	if probed {
+		t.Error("probe ran")
+	}
+	if report.Status != StatusWarn || report.Checks[0].Name != "probe" || report.Checks[0].Status != StatusSkipped {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+// loopbackBroker delivers published messages to its subscribers
+type loopbackBroker struct {
+	mu        sync.Mutex
+	connected bool
+	drop      bool
+	handlers  map[string]mqtt.MessageHandler
+}
+
+func (b *loopbackBroker) IsConnected() bool { return b.connected }
+
+func (b *loopbackBroker) Subscribe(topic string, handler mqtt.MessageHandler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.handlers == nil {
+		b.handlers = make(map[string]mqtt.MessageHandler)
+	}
+	b.handlers[topic] = handler
+	return nil
+}
+
+func (b *loopbackBroker) Unsubscribe(topic string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.handlers, topic)
+	return nil
+}
+
+func (b *loopbackBroker) Publish(topic string, payload []byte, opts mqtt.PublishOptions) error {
+	b.mu.Lock()
+	handler := b.handlers[topic]
+	b.mu.Unlock()
+	if handler != nil && !b.drop {
+		go handler(topic, payload)
+		go handler(topic, payload)
+	}
+	return nil
+}
+
+func TestBrokerRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		broker *loopbackBroker
+		want   string
+	}{
+		{"round trip", &loopbackBroker{connected: true}, StatusOK},
+		{"disconnected", &loopbackBroker{}, StatusFail},
+		{"message lost", &loopbackBroker{connected: true, drop: true}, StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if got := BrokerRoundTrip(tt.broker).Run(ctx); got.Status != tt.want {
+				t.Errorf("result = %+v, want status %q", got, tt.want)
+			}
+			if len(tt.broker.handlers) != 0 {
+				t.Error("probe subscription left behind")
+			}
+		})
+	}
+}
+
+type memStore struct {
+	values   map[string]any
+	failRead bool
+}
+
+func (s *memStore) SetGlobalState(key string, value any) error {
+	s.values[key] = value
+	return nil
+}
+
+func (s *memStore) GetGlobalState(key string) (any, error) {
+	if s.failRead {
+		return nil, errors.New("disk I/O error")
+	}
+	return s.values[key], nil
+}
+
+func (s *memStore) ClearGlobalState(key string) error {
+	delete(s.values, key)
+	return nil
+}
+
+func TestStateReadWrite(t *testing.T) {
+	store := &memStore{values: map[string]any{}}
+	result := StateReadWrite(store).Run(context.Background())
+	if result.Status != StatusOK {
+		t.Errorf("result = %+v", result)
+	}
+	if len(store.values) != 0 {
+		t.Errorf("probe key left behind: %v", store.values)
+	}
+
+	store.failRead = true
+	result = StateReadWrite(store).Run(context.Background())
+	if result.Status != StatusFail || !strings.Contains(result.Detail, "disk I/O error") {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestAutomationLoadErrors(t *testing.T) {
+	var errs []LoadError
+	check := AutomationLoadErrors(func() []LoadError { return errs })
+	if result := check.Run(context.Background()); result.Status != StatusOK {
+		t.Errorf("result = %+v", result)
+	}
+	errs = []LoadError{{File: "/app/automations/broken.star", Error: "syntax error"}}
+	if result := check.Run(context.Background()); result.Status != StatusFail || result.Data == nil {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestAdditionalBrokers(t *testing.T) {
+	brokers := []mqtt.BrokerStatus{{Name: "cloud", Connected: true}, {Name: "garage", Connected: true}}
+	check := AdditionalBrokers(func() []mqtt.BrokerStatus { return brokers })
+	if result := check.Run(context.Background()); result.Status != StatusOK {
+		t.Errorf("result = %+v", result)
+	}
+	brokers[1].Connected = false
+	if result := check.Run(context.Background()); result.Status != StatusWarn || result.Detail != "not connected to garage" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestWatchdogStalls(t *testing.T) {
+	var stalls []runner.Stall
+	check := WatchdogStalls(func() []runner.Stall { return stalls })
+	if result := check.Run(context.Background()); result.Status != StatusOK {
+		t.Errorf("result = %+v", result)
+	}
+	stalls = []runner.Stall{{Subsystem: "cron", Detail: "scheduler hasn't ticked for 40s", Trace: "goroutine 1 [running]:"}}
+	result := check.Run(context.Background())
+	if result.Status != StatusFail || result.Detail != "stalled: cron" || result.Data == nil {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+// fakeNTP answers SNTP requests with the local time shifted by offset
+func fakeNTP(t *testing.T, offset time.Duration) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 48)
+		for {
+			_, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp := make([]byte, 48)
+			resp[0] = 0x24 // version 4, mode 4 (server)
+			resp[1] = 2    // stratum
+			now := time.Now().Add(offset)
+			putNTPTime(resp[32:40], now)
+			putNTPTime(resp[40:48], now)
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func putNTPTime(b []byte, ts time.Time) {
+	binary.BigEndian.PutUint32(b[:4], uint32(ts.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:], uint32((int64(ts.Nanosecond())<<32)/1e9))
+}
+
+func TestClockSkew(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset time.Duration
+		want   string
+	}{
+		{"in sync", 0, StatusOK},
+		{"local clock behind", 5 * time.Second, StatusWarn},
+		{"local clock far ahead", -time.Minute, StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Run(context.Background(), []Check{ClockSkew(fakeNTP(t, tt.offset))}, time.Second)
+			if got := report.Checks[0]; got.Status != tt.want {
+				t.Errorf("result = %+v, want status %q", got, tt.want)
+			}
+		})
+	}
+
+	if result := ClockSkew("").Run(context.Background()); result.Status != StatusSkipped {
+		t.Errorf("no server: result = %+v", result)
+	}
+}
+
+func TestQueryNTP_Sign(t *testing.T) {
+	skew, _, err := queryNTP(context.Background(), fakeNTP(t, -10*time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The server is 10s behind, so the local clock is 10s ahead
+	if skew < 9*time.Second || skew > 11*time.Second {
+		t.Errorf("skew = %s, want about 10s", skew)
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	result := DiskSpace(t.TempDir()).Run(context.Background())
+	if result.Status != StatusSkipped && result.Data == nil {
+		t.Errorf("result = %+v, want usage data", result)
+	}
+
+	if result := DiskSpace("/does/not/exist").Run(context.Background()); result.Status != StatusFail && result.Status != StatusSkipped {
+		t.Errorf("missing dir: result = %+v", result)
+	}
+}
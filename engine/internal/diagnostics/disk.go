@@ -0,0 +1,51 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Free space below these fractions of the filesystem warns, or fails: bbolt
+// needs room to grow the database and migrations back it up first
+const (
+	diskFreeWarn = 0.10
+	diskFreeFail = 0.02
+)
+
+var errDiskUsageUnsupported = errors.New("disk usage is not available on this platform")
+
+// DiskUsage is the space on the filesystem holding a path
+type DiskUsage struct {
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"` // Available to unprivileged users
+}
+
+// DiskSpace checks the free space on the filesystem holding dir
+func DiskSpace(dir string) Check {
+	return Check{Name: "disk_space", Run: func(ctx context.Context) Result {
+		usage, err := diskUsage(dir)
+		if err == errDiskUsageUnsupported {
+			return Result{Status: StatusSkipped, Detail: err.Error()}
+		}
+		if err != nil {
+			return Result{Status: StatusFail, Detail: err.Error()}
+		}
+		if usage.TotalBytes == 0 {
+			return Result{Status: StatusSkipped, Detail: "filesystem reports no size"}
+		}
+		free := float64(usage.FreeBytes) / float64(usage.TotalBytes)
+		status := StatusOK
+		switch {
+		case free < diskFreeFail:
+			status = StatusFail
+		case free < diskFreeWarn:
+			status = StatusWarn
+		}
+		return Result{
+			Status: status,
+			Detail: fmt.Sprintf("%.1f%% free (%d MiB of %d MiB) on %s", free*100, usage.FreeBytes>>20, usage.TotalBytes>>20, dir),
+			Data:   usage,
+		}
+	}}
+}
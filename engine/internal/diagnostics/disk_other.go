@@ -0,0 +1,7 @@
+//go:build !unix
+
+package diagnostics
+
+func diskUsage(dir string) (DiskUsage, error) {
+	return DiskUsage{}, errDiskUsageUnsupported
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package diagnostics
+
+import "syscall"
+
+func diskUsage(dir string) (DiskUsage, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return DiskUsage{}, err
+	}
+	return DiskUsage{
+		TotalBytes: fs.Blocks * uint64(fs.Bsize),
+		FreeBytes:  fs.Bavail * uint64(fs.Bsize),
+	}, nil
+}
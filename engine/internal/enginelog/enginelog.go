@@ -0,0 +1,198 @@
+package enginelog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultSize is how many records a Buffer keeps unless told otherwise
+const DefaultSize = 1000
+
+// Entry is one engine log record
+type Entry struct {
+	Seq     uint64         `json:"seq"` // Increases by one per record
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"message"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// Buffer keeps the most recent engine log records and feeds them to subscribers
+type Buffer struct {
+	mu          sync.Mutex
+	entries     []Entry
+	next        int // Index the next entry is written to once the ring is full
+	size        int
+	seq         uint64 // Sequence number of the last record
+	subscribers map[chan Entry]struct{}
+}
+
+// NewBuffer creates a buffer holding up to size records
+func NewBuffer(size int) *Buffer {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Buffer{
+		entries:     make([]Entry, 0, size),
+		size:        size,
+		subscribers: make(map[chan Entry]struct{}),
+	}
+}
+
+func (b *Buffer) add(e Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	e.Seq = b.seq
+	if len(b.entries) < b.size {
+		b.entries = append(b.entries, e)
+	} else {
+		b.entries[b.next] = e
+		b.next = (b.next + 1) % b.size
+	}
+	for ch := range b.subscribers {
+		// Slow subscribers miss records rather than blocking the logger
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Entries returns records at or above minLevel, oldest first, at most limit
+// of the newest ones (all of them if limit is 0)
+func (b *Buffer) Entries(minLevel slog.Level, limit int) []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]Entry, 0, len(b.entries))
+	for i := range b.entries {
+		e := b.entries[(b.next+i)%len(b.entries)]
+		if parseLevel(e.Level) >= minLevel {
+			result = append(result, e)
+		}
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
+
+// Subscribe returns a channel receiving new records and a func that ends the
+// subscription
+func (b *Buffer) Subscribe() (<-chan Entry, func()) {
+	ch := make(chan Entry, 64)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+// ParseLevel reads "debug", "info", "warn" or "error"
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid level %q (want debug, info, warn or error)", s)
+	}
+	return level, nil
+}
+
+func parseLevel(s string) slog.Level {
+	level, _ := ParseLevel(s)
+	return level
+}
+
+// Handler is a slog.Handler that records into a Buffer before passing records
+// on to another handler
+type Handler struct {
+	next   slog.Handler
+	buffer *Buffer
+	attrs  []slog.Attr // Added with WithAttrs, keys already qualified by group
+	group  string      // Dotted group prefix for attributes of later records
+}
+
+// NewHandler wraps next so its records are also kept in buffer
+func NewHandler(next slog.Handler, buffer *Buffer) *Handler {
+	return &Handler{next: next, buffer: buffer}
+}
+
+// Enabled follows the wrapped handler, so the buffer holds what is printed
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle records r and passes it on
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	e := Entry{Time: r.Time, Level: r.Level.String(), Message: r.Message}
+	if len(h.attrs) > 0 || r.NumAttrs() > 0 {
+		e.Attrs = make(map[string]any, len(h.attrs)+r.NumAttrs())
+		for _, a := range h.attrs {
+			addAttr(e.Attrs, "", a)
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			addAttr(e.Attrs, h.group, a)
+			return true
+		})
+	}
+	h.buffer.add(e)
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a handler adding attrs to every record
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	qualified := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	qualified = append(qualified, h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.group + a.Key
+		qualified = append(qualified, a)
+	}
+	return &Handler{next: h.next.WithAttrs(attrs), buffer: h.buffer, attrs: qualified, group: h.group}
+}
+
+// WithGroup returns a handler nesting later attributes under name
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &Handler{next: h.next.WithGroup(name), buffer: h.buffer, attrs: h.attrs, group: h.group + name + "."}
+}
+
+// addAttr flattens a into attrs under dotted keys
+func addAttr(attrs map[string]any, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		p := prefix
+		if a.Key != "" {
+			p += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			addAttr(attrs, p, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	switch v.Kind() {
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			attrs[prefix+a.Key] = err.Error()
+			return
+		}
+		if s, ok := v.Any().(fmt.Stringer); ok {
+			attrs[prefix+a.Key] = s.String()
+			return
+		}
+		attrs[prefix+a.Key] = v.Any()
+	case slog.KindDuration:
+		attrs[prefix+a.Key] = v.Duration().String()
+	default:
+		attrs[prefix+a.Key] = v.Any()
+	}
+}
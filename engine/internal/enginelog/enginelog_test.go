@@ -0,0 +1,93 @@
+package enginelog
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestHandler_RecordsAndForwards(t *testing.T) {
+	var out bytes.Buffer
+	buffer := NewBuffer(10)
+	logger := slog.New(NewHandler(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelInfo}), buffer))
+
+	logger.Debug("hidden")
+	logger.With("component", "watcher").WithGroup("file").Info("Reloaded", "path", "a.star")
+	logger.Error("MQTT connection lost", "error", errors.New("EOF"))
+
+	if !strings.Contains(out.String(), "Reloaded") || strings.Contains(out.String(), "hidden") {
+		t.Errorf("wrapped handler output = %q", out.String())
+	}
+	entries := buffer.Entries(slog.LevelDebug, 0)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2 (debug is below the handler level)", len(entries))
+	}
+	if got := entries[0].Attrs; got["component"] != "watcher" || got["file.path"] != "a.star" {
+		t.Errorf("attrs = %v", got)
+	}
+	if entries[1].Level != "ERROR" || entries[1].Attrs["error"] != "EOF" {
+		t.Errorf("entry = %+v", entries[1])
+	}
+}
+
+func TestBuffer_Entries(t *testing.T) {
+	buffer := NewBuffer(3)
+	logger := slog.New(NewHandler(slog.NewTextHandler(&bytes.Buffer{}, &slog.HandlerOptions{Level: slog.LevelDebug}), buffer))
+	for _, msg := range []string{"one", "two", "three", "four", "five"} {
+		logger.Info(msg)
+	}
+	logger.Warn("six")
+
+	tests := []struct {
+		name  string
+		level slog.Level
+		limit int
+		want  []string
+	}{
+		{"ring keeps newest", slog.LevelDebug, 0, []string{"four", "five", "six"}},
+		{"limit", slog.LevelDebug, 2, []string{"five", "six"}},
+		{"level filter", slog.LevelWarn, 0, []string{"six"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range buffer.Entries(tt.level, tt.limit) {
+				got = append(got, e.Message)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuffer_Subscribe(t *testing.T) {
+	buffer := NewBuffer(10)
+	logger := slog.New(NewHandler(slog.NewTextHandler(&bytes.Buffer{}, nil), buffer))
+
+	entries, stop := buffer.Subscribe()
+	logger.Info("first")
+	// Followers replay Entries after subscribing and skip what they saw by Seq
+	replayed := buffer.Entries(slog.LevelDebug, 0)
+	if e := <-entries; e.Message != "first" || len(replayed) != 1 || e.Seq != replayed[0].Seq {
+		t.Errorf("got %+v, replayed %+v", e, replayed)
+	}
+	stop()
+	logger.Info("second")
+	select {
+	case e := <-entries:
+		t.Errorf("received %q after unsubscribing", e.Message)
+	default:
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("warn"); err != nil || level != slog.LevelWarn {
+		t.Errorf("ParseLevel(warn) = %v, %v", level, err)
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("ParseLevel(loud) should fail")
+	}
+}
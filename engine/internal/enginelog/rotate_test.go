@@ -0,0 +1,66 @@
+package enginelog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engine.log")
+	f, err := OpenRotatingFile(path, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first line\n", "second line\n", "third line\n", "fourth line\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got := read(path); got != "fourth line\n" {
+		t.Errorf("current file = %q", got)
+	}
+	if got := read(path + ".1"); got != "third line\n" {
+		t.Errorf("first backup = %q", got)
+	}
+	if got := read(path + ".2"); got != "second line\n" {
+		t.Errorf("second backup = %q", got)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("backup beyond the limit kept: %v", err)
+	}
+
+	// An oversized record is written whole into a fresh file
+	long := strings.Repeat("x", 50) + "\n"
+	f.Write([]byte(long))
+	if got := read(path); got != long {
+		t.Errorf("oversized record = %q", got)
+	}
+}
+
+func TestRotatingFile_AppendsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engine.log")
+	for _, line := range []string{"a\n", "b\n"} {
+		f, err := OpenRotatingFile(path, 0, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(line))
+		f.Close()
+	}
+	if data, _ := os.ReadFile(path); string(data) != "a\nb\n" {
+		t.Errorf("file = %q", data)
+	}
+}
@@ -0,0 +1,333 @@
+package gitsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sync outcomes reported in Result.Status
+const (
+	StatusUpdated   = "updated"
+	StatusUnchanged = "unchanged"
+	StatusConflict  = "conflict"
+	StatusError     = "error"
+)
+
+// DefaultInterval is how often the remote is polled when no interval is configured
+const DefaultInterval = 5 * time.Minute
+
+// syncTimeout bounds one sync, including the fetch
+const syncTimeout = 2 * time.Minute
+
+// Config describes the remote the automations directory follows
+type Config struct {
+	Repo     string        // Clone URL; credentials may be embedded for HTTPS
+	Branch   string        // Defaults to "main"
+	Interval time.Duration // Polling interval; 0 syncs only on request
+}
+
+// FileResult is one file changed by a sync
+type FileResult struct {
+	File   string `json:"file"`
+	Change string `json:"change"`          // "added", "modified" or "deleted"
+	Error  string `json:"error,omitempty"` // Why the new version doesn't load
+}
+
+// Result describes one sync
+type Result struct {
+	Time      time.Time    `json:"time"`
+	Status    string       `json:"status"`
+	Repo      string       `json:"repo"` // Without credentials
+	Branch    string       `json:"branch"`
+	From      string       `json:"from,omitempty"` // Local commit before the sync
+	To        string       `json:"to,omitempty"`   // Local commit after the sync
+	Files     []FileResult `json:"files,omitempty"`
+	Conflicts []string     `json:"conflicts,omitempty"` // Files changed both locally and in the remote
+	Error     string       `json:"error,omitempty"`
+}
+
+// Syncer pulls a Git remote into the automations directory. Changed files
+// are picked up by the file watcher like any other edit; check reports why a
+// changed file would fail to load.
+type Syncer struct {
+	dir   string
+	cfg   Config
+	check func(path string) error
+
+	mu   sync.Mutex // Serializes syncs
+	last *Result
+}
+
+// New creates a syncer for dir. check is called for every added or modified
+// file and may be nil.
+func New(dir string, cfg Config, check func(path string) error) (*Syncer, error) {
+	if cfg.Repo == "" {
+		return nil, fmt.Errorf("no repository configured")
+	}
+	if cfg.Branch == "" {
+		cfg.Branch = "main"
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git is not installed: %w", err)
+	}
+	return &Syncer{dir: dir, cfg: cfg, check: check}, nil
+}
+
+// Start syncs every configured interval until ctx is done
+func (s *Syncer) Start(ctx context.Context) {
+	if s.cfg.Interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Sync(ctx)
+			}
+		}
+	}()
+}
+
+// Last returns the result of the most recent sync
+func (s *Syncer) Last() (Result, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil {
+		return Result{}, false
+	}
+	return *s.last, true
+}
+
+// Sync fetches the branch and merges it into the automations directory.
+// Local commits (such as the agent's) are kept; when they touch the same
+// lines as the remote, nothing is changed and the files are reported as
+// conflicts.
+func (s *Syncer) Sync(ctx context.Context) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+
+	result := Result{Time: time.Now(), Repo: redact(s.cfg.Repo), Branch: s.cfg.Branch}
+	if err := s.sync(ctx, &result); err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+	}
+
+	switch result.Status {
+	case StatusUpdated:
+		slog.Info("Git sync updated automations", "from", short(result.From), "to", short(result.To), "files", len(result.Files))
+		for _, f := range result.Files {
+			if f.Error != "" {
+				slog.Warn("Synced automation does not load", "file", f.File, "error", f.Error)
+			}
+		}
+	case StatusConflict:
+		slog.Warn("Git sync conflict, automations not updated", "files", result.Conflicts)
+	case StatusError:
+		slog.Error("Git sync failed", "repo", result.Repo, "error", result.Error)
+	default:
+		slog.Debug("Git sync: automations up to date")
+	}
+	s.last = &result
+	return result
+}
+
+func (s *Syncer) sync(ctx context.Context, result *Result) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	if err := s.ensureRemote(ctx); err != nil {
+		return err
+	}
+	if _, err := s.git(ctx, "fetch", "--quiet", "origin", s.cfg.Branch); err != nil {
+		return err
+	}
+	remote, err := s.git(ctx, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return err
+	}
+	head, err := s.git(ctx, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		// Nothing committed yet: check out the remote branch over the directory
+		result.To = remote
+		if _, err := s.git(ctx, "checkout", "-B", s.cfg.Branch, "FETCH_HEAD"); err != nil {
+			return s.conflictOrError(result, err)
+		}
+		files, err := s.git(ctx, "ls-tree", "-r", "--name-only", "HEAD")
+		if err != nil {
+			return err
+		}
+		for _, file := range lines(files) {
+			result.Files = append(result.Files, s.fileResult(file, "added"))
+		}
+		result.Status = StatusUpdated
+		return nil
+	}
+
+	result.From, result.To = head, head
+	if head == remote {
+		result.Status = StatusUnchanged
+		return nil
+	}
+	if _, err := s.git(ctx, "merge-base", "--is-ancestor", remote, head); err == nil {
+		result.Status = StatusUnchanged // Local commits are ahead of the remote
+		return nil
+	}
+
+	// Check for conflicts without touching the working tree, so the watcher
+	// never sees files with conflict markers
+	if out, err := s.git(ctx, "merge-tree", "--write-tree", "--name-only", "--no-messages", head, remote); err != nil {
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || exit.ExitCode() != 1 {
+			return err
+		}
+		result.Status = StatusConflict
+		if files := lines(out); len(files) > 1 {
+			result.Conflicts = files[1:] // After the tree ID
+		}
+		result.Error = "local and remote changes conflict; resolve them in the repository"
+		return nil
+	}
+
+	if _, err := s.git(ctx, "-c", "user.name=Homebrain Engine", "-c", "user.email=engine@homebrain.local",
+		"merge", "--no-edit", "--quiet", remote); err != nil {
+		return s.conflictOrError(result, err)
+	}
+	if result.To, err = s.git(ctx, "rev-parse", "HEAD"); err != nil {
+		return err
+	}
+	changes, err := s.git(ctx, "diff", "--name-status", "--no-renames", head, result.To)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines(changes) {
+		status, file, _ := strings.Cut(line, "\t")
+		change := "modified"
+		switch status {
+		case "A":
+			change = "added"
+		case "D":
+			change = "deleted"
+		}
+		result.Files = append(result.Files, s.fileResult(file, change))
+	}
+	result.Status = StatusUpdated
+	return nil
+}
+
+// ensureRemote makes the directory a repository whose origin is the
+// configured remote
+func (s *Syncer) ensureRemote(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(s.dir, ".git")); os.IsNotExist(err) {
+		if _, err := s.git(ctx, "init", "--quiet", "--initial-branch", s.cfg.Branch); err != nil {
+			return err
+		}
+	}
+	current, err := s.git(ctx, "remote", "get-url", "origin")
+	switch {
+	case err != nil:
+		_, err = s.git(ctx, "remote", "add", "origin", s.cfg.Repo)
+	case current != s.cfg.Repo:
+		_, err = s.git(ctx, "remote", "set-url", "origin", s.cfg.Repo)
+	}
+	return err
+}
+
+// conflictOrError turns git's list of files that a checkout or merge would
+// overwrite into a conflict result
+func (s *Syncer) conflictOrError(result *Result, err error) error {
+	var files []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if strings.HasPrefix(line, "\t") {
+			files = append(files, strings.TrimSpace(line))
+		}
+	}
+	if len(files) == 0 {
+		return err
+	}
+	result.Status = StatusConflict
+	result.Conflicts = files
+	result.Error = "local changes would be overwritten; commit or remove them"
+	return nil
+}
+
+func (s *Syncer) fileResult(file, change string) FileResult {
+	f := FileResult{File: file, Change: change}
+	if change != "deleted" && s.check != nil {
+		if err := s.check(filepath.Join(s.dir, file)); err != nil {
+			f.Error = err.Error()
+		}
+	}
+	return f
+}
+
+// git runs a git command in the automations directory and returns its
+// trimmed output. Errors include git's stderr.
+func (s *Syncer) git(ctx context.Context, args ...string) (string, error) {
+	// The directory is shared with the agent, which may run as another user
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", s.dir, "-c", "safe.directory=" + s.dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(strings.ReplaceAll(stderr.String(), s.cfg.Repo, redact(s.cfg.Repo)))
+		if msg == "" {
+			return stdout.String(), err
+		}
+		return stdout.String(), &gitError{args: args[0], msg: msg, err: err}
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitError is a failed git command with its stderr
+type gitError struct {
+	args string
+	msg  string
+	err  error
+}
+
+func (e *gitError) Error() string { return fmt.Sprintf("git %s: %s", e.args, e.msg) }
+func (e *gitError) Unwrap() error { return e.err }
+
+// redact drops credentials from a repository URL
+func redact(repo string) string {
+	u, err := url.Parse(repo)
+	if err != nil || u.User == nil {
+		return repo
+	}
+	u.User = nil
+	return u.String()
+}
+
+func lines(s string) []string {
+	var result []string
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+func short(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
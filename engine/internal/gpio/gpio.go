@@ -0,0 +1,202 @@
+package gpio
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSysfsPath is where the Linux kernel exposes the legacy GPIO interface
+const DefaultSysfsPath = "/sys/class/gpio"
+
+// Config describes which pins the engine reads and drives
+type Config struct {
+	Inputs       map[int]string // Input pin -> internal topic its changes are dispatched on
+	Outputs      []int          // Pins automations may write via ctx.gpio.write
+	PollInterval time.Duration  // How often input pins are sampled
+	Base         int            // Offset added to pin numbers (e.g. 512 on newer Raspberry Pi kernels)
+	SysfsPath    string         // Override for tests; defaults to DefaultSysfsPath
+}
+
+// InputHandler receives input pin changes as topic/payload pairs
+type InputHandler func(topic string, payload []byte)
+
+// Controller exports configured pins through sysfs and polls inputs for changes
+type Controller struct {
+	cfg      Config
+	onInput  InputHandler
+	outputs  map[int]bool
+	last     map[int]bool
+	mu       sync.Mutex
+	stopChan chan struct{}
+}
+
+// New exports all configured pins and starts polling inputs
+func New(cfg Config, onInput InputHandler) (*Controller, error) {
+	if cfg.SysfsPath == "" {
+		cfg.SysfsPath = DefaultSysfsPath
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 50 * time.Millisecond
+	}
+
+	c := &Controller{
+		cfg:      cfg,
+		onInput:  onInput,
+		outputs:  make(map[int]bool),
+		last:     make(map[int]bool),
+		stopChan: make(chan struct{}),
+	}
+
+	for pin := range cfg.Inputs {
+		if err := c.export(pin, "in"); err != nil {
+			return nil, err
+		}
+		value, err := c.Read(pin)
+		if err != nil {
+			return nil, err
+		}
+		c.last[pin] = value
+	}
+	for _, pin := range cfg.Outputs {
+		if err := c.export(pin, "out"); err != nil {
+			return nil, err
+		}
+		c.outputs[pin] = true
+	}
+
+	if len(cfg.Inputs) > 0 {
+		go c.poll()
+	}
+	return c, nil
+}
+
+// Write drives an output pin high (true) or low (false)
+func (c *Controller) Write(pin int, value bool) error {
+	if !c.outputs[pin] {
+		return fmt.Errorf("pin %d is not configured as an output", pin)
+	}
+	data := "0"
+	if value {
+		data = "1"
+	}
+	return os.WriteFile(c.pinFile(pin, "value"), []byte(data), 0644)
+}
+
+// Read returns the current level of a configured pin
+func (c *Controller) Read(pin int) (bool, error) {
+	if _, ok := c.cfg.Inputs[pin]; !ok && !c.outputs[pin] {
+		return false, fmt.Errorf("pin %d is not configured", pin)
+	}
+	data, err := os.ReadFile(c.pinFile(pin, "value"))
+	if err != nil {
+		return false, fmt.Errorf("failed to read pin %d: %w", pin, err)
+	}
+	return strings.TrimSpace(string(data)) == "1", nil
+}
+
+// Close stops input polling
+func (c *Controller) Close() {
+	close(c.stopChan)
+}
+
+func (c *Controller) poll() {
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			c.sample()
+		}
+	}
+}
+
+func (c *Controller) sample() {
+	for pin, topic := range c.cfg.Inputs {
+		value, err := c.Read(pin)
+		if err != nil {
+			slog.Warn("GPIO read failed", "pin", pin, "error", err)
+			continue
+		}
+
+		c.mu.Lock()
+		changed := c.last[pin] != value
+		c.last[pin] = value
+		c.mu.Unlock()
+
+		if changed && c.onInput != nil {
+			payload := "0"
+			if value {
+				payload = "1"
+			}
+			c.onInput(topic, []byte(payload))
+		}
+	}
+}
+
+func (c *Controller) export(pin int, direction string) error {
+	if _, err := os.Stat(c.pinDir(pin)); os.IsNotExist(err) {
+		num := strconv.Itoa(pin + c.cfg.Base)
+		if err := os.WriteFile(filepath.Join(c.cfg.SysfsPath, "export"), []byte(num), 0644); err != nil {
+			return fmt.Errorf("failed to export pin %d: %w", pin, err)
+		}
+	}
+	if err := os.WriteFile(c.pinFile(pin, "direction"), []byte(direction), 0644); err != nil {
+		return fmt.Errorf("failed to set direction of pin %d: %w", pin, err)
+	}
+	return nil
+}
+
+func (c *Controller) pinDir(pin int) string {
+	return filepath.Join(c.cfg.SysfsPath, fmt.Sprintf("gpio%d", pin+c.cfg.Base))
+}
+
+func (c *Controller) pinFile(pin int, name string) string {
+	return filepath.Join(c.pinDir(pin), name)
+}
+
+// ParsePinMap parses "17:gpio/doorbell,27:gpio/door" into a pin -> topic map
+func ParsePinMap(s string) (map[int]string, error) {
+	result := make(map[int]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pinStr, topic, ok := strings.Cut(item, ":")
+		if !ok || topic == "" {
+			return nil, fmt.Errorf("invalid pin mapping %q, expected pin:topic", item)
+		}
+		pin, err := strconv.Atoi(strings.TrimSpace(pinStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pin number %q", pinStr)
+		}
+		result[pin] = strings.TrimSpace(topic)
+	}
+	return result, nil
+}
+
+// ParsePins parses a comma-separated pin list such as "22,23"
+func ParsePins(s string) ([]int, error) {
+	var result []int
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pin, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pin number %q", item)
+		}
+		result = append(result, pin)
+	}
+	return result, nil
+}
@@ -0,0 +1,119 @@
+package gpio
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParsePinMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected map[int]string
+		wantErr  bool
+	}{
+		{"Empty", "", map[int]string{}, false},
+		{"Single", "17:gpio/doorbell", map[int]string{17: "gpio/doorbell"}, false},
+		{"Multiple with spaces", "17:gpio/doorbell, 27:gpio/door", map[int]string{17: "gpio/doorbell", 27: "gpio/door"}, false},
+		{"Missing topic", "17:", nil, true},
+		{"Missing separator", "17", nil, true},
+		{"Bad pin", "x:gpio/a", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParsePinMap(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePinMap(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(result) != len(tt.expected) {
+				t.Fatalf("ParsePinMap(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+			for pin, topic := range tt.expected {
+				if result[pin] != topic {
+					t.Errorf("pin %d = %q, want %q", pin, result[pin], topic)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePins(t *testing.T) {
+	pins, err := ParsePins("22, 23")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pins) != 2 || pins[0] != 22 || pins[1] != 23 {
+		t.Errorf("ParsePins = %v, want [22 23]", pins)
+	}
+
+	if _, err := ParsePins("22,abc"); err == nil {
+		t.Error("expected error for invalid pin")
+	}
+}
+
+// fakeSysfs creates pre-exported pin directories the way the kernel would
+func fakeSysfs(t *testing.T, pins ...int) string {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "export"), nil, 0644)
+	for _, pin := range pins {
+		pinDir := filepath.Join(dir, "gpio"+strconv.Itoa(pin))
+		os.MkdirAll(pinDir, 0755)
+		os.WriteFile(filepath.Join(pinDir, "value"), []byte("0\n"), 0644)
+	}
+	return dir
+}
+
+func TestWriteOutput(t *testing.T) {
+	dir := fakeSysfs(t, 22)
+	c, err := New(Config{Outputs: []int{22}, SysfsPath: dir}, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Write(22, true); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	value, err := c.Read(22)
+	if err != nil || !value {
+		t.Errorf("Read(22) = %v, %v, want true", value, err)
+	}
+
+	if err := c.Write(23, true); err == nil {
+		t.Error("expected error writing unconfigured pin")
+	}
+}
+
+func TestInputChangeDispatch(t *testing.T) {
+	dir := fakeSysfs(t, 17)
+	received := make(chan string, 1)
+	c, err := New(Config{
+		Inputs:       map[int]string{17: "gpio/doorbell"},
+		PollInterval: 5 * time.Millisecond,
+		SysfsPath:    dir,
+	}, func(topic string, payload []byte) {
+		received <- topic + "=" + string(payload)
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+
+	os.WriteFile(filepath.Join(dir, "gpio17", "value"), []byte("1\n"), 0644)
+
+	select {
+	case got := <-received:
+		if got != "gpio/doorbell=1" {
+			t.Errorf("received %q, want gpio/doorbell=1", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("input change was not dispatched")
+	}
+}
@@ -0,0 +1,316 @@
+// Package grafana serves global state history and run history over the
+// Grafana JSON datasource protocol, so both can be charted without a
+// separate time-series database.
+package grafana
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/homebrain/engine/internal/runner"
+	"github.com/homebrain/engine/internal/state"
+)
+
+// Target prefixes; "runs" and "errors" without an automation cover all of them
+const (
+	prefixGlobal   = "global"   // global:<key> - recorded values of a global key
+	prefixRuns     = "runs"     // runs:<id> - handler runs per interval
+	prefixErrors   = "errors"   // errors:<id> - failed runs per interval
+	prefixDuration = "duration" // duration:<id> - duration of each run in ms
+)
+
+// maxBuckets bounds the points of a counted series, whatever the interval
+const maxBuckets = 10000
+
+// History is the part of the state store the datasource reads
+type History interface {
+	GetAllGlobalState() (map[string]any, error)
+	GetGlobalHistory(key string, limit int) ([]state.HistoryEntry, error)
+}
+
+// Runs is the part of the runner the datasource reads
+type Runs interface {
+	ListAutomations() []runner.Automation
+	GetRuns(automationID string) []runner.RunRecord
+}
+
+// Query is the body of POST /query
+type Query struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	IntervalMs    int64    `json:"intervalMs"`
+	MaxDataPoints int      `json:"maxDataPoints"`
+	Targets       []Target `json:"targets"`
+}
+
+// Target is one query of a panel
+type Target struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"` // "timeserie" (default) or "table"
+}
+
+// Series is a time series response; datapoints are [value, unix ms] pairs
+type Series struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// Table is a table response
+type Table struct {
+	Type    string   `json:"type"`
+	RefID   string   `json:"refId,omitempty"`
+	Columns []Column `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// Column describes a table column
+type Column struct {
+	Text string `json:"text"`
+	Type string `json:"type,omitempty"` // "time", "number" or "string"
+}
+
+// Datasource answers Grafana JSON datasource requests
+type Datasource struct {
+	history History
+	runs    Runs
+}
+
+// New creates a datasource over the state store and the runner
+func New(history History, runs Runs) *Datasource {
+	return &Datasource{history: history, runs: runs}
+}
+
+// Handler serves the datasource endpoints (GET /, POST /search, POST /query),
+// relative to wherever it is mounted
+func (d *Datasource) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("POST /search", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Target string `json:"target"`
+		}
+		json.NewDecoder(req.Body).Decode(&body) // An empty body lists everything
+		targets, err := d.Search(body.Target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(targets)
+	})
+	mux.HandleFunc("POST /query", func(w http.ResponseWriter, req *http.Request) {
+		var query Query
+		if err := json.NewDecoder(req.Body).Decode(&query); err != nil {
+			http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := d.Query(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+	return mux
+}
+
+// Search lists the targets containing filter, sorted
+func (d *Datasource) Search(filter string) ([]string, error) {
+	global, err := d.history.GetAllGlobalState()
+	if err != nil {
+		return nil, err
+	}
+	targets := []string{prefixRuns, prefixErrors}
+	for key := range global {
+		targets = append(targets, prefixGlobal+":"+key)
+	}
+	for _, a := range d.runs.ListAutomations() {
+		targets = append(targets, prefixRuns+":"+a.ID, prefixErrors+":"+a.ID, prefixDuration+":"+a.ID)
+	}
+	sort.Strings(targets)
+
+	result := []string{}
+	for _, target := range targets {
+		if strings.Contains(target, filter) {
+			result = append(result, target)
+		}
+	}
+	return result, nil
+}
+
+// Query returns one Series or Table per target. Unknown targets yield empty series.
+func (d *Datasource) Query(q Query) ([]any, error) {
+	result := []any{}
+	for _, t := range q.Targets {
+		if t.Target == "" {
+			continue
+		}
+		if t.Type == "table" {
+			table, err := d.table(t.Target, q)
+			if err != nil {
+				return nil, err
+			}
+			table.RefID = t.RefID
+			result = append(result, table)
+			continue
+		}
+		series, err := d.series(t.Target, q)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, series)
+	}
+	return result, nil
+}
+
+func (d *Datasource) series(target string, q Query) (Series, error) {
+	series := Series{Target: target, Datapoints: [][2]float64{}}
+	kind, id, _ := strings.Cut(target, ":")
+	switch kind {
+	case prefixGlobal:
+		entries, err := d.globalHistory(id, q)
+		if err != nil {
+			return series, err
+		}
+		for _, entry := range entries {
+			if value, ok := number(entry.Value); ok && !entry.Cleared {
+				series.Datapoints = append(series.Datapoints, [2]float64{value, unixMs(entry.Time)})
+			}
+		}
+	case prefixDuration:
+		for _, run := range d.runsInRange(id, q) {
+			series.Datapoints = append(series.Datapoints, [2]float64{run.DurationMs, unixMs(run.Start)})
+		}
+	case prefixRuns, prefixErrors:
+		series.Datapoints = d.counts(kind, id, q)
+	}
+	return series, nil
+}
+
+// counts buckets the automation's runs (or failed runs) by the query interval,
+// including empty buckets so charts drop to zero
+func (d *Datasource) counts(kind, id string, q Query) [][2]float64 {
+	datapoints := [][2]float64{}
+	span := q.Range.To.Sub(q.Range.From)
+	if span <= 0 {
+		return datapoints
+	}
+	interval := time.Duration(q.IntervalMs) * time.Millisecond
+	if interval <= 0 && q.MaxDataPoints > 0 {
+		interval = span / time.Duration(q.MaxDataPoints)
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if span/interval >= maxBuckets {
+		interval = span/maxBuckets + 1
+	}
+
+	counts := make([]float64, span/interval+1)
+	for _, run := range d.runsInRange(id, q) {
+		if kind == prefixErrors && run.Error == "" {
+			continue
+		}
+		counts[run.Start.Sub(q.Range.From)/interval]++
+	}
+	for i, count := range counts {
+		datapoints = append(datapoints, [2]float64{count, unixMs(q.Range.From.Add(time.Duration(i) * interval))})
+	}
+	return datapoints
+}
+
+func (d *Datasource) table(target string, q Query) (Table, error) {
+	table := Table{Type: "table", Rows: [][]any{}}
+	kind, id, _ := strings.Cut(target, ":")
+	if kind == prefixGlobal {
+		table.Columns = []Column{{Text: "Time", Type: "time"}, {Text: id}}
+		entries, err := d.globalHistory(id, q)
+		if err != nil {
+			return table, err
+		}
+		for _, entry := range entries {
+			table.Rows = append(table.Rows, []any{unixMs(entry.Time), entry.Value})
+		}
+		return table, nil
+	}
+
+	table.Columns = []Column{
+		{Text: "Time", Type: "time"},
+		{Text: "Automation", Type: "string"},
+		{Text: "Handler", Type: "string"},
+		{Text: "Trigger", Type: "string"},
+		{Text: "Duration (ms)", Type: "number"},
+		{Text: "Error", Type: "string"},
+	}
+	if kind != prefixRuns && kind != prefixErrors && kind != prefixDuration {
+		return table, nil
+	}
+	for _, run := range d.runsInRange(id, q) {
+		if kind == prefixErrors && run.Error == "" {
+			continue
+		}
+		table.Rows = append(table.Rows, []any{unixMs(run.Start), run.AutomationID, run.Handler, run.Trigger.Type, run.DurationMs, run.Error})
+	}
+	return table, nil
+}
+
+// globalHistory returns the recorded writes of key within the range, oldest first
+func (d *Datasource) globalHistory(key string, q Query) ([]state.HistoryEntry, error) {
+	entries, err := d.history.GetGlobalHistory(key, state.MaxHistory)
+	if err != nil {
+		return nil, err
+	}
+	result := []state.HistoryEntry{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if inRange(entries[i].Time, q) {
+			result = append(result, entries[i])
+		}
+	}
+	return result, nil
+}
+
+// runsInRange returns the automation's runs (all when id is empty) started within the range
+func (d *Datasource) runsInRange(id string, q Query) []runner.RunRecord {
+	result := []runner.RunRecord{}
+	for _, run := range d.runs.GetRuns(id) {
+		if inRange(run.Start, q) {
+			result = append(result, run)
+		}
+	}
+	return result
+}
+
+func inRange(t time.Time, q Query) bool {
+	return !t.Before(q.Range.From) && !t.After(q.Range.To)
+}
+
+// number converts a state value to a plottable number; booleans are 0 and 1
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func unixMs(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
@@ -0,0 +1,181 @@
+package grafana
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/runner"
+	"github.com/homebrain/engine/internal/state"
+)
+
+var base = time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+
+type fakeHistory map[string][]state.HistoryEntry // Newest first, like the store
+
+func (h fakeHistory) GetAllGlobalState() (map[string]any, error) {
+	global := make(map[string]any)
+	for key, entries := range h {
+		global[key] = entries[0].Value
+	}
+	return global, nil
+}
+
+func (h fakeHistory) GetGlobalHistory(key string, limit int) ([]state.HistoryEntry, error) {
+	return h[key], nil
+}
+
+type fakeRuns []runner.RunRecord
+
+func (f fakeRuns) ListAutomations() []runner.Automation {
+	return []runner.Automation{{ID: "motion_light"}}
+}
+
+func (f fakeRuns) GetRuns(automationID string) []runner.RunRecord {
+	var result []runner.RunRecord
+	for _, run := range f {
+		if automationID == "" || run.AutomationID == automationID {
+			result = append(result, run)
+		}
+	}
+	return result
+}
+
+func newTestDatasource() *Datasource {
+	history := fakeHistory{
+		"climate.living_room.temperature": {
+			{Value: 21.5, Time: base.Add(20 * time.Minute)},
+			{Time: base.Add(15 * time.Minute), Cleared: true},
+			{Value: 20.0, Time: base.Add(10 * time.Minute)},
+			{Value: 19.0, Time: base.Add(-time.Hour)},
+		},
+		"presence.home": {
+			{Value: true, Time: base.Add(5 * time.Minute)},
+			{Value: "unknown", Time: base.Add(time.Minute)},
+		},
+	}
+	runs := fakeRuns{
+		{AutomationID: "motion_light", Handler: "on_message", Start: base.Add(30 * time.Second), DurationMs: 4},
+		{AutomationID: "motion_light", Handler: "on_message", Start: base.Add(90 * time.Second), DurationMs: 6, Error: "boom"},
+		{AutomationID: "heating", Handler: "on_schedule", Start: base.Add(100 * time.Second), DurationMs: 2},
+	}
+	return New(history, runs)
+}
+
+func query(from, to time.Time, intervalMs int64, targets ...string) Query {
+	var q Query
+	q.Range.From, q.Range.To, q.IntervalMs = from, to, intervalMs
+	for _, target := range targets {
+		typ := "timeserie"
+		target, isTable := strings.CutPrefix(target, "table ")
+		if isTable {
+			typ = "table"
+		}
+		q.Targets = append(q.Targets, Target{Target: target, RefID: "A", Type: typ})
+	}
+	return q
+}
+
+func ms(d time.Duration) float64 {
+	return float64(base.Add(d).UnixMilli())
+}
+
+func TestSearch(t *testing.T) {
+	d := newTestDatasource()
+	all, err := d.Search("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"duration:motion_light",
+		"errors",
+		"errors:motion_light",
+		"global:climate.living_room.temperature",
+		"global:presence.home",
+		"runs",
+		"runs:motion_light",
+	}
+	if !reflect.DeepEqual(all, want) {
+		t.Errorf("Search(\"\") = %v, want %v", all, want)
+	}
+	if got, _ := d.Search("presence"); !reflect.DeepEqual(got, []string{"global:presence.home"}) {
+		t.Errorf("Search(presence) = %v", got)
+	}
+}
+
+func TestQuery_Series(t *testing.T) {
+	d := newTestDatasource()
+	tests := []struct {
+		target string
+		want   [][2]float64
+	}{
+		{"global:climate.living_room.temperature", [][2]float64{{20, ms(10 * time.Minute)}, {21.5, ms(20 * time.Minute)}}},
+		{"global:presence.home", [][2]float64{{1, ms(5 * time.Minute)}}},
+		{"runs", [][2]float64{{1, ms(0)}, {2, ms(time.Minute)}, {0, ms(2 * time.Minute)}}},
+		{"runs:motion_light", [][2]float64{{1, ms(0)}, {1, ms(time.Minute)}, {0, ms(2 * time.Minute)}}},
+		{"errors", [][2]float64{{0, ms(0)}, {1, ms(time.Minute)}, {0, ms(2 * time.Minute)}}},
+		{"duration:motion_light", [][2]float64{{4, ms(30 * time.Second)}, {6, ms(90 * time.Second)}}},
+		{"unknown:target", [][2]float64{}},
+	}
+	for _, tt := range tests {
+		to := base.Add(2 * time.Minute)
+		if strings.HasPrefix(tt.target, "global:") {
+			to = base.Add(time.Hour)
+		}
+		result, err := d.Query(query(base, to, 60000, tt.target))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.target, err)
+		}
+		series := result[0].(Series)
+		if series.Target != tt.target || !reflect.DeepEqual(series.Datapoints, tt.want) {
+			t.Errorf("%s: datapoints = %v, want %v", tt.target, series.Datapoints, tt.want)
+		}
+	}
+}
+
+func TestQuery_Table(t *testing.T) {
+	d := newTestDatasource()
+	result, err := d.Query(query(base, base.Add(time.Hour), 0, "table global:presence.home", "table errors"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	presence := result[0].(Table)
+	if len(presence.Rows) != 2 || presence.Rows[0][1] != "unknown" || presence.Rows[1][1] != true {
+		t.Errorf("presence rows = %v", presence.Rows)
+	}
+	errors := result[1].(Table)
+	if len(errors.Rows) != 1 || errors.Rows[0][1] != "motion_light" || errors.Rows[0][5] != "boom" || errors.RefID != "A" {
+		t.Errorf("error rows = %+v", errors)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(http.StripPrefix("/grafana", newTestDatasource().Handler()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/grafana/")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET / = %v, %v", resp, err)
+	}
+
+	body := `{"range": {"from": "2026-03-01T07:00:00.000Z", "to": "2026-03-01T07:02:00.000Z"}, "intervalMs": 60000,
+		"targets": [{"target": "runs", "refId": "A", "type": "timeserie"}]}`
+	resp, err = http.Post(server.URL+"/grafana/query", "application/json", strings.NewReader(body))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /query = %v, %v", resp, err)
+	}
+	var result []Series
+	json.NewDecoder(resp.Body).Decode(&result)
+	if len(result) != 1 || len(result[0].Datapoints) != 3 || result[0].Datapoints[1][0] != 2 {
+		t.Errorf("query result = %+v", result)
+	}
+
+	resp, _ = http.Post(server.URL+"/grafana/query", "application/json", strings.NewReader("not json"))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid query status = %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,165 @@
+package mqtt
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// brokerNames is the set of configured additional brokers, replaced by New.
+// It is package-wide since MatchTopic and SplitBroker are used without a Client.
+var brokerNames atomic.Pointer[map[string]bool]
+
+// setBrokerNames sets the prefixes SplitBroker recognizes
+func setBrokerNames(names map[string]bool) {
+	brokerNames.Store(&names)
+}
+
+// SplitBroker splits a "<name>:<topic>" topic or filter into the broker name
+// and the topic on that broker. Only the name of a configured broker is split
+// off: other topics belong to the main broker and yield an empty name, so
+// "sensor:1" and "homeassistant/sensor/aa:bb/state" are topics there.
+func SplitBroker(topic string) (name, brokerTopic string) {
+	i := strings.IndexByte(topic, ':')
+	if i < 0 {
+		return "", topic
+	}
+	names := brokerNames.Load()
+	if names == nil || !(*names)[topic[:i]] {
+		return "", topic
+	}
+	return topic[:i], topic[i+1:]
+}
+
+// isBrokerName reports whether name can name an additional broker: a
+// lowercase letter followed by lowercase letters, digits, "_" and "-"
+func isBrokerName(name string) bool {
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+	for _, ch := range name {
+		if (ch < 'a' || ch > 'z') && (ch < '0' || ch > '9') && ch != '_' && ch != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// remotePublishTimeout bounds a publish to an additional broker, since paho
+// queues messages for a broker that is reconnecting
+const remotePublishTimeout = 10 * time.Second
+
+// remote is an additional named broker. Like the main broker it has a
+// discovery subscription to "#"; every message is recorded as
+// "<name>:<topic>" and dispatched to the handlers whose filters match it.
+type remote struct {
+	name   string
+	client paho.Client
+}
+
+// BrokerStatus is the connection state of an additional broker
+type BrokerStatus struct {
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+}
+
+// Brokers returns the additional brokers, sorted by name
+func (c *Client) Brokers() []BrokerStatus {
+	result := make([]BrokerStatus, 0, len(c.remotes))
+	for name, r := range c.remotes {
+		result = append(result, BrokerStatus{Name: name, Connected: r.client.IsConnectionOpen()})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// remoteFor returns the additional broker a topic names and the topic on it,
+// or nil for topics on the main broker
+func (c *Client) remoteFor(topic string) (*remote, string) {
+	name, brokerTopic := SplitBroker(topic)
+	if r, ok := c.remotes[name]; ok {
+		return r, brokerTopic
+	}
+	return nil, topic
+}
+
+// connectRemotes starts connecting to cfg.Brokers. Unlike the main broker,
+// New doesn't wait for them: each subscribes to "#" whenever it connects.
+func (c *Client) connectRemotes(cfg Config) error {
+	c.remotes = make(map[string]*remote, len(cfg.Brokers))
+	names := make(map[string]bool, len(cfg.Brokers))
+	for name, brokerCfg := range cfg.Brokers {
+		if !isBrokerName(name) {
+			return fmt.Errorf("invalid broker name %q (want lowercase letters, digits, _ and -)", name)
+		}
+		names[name] = true
+		if brokerCfg.ClientID == "" {
+			brokerCfg.ClientID = cfg.ClientID + "-" + name
+		}
+		opts, err := brokerCfg.clientOptions()
+		if err != nil {
+			return fmt.Errorf("broker %s: %w", name, err)
+		}
+		r := &remote{name: name}
+		opts.SetDefaultPublishHandler(func(_ paho.Client, msg paho.Message) {
+			c.deliverRemote(r, msg.Topic(), msg.Payload())
+		})
+		opts.SetOnConnectHandler(func(client paho.Client) {
+			slog.Info("MQTT connected", "broker", name)
+			token := client.Subscribe("#", 1, nil)
+			if token.Wait() && token.Error() != nil {
+				slog.Error("Failed to subscribe for discovery", "broker", name, "error", token.Error())
+			}
+		})
+		opts.SetConnectionLostHandler(func(_ paho.Client, err error) {
+			slog.Warn("MQTT connection lost", "broker", name, "error", err)
+		})
+		r.client = paho.NewClient(opts)
+		c.remotes[name] = r
+	}
+	setBrokerNames(names)
+	for _, r := range c.remotes {
+		r.client.Connect()
+	}
+	return nil
+}
+
+// publish sends a message to the broker, failing at once while it is
+// disconnected instead of queueing it until it reconnects
+func (r *remote) publish(topic string, payload []byte, opts PublishOptions) error {
+	if !r.client.IsConnectionOpen() {
+		return fmt.Errorf("broker %s is not connected", r.name)
+	}
+	token := r.client.Publish(topic, opts.QoS, opts.Retain, payload)
+	if !token.WaitTimeout(remotePublishTimeout) {
+		return fmt.Errorf("broker %s did not acknowledge within %s", r.name, remotePublishTimeout)
+	}
+	return token.Error()
+}
+
+// deliverRemote records a message from an additional broker's discovery
+// subscription and hands it to the handlers subscribed to it there. There is
+// one subscription per broker, so overlapping filters see each message once.
+func (c *Client) deliverRemote(r *remote, brokerTopic string, payload []byte) {
+	topic := r.name + ":" + brokerTopic
+	c.record(topic, payload)
+
+	c.mu.RLock()
+	var handlers []MessageHandler
+	for filter, h := range c.handlers {
+		if MatchTopic(filter, topic) {
+			handlers = append(handlers, h...)
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(topic, payload)
+	}
+	c.notifyWatchers(topic, payload)
+}
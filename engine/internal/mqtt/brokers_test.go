@@ -0,0 +1,122 @@
+package mqtt
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// useBrokers configures the named additional brokers for the test
+func useBrokers(t *testing.T, names ...string) {
+	t.Helper()
+	old := brokerNames.Load()
+	t.Cleanup(func() { brokerNames.Store(old) })
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	setBrokerNames(set)
+}
+
+func TestSplitBroker(t *testing.T) {
+	useBrokers(t, "cloud")
+	tests := []struct {
+		topic, name, rest string
+	}{
+		{"cloud:home/away", "cloud", "home/away"},
+		{"cloud:#", "cloud", "#"},
+		{"zigbee2mqtt/lamp", "", "zigbee2mqtt/lamp"},
+		{"homeassistant/sensor/aa:bb/state", "", "homeassistant/sensor/aa:bb/state"},
+		{"Cloud:home", "", "Cloud:home"},
+		{":home", "", ":home"},
+		// Prefixes that don't name a configured broker are part of the topic
+		{"sensor:1", "", "sensor:1"},
+		{"esp:kitchen/state", "", "esp:kitchen/state"},
+	}
+	for _, tt := range tests {
+		if name, rest := SplitBroker(tt.topic); name != tt.name || rest != tt.rest {
+			t.Errorf("SplitBroker(%q) = %q, %q; want %q, %q", tt.topic, name, rest, tt.name, tt.rest)
+		}
+	}
+}
+
+func TestRemoteRouting(t *testing.T) {
+	useBrokers(t, "cloud")
+	cloud := &remote{name: "cloud"}
+	c := &Client{
+		handlers:         make(map[string][]MessageHandler),
+		discoveredTopics: make(map[string]time.Time),
+		messageBuffer:    NewMessageBuffer(10),
+		remotes:          map[string]*remote{"cloud": cloud},
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var got []string
+	for _, filter := range []string{"cloud:home/+", "cloud:#", "home/+", "#", "other:home/away"} {
+		c.handlers[filter] = []MessageHandler{func(topic string, payload []byte) {
+			defer wg.Done()
+			mu.Lock()
+			got = append(got, filter+" "+topic)
+			mu.Unlock()
+		}}
+	}
+	var watched []string
+	stop := c.Watch("cloud:home/+", func(topic string, payload []byte) { watched = append(watched, topic) })
+	defer stop()
+
+	wg.Add(2)
+	c.deliverRemote(cloud, "home/away", []byte("1"))
+	wg.Wait()
+	wg.Add(2)
+	c.Inject("home/away", []byte("2"))
+	wg.Wait()
+
+	slices.Sort(got)
+	want := []string{"# home/away", "cloud:# cloud:home/away", "cloud:home/+ cloud:home/away", "home/+ home/away"}
+	if !slices.Equal(got, want) {
+		t.Errorf("delivered = %v, want %v", got, want)
+	}
+	if !slices.Equal(watched, []string{"cloud:home/away"}) {
+		t.Errorf("watched = %v", watched)
+	}
+	if _, ok := c.discoveredTopics["cloud:home/away"]; !ok {
+		t.Errorf("remote topic not discovered: %v", c.GetDiscoveredTopics())
+	}
+}
+
+func TestRemoteTopics(t *testing.T) {
+	useBrokers(t, "cloud")
+	cloud := &remote{name: "cloud", client: paho.NewClient(paho.NewClientOptions())}
+	c := &Client{
+		handlers: make(map[string][]MessageHandler),
+		remotes:  map[string]*remote{"cloud": cloud},
+	}
+	handler := func(topic string, payload []byte) {}
+
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr string
+	}{
+		// Remote brokers deliver everything through their discovery subscription
+		{"subscribe on a remote broker", func() error { return c.Subscribe("cloud:home/+", handler) }, ""},
+		{"unsubscribe on a remote broker", func() error { return c.Unsubscribe("cloud:home/+") }, ""},
+		// Not queued until the broker comes back
+		{"publish to a disconnected broker", func() error { return c.Publish("cloud:home/away", nil, PublishOptions{QoS: 1}) }, "broker cloud is not connected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
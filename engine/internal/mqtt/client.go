@@ -3,6 +3,7 @@ package mqtt
 import (
 	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
 	"time"
 
@@ -10,21 +11,66 @@ import (
 )
 
 type Config struct {
-	Broker   string
+	Broker   string // tcp://host:1883, or mqtts://host:8883 for TLS
 	Username string
 	Password string
 	ClientID string
+
+	// TLS options for mqtts:// (also ssl://, tls://) brokers
+	CACert             string // PEM file with the CA that signed the broker certificate
+	ClientCert         string // PEM client certificate for brokers requiring mutual TLS
+	ClientKey          string // Private key for ClientCert
+	InsecureSkipVerify bool   // Accept any broker certificate; for testing only
+
+	// Availability: OnlinePayload is published retained to StatusTopic on
+	// every connect and OfflinePayload is registered as the last will, so
+	// other systems notice when the engine goes away. Empty StatusTopic
+	// disables both.
+	StatusTopic    string
+	OnlinePayload  string // Default "online"
+	OfflinePayload string // Default "offline"
+
+	// Additional brokers by name. Automations address their topics as
+	// "<name>:<topic>"; only the connection and TLS fields are used.
+	Brokers map[string]Config
+}
+
+// DefaultStatusTopic is where the engine announces its availability
+const DefaultStatusTopic = "homebrain/engine/status"
+
+// statusPayloads returns the online and offline payloads, with defaults
+func (cfg Config) statusPayloads() (online, offline string) {
+	online, offline = cfg.OnlinePayload, cfg.OfflinePayload
+	if online == "" {
+		online = "online"
+	}
+	if offline == "" {
+		offline = "offline"
+	}
+	return online, offline
 }
 
+// MessageHandler receives a message. Handlers are called one after another
+// in the order messages arrive, so they must return quickly.
 type MessageHandler func(topic string, payload []byte)
 
 type Client struct {
 	client           paho.Client
+	statusTopic      string // Empty when availability messages are disabled
+	onlinePayload    string
+	offlinePayload   string
 	handlers         map[string][]MessageHandler
+	watchers         map[*watcher]bool
 	mu               sync.RWMutex
 	discoveredTopics map[string]time.Time
+	topicStats       map[string]*topicStats // Since startup; not persisted
 	topicsMu         sync.RWMutex
+	topicStore       TopicStore
+	flushMu          sync.Mutex // Serializes flushTopics and DeleteTopic
 	messageBuffer    *MessageBuffer
+	remotes          map[string]*remote // Config.Brokers; fixed after New
+	replays          map[*replay]bool   // Running Replay calls
+	replaysMu        sync.Mutex
 }
 
 func New(cfg Config) (*Client, error) {
@@ -32,28 +78,27 @@ func New(cfg Config) (*Client, error) {
 		handlers:         make(map[string][]MessageHandler),
 		discoveredTopics: make(map[string]time.Time),
 		messageBuffer:    NewMessageBuffer(5000),
+		statusTopic:      cfg.StatusTopic,
 	}
+	c.onlinePayload, c.offlinePayload = cfg.statusPayloads()
 
-	opts := paho.NewClientOptions()
-	opts.AddBroker(cfg.Broker)
-	opts.SetClientID(cfg.ClientID)
-	opts.SetAutoReconnect(true)
-	opts.SetConnectRetry(true)
-	opts.SetConnectRetryInterval(5 * time.Second)
-
-	if cfg.Username != "" {
-		opts.SetUsername(cfg.Username)
+	opts, err := cfg.clientOptions()
+	if err != nil {
+		return nil, err
 	}
-	if cfg.Password != "" {
-		opts.SetPassword(cfg.Password)
+	if c.statusTopic != "" {
+		opts.SetWill(c.statusTopic, c.offlinePayload, DefaultQoS, true)
 	}
 
 	opts.SetOnConnectHandler(func(client paho.Client) {
 		slog.Info("MQTT connected")
+		c.publishStatus(true)
 		// Resubscribe to all topics on reconnect
 		c.mu.RLock()
 		for topic := range c.handlers {
-			c.subscribeInternal(topic)
+			if name, _ := SplitBroker(topic); name == "" {
+				c.subscribeInternal(topic)
+			}
 		}
 		c.mu.RUnlock()
 	})
@@ -71,22 +116,100 @@ func New(cfg Config) (*Client, error) {
 	// Subscribe to wildcard to discover topics
 	c.subscribeForDiscovery()
 
+	if err := c.connectRemotes(cfg); err != nil {
+		c.client.Disconnect(0)
+		return nil, err
+	}
 	return c, nil
 }
 
+// clientOptions are the paho options for connecting to cfg's broker
+func (cfg Config) clientOptions() (*paho.ClientOptions, error) {
+	broker, secure, err := brokerURL(cfg.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := paho.NewClientOptions()
+	opts.AddBroker(broker)
+	if secure {
+		tlsConfig, err := cfg.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	} else if cfg.usesTLSOptions() {
+		return nil, fmt.Errorf("TLS options require a TLS broker URL such as mqtts://host:8883")
+	}
+	opts.SetClientID(cfg.ClientID)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(5 * time.Second)
+
+	if cfg.Username != "" {
+		opts.SetUsername(cfg.Username)
+	}
+	if cfg.Password != "" {
+		opts.SetPassword(cfg.Password)
+	}
+	return opts, nil
+}
+
 func (c *Client) subscribeForDiscovery() {
 	token := c.client.Subscribe("#", 0, func(client paho.Client, msg paho.Message) {
-		// Track discovered topics
-		c.topicsMu.Lock()
-		c.discoveredTopics[msg.Topic()] = time.Now()
-		c.topicsMu.Unlock()
-
-		// Store message in buffer for visualization
-		c.messageBuffer.Add(msg.Topic(), msg.Payload())
+		c.record(msg.Topic(), msg.Payload())
+		c.notifyWatchers(msg.Topic(), msg.Payload())
 	})
 	token.Wait()
 }
 
+// record keeps a received message for GET /messages and topic discovery
+func (c *Client) record(topic string, payload []byte) {
+	// Store message in buffer for visualization
+	entry := c.messageBuffer.Add(topic, payload)
+
+	// Track discovered topics
+	c.topicsMu.Lock()
+	c.discoveredTopics[topic] = entry.Timestamp
+	c.recordTopicStats(entry)
+	c.topicsMu.Unlock()
+}
+
+// watcher is a Watch registration
+type watcher struct {
+	filter  string
+	handler MessageHandler
+}
+
+// Watch calls handler for every message on a topic matching filter, whether
+// or not anything subscribed to it, until stop is called. It rides on the
+// discovery subscription to "#", so it takes no broker round trip. handler
+// runs on the client's delivery goroutine and must not block.
+func (c *Client) Watch(filter string, handler MessageHandler) (stop func()) {
+	w := &watcher{filter: filter, handler: handler}
+	c.mu.Lock()
+	if c.watchers == nil {
+		c.watchers = make(map[*watcher]bool)
+	}
+	c.watchers[w] = true
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		delete(c.watchers, w)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) notifyWatchers(topic string, payload []byte) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for w := range c.watchers {
+		if MatchTopic(w.filter, topic) {
+			w.handler(topic, payload)
+		}
+	}
+}
+
 func (c *Client) GetDiscoveredTopics() []string {
 	c.topicsMu.RLock()
 	defer c.topicsMu.RUnlock()
@@ -98,33 +221,168 @@ func (c *Client) GetDiscoveredTopics() []string {
 	return topics
 }
 
-// GetRecentMessages returns all captured MQTT messages in chronological order
-func (c *Client) GetRecentMessages() []MessageEntry {
-	return c.messageBuffer.GetAll()
+// TopicInfo is a discovered topic with the time a message was last seen on
+// it and, for topics seen since startup, its traffic
+type TopicInfo struct {
+	Topic         string        `json:"topic"`
+	LastSeen      time.Time     `json:"last_seen"`
+	Messages      int64         `json:"messages"`        // Received since startup
+	RatePerMinute float64       `json:"rate_per_minute"` // Recent average, see rateWindow
+	LastPayload   *MessageEntry `json:"last_payload,omitempty"`
+}
+
+// GetDiscoveredTopicInfo returns discovered topics with last-seen times and
+// traffic, sorted by topic
+func (c *Client) GetDiscoveredTopicInfo() []TopicInfo {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+
+	now := time.Now()
+	topics := make([]TopicInfo, 0, len(c.discoveredTopics))
+	for topic, seen := range c.discoveredTopics {
+		info := TopicInfo{Topic: topic, LastSeen: seen}
+		if stats := c.topicStats[topic]; stats != nil {
+			last := stats.last
+			info.Messages = stats.count
+			info.RatePerMinute = stats.ratePerMinute(now)
+			info.LastPayload = &last
+		}
+		topics = append(topics, info)
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Topic < topics[j].Topic })
+	return topics
+}
+
+// TopicStore persists discovered topics across restarts
+type TopicStore interface {
+	LoadTopics() (map[string]time.Time, error)
+	SaveTopics(topics map[string]time.Time) error
+	DeleteTopics(topics ...string) error
+	PruneTopics(cutoff time.Time) (int, error)
+}
+
+// PersistTopics restores discovered topics from store and saves new sightings
+// every interval. Topics not seen for maxAge are pruned (0 keeps them forever).
+func (c *Client) PersistTopics(store TopicStore, interval, maxAge time.Duration) error {
+	stored, err := store.LoadTopics()
+	if err != nil {
+		return err
+	}
+	c.topicsMu.Lock()
+	for topic, seen := range stored {
+		if seen.After(c.discoveredTopics[topic]) {
+			c.discoveredTopics[topic] = seen
+		}
+	}
+	c.topicStore = store
+	c.topicsMu.Unlock()
+
+	go func() {
+		lastFlush := time.Time{}
+		for range time.Tick(interval) {
+			now := time.Now()
+			if err := c.flushTopics(store, lastFlush, now, maxAge); err != nil {
+				slog.Error("Failed to persist discovered topics", "error", err)
+				continue
+			}
+			lastFlush = now
+		}
+	}()
+	return nil
+}
+
+// flushTopics saves topics seen since lastFlush and prunes stale ones
+func (c *Client) flushTopics(store TopicStore, lastFlush, now time.Time, maxAge time.Duration) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	seen := make(map[string]time.Time)
+	c.topicsMu.Lock()
+	for topic, at := range c.discoveredTopics {
+		if at.After(lastFlush) {
+			seen[topic] = at
+		}
+		if maxAge > 0 && now.Sub(at) > maxAge {
+			delete(c.discoveredTopics, topic)
+			delete(c.topicStats, topic)
+		}
+	}
+	c.topicsMu.Unlock()
+
+	if err := store.SaveTopics(seen); err != nil {
+		return err
+	}
+	if maxAge > 0 {
+		pruned, err := store.PruneTopics(now.Add(-maxAge))
+		if err != nil {
+			return err
+		}
+		if pruned > 0 {
+			slog.Info("Pruned stale discovered topics", "count", pruned)
+		}
+	}
+	return nil
 }
 
+// DeleteTopic forgets a discovered topic. It reappears if another message
+// arrives on it.
+func (c *Client) DeleteTopic(topic string) (bool, error) {
+	// A flush in progress would save the topic again after it's deleted
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.topicsMu.Lock()
+	_, ok := c.discoveredTopics[topic]
+	delete(c.discoveredTopics, topic)
+	delete(c.topicStats, topic)
+	store := c.topicStore
+	c.topicsMu.Unlock()
+
+	if store != nil {
+		if err := store.DeleteTopics(topic); err != nil {
+			return ok, err
+		}
+	}
+	return ok, nil
+}
+
+// SetMessagePayloadLimit caps the bytes of each payload kept for GET /messages
+func (c *Client) SetMessagePayloadLimit(limit int) {
+	c.messageBuffer.SetPayloadLimit(limit)
+}
+
+// GetMessages returns captured messages on topics matching filter, newest
+// first, with at most perTopic messages per topic (0 for no limit)
+func (c *Client) GetMessages(filter string, perTopic int) []MessageEntry {
+	return c.messageBuffer.GetMatching(filter, perTopic)
+}
+
+// Subscribe calls handler for messages on topic, which may be a filter
+// and may name an additional broker as "<name>:<topic>". Additional brokers
+// deliver everything through their discovery subscription, so subscribing to
+// one of their topics takes no broker round trip.
 func (c *Client) Subscribe(topic string, handler MessageHandler) error {
+	r, _ := c.remoteFor(topic)
 	c.mu.Lock()
 	c.handlers[topic] = append(c.handlers[topic], handler)
 	c.mu.Unlock()
 
+	if r != nil {
+		return nil
+	}
 	return c.subscribeInternal(topic)
 }
 
 func (c *Client) subscribeInternal(topic string) error {
+	// paho calls every subscription whose filter matches a message, so each
+	// one only runs its own handlers. They run in arrival order on paho's
+	// delivery goroutine and must only queue work, not do it.
 	token := c.client.Subscribe(topic, 1, func(client paho.Client, msg paho.Message) {
 		c.mu.RLock()
-		handlers := c.handlers[msg.Topic()]
-		// Also check for wildcard subscriptions
-		for pattern, h := range c.handlers {
-			if matchTopic(pattern, msg.Topic()) && pattern != msg.Topic() {
-				handlers = append(handlers, h...)
-			}
-		}
+		handlers := c.handlers[topic]
 		c.mu.RUnlock()
-
 		for _, handler := range handlers {
-			go handler(msg.Topic(), msg.Payload())
+			handler(msg.Topic(), msg.Payload())
 		}
 	})
 	token.Wait()
@@ -135,11 +393,36 @@ func (c *Client) subscribeInternal(topic string) error {
 	return nil
 }
 
+// Inject delivers a message to local subscribers without sending it to the broker.
+// Used for internal event sources such as GPIO inputs.
+func (c *Client) Inject(topic string, payload []byte) {
+	c.dispatch(topic, payload)
+}
+
+func (c *Client) dispatch(topic string, payload []byte) {
+	c.mu.RLock()
+	var handlers []MessageHandler
+	for filter, h := range c.handlers {
+		if MatchTopic(filter, topic) {
+			handlers = append(handlers, h...)
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(topic, payload)
+	}
+	c.notifyWatchers(topic, payload)
+}
+
 func (c *Client) Unsubscribe(topic string) error {
 	c.mu.Lock()
 	delete(c.handlers, topic)
 	c.mu.Unlock()
 
+	if name, _ := SplitBroker(topic); name != "" {
+		return nil
+	}
 	token := c.client.Unsubscribe(topic)
 	token.Wait()
 	if token.Error() != nil {
@@ -148,28 +431,60 @@ func (c *Client) Unsubscribe(topic string) error {
 	return nil
 }
 
-func (c *Client) Publish(topic string, payload []byte) error {
-	token := c.client.Publish(topic, 1, false, payload)
-	token.Wait()
-	if token.Error() != nil {
-		return fmt.Errorf("failed to publish to topic %s: %w", topic, token.Error())
+// DefaultQoS is the QoS used when a publish doesn't ask for another
+const DefaultQoS = 1
+
+// PublishOptions control how a message is delivered
+type PublishOptions struct {
+	QoS    byte // 0 (at most once), 1 (at least once) or 2 (exactly once)
+	Retain bool // The broker keeps the message and hands it to future subscribers
+}
+
+// Publish sends payload to topic, on an additional broker for "<name>:<topic>"
+func (c *Client) Publish(topic string, payload []byte, opts PublishOptions) error {
+	r, brokerTopic := c.remoteFor(topic)
+	var err error
+	if r != nil {
+		err = r.publish(brokerTopic, payload, opts)
+	} else {
+		token := c.client.Publish(brokerTopic, opts.QoS, opts.Retain, payload)
+		token.Wait()
+		err = token.Error()
 	}
-	slog.Debug("Published message", "topic", topic)
+	if err != nil {
+		return fmt.Errorf("failed to publish to topic %s: %w", topic, err)
+	}
+	slog.Debug("Published message", "topic", topic, "qos", opts.QoS, "retain", opts.Retain)
 	return nil
 }
 
+// IsConnected reports whether the client currently has a broker connection
+func (c *Client) IsConnected() bool {
+	return c.client.IsConnectionOpen()
+}
+
+// Disconnect announces the engine as offline, since the broker only sends
+// the last will when the connection drops, and disconnects
 func (c *Client) Disconnect() {
+	c.publishStatus(false)
 	c.client.Disconnect(1000)
+	for _, r := range c.remotes {
+		r.client.Disconnect(1000)
+	}
 }
 
-// matchTopic checks if a topic matches a pattern with MQTT wildcards
-func matchTopic(pattern, topic string) bool {
-	if pattern == "#" {
-		return true
+// publishStatus publishes the retained online or offline payload, if a status
+// topic is configured
+func (c *Client) publishStatus(online bool) {
+	if c.statusTopic == "" {
+		return
+	}
+	payload := c.offlinePayload
+	if online {
+		payload = c.onlinePayload
 	}
-	if pattern == topic {
-		return true
+	token := c.client.Publish(c.statusTopic, DefaultQoS, true, []byte(payload))
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		slog.Warn("Failed to publish engine status", "topic", c.statusTopic, "payload", payload, "error", token.Error())
 	}
-	// Simple wildcard matching - could be extended for + wildcard
-	return false
 }
@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatusPayloads(t *testing.T) {
+	tests := []struct {
+		cfg     Config
+		online  string
+		offline string
+	}{
+		{Config{}, "online", "offline"},
+		{Config{OnlinePayload: "1", OfflinePayload: "0"}, "1", "0"},
+		{Config{OfflinePayload: "crashed"}, "online", "crashed"},
+	}
+	for _, tt := range tests {
+		online, offline := tt.cfg.statusPayloads()
+		if online != tt.online || offline != tt.offline {
+			t.Errorf("statusPayloads(%+v) = %q, %q; want %q, %q", tt.cfg, online, offline, tt.online, tt.offline)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c := &Client{handlers: make(map[string][]MessageHandler)}
+	var got []string
+	stop := c.Watch("zigbee2mqtt/+/state", func(topic string, payload []byte) {
+		got = append(got, topic+" "+string(payload))
+	})
+
+	c.Inject("zigbee2mqtt/lamp/state", []byte("ON"))
+	c.Inject("zigbee2mqtt/lamp/set", []byte("OFF"))
+	stop()
+	c.Inject("zigbee2mqtt/plug/state", []byte("ON"))
+
+	if len(got) != 1 || got[0] != "zigbee2mqtt/lamp/state ON" {
+		t.Errorf("watched messages = %v", got)
+	}
+}
+
+// blockingTopicStore holds SaveTopics until release is closed
+type blockingTopicStore struct {
+	saving  chan struct{}
+	release chan struct{}
+	topics  map[string]time.Time
+}
+
+func (s *blockingTopicStore) LoadTopics() (map[string]time.Time, error) { return nil, nil }
+func (s *blockingTopicStore) PruneTopics(time.Time) (int, error)        { return 0, nil }
+
+func (s *blockingTopicStore) SaveTopics(topics map[string]time.Time) error {
+	close(s.saving)
+	<-s.release
+	for topic, seen := range topics {
+		s.topics[topic] = seen
+	}
+	return nil
+}
+
+func (s *blockingTopicStore) DeleteTopics(topics ...string) error {
+	for _, topic := range topics {
+		delete(s.topics, topic)
+	}
+	return nil
+}
+
+func TestDeleteTopic_DuringFlush(t *testing.T) {
+	store := &blockingTopicStore{saving: make(chan struct{}), release: make(chan struct{}), topics: make(map[string]time.Time)}
+	c := &Client{discoveredTopics: map[string]time.Time{"sensors/old": time.Now()}, topicStore: store}
+
+	flushed := make(chan error)
+	go func() { flushed <- c.flushTopics(store, time.Time{}, time.Now(), 0) }()
+	<-store.saving
+
+	deleted := make(chan bool)
+	go func() {
+		ok, _ := c.DeleteTopic("sensors/old")
+		deleted <- ok
+	}()
+	time.Sleep(10 * time.Millisecond) // Let the delete race the save
+	close(store.release)
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	if !<-deleted {
+		t.Error("DeleteTopic didn't find the topic")
+	}
+	if _, ok := store.topics["sensors/old"]; ok {
+		t.Error("flush saved a topic deleted while it ran")
+	}
+}
@@ -12,7 +12,8 @@ type MessageEntry struct {
 	Topic     string    `json:"topic"`
 	Payload   string    `json:"payload"`
 	IsBinary  bool      `json:"is_binary"`
-	Size      int       `json:"size"`
+	Size      int       `json:"size"`                // Bytes received, even when Payload was truncated
+	Truncated bool      `json:"truncated,omitempty"` // Payload holds only the first bytes
 }
 
 // MessageBuffer is a thread-safe circular buffer for MQTT messages
@@ -22,6 +23,8 @@ type MessageBuffer struct {
 	head     int
 	count    int
 	mu       sync.RWMutex
+
+	maxPayload int // Bytes of each payload kept; 0 keeps them whole
 }
 
 // NewMessageBuffer creates a new circular buffer with the specified capacity
@@ -34,8 +37,16 @@ func NewMessageBuffer(capacity int) *MessageBuffer {
 	}
 }
 
-// Add adds a new message to the buffer
-func (b *MessageBuffer) Add(topic string, payload []byte) {
+// SetPayloadLimit caps the bytes kept of each message added afterwards, so
+// camera snapshots and firmware images don't fill memory; 0 keeps payloads whole
+func (b *MessageBuffer) SetPayloadLimit(limit int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxPayload = limit
+}
+
+// Add adds a new message to the buffer and returns the entry as stored
+func (b *MessageBuffer) Add(topic string, payload []byte) MessageEntry {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -47,6 +58,14 @@ func (b *MessageBuffer) Add(topic string, payload []byte) {
 
 	// Check if payload is valid UTF-8 text
 	if utf8.Valid(payload) {
+		if b.maxPayload > 0 && len(payload) > b.maxPayload {
+			cut := b.maxPayload
+			for cut > 0 && !utf8.RuneStart(payload[cut]) {
+				cut--
+			}
+			payload = payload[:cut]
+			entry.Truncated = true
+		}
 		entry.Payload = string(payload)
 		entry.IsBinary = false
 	} else {
@@ -59,6 +78,7 @@ func (b *MessageBuffer) Add(topic string, payload []byte) {
 	if b.count < b.capacity {
 		b.count++
 	}
+	return entry
 }
 
 // GetAll returns all messages in reverse chronological order (newest first)
@@ -93,6 +113,25 @@ func (b *MessageBuffer) GetRecent(n int) []MessageEntry {
 	return all[:n]
 }
 
+// GetMatching returns messages on topics matching filter (MQTT wildcards
+// allowed), newest first, keeping at most perTopic messages of each topic.
+// An empty filter matches every topic and perTopic <= 0 keeps them all.
+func (b *MessageBuffer) GetMatching(filter string, perTopic int) []MessageEntry {
+	result := []MessageEntry{}
+	kept := make(map[string]int)
+	for _, entry := range b.GetAll() {
+		if filter != "" && !MatchTopic(filter, entry.Topic) {
+			continue
+		}
+		if perTopic > 0 && kept[entry.Topic] >= perTopic {
+			continue
+		}
+		kept[entry.Topic]++
+		result = append(result, entry)
+	}
+	return result
+}
+
 // Count returns the number of messages in the buffer
 func (b *MessageBuffer) Count() int {
 	b.mu.RLock()
@@ -0,0 +1,61 @@
+package mqtt
+
+import "testing"
+
+func TestMessageBuffer_GetMatching(t *testing.T) {
+	b := NewMessageBuffer(5)
+	b.Add("zigbee2mqtt/lamp", []byte(`{"state": "OFF"}`))
+	b.Add("zigbee2mqtt/lamp", []byte(`{"state": "ON"}`))
+	b.Add("zigbee2mqtt/sensor", []byte(`{"occupancy": true}`))
+	b.Add("zigbee2mqtt/lamp", []byte(`{"state": "OFF"}`))
+	b.Add("tasmota/plug", []byte{0xff, 0xfe})
+	b.Add("zigbee2mqtt/sensor", []byte(`{"occupancy": false}`)) // Evicts the first lamp message
+
+	tests := []struct {
+		filter   string
+		perTopic int
+		want     []string // Payloads, newest first
+	}{
+		{"", 0, []string{`{"occupancy": false}`, "", `{"state": "OFF"}`, `{"occupancy": true}`, `{"state": "ON"}`}},
+		{"zigbee2mqtt/lamp", 0, []string{`{"state": "OFF"}`, `{"state": "ON"}`}},
+		{"zigbee2mqtt/#", 1, []string{`{"occupancy": false}`, `{"state": "OFF"}`}},
+		{"", 1, []string{`{"occupancy": false}`, "", `{"state": "OFF"}`}},
+		{"zigbee2mqtt/missing", 0, []string{}},
+	}
+	for _, tt := range tests {
+		got := b.GetMatching(tt.filter, tt.perTopic)
+		payloads := make([]string, len(got))
+		for i, entry := range got {
+			payloads[i] = entry.Payload
+		}
+		if len(payloads) != len(tt.want) {
+			t.Errorf("GetMatching(%q, %d) = %q, want %q", tt.filter, tt.perTopic, payloads, tt.want)
+			continue
+		}
+		for i := range payloads {
+			if payloads[i] != tt.want[i] {
+				t.Errorf("GetMatching(%q, %d) = %q, want %q", tt.filter, tt.perTopic, payloads, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMessageBuffer_PayloadLimit(t *testing.T) {
+	b := NewMessageBuffer(10)
+	b.SetPayloadLimit(8)
+	b.Add("frigate/front/snapshot", []byte("héllo wörld, a long payload"))
+	b.Add("zigbee2mqtt/lamp", []byte(`{"on":1}`))
+	b.Add("ota/firmware", []byte{0xff, 0xfe, 0x00})
+
+	got := b.GetAll()
+	if got[2].Payload != "héllo w" || !got[2].Truncated || got[2].Size != 29 {
+		t.Errorf("long payload = %+v, want the first 8 bytes cut on a rune boundary", got[2])
+	}
+	if got[1].Payload != `{"on":1}` || got[1].Truncated {
+		t.Errorf("payload at the limit = %+v", got[1])
+	}
+	if !got[0].IsBinary || got[0].Truncated {
+		t.Errorf("binary payload = %+v", got[0])
+	}
+}
@@ -0,0 +1,103 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxReplayDuration bounds the delays of a replayed message sequence
+const MaxReplayDuration = 10 * time.Minute
+
+// ReplayMessage is one message of a sequence replayed to local subscribers
+type ReplayMessage struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`  // A JSON string is delivered as its text, other JSON as is
+	DelayMs int             `json:"delay_ms"` // Wait after the previous message
+}
+
+// payload returns the bytes subscribers receive
+func (m ReplayMessage) payload() []byte {
+	var text string
+	if err := json.Unmarshal(m.Payload, &text); err == nil {
+		return []byte(text)
+	}
+	return m.Payload
+}
+
+// replay is a running Replay
+type replay struct {
+	cancel context.CancelFunc
+}
+
+// Replay delivers messages to local subscribers in the background, in order
+// and with their delays, as Inject does: nothing is sent to a broker. It
+// checks the whole sequence first and returns how long it takes. The replay
+// stops early when ctx ends or StopReplays is called.
+func (c *Client) Replay(ctx context.Context, messages []ReplayMessage) (time.Duration, error) {
+	if len(messages) == 0 {
+		return 0, errors.New("no messages to replay")
+	}
+	var total time.Duration
+	for i, msg := range messages {
+		if msg.Topic == "" || strings.ContainsAny(msg.Topic, "+#") {
+			return 0, fmt.Errorf("message %d: topic must be a topic name without wildcards", i)
+		}
+		if msg.DelayMs < 0 {
+			return 0, fmt.Errorf("message %d: delay_ms must not be negative", i)
+		}
+		total += time.Duration(msg.DelayMs) * time.Millisecond
+	}
+	if total > MaxReplayDuration {
+		return 0, fmt.Errorf("replay takes %s, at most %s is allowed", total, MaxReplayDuration)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	running := &replay{cancel: cancel}
+	c.replaysMu.Lock()
+	if c.replays == nil {
+		c.replays = make(map[*replay]bool)
+	}
+	c.replays[running] = true
+	c.replaysMu.Unlock()
+
+	go func() {
+		defer func() {
+			c.replaysMu.Lock()
+			delete(c.replays, running)
+			c.replaysMu.Unlock()
+			cancel()
+		}()
+		for _, msg := range messages {
+			if msg.DelayMs > 0 {
+				timer := time.NewTimer(time.Duration(msg.DelayMs) * time.Millisecond)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			c.Inject(msg.Topic, msg.payload())
+		}
+	}()
+	return total, nil
+}
+
+// StopReplays cancels the running replays and returns how many there were
+func (c *Client) StopReplays() int {
+	c.replaysMu.Lock()
+	defer c.replaysMu.Unlock()
+	stopped := len(c.replays)
+	for running := range c.replays {
+		running.cancel()
+		delete(c.replays, running)
+	}
+	return stopped
+}
@@ -0,0 +1,125 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	c := &Client{handlers: make(map[string][]MessageHandler)}
+	var mu sync.Mutex
+	var got []string
+	done := make(chan struct{})
+	c.handlers["hallway/+"] = []MessageHandler{func(topic string, payload []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, topic+" "+string(payload))
+		if len(got) == 4 {
+			close(done)
+		}
+	}}
+
+	start := time.Now()
+	total, err := c.Replay(context.Background(), []ReplayMessage{
+		{Topic: "hallway/motion", Payload: json.RawMessage(`{"occupancy": true}`)},
+		{Topic: "hallway/lux", Payload: json.RawMessage(`"10"`)},
+		{Topic: "hallway/lux", Payload: json.RawMessage(`"12"`), DelayMs: 30},
+		{Topic: "hallway/motion", Payload: json.RawMessage(`{"occupancy": false}`), DelayMs: 30},
+	})
+	if err != nil || total != 60*time.Millisecond {
+		t.Fatalf("Replay = %s, %v", total, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages not delivered")
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("replay took %s, want the delays", elapsed)
+	}
+	// Messages without a delay keep their order too
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{`hallway/motion {"occupancy": true}`, "hallway/lux 10", "hallway/lux 12", `hallway/motion {"occupancy": false}`}
+	if !slices.Equal(got, want) {
+		t.Errorf("delivered = %q, want %q", got, want)
+	}
+}
+
+func TestReplay_Invalid(t *testing.T) {
+	c := &Client{handlers: make(map[string][]MessageHandler)}
+	tests := []struct {
+		name     string
+		messages []ReplayMessage
+	}{
+		{"empty", nil},
+		{"no topic", []ReplayMessage{{Payload: json.RawMessage(`"1"`)}}},
+		{"wildcard", []ReplayMessage{{Topic: "hallway/#"}}},
+		{"negative delay", []ReplayMessage{{Topic: "hallway/motion", DelayMs: -1}}},
+		{"too long", []ReplayMessage{{Topic: "a", DelayMs: 400000}, {Topic: "b", DelayMs: 400000}}},
+	}
+	for _, tt := range tests {
+		if _, err := c.Replay(context.Background(), tt.messages); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestReplay_Stop(t *testing.T) {
+	c := &Client{handlers: make(map[string][]MessageHandler)}
+	delivered := make(chan string, 10)
+	c.handlers["hallway/+"] = []MessageHandler{func(topic string, payload []byte) {
+		delivered <- string(payload)
+	}}
+	sequence := []ReplayMessage{
+		{Topic: "hallway/motion", Payload: json.RawMessage(`"on"`)},
+		{Topic: "hallway/motion", Payload: json.RawMessage(`"off"`), DelayMs: 60000},
+	}
+
+	tests := []struct {
+		name string
+		stop func(cancel context.CancelFunc)
+	}{
+		{"StopReplays", func(context.CancelFunc) {
+			if stopped := c.StopReplays(); stopped != 1 {
+				t.Errorf("StopReplays() = %d, want 1", stopped)
+			}
+		}},
+		{"context", func(cancel context.CancelFunc) { cancel() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if _, err := c.Replay(ctx, sequence); err != nil {
+				t.Fatal(err)
+			}
+			if got := <-delivered; got != "on" {
+				t.Fatalf("delivered %q", got)
+			}
+			tt.stop(cancel)
+			deadline := time.Now().Add(time.Second)
+			for {
+				c.replaysMu.Lock()
+				running := len(c.replays)
+				c.replaysMu.Unlock()
+				if running == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("replay still running")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			select {
+			case got := <-delivered:
+				t.Errorf("delivered %q after stopping", got)
+			default:
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// tlsSchemes are the broker URL schemes paho connects to over TLS
+var tlsSchemes = map[string]bool{"mqtts": true, "ssl": true, "tls": true, "tcps": true, "mqtt+ssl": true, "wss": true}
+
+// brokerURL checks the broker address and adds the default port (1883, or
+// 8883 for TLS) when it is missing. Addresses without a scheme use tcp://, as
+// paho does. It reports whether the broker uses TLS.
+func brokerURL(raw string) (string, bool, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "tcp://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("invalid broker URL %q (want e.g. tcp://host:1883 or mqtts://host:8883)", raw)
+	}
+	secure := tlsSchemes[u.Scheme]
+	if u.Port() == "" && u.Scheme != "ws" && u.Scheme != "wss" {
+		port := "1883"
+		if secure {
+			port = "8883"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u.String(), secure, nil
+}
+
+// tlsConfig builds the TLS settings for a secure broker
+func (cfg Config) tlsConfig() (*tls.Config, error) {
+	conf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CACert)
+		}
+		conf.RootCAs = pool
+	}
+
+	if (cfg.ClientCert == "") != (cfg.ClientKey == "") {
+		return nil, fmt.Errorf("client certificate and key must be set together")
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// usesTLSOptions reports whether any TLS setting was configured
+func (cfg Config) usesTLSOptions() bool {
+	return cfg.CACert != "" || cfg.ClientCert != "" || cfg.ClientKey != "" || cfg.InsecureSkipVerify
+}
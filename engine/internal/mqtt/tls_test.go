@@ -0,0 +1,100 @@
+package mqtt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBrokerURL(t *testing.T) {
+	tests := []struct {
+		raw        string
+		want       string
+		wantSecure bool
+	}{
+		{"tcp://192.168.1.100:1883", "tcp://192.168.1.100:1883", false},
+		{"tcp://broker.local", "tcp://broker.local:1883", false},
+		{"192.168.1.100:1883", "tcp://192.168.1.100:1883", false},
+		{"mqtts://broker.example.com", "mqtts://broker.example.com:8883", true},
+		{"ssl://broker.example.com:8884", "ssl://broker.example.com:8884", true},
+		{"wss://broker.example.com/mqtt", "wss://broker.example.com/mqtt", true},
+	}
+	for _, tt := range tests {
+		got, secure, err := brokerURL(tt.raw)
+		if err != nil || got != tt.want || secure != tt.wantSecure {
+			t.Errorf("brokerURL(%q) = %q, %v, %v; want %q, %v", tt.raw, got, secure, err, tt.want, tt.wantSecure)
+		}
+	}
+
+	if _, _, err := brokerURL("mqtts://"); err == nil {
+		t.Error("broker URL without host should be rejected")
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+
+	conf, err := Config{CACert: certFile, ClientCert: certFile, ClientKey: keyFile}.tlsConfig()
+	if err != nil {
+		t.Fatalf("tlsConfig failed: %v", err)
+	}
+	if conf.RootCAs == nil || len(conf.Certificates) != 1 || conf.InsecureSkipVerify {
+		t.Errorf("tlsConfig = %+v", conf)
+	}
+
+	bad := []Config{
+		{CACert: filepath.Join(dir, "missing.pem")},
+		{CACert: keyFile}, // No certificates in a key file
+		{ClientCert: certFile},
+		{ClientCert: keyFile, ClientKey: certFile},
+	}
+	for _, cfg := range bad {
+		if _, err := cfg.tlsConfig(); err == nil {
+			t.Errorf("tlsConfig(%+v) should fail", cfg)
+		}
+	}
+
+	if _, err := New(Config{Broker: "tcp://localhost:1883", InsecureSkipVerify: true}); err == nil {
+		t.Error("TLS options with a plain tcp:// broker should be rejected")
+	}
+}
+
+// writeTestCert writes a self-signed certificate and its key as PEM files
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "homebrain-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
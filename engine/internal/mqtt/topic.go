@@ -0,0 +1,37 @@
+package mqtt
+
+import "strings"
+
+// MatchTopic reports whether topic matches an MQTT topic filter. "+" matches
+// exactly one level and "#", as the last level, matches the parent level and
+// everything below it. Wildcards at the first level don't match topics
+// starting with "$", such as $SYS. Topics on additional brokers
+// ("<name>:<topic>", see SplitBroker) only match filters naming the same one.
+func MatchTopic(filter, topic string) bool {
+	if filter == topic {
+		return true
+	}
+	filterBroker, filter := SplitBroker(filter)
+	topicBroker, topic := SplitBroker(topic)
+	if filterBroker != topicBroker {
+		return false
+	}
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return i == len(filterLevels)-1
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,43 @@
+package mqtt
+
+import "testing"
+
+func TestMatchTopic(t *testing.T) {
+	useBrokers(t, "cloud")
+	tests := []struct {
+		filter, topic string
+		expected      bool
+	}{
+		{"zigbee2mqtt/lamp", "zigbee2mqtt/lamp", true},
+		{"zigbee2mqtt/lamp", "zigbee2mqtt/lamp/set", false},
+		{"zigbee2mqtt/+/state", "zigbee2mqtt/lamp/state", true},
+		{"zigbee2mqtt/+/state", "zigbee2mqtt/lamp/set", false},
+		{"zigbee2mqtt/+/state", "zigbee2mqtt/lamp/l1/state", false},
+		{"zigbee2mqtt/+", "zigbee2mqtt/", true},
+		{"+/+", "zigbee2mqtt/lamp", true},
+		{"+", "zigbee2mqtt/lamp", false},
+		{"zigbee2mqtt/#", "zigbee2mqtt/lamp/state", true},
+		{"zigbee2mqtt/#", "zigbee2mqtt", true},
+		{"zigbee2mqtt/#", "tasmota/plug", false},
+		{"+/lamp/#", "zigbee2mqtt/lamp/state", true},
+		{"zigbee2mqtt/#/state", "zigbee2mqtt/lamp/state", false},
+		{"#", "zigbee2mqtt/lamp", true},
+		{"#", "$SYS/broker/uptime", false},
+		{"+/broker/uptime", "$SYS/broker/uptime", false},
+		{"$SYS/#", "$SYS/broker/uptime", true},
+		{"cloud:home/+", "cloud:home/away", true},
+		{"cloud:#", "cloud:home/away", true},
+		{"#", "cloud:home/away", false},
+		{"home/+", "cloud:home/away", false},
+		{"cloud:#", "home/away", false},
+		{"other:#", "cloud:home/away", false},
+		{"#", "esp:kitchen/state", true},
+		{"esp:kitchen/+", "esp:kitchen/state", true},
+	}
+
+	for _, tt := range tests {
+		if got := MatchTopic(tt.filter, tt.topic); got != tt.expected {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package mqtt
+
+import (
+	"math"
+	"time"
+)
+
+// rateWindow is the time constant of the per-topic message rate: it averages
+// roughly the last few minutes, weighting recent messages most
+const rateWindow = 5 * time.Minute
+
+// topicStats is the traffic seen on one topic since startup
+type topicStats struct {
+	count int64
+	last  MessageEntry // Payload truncated like GET /messages
+	rate  float64      // Decaying message count per second, as of last.Timestamp
+}
+
+// recordTopicStats counts a message. The caller holds topicsMu.
+func (c *Client) recordTopicStats(entry MessageEntry) {
+	if c.topicStats == nil {
+		c.topicStats = make(map[string]*topicStats)
+	}
+	stats := c.topicStats[entry.Topic]
+	if stats == nil {
+		stats = &topicStats{}
+		c.topicStats[entry.Topic] = stats
+	}
+	stats.rate = stats.rateAt(entry.Timestamp) + 1/rateWindow.Seconds()
+	stats.count++
+	stats.last = entry
+}
+
+// rateAt decays the rate to t: each message adds 1/rateWindow, fading
+// exponentially, so a steady stream converges on its true rate
+func (s *topicStats) rateAt(t time.Time) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	elapsed := t.Sub(s.last.Timestamp).Seconds()
+	return s.rate * math.Exp(-max(elapsed, 0)/rateWindow.Seconds())
+}
+
+// ratePerMinute is the rate at t in messages per minute, rounded to 0.01
+func (s *topicStats) ratePerMinute(t time.Time) float64 {
+	return math.Round(s.rateAt(t)*60*100) / 100
+}
@@ -0,0 +1,61 @@
+package mqtt
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTopicStats_Rate(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name     string
+		interval time.Duration
+		messages int
+		readAt   time.Duration // After the last message
+		want     float64       // Per minute
+	}{
+		{"steady every 10s", 10 * time.Second, 360, 0, 6},
+		{"steady every 2 minutes", 2 * time.Minute, 60, time.Minute, 0.5}, // Between messages
+		{"quiet for an hour", 10 * time.Second, 360, time.Hour, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{}
+			var last time.Time
+			for i := 0; i < tt.messages; i++ {
+				last = start.Add(time.Duration(i) * tt.interval)
+				c.recordTopicStats(MessageEntry{Timestamp: last, Topic: "sensor"})
+			}
+			got := c.topicStats["sensor"].ratePerMinute(last.Add(tt.readAt))
+			if math.Abs(got-tt.want) > tt.want*0.1+0.01 {
+				t.Errorf("rate = %v/min, want about %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDiscoveredTopicInfo(t *testing.T) {
+	c := &Client{discoveredTopics: map[string]time.Time{"restored/topic": time.Now().Add(-time.Hour)}, messageBuffer: NewMessageBuffer(10)}
+	for _, payload := range []string{`{"power": 12}`, `{"power": 14}`} {
+		entry := c.messageBuffer.Add("tasmota/plug/SENSOR", []byte(payload))
+		c.discoveredTopics[entry.Topic] = entry.Timestamp
+		c.recordTopicStats(entry)
+	}
+
+	topics := c.GetDiscoveredTopicInfo()
+	if len(topics) != 2 || topics[0].Topic != "restored/topic" || topics[1].Topic != "tasmota/plug/SENSOR" {
+		t.Fatalf("topics = %+v", topics)
+	}
+	if restored := topics[0]; restored.Messages != 0 || restored.LastPayload != nil {
+		t.Errorf("restored topic has traffic: %+v", restored)
+	}
+	plug := topics[1]
+	if plug.Messages != 2 || plug.LastPayload == nil || plug.LastPayload.Payload != `{"power": 14}` || plug.RatePerMinute <= 0 {
+		t.Errorf("plug = %+v", plug)
+	}
+
+	if ok, _ := c.DeleteTopic("tasmota/plug/SENSOR"); !ok || c.topicStats["tasmota/plug/SENSOR"] != nil {
+		t.Error("DeleteTopic kept the topic's traffic")
+	}
+}
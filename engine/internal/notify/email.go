@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TLS modes for EmailConfig.TLS
+const (
+	TLSStartTLS = "starttls" // Plain connection upgraded with STARTTLS (port 587)
+	TLSImplicit = "tls"      // TLS from the first byte (port 465)
+	TLSNone     = "none"     // Unencrypted, for local relays only
+)
+
+const smtpTimeout = 30 * time.Second
+
+// EmailConfig describes the SMTP server and envelope for the email channel
+type EmailConfig struct {
+	Host     string
+	Port     int // Defaults to 587, or 465 with implicit TLS
+	Username string
+	Password string
+	From     string
+	To       []string
+	TLS      string // TLSStartTLS (default), TLSImplicit or TLSNone
+}
+
+// Email sends notifications as plain-text mail over SMTP
+type Email struct {
+	cfg EmailConfig
+}
+
+// NewEmail validates the config and creates the email provider
+func NewEmail(cfg EmailConfig) (*Email, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("SMTP host is required")
+	}
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("sender and at least one recipient are required")
+	}
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = TLSStartTLS
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("unknown TLS mode %q (want %s, %s or %s)", cfg.TLS, TLSStartTLS, TLSImplicit, TLSNone)
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.TLS == TLSImplicit {
+			cfg.Port = 465
+		}
+	}
+	return &Email{cfg: cfg}, nil
+}
+
+// Name returns the channel name, "email"
+func (e *Email) Name() string {
+	return "email"
+}
+
+// Send delivers msg to all configured recipients
+func (e *Email) Send(msg Message) error {
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: e.cfg.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	if e.cfg.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if e.cfg.TLS == TLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if e.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(e.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range e.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(e.buildMessage(msg, time.Now())); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage renders headers and body with CRLF line endings
+func (e *Email) buildMessage(msg Message, now time.Time) []byte {
+	// Line breaks would let the title inject headers
+	subject := strings.Join(strings.Fields(msg.Title), " ")
+	if subject == "" {
+		subject = "Homebrain notification"
+	}
+
+	var b bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", key, value)
+	}
+	header("From", e.cfg.From)
+	header("To", strings.Join(e.cfg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	switch msg.Priority {
+	case PriorityHigh:
+		header("X-Priority", "1")
+		header("Importance", "high")
+	case PriorityLow:
+		header("X-Priority", "5")
+		header("Importance", "low")
+	}
+	if msg.Source != "" {
+		header("X-Homebrain-Automation", msg.Source)
+	}
+	b.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
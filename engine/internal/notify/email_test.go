@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     EmailConfig
+		port    int
+		wantErr bool
+	}{
+		{"starttls default", EmailConfig{Host: "smtp.example.com", From: "hb@example.com", To: []string{"me@example.com"}}, 587, false},
+		{"implicit tls", EmailConfig{Host: "smtp.example.com", From: "a@b", To: []string{"c@d"}, TLS: TLSImplicit}, 465, false},
+		{"explicit port", EmailConfig{Host: "relay", Port: 25, From: "a@b", To: []string{"c@d"}, TLS: TLSNone}, 25, false},
+		{"missing host", EmailConfig{From: "a@b", To: []string{"c@d"}}, 0, true},
+		{"missing recipients", EmailConfig{Host: "relay", From: "a@b"}, 0, true},
+		{"bad tls mode", EmailConfig{Host: "relay", From: "a@b", To: []string{"c@d"}, TLS: "ssl"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewEmail(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewEmail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && e.cfg.Port != tt.port {
+				t.Errorf("port = %d, want %d", e.cfg.Port, tt.port)
+			}
+		})
+	}
+}
+
+func TestEmailBuildMessage(t *testing.T) {
+	e, _ := NewEmail(EmailConfig{Host: "relay", From: "homebrain@example.com", To: []string{"a@example.com", "b@example.com"}})
+	msg := string(e.buildMessage(Message{
+		Title:    "Weekly energy\r\nBcc: victim@example.com",
+		Body:     "Used 42 kWh\nSee you",
+		Priority: PriorityHigh,
+		Source:   "energy_report",
+	}, time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)))
+
+	for _, want := range []string{
+		"From: homebrain@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: Weekly energy Bcc: victim@example.com\r\n",
+		"X-Priority: 1\r\n",
+		"X-Homebrain-Automation: energy_report\r\n",
+		"\r\n\r\nUsed 42 kWh\r\nSee you\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "\nBcc:") {
+		t.Errorf("title injected a header:\n%s", msg)
+	}
+}
+
+// TestEmailSend talks to a minimal in-process SMTP server over a plain connection
+func TestEmailSend(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 test ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 queued")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 test")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	e, err := NewEmail(EmailConfig{Host: host, Port: portNum, From: "hb@example.com", To: []string{"me@example.com"}, TLS: TLSNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Send(Message{Title: "Report", Body: "Used 42 kWh"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	select {
+	case data := <-received:
+		if !strings.Contains(data, "Subject: Report") || !strings.Contains(data, "Used 42 kWh") {
+			t.Errorf("server received:\n%s", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server received no message")
+	}
+}
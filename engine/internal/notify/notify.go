@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Priorities accepted by ctx.notify
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// ErrNoChannels is returned when nothing is configured to deliver notifications
+var ErrNoChannels = errors.New("no notification channels configured")
+
+// Message is one notification
+type Message struct {
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+	Priority string `json:"priority"`
+	Source   string `json:"source,omitempty"` // Automation that sent it
+}
+
+// Provider delivers notifications over one channel (email, push service, ...)
+type Provider interface {
+	Name() string
+	Send(msg Message) error
+}
+
+// Notifier routes messages to providers by channel name
+type Notifier struct {
+	mu             sync.RWMutex
+	providers      map[string]Provider
+	defaultChannel string
+}
+
+// New creates a notifier without providers
+func New() *Notifier {
+	return &Notifier{providers: make(map[string]Provider)}
+}
+
+// Register adds a provider. The first one registered becomes the default channel.
+func (n *Notifier) Register(p Provider) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.providers[p.Name()] = p
+	if n.defaultChannel == "" {
+		n.defaultChannel = p.Name()
+	}
+}
+
+// SetDefault selects the channel used when ctx.notify names none
+func (n *Notifier) SetDefault(channel string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.providers[channel]; !ok {
+		return fmt.Errorf("unknown notification channel %q", channel)
+	}
+	n.defaultChannel = channel
+	return nil
+}
+
+// Channels returns the configured channel names, sorted
+func (n *Notifier) Channels() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	channels := make([]string, 0, len(n.providers))
+	for name := range n.providers {
+		channels = append(channels, name)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// Send delivers a message on channel ("" for the default channel)
+func (n *Notifier) Send(channel string, msg Message) error {
+	if err := ValidatePriority(msg.Priority); err != nil {
+		return err
+	}
+	if msg.Priority == "" {
+		msg.Priority = PriorityNormal
+	}
+
+	n.mu.RLock()
+	if channel == "" {
+		channel = n.defaultChannel
+	}
+	p, ok := n.providers[channel]
+	n.mu.RUnlock()
+
+	if channel == "" {
+		return ErrNoChannels
+	}
+	if !ok {
+		return fmt.Errorf("unknown notification channel %q", channel)
+	}
+	if err := p.Send(msg); err != nil {
+		return fmt.Errorf("%s: %w", channel, err)
+	}
+	return nil
+}
+
+// ValidatePriority accepts "", low, normal and high
+func ValidatePriority(priority string) error {
+	switch priority {
+	case "", PriorityLow, PriorityNormal, PriorityHigh:
+		return nil
+	}
+	return fmt.Errorf("priority must be %q, %q or %q", PriorityLow, PriorityNormal, PriorityHigh)
+}
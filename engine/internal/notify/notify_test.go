@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+)
+
+type fakeProvider struct {
+	name string
+	sent []Message
+	err  error
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Send(msg Message) error {
+	p.sent = append(p.sent, msg)
+	return p.err
+}
+
+func TestNotifierRouting(t *testing.T) {
+	n := New()
+	if err := n.Send("", Message{Body: "hi"}); !errors.Is(err, ErrNoChannels) {
+		t.Fatalf("Send without providers error = %v, want ErrNoChannels", err)
+	}
+
+	email := &fakeProvider{name: "email"}
+	push := &fakeProvider{name: "push"}
+	n.Register(email)
+	n.Register(push)
+
+	if err := n.Send("", Message{Title: "Report", Body: "42 kWh"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send("push", Message{Body: "Door open", Priority: PriorityHigh}); err != nil {
+		t.Fatal(err)
+	}
+	if len(email.sent) != 1 || email.sent[0].Priority != PriorityNormal {
+		t.Errorf("default channel got %+v, want one normal-priority message", email.sent)
+	}
+	if len(push.sent) != 1 || push.sent[0].Priority != PriorityHigh {
+		t.Errorf("push got %+v", push.sent)
+	}
+
+	if err := n.Send("sms", Message{Body: "x"}); err == nil {
+		t.Error("Send to unknown channel succeeded")
+	}
+	if err := n.Send("", Message{Body: "x", Priority: "urgent"}); err == nil {
+		t.Error("Send with invalid priority succeeded")
+	}
+
+	push.err = errors.New("rate limited")
+	if err := n.Send("push", Message{Body: "x"}); err == nil || err.Error() != "push: rate limited" {
+		t.Errorf("provider error = %v, want wrapped with channel", err)
+	}
+
+	if err := n.SetDefault("push"); err != nil {
+		t.Fatal(err)
+	}
+	if channels := n.Channels(); len(channels) != 2 || channels[0] != "email" {
+		t.Errorf("Channels() = %v", channels)
+	}
+}
@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const pushTimeout = 30 * time.Second
+
+var pushClient = &http.Client{Timeout: pushTimeout}
+
+// NtfyConfig describes the ntfy server and topic for the ntfy channel
+type NtfyConfig struct {
+	URL   string // Defaults to https://ntfy.sh
+	Topic string
+	Token string // Access token for protected topics (optional)
+}
+
+// Ntfy publishes notifications to an ntfy topic
+type Ntfy struct {
+	cfg NtfyConfig
+}
+
+// NewNtfy validates the config and creates the ntfy provider
+func NewNtfy(cfg NtfyConfig) (*Ntfy, error) {
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("ntfy topic is required")
+	}
+	if cfg.URL == "" {
+		cfg.URL = "https://ntfy.sh"
+	}
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid ntfy URL: %w", err)
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return &Ntfy{cfg: cfg}, nil
+}
+
+// Name returns the channel name, "ntfy"
+func (n *Ntfy) Name() string {
+	return "ntfy"
+}
+
+// Send publishes msg as JSON, which keeps non-ASCII titles out of headers
+func (n *Ntfy) Send(msg Message) error {
+	// ntfy priorities run from 1 (min) to 5 (max)
+	priority := 3
+	switch msg.Priority {
+	case PriorityLow:
+		priority = 2
+	case PriorityHigh:
+		priority = 5
+	}
+	body := map[string]any{
+		"topic":    n.cfg.Topic,
+		"title":    msg.Title,
+		"message":  msg.Body,
+		"priority": priority,
+	}
+	if msg.Source != "" {
+		body["tags"] = []string{msg.Source}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.cfg.Token)
+	}
+	return doPush(req)
+}
+
+// TelegramConfig describes the bot and chat for the telegram channel
+type TelegramConfig struct {
+	BotToken string
+	ChatID   string
+}
+
+// Telegram sends notifications as messages from a Telegram bot
+type Telegram struct {
+	cfg    TelegramConfig
+	apiURL string
+}
+
+// NewTelegram validates the config and creates the telegram provider
+func NewTelegram(cfg TelegramConfig) (*Telegram, error) {
+	if cfg.BotToken == "" || cfg.ChatID == "" {
+		return nil, fmt.Errorf("bot token and chat ID are required")
+	}
+	return &Telegram{cfg: cfg, apiURL: "https://api.telegram.org"}, nil
+}
+
+// Name returns the channel name, "telegram"
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+// Send posts msg to the chat. Low priority messages arrive without a sound.
+func (t *Telegram) Send(msg Message) error {
+	// Plain text, so titles and bodies need no Markdown escaping
+	text := strings.TrimSpace(msg.Title + "\n\n" + msg.Body)
+	data, err := json.Marshal(map[string]any{
+		"chat_id":              t.cfg.ChatID,
+		"text":                 text,
+		"disable_notification": msg.Priority == PriorityLow,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.apiURL+"/bot"+t.cfg.BotToken+"/sendMessage", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doPush(req)
+}
+
+// PushoverConfig holds the application token and user key for the pushover channel
+type PushoverConfig struct {
+	Token string
+	User  string
+}
+
+// Pushover sends notifications through the Pushover API
+type Pushover struct {
+	cfg    PushoverConfig
+	apiURL string
+}
+
+// NewPushover validates the config and creates the pushover provider
+func NewPushover(cfg PushoverConfig) (*Pushover, error) {
+	if cfg.Token == "" || cfg.User == "" {
+		return nil, fmt.Errorf("application token and user key are required")
+	}
+	return &Pushover{cfg: cfg, apiURL: "https://api.pushover.net/1/messages.json"}, nil
+}
+
+// Name returns the channel name, "pushover"
+func (p *Pushover) Name() string {
+	return "pushover"
+}
+
+// Send delivers msg to the user's devices
+func (p *Pushover) Send(msg Message) error {
+	// Pushover rejects empty messages
+	body := msg.Body
+	if body == "" {
+		body = msg.Title
+	}
+	form := url.Values{
+		"token":   {p.cfg.Token},
+		"user":    {p.cfg.User},
+		"title":   {msg.Title},
+		"message": {body},
+	}
+	switch msg.Priority {
+	case PriorityLow:
+		form.Set("priority", "-1")
+	case PriorityHigh:
+		form.Set("priority", "1")
+	}
+	req, err := http.NewRequest(http.MethodPost, p.apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doPush(req)
+}
+
+// doPush sends req and turns non-2xx responses into errors quoting the
+// start of the response body
+func doPush(req *http.Request) error {
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		// The request URL can carry a bot token; report only the cause
+		if urlErr, ok := err.(*url.Error); ok {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+	return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// recordingServer captures the last request made to it
+func recordingServer(t *testing.T, status int) (*httptest.Server, *http.Request, *[]byte) {
+	t.Helper()
+	var last http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = *r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"ok": false, "description": "chat not found"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &last, &body
+}
+
+func TestNewPushProviders(t *testing.T) {
+	tests := []struct {
+		name    string
+		create  func() (Provider, error)
+		wantErr bool
+	}{
+		{"ntfy default server", func() (Provider, error) { return NewNtfy(NtfyConfig{Topic: "home-alerts"}) }, false},
+		{"ntfy missing topic", func() (Provider, error) { return NewNtfy(NtfyConfig{URL: "https://ntfy.example.com"}) }, true},
+		{"ntfy bad url", func() (Provider, error) { return NewNtfy(NtfyConfig{URL: "ntfy.example.com", Topic: "t"}) }, true},
+		{"telegram", func() (Provider, error) { return NewTelegram(TelegramConfig{BotToken: "123:abc", ChatID: "42"}) }, false},
+		{"telegram missing chat", func() (Provider, error) { return NewTelegram(TelegramConfig{BotToken: "123:abc"}) }, true},
+		{"pushover", func() (Provider, error) { return NewPushover(PushoverConfig{Token: "app", User: "user"}) }, false},
+		{"pushover missing user", func() (Provider, error) { return NewPushover(PushoverConfig{Token: "app"}) }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.create(); (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNtfySend(t *testing.T) {
+	srv, req, body := recordingServer(t, http.StatusOK)
+	n, _ := NewNtfy(NtfyConfig{URL: srv.URL + "/", Topic: "home-alerts", Token: "tk_secret"})
+
+	if err := n.Send(Message{Title: "Wäschetrockner", Body: "Done", Priority: PriorityHigh, Source: "laundry"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer tk_secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(*body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["topic"] != "home-alerts" || got["title"] != "Wäschetrockner" || got["message"] != "Done" || got["priority"] != 5.0 {
+		t.Errorf("body = %s", *body)
+	}
+}
+
+func TestTelegramSend(t *testing.T) {
+	srv, req, body := recordingServer(t, http.StatusOK)
+	tg, _ := NewTelegram(TelegramConfig{BotToken: "123:abc", ChatID: "42"})
+	tg.apiURL = srv.URL
+
+	if err := tg.Send(Message{Title: "Door", Body: "Front door open", Priority: PriorityLow}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if req.URL.Path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %q", req.URL.Path)
+	}
+	var got map[string]any
+	json.Unmarshal(*body, &got)
+	if got["chat_id"] != "42" || got["text"] != "Door\n\nFront door open" || got["disable_notification"] != true {
+		t.Errorf("body = %s", *body)
+	}
+}
+
+func TestPushoverSend(t *testing.T) {
+	srv, _, body := recordingServer(t, http.StatusOK)
+	p, _ := NewPushover(PushoverConfig{Token: "app", User: "user"})
+	p.apiURL = srv.URL
+
+	if err := p.Send(Message{Title: "Leak detected", Priority: PriorityHigh}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	form, _ := url.ParseQuery(string(*body))
+	if form.Get("token") != "app" || form.Get("user") != "user" || form.Get("message") != "Leak detected" || form.Get("priority") != "1" {
+		t.Errorf("form = %v", form)
+	}
+}
+
+func TestPushErrors(t *testing.T) {
+	srv, _, _ := recordingServer(t, http.StatusBadRequest)
+	tg, _ := NewTelegram(TelegramConfig{BotToken: "123:abc", ChatID: "42"})
+	tg.apiURL = srv.URL
+
+	err := tg.Send(Message{Title: "Door"})
+	if err == nil || !strings.Contains(err.Error(), "HTTP 400") || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("error = %v, want the status and response", err)
+	}
+
+	tg.apiURL = "http://127.0.0.1:1"
+	if err := tg.Send(Message{Title: "Door"}); err == nil || strings.Contains(err.Error(), "123:abc") {
+		t.Errorf("error = %v, want a failure without the bot token", err)
+	}
+}
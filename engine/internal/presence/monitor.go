@@ -0,0 +1,215 @@
+package presence
+
+import (
+	"context"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+// Watcher taps MQTT messages on a topic without subscribing, as
+// mqtt.Client.Watch does
+type Watcher func(filter string, handler mqtt.MessageHandler) (stop func())
+
+// Recent returns the buffered MQTT messages matching filter, newest first and
+// at most perTopic per topic, as mqtt.Client.GetMessages does
+type Recent func(filter string, perTopic int) []mqtt.MessageEntry
+
+// Monitor follows the trackers of the configured persons and reports when
+// someone arrives or leaves. A person is home while any tracker says so, and
+// away once all of them have said otherwise for AwayAfter.
+type Monitor struct {
+	cfg      Config
+	onChange func(person string, home bool)
+	ping     func(ctx context.Context, host string) bool
+
+	mu       sync.Mutex
+	trackers map[string][]bool      // Last report per tracker
+	reported map[string][]bool      // Trackers that reported since Start
+	home     map[string]bool        // Decided state; absent until the first report
+	leaving  map[string]*time.Timer // Pending away decisions
+	pending  map[string]bool        // Decisions not yet passed to onChange
+	notify   chan struct{}
+	stops    []func()
+	cancel   context.CancelFunc
+}
+
+// NewMonitor creates a monitor calling onChange, one change at a time, when
+// a person's presence is first known and whenever it changes. Changes that
+// happen while onChange is busy are coalesced to each person's latest state.
+func NewMonitor(cfg *Config, onChange func(person string, home bool)) *Monitor {
+	m := &Monitor{
+		cfg:      *cfg,
+		onChange: onChange,
+		ping:     ping,
+		trackers: make(map[string][]bool),
+		reported: make(map[string][]bool),
+		home:     make(map[string]bool),
+		leaving:  make(map[string]*time.Timer),
+		pending:  make(map[string]bool),
+		notify:   make(chan struct{}, 1),
+	}
+	for _, p := range cfg.Persons {
+		m.trackers[p.Name] = make([]bool, len(p.Trackers))
+		m.reported[p.Name] = make([]bool, len(p.Trackers))
+	}
+	return m
+}
+
+// Start watches the MQTT trackers through watch and starts pinging the
+// network ones. Messages received before Start, such as the retained tracker
+// states delivered on connect, are taken from recent.
+func (m *Monitor) Start(watch Watcher, recent Recent) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	go m.deliver(ctx)
+	for _, p := range m.cfg.Persons {
+		for i, t := range p.Trackers {
+			person, index, tracker := p.Name, i, t
+			if tracker.Topic != "" {
+				m.stops = append(m.stops, watch(tracker.Topic, func(_ string, payload []byte) {
+					m.report(person, index, IsHome(payload, tracker.Field))
+				}))
+				if recent != nil {
+					m.seed(person, index, tracker, recent(tracker.Topic, 1))
+				}
+				continue
+			}
+			go m.pingLoop(ctx, person, index, tracker.Ping)
+		}
+	}
+}
+
+// Close stops watching and pinging
+func (m *Monitor) Close() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stop := range m.stops {
+		stop()
+	}
+	for _, timer := range m.leaving {
+		timer.Stop()
+	}
+}
+
+// deliver passes decisions to onChange outside of report, which runs on the
+// MQTT delivery goroutine
+func (m *Monitor) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.notify:
+		}
+		m.mu.Lock()
+		pending := m.pending
+		m.pending = make(map[string]bool)
+		m.mu.Unlock()
+		for _, person := range sortedKeys(pending) {
+			m.onChange(person, pending[person])
+		}
+	}
+}
+
+// seed reports the newest of messages, received before Start, for tracker
+// index of person unless the tracker has reported since
+func (m *Monitor) seed(person string, index int, tracker Tracker, messages []mqtt.MessageEntry) {
+	if len(messages) == 0 || messages[0].Truncated || messages[0].IsBinary {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.reported[person][index] {
+		m.record(person, index, IsHome([]byte(messages[0].Payload), tracker.Field))
+	}
+}
+
+func (m *Monitor) pingLoop(ctx context.Context, person string, index int, host string) {
+	ticker := time.NewTicker(m.cfg.PingInterval)
+	defer ticker.Stop()
+	for {
+		m.report(person, index, m.ping(ctx, host))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// report records what tracker index of person said and decides the person's
+// presence: arrivals count at once, departures after AwayAfter
+func (m *Monitor) report(person string, index int, home bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reported[person][index] = true
+	m.record(person, index, home)
+}
+
+// record applies a tracker's report. Callers hold m.mu.
+func (m *Monitor) record(person string, index int, home bool) {
+	m.trackers[person][index] = home
+	anyHome := false
+	for _, h := range m.trackers[person] {
+		anyHome = anyHome || h
+	}
+
+	current, known := m.home[person]
+	if anyHome {
+		if timer := m.leaving[person]; timer != nil {
+			timer.Stop()
+			delete(m.leaving, person)
+		}
+		if !known || !current {
+			m.decide(person, true)
+		}
+		return
+	}
+	if (known && !current) || m.leaving[person] != nil {
+		return
+	}
+	if m.cfg.AwayAfter <= 0 {
+		m.decide(person, false)
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(m.cfg.AwayAfter, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.leaving[person] == timer {
+			delete(m.leaving, person)
+			m.decide(person, false)
+		}
+	})
+	m.leaving[person] = timer
+}
+
+// decide records a person's presence and queues the change. Callers hold m.mu.
+func (m *Monitor) decide(person string, home bool) {
+	m.home[person] = home
+	m.pending[person] = home
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ping reports whether host answers one ICMP echo request within a second
+func ping(ctx context.Context, host string) bool {
+	return exec.CommandContext(ctx, "ping", "-c", "1", "-W", "1", host).Run() == nil
+}
@@ -0,0 +1,161 @@
+// Package presence tracks whether the people living in the house are home,
+// from device trackers: MQTT topics reporting a device and network pings.
+package presence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultAwayAfter    = 5 * time.Minute
+	DefaultPingInterval = 30 * time.Second
+)
+
+// Tracker is one device reporting whether a person is home. Exactly one of
+// Topic and Ping is set.
+type Tracker struct {
+	Topic string `yaml:"topic" json:"topic,omitempty"` // MQTT topic reporting the device
+	Field string `yaml:"field" json:"field,omitempty"` // Top-level field of a JSON object payload; empty uses the whole payload
+	Ping  string `yaml:"ping" json:"ping,omitempty"`   // Host pinged every ping interval; home while it answers
+}
+
+// Person is someone whose presence is tracked
+type Person struct {
+	Name     string    `json:"name"`
+	Trackers []Tracker `json:"trackers"`
+}
+
+// Config lists the tracked persons, sorted by name
+type Config struct {
+	Persons []Person
+	// A person is away once every tracker has reported away for this long,
+	// so a phone dropping off Wi-Fi for a moment doesn't count as leaving
+	AwayAfter    time.Duration
+	PingInterval time.Duration
+}
+
+// file is the YAML layout of a presence file
+type file struct {
+	AwayAfter    *time.Duration       `yaml:"away_after"`
+	PingInterval *time.Duration       `yaml:"ping_interval"`
+	Persons      map[string][]Tracker `yaml:"persons"`
+}
+
+// Load reads a presence file. A missing file disables presence tracking and
+// returns nil.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read presence file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a presence file:
+//
+//	away_after: 10m
+//	persons:
+//	  alice:
+//	    - topic: owntracks/alice/phone
+//	      field: location
+//	    - ping: 192.168.1.20
+func Parse(data []byte) (*Config, error) {
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid presence file: %w", err)
+	}
+	cfg := &Config{AwayAfter: DefaultAwayAfter, PingInterval: DefaultPingInterval}
+	if f.AwayAfter != nil {
+		if *f.AwayAfter < 0 {
+			return nil, fmt.Errorf("away_after must not be negative")
+		}
+		cfg.AwayAfter = *f.AwayAfter
+	}
+	if f.PingInterval != nil {
+		if *f.PingInterval < time.Second {
+			return nil, fmt.Errorf("ping_interval must be at least 1s")
+		}
+		cfg.PingInterval = *f.PingInterval
+	}
+	for name, trackers := range f.Persons {
+		if !validName(name) {
+			return nil, fmt.Errorf("invalid person name %q (want lowercase letters, digits and _)", name)
+		}
+		if len(trackers) == 0 {
+			return nil, fmt.Errorf("person %s has no trackers", name)
+		}
+		for i, t := range trackers {
+			if (t.Topic == "") == (t.Ping == "") {
+				return nil, fmt.Errorf("person %s tracker %d: set either topic or ping", name, i)
+			}
+			if strings.ContainsAny(t.Topic, "+#") {
+				return nil, fmt.Errorf("person %s tracker %d: topic %q must not contain wildcards", name, i, t.Topic)
+			}
+		}
+		cfg.Persons = append(cfg.Persons, Person{Name: name, Trackers: trackers})
+	}
+	sort.Slice(cfg.Persons, func(i, j int) bool { return cfg.Persons[i].Name < cfg.Persons[j].Name })
+	return cfg, nil
+}
+
+// Names returns the tracked persons' names, sorted
+func (c *Config) Names() []string {
+	names := make([]string, len(c.Persons))
+	for i, p := range c.Persons {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, ch := range name {
+		if (ch < 'a' || ch > 'z') && (ch < '0' || ch > '9') && ch != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// homeValues are the tracker values meaning home, compared case-insensitively
+var homeValues = map[string]bool{"home": true, "present": true, "on": true, "true": true, "yes": true, "1": true}
+
+// IsHome interprets a tracker payload, picking field from a JSON object if it
+// is set: true, non-zero numbers and "home", "present", "on", "true", "yes"
+// and "1" mean home. Anything else, such as "not_home" or a zone name, is away.
+func IsHome(payload []byte, field string) bool {
+	var value any
+	if err := json.Unmarshal(payload, &value); err != nil {
+		value = string(payload)
+	}
+	if field != "" {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return false
+		}
+		value = object[field]
+	}
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return homeValues[strings.ToLower(strings.TrimSpace(v))]
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`
+away_after: 10m
+persons:
+  bob:
+    - ping: 192.168.1.21
+  alice:
+    - topic: owntracks/alice/phone
+      field: location
+    - ping: 192.168.1.20
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AwayAfter != 10*time.Minute || cfg.PingInterval != DefaultPingInterval {
+		t.Errorf("cfg = %+v", cfg)
+	}
+	if len(cfg.Persons) != 2 || cfg.Persons[0].Name != "alice" || len(cfg.Persons[0].Trackers) != 2 || cfg.Persons[0].Trackers[0].Field != "location" {
+		t.Errorf("persons = %+v", cfg.Persons)
+	}
+
+	for _, bad := range []string{
+		"persons:\n  Alice:\n    - ping: phone\n",
+		"persons:\n  alice: []\n",
+		"persons:\n  alice:\n    - field: state\n",
+		"persons:\n  alice:\n    - topic: a\n      ping: b\n",
+		"persons:\n  alice:\n    - topic: owntracks/+/phone\n",
+		"ping_interval: 10ms\n",
+		"away_after: -1m\n",
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Parse(%q) should fail", bad)
+		}
+	}
+}
+
+func TestIsHome(t *testing.T) {
+	tests := []struct {
+		payload, field string
+		want           bool
+	}{
+		{"home", "", true},
+		{"Home", "", true},
+		{"not_home", "", false},
+		{"work", "", false},
+		{"true", "", true},
+		{"0", "", false},
+		{`{"state": "home"}`, "state", true},
+		{`{"state": "away"}`, "state", false},
+		{`{"present": true}`, "present", true},
+		{`{"present": true}`, "state", false},
+		{"home", "state", false},
+	}
+	for _, tt := range tests {
+		if got := IsHome([]byte(tt.payload), tt.field); got != tt.want {
+			t.Errorf("IsHome(%q, %q) = %v, want %v", tt.payload, tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	cfg, err := Parse([]byte(`
+away_after: 50ms
+persons:
+  alice:
+    - topic: owntracks/alice/phone
+    - topic: zigbee2mqtt/alice_keys
+      field: present
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type change struct {
+		person string
+		home   bool
+	}
+	changes := make(chan change, 10)
+	m := NewMonitor(cfg, func(person string, home bool) { changes <- change{person, home} })
+	handlers := map[string]mqtt.MessageHandler{}
+	m.Start(func(filter string, handler mqtt.MessageHandler) func() {
+		handlers[filter] = handler
+		return func() {}
+	}, nil)
+	defer m.Close()
+
+	expect := func(want change) {
+		t.Helper()
+		select {
+		case got := <-changes:
+			if got != want {
+				t.Fatalf("change = %+v, want %+v", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no change, want %+v", want)
+		}
+	}
+	expectNone := func(wait time.Duration) {
+		t.Helper()
+		select {
+		case got := <-changes:
+			t.Fatalf("unexpected change %+v", got)
+		case <-time.After(wait):
+		}
+	}
+
+	handlers["owntracks/alice/phone"]("owntracks/alice/phone", []byte("home"))
+	expect(change{"alice", true})
+
+	// Away only once every tracker says so, and after away_after
+	handlers["owntracks/alice/phone"]("owntracks/alice/phone", []byte("not_home"))
+	expect(change{"alice", false})
+	handlers["zigbee2mqtt/alice_keys"]("zigbee2mqtt/alice_keys", []byte(`{"present": true}`))
+	expect(change{"alice", true})
+	handlers["zigbee2mqtt/alice_keys"]("zigbee2mqtt/alice_keys", []byte(`{"present": false}`))
+	time.Sleep(10 * time.Millisecond)
+	handlers["owntracks/alice/phone"]("owntracks/alice/phone", []byte("home"))
+	expectNone(100 * time.Millisecond)
+
+	handlers["owntracks/alice/phone"]("owntracks/alice/phone", []byte("work"))
+	start := time.Now()
+	expect(change{"alice", false})
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("left after %s, want away_after", elapsed)
+	}
+}
+
+func TestMonitor_Seed(t *testing.T) {
+	cfg, err := Parse([]byte(`
+persons:
+  alice:
+    - topic: owntracks/alice/phone
+  bob:
+    - topic: owntracks/bob/phone
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan string, 10)
+	m := NewMonitor(cfg, func(person string, home bool) {
+		if home {
+			changes <- person
+		}
+	})
+	handlers := map[string]mqtt.MessageHandler{}
+	m.Start(func(filter string, handler mqtt.MessageHandler) func() {
+		handlers[filter] = handler
+		if filter == "owntracks/bob/phone" {
+			// Arrives between watching and reading the buffer, so it wins
+			// over the older buffered state
+			handler(filter, []byte("home"))
+		}
+		return func() {}
+	}, func(filter string, perTopic int) []mqtt.MessageEntry {
+		return []mqtt.MessageEntry{{Topic: filter, Payload: "not_home"}}
+	})
+	defer m.Close()
+
+	m.mu.Lock()
+	alice, bob := m.home["alice"], m.home["bob"]
+	m.mu.Unlock()
+	if alice || !bob {
+		t.Errorf("home = alice %v, bob %v, want alice away and bob home", alice, bob)
+	}
+	select {
+	case got := <-changes:
+		if got != "bob" {
+			t.Errorf("arrived = %s, want bob", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("bob never arrived")
+	}
+}
@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// maxAnnotationLength bounds the text of one note
+const maxAnnotationLength = 2000
+
+var (
+	// ErrAnnotationNotFound is returned when deleting a note that doesn't exist
+	ErrAnnotationNotFound = errors.New("annotation not found")
+
+	// ErrInvalidAnnotation is returned for empty or oversized notes
+	ErrInvalidAnnotation = errors.New("invalid annotation")
+)
+
+// Annotate attaches a timestamped note to a loaded automation. Notes are kept
+// in the state store, so they outlive reloads and edits of the file.
+func (r *Runner) Annotate(automationID, author, text string) (state.Annotation, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return state.Annotation{}, fmt.Errorf("%w: text must not be empty", ErrInvalidAnnotation)
+	}
+	if len(text) > maxAnnotationLength {
+		return state.Annotation{}, fmt.Errorf("%w: text is %d bytes, limit is %d", ErrInvalidAnnotation, len(text), maxAnnotationLength)
+	}
+	if _, err := r.lookup(automationID); err != nil {
+		return state.Annotation{}, err
+	}
+	if r.stateStore == nil {
+		return state.Annotation{}, fmt.Errorf("annotations need a state store")
+	}
+
+	note, err := r.stateStore.AddAnnotation(automationID, state.Annotation{Time: time.Now(), Author: author, Text: text})
+	if err != nil {
+		return state.Annotation{}, err
+	}
+	slog.Info("Automation annotated", "id", automationID, "author", author)
+	return note, nil
+}
+
+// GetAnnotations returns an automation's notes, oldest first
+func (r *Runner) GetAnnotations(automationID string) ([]state.Annotation, error) {
+	if r.stateStore == nil {
+		return []state.Annotation{}, nil
+	}
+	return r.stateStore.Annotations(automationID)
+}
+
+// DeleteAnnotation removes one of an automation's notes
+func (r *Runner) DeleteAnnotation(automationID string, id uint64) error {
+	if r.stateStore == nil {
+		return ErrAnnotationNotFound
+	}
+	found, err := r.stateStore.DeleteAnnotation(automationID, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrAnnotationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+func TestAnnotate(t *testing.T) {
+	store, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	r := newTestRunner()
+	r.stateStore = store
+	addTestAutomation(t, r, "garden_pump", `
+config = {"name": "Garden Pump", "schedule": "0 6 * * *"}
+
+def on_schedule(ctx):
+    pass
+`)
+
+	note, err := r.Annotate("garden_pump", "alex", "  Disabled pump automation while valve broken ")
+	if err != nil {
+		t.Fatalf("Annotate failed: %v", err)
+	}
+	if note.Text != "Disabled pump automation while valve broken" || note.Author != "alex" || note.Time.IsZero() {
+		t.Errorf("note = %+v", note)
+	}
+
+	for _, tt := range []struct {
+		id, text string
+		wantErr  error
+	}{
+		{"garden_pump", " ", ErrInvalidAnnotation},
+		{"garden_pump", strings.Repeat("x", maxAnnotationLength+1), ErrInvalidAnnotation},
+		{"missing", "note", ErrAutomationNotFound},
+	} {
+		if _, err := r.Annotate(tt.id, "", tt.text); !errors.Is(err, tt.wantErr) {
+			t.Errorf("Annotate(%q, %.10q) = %v, want %v", tt.id, tt.text, err, tt.wantErr)
+		}
+	}
+
+	automations := r.ListAutomations()
+	if len(automations) != 1 || len(automations[0].Annotations) != 1 || automations[0].Annotations[0].ID != note.ID {
+		t.Errorf("ListAutomations = %+v", automations)
+	}
+	docs, err := r.GetDocs("garden_pump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := docs.Markdown(); !strings.Contains(md, "## Notes\n\n- "+note.Time.Format("2006-01-02 15:04")+" (alex): Disabled pump automation while valve broken\n") {
+		t.Errorf("markdown missing the note:\n%s", md)
+	}
+
+	if err := r.DeleteAnnotation("garden_pump", note.ID); err != nil {
+		t.Fatalf("DeleteAnnotation failed: %v", err)
+	}
+	if err := r.DeleteAnnotation("garden_pump", note.ID); !errors.Is(err, ErrAnnotationNotFound) {
+		t.Errorf("second DeleteAnnotation = %v, want ErrAnnotationNotFound", err)
+	}
+	if notes, _ := r.GetAnnotations("garden_pump"); len(notes) != 0 {
+		t.Errorf("notes after delete = %+v", notes)
+	}
+}
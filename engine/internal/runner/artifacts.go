@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	// threadLocalArtifacts holds the artifacts attached during the current run
+	threadLocalArtifacts = "homebrain.artifacts"
+
+	maxArtifactsPerRun = 8
+	maxArtifactSize    = 256 << 10
+)
+
+// Artifact is a small output attached to a run with ctx.attach. The data is
+// served separately from the run history: GET /runs/{id}/artifacts/{name}.
+type Artifact struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	data        []byte
+}
+
+// Data returns the artifact contents
+func (a Artifact) Data() []byte {
+	return a.data
+}
+
+// runArtifacts collects a run's artifacts; attaching a name twice replaces it
+type runArtifacts struct {
+	list []Artifact
+}
+
+func (a *runArtifacts) add(artifact Artifact) error {
+	for i, existing := range a.list {
+		if existing.Name == artifact.Name {
+			a.list[i] = artifact
+			return nil
+		}
+	}
+	if len(a.list) >= maxArtifactsPerRun {
+		return fmt.Errorf("at most %d artifacts per run", maxArtifactsPerRun)
+	}
+	a.list = append(a.list, artifact)
+	return nil
+}
+
+// GetRunArtifact returns an artifact attached to a recorded run
+func (r *Runner) GetRunArtifact(runID, name string) (Artifact, bool) {
+	r.runsMu.RLock()
+	defer r.runsMu.RUnlock()
+
+	for _, run := range r.runs {
+		if run.ID != runID {
+			continue
+		}
+		for _, artifact := range run.Artifacts {
+			if artifact.Name == name {
+				return artifact, true
+			}
+		}
+	}
+	return Artifact{}, false
+}
+
+// attach implements ctx.attach(name, data, content_type=None). Strings and
+// bytes are stored as-is, anything else is JSON-encoded.
+func (c *Context) attach(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var value starlark.Value
+	var contentType string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "data", &value, "content_type?", &contentType); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%s: name must not be empty", fn.Name())
+	}
+
+	artifacts, _ := thread.Local(threadLocalArtifacts).(*runArtifacts)
+	if artifacts == nil {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+
+	var data []byte
+	defaultType := "application/json"
+	switch v := value.(type) {
+	case starlark.String:
+		data, defaultType = []byte(v), "text/plain; charset=utf-8"
+	case starlark.Bytes:
+		data, defaultType = []byte(v), "application/octet-stream"
+	default:
+		var buf bytes.Buffer
+		if err := encodeJSON(&buf, value, -1); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		data = buf.Bytes()
+	}
+	if contentType == "" {
+		contentType = defaultType
+	}
+	if len(data) > maxArtifactSize {
+		return nil, fmt.Errorf("%s: artifact %q is %d bytes, limit is %d", fn.Name(), name, len(data), maxArtifactSize)
+	}
+
+	if err := artifacts.add(Artifact{Name: name, ContentType: contentType, Size: len(data), data: data}); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	return starlark.None, nil
+}
@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAttach_RecordsArtifactsOnRun(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "energy_report", `
+def on_schedule(ctx):
+    ctx.attach("summary.txt", "Used 42 kWh")
+    ctx.attach("chart", {"labels": ["Mon", "Tue"], "values": [20, 22]})
+    ctx.attach("summary.txt", "Used 43 kWh")
+    ctx.attach("report.csv", "day,kwh\nMon,20\n", content_type = "text/csv")
+
+config = {"name": "Weekly Energy Summary"}
+`)
+
+	record, err := r.RunManual("energy_report", ManualTrigger{})
+	if err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	if record.ID == "" || len(record.Artifacts) != 3 {
+		t.Fatalf("record = %+v, want an ID and 3 artifacts", record)
+	}
+
+	tests := []struct {
+		name, contentType, data string
+	}{
+		{"summary.txt", "text/plain; charset=utf-8", "Used 43 kWh"},
+		{"chart", "application/json", `{"labels":["Mon","Tue"],"values":[20,22]}`},
+		{"report.csv", "text/csv", "day,kwh\nMon,20\n"},
+	}
+	for _, tt := range tests {
+		artifact, ok := r.GetRunArtifact(record.ID, tt.name)
+		if !ok {
+			t.Errorf("artifact %q not found", tt.name)
+			continue
+		}
+		if artifact.ContentType != tt.contentType || string(artifact.Data()) != tt.data || artifact.Size != len(tt.data) {
+			t.Errorf("artifact %q = %s %q (%d bytes), want %s %q", tt.name, artifact.ContentType, artifact.Data(), artifact.Size, tt.contentType, tt.data)
+		}
+	}
+
+	if _, ok := r.GetRunArtifact(record.ID, "missing"); ok {
+		t.Error("unexpected artifact for unknown name")
+	}
+}
+
+func TestAttach_Limits(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "greedy", `
+def on_schedule(ctx):
+    for i in range(9):
+        ctx.attach("a%d" % i, "x")
+
+config = {"name": "Greedy"}
+`)
+	addTestAutomation(t, r, "huge", `
+def on_schedule(ctx):
+    ctx.attach("big", "x" * (300 * 1024))
+
+config = {"name": "Huge"}
+`)
+
+	if _, err := r.RunManual("greedy", ManualTrigger{}); err == nil || !strings.Contains(err.Error(), "at most") {
+		t.Errorf("RunManual(greedy) error = %v, want artifact count limit", err)
+	}
+	if _, err := r.RunManual("huge", ManualTrigger{}); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("RunManual(huge) error = %v, want size limit", err)
+	}
+}
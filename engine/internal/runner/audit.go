@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Audit kinds recorded from ctx builtins at runtime
+const (
+	AuditPublish     = "publish"
+	AuditGlobalRead  = "global_read"
+	AuditGlobalWrite = "global_write"
+
+	// AuditGlobalDenied is a set_global/clear_global refused by global_state_writes
+	AuditGlobalDenied = "global_write_denied"
+
+	// Denials of undeclared reads, publishes and library use in strict mode
+	AuditReadDenied    = "global_read_denied"
+	AuditPublishDenied = "publish_denied"
+	AuditLibraryDenied = "library_denied"
+
+	// Secrets read through ctx.secret, and reads refused by the config's secrets list
+	AuditSecretRead   = "secret_read"
+	AuditSecretDenied = "secret_denied"
+
+	// AuditServiceCall is a ctx.call of a service; the target is "<automation>:<service>"
+	AuditServiceCall = "service_call"
+)
+
+// AuditEntry summarizes what an automation actually touched at runtime
+type AuditEntry struct {
+	AutomationID string    `json:"automation_id"`
+	Kind         string    `json:"kind"`
+	Target       string    `json:"target"`
+	Count        int       `json:"count"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// audit tracks per-automation runtime activity (publishes, global reads and
+// writes) and detects automations competing over the same targets
+type audit struct {
+	mu        sync.Mutex
+	entries   map[string]*AuditEntry
+	conflicts *conflictDetector
+}
+
+func newAudit() *audit {
+	return &audit{
+		entries:   make(map[string]*AuditEntry),
+		conflicts: newConflictDetector(),
+	}
+}
+
+// recordWrite notes a publish or global write along with the written value,
+// so competing writers can be detected
+func (a *audit) recordWrite(automationID, kind, target, value string) {
+	if a == nil {
+		return
+	}
+	a.record(automationID, kind, target)
+	a.conflicts.observe(kind, target, automationID, value)
+}
+
+// record notes one occurrence of an automation touching a target
+func (a *audit) record(automationID, kind, target string) {
+	if a == nil {
+		return
+	}
+	key := automationID + "\x00" + kind + "\x00" + target
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.entries[key]
+	if !ok {
+		entry = &AuditEntry{AutomationID: automationID, Kind: kind, Target: target}
+		a.entries[key] = entry
+	}
+	entry.Count++
+	entry.LastSeen = time.Now()
+}
+
+// snapshot returns a sorted copy of all entries
+func (a *audit) snapshot() []AuditEntry {
+	a.mu.Lock()
+	result := make([]AuditEntry, 0, len(a.entries))
+	for _, entry := range a.entries {
+		result = append(result, *entry)
+	}
+	a.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].AutomationID != result[j].AutomationID {
+			return result[i].AutomationID < result[j].AutomationID
+		}
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+		return result[i].Target < result[j].Target
+	})
+	return result
+}
+
+// GetAudit returns what each automation has touched at runtime
+func (r *Runner) GetAudit() []AuditEntry {
+	return r.audit.snapshot()
+}
@@ -0,0 +1,229 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"gopkg.in/yaml.v3"
+)
+
+// BlueprintsDir is the subdirectory of the automations directory holding
+// blueprints: automation templates that read their settings from a
+// predeclared params dict. They only run through instances, declarative files
+// that name a blueprint and its params.
+const BlueprintsDir = "blueprints"
+
+// Blueprint is an automation template and the loaded automations using it
+type Blueprint struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"` // Module docstring
+	Instances   []string `json:"instances"`             // Automation IDs
+}
+
+// blueprintInstance is a declarative file instantiating a blueprint
+type blueprintInstance struct {
+	Blueprint string         `yaml:"blueprint"`
+	Params    map[string]any `yaml:"params"`
+}
+
+// parseInstance returns the blueprint instance in a declarative file, or nil
+// for a trigger/condition/action automation
+func parseInstance(data []byte) (*blueprintInstance, error) {
+	var instance blueprintInstance
+	if err := yaml.Unmarshal(data, &instance); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	if instance.Blueprint == "" {
+		return nil, nil
+	}
+	if !validBlueprintName(instance.Blueprint) {
+		return nil, fmt.Errorf("invalid blueprint name %q", instance.Blueprint)
+	}
+	return &instance, nil
+}
+
+// validBlueprintName reports whether name is a file name inside BlueprintsDir
+func validBlueprintName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
+
+// BlueprintInstanceYAML returns the declarative file instantiating blueprint
+// name with params
+func BlueprintInstanceYAML(name string, params map[string]any) (string, error) {
+	if !validBlueprintName(name) {
+		return "", fmt.Errorf("invalid blueprint name %q", name)
+	}
+	data, err := yaml.Marshal(blueprintInstance{Blueprint: name, Params: params})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// load reads the instance's blueprint from blueprintsDir. It returns the
+// blueprint's path and source, and its predeclared names: the blueprints'
+// _common.star plus the instance's params, frozen.
+func (instance *blueprintInstance) load(blueprintsDir string) (string, []byte, starlark.StringDict, error) {
+	path := filepath.Join(blueprintsDir, instance.Blueprint+".star")
+	src, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil, nil, fmt.Errorf("blueprint %s not found in %s/", instance.Blueprint, BlueprintsDir)
+	}
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to read blueprint %s: %w", instance.Blueprint, err)
+	}
+	common, err := LoadCommon(blueprintsDir)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	params, ok := goToStarlark(instance.Params).(*starlark.Dict)
+	if !ok {
+		params = starlark.NewDict(0)
+	}
+	params.Freeze()
+	predeclared := make(starlark.StringDict, len(common)+1)
+	for name, value := range common {
+		predeclared[name] = value
+	}
+	predeclared["params"] = params
+	return path, src, predeclared, nil
+}
+
+// blueprintsDir returns the blueprints directory for the automation in
+// filePath: below the automations directory, or next to the file without one
+func (r *Runner) blueprintsDir(filePath string) string {
+	dir := r.automationsDir
+	if dir == "" {
+		dir = filepath.Dir(filePath)
+	}
+	return filepath.Join(dir, BlueprintsDir)
+}
+
+// automationSource is the Starlark an automation file runs
+type automationSource struct {
+	path        string // The blueprint for instances, otherwise the file itself
+	code        []byte
+	predeclared starlark.StringDict
+	blueprint   string
+}
+
+// loadSource returns what the automation in filePath runs. Declarative files
+// compile to Starlark, and blueprint instances run their blueprint with params.
+func (r *Runner) loadSource(filePath string, data []byte) (automationSource, error) {
+	source := automationSource{path: filePath, code: data}
+	if IsDeclarativeFile(filePath) {
+		instance, err := parseInstance(data)
+		if err != nil {
+			return automationSource{}, fmt.Errorf("invalid declarative automation: %w", err)
+		}
+		if instance != nil {
+			source.path, source.code, source.predeclared, err = instance.load(r.blueprintsDir(filePath))
+			source.blueprint = instance.Blueprint
+			return source, err
+		}
+		code, err := CompileDeclarative(data)
+		if err != nil {
+			return automationSource{}, fmt.Errorf("invalid declarative automation: %w", err)
+		}
+		source.code = []byte(code)
+	}
+
+	common, err := LoadCommon(filepath.Dir(filePath))
+	if err != nil {
+		return automationSource{}, err
+	}
+	source.predeclared = common
+	return source, nil
+}
+
+// validateInstance validates a blueprint instance as if it were placed in
+// automations directory dir
+func validateInstance(instance *blueprintInstance, dir string) ValidationResult {
+	_, src, predeclared, err := instance.load(filepath.Join(dir, BlueprintsDir))
+	if err != nil {
+		return ValidationResult{Valid: false, Errors: []string{err.Error()}}
+	}
+	return validateCode(string(src), "automation", predeclared)
+}
+
+// ListBlueprints returns the blueprints in the automations directory, sorted
+// by name, with the automations instantiating them
+func (r *Runner) ListBlueprints() ([]Blueprint, error) {
+	dir := filepath.Join(r.automationsDir, BlueprintsDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Blueprint{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make(map[string][]string)
+	r.mu.RLock()
+	for _, a := range r.automations {
+		if a.Blueprint != "" {
+			instances[a.Blueprint] = append(instances[a.Blueprint], a.ID)
+		}
+	}
+	r.mu.RUnlock()
+
+	blueprints := []Blueprint{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".star") || IsTestFile(name) || IsCommonFile(name) {
+			continue
+		}
+		src, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		blueprint := Blueprint{Name: strings.TrimSuffix(name, ".star"), Instances: []string{}}
+		blueprint.Description = moduleDocstring(name, src)
+		if ids := instances[blueprint.Name]; ids != nil {
+			sort.Strings(ids)
+			blueprint.Instances = ids
+		}
+		blueprints = append(blueprints, blueprint)
+	}
+	return blueprints, nil
+}
+
+// BlueprintInstanceFiles returns the files of the automations instantiating
+// blueprint name, including ones that failed to load, so a changed blueprint
+// can reload them
+func (r *Runner) BlueprintInstanceFiles(name string) []string {
+	seen := make(map[string]bool)
+	r.mu.RLock()
+	for _, a := range r.automations {
+		if a.Blueprint == name {
+			seen[a.FilePath] = true
+		}
+	}
+	r.mu.RUnlock()
+	for _, loadErr := range r.GetLoadErrors() {
+		if !IsDeclarativeFile(loadErr.File) || seen[loadErr.File] {
+			continue
+		}
+		data, err := os.ReadFile(loadErr.File)
+		if err != nil {
+			continue
+		}
+		if instance, err := parseInstance(data); err == nil && instance != nil && instance.Blueprint == name {
+			seen[loadErr.File] = true
+		}
+	}
+
+	files := make([]string, 0, len(seen))
+	for file := range seen {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testBlueprint = `"""Turns a light on with motion and off after a delay."""
+
+config = {"name": "Motion light: " + params["light"]}
+
+def on_message(topic, payload, ctx):
+    ctx.log("%s for %ds" % (params["light"], params.get("timeout", 300)))
+`
+
+func writeBlueprintFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, code := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBlueprintInstances(t *testing.T) {
+	dir := t.TempDir()
+	writeBlueprintFiles(t, dir, map[string]string{
+		"blueprints/motion_light.star": testBlueprint,
+		"kitchen.auto.yaml":            "blueprint: motion_light\nparams:\n  light: kitchen_light\n  timeout: 60\n",
+		"hallway.auto.yaml":            "blueprint: motion_light\nparams:\n  light: hallway_light\n",
+		"broken.auto.yaml":             "blueprint: motion_light\nparams: {}\n",
+		"missing.auto.yaml":            "blueprint: door_chime\n",
+	})
+	r := New(nil, nil)
+	r.SetAutomationsDir(dir)
+	for _, name := range []string{"kitchen", "hallway", "broken", "missing"} {
+		r.LoadAutomation(filepath.Join(dir, name+".auto.yaml"))
+	}
+
+	kitchen, err := r.lookup("kitchen")
+	if err != nil || kitchen.Config.Name != "Motion light: kitchen_light" || kitchen.Blueprint != "motion_light" {
+		t.Fatalf("kitchen = %+v, %v", kitchen, err)
+	}
+	if _, err := r.RunManual("kitchen", ManualTrigger{Topic: "kitchen/motion", Payload: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, r, "kitchen_light for 60s")
+
+	errs := map[string]string{}
+	for _, loadErr := range r.GetLoadErrors() {
+		errs[loadErr.AutomationID] = loadErr.Error
+	}
+	if !strings.Contains(errs["broken"], `key "light" not in dict`) || !strings.Contains(errs["missing"], "blueprint door_chime not found") {
+		t.Errorf("load errors = %v", errs)
+	}
+
+	blueprints, err := r.ListBlueprints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blueprints) != 1 || blueprints[0].Name != "motion_light" || !slices.Equal(blueprints[0].Instances, []string{"hallway", "kitchen"}) ||
+		blueprints[0].Description != "Turns a light on with motion and off after a delay." {
+		t.Errorf("blueprints = %+v", blueprints)
+	}
+
+	var files []string
+	for _, file := range r.BlueprintInstanceFiles("motion_light") {
+		files = append(files, filepath.Base(file))
+	}
+	if want := []string{"broken.auto.yaml", "hallway.auto.yaml", "kitchen.auto.yaml"}; !slices.Equal(files, want) {
+		t.Errorf("instance files = %v, want %v", files, want)
+	}
+}
+
+func TestValidateBlueprintInstance(t *testing.T) {
+	dir := t.TempDir()
+	writeBlueprintFiles(t, dir, map[string]string{"blueprints/motion_light.star": testBlueprint})
+
+	code, err := BlueprintInstanceYAML("motion_light", map[string]any{"light": "kitchen_light"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := ValidateCodeIn(code, "declarative", dir); !result.Valid {
+		t.Errorf("valid instance: %v", result.Errors)
+	}
+	if result := ValidateCodeIn("blueprint: motion_light\n", "declarative", dir); result.Valid {
+		t.Error("instance without its params should be invalid")
+	}
+	if result := ValidateCodeIn("blueprint: door_chime\n", "declarative", dir); result.Valid {
+		t.Error("instance of a missing blueprint should be invalid")
+	}
+	if _, err := BlueprintInstanceYAML("../lib/utils", nil); err == nil {
+		t.Error("blueprint names must not leave the blueprints directory")
+	}
+}
@@ -0,0 +1,32 @@
+package runner
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// withinBudget counts a run against the automation's max_runs_per_day and
+// reports whether it may proceed. Counters live in the state store so the
+// budget survives restarts.
+func (r *Runner) withinBudget(automation *Automation) bool {
+	limit := automation.Config.MaxRunsPerDay
+	if limit <= 0 || r.stateStore == nil {
+		return true
+	}
+
+	count, err := r.stateStore.IncrementCounter("runs:"+automation.ID, time.Now().Format("2006-01-02"))
+	if err != nil {
+		slog.Error("Failed to update run budget", "automation", automation.ID, "error", err)
+		return true
+	}
+
+	if count > limit {
+		// Log once when the budget is first exceeded, not on every skipped run
+		if count == limit+1 {
+			r.addLog(automation.ID, LogLevelError, fmt.Sprintf("ERROR: daily run budget of %d exhausted, skipping runs until tomorrow", limit))
+		}
+		return false
+	}
+	return true
+}
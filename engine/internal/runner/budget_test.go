@@ -0,0 +1,36 @@
+package runner
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+func TestWithinBudget(t *testing.T) {
+	store, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	r := &Runner{stateStore: store, maxLogs: 10}
+	automation := &Automation{ID: "chatty", Config: AutomationConfig{MaxRunsPerDay: 2}}
+
+	if !r.withinBudget(automation) || !r.withinBudget(automation) {
+		t.Fatal("first two runs should be within budget")
+	}
+	if r.withinBudget(automation) {
+		t.Error("third run should exceed the budget")
+	}
+	if len(r.GetLogs()) != 1 {
+		t.Errorf("expected exactly one budget log entry, got %d", len(r.GetLogs()))
+	}
+
+	unlimited := &Automation{ID: "free"}
+	for i := 0; i < 5; i++ {
+		if !r.withinBudget(unlimited) {
+			t.Fatal("automation without budget should always run")
+		}
+	}
+}
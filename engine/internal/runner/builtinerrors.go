@@ -0,0 +1,75 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// threadLocalLastError holds the most recent builtin failure of the current run
+const threadLocalLastError = "homebrain.last_error"
+
+// Codes of ctx.last_error(). They say why a builtin returned False so an
+// automation can tell a missing permission, which needs a config change, from
+// an outage it may want to wait out.
+const (
+	errCodePermissionDenied = "permission_denied" // Key or topic not declared in config
+	errCodeUnavailable      = "unavailable"       // Broker, sink, notification channel or device unreachable
+	errCodeNotConfigured    = "not_configured"    // No notification channel configured
+	errCodeQuotaExceeded    = "quota_exceeded"    // Data directory limit reached
+	errCodeStorage          = "storage_error"     // State store or data directory failed
+	errCodeTimeout          = "timeout"           // No response arrived in time
+)
+
+// errDataLimit is returned by ctx.file.write when the data directory is full
+var errDataLimit = errors.New("data directory limit exceeded")
+
+// builtinError is a failure reported by a builtin that returned False
+type builtinError struct {
+	code    string
+	message string
+	builtin string
+	target  string // Topic, key, channel or pin; empty if none applies
+}
+
+// failed records a builtin failure as the run's last error and returns False
+func failed(thread *starlark.Thread, fn *starlark.Builtin, code, target string, err error) (starlark.Value, error) {
+	if thread != nil {
+		thread.SetLocal(threadLocalLastError, &builtinError{code: code, message: err.Error(), builtin: fn.Name(), target: target})
+	}
+	return starlark.False, nil
+}
+
+// lastErrorBuiltin implements ctx.last_error(): the most recent failure of a
+// builtin in this run as a struct with code, message, builtin and target, or
+// None. Successful calls don't clear it.
+func (c *Context) lastErrorBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	last, _ := thread.Local(threadLocalLastError).(*builtinError)
+	if last == nil {
+		return starlark.None, nil
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"code":    starlark.String(last.code),
+		"message": starlark.String(last.message),
+		"builtin": starlark.String(last.builtin),
+		"target":  starlark.String(last.target),
+	}), nil
+}
+
+// storageCode is the error code of a failed data directory write
+func storageCode(err error) string {
+	if errors.Is(err, errDataLimit) {
+		return errCodeQuotaExceeded
+	}
+	return errCodeStorage
+}
+
+// permissionDenied is the error of a write to an undeclared key or topic
+func permissionDenied(target, field string) error {
+	return fmt.Errorf("%s is not declared in %s", target, field)
+}
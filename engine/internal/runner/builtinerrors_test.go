@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+func TestLastError(t *testing.T) {
+	store, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	r := newTestRunner()
+	a := addTestAutomation(t, r, "porch", `
+config = {"name": "Porch", "subscribe": ["porch"], "global_state_writes": ["porch.*"]}
+
+def on_message(topic, payload, ctx):
+    before = ctx.last_error()
+    ok = True
+    if payload == "global":
+        ok = ctx.set_global("house.mode", "away")
+    elif payload == "publish":
+        ok = ctx.publish("zigbee2mqtt/porch/set", "ON")
+    elif payload == "notify":
+        ok = ctx.notify("Porch", "Motion")
+    elif payload == "file":
+        ok = ctx.file.write("motion.log", "too long")
+    ctx.set_global("porch.seen", True)
+    err = ctx.last_error()
+    if err == None:
+        return [before, ok, None]
+    return [before, ok, err.code, err.builtin, err.target, err.message != ""]
+`)
+	a.context.stateStore = store
+	a.context.mqttClient = &flakyPublisher{failures: 1}
+	a.context.files = &fileStore{dir: t.TempDir(), limit: 4}
+
+	tests := []struct {
+		payload string
+		want    []any
+	}{
+		{"ok", []any{nil, true, nil}},
+		{"global", []any{nil, false, errCodePermissionDenied, "set_global", "house.mode", true}},
+		{"publish", []any{nil, false, errCodeUnavailable, "publish", "zigbee2mqtt/porch/set", true}},
+		{"notify", []any{nil, false, errCodeNotConfigured, "notify", "", true}},
+		{"file", []any{nil, false, errCodeQuotaExceeded, "file.write", "motion.log", true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			record, err := r.handleMessage(a, Trigger{Type: TriggerMQTT, Topic: "porch", Time: time.Now()}, []byte(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := record.Result.([]any)
+			if len(got) != len(tt.want) {
+				t.Fatalf("result = %v, want %v", record.Result, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("result = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// changeTracker remembers the last payload seen per on_change_only
+// subscription and topic, so devices that republish identical state every few
+// seconds don't re-run the handler. A nil tracker lets everything through.
+type changeTracker struct {
+	fields map[string]string // Topic pattern -> compared JSON field ("" = whole payload)
+	mu     sync.Mutex
+	last   map[string]string // pattern + "|" + topic -> last compared value
+}
+
+func newChangeTracker(fields map[string]string) *changeTracker {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &changeTracker{fields: fields, last: make(map[string]string)}
+}
+
+// changed records the message and reports whether it differs from the
+// previous one on the same topic. The first message always counts as a change.
+func (c *changeTracker) changed(pattern, topic string, payload []byte, decoded *payloadJSON) bool {
+	if c == nil {
+		return true
+	}
+	field, ok := c.fields[pattern]
+	if !ok {
+		return true
+	}
+	value := comparableValue(field, payload, decoded)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := pattern + "|" + topic
+	prev, seen := c.last[key]
+	c.last[key] = value
+	return !seen || prev != value
+}
+
+// comparableValue returns the compared part of a payload. JSON is
+// re-encoded so key order and whitespace don't count as changes; field is a
+// dotted path into a JSON object, and a missing field compares as empty.
+func comparableValue(field string, payload []byte, decoded *payloadJSON) string {
+	if decoded == nil {
+		decoded = newPayloadJSON(payload)
+	}
+	value, ok := decoded.get()
+	if !ok {
+		if field != "" {
+			return ""
+		}
+		return string(payload)
+	}
+
+	if field != "" {
+		for _, part := range strings.Split(field, ".") {
+			obj, ok := value.(map[string]any)
+			if !ok {
+				return ""
+			}
+			value = obj[part]
+		}
+	}
+
+	// encoding/json sorts map keys
+	data, err := json.Marshal(value)
+	if err != nil {
+		return string(payload)
+	}
+	return string(data)
+}
@@ -0,0 +1,49 @@
+package runner
+
+import "testing"
+
+func TestChangeTracker(t *testing.T) {
+	c := newChangeTracker(map[string]string{
+		"zigbee2mqtt/+":          "",
+		"zigbee2mqtt/thermostat": "temperature",
+	})
+
+	tests := []struct {
+		name, pattern, topic, payload string
+		expected                      bool
+	}{
+		{"first message", "zigbee2mqtt/+", "zigbee2mqtt/lamp", `{"state":"ON","brightness":100}`, true},
+		{"identical repeat", "zigbee2mqtt/+", "zigbee2mqtt/lamp", `{"state":"ON","brightness":100}`, false},
+		{"reordered keys", "zigbee2mqtt/+", "zigbee2mqtt/lamp", `{"brightness": 100, "state": "ON"}`, false},
+		{"other topic on same pattern", "zigbee2mqtt/+", "zigbee2mqtt/plug", `{"state":"ON","brightness":100}`, true},
+		{"real change", "zigbee2mqtt/+", "zigbee2mqtt/lamp", `{"state":"OFF","brightness":100}`, true},
+		{"field first", "zigbee2mqtt/thermostat", "zigbee2mqtt/thermostat", `{"temperature":21.5,"linkquality":80}`, true},
+		{"field unchanged", "zigbee2mqtt/thermostat", "zigbee2mqtt/thermostat", `{"temperature":21.5,"linkquality":95}`, false},
+		{"field changed", "zigbee2mqtt/thermostat", "zigbee2mqtt/thermostat", `{"temperature":22,"linkquality":95}`, true},
+		{"not filtered", "other/#", "other/x", "same", true},
+		{"not filtered repeat", "other/#", "other/x", "same", true},
+	}
+
+	for _, tt := range tests {
+		if got := c.changed(tt.pattern, tt.topic, []byte(tt.payload), nil); got != tt.expected {
+			t.Errorf("%s: changed() = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestChangeTracker_PlainPayloads(t *testing.T) {
+	c := newChangeTracker(map[string]string{"door/state": ""})
+	for i, tt := range []struct {
+		payload  string
+		expected bool
+	}{{"open", true}, {"open", false}, {"closed", true}} {
+		if got := c.changed("door/state", "door/state", []byte(tt.payload), nil); got != tt.expected {
+			t.Errorf("message %d (%s): changed() = %v, want %v", i, tt.payload, got, tt.expected)
+		}
+	}
+
+	var none *changeTracker
+	if !none.changed("a", "a", []byte("x"), nil) {
+		t.Error("nil tracker should let every message through")
+	}
+}
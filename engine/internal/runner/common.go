@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// CommonFile is a directory's shared module. Its public globals (constants and
+// small helpers) are predeclared in every automation in that directory.
+const CommonFile = "_common.star"
+
+// IsCommonFile reports whether path is a directory's common module
+func IsCommonFile(path string) bool {
+	return filepath.Base(path) == CommonFile
+}
+
+// LoadCommon executes dir's common module and returns its public globals,
+// frozen. Names starting with an underscore stay private to the module. It
+// returns nil if dir has no common module.
+func LoadCommon(dir string) (starlark.StringDict, error) {
+	path := filepath.Join(dir, CommonFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", CommonFile, err)
+	}
+
+	globals, err := starlark.ExecFile(&starlark.Thread{Name: CommonFile}, path, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute %s: %w", path, err)
+	}
+
+	common := make(starlark.StringDict, len(globals))
+	for name, value := range globals {
+		switch {
+		case strings.HasPrefix(name, "_"):
+			continue
+		case name == "config" || name == "on_message" || name == "on_schedule" || name == "on_timer" || name == "on_state_change" || name == "on_webhook" || name == "on_error" || name == "services":
+			return nil, fmt.Errorf("%s must not define %s; it belongs in each automation", path, name)
+		}
+		common[name] = value
+	}
+	common.Freeze()
+	return common, nil
+}
@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCommon = `
+ROOM = "bedroom"
+_SUFFIX = "/set"
+
+def light_topic(name):
+    return "zigbee2mqtt/%s_%s%s" % (ROOM, name, _SUFFIX)
+`
+
+func TestLoadCommon(t *testing.T) {
+	dir := t.TempDir()
+	common, err := LoadCommon(dir)
+	if err != nil || common != nil {
+		t.Fatalf("LoadCommon without %s = %v, %v; want nil, nil", CommonFile, common, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, CommonFile), []byte(testCommon), 0644)
+	common, err = LoadCommon(dir)
+	if err != nil {
+		t.Fatalf("LoadCommon failed: %v", err)
+	}
+	if _, ok := common["light_topic"]; !ok || common["ROOM"].String() != `"bedroom"` {
+		t.Errorf("common = %v, want ROOM and light_topic", common.Keys())
+	}
+	if _, ok := common["_SUFFIX"]; ok {
+		t.Error("underscore names should stay private to the common module")
+	}
+
+	for _, bad := range []string{"config = {}", "def on_message(topic, payload, ctx):\n    pass", "x = ("} {
+		os.WriteFile(filepath.Join(dir, CommonFile), []byte(bad), 0644)
+		if _, err := LoadCommon(dir); err == nil {
+			t.Errorf("LoadCommon(%q) should fail", bad)
+		}
+	}
+}
+
+func TestValidateCodeIn_UsesCommonNames(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, CommonFile), []byte(testCommon), 0644)
+	code := `
+config = {"name": "Bedroom Light", "subscribe": ["zigbee2mqtt/bedroom_motion"]}
+
+def on_message(topic, payload, ctx):
+    ctx.publish(light_topic("ceiling"), "ON")
+`
+	if result := ValidateCode(code, "automation"); result.Valid {
+		t.Error("ValidateCode should reject names that are only defined in a common module")
+	}
+	if result := ValidateCodeIn(code, "automation", dir); !result.Valid {
+		t.Errorf("ValidateCodeIn errors = %v", result.Errors)
+	}
+	if result := LintIn(code, dir); len(result.Errors) != 0 {
+		t.Errorf("LintIn errors = %v", result.Errors)
+	}
+
+	os.WriteFile(filepath.Join(dir, CommonFile), []byte("config = {}"), 0644)
+	if result := ValidateCodeIn(code, "automation", dir); result.Valid || !strings.Contains(result.Errors[0], CommonFile) {
+		t.Errorf("broken common module should be reported, got %+v", result)
+	}
+}
+
+func TestDryRun_UsesLoadedAutomationCommon(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, CommonFile), []byte(testCommon), 0644)
+	common, err := LoadCommon(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRunner()
+	code := `
+config = {"name": "Bedroom Light", "subscribe": ["zigbee2mqtt/bedroom_motion"]}
+
+def on_message(topic, payload, ctx):
+    ctx.publish(light_topic("ceiling"), "ON")
+`
+	r.automations["bedroom_light"] = &Automation{ID: "bedroom_light", source: code, common: common}
+
+	for _, req := range []DryRunRequest{
+		{AutomationID: "bedroom_light", Payload: "{}"},
+		{AutomationID: "bedroom_light", Code: code, Payload: "{}"},
+	} {
+		result, err := r.DryRun(req)
+		if err != nil {
+			t.Fatalf("DryRun failed: %v", err)
+		}
+		if len(result.Published) != 1 || result.Published[0].Topic != "zigbee2mqtt/bedroom_ceiling/set" {
+			t.Errorf("Published = %+v", result.Published)
+		}
+	}
+}
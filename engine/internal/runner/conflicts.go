@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	defaultConflictWindow = 5 * time.Second
+	maxConflicts          = 100
+)
+
+// Conflict describes two automations fighting over the same device topic or
+// global key: different values written within the conflict window.
+type Conflict struct {
+	Kind        string    `json:"kind"` // AuditPublish or AuditGlobalWrite
+	Target      string    `json:"target"`
+	Automations [2]string `json:"automations"` // earlier writer, later writer
+	Values      [2]string `json:"values"`
+	Interval    string    `json:"interval"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+type lastWrite struct {
+	automationID string
+	value        string
+	at           time.Time
+}
+
+// conflictDetector remembers the last writer per target and flags competing writes
+type conflictDetector struct {
+	mu         sync.Mutex
+	window     time.Duration
+	last       map[string]lastWrite
+	recent     []Conflict
+	onConflict func(Conflict)
+}
+
+func newConflictDetector() *conflictDetector {
+	return &conflictDetector{
+		window: defaultConflictWindow,
+		last:   make(map[string]lastWrite),
+	}
+}
+
+// observe records a write and returns true if it conflicts with the previous one
+func (d *conflictDetector) observe(kind, target, automationID, value string) bool {
+	now := time.Now()
+	key := kind + "\x00" + target
+
+	d.mu.Lock()
+	prev, seen := d.last[key]
+	d.last[key] = lastWrite{automationID: automationID, value: value, at: now}
+
+	if !seen || prev.automationID == automationID || prev.value == value || now.Sub(prev.at) > d.window {
+		d.mu.Unlock()
+		return false
+	}
+
+	conflict := Conflict{
+		Kind:        kind,
+		Target:      target,
+		Automations: [2]string{prev.automationID, automationID},
+		Values:      [2]string{prev.value, value},
+		Interval:    now.Sub(prev.at).Round(time.Millisecond).String(),
+		DetectedAt:  now,
+	}
+	d.recent = append(d.recent, conflict)
+	if len(d.recent) > maxConflicts {
+		d.recent = d.recent[len(d.recent)-maxConflicts:]
+	}
+	onConflict := d.onConflict
+	d.mu.Unlock()
+
+	slog.Warn("Competing writers detected", "kind", kind, "target", target,
+		"automations", conflict.Automations, "interval", conflict.Interval)
+	if onConflict != nil {
+		onConflict(conflict)
+	}
+	return true
+}
+
+func (d *conflictDetector) snapshot() []Conflict {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := make([]Conflict, len(d.recent))
+	copy(result, d.recent)
+	return result
+}
+
+// SetConflictWindow sets how close two differing writes must be to count as a
+// conflict; zero restores the default
+func (r *Runner) SetConflictWindow(window time.Duration) {
+	if window <= 0 {
+		window = defaultConflictWindow
+	}
+	r.audit.conflicts.mu.Lock()
+	r.audit.conflicts.window = window
+	r.audit.conflicts.mu.Unlock()
+}
+
+// GetConflicts returns recently detected competing writes
+func (r *Runner) GetConflicts() []Conflict {
+	return r.audit.conflicts.snapshot()
+}
@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConflictDetector(t *testing.T) {
+	d := newConflictDetector()
+	d.window = time.Second
+
+	var notified []Conflict
+	d.onConflict = func(c Conflict) { notified = append(notified, c) }
+
+	topic := "zigbee2mqtt/heater/set"
+	if d.observe(AuditPublish, topic, "heating", `{"state":"ON"}`) {
+		t.Error("first write cannot conflict")
+	}
+	if d.observe(AuditPublish, topic, "heating", `{"state":"OFF"}`) {
+		t.Error("same automation changing its mind is not a conflict")
+	}
+	if d.observe(AuditPublish, topic, "window_guard", `{"state":"OFF"}`) {
+		t.Error("same value from another automation is not a conflict")
+	}
+	if !d.observe(AuditPublish, topic, "heating", `{"state":"ON"}`) {
+		t.Error("expected conflict for different value from another automation")
+	}
+
+	conflicts := d.snapshot()
+	if len(conflicts) != 1 || len(notified) != 1 {
+		t.Fatalf("got %d conflicts, %d notifications; want 1 each", len(conflicts), len(notified))
+	}
+	if conflicts[0].Automations != [2]string{"window_guard", "heating"} {
+		t.Errorf("Automations = %v", conflicts[0].Automations)
+	}
+}
+
+func TestConflictDetector_OutsideWindow(t *testing.T) {
+	d := newConflictDetector()
+	d.window = 10 * time.Millisecond
+
+	d.observe(AuditGlobalWrite, "mode", "a", "1")
+	time.Sleep(20 * time.Millisecond)
+	if d.observe(AuditGlobalWrite, "mode", "b", "2") {
+		t.Error("writes outside the window should not conflict")
+	}
+}
@@ -1,29 +1,105 @@
 package runner
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 
+	"github.com/homebrain/engine/internal/connector"
+	"github.com/homebrain/engine/internal/gpio"
 	"github.com/homebrain/engine/internal/mqtt"
+	"github.com/homebrain/engine/internal/notify"
 	"github.com/homebrain/engine/internal/state"
 )
 
+// Publisher sends MQTT messages (the MQTT client, or a recorder in dry runs)
+type Publisher interface {
+	Publish(topic string, payload []byte, opts mqtt.PublishOptions) error
+}
+
+// StateBackend stores per-automation state, global state and feature flags
+// (the BoltDB store, or an in-memory copy in dry runs)
+type StateBackend interface {
+	GetState(automationID, key string) (any, error)
+	SetState(automationID, key string, value any) error
+	ClearState(automationID, key string) error
+	GetGlobalState(key string) (any, error)
+	SetGlobalState(key string, value any) error
+	ClearGlobalState(key string) error
+	RecordGlobalHistory(key string, entry state.HistoryEntry) error
+	GetGlobalHistory(key string, limit int) ([]state.HistoryEntry, error)
+	GetFlag(name string) (*state.Flag, error)
+	Throttle(automationID, key string, now time.Time, interval time.Duration) (bool, error)
+}
+
 // Context provides the runtime context for Starlark automations
 type Context struct {
 	automationID        string
-	mqttClient          *mqtt.Client
-	stateStore          *state.Store
-	logFunc             func(automationID, message string)
+	mqttClient          Publisher
+	stateStore          StateBackend
+	logFunc             func(automationID, level, message string)
 	allowedGlobalWrites []string // Patterns for allowed global state writes
 	libraryManager      *LibraryManager
+	gpio                *gpio.Controller // nil when GPIO is not enabled
+	files               *fileStore       // nil when no data directory is configured
+	notify              func(channel string, msg notify.Message) error
+	httpClient          *http.Client                     // nil in dry runs
+	httpAllow           []string                         // Hosts ctx.http_* may reach (config http_allow)
+	allowedSecrets      []string                         // Secret name patterns ctx.secret may read (config secrets)
+	strict              *strictPermissions               // nil unless the engine runs in strict mode
+	secret              func(name string) (string, bool) // nil when no secrets are configured
+	sinks               map[string]connector.Connector
+	isWarmingUp         func() bool
+	audit               *audit
+	loops               *loopDetector
+	call                func(thread *starlark.Thread, caller, id, topic, payload string) (any, error)
+	callService         func(thread *starlark.Thread, caller, id, service string, args any) (any, error)
+	setTimer            func(id string, delay time.Duration, data json.RawMessage, priority string) error
+	cancelTimer         func(id string) (bool, error)
+	timerPending        func(id string) bool
+	subscribe           func(topic string) (bool, error)
+	unsubscribe         func(topic string) bool
+	setOverride         func(override state.Override) (state.Override, error)
+	cancelOverride      func(target string, allowed func(state.Override) bool) error
+	startJob            func(name, fnName string, data any) (string, error)
+	cancelJob           func(name string) bool
+	clock               func() time.Time // nil means time.Now
+	idempotency         *idempotencyCache
+	profiles            []string // Available profiles, default first
+	persons             []string // Tracked persons for ctx.presence
+
+	// writeGlobal sets or clears a global key through the runner, which also
+	// tells watching automations; nil in dry runs
+	writeGlobal func(thread *starlark.Thread, key string, value any, clear bool) error
+
+	// expire makes a state or global key expire after ttl, or keeps it if ttl
+	// is zero. A silent global expiry runs no on_state_change. Nil in dry runs.
+	expire func(key string, global bool, ttl time.Duration, silent bool) error
+
+	// sleep waits for ctx.sleep; nil means time.Sleep
+	sleep func(thread *starlark.Thread, d time.Duration)
+
+	// watch calls fn for messages matching filter until stop is called; nil
+	// without a broker. await waits up to d for ctx.publish_and_wait's
+	// response; nil waits on a plain timer.
+	watch func(filter string, fn func(topic string, payload []byte)) (stop func())
+	await func(thread *starlark.Thread, d time.Duration, responses <-chan string) (string, bool)
+
+	// retry schedules a failed side effect again, calling gaveUp if no attempt
+	// succeeds; nil without a retry policy
+	retry func(runID, action string, attempt func() error, gaveUp func())
 }
 
 // NewContext creates a new automation context
-func NewContext(automationID string, mqttClient *mqtt.Client, stateStore *state.Store, logFunc func(string, string), allowedGlobalWrites []string, libraryManager *LibraryManager) *Context {
+func NewContext(automationID string, mqttClient Publisher, stateStore StateBackend, logFunc func(string, string, string), allowedGlobalWrites []string, libraryManager *LibraryManager) *Context {
 	return &Context{
 		automationID:        automationID,
 		mqttClient:          mqttClient,
@@ -34,42 +110,286 @@ func NewContext(automationID string, mqttClient *mqtt.Client, stateStore *state.
 	}
 }
 
-// ToStarlark converts the context to a Starlark struct
-func (c *Context) ToStarlark() *starlarkstruct.Struct {
+// ToStarlark converts the context to a Starlark struct for one handler run
+func (c *Context) ToStarlark(trigger Trigger) *starlarkstruct.Struct {
 	dict := starlark.StringDict{
-		"publish":      starlark.NewBuiltin("publish", c.publish),
-		"log":          starlark.NewBuiltin("log", c.log),
-		"json_encode":  starlark.NewBuiltin("json_encode", c.jsonEncode),
-		"json_decode":  starlark.NewBuiltin("json_decode", c.jsonDecode),
-		"get_state":    starlark.NewBuiltin("get_state", c.getState),
-		"set_state":    starlark.NewBuiltin("set_state", c.setState),
-		"clear_state":  starlark.NewBuiltin("clear_state", c.clearState),
-		"get_global":   starlark.NewBuiltin("get_global", c.getGlobal),
-		"set_global":   starlark.NewBuiltin("set_global", c.setGlobal),
-		"clear_global": starlark.NewBuiltin("clear_global", c.clearGlobal),
-		"now":          starlark.NewBuiltin("now", c.now),
+		"trigger":            trigger.toStarlark(),
+		"payload_json":       starlark.NewBuiltin("payload_json", trigger.payloadJSON),
+		"publish":            starlark.NewBuiltin("publish", c.publish),
+		"publish_and_wait":   starlark.NewBuiltin("publish_and_wait", c.publishAndWait),
+		"log":                starlark.NewBuiltin("log", c.log),
+		"json_encode":        starlark.NewBuiltin("json_encode", c.jsonEncode),
+		"json_decode":        starlark.NewBuiltin("json_decode", c.jsonDecode),
+		"json_raw":           starlark.NewBuiltin("json_raw", c.jsonRaw),
+		"re_match":           starlark.NewBuiltin("re_match", reMatch),
+		"re_find_all":        starlark.NewBuiltin("re_find_all", reFindAll),
+		"re_replace":         starlark.NewBuiltin("re_replace", reReplace),
+		"parse_number":       starlark.NewBuiltin("parse_number", parseNumberBuiltin),
+		"convert":            starlark.NewBuiltin("convert", convertBuiltin),
+		"get_state":          starlark.NewBuiltin("get_state", c.getState),
+		"set_state":          starlark.NewBuiltin("set_state", c.setState),
+		"clear_state":        starlark.NewBuiltin("clear_state", c.clearState),
+		"get_global":         starlark.NewBuiltin("get_global", c.getGlobal),
+		"set_global":         starlark.NewBuiltin("set_global", c.setGlobal),
+		"clear_global":       starlark.NewBuiltin("clear_global", c.clearGlobal),
+		"get_global_history": starlark.NewBuiltin("get_global_history", c.getGlobalHistory),
+		"now":                starlark.NewBuiltin("now", c.nowBuiltin),
+		"secret":             starlark.NewBuiltin("secret", c.secretBuiltin),
+		"sleep":              starlark.NewBuiltin("sleep", c.sleepBuiltin),
+		"expect":             starlark.NewBuiltin("expect", c.expectBuiltin(trigger)),
+		"is_warmup":          starlark.NewBuiltin("is_warmup", c.isWarmup),
+		"call":               starlark.NewBuiltin("call", c.callAutomation),
+		"attach":             starlark.NewBuiltin("attach", c.attach),
+		"notify":             starlark.NewBuiltin("notify", c.notifyBuiltin),
+		"last_error":         starlark.NewBuiltin("last_error", c.lastErrorBuiltin),
+		"set_timer":          starlark.NewBuiltin("set_timer", c.setTimerBuiltin),
+		"cancel_timer":       starlark.NewBuiltin("cancel_timer", c.cancelTimerBuiltin),
+		"throttle":           starlark.NewBuiltin("throttle", c.throttleBuiltin),
+		"debounce":           starlark.NewBuiltin("debounce", c.debounceBuiltin),
+		"subscribe":          starlark.NewBuiltin("subscribe", c.subscribeBuiltin),
+		"unsubscribe":        starlark.NewBuiltin("unsubscribe", c.unsubscribeBuiltin),
+		"override":           starlark.NewBuiltin("override", c.overrideBuiltin),
+		"cancel_override":    starlark.NewBuiltin("cancel_override", c.cancelOverrideBuiltin),
+		"profile":            starlark.NewBuiltin("profile", c.profileBuiltin),
+		"set_profile":        starlark.NewBuiltin("set_profile", c.setProfileBuiltin),
+		"http_get":           starlark.NewBuiltin("http_get", c.httpGet),
+		"http_post":          starlark.NewBuiltin("http_post", c.httpPost),
+		"http_request":       starlark.NewBuiltin("http_request", c.httpRequest),
 	}
 	
-	// Add library modules if available
+	// Add library modules if available; modules binding the context get this
+	// ctx, which is only built below
+	var self starlark.Value
 	if c.libraryManager != nil {
-		dict["lib"] = c.libraryManager.ToStarlarkStruct()
+		lib := c.libraryManager.ToStarlarkStruct(func() starlark.Value { return self })
+		if c.strict != nil {
+			dict["lib"] = c.strictLibrary(lib)
+		} else {
+			dict["lib"] = lib
+		}
 	}
-	
-	return starlarkstruct.FromStringDict(starlarkstruct.Default, dict)
+
+	dict["flags"] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"is_enabled": starlark.NewBuiltin("flags.is_enabled", c.flagEnabled),
+	})
+
+	// Add GPIO access if the host has it enabled
+	if c.gpio != nil {
+		dict["gpio"] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"write": starlark.NewBuiltin("gpio.write", c.gpioWrite),
+			"read":  starlark.NewBuiltin("gpio.read", c.gpioRead),
+		})
+	}
+
+	if c.files != nil {
+		dict["file"] = c.fileModule()
+	}
+
+	dict["job"] = c.jobModule()
+	dict["time"] = c.timeModule()
+	dict["presence"] = c.presenceModule()
+
+	ctx := starlarkstruct.FromStringDict(starlarkstruct.Default, dict)
+	self = ctx
+	return ctx
 }
 
 func (c *Context) publish(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	var topic, payload string
-	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "topic", &topic, "payload", &payload); err != nil {
+	var topic, sink, idempotencyKey string
+	var payloadVal starlark.Value
+	var retain bool
+	qos := mqtt.DefaultQoS
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "topic", &topic, "payload", &payloadVal, "sink?", &sink, "idempotency_key?", &idempotencyKey, "retain?", &retain, "qos?", &qos); err != nil {
 		return nil, err
 	}
+	if qos < 0 || qos > 2 {
+		return nil, fmt.Errorf("publish: qos must be 0, 1 or 2")
+	}
+	opts := mqtt.PublishOptions{QoS: byte(qos), Retain: retain}
 
-	if err := c.mqttClient.Publish(topic, []byte(payload)); err != nil {
+	// Payloads are sent byte-for-byte; bytes values allow binary passthrough
+	var payload string
+	switch v := payloadVal.(type) {
+	case starlark.String:
+		payload = string(v)
+	case starlark.Bytes:
+		payload = string(v)
+	default:
+		return nil, fmt.Errorf("publish: payload must be string or bytes, got %s", payloadVal.Type())
+	}
+	if sink == "mqtt" {
+		sink = ""
+	}
+	if c.denyPublish(sink, topic) {
+		target := topic
+		if sink != "" {
+			target = sink + ":" + topic
+		}
+		return failed(thread, fn, errCodePermissionDenied, target, permissionDenied(target, "publishes"))
+	}
+
+	// Route to an external connector instead of MQTT
+	if sink != "" && sink != "mqtt" {
+		target, ok := c.sinks[sink]
+		if !ok {
+			return nil, fmt.Errorf("publish: unknown sink %q", sink)
+		}
+		if retain || qos != mqtt.DefaultQoS {
+			return nil, fmt.Errorf("publish: retain and qos only apply to MQTT, not sink %q", sink)
+		}
+		cacheKey, _, ok := c.claimIdempotent(fn.Name(), idempotencyKey)
+		if !ok {
+			return starlark.True, nil
+		}
+		if err := target.Publish(topic, []byte(payload)); err != nil {
+			if c.retryLater(thread, "publish "+sink+":"+topic, cacheKey, func() error { return target.Publish(topic, []byte(payload)) }) {
+				c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: publish %s:%s: %s (retrying)", sink, topic, err))
+			} else {
+				c.releaseIdempotent(cacheKey)
+			}
+			return failed(thread, fn, errCodeUnavailable, sink+":"+topic, err)
+		}
+		c.audit.recordWrite(c.automationID, AuditPublish, sink+":"+topic, payload)
+		return starlark.True, nil
+	}
+
+	cacheKey, _, ok := c.claimIdempotent(fn.Name(), idempotencyKey)
+	if !ok {
+		return starlark.True, nil
+	}
+	if err := c.mqttClient.Publish(topic, []byte(payload), opts); err != nil {
+		if c.retryLater(thread, "publish "+topic, cacheKey, func() error { return c.mqttClient.Publish(topic, []byte(payload), opts) }) {
+			c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: publish %s: %s (retrying)", topic, err))
+		} else {
+			c.releaseIdempotent(cacheKey)
+		}
+		return failed(thread, fn, errCodeUnavailable, topic, err)
+	}
+	c.audit.recordWrite(c.automationID, AuditPublish, topic, payload)
+	if c.loops != nil {
+		c.loops.published(topic, c.automationID, loopDepth(thread))
+	}
+	return starlark.True, nil
+}
+
+// notifyBuiltin sends a notification through the engine's notification
+// channels. Delivery failures return False and are logged.
+func (c *Context) notifyBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var title, message, channel, idempotencyKey string
+	priority := notify.PriorityNormal
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "title", &title, "message", &message, "priority?", &priority, "channel?", &channel, "idempotency_key?", &idempotencyKey); err != nil {
+		return nil, err
+	}
+	if err := notify.ValidatePriority(priority); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	send := c.notify
+	if send == nil {
+		send = func(string, notify.Message) error { return notify.ErrNoChannels }
+	}
+	msg := notify.Message{Title: title, Body: message, Priority: priority, Source: c.automationID}
+	cacheKey, _, ok := c.claimIdempotent(fn.Name(), idempotencyKey)
+	if !ok {
+		return starlark.True, nil
+	}
+	if err := send(channel, msg); err != nil {
+		action := strings.TrimSpace("notify " + channel)
+		if !errors.Is(err, notify.ErrNoChannels) && c.retryLater(thread, action, cacheKey, func() error { return send(channel, msg) }) {
+			c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: notify: %s (retrying)", err))
+		} else {
+			c.releaseIdempotent(cacheKey)
+			c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: notify: %s", err))
+		}
+		if errors.Is(err, notify.ErrNoChannels) {
+			return failed(thread, fn, errCodeNotConfigured, channel, err)
+		}
+		return failed(thread, fn, errCodeUnavailable, channel, err)
+	}
+	return starlark.True, nil
+}
+
+// flagEnabled evaluates a feature flag. Rollout percentages are bucketed by
+// key, which defaults to the automation ID. Unknown flags are off.
+func (c *Context) flagEnabled(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	key := c.automationID
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "key?", &key); err != nil {
+		return nil, err
+	}
+
+	flag, err := c.stateStore.GetFlag(name)
+	if err != nil {
+		return nil, fmt.Errorf("flags.is_enabled: %w", err)
+	}
+	captureFrom(thread).flag(name, flag)
+	if flag == nil {
 		return starlark.False, nil
 	}
+	return starlark.Bool(flag.IsEnabled(key, c.now())), nil
+}
+
+// callAutomation runs another automation's handler and returns its result
+func (c *Context) callAutomation(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var id, service, payload, topic string
+	var serviceArgs starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "automation_id", &id, "service?", &service, "args?", &serviceArgs, "payload?", &payload, "topic?", &topic); err != nil {
+		return nil, err
+	}
+	if service != "" {
+		if payload != "" || topic != "" {
+			return nil, fmt.Errorf("call: payload and topic don't apply to service calls")
+		}
+		if c.callService == nil {
+			return nil, fmt.Errorf("call: not available")
+		}
+		result, err := c.callService(thread, c.automationID, id, service, starlarkToGo(serviceArgs))
+		if err != nil {
+			return nil, fmt.Errorf("call %s.%s: %w", id, service, err)
+		}
+		return goToStarlark(result), nil
+	}
+	if serviceArgs != starlark.None {
+		return nil, fmt.Errorf("call: args needs a service")
+	}
+	if c.call == nil {
+		return nil, fmt.Errorf("call: not available")
+	}
+
+	result, err := c.call(thread, c.automationID, id, topic, payload)
+	if err != nil {
+		return nil, fmt.Errorf("call %s: %w", id, err)
+	}
+	return goToStarlark(result), nil
+}
+
+func (c *Context) gpioWrite(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pin int
+	var value bool
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pin", &pin, "value", &value); err != nil {
+		return nil, err
+	}
+
+	if err := c.gpio.Write(pin, value); err != nil {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s", err))
+		return failed(thread, fn, errCodeUnavailable, strconv.Itoa(pin), err)
+	}
 	return starlark.True, nil
 }
 
+func (c *Context) gpioRead(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pin int
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pin", &pin); err != nil {
+		return nil, err
+	}
+
+	value, err := c.gpio.Read(pin)
+	if err != nil {
+		return starlark.None, nil
+	}
+	return starlark.Bool(value), nil
+}
+
 func (c *Context) log(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var message string
 	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "message", &message); err != nil {
@@ -77,23 +397,32 @@ func (c *Context) log(thread *starlark.Thread, fn *starlark.Builtin, args starla
 	}
 
 	if c.logFunc != nil {
-		c.logFunc(c.automationID, message)
+		c.logFunc(c.automationID, LogLevelInfo, redactSecrets(thread, message))
 	}
 	return starlark.None, nil
 }
 
 func (c *Context) jsonEncode(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var val starlark.Value
-	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "value", &val); err != nil {
+	precision := -1
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "value", &val, "precision?", &precision); err != nil {
 		return nil, err
 	}
 
-	goVal := starlarkToGo(val)
-	data, err := json.Marshal(goVal)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, val, precision); err != nil {
 		return nil, fmt.Errorf("json_encode: %w", err)
 	}
-	return starlark.String(data), nil
+	return starlark.String(buf.String()), nil
+}
+
+// jsonRaw wraps pre-formatted JSON (e.g. "21.50") so json_encode emits it unchanged
+func (c *Context) jsonRaw(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var text string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "text", &text); err != nil {
+		return nil, err
+	}
+	return parseRawJSON(text)
 }
 
 func (c *Context) jsonDecode(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -119,6 +448,7 @@ func (c *Context) getState(thread *starlark.Thread, fn *starlark.Builtin, args s
 	if err != nil {
 		return starlark.None, nil
 	}
+	captureFrom(thread).read(captureState, key, val)
 	if val == nil {
 		return starlark.None, nil
 	}
@@ -128,14 +458,22 @@ func (c *Context) getState(thread *starlark.Thread, fn *starlark.Builtin, args s
 func (c *Context) setState(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var key string
 	var val starlark.Value
-	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "value", &val); err != nil {
+	var ttlVal starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "value", &val, "ttl?", &ttlVal); err != nil {
+		return nil, err
+	}
+	ttl, err := ttlArg(fn, ttlVal)
+	if err != nil {
 		return nil, err
 	}
 
 	goVal := starlarkToGo(val)
 	if err := c.stateStore.SetState(c.automationID, key, goVal); err != nil {
-		return starlark.False, nil
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: %s", fn.Name(), key, err))
+		return failed(thread, fn, errCodeStorage, key, err)
 	}
+	c.setExpiry(fn, key, false, ttl, false)
+	captureFrom(thread).wrote(captureState, key)
 	return starlark.True, nil
 }
 
@@ -146,13 +484,31 @@ func (c *Context) clearState(thread *starlark.Thread, fn *starlark.Builtin, args
 	}
 
 	if err := c.stateStore.ClearState(c.automationID, key); err != nil {
-		return starlark.False, nil
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: %s", fn.Name(), key, err))
+		return failed(thread, fn, errCodeStorage, key, err)
 	}
+	c.setExpiry(fn, key, false, 0, false)
+	captureFrom(thread).wrote(captureState, key)
 	return starlark.True, nil
 }
 
-func (c *Context) now(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	return starlark.Float(float64(time.Now().Unix())), nil
+func (c *Context) nowBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return starlark.Float(float64(c.now().Unix())), nil
+}
+
+// now returns the current time, pinned to the trigger time in dry runs
+func (c *Context) now() time.Time {
+	if c.clock != nil {
+		return c.clock()
+	}
+	return time.Now()
+}
+
+func (c *Context) isWarmup(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if c.isWarmingUp == nil {
+		return starlark.False, nil
+	}
+	return starlark.Bool(c.isWarmingUp()), nil
 }
 
 func (c *Context) getGlobal(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
@@ -161,10 +517,16 @@ func (c *Context) getGlobal(thread *starlark.Thread, fn *starlark.Builtin, args
 		return nil, err
 	}
 
+	if c.denyRead(key) {
+		return starlark.None, nil
+	}
+	c.audit.record(c.automationID, AuditGlobalRead, key)
+
 	val, err := c.stateStore.GetGlobalState(key)
 	if err != nil {
 		return starlark.None, nil
 	}
+	captureFrom(thread).read(captureGlobal, key, val)
 	if val == nil {
 		return starlark.None, nil
 	}
@@ -174,20 +536,33 @@ func (c *Context) getGlobal(thread *starlark.Thread, fn *starlark.Builtin, args
 func (c *Context) setGlobal(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var key string
 	var val starlark.Value
-	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "value", &val); err != nil {
+	var ttlVal starlark.Value = starlark.None
+	notifyExpiry := true
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "value", &val, "ttl?", &ttlVal, "notify_expiry?", &notifyExpiry); err != nil {
+		return nil, err
+	}
+	ttl, err := ttlArg(fn, ttlVal)
+	if err != nil {
 		return nil, err
 	}
 
 	// Check if this automation is allowed to write to this key
 	if !c.canWriteGlobalKey(key) {
-		c.logFunc(c.automationID, fmt.Sprintf("ERROR: Attempted to write to global key '%s' without permission. Add to global_state_writes in config.", key))
-		return starlark.False, nil
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: Attempted to write to global key '%s' without permission. Add to global_state_writes in config.", key))
+		c.audit.record(c.automationID, AuditGlobalDenied, key)
+		return failed(thread, fn, errCodePermissionDenied, key, permissionDenied(key, "global_state_writes"))
 	}
 
-	goVal := starlarkToGo(val)
-	if err := c.stateStore.SetGlobalState(key, goVal); err != nil {
-		return starlark.False, nil
+	if err := c.storeGlobal(thread, key, starlarkToGo(val), false); err != nil {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: %s", fn.Name(), key, err))
+		return failed(thread, fn, errCodeStorage, key, err)
+	}
+	// The write itself cancelled any earlier expiry
+	if ttl > 0 {
+		c.setExpiry(fn, key, true, ttl, !notifyExpiry)
 	}
+	captureFrom(thread).wrote(captureGlobal, key)
+	c.audit.recordWrite(c.automationID, AuditGlobalWrite, key, val.String())
 	return starlark.True, nil
 }
 
@@ -199,16 +574,79 @@ func (c *Context) clearGlobal(thread *starlark.Thread, fn *starlark.Builtin, arg
 
 	// Check if this automation is allowed to write to this key
 	if !c.canWriteGlobalKey(key) {
-		c.logFunc(c.automationID, fmt.Sprintf("ERROR: Attempted to clear global key '%s' without permission. Add to global_state_writes in config.", key))
-		return starlark.False, nil
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: Attempted to clear global key '%s' without permission. Add to global_state_writes in config.", key))
+		c.audit.record(c.automationID, AuditGlobalDenied, key)
+		return failed(thread, fn, errCodePermissionDenied, key, permissionDenied(key, "global_state_writes"))
 	}
 
-	if err := c.stateStore.ClearGlobalState(key); err != nil {
-		return starlark.False, nil
+	if err := c.storeGlobal(thread, key, nil, true); err != nil {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: %s", fn.Name(), key, err))
+		return failed(thread, fn, errCodeStorage, key, err)
 	}
+	captureFrom(thread).wrote(captureGlobal, key)
+	c.audit.recordWrite(c.automationID, AuditGlobalWrite, key, "<cleared>")
 	return starlark.True, nil
 }
 
+// setExpiry applies the TTL of a write that already succeeded; any state
+// write without one, including a clear, cancels a pending expiry (global
+// writes cancel theirs in the runner). Failing to persist the expiry is only
+// logged: the key still expires unless the engine restarts first.
+func (c *Context) setExpiry(fn *starlark.Builtin, key string, global bool, ttl time.Duration, silent bool) {
+	if c.expire == nil {
+		return
+	}
+	if err := c.expire(key, global, ttl, silent); err != nil {
+		c.logFunc(c.automationID, LogLevelWarning, fmt.Sprintf("WARNING: %s %s: expiry not saved, it won't survive a restart: %s", fn.Name(), key, err))
+	}
+}
+
+// storeGlobal sets or clears a global key through the runner, or straight in
+// the context's store in dry runs
+func (c *Context) storeGlobal(thread *starlark.Thread, key string, value any, clear bool) error {
+	if c.writeGlobal != nil {
+		return c.writeGlobal(thread, key, value, clear)
+	}
+	_, err := storeGlobal(c.stateStore, key, value, clear, c.now())
+	return err
+}
+
+// getGlobalHistory returns the latest writes of a global key, newest first, as
+// structs with value, time (Unix seconds) and cleared
+func (c *Context) getGlobalHistory(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	limit := 10
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "limit?", &limit); err != nil {
+		return nil, err
+	}
+	if limit < 1 || limit > state.MaxHistory {
+		return nil, fmt.Errorf("%s: limit must be between 1 and %d", fn.Name(), state.MaxHistory)
+	}
+
+	if c.denyRead(key) {
+		return starlark.NewList(nil), nil
+	}
+	c.audit.record(c.automationID, AuditGlobalRead, key)
+
+	entries, err := c.stateStore.GetGlobalHistory(key, limit)
+	if err != nil {
+		return starlark.NewList(nil), nil
+	}
+	list := make([]starlark.Value, 0, len(entries))
+	for _, entry := range entries {
+		value := starlark.Value(starlark.None)
+		if entry.Value != nil {
+			value = goToStarlark(entry.Value)
+		}
+		list = append(list, starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"value":   value,
+			"time":    starlark.Float(float64(entry.Time.UnixMilli()) / 1000),
+			"cleared": starlark.Bool(entry.Cleared),
+		}))
+	}
+	return starlark.NewList(list), nil
+}
+
 // canWriteGlobalKey checks if the automation is allowed to write to a global state key
 func (c *Context) canWriteGlobalKey(key string) bool {
 	for _, pattern := range c.allowedGlobalWrites {
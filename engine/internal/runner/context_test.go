@@ -363,3 +363,25 @@ func TestRoundTrip_StarlarkGoStarlark(t *testing.T) {
 		}
 	}
 }
+
+func TestNotify_WithoutChannelsReturnsFalse(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "alerts", `
+def on_schedule(ctx):
+    return ctx.notify("Door", "Front door open", priority = "high")
+
+config = {"name": "Alerts"}
+`)
+
+	record, err := r.RunManual("alerts", ManualTrigger{})
+	if err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	if record.Result != false {
+		t.Errorf("ctx.notify without channels returned %v, want False", record.Result)
+	}
+	logs := r.GetLogs()
+	if len(logs) != 1 || logs[0].Message != "ERROR: notify: no notification channels configured" {
+		t.Errorf("logs = %+v", logs)
+	}
+}
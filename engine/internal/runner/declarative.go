@@ -0,0 +1,266 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DeclarativeExtension marks YAML-defined automations (trigger/condition/action)
+const DeclarativeExtension = ".auto.yaml"
+
+// declarativeAutomation is the on-disk YAML format for simple automations
+type declarativeAutomation struct {
+	Name        string           `yaml:"name"`
+	Description string           `yaml:"description"`
+	Enabled     *bool            `yaml:"enabled"`
+	Priority    string           `yaml:"priority"`
+	Blueprint   string           `yaml:"blueprint"`
+	Trigger     []map[string]any `yaml:"trigger"`
+	Condition   []map[string]any `yaml:"condition"`
+	Action      []map[string]any `yaml:"action"`
+}
+
+// IsDeclarativeFile reports whether a path is a YAML-defined automation
+func IsDeclarativeFile(path string) bool {
+	return strings.HasSuffix(path, DeclarativeExtension)
+}
+
+// CompileDeclarative turns a YAML automation into equivalent Starlark source,
+// so it loads through the same path (and into the same Automation
+// representation) as hand-written automations.
+func CompileDeclarative(data []byte) (string, error) {
+	var def declarativeAutomation
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return "", fmt.Errorf("invalid YAML: %w", err)
+	}
+	if def.Blueprint != "" {
+		return "", fmt.Errorf("blueprint %s can only be instantiated from the automations directory", def.Blueprint)
+	}
+	if len(def.Trigger) == 0 {
+		return "", fmt.Errorf("at least one trigger is required")
+	}
+	if len(def.Action) == 0 {
+		return "", fmt.Errorf("at least one action is required")
+	}
+
+	var subscribe []any
+	schedule := ""
+	for i, trigger := range def.Trigger {
+		switch {
+		case trigger["mqtt"] != nil:
+			if trigger["on_change_only"] == true || trigger["change_field"] != nil {
+				entry := map[string]any{"topic": fmt.Sprint(trigger["mqtt"]), "on_change_only": true}
+				if trigger["change_field"] != nil {
+					entry["change_field"] = fmt.Sprint(trigger["change_field"])
+				}
+				subscribe = append(subscribe, entry)
+			} else {
+				subscribe = append(subscribe, fmt.Sprint(trigger["mqtt"]))
+			}
+		case trigger["schedule"] != nil:
+			if schedule != "" {
+				return "", fmt.Errorf("trigger %d: only one schedule trigger is supported", i+1)
+			}
+			schedule = fmt.Sprint(trigger["schedule"])
+		default:
+			return "", fmt.Errorf("trigger %d: expected 'mqtt' or 'schedule'", i+1)
+		}
+	}
+
+	var conditions []string
+	reads := map[string]bool{}
+	for i, cond := range def.Condition {
+		expr, err := compileCondition(cond)
+		if err != nil {
+			return "", fmt.Errorf("condition %d: %w", i+1, err)
+		}
+		conditions = append(conditions, expr)
+		if cond["global"] != nil {
+			reads[fmt.Sprint(cond["global"])] = true
+		}
+	}
+
+	var actions []string
+	writes := map[string]bool{}
+	publishes := map[string]bool{}
+	for i, action := range def.Action {
+		stmt, key, err := compileAction(action)
+		if err != nil {
+			return "", fmt.Errorf("action %d: %w", i+1, err)
+		}
+		actions = append(actions, stmt)
+		if key != "" {
+			writes[key] = true
+		}
+		if spec, ok := action["publish"].(map[string]any); ok {
+			publishes[fmt.Sprint(spec["topic"])] = true
+		}
+	}
+
+	config := map[string]any{
+		"name":        def.Name,
+		"description": def.Description,
+		"enabled":     def.Enabled == nil || *def.Enabled,
+	}
+	if len(subscribe) > 0 {
+		config["subscribe"] = subscribe
+	}
+	if schedule != "" {
+		config["schedule"] = schedule
+	}
+	if def.Priority != "" {
+		config["priority"] = def.Priority
+	}
+	// Declared access is known exactly, so the automation also runs in strict mode
+	for name, set := range map[string]map[string]bool{
+		"global_state_writes": writes,
+		"global_state_reads":  reads,
+		"publishes":           publishes,
+	} {
+		if len(set) > 0 {
+			config[name] = sortedKeys(set)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated from a declarative automation\n\n")
+	b.WriteString(declarativeHelpers)
+	b.WriteString("def _conditions(data, ctx):\n")
+	for _, expr := range conditions {
+		fmt.Fprintf(&b, "    if not (%s):\n        return False\n", expr)
+	}
+	b.WriteString("    return True\n\n")
+	b.WriteString("def _actions(ctx):\n")
+	for _, stmt := range actions {
+		fmt.Fprintf(&b, "    %s\n", stmt)
+	}
+	b.WriteString("\n")
+	if len(subscribe) > 0 {
+		b.WriteString("def on_message(topic, payload, ctx):\n")
+		b.WriteString("    if _conditions(_decode(payload, ctx), ctx):\n        _actions(ctx)\n\n")
+	}
+	if schedule != "" {
+		b.WriteString("def on_schedule(ctx):\n")
+		b.WriteString("    if _conditions(None, ctx):\n        _actions(ctx)\n\n")
+	}
+	fmt.Fprintf(&b, "config = %s\n", literal(config))
+	return b.String(), nil
+}
+
+const declarativeHelpers = `def _decode(payload, ctx):
+    if payload.startswith("{") or payload.startswith("["):
+        return ctx.json_decode(payload)
+    return payload
+
+def _get(data, path):
+    for part in path.split("."):
+        if type(data) != "dict" or part not in data:
+            return None
+        data = data[part]
+    return data
+
+def _number(v):
+    return type(v) == "int" or type(v) == "float"
+
+`
+
+// compileCondition returns a Starlark boolean expression for a condition.
+// The subject is one of field (JSON payload path), payload (raw payload),
+// global or state; the operator one of equals, not_equals, above, below.
+func compileCondition(cond map[string]any) (string, error) {
+	var subject string
+	switch {
+	case cond["field"] != nil:
+		subject = fmt.Sprintf("_get(data, %s)", literal(fmt.Sprint(cond["field"])))
+	case cond["payload"] != nil:
+		subject = "data"
+	case cond["global"] != nil:
+		subject = fmt.Sprintf("ctx.get_global(%s)", literal(fmt.Sprint(cond["global"])))
+	case cond["state"] != nil:
+		subject = fmt.Sprintf("ctx.get_state(%s)", literal(fmt.Sprint(cond["state"])))
+	default:
+		return "", fmt.Errorf("expected 'field', 'payload', 'global' or 'state'")
+	}
+
+	switch {
+	case hasKey(cond, "equals"):
+		return fmt.Sprintf("%s == %s", subject, literal(cond["equals"])), nil
+	case hasKey(cond, "not_equals"):
+		return fmt.Sprintf("%s != %s", subject, literal(cond["not_equals"])), nil
+	case hasKey(cond, "above"):
+		return fmt.Sprintf("_number(%s) and %s > %s", subject, subject, literal(cond["above"])), nil
+	case hasKey(cond, "below"):
+		return fmt.Sprintf("_number(%s) and %s < %s", subject, subject, literal(cond["below"])), nil
+	}
+	return "", fmt.Errorf("expected 'equals', 'not_equals', 'above' or 'below'")
+}
+
+// sortedKeys returns the keys of set in order, as config list items
+func sortedKeys(set map[string]bool) []any {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]any, len(keys))
+	for i, key := range keys {
+		result[i] = key
+	}
+	return result
+}
+
+// compileAction returns a Starlark statement for an action and, for
+// set_global/clear_global, the key that must be declared writable.
+func compileAction(action map[string]any) (string, string, error) {
+	switch {
+	case action["publish"] != nil:
+		spec, ok := action["publish"].(map[string]any)
+		if !ok || spec["topic"] == nil {
+			return "", "", fmt.Errorf("publish requires a topic")
+		}
+		payload := literal(fmt.Sprint(spec["payload"]))
+		switch spec["payload"].(type) {
+		case nil:
+			payload = `""`
+		case map[string]any, []any:
+			payload = fmt.Sprintf("ctx.json_encode(%s)", literal(spec["payload"]))
+		}
+		return fmt.Sprintf("ctx.publish(%s, %s)", literal(fmt.Sprint(spec["topic"])), payload), "", nil
+
+	case action["set_global"] != nil:
+		spec, ok := action["set_global"].(map[string]any)
+		if !ok || spec["key"] == nil {
+			return "", "", fmt.Errorf("set_global requires a key")
+		}
+		key := fmt.Sprint(spec["key"])
+		return fmt.Sprintf("ctx.set_global(%s, %s)", literal(key), literal(spec["value"])), key, nil
+
+	case action["clear_global"] != nil:
+		key := fmt.Sprint(action["clear_global"])
+		return fmt.Sprintf("ctx.clear_global(%s)", literal(key)), key, nil
+
+	case action["set_state"] != nil:
+		spec, ok := action["set_state"].(map[string]any)
+		if !ok || spec["key"] == nil {
+			return "", "", fmt.Errorf("set_state requires a key")
+		}
+		return fmt.Sprintf("ctx.set_state(%s, %s)", literal(fmt.Sprint(spec["key"])), literal(spec["value"])), "", nil
+
+	case action["log"] != nil:
+		return fmt.Sprintf("ctx.log(%s)", literal(fmt.Sprint(action["log"]))), "", nil
+	}
+	return "", "", fmt.Errorf("expected 'publish', 'set_global', 'clear_global', 'set_state' or 'log'")
+}
+
+// literal renders a Go value as a Starlark literal
+func literal(v any) string {
+	return goToStarlark(v).String()
+}
+
+func hasKey(m map[string]any, key string) bool {
+	_, ok := m[key]
+	return ok
+}
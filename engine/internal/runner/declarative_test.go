@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+const hallwayYAML = `
+name: Hallway Light
+description: Turn on hallway light on motion when someone is home
+trigger:
+  - mqtt: zigbee2mqtt/hallway_motion
+condition:
+  - field: occupancy
+    equals: true
+  - field: illuminance
+    below: 50
+action:
+  - publish:
+      topic: zigbee2mqtt/hallway_light/set
+      payload: {state: "ON"}
+  - set_global:
+      key: presence.hallway.last_motion
+      value: 1
+`
+
+// fakeDeclarativeCtx records publishes and global writes from generated code
+func fakeDeclarativeCtx(published *[]string, globals map[string]starlark.Value) *starlarkstruct.Struct {
+	real := &Context{}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"json_decode": starlark.NewBuiltin("json_decode", real.jsonDecode),
+		"json_encode": starlark.NewBuiltin("json_encode", real.jsonEncode),
+		"publish": starlark.NewBuiltin("publish", func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+			*published = append(*published, string(args[0].(starlark.String))+" "+string(args[1].(starlark.String)))
+			return starlark.True, nil
+		}),
+		"set_global": starlark.NewBuiltin("set_global", func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+			globals[string(args[0].(starlark.String))] = args[1]
+			return starlark.True, nil
+		}),
+	})
+}
+
+func TestCompileDeclarative_RunsActionsWhenConditionsMatch(t *testing.T) {
+	source, err := CompileDeclarative([]byte(hallwayYAML))
+	if err != nil {
+		t.Fatalf("CompileDeclarative failed: %v", err)
+	}
+
+	thread := &starlark.Thread{Name: "test"}
+	globals, err := starlark.ExecFile(thread, "hallway.star", source, nil)
+	if err != nil {
+		t.Fatalf("generated code failed to execute: %v\n%s", err, source)
+	}
+
+	config, err := extractConfig(globals["config"])
+	if err != nil {
+		t.Fatalf("extractConfig failed: %v", err)
+	}
+	if config.Name != "Hallway Light" || len(config.Subscribe) != 1 {
+		t.Errorf("unexpected config: %+v", config)
+	}
+	if len(config.GlobalStateWrites) != 1 || config.GlobalStateWrites[0] != "presence.hallway.last_motion" {
+		t.Errorf("GlobalStateWrites = %v, want derived from set_global", config.GlobalStateWrites)
+	}
+	if len(config.Publishes) != 1 || config.Publishes[0] != "zigbee2mqtt/hallway_light/set" {
+		t.Errorf("Publishes = %v, want derived from publish", config.Publishes)
+	}
+
+	var published []string
+	written := map[string]starlark.Value{}
+	ctx := fakeDeclarativeCtx(&published, written)
+	onMessage := globals["on_message"].(starlark.Callable)
+
+	// Bright hallway: condition fails
+	starlark.Call(thread, onMessage, starlark.Tuple{starlark.String("t"), starlark.String(`{"occupancy": true, "illuminance": 200}`), ctx}, nil)
+	if len(published) != 0 {
+		t.Errorf("expected no publish when condition fails, got %v", published)
+	}
+
+	_, err = starlark.Call(thread, onMessage, starlark.Tuple{starlark.String("t"), starlark.String(`{"occupancy": true, "illuminance": 10}`), ctx}, nil)
+	if err != nil {
+		t.Fatalf("on_message failed: %v", err)
+	}
+	if len(published) != 1 || published[0] != `zigbee2mqtt/hallway_light/set {"state":"ON"}` {
+		t.Errorf("published = %v", published)
+	}
+	if written["presence.hallway.last_motion"] == nil {
+		t.Error("expected set_global action to run")
+	}
+}
+
+func TestCompileDeclarative_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"No trigger", "name: x\naction:\n  - log: hi\n", "trigger"},
+		{"No action", "name: x\ntrigger:\n  - mqtt: a/b\n", "action"},
+		{"Unknown trigger", "trigger:\n  - webhook: x\naction:\n  - log: hi\n", "trigger 1"},
+		{"Unknown condition operator", "trigger:\n  - mqtt: a\ncondition:\n  - field: x\n    matches: y\naction:\n  - log: hi\n", "condition 1"},
+		{"Unknown action", "trigger:\n  - mqtt: a\naction:\n  - shout: hi\n", "action 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileDeclarative([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CompileDeclarative error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCode_Declarative(t *testing.T) {
+	result := ValidateCode(hallwayYAML, "declarative")
+	if !result.Valid {
+		t.Errorf("expected valid declarative automation, got errors: %v", result.Errors)
+	}
+}
+
+func TestCompileDeclarative_OnChangeOnly(t *testing.T) {
+	source, err := CompileDeclarative([]byte(`
+name: Thermostat
+trigger:
+  - mqtt: zigbee2mqtt/thermostat
+    change_field: temperature
+action:
+  - log: changed
+`))
+	if err != nil {
+		t.Fatalf("CompileDeclarative failed: %v", err)
+	}
+
+	globals, err := starlark.ExecFile(&starlark.Thread{Name: "test"}, "thermostat.star", source, nil)
+	if err != nil {
+		t.Fatalf("generated code failed to execute: %v\n%s", err, source)
+	}
+	config, err := extractConfig(globals["config"])
+	if err != nil {
+		t.Fatalf("extractConfig failed: %v", err)
+	}
+	if field, ok := config.OnChangeOnly["zigbee2mqtt/thermostat"]; !ok || field != "temperature" {
+		t.Errorf("OnChangeOnly = %v, want temperature filter", config.OnChangeOnly)
+	}
+}
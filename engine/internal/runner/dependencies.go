@@ -0,0 +1,176 @@
+package runner
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// missingDependencyError refuses an automation whose config.requires names
+// automations that aren't loaded. It is kept as a load error and retried
+// whenever one of them loads.
+type missingDependencyError struct {
+	ids []string
+}
+
+func (e *missingDependencyError) Error() string {
+	return "required automations not loaded: " + strings.Join(e.ids, ", ")
+}
+
+// checkRequires checks that the automations id requires are loaded and don't
+// require id in turn
+func (r *Runner) checkRequires(id string, requires []string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var missing []string
+	for _, dep := range requires {
+		if dep == id {
+			return fmt.Errorf("requires itself")
+		}
+		if _, ok := r.automations[dep]; !ok {
+			missing = append(missing, dep)
+			continue
+		}
+		if path := r.requirePath(dep, id, nil); path != nil {
+			return fmt.Errorf("dependency cycle: %s -> %s", id, strings.Join(path, " -> "))
+		}
+	}
+	if len(missing) > 0 {
+		return &missingDependencyError{ids: missing}
+	}
+	return nil
+}
+
+// requirePath returns the chain of loaded automations from through which
+// from requires target, ending in target, or nil. Callers hold r.mu.
+func (r *Runner) requirePath(from, target string, seen map[string]bool) []string {
+	if from == target {
+		return []string{target}
+	}
+	a, ok := r.automations[from]
+	if !ok || seen[from] {
+		return nil
+	}
+	if seen == nil {
+		seen = make(map[string]bool)
+	}
+	seen[from] = true
+	for _, dep := range a.Config.Requires {
+		if path := r.requirePath(dep, target, seen); path != nil {
+			return append([]string{from}, path...)
+		}
+	}
+	return nil
+}
+
+// reloadDependents reloads the automations requiring id after it loaded,
+// changed or went away, including ones waiting for it to load
+func (r *Runner) reloadDependents(id string) {
+	files := make(map[string]string)
+	r.mu.RLock()
+	for _, a := range r.automations {
+		if slices.Contains(a.Config.Requires, id) {
+			files[a.ID] = a.FilePath
+		}
+	}
+	r.mu.RUnlock()
+	for _, loadErr := range r.GetLoadErrors() {
+		if slices.Contains(loadErr.Waiting, id) {
+			files[loadErr.AutomationID] = loadErr.File
+		}
+	}
+
+	ids := make([]string, 0, len(files))
+	for dependent := range files {
+		ids = append(ids, dependent)
+	}
+	sort.Strings(ids)
+	for _, dependent := range ids {
+		slog.Info("Reloading dependent automation", "id", dependent, "requires", id)
+		r.LoadAutomation(files[dependent])
+	}
+}
+
+// LoadAutomations loads files in dependency order, each after the ones its
+// config.requires names, so none is refused for a dependency that is about
+// to load. Automations that require each other in a cycle are refused with
+// an error naming the cycle. Each file runs once to read its config before
+// it is loaded. It returns the load errors by file.
+func (r *Runner) LoadAutomations(files []string) map[string]error {
+	ids := make([]string, 0, len(files))
+	fileOf := make(map[string]string, len(files))
+	requires := make(map[string][]string)
+	for _, file := range files {
+		id := AutomationID(r.automationsDir, file)
+		ids = append(ids, id)
+		fileOf[id] = file
+		// A file that fails here fails again, with the same error, on load
+		if f, err := r.readAutomation(id, file); err == nil && f.config.Enabled {
+			requires[id] = f.config.Requires
+		}
+	}
+
+	errs := make(map[string]error)
+	order, cycles := requiresOrder(ids, requires)
+	for id, cycle := range cycles {
+		err := fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		r.loadErrors.set(id, fileOf[id], err, false)
+		errs[fileOf[id]] = err
+	}
+	for _, id := range order {
+		if err := r.LoadAutomation(fileOf[id]); err != nil {
+			errs[fileOf[id]] = err
+		}
+	}
+	return errs
+}
+
+// requiresOrder sorts ids so that each comes after the ones it requires,
+// keeping their order otherwise. Requirements outside ids are left to
+// checkRequires. IDs in a cycle are left out and returned with the cycle,
+// which starts and ends with the ID itself.
+func requiresOrder(ids []string, requires map[string][]string) (order []string, cycles map[string][]string) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	known := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		known[id] = true
+	}
+	marks := make(map[string]int, len(ids))
+	cycles = make(map[string][]string)
+	var stack []string
+	var visit func(id string)
+	visit = func(id string) {
+		switch marks[id] {
+		case visited:
+			return
+		case visiting:
+			cycle := stack[slices.Index(stack, id):]
+			for i, member := range cycle {
+				path := append(slices.Clone(cycle[i:]), cycle[:i]...)
+				cycles[member] = append(path, member)
+			}
+			return
+		}
+		marks[id] = visiting
+		stack = append(stack, id)
+		for _, dep := range requires[id] {
+			if known[dep] {
+				visit(dep)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		marks[id] = visited
+		if _, ok := cycles[id]; !ok {
+			order = append(order, id)
+		}
+	}
+	for _, id := range ids {
+		visit(id)
+	}
+	return order, cycles
+}
@@ -0,0 +1,189 @@
+package runner
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func dependencyTestAutomation(name string, requires ...string) string {
+	config := `config = {"name": "` + name + `", "schedule": "0 7 * * *"`
+	if len(requires) > 0 {
+		config += `, "requires": ["` + strings.Join(requires, `", "`) + `"]`
+	}
+	return config + "}\ndef on_schedule(ctx):\n    pass\n"
+}
+
+func TestRequires_LoadsInDependencyOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeBlueprintFiles(t, dir, map[string]string{
+		"presence_tracker.star": dependencyTestAutomation("Presence"),
+		"lights.star":           dependencyTestAutomation("Lights", "presence_tracker"),
+		"alarm.star":            dependencyTestAutomation("Alarm", "lights", "presence_tracker"),
+	})
+	r := New(nil, nil)
+	r.SetAutomationsDir(dir)
+	path := func(id string) string { return filepath.Join(dir, id+".star") }
+
+	// Directory order loads dependents first; they wait for their dependencies
+	for _, id := range []string{"alarm", "lights"} {
+		if err := r.LoadAutomation(path(id)); err == nil || !strings.Contains(err.Error(), "required automations not loaded") {
+			t.Fatalf("load %s: %v", id, err)
+		}
+	}
+	errs := r.GetLoadErrors()
+	if len(errs) != 2 || !slices.Equal(errs[0].Waiting, []string{"lights", "presence_tracker"}) || !slices.Equal(errs[1].Waiting, []string{"presence_tracker"}) {
+		t.Fatalf("load errors = %+v", errs)
+	}
+
+	if err := r.LoadAutomation(path("presence_tracker")); err != nil {
+		t.Fatal(err)
+	}
+	if errs := r.GetLoadErrors(); len(errs) != 0 {
+		t.Fatalf("load errors = %+v", errs)
+	}
+	lights, _ := r.lookup("lights")
+	alarm, _ := r.lookup("alarm")
+	if lights == nil || alarm == nil {
+		t.Fatal("dependents not loaded")
+	}
+
+	// A changed dependency reloads its dependents
+	if err := r.LoadAutomation(path("presence_tracker")); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, _ := r.lookup("lights"); reloaded == lights {
+		t.Error("lights not reloaded")
+	}
+	if reloaded, _ := r.lookup("alarm"); reloaded == alarm {
+		t.Error("alarm not reloaded")
+	}
+
+	// A removed dependency takes its dependents down until it is back
+	r.UnloadAutomation("presence_tracker")
+	if ids := automationIDs(r); len(ids) != 0 {
+		t.Errorf("loaded = %v, want none", ids)
+	}
+	if errs := r.GetLoadErrors(); len(errs) != 2 || errs[0].Previous || errs[1].AutomationID != "lights" {
+		t.Errorf("load errors = %+v", errs)
+	}
+	if err := r.LoadAutomation(path("presence_tracker")); err != nil {
+		t.Fatal(err)
+	}
+	if ids := automationIDs(r); !slices.Equal(ids, []string{"alarm", "lights", "presence_tracker"}) {
+		t.Errorf("loaded = %v", ids)
+	}
+}
+
+func TestRequires_Cycles(t *testing.T) {
+	dir := t.TempDir()
+	writeBlueprintFiles(t, dir, map[string]string{
+		"presence_tracker.star": dependencyTestAutomation("Presence"),
+		"lights.star":           dependencyTestAutomation("Lights", "presence_tracker"),
+		"loop.star":             dependencyTestAutomation("Loop", "loop"),
+	})
+	r := New(nil, nil)
+	r.SetAutomationsDir(dir)
+	for _, id := range []string{"presence_tracker", "lights"} {
+		if err := r.LoadAutomation(filepath.Join(dir, id+".star")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := r.LoadAutomation(filepath.Join(dir, "loop.star")); err == nil || err.Error() != "requires itself" {
+		t.Errorf("self requirement: %v", err)
+	}
+
+	writeBlueprintFiles(t, dir, map[string]string{"presence_tracker.star": dependencyTestAutomation("Presence", "lights")})
+	err := r.LoadAutomation(filepath.Join(dir, "presence_tracker.star"))
+	if err == nil || err.Error() != "dependency cycle: presence_tracker -> lights -> presence_tracker" {
+		t.Errorf("cycle: %v", err)
+	}
+	if ids := automationIDs(r); !slices.Equal(ids, []string{"lights", "presence_tracker"}) {
+		t.Errorf("loaded = %v, want the previous versions kept", ids)
+	}
+}
+
+func automationIDs(r *Runner) []string {
+	var ids []string
+	for _, a := range r.ListAutomations() {
+		ids = append(ids, a.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestRequiresOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		ids        []string
+		requires   map[string][]string
+		wantOrder  []string
+		wantCycles map[string]string
+	}{
+		{"independent", []string{"b", "a"}, nil, []string{"b", "a"}, nil},
+		{"dependencies first", []string{"alarm", "lights", "presence"},
+			map[string][]string{"alarm": {"lights", "presence"}, "lights": {"presence"}},
+			[]string{"presence", "lights", "alarm"}, nil},
+		{"unknown dependency", []string{"lights"}, map[string][]string{"lights": {"missing"}}, []string{"lights"}, nil},
+		{"cycle", []string{"a", "b", "c", "d"},
+			map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}, "d": {"a"}},
+			[]string{"d"}, map[string]string{"a": "a b c a", "b": "b c a b", "c": "c a b c"}},
+		{"requires itself", []string{"a", "b"}, map[string][]string{"a": {"a"}}, []string{"b"}, map[string]string{"a": "a a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, cycles := requiresOrder(tt.ids, tt.requires)
+			if !slices.Equal(order, tt.wantOrder) {
+				t.Errorf("order = %v, want %v", order, tt.wantOrder)
+			}
+			got := make(map[string]string)
+			for id, cycle := range cycles {
+				got[id] = strings.Join(cycle, " ")
+			}
+			if len(got) != len(tt.wantCycles) {
+				t.Errorf("cycles = %v, want %v", got, tt.wantCycles)
+			}
+			for id, want := range tt.wantCycles {
+				if got[id] != want {
+					t.Errorf("cycle of %s = %q, want %q", id, got[id], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadAutomations(t *testing.T) {
+	dir := t.TempDir()
+	writeBlueprintFiles(t, dir, map[string]string{
+		"alarm.star":            dependencyTestAutomation("Alarm", "lights", "presence_tracker"),
+		"lights.star":           dependencyTestAutomation("Lights", "presence_tracker"),
+		"presence_tracker.star": dependencyTestAutomation("Presence"),
+		"ping.star":             dependencyTestAutomation("Ping", "pong"),
+		"pong.star":             dependencyTestAutomation("Pong", "ping"),
+	})
+	r := New(nil, nil)
+	r.SetAutomationsDir(dir)
+	var files []string
+	for _, id := range []string{"alarm", "lights", "ping", "pong", "presence_tracker"} {
+		files = append(files, filepath.Join(dir, id+".star"))
+	}
+
+	errs := r.LoadAutomations(files)
+	if len(errs) != 2 {
+		t.Fatalf("errors = %v, want the ping/pong cycle only", errs)
+	}
+	if err := errs[files[2]]; err == nil || err.Error() != "dependency cycle: ping -> pong -> ping" {
+		t.Errorf("ping: %v", err)
+	}
+	for _, id := range []string{"alarm", "lights", "presence_tracker"} {
+		if a, _ := r.lookup(id); a == nil {
+			t.Errorf("%s not loaded", id)
+		}
+	}
+	loadErrs := r.GetLoadErrors()
+	if len(loadErrs) != 2 || loadErrs[0].AutomationID != "ping" || len(loadErrs[0].Waiting) != 0 {
+		t.Errorf("load errors = %+v", loadErrs)
+	}
+}
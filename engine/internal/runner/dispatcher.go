@@ -0,0 +1,316 @@
+package runner
+
+import (
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Automation priorities. High-priority automations (doorbell, alarm) run on a
+// reserved worker set so they are never queued behind bulk sensor processing.
+const (
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// threadLocalPriority holds the priority a run executes at. It can be higher
+// than the automation's own when inherited from a ctx.call caller or a timer.
+const threadLocalPriority = "homebrain.priority"
+
+// higherPriority returns the more urgent of two priorities
+func higherPriority(a, b string) string {
+	if a == PriorityHigh || b == PriorityHigh {
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+const (
+	defaultNormalWorkers = 16
+	defaultHighWorkers   = 2
+	dispatchQueueSize    = 1000
+)
+
+// dispatcher runs handler invocations on bounded worker pools, one per priority.
+// Jobs submitted with a key (the automation ID) run one at a time in FIFO
+// order, so an automation's handlers never race each other on its state.
+type dispatcher struct {
+	normal     chan func()
+	high       chan func()
+	normalSize int
+	highSize   int
+	mu         sync.Mutex
+	serial     map[string]*serialQueue // By key; present while a job with the key is queued or runs
+	standIns   map[string]int          // Running stand-in workers by priority
+	workersMu  sync.Mutex
+	workers    map[*worker]struct{} // Permanent workers
+}
+
+// worker is a permanent pool worker as seen by replaceStuck
+type worker struct {
+	pool    string
+	busy    time.Time // Start of the running job; zero while idle
+	retired bool      // Replaced; exits once its job returns
+}
+
+// newDispatcher starts the worker pools (non-positive sizes use the defaults).
+// High-priority workers are locked to their own OS threads so they keep
+// running while normal workers are busy.
+func newDispatcher(normalWorkers, highWorkers int) *dispatcher {
+	if normalWorkers < 1 {
+		normalWorkers = defaultNormalWorkers
+	}
+	if highWorkers < 1 {
+		highWorkers = defaultHighWorkers
+	}
+
+	d := &dispatcher{
+		normal:     make(chan func(), dispatchQueueSize),
+		high:       make(chan func(), dispatchQueueSize),
+		normalSize: normalWorkers,
+		highSize:   highWorkers,
+		serial:     make(map[string]*serialQueue),
+		standIns:   make(map[string]int),
+		workers:    make(map[*worker]struct{}),
+	}
+	for i := 0; i < normalWorkers; i++ {
+		go d.work(PriorityNormal)
+	}
+	for i := 0; i < highWorkers; i++ {
+		go d.work(PriorityHigh)
+	}
+	return d
+}
+
+// queue returns the job channel of a pool and whether its workers are locked
+// to OS threads
+func (d *dispatcher) queue(priority string) (chan func(), bool) {
+	if priority == PriorityHigh {
+		return d.high, true
+	}
+	return d.normal, false
+}
+
+func (d *dispatcher) work(pool string) {
+	jobs, lockThread := d.queue(pool)
+	if lockThread {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+	w := &worker{pool: pool}
+	d.workersMu.Lock()
+	d.workers[w] = struct{}{}
+	d.workersMu.Unlock()
+	defer func() {
+		d.workersMu.Lock()
+		delete(d.workers, w)
+		d.workersMu.Unlock()
+	}()
+
+	for job := range jobs {
+		d.workersMu.Lock()
+		w.busy = time.Now()
+		d.workersMu.Unlock()
+
+		job()
+
+		d.workersMu.Lock()
+		w.busy = time.Time{}
+		retired := w.retired
+		d.workersMu.Unlock()
+		if retired {
+			return
+		}
+	}
+}
+
+// submit queues a job on the pool matching the priority
+func (d *dispatcher) submit(priority string, job func()) {
+	if priority == PriorityHigh {
+		d.high <- job
+		return
+	}
+	d.normal <- job
+}
+
+// serialQueue holds the jobs waiting on one key
+type serialQueue struct {
+	jobs    []serialJob
+	high    int    // Waiting jobs submitted at high priority
+	pool    string // Pool the drain is queued or running on
+	running bool
+}
+
+type serialJob struct {
+	run      func()
+	priority string
+}
+
+// submitSerial queues a job behind any queued or running job with the same
+// key. It never blocks, so it can be called from MQTT callbacks and from
+// handlers running on a worker. One drain per key takes a worker and runs the
+// key's jobs in order until none are left. The drain runs on the high-priority
+// pool while a high-priority job waits, moving there between jobs if it
+// started on the normal pool. Once dispatchQueueSize jobs wait on a key, or
+// the pool's queue is full, new ones are dropped and it returns false.
+func (d *dispatcher) submitSerial(key, priority string, job func()) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := d.serial[key]
+	if q == nil {
+		q = &serialQueue{}
+		d.serial[key] = q
+	}
+	if len(q.jobs) >= dispatchQueueSize {
+		slog.Warn("Automation queue full, dropping trigger", "automation", key)
+		return false
+	}
+	q.jobs = append(q.jobs, serialJob{job, priority})
+	if priority == PriorityHigh {
+		q.high++
+	}
+
+	switch {
+	case q.pool == "":
+		if !d.scheduleDrain(key, q, priority) {
+			delete(d.serial, key)
+			slog.Warn("Dispatch queue full, dropping trigger", "automation", key, "priority", priority)
+			return false
+		}
+	case priority == PriorityHigh && q.pool != PriorityHigh && !q.running:
+		// The drain is still queued behind normal jobs; a high-priority one
+		// takes over if it starts first
+		d.scheduleDrain(key, q, PriorityHigh)
+	}
+	return true
+}
+
+// scheduleDrain queues a drain of q on the priority's pool. Caller holds d.mu.
+func (d *dispatcher) scheduleDrain(key string, q *serialQueue, priority string) bool {
+	if !d.trySubmit(priority, func() { d.drain(key, priority) }) {
+		return false
+	}
+	q.pool = priority
+	return true
+}
+
+// drain runs the key's queued jobs in order until none are left. A drain
+// that finds the queue running, or scheduled on another pool, was
+// superseded and returns.
+func (d *dispatcher) drain(key, pool string) {
+	d.mu.Lock()
+	q := d.serial[key]
+	if q == nil || q.running || q.pool != pool {
+		d.mu.Unlock()
+		return
+	}
+	q.running = true
+	for {
+		if len(q.jobs) == 0 {
+			delete(d.serial, key)
+			d.mu.Unlock()
+			return
+		}
+		if pool != PriorityHigh && q.high > 0 {
+			q.running = false
+			if d.scheduleDrain(key, q, PriorityHigh) {
+				d.mu.Unlock()
+				return
+			}
+			q.running = true
+		}
+		job := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		if job.priority == PriorityHigh {
+			q.high--
+		}
+		d.mu.Unlock()
+
+		job.run()
+
+		d.mu.Lock()
+	}
+}
+
+// trySubmit queues a job without blocking, reporting false if the pool's
+// queue is full
+func (d *dispatcher) trySubmit(priority string, job func()) bool {
+	jobs, _ := d.queue(priority)
+	select {
+	case jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// replaceStuck starts a new worker on the priority's pool for each worker
+// that has been running one job for longer than threshold at now, and returns
+// how many it replaced. A replaced worker exits when its job finally returns,
+// so the pool goes back to its configured size.
+func (d *dispatcher) replaceStuck(priority string, threshold time.Duration, now time.Time) int {
+	n := 0
+	d.workersMu.Lock()
+	for w := range d.workers {
+		if w.pool == priority && !w.retired && !w.busy.IsZero() && now.Sub(w.busy) > threshold {
+			w.retired = true
+			n++
+		}
+	}
+	d.workersMu.Unlock()
+	for i := 0; i < n; i++ {
+		go d.work(priority)
+	}
+	return n
+}
+
+// standIn starts a temporary worker on the priority's pool for a job that is
+// about to block (ctx.sleep). Calling the returned func retires it once it
+// finishes the job it is running, if any. At most as many stand-ins as the
+// pool has workers run at once; past that, blocking jobs hold their worker.
+func (d *dispatcher) standIn(priority string) func() {
+	pool, limit := PriorityNormal, d.normalSize
+	if priority == PriorityHigh {
+		pool, limit = PriorityHigh, d.highSize
+	}
+	jobs, lockThread := d.queue(pool)
+	d.mu.Lock()
+	if d.standIns[pool] >= limit {
+		d.mu.Unlock()
+		return func() {}
+	}
+	d.standIns[pool]++
+	d.mu.Unlock()
+
+	stop := make(chan struct{})
+	go func() {
+		if lockThread {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+		}
+		for {
+			select {
+			case <-stop:
+				return
+			case job, ok := <-jobs:
+				if !ok {
+					return
+				}
+				job()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		d.mu.Lock()
+		d.standIns[pool]--
+		d.mu.Unlock()
+	}
+}
+
+// stop lets workers finish queued jobs and exit
+func (d *dispatcher) stop() {
+	close(d.normal)
+	close(d.high)
+}
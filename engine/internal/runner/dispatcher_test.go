@@ -0,0 +1,231 @@
+package runner
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_HighPriorityNotBlockedByNormal(t *testing.T) {
+	d := newDispatcher(1, 1)
+	defer d.stop()
+
+	// Occupy the only normal worker
+	release := make(chan struct{})
+	d.submit(PriorityNormal, func() { <-release })
+	defer close(release)
+
+	done := make(chan struct{})
+	d.submit(PriorityHigh, func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("high-priority job was queued behind a normal job")
+	}
+}
+
+func TestDispatcher_RunsAllJobs(t *testing.T) {
+	d := newDispatcher(4, 1)
+	defer d.stop()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	count := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		d.submit(PriorityNormal, func() {
+			defer wg.Done()
+			mu.Lock()
+			count++
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	if count != 50 {
+		t.Errorf("ran %d jobs, want 50", count)
+	}
+}
+
+func TestDispatcher_SerialPerKey(t *testing.T) {
+	d := newDispatcher(4, 1)
+	defer d.stop()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	running := map[string]int{}
+	order := map[string][]int{}
+	overlap := false
+	for i := 0; i < 20; i++ {
+		for _, key := range []string{"a", "b"} {
+			wg.Add(1)
+			d.submitSerial(key, PriorityNormal, func() {
+				defer wg.Done()
+				mu.Lock()
+				running[key]++
+				if running[key] > 1 {
+					overlap = true
+				}
+				order[key] = append(order[key], i)
+				mu.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				mu.Lock()
+				running[key]--
+				mu.Unlock()
+			})
+		}
+	}
+	wg.Wait()
+
+	if overlap {
+		t.Error("jobs with the same key ran concurrently")
+	}
+	for key, got := range order {
+		for i, n := range got {
+			if n != i {
+				t.Fatalf("key %s ran out of order: %v", key, got)
+			}
+		}
+	}
+
+	// The last job's worker removes the key after the job returns
+	deadline := time.Now().Add(time.Second)
+	for {
+		d.mu.Lock()
+		left := len(d.serial)
+		d.mu.Unlock()
+		if left == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d serial queue(s) left behind", left)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcher_SerialKeysRunInParallel(t *testing.T) {
+	d := newDispatcher(2, 1)
+	defer d.stop()
+
+	// Block key a; key b must still get the other worker
+	release := make(chan struct{})
+	d.submitSerial("a", PriorityNormal, func() { <-release })
+	defer close(release)
+
+	done := make(chan struct{})
+	d.submitSerial("b", PriorityNormal, func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("key b was queued behind key a")
+	}
+}
+
+func TestDispatcher_StandInsCapped(t *testing.T) {
+	d := newDispatcher(2, 1)
+	defer d.stop()
+
+	var retire []func()
+	for i := 0; i < 5; i++ {
+		retire = append(retire, d.standIn(PriorityNormal))
+	}
+	d.mu.Lock()
+	running := d.standIns[PriorityNormal]
+	d.mu.Unlock()
+	if running != 2 {
+		t.Errorf("stand-ins = %d, want 2 (the pool size)", running)
+	}
+	for _, f := range retire {
+		f()
+	}
+	d.mu.Lock()
+	running = d.standIns[PriorityNormal]
+	d.mu.Unlock()
+	if running != 0 {
+		t.Errorf("stand-ins = %d after retiring them all", running)
+	}
+}
+
+func TestDispatcher_ReplaceStuck(t *testing.T) {
+	d := newDispatcher(2, 1)
+	defer d.stop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	d.submit(PriorityNormal, func() { close(started); <-release })
+	<-started
+
+	poolSize := func() int {
+		d.workersMu.Lock()
+		defer d.workersMu.Unlock()
+		n := 0
+		for w := range d.workers {
+			if w.pool == PriorityNormal && !w.retired {
+				n++
+			} else if w.retired {
+				return -1 // Still running its job
+			}
+		}
+		return n
+	}
+	if n := d.replaceStuck(PriorityNormal, time.Minute, time.Now()); n != 0 {
+		t.Errorf("replaced %d workers before the threshold", n)
+	}
+	if n := d.replaceStuck(PriorityNormal, time.Minute, time.Now().Add(2*time.Minute)); n != 1 {
+		t.Fatalf("replaced %d workers, want only the stuck one", n)
+	}
+	if n := d.replaceStuck(PriorityNormal, time.Minute, time.Now().Add(3*time.Minute)); n != 0 {
+		t.Errorf("replaced the stuck worker again (%d)", n)
+	}
+
+	// The replaced worker leaves once its job returns
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for poolSize() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool has %d workers, want 2", poolSize())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcher_SerialInheritsHighPriority(t *testing.T) {
+	d := newDispatcher(1, 1)
+	defer d.stop()
+
+	// Occupy the only normal worker, so key a's drain waits in the normal queue
+	release := make(chan struct{})
+	d.submit(PriorityNormal, func() { <-release })
+	defer close(release)
+
+	var mu sync.Mutex
+	var order []string
+	done := make(chan struct{})
+	d.submitSerial("a", PriorityNormal, func() {
+		mu.Lock()
+		order = append(order, "normal")
+		mu.Unlock()
+	})
+	d.submitSerial("a", PriorityHigh, func() {
+		mu.Lock()
+		order = append(order, "high")
+		mu.Unlock()
+		close(done)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("high-priority job waited behind the busy normal pool")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 2 || order[0] != "normal" {
+		t.Errorf("order = %v, want the normal job first", order)
+	}
+}
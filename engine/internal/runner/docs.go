@@ -0,0 +1,171 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// AutomationDocs is human-readable documentation extracted from an automation's
+// docstrings and config
+type AutomationDocs struct {
+	ID       string           `json:"id"`
+	Module   string           `json:"module,omitempty"` // Module docstring
+	Handlers []HandlerDoc     `json:"handlers"`
+	Config   AutomationConfig `json:"config"`
+
+	Annotations []state.Annotation `json:"annotations,omitempty"` // Notes attached via the API, oldest first
+}
+
+// HandlerDoc is the docstring of one on_* handler
+type HandlerDoc struct {
+	Name string `json:"name"`
+	Doc  string `json:"doc,omitempty"`
+}
+
+// GetDocs returns documentation for a loaded automation
+func (r *Runner) GetDocs(id string) (AutomationDocs, error) {
+	automation, err := r.lookup(id)
+	if err != nil {
+		return AutomationDocs{}, err
+	}
+
+	docs := AutomationDocs{
+		ID:       automation.ID,
+		Module:   automation.doc,
+		Handlers: []HandlerDoc{},
+		Config:   automation.Config,
+	}
+	for name, value := range automation.globals {
+		fn, ok := value.(*starlark.Function)
+		if !ok || !strings.HasPrefix(name, "on_") {
+			continue
+		}
+		docs.Handlers = append(docs.Handlers, HandlerDoc{Name: name, Doc: strings.TrimSpace(fn.Doc())})
+	}
+	sort.Slice(docs.Handlers, func(i, j int) bool { return docs.Handlers[i].Name < docs.Handlers[j].Name })
+	if docs.Annotations, err = r.GetAnnotations(id); err != nil {
+		return AutomationDocs{}, err
+	}
+	return docs, nil
+}
+
+// Markdown renders the documentation as a markdown page
+func (d AutomationDocs) Markdown() string {
+	return d.render(true)
+}
+
+// PlainText renders the documentation without markdown markup
+func (d AutomationDocs) PlainText() string {
+	return d.render(false)
+}
+
+func (d AutomationDocs) render(markdown bool) string {
+	var b strings.Builder
+	heading := func(level int, text string) {
+		if markdown {
+			fmt.Fprintf(&b, "%s %s\n\n", strings.Repeat("#", level), text)
+			return
+		}
+		underline := "-"
+		if level == 1 {
+			underline = "="
+		}
+		if level > 2 {
+			fmt.Fprintf(&b, "%s:\n", text)
+			return
+		}
+		fmt.Fprintf(&b, "%s\n%s\n\n", text, strings.Repeat(underline, len(text)))
+	}
+	code := func(s string) string {
+		if markdown {
+			return "`" + s + "`"
+		}
+		return s
+	}
+	paragraph := func(s string) {
+		if s != "" {
+			b.WriteString(s + "\n\n")
+		}
+	}
+
+	title := d.Config.Name
+	if title == "" {
+		title = d.ID
+	}
+	heading(1, title)
+	paragraph(d.Config.Description)
+	paragraph(d.Module)
+
+	heading(2, "Triggers")
+	for _, topic := range d.Config.Subscribe {
+		fmt.Fprintf(&b, "- Subscribes to %s\n", code(topic))
+	}
+	for _, spec := range d.Config.ScheduleSpecs() {
+		fmt.Fprintf(&b, "- Runs on schedule %s\n", code(spec))
+	}
+	if d.Config.Webhook != nil {
+		fmt.Fprintf(&b, "- Runs on webhook %s\n", code("POST /hooks/"+d.Config.Webhook.Name))
+	}
+	if len(d.Config.Subscribe) == 0 && len(d.Config.ScheduleSpecs()) == 0 && d.Config.Webhook == nil {
+		b.WriteString("- Manual only\n")
+	}
+	b.WriteString("\n")
+
+	if len(d.Config.GlobalStateWrites) > 0 {
+		heading(2, "Global State Writes")
+		for _, key := range d.Config.GlobalStateWrites {
+			fmt.Fprintf(&b, "- %s\n", code(key))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(d.Handlers) > 0 {
+		heading(2, "Handlers")
+		for _, h := range d.Handlers {
+			heading(3, code(h.Name))
+			if h.Doc == "" {
+				paragraph("(undocumented)")
+				continue
+			}
+			paragraph(h.Doc)
+		}
+	}
+
+	if len(d.Annotations) > 0 {
+		heading(2, "Notes")
+		for _, note := range d.Annotations {
+			by := ""
+			if note.Author != "" {
+				by = " (" + note.Author + ")"
+			}
+			fmt.Fprintf(&b, "- %s%s: %s\n", note.Time.Format("2006-01-02 15:04"), by, note.Text)
+		}
+		b.WriteString("\n")
+	}
+
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// moduleDocstring returns the string literal that opens a Starlark file, if any
+func moduleDocstring(filename string, src []byte) string {
+	f, err := syntax.Parse(filename, src, 0)
+	if err != nil || len(f.Stmts) == 0 {
+		return ""
+	}
+	expr, ok := f.Stmts[0].(*syntax.ExprStmt)
+	if !ok {
+		return ""
+	}
+	lit, ok := expr.X.(*syntax.Literal)
+	if !ok || lit.Token != syntax.STRING {
+		return ""
+	}
+	doc, _ := lit.Value.(string)
+	return strings.TrimSpace(doc)
+}
@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestModuleDocstring(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{"triple quoted", "\"\"\"\nTurns on the hallway light.\n\"\"\"\nconfig = {}\n", "Turns on the hallway light."},
+		{"single line", "\"Night mode.\"\nconfig = {}\n", "Night mode."},
+		{"comment only", "# Not a docstring\nconfig = {}\n", ""},
+		{"not first statement", "config = {}\n\"\"\"late\"\"\"\n", ""},
+		{"parse error", "def (", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := moduleDocstring("test.star", []byte(tt.src)); got != tt.expected {
+				t.Errorf("moduleDocstring() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetDocs(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "hallway", `
+"""Hallway motion lighting."""
+
+def on_message(topic, payload, ctx):
+    """Turns the light on when motion is detected."""
+    pass
+
+def on_schedule(ctx):
+    pass
+
+def helper():
+    """Not a handler."""
+    pass
+
+config = {
+    "name": "Hallway Light",
+    "description": "Motion-activated hallway light",
+    "subscribe": ["zigbee2mqtt/hallway_motion"],
+    "global_state_writes": ["presence.hallway.*"],
+}
+`)
+
+	docs, err := r.GetDocs("hallway")
+	if err != nil {
+		t.Fatalf("GetDocs failed: %v", err)
+	}
+	if docs.Module != "Hallway motion lighting." {
+		t.Errorf("Module = %q", docs.Module)
+	}
+	if len(docs.Handlers) != 2 || docs.Handlers[0].Name != "on_message" || docs.Handlers[1].Name != "on_schedule" {
+		t.Fatalf("Handlers = %+v, want on_message and on_schedule", docs.Handlers)
+	}
+	if docs.Handlers[0].Doc != "Turns the light on when motion is detected." {
+		t.Errorf("on_message doc = %q", docs.Handlers[0].Doc)
+	}
+
+	md := docs.Markdown()
+	for _, want := range []string{"# Hallway Light", "Motion-activated hallway light", "`zigbee2mqtt/hallway_motion`", "### `on_message`", "`presence.hallway.*`"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+	text := docs.PlainText()
+	if strings.Contains(text, "`") || strings.Contains(text, "# ") {
+		t.Errorf("plain text contains markdown markup:\n%s", text)
+	}
+
+	if _, err := r.GetDocs("missing"); !errors.Is(err, ErrAutomationNotFound) {
+		t.Errorf("GetDocs(missing) error = %v, want ErrAutomationNotFound", err)
+	}
+}
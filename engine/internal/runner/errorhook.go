@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// HandlerErrors counts an automation's failed handler runs since the engine
+// started. Reloads keep the count.
+type HandlerErrors struct {
+	Count       int       `json:"count"`
+	LastError   string    `json:"last_error"`
+	LastHandler string    `json:"last_handler"`
+	LastTime    time.Time `json:"last_time"`
+}
+
+// handlerErrors holds error counts by automation ID
+type handlerErrors struct {
+	mu   sync.Mutex
+	byID map[string]*HandlerErrors
+}
+
+func (h *handlerErrors) record(id, handler string, err error, at time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.byID == nil {
+		h.byID = make(map[string]*HandlerErrors)
+	}
+	e := h.byID[id]
+	if e == nil {
+		e = &HandlerErrors{}
+		h.byID[id] = e
+	}
+	e.Count++
+	e.LastError, e.LastHandler, e.LastTime = err.Error(), handler, at
+	return e.Count
+}
+
+// get returns a copy of id's counts, or nil if none of its runs failed
+func (h *handlerErrors) get(id string) *HandlerErrors {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.byID[id]
+	if !ok {
+		return nil
+	}
+	copied := *e
+	return &copied
+}
+
+// GetHandlerErrors returns the failed-run counts of automation id, or nil
+func (r *Runner) GetHandlerErrors(id string) *HandlerErrors {
+	return r.handlerErrors.get(id)
+}
+
+// handlerFailed records a failed run and passes it to the automation's
+// on_error(error, context_info, ctx). Services report to their caller
+// instead, and a failing on_error is only logged.
+func (r *Runner) handlerFailed(automation *Automation, trigger Trigger, record RunRecord, err error) {
+	count := r.handlerErrors.record(automation.ID, record.Handler, err, record.Start)
+	if automation.onError == nil || record.Handler == "on_error" || strings.HasPrefix(record.Handler, "services.") {
+		return
+	}
+
+	info := starlark.NewDict(6)
+	info.SetKey(starlark.String("handler"), starlark.String(record.Handler))
+	info.SetKey(starlark.String("run_id"), starlark.String(record.ID))
+	info.SetKey(starlark.String("payload"), starlark.String(trigger.payload))
+	info.SetKey(starlark.String("timed_out"), starlark.Bool(errors.Is(err, errHandlerTimeout)))
+	info.SetKey(starlark.String("error_count"), starlark.MakeInt(count))
+	var backtrace string
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		backtrace = evalErr.Backtrace()
+		var redacted *redactedError
+		if errors.As(err, &redacted) {
+			backtrace = redacted.redact(backtrace)
+		}
+	}
+	info.SetKey(starlark.String("backtrace"), starlark.String(backtrace))
+
+	r.execute(automation, trigger, "on_error", automation.onError, starlark.String(err.Error()), info)
+}
@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestOnError(t *testing.T) {
+	r := newTestRunner()
+	a := addTestAutomation(t, r, "boiler", `
+config = {"name": "Boiler"}
+
+def on_schedule(ctx):
+    fail("boom")
+
+def on_error(error, info, ctx):
+    ctx.log("%s in %s (%s, #%d, timed out: %s)" % (error, info["handler"], ctx.trigger.type, info["error_count"], info["timed_out"]))
+    if "on_schedule" not in info["backtrace"]:
+        fail("no backtrace: " + info["backtrace"])
+`)
+	a.onError, _ = a.globals["on_error"].(starlark.Callable)
+
+	if _, err := r.RunManual("boiler", ManualTrigger{}); err == nil {
+		t.Fatal("expected the handler error to be returned")
+	}
+	waitForLog(t, r, "fail: boom in on_schedule (manual, #1, timed out: False)")
+
+	r.RunManual("boiler", ManualTrigger{})
+	errs := r.GetHandlerErrors("boiler")
+	if errs == nil || errs.Count != 2 || errs.LastError != "fail: boom" || errs.LastHandler != "on_schedule" {
+		t.Fatalf("errors = %+v", errs)
+	}
+	for _, listed := range r.ListAutomations() {
+		if listed.ID == "boiler" && (listed.Errors == nil || listed.Errors.Count != 2) {
+			t.Errorf("listed errors = %+v", listed.Errors)
+		}
+	}
+	if r.GetHandlerErrors("unknown") != nil {
+		t.Error("expected no errors for an automation that never failed")
+	}
+}
+
+func TestOnError_FailureIsNotReentered(t *testing.T) {
+	r := newTestRunner()
+	a := addTestAutomation(t, r, "broken", `
+config = {"name": "Broken"}
+
+def on_schedule(ctx):
+    fail("first")
+
+def on_error(error, info, ctx):
+    fail("second")
+`)
+	a.onError, _ = a.globals["on_error"].(starlark.Callable)
+
+	r.RunManual("broken", ManualTrigger{})
+	errs := r.GetHandlerErrors("broken")
+	if errs == nil || errs.Count != 2 || errs.LastHandler != "on_error" {
+		t.Fatalf("errors = %+v", errs)
+	}
+	var handlers []string
+	for _, run := range r.GetRuns("broken") {
+		handlers = append(handlers, run.Handler)
+	}
+	if got := strings.Join(handlers, ","); got != "on_error,on_schedule" && got != "on_schedule,on_error" {
+		t.Errorf("runs = %s", got)
+	}
+}
@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"fmt"
+	"maps"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/notify"
+)
+
+const (
+	// threadLocalExpectations holds the expectations failed during the current run
+	threadLocalExpectations = "homebrain.expectations"
+
+	maxExpectationsPerRun = 16
+)
+
+// ExpectationFailure is a failed ctx.expect, recorded with the inputs the run
+// saw: the trigger payload and the state and global values it had read
+type ExpectationFailure struct {
+	AutomationID string         `json:"automation_id"`
+	RunID        string         `json:"run_id,omitempty"` // Empty in dry runs
+	Message      string         `json:"message"`
+	Location     string         `json:"location"` // file:line of the ctx.expect call
+	Time         time.Time      `json:"time"`
+	Topic        string         `json:"topic,omitempty"`
+	Payload      string         `json:"payload,omitempty"`
+	State        map[string]any `json:"state,omitempty"`
+	Global       map[string]any `json:"global,omitempty"`
+}
+
+// runExpectations collects a run's failed expectations
+type runExpectations struct {
+	list []ExpectationFailure
+}
+
+// GetExpectationFailures returns failed expectations from the run history,
+// oldest first, optionally filtered by automation ID
+func (r *Runner) GetExpectationFailures(automationID string) []ExpectationFailure {
+	r.runsMu.RLock()
+	defer r.runsMu.RUnlock()
+
+	result := []ExpectationFailure{}
+	for _, run := range r.runs {
+		if automationID == "" || run.AutomationID == automationID {
+			result = append(result, run.Expectations...)
+		}
+	}
+	return result
+}
+
+// expectBuiltin implements ctx.expect(condition, message, notify=False,
+// priority="normal"). A false condition is recorded on the run and logged as a
+// warning, and with notify=True also sent as a notification; the handler keeps
+// running. Returns the condition's truth value.
+func (c *Context) expectBuiltin(trigger Trigger) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var condition starlark.Value
+		var message string
+		var notifyOnFailure bool
+		priority := notify.PriorityNormal
+		if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "condition", &condition, "message", &message, "notify?", &notifyOnFailure, "priority?", &priority); err != nil {
+			return nil, err
+		}
+		if err := notify.ValidatePriority(priority); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		if condition.Truth() {
+			return starlark.True, nil
+		}
+
+		message = redactSecrets(thread, message)
+		c.logFunc(c.automationID, LogLevelWarning, "WARNING: expectation failed: "+message)
+
+		expectations, _ := thread.Local(threadLocalExpectations).(*runExpectations)
+		if expectations != nil && len(expectations.list) < maxExpectationsPerRun {
+			failure := ExpectationFailure{
+				AutomationID: c.automationID,
+				Message:      message,
+				Location:     thread.CallFrame(1).Pos.String(),
+				Time:         c.now(),
+				Topic:        trigger.Topic,
+				Payload:      redactSecrets(thread, trigger.payload),
+			}
+			failure.RunID, _ = thread.Local(threadLocalRunID).(string)
+			if capture := captureFrom(thread); capture != nil {
+				state, global, _ := capture.snapshot()
+				failure.State, failure.Global = maps.Clone(state), maps.Clone(global)
+			}
+			expectations.list = append(expectations.list, failure)
+		}
+
+		if notifyOnFailure {
+			msg := notify.Message{Title: "Expectation failed: " + c.automationID, Body: message, Priority: priority, Source: c.automationID}
+			err := notify.ErrNoChannels
+			if c.notify != nil {
+				err = c.notify("", msg)
+			}
+			if err != nil {
+				c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: notify: %s", err))
+			}
+		}
+		return starlark.False, nil
+	}
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/notify"
+)
+
+func TestExpect(t *testing.T) {
+	r := newTestRunner()
+	a := addTestAutomation(t, r, "heating", `
+config = {"name": "Heating", "subscribe": ["zigbee2mqtt/window"]}
+
+def on_message(topic, payload, ctx):
+    window = ctx.json_decode(payload)
+    heater = ctx.get_global("heating.living_room")
+    ok = ctx.expect(not (window["contact"] == False and heater == "on"), "heater on while window open", notify=True, priority="high")
+    ctx.expect(True, "never recorded")
+    return ok
+`)
+	a.context.stateStore = newMemoryState(nil, map[string]any{"heating.living_room": "on"}, nil)
+	var sent []notify.Message
+	a.context.notify = func(channel string, msg notify.Message) error {
+		sent = append(sent, msg)
+		return nil
+	}
+
+	trigger := Trigger{Type: TriggerMQTT, Topic: "zigbee2mqtt/window", Time: time.Now()}
+	record, err := r.handleMessage(a, trigger, []byte(`{"contact": false}`))
+	if err != nil {
+		t.Fatalf("handleMessage failed: %v", err)
+	}
+	if record.Result != false {
+		t.Errorf("result = %v, want False", record.Result)
+	}
+	if len(record.Expectations) != 1 {
+		t.Fatalf("expectations = %+v, want one failure", record.Expectations)
+	}
+	failure := record.Expectations[0]
+	if failure.Message != "heater on while window open" || failure.RunID != record.ID || failure.Location != "heating.star:7:20" {
+		t.Errorf("failure = %+v", failure)
+	}
+	if failure.Topic != "zigbee2mqtt/window" || failure.Payload != `{"contact": false}` || failure.Global["heating.living_room"] != "on" {
+		t.Errorf("failure inputs = %+v", failure)
+	}
+
+	if len(sent) != 1 || sent[0].Title != "Expectation failed: heating" || sent[0].Priority != notify.PriorityHigh {
+		t.Errorf("notifications = %+v", sent)
+	}
+	if logs := r.GetLogs(); len(logs) != 1 || logs[0].Message != "WARNING: expectation failed: heater on while window open" {
+		t.Errorf("logs = %+v", logs)
+	}
+	if got := r.GetExpectationFailures("heating"); len(got) != 1 || got[0].Message != failure.Message {
+		t.Errorf("GetExpectationFailures = %+v", got)
+	}
+	if got := r.GetExpectationFailures("other"); len(got) != 0 {
+		t.Errorf("GetExpectationFailures(other) = %+v", got)
+	}
+}
+
+func TestExpect_DryRun(t *testing.T) {
+	r := newTestRunner()
+	result, err := r.DryRun(DryRunRequest{
+		State: map[string]any{"count": 3},
+		Code: `
+config = {"name": "Counter"}
+
+def on_schedule(ctx):
+    count = ctx.get_state("count")
+    for i in range(20):
+        ctx.expect(count < 3, "count is %d" % count)
+`})
+	if err != nil || !result.Success {
+		t.Fatalf("DryRun = %+v, %v", result, err)
+	}
+	if len(result.Expectations) != maxExpectationsPerRun {
+		t.Fatalf("recorded %d failures, want the cap of %d", len(result.Expectations), maxExpectationsPerRun)
+	}
+	if failure := result.Expectations[0]; failure.Message != "count is 3" || failure.RunID != "" || failure.State["count"] != 3 {
+		t.Errorf("failure = %+v", failure)
+	}
+	if len(result.Logs) != 20 || !strings.HasPrefix(result.Logs[0], "WARNING: expectation failed:") {
+		t.Errorf("logs = %v", result.Logs)
+	}
+	if len(result.Notifications) != 0 {
+		t.Errorf("notifications = %+v, want none without notify=True", result.Notifications)
+	}
+}
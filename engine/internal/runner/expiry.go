@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// expirations holds the clear timers of state keys set with a TTL. They are
+// also kept in the state store and re-armed when the runner starts, so a key
+// expires even if the engine was down at the time.
+type expirations struct {
+	mu      sync.Mutex
+	pending map[string]*time.Timer // Keyed by expirationKey
+}
+
+// expirationKey names a pending expiry like the state store does; "\x00"
+// can't occur in automation IDs or keys, so the kinds never collide
+func expirationKey(automationID, key string, global bool) string {
+	if global {
+		return "global\x00" + key
+	}
+	return "automation\x00" + automationID + "\x00" + key
+}
+
+// setExpiry makes a key written by automationID expire after ttl, replacing
+// any earlier expiry. A zero ttl keeps the key until it is cleared. A silent
+// global key is cleared without running on_state_change.
+func (r *Runner) setExpiry(automationID, key string, global bool, ttl time.Duration, silent bool) error {
+	if ttl <= 0 {
+		return r.cancelExpiry(automationID, key, global)
+	}
+	expiration := state.Expiration{AutomationID: automationID, Key: key, Global: global, Silent: silent && global, ExpiresAt: time.Now().Add(ttl)}
+	r.armExpiry(expiration)
+	if r.stateStore != nil {
+		return r.stateStore.SaveExpiration(expiration)
+	}
+	return nil
+}
+
+// cancelExpiry drops a key's pending expiry, if any
+func (r *Runner) cancelExpiry(automationID, key string, global bool) error {
+	if r.disarmExpiry(automationID, key, global) && r.stateStore != nil {
+		return r.stateStore.DeleteExpiration(automationID, key, global)
+	}
+	return nil
+}
+
+// disarmExpiry stops a key's expiry timer, leaving the stored expiration, and
+// reports whether one was pending
+func (r *Runner) disarmExpiry(automationID, key string, global bool) bool {
+	id := expirationKey(automationID, key, global)
+	r.expirations.mu.Lock()
+	defer r.expirations.mu.Unlock()
+	t, ok := r.expirations.pending[id]
+	if ok {
+		t.Stop()
+		delete(r.expirations.pending, id)
+	}
+	return ok
+}
+
+func (r *Runner) armExpiry(expiration state.Expiration) {
+	id := expirationKey(expiration.AutomationID, expiration.Key, expiration.Global)
+
+	r.expirations.mu.Lock()
+	defer r.expirations.mu.Unlock()
+	if r.expirations.pending == nil {
+		r.expirations.pending = make(map[string]*time.Timer)
+	}
+	if existing, ok := r.expirations.pending[id]; ok {
+		existing.Stop()
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(time.Until(expiration.ExpiresAt), func() {
+		r.expirations.mu.Lock()
+		current := r.expirations.pending[id] == t
+		if current {
+			delete(r.expirations.pending, id)
+		}
+		r.expirations.mu.Unlock()
+		// A rewritten key may already be expiring
+		if current {
+			r.expire(expiration)
+		}
+	})
+	r.expirations.pending[id] = t
+}
+
+// expire clears a key whose TTL ran out. An expired global key triggers
+// on_state_change(key, old, None) in the automations watching it, including
+// the one that set it, unless the expiry is silent.
+func (r *Runner) expire(expiration state.Expiration) {
+	if r.stateStore == nil {
+		return
+	}
+	if err := r.stateStore.DeleteExpiration(expiration.AutomationID, expiration.Key, expiration.Global); err != nil {
+		slog.Error("Failed to delete expiration", "automation", expiration.AutomationID, "key", expiration.Key, "error", err)
+	}
+
+	if !expiration.Global {
+		if err := r.stateStore.ClearState(expiration.AutomationID, expiration.Key); err != nil {
+			r.addLog(expiration.AutomationID, LogLevelError, fmt.Sprintf("ERROR: expire state %s: %s", expiration.Key, err))
+			return
+		}
+		slog.Debug("State key expired", "automation", expiration.AutomationID, "key", expiration.Key)
+		return
+	}
+
+	if err := r.commitGlobal(nil, "", expiration.Key, nil, true, !expiration.Silent); err != nil {
+		r.addLog(expiration.AutomationID, LogLevelError, fmt.Sprintf("ERROR: expire global %s: %s", expiration.Key, err))
+		return
+	}
+	slog.Debug("Global key expired", "key", expiration.Key, "writer", expiration.AutomationID)
+}
+
+// restoreExpirations re-arms persisted expirations. Keys whose TTL ran out
+// while the engine was down are cleared right away.
+func (r *Runner) restoreExpirations() {
+	if r.stateStore == nil {
+		return
+	}
+	pending, err := r.stateStore.ListExpirations()
+	if err != nil {
+		slog.Error("Failed to restore state expirations", "error", err)
+		return
+	}
+	for _, expiration := range pending {
+		r.armExpiry(expiration)
+	}
+}
+
+// ttlArg converts the ttl argument of ctx.set_state and ctx.set_global; None
+// means the key never expires
+func ttlArg(fn *starlark.Builtin, v starlark.Value) (time.Duration, error) {
+	if v == starlark.None {
+		return 0, nil
+	}
+	seconds, ok := starlark.AsFloat(v)
+	if !ok || seconds <= 0 {
+		return 0, fmt.Errorf("%s: ttl must be a positive number of seconds", fn.Name())
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
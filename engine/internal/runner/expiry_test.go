@@ -0,0 +1,203 @@
+package runner
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// expiryTestAutomation registers src with the runner's store and TTLs wired
+// up the way loadAutomation does it
+func expiryTestAutomation(t *testing.T, r *Runner, id, src string) *Automation {
+	t.Helper()
+	a := addTestAutomation(t, r, id, src)
+	a.onStateChange, _ = a.globals["on_state_change"].(starlark.Callable)
+	a.context.stateStore = r.stateStore
+	a.context.writeGlobal = func(thread *starlark.Thread, key string, value any, clear bool) error {
+		return r.writeGlobal(thread, id, key, value, clear)
+	}
+	a.context.expire = func(key string, global bool, ttl time.Duration, silent bool) error {
+		return r.setExpiry(id, key, global, ttl, silent)
+	}
+	return a
+}
+
+func newExpiryTestRunner(t *testing.T) *Runner {
+	t.Helper()
+	store, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	r := newTestRunner()
+	r.stateStore = store
+	return r
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStateTTL(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	expiryTestAutomation(t, r, "hallway", `
+config = {"name": "Hallway"}
+
+def on_message(topic, payload, ctx):
+    ctx.set_state("motion", True, ttl = 0.05)
+    ctx.set_state("kept", True, ttl = 0.05)
+    ctx.set_state("kept", "forever")
+`)
+	if _, err := r.handleMessage(r.automations["hallway"], Trigger{Type: TriggerMQTT, Topic: "hallway/motion"}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := r.stateStore.GetState("hallway", "motion"); v != true {
+		t.Fatalf("motion before expiry = %v", v)
+	}
+	waitFor(t, "motion to expire", func() bool {
+		v, _ := r.stateStore.GetState("hallway", "motion")
+		return v == nil
+	})
+
+	// Rewriting without a TTL cancelled the expiry
+	time.Sleep(100 * time.Millisecond)
+	if v, _ := r.stateStore.GetState("hallway", "kept"); v != "forever" {
+		t.Errorf("kept = %v", v)
+	}
+	if pending, _ := r.stateStore.ListExpirations(); len(pending) != 0 {
+		t.Errorf("expirations left behind: %+v", pending)
+	}
+}
+
+func TestStateTTL_GlobalTriggersWatchers(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	expiryTestAutomation(t, r, "motion", `
+config = {"name": "Motion", "global_state_writes": ["presence.*"]}
+
+def on_message(topic, payload, ctx):
+    ctx.set_global("presence.hallway", True, ttl = 0.05)
+`)
+	expiryTestAutomation(t, r, "lights", `
+config = {"name": "Lights", "watch_global": ["presence.*"]}
+
+def on_state_change(key, old, new, ctx):
+    ctx.log("%s: %s -> %s" % (key, old, new))
+`)
+	if _, err := r.handleMessage(r.automations["motion"], Trigger{Type: TriggerMQTT, Topic: "hallway/motion"}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForLog(t, r, "presence.hallway: None -> True")
+	waitForLog(t, r, "presence.hallway: True -> None")
+	if v, _ := r.stateStore.GetGlobalState("presence.hallway"); v != nil {
+		t.Errorf("presence.hallway after expiry = %v", v)
+	}
+	history, _ := r.stateStore.GetGlobalHistory("presence.hallway", 1)
+	if len(history) != 1 || !history[0].Cleared {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestStateTTL_GlobalWithoutNotify(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	expiryTestAutomation(t, r, "motion", `
+config = {"name": "Motion", "global_state_writes": ["presence.*"]}
+
+def on_message(topic, payload, ctx):
+    ctx.set_global("presence.hallway", True, ttl = 0.05, notify_expiry = False)
+`)
+	expiryTestAutomation(t, r, "lights", `
+config = {"name": "Lights", "watch_global": ["presence.*"]}
+
+def on_state_change(key, old, new, ctx):
+    ctx.log("%s: %s -> %s" % (key, old, new))
+`)
+	if _, err := r.handleMessage(r.automations["motion"], Trigger{Type: TriggerMQTT, Topic: "hallway/motion"}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForLog(t, r, "presence.hallway: None -> True")
+	waitFor(t, "presence.hallway to expire", func() bool {
+		v, _ := r.stateStore.GetGlobalState("presence.hallway")
+		return v == nil
+	})
+	time.Sleep(50 * time.Millisecond)
+	for _, entry := range r.GetLogs() {
+		if strings.Contains(entry.Message, "presence.hallway: True -> None") {
+			t.Error("silent expiry ran on_state_change")
+		}
+	}
+}
+
+func TestStateTTL_RunnerWriteCancels(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	expiryTestAutomation(t, r, "motion", `
+config = {"name": "Motion", "global_state_writes": ["presence.*"]}
+
+def on_message(topic, payload, ctx):
+    ctx.set_global("presence.hallway", True, ttl = 0.05)
+`)
+	if _, err := r.handleMessage(r.automations["motion"], Trigger{Type: TriggerMQTT, Topic: "hallway/motion"}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	// An override, profile switch or seed writes the key without a TTL
+	if err := r.setGlobal(nil, "api", "presence.hallway", "pinned"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if v, _ := r.stateStore.GetGlobalState("presence.hallway"); v != "pinned" {
+		t.Errorf("presence.hallway = %v, want the later write kept", v)
+	}
+	if pending, _ := r.stateStore.ListExpirations(); len(pending) != 0 {
+		t.Errorf("expirations left behind: %+v", pending)
+	}
+}
+
+func TestStateTTL_Restore(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	r.stateStore.SetState("hallway", "motion", true)
+	r.stateStore.SaveExpiration(state.Expiration{AutomationID: "hallway", Key: "motion", ExpiresAt: time.Now().Add(-time.Minute)})
+	r.stateStore.SetGlobalState("presence.hallway", true)
+	r.stateStore.SaveExpiration(state.Expiration{AutomationID: "hallway", Key: "presence.hallway", Global: true, ExpiresAt: time.Now().Add(time.Hour)})
+
+	r.restoreExpirations()
+
+	waitFor(t, "overdue key to expire", func() bool {
+		v, _ := r.stateStore.GetState("hallway", "motion")
+		return v == nil
+	})
+	if v, _ := r.stateStore.GetGlobalState("presence.hallway"); v != true {
+		t.Errorf("presence.hallway = %v, want it kept until its TTL", v)
+	}
+	if pending, _ := r.stateStore.ListExpirations(); len(pending) != 1 || !pending[0].Global {
+		t.Errorf("expirations = %+v", pending)
+	}
+}
+
+func TestStateTTL_InvalidTTL(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	expiryTestAutomation(t, r, "hallway", `
+config = {"name": "Hallway"}
+
+def on_message(topic, payload, ctx):
+    ctx.set_state("motion", True, ttl = 0)
+`)
+	if _, err := r.handleMessage(r.automations["hallway"], Trigger{Type: TriggerMQTT, Topic: "hallway/motion"}, []byte("{}")); err == nil {
+		t.Fatal("expected an error for ttl = 0")
+	}
+}
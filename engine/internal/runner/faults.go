@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Side effects that can be made to fail in a dry run
+const (
+	FailPublish    = "publish"
+	FailStateWrite = "state_write"
+	FailHTTP       = "http"
+	FailNotify     = "notify"
+)
+
+var errInjected = errors.New("injected failure")
+
+// InjectedFailure makes matching side effects fail during a dry run so an
+// automation's error handling can be exercised
+type InjectedFailure struct {
+	Action string `json:"action"`           // publish, state_write, http or notify
+	Match  string `json:"match,omitempty"`  // Topic, state key, URL or channel; a trailing * matches a prefix, empty matches all
+	Status int    `json:"status,omitempty"` // Response status for http failures (default 500)
+}
+
+// faultInjector applies a dry run's injected failures and records which fired
+type faultInjector struct {
+	failures []InjectedFailure
+	mu       sync.Mutex
+	fired    []string
+}
+
+func newFaultInjector(failures []InjectedFailure) (*faultInjector, error) {
+	f := &faultInjector{failures: make([]InjectedFailure, 0, len(failures))}
+	for _, failure := range failures {
+		switch failure.Action {
+		case FailPublish, FailStateWrite, FailNotify:
+		case FailHTTP:
+			if failure.Status == 0 {
+				failure.Status = http.StatusInternalServerError
+			}
+			if failure.Status < 100 || failure.Status > 599 {
+				return nil, fmt.Errorf("invalid status %d for injected http failure", failure.Status)
+			}
+		default:
+			return nil, fmt.Errorf("unknown failure action %q (want publish, state_write, http or notify)", failure.Action)
+		}
+		f.failures = append(f.failures, failure)
+	}
+	return f, nil
+}
+
+// fail reports whether action on target should fail. A nil injector never fails.
+func (f *faultInjector) fail(action, target string) (InjectedFailure, bool) {
+	if f == nil {
+		return InjectedFailure{}, false
+	}
+	for _, failure := range f.failures {
+		if failure.Action == action && (failure.Match == "" || matchPattern(failure.Match, target)) {
+			f.mu.Lock()
+			f.fired = append(f.fired, strings.TrimSpace(action+" "+target))
+			f.mu.Unlock()
+			return failure, true
+		}
+	}
+	return InjectedFailure{}, false
+}
+
+func (f *faultInjector) has(action string) bool {
+	for _, failure := range f.failures {
+		if failure.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *faultInjector) snapshot() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.fired...)
+}
+
+// RoundTrip answers requests to matching URLs with the injected status. Other
+// requests fail, as no real requests are sent in dry runs.
+func (f *faultInjector) RoundTrip(req *http.Request) (*http.Response, error) {
+	failure, ok := f.fail(FailHTTP, req.URL.String())
+	if !ok {
+		return nil, errors.New("http is not available in dry runs")
+	}
+	return &http.Response{
+		StatusCode: failure.Status,
+		Status:     fmt.Sprintf("%d %s", failure.Status, http.StatusText(failure.Status)),
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(errInjected.Error())),
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,239 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// defaultDataLimit caps the total size of one automation's data directory
+const defaultDataLimit = 10 << 20
+
+// validFileName allows flat names only, so automations can't escape their directory
+var validFileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// SetDataDir enables ctx.file for automations loaded afterwards. Each
+// automation gets dir/<automation id>, capped at limit bytes in total
+// (0 uses the default of 10 MiB).
+func (r *Runner) SetDataDir(dir string, limit int64) {
+	if limit <= 0 {
+		limit = defaultDataLimit
+	}
+	r.dataDir = dir
+	r.dataLimit = limit
+}
+
+// fileStore is an automation's sandboxed data directory
+type fileStore struct {
+	dir   string
+	limit int64
+	mu    sync.Mutex
+}
+
+func (f *fileStore) path(name string) (string, error) {
+	if !validFileName.MatchString(name) {
+		return "", fmt.Errorf("invalid file name %q (letters, digits, '.', '_' and '-' only)", name)
+	}
+	return filepath.Join(f.dir, name), nil
+}
+
+// read returns a file's contents, or nil if it doesn't exist
+func (f *fileStore) read(name string) ([]byte, error) {
+	path, err := f.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// write replaces or appends to a file, refusing writes that would take the
+// directory over its size limit
+func (f *fileStore) write(name string, data []byte, appendData bool) error {
+	path, err := f.path(name)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	used, err := f.usage()
+	if err != nil {
+		return err
+	}
+	newSize := used + int64(len(data))
+	if !appendData {
+		if info, err := os.Stat(path); err == nil {
+			newSize -= info.Size()
+		}
+	}
+	if newSize > f.limit {
+		return fmt.Errorf("%w (%d bytes)", errDataLimit, f.limit)
+	}
+
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendData {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// list returns the names of all files, sorted
+func (f *fileStore) list() ([]string, error) {
+	entries, err := os.ReadDir(f.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// remove deletes a file and reports whether it existed
+func (f *fileStore) remove(name string) (bool, error) {
+	path, err := f.path(name)
+	if err != nil {
+		return false, err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// usage sums the sizes of all files in the directory
+func (f *fileStore) usage() (int64, error) {
+	entries, err := os.ReadDir(f.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+	}
+	return total, nil
+}
+
+// fileModule builds ctx.file
+func (c *Context) fileModule() *starlarkstruct.Struct {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"read":   starlark.NewBuiltin("file.read", c.fileRead),
+		"write":  starlark.NewBuiltin("file.write", c.fileWrite),
+		"list":   starlark.NewBuiltin("file.list", c.fileList),
+		"delete": starlark.NewBuiltin("file.delete", c.fileDelete),
+	})
+}
+
+// fileRead returns a file as a string (bytes with binary=True), or None if missing
+func (c *Context) fileRead(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var binary bool
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "binary?", &binary); err != nil {
+		return nil, err
+	}
+
+	data, err := c.files.read(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	if data == nil {
+		return starlark.None, nil
+	}
+	if binary {
+		return starlark.Bytes(data), nil
+	}
+	return starlark.String(data), nil
+}
+
+// fileWrite stores string or bytes content. Returns False (and logs) when the
+// write fails, e.g. because the size limit would be exceeded.
+func (c *Context) fileWrite(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var content starlark.Value
+	var appendData bool
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "content", &content, "append?", &appendData); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	switch v := content.(type) {
+	case starlark.String:
+		data = []byte(v)
+	case starlark.Bytes:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("%s: content must be string or bytes, got %s", fn.Name(), content.Type())
+	}
+	if _, err := c.files.path(name); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	if err := c.files.write(name, data, appendData); err != nil {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s: %s", fn.Name(), err))
+		return failed(thread, fn, storageCode(err), name, err)
+	}
+	return starlark.True, nil
+}
+
+func (c *Context) fileList(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	names, err := c.files.list()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	values := make([]starlark.Value, len(names))
+	for i, name := range names {
+		values[i] = starlark.String(name)
+	}
+	return starlark.NewList(values), nil
+}
+
+func (c *Context) fileDelete(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+	removed, err := c.files.remove(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	return starlark.Bool(removed), nil
+}
@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+func TestFileStore(t *testing.T) {
+	f := &fileStore{dir: filepath.Join(t.TempDir(), "camera"), limit: 10}
+
+	if data, err := f.read("snapshot.jpg"); err != nil || data != nil {
+		t.Fatalf("read of missing file = %q, %v; want nil", data, err)
+	}
+	if names, err := f.list(); err != nil || len(names) != 0 {
+		t.Fatalf("list of empty dir = %v, %v", names, err)
+	}
+
+	if err := f.write("log.csv", []byte("a,b\n"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.write("log.csv", []byte("1,2\n"), true); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := f.read("log.csv"); string(data) != "a,b\n1,2\n" {
+		t.Errorf("read after append = %q", data)
+	}
+
+	// 8 bytes used: 3 more fit, replacing the file frees its old size
+	if err := f.write("big.bin", []byte("xyz"), false); err == nil {
+		t.Error("write over the limit succeeded")
+	}
+	if err := f.write("log.csv", []byte("0123456789"), false); err != nil {
+		t.Errorf("overwrite within the limit failed: %v", err)
+	}
+
+	if names, _ := f.list(); len(names) != 1 || names[0] != "log.csv" {
+		t.Errorf("list = %v, want [log.csv]", names)
+	}
+	if removed, err := f.remove("log.csv"); !removed || err != nil {
+		t.Errorf("remove = %v, %v", removed, err)
+	}
+
+	for _, name := range []string{"../escape", "a/b", ".hidden", "", strings.Repeat("x", 200)} {
+		if _, err := f.read(name); err == nil {
+			t.Errorf("read(%q) succeeded, want invalid name error", name)
+		}
+	}
+}
+
+func TestContextFile(t *testing.T) {
+	var logs []string
+	ctx := NewContext("camera", nil, nil, func(_, _, msg string) { logs = append(logs, msg) }, nil, nil)
+	ctx.files = &fileStore{dir: t.TempDir(), limit: 100}
+
+	globals, err := starlark.ExecFile(&starlark.Thread{Name: "test"}, "test.star", `
+def run(ctx):
+    ok = ctx.file.write("export.csv", "t,v\n")
+    ctx.file.write("export.csv", "1,2\n", append = True)
+    too_big = ctx.file.write("huge.txt", "x" * 200)
+    return [ok, too_big, ctx.file.read("export.csv"), ctx.file.read("missing"), ctx.file.list(), ctx.file.delete("export.csv")]
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := starlark.Call(&starlark.Thread{Name: "test"}, globals["run"], starlark.Tuple{ctx.ToStarlark(Trigger{Time: time.Now()})}, nil)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	want := `[True, False, "t,v\n1,2\n", None, ["export.csv"], True]`
+	if result.String() != want {
+		t.Errorf("result = %s, want %s", result, want)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], "limit") {
+		t.Errorf("logs = %v, want one limit error", logs)
+	}
+}
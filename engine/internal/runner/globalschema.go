@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"sort"
+	"time"
+)
+
+// GlobalKeyPattern is a declared global_state_writes pattern with the keys
+// automations have actually written under it
+type GlobalKeyPattern struct {
+	Pattern  string          `json:"pattern"`
+	Writers  []string        `json:"writers"` // Automations declaring the pattern
+	Observed []ObservedWrite `json:"observed,omitempty"`
+}
+
+// ObservedWrite is a global key an automation wrote (or tried to) at runtime
+type ObservedWrite struct {
+	Key          string    `json:"key"`
+	AutomationID string    `json:"automation_id"`
+	Count        int       `json:"count"`
+	LastSeen     time.Time `json:"last_seen"`
+	Denied       bool      `json:"denied,omitempty"` // Rejected for lack of a matching pattern
+}
+
+// GlobalStateSchema merges declared write patterns with runtime observation
+type GlobalStateSchema struct {
+	Patterns []GlobalKeyPattern `json:"patterns"`
+
+	// Undeclared lists writes outside the writer's current patterns: attempts
+	// that were denied, and writes made before its config was narrowed or by
+	// automations that have since been unloaded
+	Undeclared []ObservedWrite `json:"undeclared"`
+}
+
+// GetGlobalStateSchema returns the declared global key patterns, the keys
+// observed under each, and observed writes no declared pattern covers
+func (r *Runner) GetGlobalStateSchema() GlobalStateSchema {
+	declared := make(map[string][]string) // Automation ID -> patterns
+	writers := make(map[string][]string)  // Pattern -> automation IDs
+	for _, a := range r.ListAutomations() {
+		declared[a.ID] = a.Config.GlobalStateWrites
+		for _, pattern := range a.Config.GlobalStateWrites {
+			writers[pattern] = append(writers[pattern], a.ID)
+		}
+	}
+
+	observed := make(map[string][]ObservedWrite) // Pattern -> writes
+	schema := GlobalStateSchema{Patterns: []GlobalKeyPattern{}, Undeclared: []ObservedWrite{}}
+	for _, entry := range r.GetAudit() {
+		if entry.Kind != AuditGlobalWrite && entry.Kind != AuditGlobalDenied {
+			continue
+		}
+		write := ObservedWrite{
+			Key:          entry.Target,
+			AutomationID: entry.AutomationID,
+			Count:        entry.Count,
+			LastSeen:     entry.LastSeen,
+			Denied:       entry.Kind == AuditGlobalDenied,
+		}
+		matched := false
+		if !write.Denied {
+			for _, pattern := range declared[entry.AutomationID] {
+				if matchPattern(pattern, entry.Target) {
+					observed[pattern] = append(observed[pattern], write)
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			schema.Undeclared = append(schema.Undeclared, write)
+		}
+	}
+
+	for pattern, ids := range writers {
+		sort.Strings(ids)
+		schema.Patterns = append(schema.Patterns, GlobalKeyPattern{Pattern: pattern, Writers: ids, Observed: observed[pattern]})
+	}
+	sort.Slice(schema.Patterns, func(i, j int) bool { return schema.Patterns[i].Pattern < schema.Patterns[j].Pattern })
+	return schema
+}
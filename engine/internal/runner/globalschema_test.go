@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"testing"
+)
+
+func TestGetGlobalStateSchema(t *testing.T) {
+	r := &Runner{
+		automations: map[string]*Automation{
+			"hallway": {ID: "hallway", Config: AutomationConfig{GlobalStateWrites: []string{"presence.*"}}},
+			"kitchen": {ID: "kitchen", Config: AutomationConfig{GlobalStateWrites: []string{"presence.*", "kitchen.mode"}}},
+		},
+		audit: newAudit(),
+	}
+	r.audit.record("hallway", AuditGlobalWrite, "presence.hallway")
+	r.audit.record("hallway", AuditGlobalWrite, "presence.hallway")
+	r.audit.record("hallway", AuditGlobalDenied, "security.armed")
+	r.audit.record("hallway", AuditGlobalRead, "mode")
+	r.audit.record("kitchen", AuditGlobalWrite, "kitchen.mode")
+	r.audit.record("kitchen", AuditGlobalWrite, "lights.kitchen")  // Pattern since removed from its config
+	r.audit.record("retired", AuditGlobalWrite, "presence.garage") // No longer loaded
+
+	schema := r.GetGlobalStateSchema()
+
+	if len(schema.Patterns) != 2 || schema.Patterns[0].Pattern != "kitchen.mode" || schema.Patterns[1].Pattern != "presence.*" {
+		t.Fatalf("Patterns = %+v", schema.Patterns)
+	}
+	presence := schema.Patterns[1]
+	if len(presence.Writers) != 2 || presence.Writers[0] != "hallway" || presence.Writers[1] != "kitchen" {
+		t.Errorf("presence.* writers = %v", presence.Writers)
+	}
+	if len(presence.Observed) != 1 || presence.Observed[0].Key != "presence.hallway" || presence.Observed[0].Count != 2 {
+		t.Errorf("presence.* observed = %+v", presence.Observed)
+	}
+	if observed := schema.Patterns[0].Observed; len(observed) != 1 || observed[0].AutomationID != "kitchen" {
+		t.Errorf("kitchen.mode observed = %+v", observed)
+	}
+
+	undeclared := map[string]ObservedWrite{}
+	for _, w := range schema.Undeclared {
+		undeclared[w.Key] = w
+	}
+	if len(undeclared) != 3 {
+		t.Fatalf("Undeclared = %+v", schema.Undeclared)
+	}
+	if w := undeclared["security.armed"]; !w.Denied || w.AutomationID != "hallway" {
+		t.Errorf("security.armed = %+v, want a denied write by hallway", w)
+	}
+	if w := undeclared["lights.kitchen"]; w.Denied || w.AutomationID != "kitchen" {
+		t.Errorf("lights.kitchen = %+v", w)
+	}
+	if _, ok := undeclared["presence.garage"]; !ok {
+		t.Error("write by an unloaded automation should be undeclared")
+	}
+}
+
+func TestSetGlobal_DeniedWriteAudited(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "hallway", `
+config = {"name": "Hallway", "global_state_writes": ["presence.*"]}
+
+def on_schedule(ctx):
+    ctx.set_global("security.armed", True)
+`)
+	if _, err := r.RunManual("hallway", ManualTrigger{}); err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+
+	schema := r.GetGlobalStateSchema()
+	if len(schema.Undeclared) != 1 || !schema.Undeclared[0].Denied || schema.Undeclared[0].Key != "security.armed" {
+		t.Errorf("Undeclared = %+v", schema.Undeclared)
+	}
+}
@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// storeGlobal sets a global key in store, or removes it if clear is set, and
+// adds the write to the key's history. It returns the value the key had
+// before. The write itself already succeeded when the history fails, so that
+// is only logged.
+func storeGlobal(store StateBackend, key string, value any, clear bool, at time.Time) (any, error) {
+	old, _ := store.GetGlobalState(key)
+	entry := state.HistoryEntry{Value: value, Time: at}
+	if clear {
+		if err := store.ClearGlobalState(key); err != nil {
+			return old, err
+		}
+		entry = state.HistoryEntry{Time: at, Cleared: true}
+	} else if err := store.SetGlobalState(key, value); err != nil {
+		return old, err
+	}
+	if err := store.RecordGlobalHistory(key, entry); err != nil {
+		slog.Warn("Failed to record history of global key", "key", key, "error", err)
+	}
+	return old, nil
+}
+
+// setGlobal writes a global key on behalf of writer (an automation ID, or
+// who else made the change) and tells on_state_change and the state stream.
+// Every global write goes through here or clearGlobal, and cancels the key's
+// pending expiry.
+func (r *Runner) setGlobal(thread *starlark.Thread, writer, key string, value any) error {
+	return r.writeGlobal(thread, writer, key, value, false)
+}
+
+// clearGlobal removes a global key on behalf of writer, like setGlobal
+func (r *Runner) clearGlobal(thread *starlark.Thread, writer, key string) error {
+	return r.writeGlobal(thread, writer, key, nil, true)
+}
+
+func (r *Runner) writeGlobal(thread *starlark.Thread, writer, key string, value any, clear bool) error {
+	return r.commitGlobal(thread, writer, key, value, clear, true)
+}
+
+// commitGlobal does a global write; without notify the change is streamed
+// but runs no on_state_change
+func (r *Runner) commitGlobal(thread *starlark.Thread, writer, key string, value any, clear, notify bool) error {
+	if r.stateStore == nil {
+		return errors.New("no state store")
+	}
+	if err := r.cancelExpiry(writer, key, true); err != nil {
+		slog.Warn("Failed to cancel expiry of global key", "key", key, "error", err)
+	}
+	old, err := storeGlobal(r.stateStore, key, value, clear, time.Now())
+	if err != nil {
+		return err
+	}
+	r.globalStateChanged(thread, writer, key, old, value, notify)
+	return nil
+}
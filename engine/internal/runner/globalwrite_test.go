@@ -0,0 +1,27 @@
+package runner
+
+import "testing"
+
+func TestWriteGlobal(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	if err := r.setGlobal(nil, "api", "mode", "away"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.clearGlobal(nil, "api", "mode"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.stateStore.GetGlobalState("mode"); v != nil {
+		t.Errorf("mode = %v after clear", v)
+	}
+	history, err := r.stateStore.GetGlobalHistory("mode", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || !history[0].Cleared || history[1].Value != "away" {
+		t.Errorf("history = %+v, want the clear then the write", history)
+	}
+
+	if err := newTestRunner().setGlobal(nil, "api", "mode", "home"); err == nil {
+		t.Error("setGlobal without a store should fail")
+	}
+}
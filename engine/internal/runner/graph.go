@@ -0,0 +1,152 @@
+package runner
+
+import (
+	"sort"
+	"strings"
+)
+
+// Graph node types
+const (
+	NodeAutomation = "automation"
+	NodeTopic      = "topic"
+	NodeGlobal     = "global"
+	NodeDevice     = "device"
+)
+
+// Graph edge types
+const (
+	EdgeSubscribes = "subscribes"
+	EdgePublishes  = "publishes"
+	EdgeReads      = "reads"
+	EdgeWrites     = "writes"
+	EdgeDevice     = "device" // topic belongs to device
+	EdgeCalls      = "calls"  // automation calls another's service
+	EdgeRequires   = "requires"
+)
+
+// GraphNode is an automation, MQTT topic, global state key or device
+type GraphNode struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+}
+
+// GraphEdge connects two nodes. Declared edges come from configs; observed
+// edges come from runtime audit data (with how often they happened).
+type GraphEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Type     string `json:"type"`
+	Declared bool   `json:"declared"`
+	Observed int    `json:"observed"`
+}
+
+// Graph describes how automations interact through topics and global state
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type graphBuilder struct {
+	nodes map[string]GraphNode
+	edges map[string]*GraphEdge
+}
+
+func (b *graphBuilder) node(nodeType, label string) string {
+	id := nodeType + ":" + label
+	if _, ok := b.nodes[id]; !ok {
+		b.nodes[id] = GraphNode{ID: id, Type: nodeType, Label: label}
+	}
+	return id
+}
+
+func (b *graphBuilder) edge(from, to, edgeType string, declared bool, observed int) {
+	key := from + "\x00" + to + "\x00" + edgeType
+	e, ok := b.edges[key]
+	if !ok {
+		e = &GraphEdge{From: from, To: to, Type: edgeType}
+		b.edges[key] = e
+	}
+	e.Declared = e.Declared || declared
+	e.Observed += observed
+}
+
+// topic adds a topic node plus its device node, if one can be derived
+func (b *graphBuilder) topic(topic string) string {
+	id := b.node(NodeTopic, topic)
+	if device := deviceFromTopic(topic); device != "" {
+		b.edge(id, b.node(NodeDevice, device), EdgeDevice, true, 0)
+	}
+	return id
+}
+
+// Graph builds the automation dependency graph from configs and audit data
+func (r *Runner) Graph() Graph {
+	b := &graphBuilder{nodes: map[string]GraphNode{}, edges: map[string]*GraphEdge{}}
+
+	for _, a := range r.ListAutomations() {
+		automation := b.node(NodeAutomation, a.ID)
+		for _, topic := range a.Config.Subscribe {
+			b.edge(automation, b.topic(topic), EdgeSubscribes, true, 0)
+		}
+		for _, pattern := range a.Config.GlobalStateWrites {
+			b.edge(automation, b.node(NodeGlobal, pattern), EdgeWrites, true, 0)
+		}
+		for _, dep := range a.Config.Requires {
+			b.edge(automation, b.node(NodeAutomation, dep), EdgeRequires, true, 0)
+		}
+	}
+
+	for _, entry := range r.GetAudit() {
+		automation := b.node(NodeAutomation, entry.AutomationID)
+		switch entry.Kind {
+		case AuditPublish:
+			b.edge(automation, b.topic(entry.Target), EdgePublishes, false, entry.Count)
+		case AuditGlobalRead:
+			b.edge(b.node(NodeGlobal, entry.Target), automation, EdgeReads, false, entry.Count)
+		case AuditGlobalWrite:
+			b.edge(automation, b.node(NodeGlobal, entry.Target), EdgeWrites, false, entry.Count)
+		case AuditServiceCall:
+			target := entry.Target[:strings.LastIndex(entry.Target, ":")]
+			b.edge(automation, b.node(NodeAutomation, target), EdgeCalls, false, entry.Count)
+		}
+	}
+
+	graph := Graph{
+		Nodes: make([]GraphNode, 0, len(b.nodes)),
+		Edges: make([]GraphEdge, 0, len(b.edges)),
+	}
+	for _, n := range b.nodes {
+		graph.Nodes = append(graph.Nodes, n)
+	}
+	for _, e := range b.edges {
+		graph.Edges = append(graph.Edges, *e)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+	return graph
+}
+
+// deviceFromTopic derives a device name from common topic layouts:
+// zigbee2mqtt/<device>/..., shellies/<device>/..., Tasmota's
+// cmnd|stat|tele/<device>/..., and otherwise the first two levels.
+func deviceFromTopic(topic string) string {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 2 || parts[1] == "" || strings.ContainsAny(parts[0]+parts[1], "+#") {
+		return ""
+	}
+	switch parts[0] {
+	case "cmnd", "stat", "tele":
+		return "tasmota/" + parts[1]
+	case "zigbee2mqtt":
+		if parts[1] == "bridge" {
+			return ""
+		}
+	}
+	return parts[0] + "/" + parts[1]
+}
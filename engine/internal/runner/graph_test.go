@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"testing"
+)
+
+func TestDeviceFromTopic(t *testing.T) {
+	tests := []struct {
+		topic    string
+		expected string
+	}{
+		{"zigbee2mqtt/hallway_light/set", "zigbee2mqtt/hallway_light"},
+		{"zigbee2mqtt/hallway_light", "zigbee2mqtt/hallway_light"},
+		{"zigbee2mqtt/bridge/state", ""},
+		{"cmnd/plug_1/POWER", "tasmota/plug_1"},
+		{"stat/plug_1/RESULT", "tasmota/plug_1"},
+		{"shellies/garage/relay/0", "shellies/garage"},
+		{"zigbee2mqtt/+/state", ""},
+		{"single", ""},
+	}
+
+	for _, tt := range tests {
+		if got := deviceFromTopic(tt.topic); got != tt.expected {
+			t.Errorf("deviceFromTopic(%q) = %q, want %q", tt.topic, got, tt.expected)
+		}
+	}
+}
+
+func findEdge(g Graph, from, to, edgeType string) *GraphEdge {
+	for i, e := range g.Edges {
+		if e.From == from && e.To == to && e.Type == edgeType {
+			return &g.Edges[i]
+		}
+	}
+	return nil
+}
+
+func TestRunnerGraph(t *testing.T) {
+	r := &Runner{
+		automations: map[string]*Automation{
+			"hallway": {ID: "hallway", Config: AutomationConfig{
+				Subscribe:         []string{"zigbee2mqtt/hallway_motion"},
+				GlobalStateWrites: []string{"presence.*"},
+			}},
+		},
+		audit: newAudit(),
+	}
+	r.audit.record("hallway", AuditPublish, "zigbee2mqtt/hallway_light/set")
+	r.audit.record("hallway", AuditPublish, "zigbee2mqtt/hallway_light/set")
+	r.audit.record("hallway", AuditGlobalWrite, "presence.hallway")
+	r.audit.record("night_mode", AuditGlobalRead, "presence.hallway")
+
+	g := r.Graph()
+
+	if e := findEdge(g, "automation:hallway", "topic:zigbee2mqtt/hallway_motion", EdgeSubscribes); e == nil || !e.Declared {
+		t.Error("missing declared subscribes edge")
+	}
+	if e := findEdge(g, "automation:hallway", "topic:zigbee2mqtt/hallway_light/set", EdgePublishes); e == nil || e.Observed != 2 {
+		t.Errorf("publishes edge = %+v, want observed 2", e)
+	}
+	if e := findEdge(g, "topic:zigbee2mqtt/hallway_light/set", "device:zigbee2mqtt/hallway_light", EdgeDevice); e == nil {
+		t.Error("missing topic -> device edge")
+	}
+	if e := findEdge(g, "automation:hallway", "global:presence.*", EdgeWrites); e == nil || !e.Declared {
+		t.Error("missing declared writes edge")
+	}
+	if e := findEdge(g, "global:presence.hallway", "automation:night_mode", EdgeReads); e == nil || e.Observed != 1 {
+		t.Errorf("reads edge = %+v, want observed 1", e)
+	}
+}
@@ -0,0 +1,255 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+const (
+	defaultHTTPTimeout = 10 * time.Second
+	maxHTTPTimeout     = 60 * time.Second
+
+	// maxHTTPResponse caps how much of a response body is read into Starlark
+	maxHTTPResponse = 1 << 20
+)
+
+// newHTTPClient returns the client behind ctx.http_*. Redirects are followed
+// only to hosts the calling automation may reach.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			allow, _ := req.Context().Value(httpAllowKey{}).([]string)
+			if !hostAllowed(allow, req.URL) {
+				return fmt.Errorf("redirect to %s is not in http_allow", req.URL.Host)
+			}
+			return nil
+		},
+	}
+}
+
+// httpAllowKey carries the automation's allowlist on the request context so
+// CheckRedirect can apply it
+type httpAllowKey struct{}
+
+// hostAllowed reports whether u's host matches an http_allow entry. Entries are
+// hosts ("api.example.com"), host:port pairs ("192.168.1.50:8080") or
+// subdomain wildcards ("*.example.com"). Entries without a port allow any port.
+func hostAllowed(allow []string, u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	for _, entry := range allow {
+		entry = strings.ToLower(entry)
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		if strings.HasPrefix(entryHost, "*.") {
+			if strings.HasSuffix(host, entryHost[1:]) {
+				return true
+			}
+			continue
+		}
+		if entryHost == host {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Context) httpGet(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var rawURL string
+	var headers *starlark.Dict
+	timeout := starlark.Value(starlark.None)
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "url", &rawURL, "headers?", &headers, "timeout?", &timeout); err != nil {
+		return nil, err
+	}
+	return c.doHTTP(thread, fn.Name(), http.MethodGet, rawURL, headers, nil, timeout, "")
+}
+
+func (c *Context) httpPost(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var rawURL, idempotencyKey string
+	var body starlark.Value = starlark.String("")
+	var headers *starlark.Dict
+	timeout := starlark.Value(starlark.None)
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "url", &rawURL, "body?", &body, "headers?", &headers, "timeout?", &timeout, "idempotency_key?", &idempotencyKey); err != nil {
+		return nil, err
+	}
+	return c.doHTTP(thread, fn.Name(), http.MethodPost, rawURL, headers, body, timeout, idempotencyKey)
+}
+
+func (c *Context) httpRequest(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var method, rawURL, idempotencyKey string
+	var body starlark.Value = starlark.String("")
+	var headers *starlark.Dict
+	timeout := starlark.Value(starlark.None)
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "method", &method, "url", &rawURL, "headers?", &headers, "body?", &body, "timeout?", &timeout, "idempotency_key?", &idempotencyKey); err != nil {
+		return nil, err
+	}
+	return c.doHTTP(thread, fn.Name(), strings.ToUpper(method), rawURL, headers, body, timeout, idempotencyKey)
+}
+
+// doHTTP performs a request and returns the response struct. Problems with
+// the call itself (bad URL, host not allowed) are Starlark errors; network
+// failures return a response with status 0 and error set. Repeats of an
+// idempotency_key get the first call's response without a new request.
+func (c *Context) doHTTP(thread *starlark.Thread, name, method, rawURL string, headers *starlark.Dict, body, timeoutVal starlark.Value, idempotencyKey string) (starlark.Value, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%s: invalid URL %q", name, rawURL)
+	}
+	if !hostAllowed(c.httpAllow, u) {
+		return nil, fmt.Errorf("%s: host %s is not in this automation's http_allow list", name, u.Host)
+	}
+
+	timeout := defaultHTTPTimeout
+	if timeoutVal != nil && timeoutVal != starlark.None {
+		seconds, ok := starlark.AsFloat(timeoutVal)
+		if !ok || seconds <= 0 {
+			return nil, fmt.Errorf("%s: timeout must be a positive number of seconds", name)
+		}
+		timeout = min(time.Duration(seconds*float64(time.Second)), maxHTTPTimeout)
+	}
+
+	var payload []byte
+	switch v := body.(type) {
+	case nil, starlark.NoneType:
+	case starlark.String:
+		payload = []byte(v)
+	case starlark.Bytes:
+		payload = []byte(v)
+	default:
+		return nil, fmt.Errorf("%s: body must be string or bytes, got %s", name, body.Type())
+	}
+
+	header := make(http.Header)
+	if headers != nil {
+		for _, item := range headers.Items() {
+			k, kok := item[0].(starlark.String)
+			v, vok := item[1].(starlark.String)
+			if !kok || !vok {
+				return nil, fmt.Errorf("%s: headers must map strings to strings", name)
+			}
+			header.Set(string(k), string(v))
+		}
+	}
+
+	if c.httpClient == nil {
+		return httpResponse(0, "", nil, "http is not available in dry runs"), nil
+	}
+
+	cacheKey, cached, ok := c.claimIdempotent(name, idempotencyKey)
+	if !ok {
+		if first, ok := cached.(httpResult); ok {
+			return first.value(), nil
+		}
+		return httpResponse(0, "", nil, "duplicate of a request that has not completed"), nil
+	}
+
+	// send builds a fresh request each time so failed calls can be retried
+	send := func(handle func(*http.Response) error) error {
+		reqCtx, cancel := context.WithTimeout(context.WithValue(context.Background(), httpAllowKey{}, c.httpAllow), timeout)
+		defer cancel()
+		var reader io.Reader
+		if payload != nil {
+			reader = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(reqCtx, method, u.String(), reader)
+		if err != nil {
+			return err
+		}
+		req.Header = header.Clone()
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return handle(resp)
+	}
+
+	var result httpResult
+	err = send(func(resp *http.Response) error {
+		result = httpResult{status: resp.StatusCode, header: resp.Header}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponse))
+		if err != nil {
+			result.err = err.Error()
+			return nil
+		}
+		result.body = string(data)
+		return nil
+	})
+	if err != nil {
+		action := redactSecrets(thread, fmt.Sprintf("%s %s %s", name, method, u.Redacted()))
+		retrying := c.retryLater(thread, action, cacheKey, func() error {
+			return send(func(*http.Response) error { return nil })
+		})
+		msg := redactSecrets(thread, fmt.Sprintf("ERROR: %s: %s", action, err))
+		if retrying {
+			msg += " (retrying)"
+		} else {
+			c.releaseIdempotent(cacheKey)
+		}
+		c.logFunc(c.automationID, LogLevelError, msg)
+		return httpResponse(0, "", nil, err.Error()), nil
+	}
+	if cacheKey != "" {
+		c.idempotency.store(cacheKey, result)
+	}
+	return result.value(), nil
+}
+
+// httpResult is a completed response, kept for idempotent repeats
+type httpResult struct {
+	status int
+	body   string
+	header http.Header
+	err    string
+}
+
+func (r httpResult) value() starlark.Value {
+	return httpResponse(r.status, r.body, r.header, r.err)
+}
+
+// httpResponse builds the struct returned by ctx.http_*:
+// status, ok (2xx), body, headers (lower-case names), error and json()
+func httpResponse(status int, body string, header http.Header, errMsg string) *starlarkstruct.Struct {
+	headers := starlark.NewDict(len(header))
+	for k := range header {
+		headers.SetKey(starlark.String(strings.ToLower(k)), starlark.String(header.Get(k)))
+	}
+	decode := func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+			return nil, err
+		}
+		var v any
+		if err := json.Unmarshal([]byte(body), &v); err != nil {
+			return nil, fmt.Errorf("json: %w", err)
+		}
+		return goToStarlark(v), nil
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"status":  starlark.MakeInt(status),
+		"ok":      starlark.Bool(status >= 200 && status < 300),
+		"body":    starlark.String(body),
+		"headers": headers,
+		"error":   starlark.String(errMsg),
+		"json":    starlark.NewBuiltin("json", decode),
+	})
+}
@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+func TestHostAllowed(t *testing.T) {
+	allow := []string{"api.open-meteo.com", "*.example.com", "192.168.1.50:8080"}
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://api.open-meteo.com/v1/forecast", true},
+		{"https://API.Open-Meteo.com:443/v1", true},
+		{"https://weather.example.com/x", true},
+		{"https://example.com/x", false},
+		{"https://evilexample.com/x", false},
+		{"http://192.168.1.50:8080/status", true},
+		{"http://192.168.1.50/status", false},
+		{"http://192.168.1.51:8080/status", false},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := hostAllowed(allow, u); got != tt.expected {
+			t.Errorf("hostAllowed(%s) = %v, want %v", tt.url, got, tt.expected)
+		}
+	}
+}
+
+// runHTTPScript calls run(ctx) with a context allowed to reach the test server
+func runHTTPScript(t *testing.T, allow []string, src string) (starlark.Value, error) {
+	t.Helper()
+	ctx := NewContext("weather", nil, nil, func(string, string, string) {}, nil, nil)
+	ctx.httpClient = newHTTPClient()
+	ctx.httpAllow = allow
+
+	globals, err := starlark.ExecFile(&starlark.Thread{Name: "test"}, "test.star", src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return starlark.Call(&starlark.Thread{Name: "test"}, globals["run"], starlark.Tuple{ctx.ToStarlark(Trigger{Time: time.Now()})}, nil)
+}
+
+func TestHTTPBuiltins(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/weather":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"temperature": 21.5, "auth": "`+req.Header.Get("Authorization")+`"}`)
+		case "/echo":
+			body, _ := io.ReadAll(req.Body)
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, req.Method+" "+string(body))
+		case "/elsewhere":
+			http.Redirect(w, req, "http://not-allowed.invalid/", http.StatusFound)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	result, err := runHTTPScript(t, []string{host}, `
+def run(ctx):
+    r = ctx.http_get("`+server.URL+`/weather", headers = {"Authorization": "Bearer abc"})
+    p = ctx.http_post("`+server.URL+`/echo", body = "hello")
+    put = ctx.http_request("put", "`+server.URL+`/echo", body = "x", timeout = 2)
+    missing = ctx.http_get("`+server.URL+`/missing")
+    redirect = ctx.http_get("`+server.URL+`/elsewhere")
+    return [r.status, r.ok, r.json()["temperature"], r.json()["auth"], r.headers["content-type"],
+            p.status, p.body, put.body, missing.status, missing.ok, redirect.status, "http_allow" in redirect.error]
+`)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	want := `[200, True, 21.5, "Bearer abc", "application/json", 201, "POST hello", "PUT x", 404, False, 0, True]`
+	if result.String() != want {
+		t.Errorf("result = %s\nwant     %s", result, want)
+	}
+}
+
+func TestHTTPBuiltins_RejectsHostsOutsideAllowlist(t *testing.T) {
+	_, err := runHTTPScript(t, []string{"api.open-meteo.com"}, `
+def run(ctx):
+    return ctx.http_get("https://example.com/")
+`)
+	if err == nil || !strings.Contains(err.Error(), "http_allow") {
+		t.Errorf("error = %v, want http_allow rejection", err)
+	}
+
+	_, err = runHTTPScript(t, nil, `
+def run(ctx):
+    return ctx.http_get("file:///etc/passwd")
+`)
+	if err == nil || !strings.Contains(err.Error(), "invalid URL") {
+		t.Errorf("error = %v, want invalid URL", err)
+	}
+}
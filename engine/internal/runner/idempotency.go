@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// idempotencyWindow is how long an idempotency_key suppresses repeats
+const idempotencyWindow = 10 * time.Minute
+
+// idempotencyCache remembers side effects performed with an idempotency_key so
+// that repeats within the window (QoS 1 redeliveries, re-run handlers) are
+// skipped instead of sent twice
+type idempotencyCache struct {
+	mu        sync.Mutex
+	window    time.Duration
+	entries   map[string]idempotencyEntry
+	lastSweep time.Time
+}
+
+type idempotencyEntry struct {
+	expires time.Time
+	result  any // What the first call produced, for builtins that return data
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	return &idempotencyCache{window: window, entries: make(map[string]idempotencyEntry)}
+}
+
+// claim reserves key. It returns true if the key is unused within the window;
+// otherwise it returns false and the result stored by the first call.
+func (c *idempotencyCache) claim(key string, now time.Time) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.lastSweep) >= time.Minute {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	if entry, ok := c.entries[key]; ok && now.Before(entry.expires) {
+		return entry.result, false
+	}
+	c.entries[key] = idempotencyEntry{expires: now.Add(c.window)}
+	return nil, true
+}
+
+// store keeps the result of a claimed call for later duplicates
+func (c *idempotencyCache) store(key string, result any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok {
+		entry.result = result
+		c.entries[key] = entry
+	}
+}
+
+// release frees a key whose side effect failed, so a later attempt can run
+func (c *idempotencyCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// claimIdempotent checks a builtin's idempotency_key. It returns the cache key
+// to store or release (empty when no key was given) and false if the call is
+// a duplicate, along with the first call's result.
+func (c *Context) claimIdempotent(builtin, key string) (string, any, bool) {
+	if key == "" || c.idempotency == nil {
+		return "", nil, true
+	}
+	cacheKey := c.automationID + "\x00" + builtin + "\x00" + key
+	result, ok := c.idempotency.claim(cacheKey, time.Now())
+	if !ok {
+		c.logFunc(c.automationID, LogLevelInfo, fmt.Sprintf("%s skipped: idempotency_key %q was already used", builtin, key))
+	}
+	return cacheKey, result, ok
+}
+
+// releaseIdempotent frees a claimed key after a failed call
+func (c *Context) releaseIdempotent(cacheKey string) {
+	if cacheKey != "" {
+		c.idempotency.release(cacheKey)
+	}
+}
@@ -0,0 +1,146 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+func TestIdempotencyCache(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute)
+	now := time.Now()
+
+	if _, ok := cache.claim("a", now); !ok {
+		t.Fatal("first claim should succeed")
+	}
+	cache.store("a", 42)
+	if result, ok := cache.claim("a", now.Add(30*time.Second)); ok || result != 42 {
+		t.Errorf("repeat within window = %v, %v; want stored result and false", result, ok)
+	}
+	if _, ok := cache.claim("a", now.Add(time.Minute)); !ok {
+		t.Error("claim after the window should succeed")
+	}
+
+	cache.claim("b", now)
+	cache.release("b")
+	if _, ok := cache.claim("b", now); !ok {
+		t.Error("released key should be claimable")
+	}
+}
+
+func TestIdempotentPublish(t *testing.T) {
+	r := newTestRunner()
+	a := addTestAutomation(t, r, "doorbell", `
+config = {"name": "Doorbell", "subscribe": ["doorbell/ring"]}
+
+def on_message(topic, payload, ctx):
+    return ctx.publish("chime/play", "ding", idempotency_key = payload)
+`)
+	publisher := &flakyPublisher{failures: 1}
+	a.context.mqttClient = publisher
+	a.context.idempotency = newIdempotencyCache(time.Minute)
+
+	// The failed first publish must not use up the key; the redelivery after
+	// it is sent and the one after that is skipped
+	want := []any{false, true, true}
+	for i, result := range want {
+		record, _ := r.handleMessage(a, Trigger{Type: TriggerMQTT, Time: time.Now()}, []byte("ring-1"))
+		if record.Result != result {
+			t.Errorf("delivery %d returned %v, want %v", i+1, record.Result, result)
+		}
+	}
+	if publisher.calls != 2 {
+		t.Errorf("publisher called %d times, want 2", publisher.calls)
+	}
+
+	r.handleMessage(a, Trigger{Type: TriggerMQTT, Time: time.Now()}, []byte("ring-2"))
+	if publisher.calls != 3 {
+		t.Errorf("a new key should publish again, calls = %d", publisher.calls)
+	}
+}
+
+func TestIdempotentPublish_RetriesExhausted(t *testing.T) {
+	r := newTestRunner()
+	a := addTestAutomation(t, r, "doorbell", `
+config = {"name": "Doorbell", "subscribe": ["doorbell/ring"], "retry": {"attempts": 2, "backoff": "5ms"}}
+
+def on_message(topic, payload, ctx):
+    return ctx.publish("chime/play", "ding", idempotency_key = payload)
+`)
+	a.context.mqttClient = &flakyPublisher{failures: 10}
+	a.context.idempotency = newIdempotencyCache(time.Minute)
+	a.context.retry = func(runID, action string, attempt func() error, gaveUp func()) {
+		r.retrySideEffect(context.Background(), "doorbell", runID, *a.Config.Retry, action, attempt, gaveUp)
+	}
+
+	r.handleMessage(a, Trigger{Type: TriggerMQTT, Time: time.Now()}, []byte("ring-1"))
+	waitFor(t, "the retry to give up", func() bool {
+		runs := r.GetRuns("doorbell")
+		return len(runs) == 1 && len(runs[0].Retries) == 1
+	})
+
+	// The key is free again, so the redelivery publishes (and fails) instead
+	// of being skipped as a duplicate
+	if record, _ := r.handleMessage(a, Trigger{Type: TriggerMQTT, Time: time.Now()}, []byte("ring-1")); record.Result != false {
+		t.Errorf("redelivery returned %v, want False from a new attempt", record.Result)
+	}
+}
+
+func TestIdempotentHTTPPost(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := requests.Add(1)
+		fmt.Fprintf(w, "request %d", n)
+	}))
+	defer server.Close()
+
+	ctx := NewContext("webhook", nil, nil, func(string, string, string) {}, nil, nil)
+	ctx.httpClient = newHTTPClient()
+	ctx.httpAllow = []string{strings.TrimPrefix(server.URL, "http://")}
+	ctx.idempotency = newIdempotencyCache(time.Minute)
+
+	globals, err := starlark.ExecFile(&starlark.Thread{Name: "test"}, "test.star", `
+def run(ctx):
+    first = ctx.http_post("`+server.URL+`", body = "x", idempotency_key = "order-7")
+    repeat = ctx.http_post("`+server.URL+`", body = "x", idempotency_key = "order-7")
+    other = ctx.http_post("`+server.URL+`", body = "x", idempotency_key = "order-8")
+    return [first.body, repeat.body, other.body]
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := starlark.Call(&starlark.Thread{Name: "test"}, globals["run"], starlark.Tuple{ctx.ToStarlark(Trigger{Time: time.Now()})}, nil)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if want := `["request 1", "request 1", "request 2"]`; result.String() != want {
+		t.Errorf("result = %s, want %s", result, want)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("server saw %d requests, want 2", requests.Load())
+	}
+}
+
+func TestDryRun_SkipsRepeatedIdempotencyKeys(t *testing.T) {
+	r := newTestRunner()
+	result, err := r.DryRun(DryRunRequest{Code: `
+def on_schedule(ctx):
+    for i in range(3):
+        ctx.notify("Leak", "Water detected", idempotency_key = "leak")
+
+config = {"name": "Leak"}
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || len(result.Notifications) != 1 {
+		t.Errorf("notifications = %+v (error %q), want 1", result.Notifications, result.Error)
+	}
+}
@@ -0,0 +1,354 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+const (
+	// maxJobWorkers bounds how many background jobs run at once; more wait queued
+	maxJobWorkers = 2
+
+	// maxJobs bounds how many finished jobs are kept for the API
+	maxJobs = 100
+
+	// jobTimeout cancels jobs that run longer; handler timeouts don't apply to jobs
+	jobTimeout = 6 * time.Hour
+
+	// threadLocalJob holds the *job a thread runs, for ctx.job.progress
+	threadLocalJob = "homebrain.job"
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+var (
+	// ErrJobNotFound is returned for operations on unknown job IDs
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrJobFinished is returned when cancelling a job that already ended
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// Job is a Starlark function started with ctx.job.start, running on the
+// background workers instead of the handler pools
+type Job struct {
+	ID           string     `json:"id"`
+	AutomationID string     `json:"automation_id"`
+	Name         string     `json:"name"`
+	Function     string     `json:"function"`
+	Status       string     `json:"status"`
+	Progress     float64    `json:"progress"` // 0 to 1, as reported by ctx.job.progress
+	Result       any        `json:"result,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	Created      time.Time  `json:"created"`
+	Started      *time.Time `json:"started,omitempty"`
+	Finished     *time.Time `json:"finished,omitempty"`
+}
+
+func (j *Job) active() bool {
+	return j.Status == JobQueued || j.Status == JobRunning
+}
+
+type job struct {
+	Job
+	queue  *jobQueue
+	cancel chan struct{} // Closed to cancel the job
+	thread *starlark.Thread
+}
+
+// jobQueue holds background jobs, oldest first
+type jobQueue struct {
+	mu    sync.Mutex
+	list  []*job
+	slots chan struct{}
+}
+
+// StartJob runs fnName, a top-level function of the automation, in the
+// background as fn(data, ctx). Only one job per automation and name may be
+// queued or running at a time.
+func (r *Runner) StartJob(automationID, name, fnName string, data any) (string, error) {
+	automation, err := r.lookup(automationID)
+	if err != nil {
+		return "", err
+	}
+	fn, ok := automation.globals[fnName].(starlark.Callable)
+	if !ok {
+		return "", fmt.Errorf("%s has no function %s", automationID, fnName)
+	}
+
+	now := time.Now()
+	j := &job{
+		Job: Job{
+			ID:           fmt.Sprintf("%s-%s-%d", automationID, name, now.UnixNano()),
+			AutomationID: automationID,
+			Name:         name,
+			Function:     fnName,
+			Status:       JobQueued,
+			Created:      now,
+		},
+		queue:  &r.jobs,
+		cancel: make(chan struct{}),
+	}
+
+	r.jobs.mu.Lock()
+	for _, other := range r.jobs.list {
+		if other.AutomationID == automationID && other.Name == name && other.active() {
+			r.jobs.mu.Unlock()
+			return "", fmt.Errorf("job %s is already %s", name, other.Status)
+		}
+	}
+	if r.jobs.slots == nil {
+		r.jobs.slots = make(chan struct{}, maxJobWorkers)
+	}
+	r.jobs.list = append(r.jobs.list, j)
+	r.pruneJobs()
+	slots := r.jobs.slots
+	r.jobs.mu.Unlock()
+
+	go r.runJob(automation, j, fn, data, slots)
+	return j.ID, nil
+}
+
+// pruneJobs drops the oldest finished jobs beyond maxJobs; callers hold jobs.mu
+func (r *Runner) pruneJobs() {
+	excess := len(r.jobs.list) - maxJobs
+	if excess <= 0 {
+		return
+	}
+	kept := r.jobs.list[:0]
+	for _, j := range r.jobs.list {
+		if excess > 0 && !j.active() {
+			excess--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	r.jobs.list = kept
+}
+
+func (r *Runner) runJob(automation *Automation, j *job, fn starlark.Callable, data any, slots chan struct{}) {
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-j.cancel:
+		r.finishJob(j, nil, nil)
+		return
+	}
+
+	thread := &starlark.Thread{Name: automation.ID}
+	thread.SetLocal(threadLocalJob, j)
+	thread.SetLocal(threadLocalRunID, j.ID)
+	thread.SetLocal(threadLocalPriority, automation.Config.Priority)
+
+	// The run context ends when the job is cancelled or the automation unloaded
+	base := context.Background()
+	if automation.done != nil {
+		base = automation.done
+	}
+	runCtx, cancelRun := context.WithCancel(base)
+	defer cancelRun()
+	go func() {
+		select {
+		case <-j.cancel:
+			cancelRun()
+		case <-runCtx.Done():
+		}
+	}()
+	thread.SetLocal(threadLocalContext, runCtx)
+
+	r.jobs.mu.Lock()
+	select {
+	case <-j.cancel:
+		r.jobs.mu.Unlock()
+		r.finishJob(j, nil, nil)
+		return
+	default:
+	}
+	started := time.Now()
+	j.Status = JobRunning
+	j.Started = &started
+	j.thread = thread
+	r.jobs.mu.Unlock()
+
+	slog.Info("Job started", "automation", automation.ID, "job", j.Name, "function", j.Function)
+	trigger := Trigger{Type: TriggerJob, Time: started}
+	timedOut := cancelAfter(thread, jobTimeout)
+	result, err := starlark.Call(thread, fn, starlark.Tuple{goToStarlark(data), automation.context.ToStarlark(trigger)}, nil)
+	if timedOut() && err != nil {
+		err = fmt.Errorf("job %s %w after %s", j.Name, errHandlerTimeout, jobTimeout)
+	}
+	r.finishJob(j, result, err)
+}
+
+// finishJob records how a job ended
+func (r *Runner) finishJob(j *job, result starlark.Value, err error) {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+
+	finished := time.Now()
+	j.Finished = &finished
+	j.thread = nil
+	select {
+	case <-j.cancel:
+		j.Status = JobCancelled
+		slog.Info("Job cancelled", "automation", j.AutomationID, "job", j.Name)
+		return
+	default:
+	}
+	if err != nil {
+		j.Status = JobFailed
+		j.Error = err.Error()
+		slog.Error("Job failed", "automation", j.AutomationID, "job", j.Name, "error", err)
+		r.addLog(j.AutomationID, LogLevelError, fmt.Sprintf("ERROR: job %s: %s", j.Name, err))
+		return
+	}
+	j.Status = JobSucceeded
+	j.Progress = 1
+	if result != nil && result != starlark.None {
+		j.Result = starlarkToGo(result)
+	}
+	slog.Info("Job finished", "automation", j.AutomationID, "job", j.Name)
+}
+
+// CancelJob stops a queued or running job
+func (r *Runner) CancelJob(id string) error {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	for _, j := range r.jobs.list {
+		if j.ID == id {
+			if !j.active() {
+				return ErrJobFinished
+			}
+			r.cancelJobLocked(j)
+			return nil
+		}
+	}
+	return ErrJobNotFound
+}
+
+// cancelJobs stops an automation's active jobs, all of them if name is empty,
+// and reports whether any was cancelled
+func (r *Runner) cancelJobs(automationID, name string) bool {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	cancelled := false
+	for _, j := range r.jobs.list {
+		if j.AutomationID == automationID && (name == "" || j.Name == name) && j.active() {
+			r.cancelJobLocked(j)
+			cancelled = true
+		}
+	}
+	return cancelled
+}
+
+func (r *Runner) cancelJobLocked(j *job) {
+	select {
+	case <-j.cancel:
+		return
+	default:
+	}
+	close(j.cancel)
+	if j.thread != nil {
+		j.thread.Cancel("job cancelled")
+	}
+}
+
+// GetJobs returns all kept jobs, newest first
+func (r *Runner) GetJobs() []Job {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	result := make([]Job, 0, len(r.jobs.list))
+	for i := len(r.jobs.list) - 1; i >= 0; i-- {
+		result = append(result, r.jobs.list[i].Job)
+	}
+	return result
+}
+
+// GetJob returns one job by ID
+func (r *Runner) GetJob(id string) (Job, error) {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	for _, j := range r.jobs.list {
+		if j.ID == id {
+			return j.Job, nil
+		}
+	}
+	return Job{}, ErrJobNotFound
+}
+
+// jobModule builds ctx.job
+func (c *Context) jobModule() *starlarkstruct.Struct {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"start":    starlark.NewBuiltin("job.start", c.jobStart),
+		"progress": starlark.NewBuiltin("job.progress", c.jobProgress),
+		"cancel":   starlark.NewBuiltin("job.cancel", c.jobCancel),
+	})
+}
+
+// jobStart implements ctx.job.start(name, fn_name, data=None); it returns the
+// job ID, or None if the job could not be started
+func (c *Context) jobStart(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, fnName string
+	var data starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "fn_name", &fnName, "data?", &data); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%s: name must not be empty", fn.Name())
+	}
+	if c.startJob == nil {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	id, err := c.startJob(name, fnName, starlarkToGo(data))
+	if err != nil {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: %s", fn.Name(), name, err))
+		return starlark.None, nil
+	}
+	return starlark.String(id), nil
+}
+
+// jobProgress implements ctx.job.progress(p), p being 0 to 1
+func (c *Context) jobProgress(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var value starlark.Value
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "p", &value); err != nil {
+		return nil, err
+	}
+	p, ok := starlark.AsFloat(value)
+	if !ok || p < 0 || p > 1 {
+		return nil, fmt.Errorf("%s: p must be a number from 0 to 1", fn.Name())
+	}
+	j, _ := thread.Local(threadLocalJob).(*job)
+	if j == nil {
+		return nil, fmt.Errorf("%s: only available inside a job", fn.Name())
+	}
+	j.queue.mu.Lock()
+	j.Progress = p
+	j.queue.mu.Unlock()
+	return starlark.None, nil
+}
+
+// jobCancel implements ctx.job.cancel(name); True if a queued or running job was cancelled
+func (c *Context) jobCancel(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+	if c.cancelJob == nil {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	return starlark.Bool(c.cancelJob(name)), nil
+}
@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForJob polls until job id has left the queued/running states
+func waitForJob(t *testing.T, r *Runner, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, err := r.GetJob(id); err == nil && !job.active() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for job %s", id)
+	return Job{}
+}
+
+const testJobAutomation = `
+def crunch(data, ctx):
+    total = 0
+    for i, v in enumerate(data["values"]):
+        total += v
+        ctx.job.progress((i + 1) / len(data["values"]))
+    return total
+
+def spin(data, ctx):
+    ctx.job.progress(0.5)
+    for i in range(100000000):
+        pass
+
+def on_message(topic, payload, ctx):
+    return ctx.job.start(payload, payload, {"values": [1, 2, 3, 4]})
+
+config = {"name": "Energy Report", "subscribe": ["energy/report"]}
+`
+
+func TestJobs(t *testing.T) {
+	r := newTestRunner()
+	a := addTestAutomation(t, r, "energy", testJobAutomation)
+	a.context.startJob = func(name, fnName string, data any) (string, error) {
+		return r.StartJob("energy", name, fnName, data)
+	}
+
+	run, err := r.handleMessage(a, Trigger{Type: TriggerMQTT, Topic: "energy/report"}, []byte("crunch"))
+	if err != nil {
+		t.Fatalf("handler failed: %v", err)
+	}
+	id, _ := run.Result.(string)
+	job := waitForJob(t, r, id)
+	if job.Status != JobSucceeded || job.Result != int64(10) || job.Progress != 1 || job.Function != "crunch" {
+		t.Errorf("job = %+v", job)
+	}
+
+	if _, err := r.StartJob("energy", "report", "missing", nil); err == nil {
+		t.Error("StartJob with an unknown function should fail")
+	}
+
+	id, err = r.StartJob("energy", "spin", "spin", nil)
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	if _, err := r.StartJob("energy", "spin", "spin", nil); err == nil {
+		t.Error("a second job with the same name should be rejected while the first runs")
+	}
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if job, _ := r.GetJob(id); job.Progress == 0.5 {
+			break
+		}
+	}
+	if err := r.CancelJob(id); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+	if job := waitForJob(t, r, id); job.Status != JobCancelled || job.Progress != 0.5 {
+		t.Errorf("cancelled job = %+v", job)
+	}
+	if err := r.CancelJob(id); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("CancelJob of finished job = %v, want ErrJobFinished", err)
+	}
+	if err := r.CancelJob("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("CancelJob of unknown job = %v, want ErrJobNotFound", err)
+	}
+
+	if jobs := r.GetJobs(); len(jobs) != 2 || jobs[0].ID != id {
+		t.Errorf("GetJobs() = %+v, want newest first", jobs)
+	}
+}
+
+func TestJobProgress_OutsideJob(t *testing.T) {
+	r := newTestRunner()
+	result, err := r.DryRun(DryRunRequest{AutomationID: "energy", Code: `
+def crunch(data, ctx):
+    pass
+
+def on_message(topic, payload, ctx):
+    ctx.job.start("report", "crunch", {"day": "2026-03-01"})
+    ctx.job.progress(0.5)
+
+config = {"name": "Energy Report", "subscribe": ["energy/report"]}
+`, Payload: "{}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success {
+		t.Error("ctx.job.progress outside a job should fail")
+	}
+	if len(result.Jobs) != 1 || result.Jobs[0].Function != "crunch" {
+		t.Errorf("recorded jobs = %+v", result.Jobs)
+	}
+}
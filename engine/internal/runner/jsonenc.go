@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"go.starlark.net/starlark"
+)
+
+// rawJSON is JSON text that json_encode embeds verbatim (from ctx.json_raw)
+type rawJSON string
+
+var _ starlark.Value = rawJSON("")
+
+func (r rawJSON) String() string        { return string(r) }
+func (r rawJSON) Type() string          { return "json_raw" }
+func (r rawJSON) Freeze()               {}
+func (r rawJSON) Truth() starlark.Bool  { return len(r) > 0 }
+func (r rawJSON) Hash() (uint32, error) { return starlark.String(r).Hash() }
+
+// encodeJSON encodes a Starlark value as JSON. Integers keep full precision;
+// floats use the shortest exact representation, or exactly precision decimals
+// when precision >= 0. Dict keys are sorted, matching encoding/json, but
+// strings are not HTML-escaped.
+func encodeJSON(buf *bytes.Buffer, val starlark.Value, precision int) error {
+	switch v := val.(type) {
+	case starlark.NoneType:
+		buf.WriteString("null")
+	case starlark.Bool:
+		buf.WriteString(strconv.FormatBool(bool(v)))
+	case starlark.Int:
+		buf.WriteString(v.String())
+	case starlark.Float:
+		if precision >= 0 {
+			buf.WriteString(strconv.FormatFloat(float64(v), 'f', precision, 64))
+			return nil
+		}
+		data, err := json.Marshal(float64(v))
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	case rawJSON:
+		buf.WriteString(string(v))
+	case *starlark.List:
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSON(buf, v.Index(i), precision); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case *starlark.Dict:
+		items := v.Items()
+		keyed := make([]starlark.Tuple, 0, len(items))
+		for _, item := range items {
+			if _, ok := item[0].(starlark.String); ok {
+				keyed = append(keyed, item)
+			}
+		}
+		sort.Slice(keyed, func(i, j int) bool {
+			return string(keyed[i][0].(starlark.String)) < string(keyed[j][0].(starlark.String))
+		})
+
+		buf.WriteByte('{')
+		for i, item := range keyed {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, string(item[0].(starlark.String)))
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, item[1], precision); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case starlark.String:
+		writeJSONString(buf, string(v))
+	default:
+		writeJSONString(buf, v.String())
+	}
+	return nil
+}
+
+// writeJSONString writes a JSON string without encoding/json's HTML escaping,
+// so characters like < and & reach devices unchanged
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // Encode appends a newline
+}
+
+// parseRawJSON validates text for ctx.json_raw
+func parseRawJSON(text string) (rawJSON, error) {
+	if !json.Valid([]byte(text)) {
+		return "", fmt.Errorf("json_raw: %q is not valid JSON", text)
+	}
+	return rawJSON(text), nil
+}
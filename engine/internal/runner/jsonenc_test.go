@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestJSONEncode(t *testing.T) {
+	c := &Context{}
+	predeclared := starlark.StringDict{
+		"json_encode": starlark.NewBuiltin("json_encode", c.jsonEncode),
+		"json_raw":    starlark.NewBuiltin("json_raw", c.jsonRaw),
+	}
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{`json_encode({"b": 1, "a": "x"})`, `{"a":"x","b":1}`},
+		{`json_encode(1.0)`, `1`},
+		{`json_encode(0.1 + 0.2)`, `0.30000000000000004`},
+		{`json_encode(1.0, precision=1)`, `1.0`},
+		{`json_encode({"temp": 21.456, "n": 3}, precision=2)`, `{"n":3,"temp":21.46}`},
+		{`json_encode(12345678901234567890)`, `12345678901234567890`},
+		{`json_encode({"brightness": json_raw("254.00")})`, `{"brightness":254.00}`},
+		{`json_encode([None, True, "<tag>"])`, `[null,true,"<tag>"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			val, err := starlark.Eval(&starlark.Thread{}, "test", tt.expr, predeclared)
+			if err != nil {
+				t.Fatalf("eval failed: %v", err)
+			}
+			if got := string(val.(starlark.String)); got != tt.expected {
+				t.Errorf("got %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestJSONRaw_RejectsInvalidJSON(t *testing.T) {
+	if _, err := parseRawJSON("21.5.0"); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestPublish_PassesPayloadThrough(t *testing.T) {
+	published := &publishRecorder{}
+	c := NewContext("test", published, nil, func(string, string, string) {}, nil, nil)
+	predeclared := starlark.StringDict{"publish": starlark.NewBuiltin("publish", c.publish)}
+
+	for _, expr := range []string{`publish("a", "1.0")`, `publish("b", b"\x00\xff")`} {
+		if _, err := starlark.Eval(&starlark.Thread{}, "test", expr, predeclared); err != nil {
+			t.Fatalf("%s failed: %v", expr, err)
+		}
+	}
+	if _, err := starlark.Eval(&starlark.Thread{}, "test", `publish("c", 1.0)`, predeclared); err == nil {
+		t.Error("expected error for non-string payload")
+	}
+
+	messages := published.snapshot()
+	if len(messages) != 2 || messages[0].Payload != "1.0" || messages[1].Payload != "\x00\xff" {
+		t.Errorf("published = %+v", messages)
+	}
+}
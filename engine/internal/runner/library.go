@@ -17,12 +17,14 @@ type LibraryModule struct {
 	Description string
 	Functions   map[string]*starlark.Function
 	Globals     starlark.StringDict
+	BindContext bool // bind_ctx = True: functions taking ctx first get the caller's
 }
 
 // LibraryManager manages library modules
 type LibraryManager struct {
-	modules map[string]*LibraryModule
-	mu      sync.RWMutex
+	modules  map[string]*LibraryModule
+	programs *programCache // Shared with the runner; see Runner.SetProgramCache
+	mu       sync.RWMutex
 }
 
 // NewLibraryManager creates a new library manager
@@ -77,7 +79,7 @@ func (lm *LibraryManager) loadLibrary(filePath string) error {
 
 	// Execute the Starlark file
 	thread := &starlark.Thread{Name: "library:" + name}
-	globals, err := starlark.ExecFile(thread, filePath, data, nil)
+	globals, err := lm.programs.exec(thread, filePath, data, nil)
 	if err != nil {
 		return fmt.Errorf("starlark execution error: %w", err)
 	}
@@ -107,6 +109,7 @@ func (lm *LibraryManager) loadLibrary(filePath string) error {
 		Description: description,
 		Functions:   functions,
 		Globals:     globals,
+		BindContext: bindsContext(globals),
 	}
 
 	lm.modules[name] = module
@@ -134,30 +137,26 @@ func (lm *LibraryManager) GetAllModules() map[string]*LibraryModule {
 	return result
 }
 
-// ToStarlarkStruct converts all library modules to a Starlark struct
-// that can be accessed as ctx.lib.modulename.function()
-func (lm *LibraryManager) ToStarlarkStruct() *starlark.Dict {
+// ToStarlarkStruct converts all library modules to a Starlark value
+// that can be accessed as ctx.lib.modulename.function(). Functions of modules
+// binding the context are called with ctx() as their ctx argument.
+func (lm *LibraryManager) ToStarlarkStruct(ctx func() starlark.Value) *libraryNamespace {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
 
-	libDict := starlark.NewDict(len(lm.modules))
-	
+	modules := make(map[string]starlark.Value, len(lm.modules))
 	for moduleName, module := range lm.modules {
-		// Create a struct for each module containing its functions
-		moduleDict := starlark.StringDict{}
+		functions := make(map[string]starlark.Value, len(module.Functions))
 		for fnName, fn := range module.Functions {
-			moduleDict[fnName] = fn
-		}
-		
-		moduleStruct := starlark.NewDict(len(moduleDict))
-		for k, v := range moduleDict {
-			moduleStruct.SetKey(starlark.String(k), v)
+			if module.BindContext && ctx != nil && takesContext(fn) {
+				functions[fnName] = bindContext(moduleName, fnName, fn, ctx)
+			} else {
+				functions[fnName] = fn
+			}
 		}
-		
-		libDict.SetKey(starlark.String(moduleName), moduleStruct)
+		modules[moduleName] = newLibraryNamespace("library "+moduleName, functions)
 	}
-	
-	return libDict
+	return newLibraryNamespace("library modules", modules)
 }
 
 // GetFunctionInfo extracts function information for a library module
@@ -3,6 +3,7 @@ package runner
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -277,7 +278,7 @@ def helper():
 		t.Fatal(err)
 	}
 
-	starlarkDict := lm.ToStarlarkStruct()
+	starlarkDict := lm.ToStarlarkStruct(nil)
 	if starlarkDict == nil {
 		t.Fatal("Expected non-nil Starlark dict")
 	}
@@ -376,3 +377,55 @@ def lib_func():
 		t.Error("Regular .star file should not be loaded as library")
 	}
 }
+
+func TestLibrary_BindContext(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeBlueprintFiles(t, tmpDir, map[string]string{
+		"lib/timers.lib.star": `
+bind_ctx = True
+
+def start(ctx, name):
+    ctx.log("started " + name)
+    return ctx
+
+def format_duration(seconds):
+    return "%ds" % seconds
+`,
+		"lib/utils.lib.star": `
+def describe(ctx, value):
+    return "%s=%s" % (type(ctx), value)
+`,
+	})
+	lm := NewLibraryManager()
+	if err := lm.LoadLibraries(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if module, _ := lm.GetModule("timers"); !module.BindContext {
+		t.Error("timers should bind the context")
+	}
+
+	r := newTestRunner()
+	a := addTestAutomation(t, r, "hallway", `
+config = {"name": "Hallway", "schedule": "@every 1m"}
+
+def on_schedule(ctx):
+    if ctx.lib.timers.start("hallway") != ctx:
+        fail("bound to another ctx")
+    ctx.log(ctx.lib["timers"]["format_duration"](5))
+    ctx.log(ctx.lib.utils.describe(ctx, 2))
+    ctx.log(str(sorted(ctx.lib)))
+`)
+	a.context.libraryManager = lm
+
+	if _, err := r.RunManual("hallway", ManualTrigger{}); err != nil {
+		t.Fatal(err)
+	}
+	var logs []string
+	for _, entry := range r.GetLogs() {
+		logs = append(logs, entry.Message)
+	}
+	want := []string{"started hallway", "5s", "struct=2", `["timers", "utils"]`}
+	if !slices.Equal(logs, want) {
+		t.Errorf("logs = %q, want %q", logs, want)
+	}
+}
@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+
+	"go.starlark.net/starlark"
+)
+
+// bindContextFlag is the library global that opts a module into context
+// binding: its functions taking ctx first are called with the calling
+// automation's ctx, so ctx.lib.timers.start("x") calls start(ctx, "x")
+const bindContextFlag = "bind_ctx"
+
+// bindsContext reports whether a library's globals set bind_ctx = True
+func bindsContext(globals starlark.StringDict) bool {
+	flag, ok := globals[bindContextFlag].(starlark.Bool)
+	return ok && bool(flag)
+}
+
+// takesContext reports whether fn's first parameter is named ctx
+func takesContext(fn *starlark.Function) bool {
+	if fn.NumParams() == 0 {
+		return false
+	}
+	name, _ := fn.Param(0)
+	return name == "ctx"
+}
+
+// bindContext returns fn with ctx() passed as its first argument
+func bindContext(module, name string, fn *starlark.Function, ctx func() starlark.Value) *starlark.Builtin {
+	return starlark.NewBuiltin(module+"."+name, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		return starlark.Call(thread, fn, append(starlark.Tuple{ctx()}, args...), kwargs)
+	})
+}
+
+// libraryNamespace is ctx.lib and each module in it: a read-only mapping whose
+// entries can also be read as attributes, as in ctx.lib.timers.start
+type libraryNamespace struct {
+	name    string
+	members *starlark.Dict
+}
+
+var (
+	_ starlark.IterableMapping = (*libraryNamespace)(nil)
+	_ starlark.HasAttrs        = (*libraryNamespace)(nil)
+)
+
+func newLibraryNamespace(name string, members map[string]starlark.Value) *libraryNamespace {
+	dict := starlark.NewDict(len(members))
+	for k, v := range members {
+		dict.SetKey(starlark.String(k), v)
+	}
+	dict.Freeze()
+	return &libraryNamespace{name: name, members: dict}
+}
+
+func (n *libraryNamespace) String() string        { return "<" + n.name + ">" }
+func (n *libraryNamespace) Type() string          { return "library" }
+func (n *libraryNamespace) Freeze()               {}
+func (n *libraryNamespace) Truth() starlark.Bool  { return n.members.Len() > 0 }
+func (n *libraryNamespace) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: library") }
+func (n *libraryNamespace) Len() int              { return n.members.Len() }
+
+func (n *libraryNamespace) Get(k starlark.Value) (starlark.Value, bool, error) {
+	return n.members.Get(k)
+}
+
+func (n *libraryNamespace) Items() []starlark.Tuple {
+	items := n.members.Items()
+	sort.Slice(items, func(i, j int) bool { return items[i][0].(starlark.String) < items[j][0].(starlark.String) })
+	return items
+}
+
+func (n *libraryNamespace) Iterate() starlark.Iterator {
+	items := n.Items()
+	keys := make([]starlark.Value, len(items))
+	for i, item := range items {
+		keys[i] = item[0]
+	}
+	return starlark.NewList(keys).Iterate()
+}
+
+func (n *libraryNamespace) Attr(name string) (starlark.Value, error) {
+	v, found, err := n.members.Get(starlark.String(name))
+	if !found || err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (n *libraryNamespace) AttrNames() []string {
+	names := make([]string, 0, n.members.Len())
+	for _, item := range n.Items() {
+		names = append(names, string(item[0].(starlark.String)))
+	}
+	return names
+}
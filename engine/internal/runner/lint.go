@@ -0,0 +1,254 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Lint rule identifiers
+const (
+	LintUncheckedPublish  = "unchecked-publish"
+	LintUnusedPermission  = "unused-permission"
+	LintWildcardSubscribe = "wildcard-subscribe"
+	LintUncheckedDecode   = "unchecked-decode"
+)
+
+// LintFinding is one style issue found in automation code
+type LintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"` // "warning" or "info"
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+// LintResult is the outcome of linting automation code. Errors are set when
+// the code could not be parsed or executed at all.
+type LintResult struct {
+	Findings []LintFinding `json:"findings"`
+	Errors   []string      `json:"errors,omitempty"`
+}
+
+// Lint checks automation code against homebrain-specific style rules
+func Lint(code string) LintResult {
+	return lint(code, nil)
+}
+
+// LintIn lints code as if it were placed in dir (see ValidateCodeIn)
+func LintIn(code, dir string) LintResult {
+	common, err := LoadCommon(dir)
+	if err != nil {
+		return LintResult{Findings: []LintFinding{}, Errors: []string{err.Error()}}
+	}
+	return lint(code, common)
+}
+
+func lint(code string, predeclared starlark.StringDict) LintResult {
+	f, err := syntax.Parse("validation.star", code, 0)
+	if err != nil {
+		return LintResult{Findings: []LintFinding{}, Errors: []string{formatStarlarkError(err)}}
+	}
+
+	thread := &starlark.Thread{Name: "lint"}
+	globals, err := starlark.ExecFile(thread, "validation.star", code, predeclared)
+	if err != nil {
+		return LintResult{Findings: []LintFinding{}, Errors: []string{formatStarlarkError(err)}}
+	}
+
+	var config AutomationConfig
+	if val, ok := globals["config"]; ok {
+		config, _ = extractConfig(val)
+	}
+
+	findings := []LintFinding{}
+	findings = append(findings, lintUncheckedPublish(f)...)
+	findings = append(findings, lintUnusedPermissions(f, config)...)
+	findings = append(findings, lintWildcardSubscribe(f, config)...)
+	findings = append(findings, lintUncheckedDecode(f)...)
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return LintResult{Findings: findings}
+}
+
+func newFinding(rule, severity string, node syntax.Node, message string) LintFinding {
+	finding := LintFinding{Rule: rule, Severity: severity, Message: message}
+	if node != nil {
+		start, _ := node.Span()
+		finding.Line, finding.Column = int(start.Line), int(start.Col)
+	}
+	return finding
+}
+
+// ctxMethodCall returns the method name for calls of the form ctx.method(...)
+func ctxMethodCall(n syntax.Node) (*syntax.CallExpr, string) {
+	call, ok := n.(*syntax.CallExpr)
+	if !ok {
+		return nil, ""
+	}
+	dot, ok := call.Fn.(*syntax.DotExpr)
+	if !ok {
+		return nil, ""
+	}
+	if ident, ok := dot.X.(*syntax.Ident); !ok || ident.Name != "ctx" {
+		return nil, ""
+	}
+	return call, dot.Name.Name
+}
+
+// findStringLiteral returns the first string literal with the given value
+func findStringLiteral(f *syntax.File, value string) syntax.Node {
+	var found syntax.Node
+	syntax.Walk(f, func(n syntax.Node) bool {
+		if found != nil {
+			return false
+		}
+		if lit, ok := n.(*syntax.Literal); ok && lit.Token == syntax.STRING && lit.Value == value {
+			found = lit
+		}
+		return true
+	})
+	return found
+}
+
+// lintUncheckedPublish flags ctx.publish calls used as bare statements
+func lintUncheckedPublish(f *syntax.File) []LintFinding {
+	var findings []LintFinding
+	syntax.Walk(f, func(n syntax.Node) bool {
+		stmt, ok := n.(*syntax.ExprStmt)
+		if !ok {
+			return true
+		}
+		if _, method := ctxMethodCall(stmt.X); method == "publish" {
+			findings = append(findings, newFinding(LintUncheckedPublish, "warning", stmt,
+				"ctx.publish result is ignored; check the returned bool to handle failed publishes"))
+		}
+		return true
+	})
+	return findings
+}
+
+// lintUnusedPermissions flags global_state_writes patterns that no literal
+// ctx.set_global/clear_global key uses. Skipped when keys are computed.
+func lintUnusedPermissions(f *syntax.File, config AutomationConfig) []LintFinding {
+	if len(config.GlobalStateWrites) == 0 {
+		return nil
+	}
+
+	var keys []string
+	dynamic := false
+	syntax.Walk(f, func(n syntax.Node) bool {
+		call, method := ctxMethodCall(n)
+		if call == nil || (method != "set_global" && method != "clear_global") || len(call.Args) == 0 {
+			return true
+		}
+		if lit, ok := call.Args[0].(*syntax.Literal); ok && lit.Token == syntax.STRING {
+			keys = append(keys, lit.Value.(string))
+		} else {
+			dynamic = true
+		}
+		return true
+	})
+	if dynamic {
+		return nil
+	}
+
+	var findings []LintFinding
+	for _, pattern := range config.GlobalStateWrites {
+		used := false
+		for _, key := range keys {
+			if matchPattern(pattern, key) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			findings = append(findings, newFinding(LintUnusedPermission, "info", findStringLiteral(f, pattern),
+				fmt.Sprintf("global_state_writes declares %q but no ctx.set_global/clear_global call uses it", pattern)))
+		}
+	}
+	return findings
+}
+
+// lintWildcardSubscribe flags subscriptions to every topic on the broker
+func lintWildcardSubscribe(f *syntax.File, config AutomationConfig) []LintFinding {
+	for _, topic := range config.Subscribe {
+		if topic == "#" {
+			return []LintFinding{newFinding(LintWildcardSubscribe, "warning", findStringLiteral(f, "#"),
+				`subscribing to "#" runs this automation for every message on the broker; subscribe to specific topics`)}
+		}
+	}
+	return nil
+}
+
+// lintUncheckedDecode flags `x = ctx.json_decode(...)` inside a function when x
+// is never indexed, queried with .get/in, iterated, returned or passed on
+func lintUncheckedDecode(f *syntax.File) []LintFinding {
+	var findings []LintFinding
+	for _, stmt := range f.Stmts {
+		def, ok := stmt.(*syntax.DefStmt)
+		if !ok {
+			continue
+		}
+
+		decoded := map[string]syntax.Node{}
+		var order []string
+		used := map[string]bool{}
+		markUsed := func(e syntax.Expr) {
+			if ident, ok := e.(*syntax.Ident); ok {
+				used[ident.Name] = true
+			}
+		}
+
+		walkStmts(def.Body, func(n syntax.Node) bool {
+			switch n := n.(type) {
+			case *syntax.AssignStmt:
+				ident, ok := n.LHS.(*syntax.Ident)
+				if _, method := ctxMethodCall(n.RHS); ok && method == "json_decode" {
+					if _, seen := decoded[ident.Name]; !seen {
+						order = append(order, ident.Name)
+					}
+					decoded[ident.Name] = n
+				}
+			case *syntax.IndexExpr:
+				markUsed(n.X)
+			case *syntax.DotExpr:
+				markUsed(n.X)
+			case *syntax.BinaryExpr:
+				if n.Op == syntax.IN || n.Op == syntax.NOT_IN {
+					markUsed(n.Y)
+				}
+			case *syntax.CallExpr:
+				for _, arg := range n.Args {
+					if kw, ok := arg.(*syntax.BinaryExpr); ok && kw.Op == syntax.EQ {
+						arg = kw.Y // keyword argument
+					}
+					markUsed(arg)
+				}
+			case *syntax.ReturnStmt:
+				if n.Result != nil {
+					markUsed(n.Result)
+				}
+			case *syntax.ForStmt:
+				markUsed(n.X)
+			}
+			return true
+		})
+
+		for _, name := range order {
+			if !used[name] {
+				findings = append(findings, newFinding(LintUncheckedDecode, "warning", decoded[name],
+					fmt.Sprintf("payload decoded into %q in %s but no field is checked", name, def.Name.Name)))
+			}
+		}
+	}
+	return findings
+}
+
+func walkStmts(stmts []syntax.Stmt, fn func(syntax.Node) bool) {
+	for _, stmt := range stmts {
+		syntax.Walk(stmt, fn)
+	}
+}
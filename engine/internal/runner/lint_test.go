@@ -0,0 +1,127 @@
+package runner
+
+import "testing"
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected []string // Rules, in line order
+	}{
+		{
+			name: "clean automation",
+			code: `
+def on_message(topic, payload, ctx):
+    data = ctx.json_decode(payload)
+    if data.get("occupancy"):
+        if not ctx.publish("zigbee2mqtt/light/set", "ON"):
+            ctx.log("publish failed")
+        ctx.set_global("presence.hallway.last_motion", ctx.now())
+
+config = {
+    "name": "Clean",
+    "subscribe": ["zigbee2mqtt/motion"],
+    "global_state_writes": ["presence.hallway.*"],
+}
+`,
+			expected: nil,
+		},
+		{
+			name: "unchecked publish",
+			code: `
+def on_schedule(ctx):
+    ctx.publish("a/b", "x")
+    ok = ctx.publish("a/c", "y")
+
+config = {"name": "Publish", "schedule": "* * * * *"}
+`,
+			expected: []string{LintUncheckedPublish},
+		},
+		{
+			name: "unused permission",
+			code: `
+def on_schedule(ctx):
+    ctx.set_global("presence.kitchen", True)
+
+config = {
+    "name": "Perms",
+    "global_state_writes": ["presence.kitchen", "climate.*"],
+}
+`,
+			expected: []string{LintUnusedPermission},
+		},
+		{
+			name: "computed global keys skip permission check",
+			code: `
+def on_message(topic, payload, ctx):
+    ctx.set_global("climate." + topic, payload)
+
+config = {"name": "Dynamic", "subscribe": ["a"], "global_state_writes": ["climate.*", "other"]}
+`,
+			expected: nil,
+		},
+		{
+			name: "wildcard subscribe",
+			code: `
+def on_message(topic, payload, ctx):
+    ctx.log(topic)
+
+config = {"name": "Everything", "subscribe": ["#"]}
+`,
+			expected: []string{LintWildcardSubscribe},
+		},
+		{
+			name: "decoded payload never checked",
+			code: `
+def on_message(topic, payload, ctx):
+    data = ctx.json_decode(payload)
+    ctx.log("got message")
+
+config = {"name": "Decode", "subscribe": ["a"]}
+`,
+			expected: []string{LintUncheckedDecode},
+		},
+		{
+			name: "decoded payload passed on",
+			code: `
+def on_message(topic, payload, ctx):
+    data = ctx.json_decode(payload)
+    ctx.lib.devices.sync_state(ctx, "lamp", payload=data)
+
+config = {"name": "Decode", "subscribe": ["a"]}
+`,
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Lint(tt.code)
+			if len(result.Errors) > 0 {
+				t.Fatalf("unexpected errors: %v", result.Errors)
+			}
+			var rules []string
+			for _, f := range result.Findings {
+				rules = append(rules, f.Rule)
+				if f.Line == 0 {
+					t.Errorf("finding %s has no line", f.Rule)
+				}
+			}
+			if len(rules) != len(tt.expected) {
+				t.Fatalf("findings = %+v, want rules %v", result.Findings, tt.expected)
+			}
+			for i := range rules {
+				if rules[i] != tt.expected[i] {
+					t.Errorf("finding %d = %s, want %s", i, rules[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLint_SyntaxError(t *testing.T) {
+	result := Lint("def broken(")
+	if len(result.Errors) == 0 {
+		t.Error("expected syntax error")
+	}
+}
@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LoadError is the last failed load of an automation file that hasn't loaded since
+type LoadError struct {
+	AutomationID string    `json:"automation_id"`
+	File         string    `json:"file"`
+	Error        string    `json:"error"`
+	Time         time.Time `json:"time"`
+	Previous     bool      `json:"previous"`          // An earlier version of the file is still running
+	Waiting      []string  `json:"waiting,omitempty"` // Required automations that aren't loaded; it loads once they are
+}
+
+// loadErrors holds load failures by automation ID
+type loadErrors struct {
+	mu   sync.Mutex
+	byID map[string]LoadError
+}
+
+// set records err for id, or forgets id's failure if err is nil. previous
+// reports whether an earlier version is still loaded.
+func (l *loadErrors) set(id, file string, err error, previous bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		delete(l.byID, id)
+		return
+	}
+	if l.byID == nil {
+		l.byID = make(map[string]LoadError)
+	}
+	loadErr := LoadError{AutomationID: id, File: file, Error: err.Error(), Time: time.Now(), Previous: previous}
+	var missing *missingDependencyError
+	if errors.As(err, &missing) {
+		loadErr.Waiting = missing.ids
+	}
+	l.byID[id] = loadErr
+}
+
+// GetLoadErrors returns automation files that failed to load, sorted by ID
+func (r *Runner) GetLoadErrors() []LoadError {
+	r.loadErrors.mu.Lock()
+	defer r.loadErrors.mu.Unlock()
+	result := make([]LoadError, 0, len(r.loadErrors.byID))
+	for _, e := range r.loadErrors.byID {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].AutomationID < result[j].AutomationID })
+	return result
+}
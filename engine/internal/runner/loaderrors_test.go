@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetLoadErrors(t *testing.T) {
+	r := New(nil, nil)
+	path := filepath.Join(t.TempDir(), "broken.star")
+
+	write := func(code string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`config = {"name": "Broken"`)
+	if err := r.LoadAutomation(path); err == nil {
+		t.Fatal("expected a load error")
+	}
+	errs := r.GetLoadErrors()
+	if len(errs) != 1 || errs[0].AutomationID != "broken" || errs[0].File != path || errs[0].Error == "" {
+		t.Fatalf("GetLoadErrors() = %+v", errs)
+	}
+
+	write("config = {\"name\": \"Fixed\", \"schedule\": \"0 7 * * *\"}\ndef on_schedule(ctx):\n    pass\n")
+	if err := r.LoadAutomation(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if errs := r.GetLoadErrors(); len(errs) != 0 {
+		t.Errorf("fixed file still reported: %+v", errs)
+	}
+
+	write(`config = {"name": "Broken"`)
+	r.LoadAutomation(path)
+	r.UnloadAutomation("broken")
+	if errs := r.GetLoadErrors(); len(errs) != 0 {
+		t.Errorf("removed file still reported: %+v", errs)
+	}
+}
+
+func TestReloadKeepsPreviousVersion(t *testing.T) {
+	r := New(nil, nil)
+	path := filepath.Join(t.TempDir(), "wake_up.star")
+
+	write := func(code string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("config = {\"name\": \"Wake Up\", \"schedule\": \"0 7 * * *\"}\ndef on_schedule(ctx):\n    return \"v1\"\n")
+	if err := r.LoadAutomation(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, broken := range []string{
+		`config = {"name": "Broken"`,
+		"config = {\"name\": \"No Handler\"}\n",
+		"config = {\"name\": \"Bad Schedule\", \"schedule\": \"never\"}\ndef on_schedule(ctx):\n    return \"v2\"\n",
+	} {
+		write(broken)
+		if err := r.LoadAutomation(path); err == nil {
+			t.Fatalf("expected a load error for %q", broken)
+		}
+		list := r.ListAutomations()
+		if len(list) != 1 || list[0].Config.Name != "Wake Up" {
+			t.Fatalf("after failed reload: %+v", list)
+		}
+		if record, err := r.RunManual("wake_up", ManualTrigger{}); err != nil || record.Result != "v1" {
+			t.Errorf("previous version run = %v, %v", record.Result, err)
+		}
+		if errs := r.GetLoadErrors(); len(errs) != 1 || !errs[0].Previous {
+			t.Errorf("GetLoadErrors() = %+v, want the previous version marked as running", errs)
+		}
+	}
+
+	// Disabling still unloads
+	write("config = {\"name\": \"Wake Up\", \"schedule\": \"0 7 * * *\", \"enabled\": False}\ndef on_schedule(ctx):\n    return \"v3\"\n")
+	if err := r.LoadAutomation(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if list := r.ListAutomations(); len(list) != 0 {
+		t.Errorf("disabled automation still loaded: %+v", list)
+	}
+}
@@ -0,0 +1,129 @@
+package runner
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// logFlushInterval is how often new automation log entries are written to the
+// state store; batching keeps chatty automations from costing a disk sync each
+const logFlushInterval = time.Second
+
+// DefaultStoredLogs is how many log entries PersistLogs keeps by default
+const DefaultStoredLogs = 100000
+
+// logScanPage bounds how many stored entries one log query reads; a query
+// that stops there returns a cursor to continue from
+const logScanPage = 10000
+
+// PersistLogs keeps automation logs in the state store so they survive
+// restarts. It restores the newest stored entries into the log buffer, then
+// writes new ones in batches, keeping the newest limit entries (0 uses
+// DefaultStoredLogs). Log queries then page through the store once they
+// reach past the buffer. Call it before loading automations.
+func (r *Runner) PersistLogs(limit int) error {
+	if r.stateStore == nil {
+		return fmt.Errorf("no state store")
+	}
+	if limit <= 0 {
+		limit = DefaultStoredLogs
+	}
+	stored, err := r.stateStore.RecentLogs(r.maxLogs)
+	if err != nil {
+		return err
+	}
+
+	r.logsMu.Lock()
+	restored := make([]LogEntry, 0, len(stored)+len(r.logs))
+	for _, e := range stored {
+		restored = append(restored, LogEntry(e))
+	}
+	// Entries logged so far continue the stored sequence
+	r.logSeq = 0
+	if len(stored) > 0 {
+		r.logSeq = stored[len(stored)-1].Seq
+	}
+	for i := range r.logs {
+		r.logSeq++
+		r.logs[i].Seq = r.logSeq
+	}
+	r.pendingLogs = append(r.pendingLogs, r.logs...)
+	r.logs = append(restored, r.logs...)
+	if len(r.logs) > r.maxLogs {
+		r.logs = r.logs[len(r.logs)-r.maxLogs:]
+	}
+	r.storedLogs = max(limit, r.maxLogs)
+	stop := make(chan struct{})
+	r.stopFlush = stop
+	r.logsMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(logFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.FlushLogs(); err != nil {
+					slog.Error("Failed to persist automation logs", "error", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopLogs ends the periodic flush started by PersistLogs and writes the
+// entries still pending. Call it on shutdown.
+func (r *Runner) StopLogs() error {
+	r.logsMu.Lock()
+	if r.stopFlush != nil {
+		close(r.stopFlush)
+		r.stopFlush = nil
+	}
+	r.logsMu.Unlock()
+	return r.FlushLogs()
+}
+
+// FlushLogs writes log entries not yet persisted to the state store
+func (r *Runner) FlushLogs() error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.logsMu.Lock()
+	pending := r.pendingLogs
+	r.pendingLogs = nil
+	limit := r.storedLogs
+	r.logsMu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	entries := make([]state.LogEntry, len(pending))
+	for i, e := range pending {
+		entries[i] = state.LogEntry(e)
+	}
+	return r.stateStore.AppendLogs(entries, limit)
+}
+
+// searchStoredLogs continues a log query in the state store below the
+// sequence number before, adding up to limit entries to result. It reads at
+// most logScanPage entries and returns the cursor for the next page, 0 when
+// there is nothing older.
+func (r *Runner) searchStoredLogs(q LogQuery, terms []string, before uint64, limit int, result []LogEntry) ([]LogEntry, uint64) {
+	stored, next, err := r.stateStore.QueryLogs(before, q.Since, limit, logScanPage, func(e state.LogEntry) bool {
+		return q.matches(LogEntry(e), terms)
+	})
+	if err != nil {
+		slog.Error("Failed to search stored logs", "error", err)
+		return result, 0
+	}
+	for _, e := range stored {
+		result = append(result, LogEntry(e))
+	}
+	return result, next
+}
@@ -0,0 +1,159 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPersistLogs(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	r.addLog("hallway", LogLevelInfo, "before persistence")
+	if err := r.PersistLogs(0); err != nil {
+		t.Fatal(err)
+	}
+	r.addLog("hallway", LogLevelError, "ERROR: lamp unavailable")
+	if err := r.FlushLogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted runner on the same store starts with the earlier logs
+	restarted := newTestRunner()
+	restarted.stateStore = r.stateStore
+	restarted.addLog("kitchen", LogLevelInfo, "loaded before restore")
+	if err := restarted.PersistLogs(0); err != nil {
+		t.Fatal(err)
+	}
+	logs := restarted.GetLogs()
+	if len(logs) != 3 || logs[0].Message != "before persistence" || logs[1].Level != LogLevelError || logs[2].AutomationID != "kitchen" {
+		t.Fatalf("restored logs = %+v", logs)
+	}
+
+	// Entries already flushed are not written twice
+	if err := restarted.FlushLogs(); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := r.stateStore.RecentLogs(10)
+	if len(stored) != 3 {
+		t.Errorf("stored %d entries, want 3: %+v", len(stored), stored)
+	}
+	// New entries continue the stored sequence
+	restarted.addLog("kitchen", LogLevelInfo, "after restore")
+	if logs := restarted.GetLogs(); logs[2].Seq != 3 || logs[3].Seq != 4 {
+		t.Errorf("sequence numbers = %d, %d; want 3, 4", logs[2].Seq, logs[3].Seq)
+	}
+}
+
+func TestStopLogs(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	if err := r.PersistLogs(0); err != nil {
+		t.Fatal(err)
+	}
+	r.addLog("hallway", LogLevelInfo, "shutting down")
+	if err := r.StopLogs(); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := r.stateStore.RecentLogs(10); len(stored) != 1 {
+		t.Errorf("stored %d entries, want the pending one flushed", len(stored))
+	}
+	if r.stopFlush != nil {
+		t.Error("flush loop still running")
+	}
+	// Stopping twice is harmless
+	if err := r.StopLogs(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPersistLogs_SearchesBeyondBuffer(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	r.maxLogs = 3
+	if err := r.PersistLogs(5); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 7; i++ {
+		r.addLog("boiler", LogLevelInfo, fmt.Sprintf("reading %d", i))
+	}
+	r.addLog("hallway", LogLevelError, "ERROR: lamp unavailable")
+	if err := r.FlushLogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if logs := r.GetLogs(); len(logs) != 3 {
+		t.Fatalf("buffer holds %d entries, want 3", len(logs))
+	}
+	messages := func(entries []LogEntry) string {
+		var list []string
+		for _, e := range entries {
+			list = append(list, e.Message)
+		}
+		return strings.Join(list, ", ")
+	}
+	tests := []struct {
+		query LogQuery
+		want  string
+	}{
+		// The store keeps the newest 5 entries, beyond the buffer's 3
+		{LogQuery{AutomationID: "boiler", Limit: 10}, "reading 6, reading 5, reading 4, reading 3"},
+		{LogQuery{Text: "reading 3"}, "reading 3"},
+		{LogQuery{Level: LogLevelError, Since: start}, "ERROR: lamp unavailable"},
+		{LogQuery{Until: start}, ""},
+		// Without a limit, as many as the buffer holds
+		{LogQuery{}, "ERROR: lamp unavailable, reading 6, reading 5"},
+	}
+	for _, tt := range tests {
+		entries, _ := r.SearchLogs(tt.query)
+		if got := messages(entries); got != tt.want {
+			t.Errorf("SearchLogs(%+v) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPersistLogs_Paging(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	r.maxLogs = 3
+	if err := r.PersistLogs(10); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		r.addLog("boiler", LogLevelInfo, fmt.Sprintf("reading %d", i))
+	}
+	if err := r.FlushLogs(); err != nil {
+		t.Fatal(err)
+	}
+	// Not flushed yet, but in the buffer
+	r.addLog("boiler", LogLevelInfo, "reading 8")
+
+	var pages [][]LogEntry
+	query := LogQuery{Limit: 2}
+	for {
+		entries, next := r.SearchLogs(query)
+		pages = append(pages, entries)
+		if next == 0 || len(pages) > 10 {
+			break
+		}
+		query.Before = next
+	}
+	var got []string
+	for _, page := range pages {
+		var list []string
+		for _, e := range page {
+			list = append(list, strings.TrimPrefix(e.Message, "reading "))
+		}
+		got = append(got, strings.Join(list, " "))
+	}
+	if want := "8 7|6 5|4 3|2 1|0"; strings.Join(got, "|") != want {
+		t.Errorf("pages = %q, want %q", strings.Join(got, "|"), want)
+	}
+
+	// The buffer answers queries it covers without reading the store
+	if err := r.StopLogs(); err != nil {
+		t.Fatal(err)
+	}
+	r.stateStore.Close()
+	if entries, next := r.SearchLogs(LogQuery{Limit: 2}); len(entries) != 2 || next != entries[1].Seq {
+		t.Errorf("SearchLogs() = %+v, %d", entries, next)
+	}
+}
@@ -0,0 +1,157 @@
+package runner
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Log levels. ctx.log is always info; handler errors and the errors and
+// warnings builtins report are logged at their level, with an "ERROR: " or
+// "WARNING: " prefix for readers of the plain message.
+const (
+	LogLevelInfo    = "info"
+	LogLevelWarning = "warning"
+	LogLevelError   = "error"
+)
+
+var logLevelRank = map[string]int{LogLevelInfo: 0, LogLevelWarning: 1, LogLevelError: 2}
+
+// ParseLogLevel checks a minimum level given as a query parameter
+func ParseLogLevel(level string) (string, error) {
+	level = strings.ToLower(level)
+	if level == "warn" {
+		level = LogLevelWarning
+	}
+	if _, ok := logLevelRank[level]; !ok {
+		return "", fmt.Errorf("unknown log level %q (want %s, %s or %s)", level, LogLevelInfo, LogLevelWarning, LogLevelError)
+	}
+	return level, nil
+}
+
+// LogQuery filters log entries for GET /logs
+type LogQuery struct {
+	Text         string    // Words and "quoted phrases"; all must match (case-insensitive)
+	AutomationID string    // Optional exact automation ID
+	Level        string    // Optional minimum level
+	Since        time.Time // Optional lower bound (inclusive)
+	Until        time.Time // Optional upper bound (exclusive)
+	Limit        int       // Maximum results, newest first (0 = no limit)
+	Before       uint64    // Optional cursor from an earlier query: only older entries
+}
+
+// FilterLogs returns the newest log entries matching the query in
+// chronological order, like GetLogs, and the cursor for older ones
+func (r *Runner) FilterLogs(q LogQuery) ([]LogEntry, uint64) {
+	result, next := r.SearchLogs(q)
+	if result == nil {
+		return []LogEntry{}, next
+	}
+	slices.Reverse(result)
+	return result, next
+}
+
+// SearchLogs returns log entries matching the query, newest first, and the
+// cursor to pass as Before for the next page (0 when there is none). The log
+// buffer answers first; with PersistLogs, queries reaching further back page
+// through the state store. Without it only the buffer is searched.
+func (r *Runner) SearchLogs(q LogQuery) ([]LogEntry, uint64) {
+	terms := parseSearchTerms(q.Text)
+
+	r.logsMu.RLock()
+	persisted := r.storedLogs > 0
+	limit := q.Limit
+	if limit <= 0 && persisted {
+		limit = r.maxLogs // As many as the buffer would return
+	}
+	var result []LogEntry
+	for i := len(r.logs) - 1; i >= 0; i-- {
+		entry := r.logs[i]
+		if q.Before > 0 && entry.Seq >= q.Before {
+			continue
+		}
+		if !q.matches(entry, terms) {
+			continue
+		}
+		result = append(result, entry)
+		if limit > 0 && len(result) >= limit {
+			r.logsMu.RUnlock()
+			if i == 0 && !persisted {
+				return result, 0
+			}
+			return result, entry.Seq
+		}
+	}
+
+	// The store only has older entries to add if the buffer doesn't already
+	// reach back to since or the start of the log
+	before := q.Before
+	covered := !persisted
+	if len(r.logs) > 0 {
+		oldest := r.logs[0]
+		if before == 0 || oldest.Seq < before {
+			before = oldest.Seq
+		}
+		covered = covered || oldest.Seq <= 1 || (!q.Since.IsZero() && oldest.Timestamp.Before(q.Since))
+	}
+	r.logsMu.RUnlock()
+	if covered {
+		return result, 0
+	}
+	return r.searchStoredLogs(q, terms, before, limit-len(result), result)
+}
+
+func (q LogQuery) matches(entry LogEntry, terms []string) bool {
+	if q.AutomationID != "" && entry.AutomationID != q.AutomationID {
+		return false
+	}
+	if q.Level != "" && logLevelRank[entry.Level] < logLevelRank[q.Level] {
+		return false
+	}
+	if !q.Since.IsZero() && entry.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !entry.Timestamp.Before(q.Until) {
+		return false
+	}
+
+	// Terms match against the automation ID as well, so "garage" finds
+	// entries from garage_door even if the message doesn't mention it
+	haystack := strings.ToLower(entry.AutomationID + " " + entry.Message)
+	for _, term := range terms {
+		if !strings.Contains(haystack, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSearchTerms splits a query into lowercase words, keeping "quoted phrases" intact
+func parseSearchTerms(text string) []string {
+	var terms []string
+	var current strings.Builder
+	quoted := false
+
+	flush := func() {
+		if current.Len() > 0 {
+			terms = append(terms, strings.ToLower(current.String()))
+			current.Reset()
+		}
+	}
+
+	for _, ch := range text {
+		switch {
+		case ch == '"':
+			flush()
+			quoted = !quoted
+		case unicode.IsSpace(ch) && !quoted:
+			flush()
+		default:
+			current.WriteRune(ch)
+		}
+	}
+	flush()
+	return terms
+}
@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSearchTerms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{"garage", []string{"garage"}},
+		{"Garage  Door", []string{"garage", "door"}},
+		{`"garage door" open`, []string{"garage door", "open"}},
+		{`"unterminated phrase`, []string{"unterminated phrase"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := parseSearchTerms(tt.input); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("parseSearchTerms(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSearchLogs(t *testing.T) {
+	base := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	r := &Runner{logs: []LogEntry{
+		{Timestamp: base, AutomationID: "garage_door", Message: "Door opened"},
+		{Timestamp: base.Add(time.Hour), AutomationID: "lights", Message: "Garage light ON"},
+		{Timestamp: base.Add(2 * time.Hour), AutomationID: "lights", Message: "Hallway light ON"},
+		{Timestamp: base.Add(3 * time.Hour), AutomationID: "garage_door", Message: "Door closed"},
+		{Timestamp: base.Add(4 * time.Hour), AutomationID: "lights", Level: LogLevelWarning, Message: "WARNING: zigbee2mqtt/motion: missing field occupancy"},
+		{Timestamp: base.Add(5 * time.Hour), AutomationID: "lights", Level: LogLevelError, Message: "ERROR: publish: not connected"},
+	}}
+
+	tests := []struct {
+		name     string
+		query    LogQuery
+		expected []string // Messages, newest first
+	}{
+		{"matches message and automation ID", LogQuery{Text: "garage"}, []string{"Door closed", "Garage light ON", "Door opened"}},
+		{"all terms must match", LogQuery{Text: "garage light"}, []string{"Garage light ON"}},
+		{"phrase", LogQuery{Text: `"light on"`}, []string{"Hallway light ON", "Garage light ON"}},
+		{"automation filter", LogQuery{Text: "door", AutomationID: "garage_door"}, []string{"Door closed", "Door opened"}},
+		{"time range", LogQuery{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour)}, []string{"Hallway light ON", "Garage light ON"}},
+		{"minimum level", LogQuery{Level: LogLevelWarning}, []string{"ERROR: publish: not connected", "WARNING: zigbee2mqtt/motion: missing field occupancy"}},
+		{"level and automation", LogQuery{Level: LogLevelError, AutomationID: "garage_door"}, nil},
+		{"limit", LogQuery{Text: "garage", Limit: 1}, []string{"Door closed"}},
+		{"no match", LogQuery{Text: "kitchen"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			entries, _ := r.SearchLogs(tt.query)
+			for _, entry := range entries {
+				got = append(got, entry.Message)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("SearchLogs() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterLogs(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "lights", `
+config = {"name": "Lights"}
+
+def on_schedule(ctx):
+    ctx.log("first")
+    ctx.log("ERROR: looks like an error")
+    fail("lamp unreachable")
+`)
+	r.addLog("other", LogLevelInfo, "elsewhere")
+	r.RunManual("lights", ManualTrigger{})
+
+	var got []string
+	entries, _ := r.FilterLogs(LogQuery{AutomationID: "lights", Limit: 2})
+	for _, entry := range entries {
+		got = append(got, entry.Level+" "+entry.Message)
+	}
+	// ctx.log is info whatever its message says
+	want := []string{"info ERROR: looks like an error", "error ERROR: fail: lamp unreachable"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterLogs() = %q, want %q", got, want)
+	}
+	if got, _ := r.FilterLogs(LogQuery{AutomationID: "missing"}); got == nil || len(got) != 0 {
+		t.Errorf("FilterLogs(missing) = %#v, want an empty slice", got)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for input, want := range map[string]string{"info": LogLevelInfo, "WARN": LogLevelWarning, "warning": LogLevelWarning, "Error": LogLevelError} {
+		if got, err := ParseLogLevel(input); err != nil || got != want {
+			t.Errorf("ParseLogLevel(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseLogLevel("debug"); err == nil {
+		t.Error("ParseLogLevel(debug) should fail")
+	}
+}
@@ -0,0 +1,237 @@
+package runner
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+const (
+	defaultLoopWindow   = 500 * time.Millisecond
+	defaultLoopMaxDepth = 5
+
+	// threadLocalDepth holds how many publish→trigger hops led to the current run
+	threadLocalDepth = "homebrain.loop_depth"
+)
+
+// staticPublishes finds ctx.publish("literal/topic", ...) calls in source code
+func staticPublishes(filename string, src []byte) []string {
+	f, err := syntax.Parse(filename, src, 0)
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var topics []string
+	syntax.Walk(f, func(n syntax.Node) bool {
+		call, ok := n.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		dot, ok := call.Fn.(*syntax.DotExpr)
+		if !ok || dot.Name.Name != "publish" {
+			return true
+		}
+		lit, ok := call.Args[0].(*syntax.Literal)
+		if !ok || lit.Token != syntax.STRING {
+			return true
+		}
+		topic, _ := lit.Value.(string)
+		if topic != "" && !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+		return true
+	})
+	return topics
+}
+
+// triggers reports whether a publish of topic by from reaches a subscription of to
+func triggers(fromPublishes []string, to *Automation) bool {
+	for _, topic := range fromPublishes {
+		for _, filter := range to.Config.Subscribe {
+			if mqtt.MatchTopic(filter, topic) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findStaticLoop returns a cycle of automation IDs starting and ending at
+// start, following statically known publish → subscribe links, or nil.
+func findStaticLoop(start *Automation, others map[string]*Automation) []string {
+	all := make(map[string]*Automation, len(others)+1)
+	for id, a := range others {
+		all[id] = a
+	}
+	all[start.ID] = start
+
+	visited := map[string]bool{}
+	var path []string
+	var visit func(a *Automation) []string
+	visit = func(a *Automation) []string {
+		path = append(path, a.ID)
+		defer func() { path = path[:len(path)-1] }()
+
+		for _, next := range sortedAutomations(all) {
+			if !triggers(a.StaticPublishes, next) {
+				continue
+			}
+			if next.ID == start.ID {
+				return append(append([]string{}, path...), start.ID)
+			}
+			if visited[next.ID] {
+				continue
+			}
+			visited[next.ID] = true
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return visit(start)
+}
+
+// recentPublish remembers who published a topic, for runtime loop correlation
+type recentPublish struct {
+	automationID string
+	depth        int
+	at           time.Time
+}
+
+// loopDetector correlates publishes with the triggers they cause. A message
+// arriving shortly after an automation published it is treated as caused by
+// that publish; chains deeper than maxDepth are reported (and optionally broken).
+type loopDetector struct {
+	mu         sync.Mutex
+	window     time.Duration
+	maxDepth   int
+	breakLoops bool
+	recent     map[string]recentPublish
+}
+
+func newLoopDetector() *loopDetector {
+	return &loopDetector{
+		window:   defaultLoopWindow,
+		maxDepth: defaultLoopMaxDepth,
+		recent:   make(map[string]recentPublish),
+	}
+}
+
+// published records a publish made during a run at the given chain depth
+func (d *loopDetector) published(topic, automationID string, depth int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.recent[topic] = recentPublish{automationID: automationID, depth: depth + 1, at: now}
+
+	// Drop stale entries so the map doesn't grow with every topic ever published
+	if len(d.recent) > 1000 {
+		for t, p := range d.recent {
+			if now.Sub(p.at) > d.window {
+				delete(d.recent, t)
+			}
+		}
+	}
+}
+
+// cause returns the publisher and chain depth behind a message, if it was
+// published by an automation within the correlation window
+func (d *loopDetector) cause(topic string) (string, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p, ok := d.recent[topic]
+	if !ok || time.Since(p.at) > d.window {
+		return "", 0
+	}
+	return p.automationID, p.depth
+}
+
+// SetLoopGuard configures runtime loop detection. With breakLoops, triggers
+// beyond maxDepth chained publishes are dropped instead of only logged. A
+// zero window or maxDepth restores the default.
+func (r *Runner) SetLoopGuard(window time.Duration, maxDepth int, breakLoops bool) {
+	if window <= 0 {
+		window = defaultLoopWindow
+	}
+	if maxDepth <= 0 {
+		maxDepth = defaultLoopMaxDepth
+	}
+	r.loops.mu.Lock()
+	defer r.loops.mu.Unlock()
+	r.loops.window = window
+	r.loops.maxDepth = maxDepth
+	r.loops.breakLoops = breakLoops
+}
+
+// checkLoop inspects a message about to trigger an automation. It returns the
+// chain depth for the run and whether the run should go ahead.
+func (r *Runner) checkLoop(automation *Automation, topic string) (int, bool) {
+	publisher, depth := r.loops.cause(topic)
+	if publisher == "" {
+		return 0, true
+	}
+
+	if publisher == automation.ID && depth == 1 {
+		r.addLog(automation.ID, LogLevelWarning, fmt.Sprintf("WARNING: automation triggered itself via %s", topic))
+	}
+
+	r.loops.mu.Lock()
+	maxDepth, breakLoops := r.loops.maxDepth, r.loops.breakLoops
+	r.loops.mu.Unlock()
+
+	if depth <= maxDepth {
+		return depth, true
+	}
+	if depth == maxDepth+1 {
+		slog.Warn("Publish/subscribe loop detected", "automation", automation.ID, "topic", topic, "depth", depth, "break", breakLoops)
+		r.addLog(automation.ID, LogLevelWarning, fmt.Sprintf("WARNING: publish loop detected on %s (%d chained triggers)", topic, depth))
+	}
+	return depth, !breakLoops
+}
+
+// warnStaticLoop logs a warning if the automation can trigger itself,
+// directly or through other automations, based on literal publish topics
+func (r *Runner) warnStaticLoop(automation *Automation) {
+	r.mu.RLock()
+	cycle := findStaticLoop(automation, r.automations)
+	r.mu.RUnlock()
+
+	if cycle == nil {
+		return
+	}
+	msg := fmt.Sprintf("WARNING: possible publish loop: %s", strings.Join(cycle, " -> "))
+	slog.Warn("Possible publish loop", "cycle", cycle)
+	r.addLog(automation.ID, LogLevelWarning, msg)
+}
+
+// loopDepth returns the chain depth stored on a handler thread
+func loopDepth(thread *starlark.Thread) int {
+	if thread == nil {
+		return 0
+	}
+	depth, _ := thread.Local(threadLocalDepth).(int)
+	return depth
+}
+
+// sortedAutomations returns automations ordered by ID for deterministic traversal
+func sortedAutomations(automations map[string]*Automation) []*Automation {
+	result := make([]*Automation, 0, len(automations))
+	for _, a := range automations {
+		result = append(result, a)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
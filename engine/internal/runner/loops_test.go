@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStaticPublishes(t *testing.T) {
+	src := []byte(`
+def on_message(topic, payload, ctx):
+    ctx.publish("zigbee2mqtt/hallway_light/set", "ON")
+    ctx.publish(topic + "/set", "ON")
+    ctx.publish("zigbee2mqtt/hallway_light/set", "OFF")
+    ctx.log("publish")
+
+config = {"name": "x"}
+`)
+	got := staticPublishes("test.star", src)
+	want := []string{"zigbee2mqtt/hallway_light/set"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("staticPublishes = %v, want %v", got, want)
+	}
+}
+
+func TestFindStaticLoop(t *testing.T) {
+	a := &Automation{ID: "a", StaticPublishes: []string{"topic/b"}, Config: AutomationConfig{Subscribe: []string{"topic/a"}}}
+	b := &Automation{ID: "b", StaticPublishes: []string{"topic/a"}, Config: AutomationConfig{Subscribe: []string{"topic/b"}}}
+	c := &Automation{ID: "c", StaticPublishes: []string{"topic/x"}, Config: AutomationConfig{Subscribe: []string{"topic/c"}}}
+
+	if cycle := findStaticLoop(a, map[string]*Automation{"b": b, "c": c}); !reflect.DeepEqual(cycle, []string{"a", "b", "a"}) {
+		t.Errorf("findStaticLoop = %v, want [a b a]", cycle)
+	}
+	if cycle := findStaticLoop(c, map[string]*Automation{"a": a, "b": b}); cycle != nil {
+		t.Errorf("findStaticLoop = %v, want nil", cycle)
+	}
+
+	self := &Automation{ID: "self", StaticPublishes: []string{"topic/self"}, Config: AutomationConfig{Subscribe: []string{"topic/self"}}}
+	if cycle := findStaticLoop(self, nil); !reflect.DeepEqual(cycle, []string{"self", "self"}) {
+		t.Errorf("findStaticLoop self = %v, want [self self]", cycle)
+	}
+}
+
+func TestCheckLoop_BreaksRunawayChains(t *testing.T) {
+	r := &Runner{loops: newLoopDetector(), maxLogs: 100}
+	r.SetLoopGuard(time.Second, 2, true)
+	a := &Automation{ID: "pingpong"}
+
+	if depth, ok := r.checkLoop(a, "external/topic"); !ok || depth != 0 {
+		t.Errorf("external message: depth=%d ok=%v, want 0 true", depth, ok)
+	}
+
+	depth := 0
+	for i := 1; i <= 2; i++ {
+		r.loops.published("loop/topic", a.ID, depth)
+		var ok bool
+		depth, ok = r.checkLoop(a, "loop/topic")
+		if !ok || depth != i {
+			t.Fatalf("hop %d: depth=%d ok=%v", i, depth, ok)
+		}
+	}
+
+	r.loops.published("loop/topic", a.ID, depth)
+	if _, ok := r.checkLoop(a, "loop/topic"); ok {
+		t.Error("expected chain beyond max depth to be broken")
+	}
+}
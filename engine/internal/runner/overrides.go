@@ -0,0 +1,360 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/mqtt"
+	"github.com/homebrain/engine/internal/state"
+)
+
+const (
+	// maxOverrideDuration bounds ctx.override; longer changes belong in config
+	maxOverrideDuration = 7 * 24 * time.Hour
+
+	// overrideRetryDelay is the wait before retrying a failed revert
+	overrideRetryDelay = time.Minute
+)
+
+// ErrOverrideNotFound is returned when cancelling a target without an active override
+var ErrOverrideNotFound = errors.New("override not found")
+
+// errOverrideDenied is returned when an automation may not cancel an override
+var errOverrideDenied = errors.New("override not cancellable")
+
+// overrides holds the active ctx.override values and their revert timers,
+// keyed by target. They are also kept in the state store and re-armed when
+// the runner starts, so a value is reverted even if the automation that set
+// it has since been removed.
+type overrides struct {
+	mu     sync.Mutex
+	active map[string]*activeOverride
+}
+
+type activeOverride struct {
+	override state.Override
+	timer    *time.Timer
+}
+
+// deviceTargetPrefix marks an override target as an MQTT topic. Any other
+// target is a global key, whatever characters it contains.
+const deviceTargetPrefix = "mqtt:"
+
+// deviceTopic returns the MQTT topic of a device override target
+func deviceTopic(target string) (string, bool) {
+	return strings.CutPrefix(target, deviceTargetPrefix)
+}
+
+// setOverride arms the revert of an applied override. Overriding a target
+// that is already overridden keeps the first restore value, so extending a
+// boost still returns to the value from before it. The override is armed even
+// if persisting it fails; the error is returned so the caller can warn that
+// it won't survive a restart.
+func (r *Runner) setOverride(override state.Override) (state.Override, error) {
+	r.overrides.mu.Lock()
+	if existing, ok := r.overrides.active[override.Target]; ok {
+		override.Restore = existing.override.Restore
+	}
+	r.armOverride(override)
+	r.overrides.mu.Unlock()
+
+	if r.stateStore != nil {
+		if err := r.stateStore.SaveOverride(override); err != nil {
+			return override, err
+		}
+	}
+	return override, nil
+}
+
+// armOverride (re)starts the revert timer of override; r.overrides.mu must be held
+func (r *Runner) armOverride(override state.Override) {
+	if r.overrides.active == nil {
+		r.overrides.active = make(map[string]*activeOverride)
+	}
+	if existing, ok := r.overrides.active[override.Target]; ok {
+		existing.timer.Stop()
+	}
+	entry := &activeOverride{override: override}
+	entry.timer = time.AfterFunc(time.Until(override.Until), func() {
+		r.overrides.mu.Lock()
+		current := r.overrides.active[override.Target] == entry
+		if current {
+			delete(r.overrides.active, override.Target)
+		}
+		r.overrides.mu.Unlock()
+		// A replaced or cancelled override may already be expiring
+		if current {
+			r.expireOverride(override)
+		}
+	})
+	r.overrides.active[override.Target] = entry
+}
+
+// expireOverride reverts an override whose time is up, retrying later if the
+// revert fails
+func (r *Runner) expireOverride(override state.Override) {
+	if err := r.revertOverride(override); err != nil {
+		r.addLog(override.AutomationID, LogLevelError, fmt.Sprintf("ERROR: override %s: revert failed, retrying in %s: %s", override.Target, overrideRetryDelay, err))
+		override.Until = time.Now().Add(overrideRetryDelay)
+		r.overrides.mu.Lock()
+		if _, replaced := r.overrides.active[override.Target]; !replaced {
+			r.armOverride(override)
+		}
+		r.overrides.mu.Unlock()
+		return
+	}
+	r.addLog(override.AutomationID, LogLevelInfo, fmt.Sprintf("override %s expired and was reverted", override.Target))
+}
+
+// revertOverride puts back the restore value and forgets the override
+func (r *Runner) revertOverride(override state.Override) error {
+	if override.Device {
+		var payload string
+		if err := json.Unmarshal(override.Restore, &payload); err != nil {
+			return fmt.Errorf("invalid restore payload: %w", err)
+		}
+		var publisher Publisher
+		switch {
+		case r.throttle != nil:
+			publisher = r.throttle
+		case r.mqttClient != nil:
+			publisher = r.mqttClient
+		default:
+			return errors.New("MQTT is not connected")
+		}
+		topic, _ := deviceTopic(override.Target)
+		if err := publisher.Publish(topic, []byte(payload), mqtt.PublishOptions{QoS: mqtt.DefaultQoS}); err != nil {
+			return err
+		}
+	} else if r.stateStore != nil {
+		if len(override.Restore) == 0 {
+			if err := r.clearGlobal(nil, override.AutomationID, override.Target); err != nil {
+				return err
+			}
+		} else {
+			var restore any
+			if err := json.Unmarshal(override.Restore, &restore); err != nil {
+				return fmt.Errorf("invalid restore value: %w", err)
+			}
+			if err := r.setGlobal(nil, override.AutomationID, override.Target, restore); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.stateStore != nil {
+		if err := r.stateStore.DeleteOverride(override.Target); err != nil {
+			slog.Error("Failed to delete reverted override", "target", override.Target, "error", err)
+		}
+	}
+	return nil
+}
+
+// CancelOverride reverts an active override right away
+func (r *Runner) CancelOverride(target string) error {
+	return r.cancelOverride(target, nil)
+}
+
+// cancelOverride reverts the override of target if allowed, when set,
+// accepts it, and fails with errOverrideDenied otherwise
+func (r *Runner) cancelOverride(target string, allowed func(state.Override) bool) error {
+	r.overrides.mu.Lock()
+	entry, ok := r.overrides.active[target]
+	if ok && allowed != nil && !allowed(entry.override) {
+		r.overrides.mu.Unlock()
+		return errOverrideDenied
+	}
+	if ok {
+		entry.timer.Stop()
+		delete(r.overrides.active, target)
+	}
+	r.overrides.mu.Unlock()
+	if !ok {
+		return ErrOverrideNotFound
+	}
+
+	if err := r.revertOverride(entry.override); err != nil {
+		// Keep it pending so the revert is retried
+		entry.override.Until = time.Now().Add(overrideRetryDelay)
+		r.overrides.mu.Lock()
+		if _, replaced := r.overrides.active[target]; !replaced {
+			r.armOverride(entry.override)
+		}
+		r.overrides.mu.Unlock()
+		return err
+	}
+	r.addLog(entry.override.AutomationID, LogLevelInfo, fmt.Sprintf("override %s cancelled and reverted", target))
+	return nil
+}
+
+// GetOverrides returns the active overrides, soonest to expire first
+func (r *Runner) GetOverrides() []state.Override {
+	r.overrides.mu.Lock()
+	defer r.overrides.mu.Unlock()
+	list := make([]state.Override, 0, len(r.overrides.active))
+	for _, entry := range r.overrides.active {
+		list = append(list, entry.override)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Until.Equal(list[j].Until) {
+			return list[i].Until.Before(list[j].Until)
+		}
+		return list[i].Target < list[j].Target
+	})
+	return list
+}
+
+// restoreOverrides re-arms persisted overrides. Those that expired while the
+// engine was down are reverted right away.
+func (r *Runner) restoreOverrides() {
+	if r.stateStore == nil {
+		return
+	}
+	pending, err := r.stateStore.ListOverrides()
+	if err != nil {
+		slog.Error("Failed to restore overrides", "error", err)
+		return
+	}
+	r.overrides.mu.Lock()
+	defer r.overrides.mu.Unlock()
+	for _, override := range pending {
+		r.armOverride(override)
+	}
+}
+
+// overrideBuiltin implements ctx.override(target, value, duration, restore=None).
+// A target "mqtt:<topic>" is an MQTT topic: value is published now and
+// restore, which is then required, when the override ends. Any other target
+// is a global key that goes back to its previous value (or restore).
+func (c *Context) overrideBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var target string
+	var value, durationVal starlark.Value
+	var restore starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "target", &target, "value", &value, "duration", &durationVal, "restore?", &restore); err != nil {
+		return nil, err
+	}
+	if target == "" {
+		return nil, fmt.Errorf("%s: target must not be empty", fn.Name())
+	}
+	seconds, ok := starlark.AsFloat(durationVal)
+	if !ok || seconds <= 0 {
+		return nil, fmt.Errorf("%s: duration must be a positive number of seconds", fn.Name())
+	}
+	duration := time.Duration(seconds * float64(time.Second))
+	if duration > maxOverrideDuration {
+		return nil, fmt.Errorf("%s: duration must be at most %s", fn.Name(), maxOverrideDuration)
+	}
+	if c.setOverride == nil {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+
+	override := state.Override{Target: target, AutomationID: c.automationID, Until: c.now().Add(duration)}
+	var applied starlark.Value
+	var err error
+	if topic, ok := deviceTopic(target); ok {
+		if topic == "" {
+			return nil, fmt.Errorf("%s: target %s has no topic", fn.Name(), target)
+		}
+		override.Device = true
+		payload, ok := overridePayload(value)
+		if !ok {
+			return nil, fmt.Errorf("%s: payload for topic %s must be string or bytes, got %s", fn.Name(), topic, value.Type())
+		}
+		restorePayload, ok := overridePayload(restore)
+		if !ok {
+			return nil, fmt.Errorf("%s: restore payload (string or bytes) is required for topic %s", fn.Name(), topic)
+		}
+		override.Value, _ = json.Marshal(payload)
+		override.Restore, _ = json.Marshal(restorePayload)
+		applied, err = c.publish(thread, fn, starlark.Tuple{starlark.String(topic), value}, nil)
+	} else {
+		if override.Value, err = encodeOverrideValue(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		if restore != starlark.None {
+			if override.Restore, err = encodeOverrideValue(restore); err != nil {
+				return nil, fmt.Errorf("%s: restore: %w", fn.Name(), err)
+			}
+		} else if previous, _ := c.stateStore.GetGlobalState(target); previous != nil {
+			override.Restore, _ = json.Marshal(previous)
+		}
+		applied, err = c.setGlobal(thread, fn, starlark.Tuple{starlark.String(target), value}, nil)
+	}
+	if err != nil || applied != starlark.True {
+		return applied, err
+	}
+
+	if _, err := c.setOverride(override); err != nil {
+		c.logFunc(c.automationID, LogLevelWarning, fmt.Sprintf("WARNING: override %s will not be reverted after a restart: %s", target, err))
+	}
+	return starlark.True, nil
+}
+
+// cancelOverrideBuiltin implements ctx.cancel_override(target): the override
+// is reverted now. True if one was active. Overrides set by other automations
+// can only be cancelled with permission to write the target, as declared in
+// global_state_writes or, in strict mode, publishes.
+func (c *Context) cancelOverrideBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var target string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "target", &target); err != nil {
+		return nil, err
+	}
+	if c.cancelOverride == nil {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	topic, device := deviceTopic(target)
+	var owner string
+	err := c.cancelOverride(target, func(override state.Override) bool {
+		owner = override.AutomationID
+		if owner == c.automationID {
+			return true
+		}
+		if device {
+			return !c.denyPublish("", topic)
+		}
+		return c.canWriteGlobalKey(target)
+	})
+	if errors.Is(err, ErrOverrideNotFound) {
+		return starlark.False, nil
+	}
+	if errors.Is(err, errOverrideDenied) {
+		denied := permissionDenied(target, "global_state_writes")
+		if device {
+			denied = permissionDenied(topic, "publishes")
+		}
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: set by %s and %s", fn.Name(), target, owner, denied))
+		return failed(thread, fn, errCodePermissionDenied, target, fmt.Errorf("override set by %s: %w", owner, denied))
+	}
+	if err != nil {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: %s (retrying)", fn.Name(), target, err))
+	}
+	return starlark.True, nil
+}
+
+// overridePayload returns the MQTT payload of a string or bytes value
+func overridePayload(v starlark.Value) (string, bool) {
+	switch v := v.(type) {
+	case starlark.String:
+		return string(v), true
+	case starlark.Bytes:
+		return string(v), true
+	}
+	return "", false
+}
+
+func encodeOverrideValue(v starlark.Value) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, v, -1); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
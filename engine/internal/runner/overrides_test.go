@@ -0,0 +1,149 @@
+package runner
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// waitForGlobal polls until a global key holds want
+func waitForGlobal(t *testing.T, store *state.Store, key string, want any) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if got, _ := store.GetGlobalState(key); got == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	got, _ := store.GetGlobalState(key)
+	t.Fatalf("global %s = %v, want %v", key, got, want)
+}
+
+func TestOverride(t *testing.T) {
+	store, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+	store.SetGlobalState("heating.boost", false)
+
+	recorder := &publishRecorder{}
+	r := newTestRunner()
+	r.stateStore = store
+	r.throttle = newPublishThrottle(recorder, nil)
+	a := addTestAutomation(t, r, "boost_button", `
+config = {"name": "Boost", "subscribe": ["button"], "global_state_writes": ["heating.*"]}
+
+def on_message(topic, payload, ctx):
+    if payload == "boost":
+        ctx.override("heating.boost", True, 0.1)
+        return ctx.override("heating.boost", True, 0.1)
+    if payload == "heater":
+        return ctx.override("mqtt:zigbee2mqtt/heater/set", '{"state": "ON"}', 3600, restore = '{"state": "OFF"}')
+    if payload == "zone":
+        return ctx.override("heating.zone/bath", True, 3600)
+    if payload == "cancel":
+        return ctx.cancel_override("mqtt:zigbee2mqtt/heater/set")
+    ctx.override("mqtt:zigbee2mqtt/heater/set", "ON", 60)
+`)
+	a.context.stateStore = store
+	a.context.mqttClient = recorder
+	a.context.setOverride = r.setOverride
+	a.context.cancelOverride = r.cancelOverride
+
+	// Overriding again extends the boost but still restores the original value
+	record, err := r.handleMessage(a, Trigger{Type: TriggerMQTT, Topic: "button", Time: time.Now()}, []byte("boost"))
+	if err != nil || record.Result != true {
+		t.Fatalf("override = %v, %v", record.Result, err)
+	}
+	if got, _ := store.GetGlobalState("heating.boost"); got != true {
+		t.Errorf("heating.boost = %v during the override", got)
+	}
+	if overrides := r.GetOverrides(); len(overrides) != 1 || string(overrides[0].Restore) != "false" {
+		t.Fatalf("GetOverrides = %+v", overrides)
+	}
+	waitForGlobal(t, store, "heating.boost", false)
+	if pending, _ := store.ListOverrides(); len(pending) != 0 || len(r.GetOverrides()) != 0 {
+		t.Errorf("expired override still pending: %+v", pending)
+	}
+
+	// Device overrides publish now and publish restore when cancelled
+	if record, _ := r.handleMessage(a, Trigger{Type: TriggerMQTT, Topic: "button", Time: time.Now()}, []byte("heater")); record.Result != true {
+		t.Fatalf("device override = %v (%s)", record.Result, record.Error)
+	}
+	if record, _ := r.handleMessage(a, Trigger{Type: TriggerMQTT, Topic: "button", Time: time.Now()}, []byte("cancel")); record.Result != true {
+		t.Fatalf("cancel_override = %v (%s)", record.Result, record.Error)
+	}
+	messages := recorder.snapshot()
+	if len(messages) != 2 || messages[0].Topic != "zigbee2mqtt/heater/set" || messages[0].Payload != `{"state": "ON"}` || messages[1].Payload != `{"state": "OFF"}` {
+		t.Errorf("published = %+v", messages)
+	}
+
+	// Only the mqtt: prefix makes a device target; other keys may contain "/"
+	if record, _ := r.handleMessage(a, Trigger{Type: TriggerMQTT, Topic: "button", Time: time.Now()}, []byte("zone")); record.Result != true {
+		t.Fatalf("override of heating.zone/bath = %v (%s)", record.Result, record.Error)
+	}
+	if got, _ := store.GetGlobalState("heating.zone/bath"); got != true || len(recorder.snapshot()) != 2 {
+		t.Errorf("heating.zone/bath = %v, published %+v", got, recorder.snapshot())
+	}
+	// Other automations need permission to write the target to cancel
+	other := addTestAutomation(t, r, "guest_mode", `
+config = {"name": "Guest", "subscribe": ["guest"]}
+
+def on_message(topic, payload, ctx):
+    if ctx.cancel_override("heating.zone/bath"):
+        return "cancelled"
+    return ctx.last_error().code
+`)
+	other.context.stateStore = store
+	other.context.cancelOverride = r.cancelOverride
+	if record, _ := r.handleMessage(other, Trigger{Type: TriggerMQTT, Topic: "guest", Time: time.Now()}, []byte("on")); record.Result != "permission_denied" {
+		t.Errorf("foreign cancel_override = %v (%s)", record.Result, record.Error)
+	}
+	if len(r.GetOverrides()) != 1 {
+		t.Errorf("denied cancel reverted the override: %+v", r.GetOverrides())
+	}
+	if err := r.CancelOverride("heating.zone/bath"); err != nil {
+		t.Errorf("cancel heating.zone/bath = %v", err)
+	}
+	if err := r.CancelOverride("mqtt:zigbee2mqtt/heater/set"); !errors.Is(err, ErrOverrideNotFound) {
+		t.Errorf("second cancel = %v, want ErrOverrideNotFound", err)
+	}
+
+	if record, _ := r.handleMessage(a, Trigger{Type: TriggerMQTT, Topic: "button", Time: time.Now()}, []byte("norestore")); record.Error == "" {
+		t.Error("device override without restore should fail")
+	}
+
+	// Overrides that expired while the engine was down are reverted on start
+	store.SetGlobalState("heating.mode", "boost")
+	store.SaveOverride(state.Override{Target: "heating.mode", AutomationID: "removed_automation", Value: []byte(`"boost"`), Until: time.Now().Add(-time.Minute)})
+	r.restoreOverrides()
+	waitForGlobal(t, store, "heating.mode", nil)
+}
+
+func TestDryRunOverride(t *testing.T) {
+	r := newTestRunner()
+	result, err := r.DryRun(DryRunRequest{
+		Code: `
+config = {"name": "Boost", "subscribe": ["button"], "global_state_writes": ["heating.*"]}
+
+def on_message(topic, payload, ctx):
+    ctx.override("heating.boost", True, 3600)
+`,
+		Trigger: Trigger{Type: TriggerMQTT, Topic: "button"},
+		Global:  map[string]any{"heating.boost": false},
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("DryRun = %+v, %v", result, err)
+	}
+	if result.Global["heating.boost"] != true {
+		t.Errorf("global = %v", result.Global)
+	}
+	if len(result.Overrides) != 1 || result.Overrides[0].Seconds != 3600 || string(result.Overrides[0].Restore) != "false" {
+		t.Errorf("overrides = %+v", result.Overrides)
+	}
+}
@@ -0,0 +1,370 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/homebrain/engine/internal/mqtt"
+	"go.starlark.net/starlark"
+)
+
+// errSchemaViolation is returned for messages whose payload doesn't match the
+// subscription's schema; the handler is not run
+var errSchemaViolation = errors.New("payload does not match schema")
+
+// PayloadSchema describes the JSON payload expected on a subscription. It is
+// a subset of JSON Schema; the simple type map form is converted to it.
+type PayloadSchema struct {
+	Type       string                    `json:"type,omitempty"` // Empty accepts any value
+	Properties map[string]*PayloadSchema `json:"properties,omitempty"`
+	Required   []string                  `json:"required,omitempty"`
+	Items      *PayloadSchema            `json:"items,omitempty"`
+	Enum       []any                     `json:"enum,omitempty"`
+	Minimum    *float64                  `json:"minimum,omitempty"`
+	Maximum    *float64                  `json:"maximum,omitempty"`
+}
+
+// schemaTypes maps the type names accepted in schemas to JSON Schema types
+var schemaTypes = map[string]string{
+	"string":  "string",
+	"number":  "number",
+	"float":   "number",
+	"integer": "integer",
+	"int":     "integer",
+	"boolean": "boolean",
+	"bool":    "boolean",
+	"object":  "object",
+	"dict":    "object",
+	"array":   "array",
+	"list":    "array",
+	"null":    "null",
+	"any":     "",
+}
+
+// jsonSchemaKeywords are the keys that mark a dict as JSON Schema rather than
+// a simple type map; unsupported annotations are accepted and ignored
+var jsonSchemaKeywords = map[string]bool{
+	"$schema": true, "title": true, "description": true, "additionalProperties": true,
+	"type": true, "properties": true, "required": true, "items": true,
+	"enum": true, "minimum": true, "maximum": true,
+}
+
+// parsePayloadSchema reads a subscription schema, either JSON Schema
+// ({"type": "object", "properties": {...}, "required": [...]}) or a simple
+// type map ({"temperature": "number", "battery": "int?"}) where a trailing
+// "?" marks an optional field, a nested dict is an object and a one-element
+// list is an array of that type
+func parsePayloadSchema(v starlark.Value) (*PayloadSchema, error) {
+	dict, ok := v.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("schema must be a dict")
+	}
+	if isJSONSchema(dict) {
+		return parseJSONSchema(dict)
+	}
+	return parseTypeMap(dict)
+}
+
+func isJSONSchema(dict *starlark.Dict) bool {
+	if _, found, _ := dict.Get(starlark.String("type")); !found {
+		return false
+	}
+	for _, k := range dict.Keys() {
+		if s, ok := k.(starlark.String); !ok || !jsonSchemaKeywords[string(s)] {
+			return false
+		}
+	}
+	return true
+}
+
+func parseJSONSchema(dict *starlark.Dict) (*PayloadSchema, error) {
+	schema := &PayloadSchema{}
+	if v, found, _ := dict.Get(starlark.String("type")); found {
+		s, ok := v.(starlark.String)
+		t, known := schemaTypes[string(s)]
+		if !ok || !known {
+			return nil, fmt.Errorf("unknown type %s", v)
+		}
+		schema.Type = t
+	}
+	if v, found, _ := dict.Get(starlark.String("properties")); found {
+		props, ok := v.(*starlark.Dict)
+		if !ok {
+			return nil, fmt.Errorf("properties must be a dict")
+		}
+		schema.Properties = make(map[string]*PayloadSchema, props.Len())
+		for _, item := range props.Items() {
+			name, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("property names must be strings")
+			}
+			propDict, ok := item[1].(*starlark.Dict)
+			if !ok {
+				return nil, fmt.Errorf("%s: property schema must be a dict", name)
+			}
+			prop, err := parseJSONSchema(propDict)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			schema.Properties[string(name)] = prop
+		}
+	}
+	if v, found, _ := dict.Get(starlark.String("required")); found {
+		required, err := stringList(v)
+		if err != nil {
+			return nil, fmt.Errorf("required %w", err)
+		}
+		schema.Required = required
+	}
+	if v, found, _ := dict.Get(starlark.String("items")); found {
+		itemsDict, ok := v.(*starlark.Dict)
+		if !ok {
+			return nil, fmt.Errorf("items must be a dict")
+		}
+		items, err := parseJSONSchema(itemsDict)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		schema.Items = items
+	}
+	if v, found, _ := dict.Get(starlark.String("enum")); found {
+		list, ok := v.(*starlark.List)
+		if !ok {
+			return nil, fmt.Errorf("enum must be a list")
+		}
+		for i := 0; i < list.Len(); i++ {
+			schema.Enum = append(schema.Enum, starlarkToGo(list.Index(i)))
+		}
+	}
+	for _, bound := range []struct {
+		key  string
+		dest **float64
+	}{{"minimum", &schema.Minimum}, {"maximum", &schema.Maximum}} {
+		if v, found, _ := dict.Get(starlark.String(bound.key)); found {
+			f, ok := starlark.AsFloat(v)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a number", bound.key)
+			}
+			*bound.dest = &f
+		}
+	}
+	return schema, nil
+}
+
+func parseTypeMap(dict *starlark.Dict) (*PayloadSchema, error) {
+	schema := &PayloadSchema{Type: "object", Properties: make(map[string]*PayloadSchema, dict.Len())}
+	for _, item := range dict.Items() {
+		name, ok := item[0].(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("field names must be strings")
+		}
+		field, optional, err := parseFieldType(item[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		schema.Properties[string(name)] = field
+		if !optional {
+			schema.Required = append(schema.Required, string(name))
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema, nil
+}
+
+// parseFieldType reads one field of a simple type map
+func parseFieldType(v starlark.Value) (*PayloadSchema, bool, error) {
+	switch v := v.(type) {
+	case starlark.String:
+		name, optional := strings.CutSuffix(string(v), "?")
+		t, known := schemaTypes[name]
+		if !known {
+			return nil, false, fmt.Errorf("unknown type %q", name)
+		}
+		return &PayloadSchema{Type: t}, optional, nil
+	case *starlark.Dict:
+		schema, err := parsePayloadSchema(v)
+		return schema, false, err
+	case *starlark.List:
+		if v.Len() != 1 {
+			return nil, false, fmt.Errorf("list type must have exactly one element type")
+		}
+		items, _, err := parseFieldType(v.Index(0))
+		if err != nil {
+			return nil, false, err
+		}
+		return &PayloadSchema{Type: "array", Items: items}, false, nil
+	}
+	return nil, false, fmt.Errorf("type must be a string, dict or list")
+}
+
+// typed validates a decoded JSON value and converts it for the handler:
+// integer fields become ints, and optional object fields that are missing
+// are set to None so handlers can index them without checking
+func (s *PayloadSchema) typed(value any, path string) (starlark.Value, error) {
+	if s == nil {
+		return goToStarlark(value), nil
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		return nil, fmt.Errorf("%s: %v is not one of the allowed values", pathName(path), value)
+	}
+
+	switch s.Type {
+	case "":
+		return goToStarlark(value), nil
+	case "null":
+		if value != nil {
+			return nil, mismatch(path, "null", value)
+		}
+		return starlark.None, nil
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return nil, mismatch(path, "string", value)
+		}
+		return starlark.String(str), nil
+	case "boolean":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, mismatch(path, "boolean", value)
+		}
+		return starlark.Bool(b), nil
+	case "number", "integer":
+		f, ok := value.(float64)
+		if !ok || (s.Type == "integer" && f != math.Trunc(f)) {
+			return nil, mismatch(path, s.Type, value)
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return nil, fmt.Errorf("%s: %v is below the minimum %v", pathName(path), f, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return nil, fmt.Errorf("%s: %v is above the maximum %v", pathName(path), f, *s.Maximum)
+		}
+		if s.Type == "integer" {
+			return starlark.MakeInt64(int64(f)), nil
+		}
+		return starlark.Float(f), nil
+	case "array":
+		list, ok := value.([]any)
+		if !ok {
+			return nil, mismatch(path, "array", value)
+		}
+		elems := make([]starlark.Value, len(list))
+		for i, item := range list {
+			elem, err := s.Items.typed(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return starlark.NewList(elems), nil
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil, mismatch(path, "object", value)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return nil, fmt.Errorf("%s: missing required field", pathName(join(path, name)))
+			}
+		}
+		names := make([]string, 0, len(obj)+len(s.Properties))
+		for name := range obj {
+			names = append(names, name)
+		}
+		for name := range s.Properties {
+			if _, ok := obj[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		dict := starlark.NewDict(len(names))
+		for _, name := range names {
+			fieldValue, present := obj[name]
+			if !present {
+				dict.SetKey(starlark.String(name), starlark.None)
+				continue
+			}
+			field, err := s.Properties[name].typed(fieldValue, join(path, name))
+			if err != nil {
+				return nil, err
+			}
+			dict.SetKey(starlark.String(name), field)
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("unknown schema type %q", s.Type)
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, allowed := range enum {
+		if sameValue(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func mismatch(path, want string, value any) error {
+	return fmt.Errorf("%s: expected %s, got %s", pathName(path), want, describe(value))
+}
+
+// describe names a decoded JSON value's type for error messages
+func describe(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func pathName(path string) string {
+	if path == "" {
+		return "payload"
+	}
+	return path
+}
+
+// messagePayload returns the payload argument for on_message: the raw payload
+// as a string, or the validated, typed value when the first subscription
+// matching topic declares a schema
+func messagePayload(config AutomationConfig, topic string, payload []byte, decoded *payloadJSON) (starlark.Value, error) {
+	for _, pattern := range config.Subscribe {
+		schema := config.Schemas[pattern]
+		if schema == nil || !mqtt.MatchTopic(pattern, topic) {
+			continue
+		}
+		if decoded == nil {
+			decoded = newPayloadJSON(payload)
+		}
+		value, ok := decoded.get()
+		if !ok {
+			return nil, fmt.Errorf("%w: payload is not JSON", errSchemaViolation)
+		}
+		typed, err := schema.typed(value, "")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errSchemaViolation, err)
+		}
+		return typed, nil
+	}
+	return starlark.String(payload), nil
+}
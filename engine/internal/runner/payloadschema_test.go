@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPayloadSchema(t *testing.T) {
+	typeMap, err := execConfig(t, `config = {"name": "T", "subscribe": [{"topic": "sensors/+", "schema": {
+    "temperature": "number",
+    "battery": "int?",
+    "state": "string?",
+    "location": {"room": "string"},
+    "readings": ["number"],
+}}]}`)
+	if err != nil {
+		t.Fatalf("type map schema: %v", err)
+	}
+	jsonSchema, err := execConfig(t, `config = {"name": "T", "subscribe": [{"topic": "sensors/+", "schema": {
+    "$schema": "https://json-schema.org/draft/2020-12/schema",
+    "type": "object",
+    "properties": {
+        "temperature": {"type": "number", "minimum": -40, "maximum": 80},
+        "battery": {"type": "integer"},
+        "state": {"type": "string", "enum": ["ON", "OFF"]},
+        "location": {"type": "object", "properties": {"room": {"type": "string"}}, "required": ["room"]},
+        "readings": {"type": "array", "items": {"type": "number"}},
+    },
+    "required": ["temperature", "location", "readings"],
+}}]}`)
+	if err != nil {
+		t.Fatalf("JSON schema: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		want    string // Handler argument, or the error if it isn't a dict
+	}{
+		{"complete", `{"temperature": 21.5, "battery": 87, "state": "ON", "location": {"room": "hall"}, "readings": [1, 2.5]}`,
+			`{"battery": 87, "location": {"room": "hall"}, "readings": [1.0, 2.5], "state": "ON", "temperature": 21.5}`},
+		{"optional fields missing", `{"temperature": 21, "location": {"room": "hall"}, "readings": []}`,
+			`{"battery": None, "location": {"room": "hall"}, "readings": [], "state": None, "temperature": 21.0}`},
+		{"extra fields kept", `{"temperature": 21, "location": {"room": "hall"}, "readings": [], "linkquality": 90}`,
+			`{"battery": None, "linkquality": 90.0, "location": {"room": "hall"}, "readings": [], "state": None, "temperature": 21.0}`},
+		{"missing field", `{"location": {"room": "hall"}, "readings": []}`, "temperature: missing required field"},
+		{"nested missing field", `{"temperature": 21, "location": {}, "readings": []}`, "location.room: missing required field"},
+		{"wrong type", `{"temperature": "warm", "location": {"room": "hall"}, "readings": []}`, "temperature: expected number, got string"},
+		{"fractional integer", `{"temperature": 21, "battery": 8.5, "location": {"room": "hall"}, "readings": []}`, "battery: expected integer, got number"},
+		{"array element", `{"temperature": 21, "location": {"room": "hall"}, "readings": [1, "x"]}`, "readings[1]: expected number, got string"},
+		{"not an object", `[1, 2]`, "payload: expected object, got array"},
+		{"not JSON", `hello`, "payload is not JSON"},
+	}
+	for _, tt := range tests {
+		for form, config := range map[string]AutomationConfig{"type map": typeMap, "JSON schema": jsonSchema} {
+			got, err := messagePayload(config, "sensors/hall", []byte(tt.payload), nil)
+			if !strings.HasPrefix(tt.want, "{") {
+				if !errors.Is(err, errSchemaViolation) || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("%s (%s): err = %v, want %q", tt.name, form, err, tt.want)
+				}
+				continue
+			}
+			if err != nil || got.String() != tt.want {
+				t.Errorf("%s (%s): got %v, %v; want %s", tt.name, form, got, err, tt.want)
+			}
+		}
+	}
+
+	// JSON Schema-only constraints
+	for payload, want := range map[string]string{
+		`{"temperature": 95, "location": {"room": "hall"}, "readings": []}`:                 "temperature: 95 is above the maximum 80",
+		`{"temperature": 20, "state": "DIM", "location": {"room": "hall"}, "readings": []}`: "state: DIM is not one of the allowed values",
+	} {
+		if _, err := messagePayload(jsonSchema, "sensors/hall", []byte(payload), nil); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", payload, err, want)
+		}
+	}
+
+	// Topics without a schema still get the raw payload
+	if got, err := messagePayload(typeMap, "other/topic", []byte("hello"), nil); err != nil || got.String() != `"hello"` {
+		t.Errorf("unmatched topic: got %v, %v", got, err)
+	}
+}
+
+func TestParsePayloadSchema_Errors(t *testing.T) {
+	for _, schema := range []string{
+		`"number"`,
+		`{"temperature": "decimal"}`,
+		`{"readings": ["number", "string"]}`,
+		`{"temperature": 42}`,
+		`{"type": "object", "properties": {"x": {"type": "decimal"}}}`,
+		`{"type": "object", "required": "x"}`,
+	} {
+		_, err := execConfig(t, `config = {"name": "T", "subscribe": [{"topic": "a", "schema": `+schema+`}]}`)
+		if err == nil {
+			t.Errorf("schema %s: expected an error", schema)
+		}
+	}
+}
+
+func TestHandleMessage_SchemaViolation(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "thermostat", `
+config = {"name": "Thermostat", "subscribe": [{"topic": "sensors/thermostat", "schema": {"temperature": "number"}}]}
+
+def on_message(topic, payload, ctx):
+    ctx.log("temperature %s" % payload["temperature"])
+`)
+
+	if _, err := r.RunManual("thermostat", ManualTrigger{Topic: "sensors/thermostat", Payload: `{"temperature": 19}`}); err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	_, err := r.RunManual("thermostat", ManualTrigger{Topic: "sensors/thermostat", Payload: `{"humidity": 40}`})
+	if !errors.Is(err, errSchemaViolation) {
+		t.Fatalf("RunManual error = %v, want a schema violation", err)
+	}
+
+	logs := r.GetLogs()
+	if len(logs) != 2 || logs[0].Message != "temperature 19.0" || !strings.HasPrefix(logs[1].Message, "WARNING: sensors/thermostat: payload does not match schema") {
+		t.Errorf("logs = %+v", logs)
+	}
+	if runs := r.GetRuns("thermostat"); len(runs) != 1 {
+		t.Errorf("runs = %+v, want only the valid message to run", runs)
+	}
+}
@@ -0,0 +1,168 @@
+package runner
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// PresenceKeyPrefix prefixes the global keys holding each tracked person's
+// presence, "home" or "away", so automations can also watch them with
+// watch_global
+const PresenceKeyPrefix = "presence.person."
+
+// presenceWriter is reported as the writer of presence keys to on_state_change
+const presenceWriter = "presence"
+
+// PersonPresence is whether a tracked person is home
+type PersonPresence struct {
+	Name  string `json:"name"`
+	Home  bool   `json:"home"`
+	Known bool   `json:"known"` // False until a tracker has reported
+}
+
+// SetPresence sets the tracked persons, for ctx.presence. Their presence is
+// reported with PresenceChanged.
+func (r *Runner) SetPresence(persons []string) {
+	r.persons = slices.Clone(persons)
+}
+
+// Presence returns the tracked persons, sorted by name
+func (r *Runner) Presence() []PersonPresence {
+	return personPresence(r.stateStore, r.persons)
+}
+
+func personPresence(store StateBackend, persons []string) []PersonPresence {
+	result := make([]PersonPresence, 0, len(persons))
+	for _, name := range persons {
+		p := PersonPresence{Name: name}
+		if store != nil {
+			if v, err := store.GetGlobalState(PresenceKeyPrefix + name); err == nil && v != nil {
+				p.Known = true
+				p.Home = v == "home"
+			}
+		}
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// PresenceChanged records that person arrived or left, then runs
+// on_presence_change(person, home, ctx) in every automation defining it.
+// The first report for a person, with nothing stored yet, only records it.
+func (r *Runner) PresenceChanged(person string, home bool) {
+	if r.stateStore == nil {
+		return
+	}
+	key := PresenceKeyPrefix + person
+	value := "away"
+	if home {
+		value = "home"
+	}
+	old, _ := r.stateStore.GetGlobalState(key)
+	if sameValue(old, value) {
+		return
+	}
+	if err := r.setGlobal(nil, presenceWriter, key, value); err != nil {
+		slog.Error("Failed to store presence", "person", person, "error", err)
+		return
+	}
+	slog.Info("Presence changed", "person", person, "state", value)
+	if old == nil {
+		return
+	}
+
+	r.mu.RLock()
+	var handlers []*Automation
+	for _, a := range sortedAutomations(r.automations) {
+		if a.onPresence != nil {
+			handlers = append(handlers, a)
+		}
+	}
+	r.mu.RUnlock()
+
+	trigger := Trigger{Type: TriggerPresence, Person: person, Key: key, Time: time.Now()}
+	for _, a := range handlers {
+		a := a
+		r.dispatcher.submitSerial(a.ID, a.Config.Priority, func() {
+			r.execute(a, trigger, "on_presence_change", a.onPresence, starlark.String(person), starlark.Bool(home))
+		})
+	}
+}
+
+// presenceModule returns ctx.presence
+func (c *Context) presenceModule() *starlarkstruct.Struct {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"anyone_home": starlark.NewBuiltin("presence.anyone_home", c.presenceAnyoneHome),
+		"is_home":     starlark.NewBuiltin("presence.is_home", c.presenceIsHome),
+		"who_is_home": starlark.NewBuiltin("presence.who_is_home", c.presenceWhoIsHome),
+	})
+}
+
+// presence returns the tracked persons, or an error if there are none
+func (c *Context) presence(fn *starlark.Builtin) ([]PersonPresence, error) {
+	if len(c.persons) == 0 {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	return personPresence(c.stateStore, c.persons), nil
+}
+
+// presenceAnyoneHome implements ctx.presence.anyone_home()
+func (c *Context) presenceAnyoneHome(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	persons, err := c.presence(fn)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range persons {
+		if p.Home {
+			return starlark.True, nil
+		}
+	}
+	return starlark.False, nil
+}
+
+// presenceIsHome implements ctx.presence.is_home(person)
+func (c *Context) presenceIsHome(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "person", &name); err != nil {
+		return nil, err
+	}
+	persons, err := c.presence(fn)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range persons {
+		if p.Name == name {
+			return starlark.Bool(p.Home), nil
+		}
+	}
+	return nil, fmt.Errorf("%s: unknown person %q (tracked: %v)", fn.Name(), name, c.persons)
+}
+
+// presenceWhoIsHome implements ctx.presence.who_is_home(): the names of the
+// persons at home, sorted
+func (c *Context) presenceWhoIsHome(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	persons, err := c.presence(fn)
+	if err != nil {
+		return nil, err
+	}
+	var home []starlark.Value
+	for _, p := range persons {
+		if p.Home {
+			home = append(home, starlark.String(p.Name))
+		}
+	}
+	return starlark.NewList(home), nil
+}
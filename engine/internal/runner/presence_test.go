@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestPresence(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	r.SetPresence([]string{"bob", "alice"})
+	a := expiryTestAutomation(t, r, "welcome", `
+config = {"name": "Welcome"}
+
+def on_presence_change(person, home, ctx):
+    ctx.log("%s %s via %s: home=%s anyone=%s" % (
+        person, home, ctx.trigger.type, ctx.presence.who_is_home(), ctx.presence.anyone_home()))
+
+def on_message(topic, payload, ctx):
+    ctx.log("alice home: %s" % ctx.presence.is_home(payload))
+`)
+	a.onPresence, _ = a.globals["on_presence_change"].(starlark.Callable)
+	a.context.persons = r.persons
+
+	// The first report only records the person's presence
+	r.PresenceChanged("alice", true)
+	if got := r.Presence(); len(got) != 2 || got[0] != (PersonPresence{Name: "alice", Home: true, Known: true}) || got[1].Known {
+		t.Errorf("Presence() = %+v", got)
+	}
+	if value, _ := r.stateStore.GetGlobalState("presence.person.alice"); value != "home" {
+		t.Errorf("stored presence = %v, want home", value)
+	}
+
+	r.PresenceChanged("bob", false)
+	r.PresenceChanged("bob", true)
+	waitForLog(t, r, "bob True via presence: home=[\"alice\", \"bob\"] anyone=True")
+
+	if _, err := r.RunManual("welcome", ManualTrigger{Topic: "test", Payload: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, r, "alice home: True")
+	if _, err := r.RunManual("welcome", ManualTrigger{Topic: "test", Payload: "carol"}); err == nil || !strings.Contains(err.Error(), `unknown person "carol"`) {
+		t.Errorf("is_home(carol) error = %v", err)
+	}
+}
+
+func TestPresence_NotTracked(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	addTestAutomation(t, r, "probe", `
+config = {"name": "Probe"}
+
+def on_message(topic, payload, ctx):
+    ctx.presence.anyone_home()
+`)
+	if _, err := r.RunManual("probe", ManualTrigger{Topic: "test", Payload: "{}"}); err == nil || !strings.Contains(err.Error(), "presence.anyone_home: not available") {
+		t.Errorf("anyone_home() without tracked persons error = %v", err)
+	}
+}
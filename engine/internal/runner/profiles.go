@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"go.starlark.net/starlark"
+)
+
+// ProfileKey is the global key holding the active profile, so automations
+// can watch it with watch_global and its switches show up in the history
+const ProfileKey = "homebrain.profile"
+
+// DefaultProfiles are available unless SetProfiles picks others; the first
+// one is active until a profile is chosen
+var DefaultProfiles = []string{"home", "away", "vacation", "guest"}
+
+// ErrUnknownProfile is returned when switching to a profile that isn't configured
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// profiles holds the configured profile names and who to tell about switches
+type profiles struct {
+	mu       sync.RWMutex
+	names    []string
+	onSwitch func(profile string)
+}
+
+// SetProfiles replaces the available profiles. The first is the default.
+func (r *Runner) SetProfiles(names []string) error {
+	if len(names) == 0 {
+		return errors.New("at least one profile is required")
+	}
+	for i, name := range names {
+		if name == "" || slices.Contains(names[:i], name) {
+			return fmt.Errorf("invalid profile list %v: names must be unique and non-empty", names)
+		}
+	}
+	r.profiles.mu.Lock()
+	r.profiles.names = slices.Clone(names)
+	r.profiles.mu.Unlock()
+	return nil
+}
+
+// OnProfileSwitch registers fn to be called with the new profile whenever it changes
+func (r *Runner) OnProfileSwitch(fn func(profile string)) {
+	r.profiles.mu.Lock()
+	r.profiles.onSwitch = fn
+	r.profiles.mu.Unlock()
+}
+
+// Profiles returns the available profiles, default first
+func (r *Runner) Profiles() []string {
+	r.profiles.mu.RLock()
+	defer r.profiles.mu.RUnlock()
+	if r.profiles.names == nil {
+		return slices.Clone(DefaultProfiles)
+	}
+	return slices.Clone(r.profiles.names)
+}
+
+// ActiveProfile returns the profile stored in ProfileKey, or the default
+func (r *Runner) ActiveProfile() string {
+	if r.stateStore == nil {
+		return r.Profiles()[0]
+	}
+	return activeProfile(r.stateStore, r.Profiles())
+}
+
+// activeProfile reads ProfileKey from store (nil in some tests), falling back
+// to the first of names
+func activeProfile(store StateBackend, names []string) string {
+	if store != nil {
+		if v, err := store.GetGlobalState(ProfileKey); err == nil {
+			if profile, ok := v.(string); ok && profile != "" {
+				return profile
+			}
+		}
+	}
+	return names[0]
+}
+
+// SetActiveProfile switches the engine to profile. source names who asked
+// ("api", "mqtt") and is reported as the writer to on_state_change.
+func (r *Runner) SetActiveProfile(profile, source string) error {
+	if !slices.Contains(r.Profiles(), profile) {
+		return fmt.Errorf("%w %q (available: %v)", ErrUnknownProfile, profile, r.Profiles())
+	}
+	if r.stateStore == nil {
+		return errors.New("profiles need a state store")
+	}
+	return r.setGlobal(nil, source, ProfileKey, profile)
+}
+
+// profileSwitched is called from globalStateChanged when ProfileKey changes,
+// whoever wrote it
+func (r *Runner) profileSwitched(writer string, profile any) {
+	name, _ := profile.(string)
+	slog.Info("Profile switched", "profile", name, "by", writer)
+	r.profiles.mu.RLock()
+	onSwitch := r.profiles.onSwitch
+	r.profiles.mu.RUnlock()
+	if onSwitch != nil && name != "" {
+		onSwitch(name)
+	}
+}
+
+// activeInProfile reports whether an automation may run for trigger under
+// the current profile. Automations without profiles always run, and so do
+// manual runs, ctx.call, timers and jobs, which continue or were explicitly
+// asked for rather than reacting to the house.
+func (r *Runner) activeInProfile(automation *Automation, trigger Trigger) bool {
+	if len(automation.Config.Profiles) == 0 {
+		return true
+	}
+	switch trigger.Type {
+	case TriggerManual, TriggerCall, TriggerTimer, TriggerJob:
+		return true
+	}
+	return slices.Contains(automation.Config.Profiles, r.ActiveProfile())
+}
+
+// profileBuiltin implements ctx.profile(): the active profile
+func (c *Context) profileBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	if len(c.profiles) == 0 {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	return starlark.String(activeProfile(c.stateStore, c.profiles)), nil
+}
+
+// setProfileBuiltin implements ctx.set_profile(name). It is a write of
+// ProfileKey, so the automation needs it in global_state_writes.
+func (c *Context) setProfileBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+	if len(c.profiles) == 0 {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	if !slices.Contains(c.profiles, name) {
+		return nil, fmt.Errorf("%s: %w %q (available: %v)", fn.Name(), ErrUnknownProfile, name, c.profiles)
+	}
+	return c.setGlobal(thread, fn, starlark.Tuple{starlark.String(ProfileKey), starlark.String(name)}, nil)
+}
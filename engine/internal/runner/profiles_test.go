@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+func TestSetProfiles(t *testing.T) {
+	r := newTestRunner()
+	if got := r.Profiles(); len(got) != 4 || got[0] != "home" {
+		t.Errorf("default profiles = %v", got)
+	}
+	for _, names := range [][]string{nil, {"home", ""}, {"home", "away", "home"}} {
+		if err := r.SetProfiles(names); err == nil {
+			t.Errorf("SetProfiles(%q) succeeded", names)
+		}
+	}
+	if err := r.SetProfiles([]string{"home", "night"}); err != nil {
+		t.Fatal(err)
+	}
+	if r.ActiveProfile() != "home" {
+		t.Errorf("ActiveProfile() = %q, want the first profile", r.ActiveProfile())
+	}
+}
+
+func TestProfileGating(t *testing.T) {
+	store, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	r := newTestRunner()
+	r.stateStore = store
+	var switched []string
+	r.OnProfileSwitch(func(profile string) { switched = append(switched, profile) })
+
+	away := addTestAutomation(t, r, "away_lights", `
+config = {"name": "Away Lights", "subscribe": ["sunset"], "profiles": ["away", "vacation"]}
+
+def on_message(topic, payload, ctx):
+    return ctx.profile()
+`)
+	away.context.profiles = r.Profiles()
+	away.context.stateStore = store
+	mode := addTestAutomation(t, r, "leave_home", `
+config = {"name": "Leave Home", "subscribe": ["door"], "global_state_writes": ["homebrain.profile"]}
+
+def on_message(topic, payload, ctx):
+    return ctx.set_profile(payload)
+`)
+	mode.context.profiles = r.Profiles()
+	mode.context.stateStore = store
+	mode.context.writeGlobal = func(thread *starlark.Thread, key string, value any, clear bool) error {
+		return r.writeGlobal(thread, "leave_home", key, value, clear)
+	}
+
+	trigger := Trigger{Type: TriggerMQTT, Topic: "sunset", Time: time.Now()}
+	if _, err := r.handleMessage(away, trigger, nil); !errors.Is(err, errInactiveProfile) {
+		t.Fatalf("run at home = %v, want errInactiveProfile", err)
+	}
+	if list := r.ListAutomations(); len(list) != 2 || !(list[0].Inactive || list[1].Inactive) {
+		t.Errorf("ListAutomations should mark away_lights inactive: %+v", list)
+	}
+	if record, err := r.RunManual("away_lights", ManualTrigger{Topic: "sunset"}); err != nil || record.Result != "home" {
+		t.Errorf("manual run = %v, %v; manual runs ignore profiles", record.Result, err)
+	}
+
+	// ctx.set_profile switches the whole engine
+	record, err := r.handleMessage(mode, Trigger{Type: TriggerMQTT, Topic: "door", Time: time.Now()}, []byte("vacation"))
+	if err != nil || record.Result != true {
+		t.Fatalf("set_profile = %v, %v", record.Result, err)
+	}
+	if record, err := r.handleMessage(away, trigger, nil); err != nil || record.Result != "vacation" {
+		t.Errorf("run on vacation = %v, %v", record.Result, err)
+	}
+	if _, err := r.handleMessage(mode, Trigger{Type: TriggerMQTT, Topic: "door", Time: time.Now()}, []byte("party")); err == nil {
+		t.Error("set_profile with an unknown profile should fail")
+	}
+
+	if err := r.SetActiveProfile("party", "api"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("SetActiveProfile(party) = %v, want ErrUnknownProfile", err)
+	}
+	if err := r.SetActiveProfile("home", "api"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.handleMessage(away, trigger, nil); !errors.Is(err, errInactiveProfile) {
+		t.Errorf("run back home = %v, want errInactiveProfile", err)
+	}
+	if len(switched) != 2 || switched[0] != "vacation" || switched[1] != "home" {
+		t.Errorf("switches reported = %v", switched)
+	}
+}
@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	// programCacheVersion is part of every cache key; bump it to drop old entries
+	programCacheVersion = "1"
+
+	// programCacheMaxAge prunes entries not rewritten for this long at startup,
+	// so edited files don't leave compiled programs behind forever
+	programCacheMaxAge = 30 * 24 * time.Hour
+)
+
+// programCache keeps compiled Starlark programs on disk, keyed by a hash of
+// the file name, source and predeclared names, so restarts skip compilation
+type programCache struct {
+	dir    string
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// ProgramCacheStats counts compiled programs served from and added to the cache
+type ProgramCacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// SetProgramCache caches compiled automations and libraries in dir. Call
+// before loading libraries and automations.
+func (r *Runner) SetProgramCache(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create program cache: %w", err)
+	}
+	cache := &programCache{dir: dir}
+	cache.prune(time.Now().Add(-programCacheMaxAge))
+	r.programs = cache
+	r.libraryManager.programs = cache
+	return nil
+}
+
+// ProgramCacheStats reports cache use since startup
+func (r *Runner) ProgramCacheStats() ProgramCacheStats {
+	if r.programs == nil {
+		return ProgramCacheStats{}
+	}
+	return ProgramCacheStats{Hits: r.programs.hits.Load(), Misses: r.programs.misses.Load()}
+}
+
+// exec behaves like starlark.ExecFile, compiling src only when the cache has
+// no program for it. A nil cache always compiles.
+func (pc *programCache) exec(thread *starlark.Thread, filename string, src []byte, predeclared starlark.StringDict) (starlark.StringDict, error) {
+	if pc == nil {
+		return starlark.ExecFile(thread, filename, src, predeclared)
+	}
+	prog, err := pc.program(filename, src, predeclared)
+	if err != nil {
+		return nil, err
+	}
+	globals, err := prog.Init(thread, predeclared)
+	globals.Freeze()
+	return globals, err
+}
+
+func (pc *programCache) program(filename string, src []byte, predeclared starlark.StringDict) (*starlark.Program, error) {
+	path := filepath.Join(pc.dir, programCacheKey(filename, src, predeclared)+".starc")
+	if data, err := os.ReadFile(path); err == nil {
+		prog, err := starlark.CompiledProgram(bytes.NewReader(data))
+		if err == nil {
+			pc.hits.Add(1)
+			return prog, nil
+		}
+		// Written by another Starlark version or damaged; compile again
+		slog.Debug("Ignoring cached Starlark program", "file", filename, "error", err)
+	}
+
+	_, prog, err := starlark.SourceProgram(filename, src, predeclared.Has)
+	if err != nil {
+		return nil, err
+	}
+	pc.misses.Add(1)
+	if err := pc.write(path, prog); err != nil {
+		slog.Warn("Failed to cache compiled Starlark program", "file", filename, "error", err)
+	}
+	return prog, nil
+}
+
+// write stores prog through a temporary file so readers never see a partial program
+func (pc *programCache) write(path string, prog *starlark.Program) error {
+	var buf bytes.Buffer
+	if err := prog.Write(&buf); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(pc.dir, ".starc-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// prune removes entries last written before cutoff
+func (pc *programCache) prune(cutoff time.Time) {
+	entries, err := os.ReadDir(pc.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		os.Remove(filepath.Join(pc.dir, entry.Name()))
+	}
+}
+
+// programCacheKey hashes everything compilation depends on: the file name
+// (kept in positions), the source and which names are predeclared
+func programCacheKey(filename string, src []byte, predeclared starlark.StringDict) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "v%s\x00%s\x00", programCacheVersion, filename)
+	h.Write(src)
+	names := predeclared.Keys()
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "\x00%s", name)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
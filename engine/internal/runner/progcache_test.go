@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestProgramCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := &programCache{dir: dir}
+	src := []byte("greeting = prefix + \", world\"\n")
+	predeclared := starlark.StringDict{"prefix": starlark.String("hello")}
+
+	for i := 0; i < 2; i++ {
+		globals, err := cache.exec(&starlark.Thread{}, "greet.star", src, predeclared)
+		if err != nil {
+			t.Fatalf("exec %d failed: %v", i, err)
+		}
+		if got := globals["greeting"]; got != starlark.String("hello, world") {
+			t.Errorf("exec %d: greeting = %v", i, got)
+		}
+	}
+	if cache.hits.Load() != 1 || cache.misses.Load() != 1 {
+		t.Errorf("hits = %d, misses = %d; want 1, 1", cache.hits.Load(), cache.misses.Load())
+	}
+
+	// Predeclared names are resolved at compile time, so they are part of the key
+	other := programCacheKey("greet.star", src, starlark.StringDict{"prefix": starlark.String("x"), "extra": starlark.None})
+	if other == programCacheKey("greet.star", src, predeclared) {
+		t.Error("different predeclared names should give different keys")
+	}
+	if programCacheKey("greet.star", src, starlark.StringDict{"prefix": starlark.String("x")}) != programCacheKey("greet.star", src, predeclared) {
+		t.Error("predeclared values should not affect the key")
+	}
+
+	// A damaged entry is recompiled and replaced
+	entries, _ := filepath.Glob(filepath.Join(dir, "*.starc"))
+	if len(entries) != 1 {
+		t.Fatalf("cache entries = %v", entries)
+	}
+	os.WriteFile(entries[0], []byte("garbage"), 0644)
+	if _, err := cache.exec(&starlark.Thread{}, "greet.star", src, predeclared); err != nil {
+		t.Fatalf("exec with damaged entry failed: %v", err)
+	}
+	if cache.misses.Load() != 2 {
+		t.Errorf("misses = %d, want 2", cache.misses.Load())
+	}
+	if _, err := cache.exec(&starlark.Thread{}, "greet.star", src, predeclared); err != nil || cache.hits.Load() != 2 {
+		t.Errorf("exec after recompiling: err = %v, hits = %d", err, cache.hits.Load())
+	}
+
+	// Compile errors are not cached
+	if _, err := cache.exec(&starlark.Thread{}, "bad.star", []byte("x = undefined_name\n"), nil); err == nil {
+		t.Error("expected a compile error")
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "*.starc")); len(entries) != 1 {
+		t.Errorf("cache entries after a failed compile = %v", entries)
+	}
+}
+
+func TestSetProgramCache_Libraries(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lib"), 0755)
+	os.WriteFile(filepath.Join(dir, "lib", "timers.lib.star"), []byte("def ping():\n    return \"pong\"\n"), 0644)
+
+	for i := 0; i < 2; i++ {
+		r := newTestRunner()
+		r.libraryManager = NewLibraryManager()
+		if err := r.SetProgramCache(filepath.Join(dir, "cache")); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.LoadLibraries(dir); err != nil {
+			t.Fatal(err)
+		}
+		want := ProgramCacheStats{Misses: 1}
+		if i == 1 {
+			want = ProgramCacheStats{Hits: 1}
+		}
+		if stats := r.ProgramCacheStats(); stats != want {
+			t.Errorf("start %d: stats = %+v, want %+v", i, stats, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// defaultResponseTimeout is how long ctx.publish_and_wait waits by default
+const defaultResponseTimeout = 5 * time.Second
+
+// publishAndWait implements ctx.publish_and_wait(pub_topic, payload,
+// resp_topic, timeout=5): publish a request, such as a Zigbee2MQTT "/get",
+// and return the payload of the next message on resp_topic. It returns None
+// if the publish fails or nothing arrives in time; ctx.last_error() says which.
+func (c *Context) publishAndWait(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pubTopic, respTopic string
+	var payload starlark.Value
+	var timeout starlark.Value = starlark.MakeInt(int(defaultResponseTimeout.Seconds()))
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pub_topic", &pubTopic, "payload", &payload, "resp_topic", &respTopic, "timeout?", &timeout); err != nil {
+		return nil, err
+	}
+	f, ok := starlark.AsFloat(timeout)
+	if !ok || f <= 0 || f > maxSleep.Seconds() {
+		return nil, fmt.Errorf("%s: timeout must be between 0 and %d seconds", fn.Name(), int(maxSleep.Seconds()))
+	}
+	d := time.Duration(f * float64(time.Second))
+	if deadline, ok := thread.Local(threadLocalDeadline).(time.Time); ok && time.Now().Add(d).After(deadline) {
+		return nil, fmt.Errorf("%s: waiting %s would exceed the handler timeout", fn.Name(), d)
+	}
+	if err := validateTopicFilter(respTopic); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	// Listen before publishing so a fast reply isn't missed
+	responses := make(chan string, 1)
+	if c.watch != nil {
+		stop := c.watch(respTopic, func(_ string, payload []byte) {
+			select {
+			case responses <- string(payload):
+			default: // Only the first response counts
+			}
+		})
+		defer stop()
+	}
+
+	published, err := c.publish(thread, starlark.NewBuiltin(fn.Name(), c.publish), starlark.Tuple{starlark.String(pubTopic), payload}, nil)
+	if err != nil || published != starlark.True {
+		return starlark.None, err
+	}
+
+	wait := c.await
+	if wait == nil {
+		wait = awaitResponse
+	}
+	if response, ok := wait(thread, d, responses); ok {
+		return starlark.String(response), nil
+	}
+	if runContext(thread).Err() != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), errRunCancelled)
+	}
+	failed(thread, fn, errCodeTimeout, respTopic, fmt.Errorf("no message on %s within %s", respTopic, d))
+	return starlark.None, nil
+}
+
+// awaitResponse waits up to d for a response, giving up early if thread's
+// run is cancelled
+func awaitResponse(thread *starlark.Thread, d time.Duration, responses <-chan string) (string, bool) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case response := <-responses:
+		return response, true
+	case <-timer.C:
+		return "", false
+	case <-runContext(thread).Done():
+		return "", false
+	}
+}
+
+// await backs ctx.publish_and_wait for loaded automations. Like ctx.sleep, a
+// stand-in worker serves the handler's pool while it waits.
+func (r *Runner) await(thread *starlark.Thread, d time.Duration, responses <-chan string) (string, bool) {
+	if thread.Local(threadLocalJob) == nil {
+		priority, _ := thread.Local(threadLocalPriority).(string)
+		defer r.dispatcher.standIn(priority)()
+	}
+	return awaitResponse(thread, d, responses)
+}
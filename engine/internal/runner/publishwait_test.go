@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+// replyingDevice answers a publish to "<device>/get" on "<device>", like a
+// Zigbee2MQTT device reporting its state
+type replyingDevice struct {
+	mu      sync.Mutex
+	watches map[string]func(topic string, payload []byte)
+}
+
+func (d *replyingDevice) Publish(topic string, payload []byte, opts mqtt.PublishOptions) error {
+	device, ok := strings.CutSuffix(topic, "/get")
+	d.mu.Lock()
+	fn := d.watches[device]
+	d.mu.Unlock()
+	if ok && fn != nil {
+		go fn(device, []byte(`{"state": "ON"}`))
+	}
+	return nil
+}
+
+func (d *replyingDevice) watch(filter string, fn func(topic string, payload []byte)) func() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.watches[filter] = fn
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(d.watches, filter)
+	}
+}
+
+func TestPublishAndWait(t *testing.T) {
+	device := &replyingDevice{watches: make(map[string]func(string, []byte))}
+	c := NewContext("lamp_check", device, nil, func(string, string, string) {}, nil, nil)
+	c.watch = device.watch
+	predeclared := starlark.StringDict{
+		"publish_and_wait": starlark.NewBuiltin("publish_and_wait", c.publishAndWait),
+		"last_error":       starlark.NewBuiltin("last_error", c.lastErrorBuiltin),
+	}
+
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr string
+	}{
+		{`publish_and_wait("zigbee2mqtt/lamp/get", '{"state": ""}', "zigbee2mqtt/lamp")`, `"{\"state\": \"ON\"}"`, ""},
+		{`publish_and_wait("zigbee2mqtt/lamp/set", "ON", "zigbee2mqtt/lamp", timeout=0.05)`, "None", ""},
+		{`[publish_and_wait("zigbee2mqtt/lamp/set", "ON", "zigbee2mqtt/lamp", timeout=0.05), last_error().code][1]`, `"timeout"`, ""},
+		{`publish_and_wait("zigbee2mqtt/lamp/get", "", "zigbee2mqtt/lamp", timeout=0)`, "", "timeout must be"},
+		{`publish_and_wait("zigbee2mqtt/lamp/get", "", "zigbee2mqtt/#/state")`, "", "invalid topic"},
+	}
+	for _, tt := range tests {
+		got, err := starlark.Eval(&starlark.Thread{}, "test", tt.expr, predeclared)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.expr, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s failed: %v", tt.expr, err)
+		} else if got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+	if len(device.watches) != 0 {
+		t.Errorf("watches left behind: %v", device.watches)
+	}
+}
@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// secondsArg converts a builtin's seconds argument to a duration
+func secondsArg(fn *starlark.Builtin, name string, v starlark.Value) (time.Duration, error) {
+	seconds, ok := starlark.AsFloat(v)
+	if !ok || seconds <= 0 {
+		return 0, fmt.Errorf("%s: %s must be a positive number of seconds", fn.Name(), name)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// throttleBuiltin implements ctx.throttle(key, seconds): True if the last
+// call that returned True for key was at least seconds ago. The times are
+// kept in the state store, so throttling holds across reloads and restarts.
+func (c *Context) throttleBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	var secondsVal starlark.Value
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "seconds", &secondsVal); err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, fmt.Errorf("%s: key must not be empty", fn.Name())
+	}
+	interval, err := secondsArg(fn, "seconds", secondsVal)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := c.stateStore.Throttle(c.automationID, key, c.now(), interval)
+	if err != nil {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: %s", fn.Name(), key, err))
+		return failed(thread, fn, errCodeStorage, key, err)
+	}
+	return starlark.Bool(allowed), nil
+}
+
+// debounceBuiltin implements ctx.debounce(key, seconds, data=None): it
+// (re)starts timer key, so on_timer(key, data, ctx) runs once, with the
+// latest data, after seconds pass without another call. It returns True when
+// no debounce for key was pending, i.e. for the first call of a burst.
+func (c *Context) debounceBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	var secondsVal starlark.Value
+	var data starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "seconds", &secondsVal, "data?", &data); err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, fmt.Errorf("%s: key must not be empty", fn.Name())
+	}
+	delay, err := secondsArg(fn, "seconds", secondsVal)
+	if err != nil {
+		return nil, err
+	}
+	if delay > maxTimerDelay {
+		return nil, fmt.Errorf("%s: seconds must be at most %s", fn.Name(), maxTimerDelay)
+	}
+
+	var encoded json.RawMessage
+	if data != starlark.None {
+		var buf bytes.Buffer
+		if err := encodeJSON(&buf, data, -1); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		encoded = buf.Bytes()
+	}
+
+	if c.setTimer == nil || c.timerPending == nil {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	first := !c.timerPending(key)
+	priority, _ := thread.Local(threadLocalPriority).(string)
+	if err := c.setTimer(key, delay, encoded, priority); err != nil {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: %s", fn.Name(), key, err))
+		return failed(thread, fn, errCodeStorage, key, err)
+	}
+	return starlark.Bool(first), nil
+}
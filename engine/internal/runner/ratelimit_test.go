@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+func TestThrottleBuiltin(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	a := addTestAutomation(t, r, "doorbell", `
+config = {"name": "Doorbell", "subscribe": ["doorbell"]}
+
+def on_message(topic, payload, ctx):
+    return [ctx.throttle("notify", 60), ctx.throttle("notify", 60), ctx.throttle("chime", 60)]
+`)
+	a.context.stateStore = r.stateStore
+	record, err := r.handleMessage(a, Trigger{Type: TriggerMQTT, Time: time.Now()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := record.Result.([]any); len(got) != 3 || got[0] != true || got[1] != false || got[2] != true {
+		t.Errorf("throttle results = %v, want [true false true]", record.Result)
+	}
+
+	// The decision is kept in the state store, so a reloaded automation is
+	// still throttled
+	a = addTestAutomation(t, r, "doorbell", `
+config = {"name": "Doorbell", "subscribe": ["doorbell"]}
+
+def on_message(topic, payload, ctx):
+    return ctx.throttle("notify", 60)
+`)
+	a.context.stateStore = r.stateStore
+	if record, _ := r.handleMessage(a, Trigger{Type: TriggerMQTT, Time: time.Now()}, nil); record.Result != false {
+		t.Errorf("after reload throttle = %v, want false", record.Result)
+	}
+}
+
+func TestDebounceBuiltin(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	a := addTestAutomation(t, r, "washer", `
+config = {"name": "Washer", "subscribe": ["washer/power"]}
+
+def on_message(topic, payload, ctx):
+    return ctx.debounce("idle", 0.05, {"power": payload})
+
+def on_timer(timer_id, data, ctx):
+    return [timer_id, data]
+`)
+	a.onTimer, _ = a.globals["on_timer"].(starlark.Callable)
+	a.context.setTimer = func(id string, delay time.Duration, data json.RawMessage, priority string) error {
+		return r.setTimer("washer", id, delay, data, priority)
+	}
+	a.context.timerPending = func(id string) bool { return r.timerPending("washer", id) }
+
+	var first []any
+	for _, payload := range []string{"3", "2", "1"} {
+		record, err := r.handleMessage(a, Trigger{Type: TriggerMQTT, Time: time.Now()}, []byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		first = append(first, record.Result)
+	}
+	if first[0] != true || first[1] != false || first[2] != false {
+		t.Errorf("debounce results = %v, want only the first call of the burst to be True", first)
+	}
+
+	runs := waitForRuns(t, r, "washer", 4)
+	time.Sleep(100 * time.Millisecond)
+	if runs = r.GetRuns("washer"); len(runs) != 4 {
+		t.Fatalf("got %d runs, want 3 messages and one trailing on_timer", len(runs))
+	}
+	var timerRun *RunRecord
+	for i := range runs {
+		if runs[i].Handler == "on_timer" {
+			timerRun = &runs[i]
+		}
+	}
+	if timerRun == nil {
+		t.Fatal("no on_timer run")
+	}
+	if result, _ := timerRun.Result.([]any); len(result) != 2 || result[0] != "idle" || result[1].(map[string]any)["power"] != "1" {
+		t.Errorf("on_timer result = %v, want the latest data", timerRun.Result)
+	}
+}
+
+func TestRateLimitDryRun(t *testing.T) {
+	r := newTestRunner()
+	result, err := r.DryRun(DryRunRequest{Code: `
+config = {"name": "Chatty"}
+
+def on_schedule(ctx):
+    return [ctx.throttle("publish", 10), ctx.throttle("publish", 10), ctx.debounce("quiet", 30), ctx.debounce("quiet", 30)]
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := result.Result.([]any); !result.Success || len(got) != 4 || got[0] != true || got[1] != false || got[2] != true || got[3] != false {
+		t.Errorf("result = %+v", result)
+	}
+	if len(result.Timers) != 2 || result.Timers[1].ID != "quiet" || result.Timers[1].Seconds != 30 {
+		t.Errorf("timers = %+v", result.Timers)
+	}
+}
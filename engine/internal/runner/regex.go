@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"go.starlark.net/starlark"
+)
+
+// maxCachedPatterns bounds the compiled pattern cache. Automations use a
+// handful of constant patterns; ones built at runtime past the limit are
+// compiled on every call.
+const maxCachedPatterns = 256
+
+var patternCache = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: make(map[string]*regexp.Regexp)}
+
+// compilePattern compiles a Go (RE2) pattern, reusing earlier compilations
+func compilePattern(fn *starlark.Builtin, pattern string) (*regexp.Regexp, error) {
+	patternCache.Lock()
+	re, ok := patternCache.m[pattern]
+	patternCache.Unlock()
+	if ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern: %w", fn.Name(), err)
+	}
+	patternCache.Lock()
+	if len(patternCache.m) < maxCachedPatterns {
+		patternCache.m[pattern] = re
+	}
+	patternCache.Unlock()
+	return re, nil
+}
+
+// submatches converts the groups of one match, None for a group that didn't
+// participate
+func submatches(s string, loc []int) []starlark.Value {
+	values := make([]starlark.Value, 0, len(loc)/2)
+	for i := 0; i < len(loc); i += 2 {
+		if loc[i] < 0 {
+			values = append(values, starlark.None)
+		} else {
+			values = append(values, starlark.String(s[loc[i]:loc[i+1]]))
+		}
+	}
+	return values
+}
+
+// reMatch implements ctx.re_match(pattern, s): the first match in s as a list
+// of the whole match followed by its groups, or None
+func reMatch(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "s", &s); err != nil {
+		return nil, err
+	}
+	re, err := compilePattern(fn, pattern)
+	if err != nil {
+		return nil, err
+	}
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return starlark.None, nil
+	}
+	return starlark.NewList(submatches(s, loc)), nil
+}
+
+// reFindAll implements ctx.re_find_all(pattern, s). Like Python's
+// re.findall, it returns the matched strings for a pattern without groups,
+// the group for a pattern with one, and tuples of groups otherwise.
+func reFindAll(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "s", &s); err != nil {
+		return nil, err
+	}
+	re, err := compilePattern(fn, pattern)
+	if err != nil {
+		return nil, err
+	}
+	var result []starlark.Value
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		groups := submatches(s, loc)
+		switch len(groups) {
+		case 1:
+			result = append(result, groups[0])
+		case 2:
+			result = append(result, groups[1])
+		default:
+			result = append(result, starlark.Tuple(groups[1:]))
+		}
+	}
+	return starlark.NewList(result), nil
+}
+
+// reReplace implements ctx.re_replace(pattern, s, repl, count=0). repl may
+// refer to groups as $1 or ${name}; count limits the replacements, 0 for all.
+func reReplace(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s, repl string
+	count := 0
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "s", &s, "repl", &repl, "count?", &count); err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("%s: count must not be negative", fn.Name())
+	}
+	re, err := compilePattern(fn, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return starlark.String(re.ReplaceAllString(s, repl)), nil
+	}
+	var out []byte
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, count) {
+		out = append(out, s[last:loc[0]]...)
+		out = re.ExpandString(out, repl, s, loc)
+		last = loc[1]
+	}
+	return starlark.String(string(append(out, s[last:]...))), nil
+}
@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestRegexBuiltins(t *testing.T) {
+	predeclared := starlark.StringDict{
+		"re_match":    starlark.NewBuiltin("re_match", reMatch),
+		"re_find_all": starlark.NewBuiltin("re_find_all", reFindAll),
+		"re_replace":  starlark.NewBuiltin("re_replace", reReplace),
+	}
+
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr string
+	}{
+		{`re_match(r"^zigbee2mqtt/([^/]+)/(\w+)$", "zigbee2mqtt/kitchen_plug/power")`, `["zigbee2mqtt/kitchen_plug/power", "kitchen_plug", "power"]`, ""},
+		{`re_match(r"(\d+)(%)?", "battery 87")`, `["87", "87", None]`, ""},
+		{`re_match(r"^\d+$", "87%")`, "None", ""},
+		{`re_find_all(r"\d+\.\d+", "T=21.5 H=40.25")`, `["21.5", "40.25"]`, ""},
+		{`re_find_all(r"(\w+)=", "T=21.5 H=40.25")`, `["T", "H"]`, ""},
+		{`re_find_all(r"(\w+)=([\d.]+)", "T=21.5 H=40.25")`, `[("T", "21.5"), ("H", "40.25")]`, ""},
+		{`re_find_all(r"x", "abc")`, `[]`, ""},
+		{`re_replace(r"\s+", " a   b  ", "")`, `"ab"`, ""},
+		{`re_replace(r"(\w+)_(\w+)", "kitchen_plug", "$2 in ${1}")`, `"plug in kitchen"`, ""},
+		{`re_replace(r"o", "foo boo", "0", count=2)`, `"f00 boo"`, ""},
+		{`re_match("(", "x")`, "", "re_match: invalid pattern"},
+		{`re_replace("o", "foo", "0", count=-1)`, "", "count must not be negative"},
+	}
+	for _, tt := range tests {
+		got, err := starlark.Eval(&starlark.Thread{}, "test", tt.expr, predeclared)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.expr, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s failed: %v", tt.expr, err)
+		} else if got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+const (
+	defaultMaxReplays = 50
+
+	// threadLocalCapture holds the stateCapture for the current run
+	threadLocalCapture = "homebrain.capture"
+
+	captureState  = "state"
+	captureGlobal = "global"
+)
+
+// ReplayBundle captures everything needed to re-run a failed handler exactly:
+// the source it ran, its trigger and payload, and the state it read
+type ReplayBundle struct {
+	ID         string    `json:"id"`
+	CapturedAt time.Time `json:"captured_at"`
+	SourceHash string    `json:"source_hash"`
+	Error      string    `json:"error"`
+	DryRunRequest
+}
+
+// GetReplays returns captured replay bundles, newest last
+func (r *Runner) GetReplays() []ReplayBundle {
+	r.replaysMu.RLock()
+	defer r.replaysMu.RUnlock()
+
+	result := make([]ReplayBundle, len(r.replays))
+	copy(result, r.replays)
+	return result
+}
+
+// GetReplay returns one replay bundle by ID
+func (r *Runner) GetReplay(id string) (ReplayBundle, bool) {
+	r.replaysMu.RLock()
+	defer r.replaysMu.RUnlock()
+
+	for _, bundle := range r.replays {
+		if bundle.ID == id {
+			return bundle, true
+		}
+	}
+	return ReplayBundle{}, false
+}
+
+// Replay re-runs a captured bundle in the dry-run sandbox
+func (r *Runner) Replay(id string) (DryRunResult, error) {
+	bundle, ok := r.GetReplay(id)
+	if !ok {
+		return DryRunResult{}, fmt.Errorf("replay bundle not found: %s", id)
+	}
+	return r.DryRun(bundle.DryRunRequest)
+}
+
+// captureReplay stores a bundle for a failed run
+func (r *Runner) captureReplay(automation *Automation, trigger Trigger, handler string, capture *stateCapture, runErr error) {
+	sum := sha256.Sum256([]byte(automation.source))
+	now := time.Now()
+	bundle := ReplayBundle{
+		ID:         fmt.Sprintf("%s-%d", automation.ID, now.UnixNano()),
+		CapturedAt: now,
+		SourceHash: hex.EncodeToString(sum[:8]),
+		Error:      runErr.Error(),
+		DryRunRequest: DryRunRequest{
+			AutomationID:      automation.ID,
+			Code:              automation.source,
+			Handler:           handler,
+			Trigger:           trigger,
+			Payload:           trigger.payload,
+			GlobalStateWrites: automation.Config.GlobalStateWrites,
+		},
+	}
+	bundle.State, bundle.Global, bundle.Flags = capture.snapshot()
+
+	r.replaysMu.Lock()
+	defer r.replaysMu.Unlock()
+	r.replays = append(r.replays, bundle)
+	if len(r.replays) > r.maxReplays {
+		r.replays = r.replays[len(r.replays)-r.maxReplays:]
+	}
+}
+
+// stateCapture records the state, global and flag values a run read before
+// changing them, so a replay can start from exactly those inputs
+type stateCapture struct {
+	mu      sync.Mutex
+	values  map[string]map[string]any
+	flags   map[string]state.Flag
+	written map[string]bool
+}
+
+func newStateCapture() *stateCapture {
+	return &stateCapture{
+		values: map[string]map[string]any{
+			captureState:  {},
+			captureGlobal: {},
+		},
+		flags:   map[string]state.Flag{},
+		written: map[string]bool{},
+	}
+}
+
+// captureFrom returns the capture attached to a thread, or nil
+func captureFrom(thread *starlark.Thread) *stateCapture {
+	if thread == nil {
+		return nil
+	}
+	capture, _ := thread.Local(threadLocalCapture).(*stateCapture)
+	return capture
+}
+
+func (c *stateCapture) read(scope, key string, value any) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.written[scope+"\x00"+key] {
+		return
+	}
+	if _, seen := c.values[scope][key]; !seen && value != nil {
+		c.values[scope][key] = value
+	}
+}
+
+func (c *stateCapture) wrote(scope, key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written[scope+"\x00"+key] = true
+}
+
+func (c *stateCapture) flag(name string, flag *state.Flag) {
+	if c == nil || flag == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, seen := c.flags[name]; !seen {
+		c.flags[name] = *flag
+	}
+}
+
+func (c *stateCapture) snapshot() (map[string]any, map[string]any, map[string]state.Flag) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[captureState], c.values[captureGlobal], c.flags
+}
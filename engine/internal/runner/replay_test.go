@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"testing"
+)
+
+func TestReplayBundle(t *testing.T) {
+	r := newTestRunner()
+	a := addTestAutomation(t, r, "thermostat", `
+def on_message(topic, payload, ctx):
+    ctx.set_state("last", payload)
+    target = ctx.get_global("climate.target")
+    if ctx.get_state("mode") == "away":
+        fail("cannot heat to %s while away" % target)
+
+config = {"name": "Thermostat", "subscribe": ["sensors/temp"]}
+`)
+	store := newMemoryState(map[string]any{"mode": "away"}, map[string]any{"climate.target": 21.5, "unrelated": 1}, nil)
+	a.context.stateStore = store
+
+	if _, err := r.RunManual("thermostat", ManualTrigger{Topic: "sensors/temp", Payload: "18.2"}); err == nil {
+		t.Fatal("expected handler error")
+	}
+
+	replays := r.GetReplays()
+	if len(replays) != 1 {
+		t.Fatalf("got %d replay bundles, want 1", len(replays))
+	}
+	bundle := replays[0]
+	if bundle.Payload != "18.2" || bundle.Trigger.Topic != "sensors/temp" || bundle.Handler != "on_message" {
+		t.Errorf("bundle trigger not captured: %+v", bundle.DryRunRequest)
+	}
+	if bundle.State["mode"] != "away" {
+		t.Errorf("bundle state = %+v, want mode=away", bundle.State)
+	}
+	if _, ok := bundle.State["last"]; ok {
+		t.Error("state written by the run must not be captured as input")
+	}
+	if bundle.Global["climate.target"] != 21.5 {
+		t.Errorf("bundle global = %+v", bundle.Global)
+	}
+	if _, ok := bundle.Global["unrelated"]; ok {
+		t.Error("globals the run never read must not be captured")
+	}
+	if bundle.Code == "" || bundle.SourceHash == "" {
+		t.Error("bundle must carry the source it ran")
+	}
+
+	// The live state changes, but the replay still reproduces the failure
+	store.SetState("", "mode", "home")
+	result, err := r.Replay(bundle.ID)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if result.Success || result.Error != bundle.Error {
+		t.Errorf("replay error = %q, want %q", result.Error, bundle.Error)
+	}
+
+	if _, err := r.Replay("missing"); err == nil {
+		t.Error("expected error for unknown bundle")
+	}
+}
@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	// threadLocalRunID holds the ID of the run record being executed
+	threadLocalRunID = "homebrain.run_id"
+
+	maxRetryAttempts = 10
+	maxRetryBackoff  = 5 * time.Minute
+	defaultBackoff   = time.Second
+)
+
+// RetryPolicy is config["retry"]: failed publish, notify and http calls are
+// tried again up to Attempts times in total, waiting Backoff before the first
+// retry and doubling the wait after each failure
+type RetryPolicy struct {
+	Attempts int    `json:"attempts"`
+	Backoff  string `json:"backoff"`
+	backoff  time.Duration
+}
+
+// RetryOutcome records how a retried side effect ended
+type RetryOutcome struct {
+	Action   string    `json:"action"`
+	Attempts int       `json:"attempts"` // Including the original call
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// parseRetryPolicy reads {"attempts": 3, "backoff": "2s"}
+func parseRetryPolicy(v starlark.Value) (*RetryPolicy, error) {
+	dict, ok := v.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("retry must be a dict")
+	}
+	policy := &RetryPolicy{Attempts: 3, Backoff: defaultBackoff.String(), backoff: defaultBackoff}
+	if v, found, _ := dict.Get(starlark.String("attempts")); found {
+		n, err := starlark.AsInt32(v)
+		if err != nil || n < 1 || n > maxRetryAttempts {
+			return nil, fmt.Errorf("retry.attempts must be an int between 1 and %d", maxRetryAttempts)
+		}
+		policy.Attempts = n
+	}
+	if v, found, _ := dict.Get(starlark.String("backoff")); found {
+		s, ok := v.(starlark.String)
+		d, err := time.ParseDuration(string(s))
+		if !ok || err != nil || d <= 0 || d > maxRetryBackoff {
+			return nil, fmt.Errorf("retry.backoff must be a duration like \"2s\", at most %s", maxRetryBackoff)
+		}
+		policy.Backoff, policy.backoff = string(s), d
+	}
+	return policy, nil
+}
+
+// retryLater hands a failed side effect to the automation's retry policy and
+// reports whether a retry was scheduled. The idempotency key claimed for the
+// call (cacheKey, may be empty) is released if every retry fails.
+func (c *Context) retryLater(thread *starlark.Thread, action, cacheKey string, attempt func() error) bool {
+	if c.retry == nil {
+		return false
+	}
+	runID, _ := thread.Local(threadLocalRunID).(string)
+	c.retry(runID, action, attempt, func() { c.releaseIdempotent(cacheKey) })
+	return true
+}
+
+// retrySideEffect runs the remaining attempts of a failed side effect in the
+// background, so the handler and its worker are not held up. Retries stop
+// when done is cancelled, i.e. the automation is unloaded or replaced; gaveUp
+// runs when the side effect was not performed.
+func (r *Runner) retrySideEffect(done context.Context, automationID, runID string, policy RetryPolicy, action string, attempt func() error, gaveUp func()) {
+	go func() {
+		delay := policy.backoff
+		var err error
+		for n := 2; n <= policy.Attempts; n++ {
+			select {
+			case <-done.Done():
+				r.addLog(automationID, LogLevelWarning, fmt.Sprintf("WARNING: %s: retry cancelled, the automation was unloaded", action))
+				r.recordRetry(runID, RetryOutcome{Action: action, Attempts: n - 1, Error: "cancelled: automation unloaded", Time: time.Now()})
+				gaveUp()
+				return
+			case <-time.After(delay):
+			}
+			if err = attempt(); err == nil {
+				r.addLog(automationID, LogLevelInfo, fmt.Sprintf("%s succeeded on attempt %d", action, n))
+				r.recordRetry(runID, RetryOutcome{Action: action, Attempts: n, Success: true, Time: time.Now()})
+				return
+			}
+			delay = min(delay*2, maxRetryBackoff)
+		}
+		r.addLog(automationID, LogLevelError, fmt.Sprintf("ERROR: %s failed after %d attempts: %s", action, policy.Attempts, err))
+		r.recordRetry(runID, RetryOutcome{Action: action, Attempts: policy.Attempts, Error: err.Error(), Time: time.Now()})
+		gaveUp()
+	}()
+}
+
+// recordRetry attaches a retry outcome to its run. Outcomes are kept beside
+// the run list because retries usually finish after the run was recorded.
+func (r *Runner) recordRetry(runID string, outcome RetryOutcome) {
+	if runID == "" {
+		return
+	}
+	r.runsMu.Lock()
+	defer r.runsMu.Unlock()
+	if r.retries == nil {
+		r.retries = make(map[string][]RetryOutcome)
+	}
+	r.retries[runID] = append(r.retries[runID], outcome)
+}
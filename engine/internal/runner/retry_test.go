@@ -0,0 +1,146 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+// flakyPublisher fails its first `failures` publishes
+type flakyPublisher struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (p *flakyPublisher) Publish(topic string, payload []byte, opts mqtt.PublishOptions) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+func TestExtractConfig_Retry(t *testing.T) {
+	config, err := execConfig(t, `config = {"name": "Test", "retry": {"attempts": 5, "backoff": "2s"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Retry == nil || config.Retry.Attempts != 5 || config.Retry.backoff != 2*time.Second {
+		t.Errorf("Retry = %+v", config.Retry)
+	}
+
+	config, err = execConfig(t, `config = {"name": "Test", "retry": {}}`)
+	if err != nil || config.Retry.Attempts != 3 || config.Retry.backoff != time.Second {
+		t.Errorf("defaults = %+v, %v", config.Retry, err)
+	}
+
+	for _, bad := range []string{`"3"`, `{"attempts": 0}`, `{"attempts": 11}`, `{"backoff": "soon"}`, `{"backoff": "-1s"}`, `{"backoff": "1h"}`} {
+		if _, err := execConfig(t, `config = {"name": "Bad", "retry": `+bad+`}`); err == nil {
+			t.Errorf("retry %s should be rejected", bad)
+		}
+	}
+}
+
+func TestRetrySideEffects(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		wantSuccess bool
+		wantTries   int
+	}{
+		{"recovers", 2, true, 3},
+		{"gives up", 10, false, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRunner()
+			a := addTestAutomation(t, r, "heater", `
+config = {"name": "Heater", "subscribe": ["t"], "retry": {"attempts": 3, "backoff": "5ms"}}
+
+def on_message(topic, payload, ctx):
+    return ctx.publish("heater/set", "ON")
+`)
+			publisher := &flakyPublisher{failures: tt.failures}
+			a.context.mqttClient = publisher
+			a.context.retry = func(runID, action string, attempt func() error, gaveUp func()) {
+				r.retrySideEffect(context.Background(), "heater", runID, *a.Config.Retry, action, attempt, gaveUp)
+			}
+
+			record, _ := r.handleMessage(a, Trigger{Type: TriggerMQTT, Time: time.Now()}, nil)
+			if record.Result != false {
+				t.Errorf("publish returned %v, want False for the failed first attempt", record.Result)
+			}
+
+			var outcome RetryOutcome
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) {
+				if runs := r.GetRuns("heater"); len(runs) == 1 && len(runs[0].Retries) == 1 {
+					outcome = runs[0].Retries[0]
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			if outcome.Action != "publish heater/set" || outcome.Success != tt.wantSuccess || outcome.Attempts != tt.wantTries {
+				t.Errorf("outcome = %+v", outcome)
+			}
+			if !tt.wantSuccess && !strings.Contains(outcome.Error, "broker unavailable") {
+				t.Errorf("outcome error = %q", outcome.Error)
+			}
+
+			logs := r.GetLogs()
+			if len(logs) == 0 || !strings.Contains(logs[0].Message, "(retrying)") {
+				t.Errorf("logs = %+v, want the first failure marked as retrying", logs)
+			}
+		})
+	}
+}
+
+func TestRetryCancelledOnUnload(t *testing.T) {
+	r := New(nil, nil)
+	done, stop := context.WithCancel(context.Background())
+	r.automations["heater"] = &Automation{ID: "heater", done: done, stop: stop}
+	r.addRun(RunRecord{ID: "heater-1", AutomationID: "heater"})
+
+	var calls atomic.Int32
+	policy := RetryPolicy{Attempts: 3, backoff: time.Hour}
+	r.retrySideEffect(done, "heater", "heater-1", policy, "publish heater/set", func() error {
+		calls.Add(1)
+		return errors.New("broker unavailable")
+	}, func() {})
+	r.UnloadAutomation("heater")
+
+	var outcome RetryOutcome
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if runs := r.GetRuns("heater"); len(runs) == 1 && len(runs[0].Retries) == 1 {
+			outcome = runs[0].Retries[0]
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if outcome.Success || outcome.Attempts != 1 || !strings.Contains(outcome.Error, "cancelled") || calls.Load() != 0 {
+		t.Errorf("outcome = %+v after %d retries, want the retry cancelled", outcome, calls.Load())
+	}
+}
+
+func TestRetryOutcomesEvictedWithRuns(t *testing.T) {
+	r := newTestRunner()
+	r.maxRuns = 1
+	r.addRun(RunRecord{ID: "a-1", AutomationID: "a"})
+	r.recordRetry("a-1", RetryOutcome{Action: "publish x", Attempts: 2, Success: true})
+	r.addRun(RunRecord{ID: "a-2", AutomationID: "a"})
+
+	if _, ok := r.retries["a-1"]; ok {
+		t.Error("retry outcomes of evicted runs should be dropped")
+	}
+}
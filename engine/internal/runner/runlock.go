@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errCallCycle is returned when running an automation would wait on its own
+// call chain, as when A calls B and B calls A
+var errCallCycle = errors.New("call cycle")
+
+// threadLocalRunChain holds the runChain of the current run
+const threadLocalRunChain = "homebrain.run_chain"
+
+// runChain identifies a run and the ctx.call calls, of handlers or services,
+// it makes, which run synchronously on the same worker
+type runChain struct {
+	root string // Automation whose run started the chain
+}
+
+// runLocks lets one run chain at a time execute an automation's handlers. The
+// dispatcher already runs an automation's triggered handlers one by one; the
+// locks also cover calls from other automations, which run on the caller's
+// worker. A chain that would wait on itself, directly or through other
+// waiting chains, fails with errCallCycle instead of deadlocking.
+type runLocks struct {
+	mu      sync.Mutex
+	holders map[string]*runChain // Automation ID → chain running it
+	waits   map[*runChain]string // Chain → automation it waits for
+	changed chan struct{}        // Closed and replaced on every release
+}
+
+// acquire waits until chain may run automation id, or ctx ends, and returns
+// the func that releases it
+func (l *runLocks) acquire(ctx context.Context, chain *runChain, id string) (func(), error) {
+	for {
+		l.mu.Lock()
+		if l.holders == nil {
+			l.holders = make(map[string]*runChain)
+			l.waits = make(map[*runChain]string)
+			l.changed = make(chan struct{})
+		}
+		holder := l.holders[id]
+		if holder == nil {
+			l.holders[id] = chain
+			delete(l.waits, chain)
+			l.mu.Unlock()
+			return func() { l.release(id) }, nil
+		}
+		if l.waitsOn(holder, chain) {
+			delete(l.waits, chain)
+			l.mu.Unlock()
+			if holder == chain {
+				return nil, fmt.Errorf("%w: %s is already running in this call chain (started by %s)", errCallCycle, id, chain.root)
+			}
+			return nil, fmt.Errorf("%w: %s is running in a call chain (started by %s) that waits on this one", errCallCycle, id, holder.root)
+		}
+		l.waits[chain] = id
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			l.mu.Lock()
+			delete(l.waits, chain)
+			l.mu.Unlock()
+			return nil, errRunCancelled
+		}
+	}
+}
+
+// waitsOn reports whether holder is chain, or waits for an automation whose
+// holder is chain or waits on it in turn. Caller holds l.mu.
+func (l *runLocks) waitsOn(holder, chain *runChain) bool {
+	for i := 0; i <= len(l.waits); i++ {
+		if holder == chain {
+			return true
+		}
+		id, ok := l.waits[holder]
+		if !ok {
+			return false
+		}
+		if holder = l.holders[id]; holder == nil {
+			return false
+		}
+	}
+	return false
+}
+
+func (l *runLocks) release(id string) {
+	l.mu.Lock()
+	delete(l.holders, id)
+	close(l.changed)
+	l.changed = make(chan struct{})
+	l.mu.Unlock()
+}
@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunLocks_CrossChainCycle(t *testing.T) {
+	var l runLocks
+	one, two := &runChain{root: "a"}, &runChain{root: "b"}
+	releaseA, _ := l.acquire(context.Background(), one, "a")
+	releaseB, _ := l.acquire(context.Background(), two, "b")
+
+	// a's chain calls b and waits for b's run
+	waited := make(chan error, 1)
+	go func() {
+		release, err := l.acquire(context.Background(), one, "b")
+		if err == nil {
+			release()
+		}
+		waited <- err
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		l.mu.Lock()
+		_, waiting := l.waits[one]
+		l.mu.Unlock()
+		if waiting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("chain one never waited for b")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// b's chain calling a would wait on itself
+	if _, err := l.acquire(context.Background(), two, "a"); !errors.Is(err, errCallCycle) {
+		t.Errorf("error = %v, want a call cycle", err)
+	}
+	releaseB()
+	if err := <-waited; err != nil {
+		t.Errorf("chain one's wait = %v", err)
+	}
+	releaseA()
+
+	// Waiting ends with the run
+	releaseA, _ = l.acquire(context.Background(), one, "a")
+	defer releaseA()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.acquire(ctx, two, "a"); !errors.Is(err, errRunCancelled) {
+		t.Errorf("error = %v, want errRunCancelled", err)
+	}
+}
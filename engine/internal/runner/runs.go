@@ -0,0 +1,49 @@
+package runner
+
+import "time"
+
+const defaultMaxRuns = 500
+
+// RunRecord describes one handler invocation and its outcome
+type RunRecord struct {
+	ID           string     `json:"id"`
+	AutomationID string     `json:"automation_id"`
+	Handler      string     `json:"handler"`
+	Trigger      Trigger    `json:"trigger"`
+	Start        time.Time  `json:"start"`
+	DurationMs   float64    `json:"duration_ms"`
+	Error        string     `json:"error,omitempty"`
+	Result       any        `json:"result,omitempty"`    // Handler return value (JSON-compatible)
+	Artifacts    []Artifact `json:"artifacts,omitempty"` // Attached with ctx.attach
+
+	Retries      []RetryOutcome       `json:"retries,omitempty"`             // Side effects retried under config["retry"]
+	Expectations []ExpectationFailure `json:"failed_expectations,omitempty"` // Failed ctx.expect calls
+}
+
+// GetRuns returns recent run records, optionally filtered by automation ID
+func (r *Runner) GetRuns(automationID string) []RunRecord {
+	r.runsMu.RLock()
+	defer r.runsMu.RUnlock()
+
+	result := make([]RunRecord, 0, len(r.runs))
+	for _, run := range r.runs {
+		if automationID == "" || run.AutomationID == automationID {
+			run.Retries = r.retries[run.ID]
+			result = append(result, run)
+		}
+	}
+	return result
+}
+
+func (r *Runner) addRun(record RunRecord) {
+	r.runsMu.Lock()
+	defer r.runsMu.Unlock()
+
+	r.runs = append(r.runs, record)
+	if len(r.runs) > r.maxRuns {
+		for _, evicted := range r.runs[:len(r.runs)-r.maxRuns] {
+			delete(r.retries, evicted.ID)
+		}
+		r.runs = r.runs[len(r.runs)-r.maxRuns:]
+	}
+}
@@ -0,0 +1,499 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/connector"
+	"github.com/homebrain/engine/internal/mqtt"
+	"github.com/homebrain/engine/internal/notify"
+	"github.com/homebrain/engine/internal/state"
+)
+
+// DryRunRequest describes a sandboxed handler run. Replay bundles embed it so a
+// downloaded bundle can be posted to /dry-run as-is.
+type DryRunRequest struct {
+	AutomationID      string                `json:"automation_id"`
+	Code              string                `json:"code,omitempty"`    // Defaults to the loaded automation's source
+	Handler           string                `json:"handler,omitempty"` // "on_message", "on_schedule" or "on_webhook"; derived if empty
+	Trigger           Trigger               `json:"trigger"`
+	Payload           string                `json:"payload,omitempty"`
+	State             map[string]any        `json:"state,omitempty"`  // Initial per-automation state
+	Global            map[string]any        `json:"global,omitempty"` // Initial global state
+	Flags             map[string]state.Flag `json:"flags,omitempty"`
+	GlobalStateWrites []string              `json:"global_state_writes,omitempty"` // Overrides the code's config
+	Failures          []InjectedFailure     `json:"failures,omitempty"`            // Side effects that should fail
+
+	common starlark.StringDict // Predeclared names for Code when the automation isn't loaded
+}
+
+// PublishedMessage is a publish recorded during a dry run
+type PublishedMessage struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+	Sink    string `json:"sink,omitempty"`
+	QoS     byte   `json:"qos,omitempty"` // Set for MQTT publishes
+	Retain  bool   `json:"retain,omitempty"`
+}
+
+// DryRunResult is the outcome of a sandboxed run. State and Global hold the
+// values after the run.
+type DryRunResult struct {
+	Success   bool               `json:"success"`
+	Error     string             `json:"error,omitempty"`
+	Handler   string             `json:"handler"`
+	Result    any                `json:"result,omitempty"`
+	Published []PublishedMessage `json:"published"`
+	Logs      []string           `json:"logs"`
+	State     map[string]any     `json:"state"`
+	Global    map[string]any     `json:"global"`
+	Artifacts map[string]string  `json:"artifacts,omitempty"` // ctx.attach contents by name
+
+	Notifications []SentNotification  `json:"notifications,omitempty"` // Recorded ctx.notify calls
+	Timers        []ScheduledTimer    `json:"timers,omitempty"`        // Recorded ctx.set_timer calls
+	Overrides     []ScheduledOverride `json:"overrides,omitempty"`     // Recorded ctx.override calls; nothing is reverted
+	Jobs          []StartedJob        `json:"jobs,omitempty"`          // Recorded ctx.job.start calls; jobs don't run
+	Subscribed    []string            `json:"subscribed,omitempty"`    // Recorded ctx.subscribe topics
+	Injected      []string            `json:"injected,omitempty"`      // Side effects failed by the request's failures
+
+	Expectations []ExpectationFailure `json:"failed_expectations,omitempty"` // Failed ctx.expect calls
+}
+
+// StartedJob is a ctx.job.start call recorded during a dry run
+type StartedJob struct {
+	Name     string `json:"name"`
+	Function string `json:"function"`
+	Data     any    `json:"data,omitempty"`
+}
+
+// ScheduledTimer is a ctx.set_timer call recorded during a dry run
+type ScheduledTimer struct {
+	ID      string          `json:"id"`
+	Seconds float64         `json:"seconds"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// ScheduledOverride is a ctx.override call recorded during a dry run. Value
+// and Restore are JSON (payload strings for device targets); an empty
+// Restore would clear the global key.
+type ScheduledOverride struct {
+	Target  string          `json:"target"`
+	Seconds float64         `json:"seconds"`
+	Value   json.RawMessage `json:"value"`
+	Restore json.RawMessage `json:"restore,omitempty"`
+}
+
+// SentNotification is a ctx.notify call recorded during a dry run
+type SentNotification struct {
+	Channel string `json:"channel,omitempty"`
+	notify.Message
+}
+
+// DryRun executes automation code in a sandbox: publishes are recorded instead
+// of sent, state starts from the request's snapshot and is never written to the
+// store, and ctx.now() is pinned to the trigger time. Handler errors are
+// reported in the result; the error return is for requests that cannot run.
+func (r *Runner) DryRun(req DryRunRequest) (DryRunResult, error) {
+	id := req.AutomationID
+	code := req.Code
+	common := req.common
+	if code == "" {
+		if id == "" {
+			return DryRunResult{}, fmt.Errorf("code or automation_id is required")
+		}
+		automation, err := r.lookup(id)
+		if err != nil {
+			return DryRunResult{}, err
+		}
+		code, common = automation.source, automation.common
+	} else if automation, err := r.lookup(id); err == nil && common == nil {
+		common = automation.common
+	}
+	if id == "" {
+		id = "dry_run"
+	}
+	faults, err := newFaultInjector(req.Failures)
+	if err != nil {
+		return DryRunResult{}, err
+	}
+
+	thread := &starlark.Thread{Name: id}
+	globals, err := starlark.ExecFile(thread, id+".star", code, common)
+	if err != nil {
+		return DryRunResult{}, fmt.Errorf("failed to execute automation: %w", err)
+	}
+
+	config := AutomationConfig{}
+	if val, ok := globals["config"]; ok {
+		if config, err = extractConfig(val); err != nil {
+			return DryRunResult{}, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	writes := config.GlobalStateWrites
+	if req.GlobalStateWrites != nil {
+		writes = req.GlobalStateWrites
+	}
+
+	trigger := req.Trigger
+	if trigger.Type == "" {
+		trigger.Type = TriggerManual
+	}
+	if trigger.Time.IsZero() {
+		trigger.Time = time.Now()
+	}
+
+	handler := req.Handler
+	if handler == "" {
+		handler = "on_schedule"
+		if _, ok := globals["on_schedule"]; !ok || trigger.Topic != "" || req.Payload != "" {
+			handler = "on_message"
+		}
+	}
+	fn, ok := globals[handler].(starlark.Callable)
+	if !ok {
+		return DryRunResult{}, fmt.Errorf("automation has no %s handler", handler)
+	}
+
+	store := newMemoryState(req.State, req.Global, req.Flags)
+	store.faults = faults
+	published := &publishRecorder{faults: faults}
+	var logsMu sync.Mutex
+	logs := []string{}
+
+	ctx := NewContext(id, published, store, func(_, _, message string) {
+		logsMu.Lock()
+		logs = append(logs, message)
+		logsMu.Unlock()
+	}, writes, r.libraryManager)
+	// Dry runs don't wait: ctx.sleep moves the run's clock forward instead
+	now := trigger.Time
+	ctx.clock = func() time.Time { return now }
+	ctx.sleep = func(_ *starlark.Thread, d time.Duration) { now = now.Add(d) }
+	ctx.await = func(_ *starlark.Thread, d time.Duration, _ <-chan string) (string, bool) {
+		// Nothing answers in the sandbox, so requests time out without waiting
+		now = now.Add(d)
+		return "", false
+	}
+	ctx.httpAllow = config.HTTPAllow
+	ctx.profiles = r.Profiles()
+	ctx.persons = r.persons
+	ctx.allowedSecrets = config.Secrets
+	ctx.secret = func(name string) (string, bool) {
+		// Dry-run results are returned to the caller, so real values never enter the sandbox
+		_, ok := r.secrets.Get(name)
+		return "<secret:" + name + ">", ok
+	}
+	ctx.strict = r.strictFor(config)
+	if faults.has(FailHTTP) {
+		ctx.httpClient = &http.Client{Transport: faults}
+	}
+	ctx.idempotency = newIdempotencyCache(idempotencyWindow) // Repeats within the run are skipped as in production
+	var notifications []SentNotification
+	ctx.notify = func(channel string, msg notify.Message) error {
+		if _, ok := faults.fail(FailNotify, channel); ok {
+			return errInjected
+		}
+		notifications = append(notifications, SentNotification{Channel: channel, Message: msg})
+		return nil
+	}
+	var timers []ScheduledTimer
+	ctx.setTimer = func(id string, delay time.Duration, data json.RawMessage, _ string) error {
+		timers = append(timers, ScheduledTimer{ID: id, Seconds: delay.Seconds(), Data: data})
+		return nil
+	}
+	ctx.cancelTimer = func(string) (bool, error) { return false, nil }
+	ctx.timerPending = func(id string) bool {
+		return slices.ContainsFunc(timers, func(timer ScheduledTimer) bool { return timer.ID == id })
+	}
+	var subscribed []string
+	ctx.subscribe = func(topic string) (bool, error) {
+		if err := validateTopicFilter(topic); err != nil {
+			return false, err
+		}
+		if slices.Contains(config.Subscribe, topic) || slices.Contains(subscribed, topic) {
+			return false, nil
+		}
+		subscribed = append(subscribed, topic)
+		return true, nil
+	}
+	ctx.unsubscribe = func(topic string) bool {
+		i := slices.Index(subscribed, topic)
+		if i >= 0 {
+			subscribed = slices.Delete(subscribed, i, i+1)
+		}
+		return i >= 0
+	}
+	var overrides []ScheduledOverride
+	ctx.setOverride = func(override state.Override) (state.Override, error) {
+		overrides = append(overrides, ScheduledOverride{
+			Target:  override.Target,
+			Seconds: override.Until.Sub(now).Seconds(),
+			Value:   override.Value,
+			Restore: override.Restore,
+		})
+		return override, nil
+	}
+	ctx.cancelOverride = func(string, func(state.Override) bool) error { return ErrOverrideNotFound }
+	var jobs []StartedJob
+	ctx.startJob = func(name, fnName string, data any) (string, error) {
+		if _, ok := globals[fnName].(starlark.Callable); !ok {
+			return "", fmt.Errorf("%s has no function %s", id, fnName)
+		}
+		jobs = append(jobs, StartedJob{Name: name, Function: fnName, Data: data})
+		return fmt.Sprintf("%s-%s-dry-run", id, name), nil
+	}
+	ctx.cancelJob = func(string) bool { return false }
+	ctx.sinks = make(map[string]connector.Connector)
+	for name := range r.sinks {
+		ctx.sinks[name] = &recordingSink{name: name, recorder: published}
+	}
+
+	result := DryRunResult{Handler: handler}
+	args := starlark.Tuple{}
+	if handler == "on_message" {
+		trigger.payload = req.Payload
+		trigger.json = newPayloadJSON([]byte(req.Payload))
+		payload, err := messagePayload(config, trigger.Topic, []byte(req.Payload), trigger.json)
+		if err != nil {
+			result.Error = err.Error()
+			result.Logs = []string{fmt.Sprintf("WARNING: %s: %s", trigger.Topic, err)}
+			return result, nil
+		}
+		args = starlark.Tuple{starlark.String(trigger.Topic), payload}
+	} else if handler == "on_webhook" {
+		trigger.payload = req.Payload
+		trigger.json = newPayloadJSON([]byte(req.Payload))
+		args = starlark.Tuple{starlark.String(req.Payload), webhookHeaders(trigger.Headers)}
+	}
+
+	artifacts := &runArtifacts{}
+	thread.SetLocal(threadLocalArtifacts, artifacts)
+	thread.SetLocal(threadLocalCapture, newStateCapture())
+	expectations := &runExpectations{}
+	thread.SetLocal(threadLocalExpectations, expectations)
+	timeout := r.timeoutFor(config)
+	timedOut := cancelAfter(thread, timeout)
+	steps := r.stepsFor(config)
+	outOfSteps := limitSteps(thread, steps)
+	value, err := starlark.Call(thread, fn, append(args, ctx.ToStarlark(trigger)), nil)
+	if timedOut() && err != nil {
+		err = fmt.Errorf("%s %w after %s", handler, errHandlerTimeout, timeout)
+	} else if outOfSteps() && err != nil {
+		err = fmt.Errorf("%s %w of %d", handler, errStepLimit, steps)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+		if value != starlark.None {
+			result.Result = starlarkToGo(value)
+		}
+	}
+
+	result.Published = published.snapshot()
+	result.Logs = logs
+	result.Notifications = notifications
+	result.Timers = timers
+	result.Overrides = overrides
+	result.Jobs = jobs
+	result.Subscribed = subscribed
+	result.Injected = faults.snapshot()
+	result.Expectations = expectations.list
+	result.State, result.Global = store.snapshot()
+	for _, artifact := range artifacts.list {
+		if result.Artifacts == nil {
+			result.Artifacts = make(map[string]string)
+		}
+		result.Artifacts[artifact.Name] = string(artifact.data)
+	}
+	return result, nil
+}
+
+// memoryState is an in-memory StateBackend seeded from a snapshot
+type memoryState struct {
+	mu        sync.Mutex
+	state     map[string]any
+	global    map[string]any
+	history   map[string][]state.HistoryEntry // Newest last
+	flags     map[string]state.Flag
+	throttled map[string]time.Time // Last allowed ctx.throttle call by key
+	faults    *faultInjector
+}
+
+func newMemoryState(stateValues, global map[string]any, flags map[string]state.Flag) *memoryState {
+	m := &memoryState{
+		state:     make(map[string]any, len(stateValues)),
+		global:    make(map[string]any, len(global)),
+		history:   make(map[string][]state.HistoryEntry),
+		flags:     make(map[string]state.Flag, len(flags)),
+		throttled: make(map[string]time.Time),
+	}
+	for k, v := range stateValues {
+		m.state[k] = v
+	}
+	for k, v := range global {
+		m.global[k] = v
+	}
+	for k, v := range flags {
+		m.flags[k] = v
+	}
+	return m
+}
+
+func (m *memoryState) GetState(_, key string) (any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state[key], nil
+}
+
+func (m *memoryState) SetState(_, key string, value any) error {
+	if _, ok := m.faults.fail(FailStateWrite, key); ok {
+		return errInjected
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state[key] = value
+	return nil
+}
+
+func (m *memoryState) ClearState(_, key string) error {
+	if _, ok := m.faults.fail(FailStateWrite, key); ok {
+		return errInjected
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.state, key)
+	return nil
+}
+
+func (m *memoryState) GetGlobalState(key string) (any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.global[key], nil
+}
+
+func (m *memoryState) SetGlobalState(key string, value any) error {
+	if _, ok := m.faults.fail(FailStateWrite, key); ok {
+		return errInjected
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.global[key] = value
+	return nil
+}
+
+func (m *memoryState) ClearGlobalState(key string) error {
+	if _, ok := m.faults.fail(FailStateWrite, key); ok {
+		return errInjected
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.global, key)
+	return nil
+}
+
+func (m *memoryState) RecordGlobalHistory(key string, entry state.HistoryEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history := append(m.history[key], entry)
+	if len(history) > state.MaxHistory {
+		history = history[len(history)-state.MaxHistory:]
+	}
+	m.history[key] = history
+	return nil
+}
+
+func (m *memoryState) GetGlobalHistory(key string, limit int) ([]state.HistoryEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history := m.history[key]
+	entries := make([]state.HistoryEntry, 0, min(limit, len(history)))
+	for i := len(history) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, history[i])
+	}
+	return entries, nil
+}
+
+func (m *memoryState) GetFlag(name string) (*state.Flag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	flag, ok := m.flags[name]
+	if !ok {
+		return nil, nil
+	}
+	return &flag, nil
+}
+
+func (m *memoryState) Throttle(_, key string, now time.Time, interval time.Duration) (bool, error) {
+	if _, ok := m.faults.fail(FailStateWrite, key); ok {
+		return false, errInjected
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if last, ok := m.throttled[key]; ok && now.Sub(last) < interval {
+		return false, nil
+	}
+	m.throttled[key] = now
+	return true, nil
+}
+
+func (m *memoryState) snapshot() (map[string]any, map[string]any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stateCopy := make(map[string]any, len(m.state))
+	for k, v := range m.state {
+		stateCopy[k] = v
+	}
+	globalCopy := make(map[string]any, len(m.global))
+	for k, v := range m.global {
+		globalCopy[k] = v
+	}
+	return stateCopy, globalCopy
+}
+
+// publishRecorder is a Publisher that keeps messages instead of sending them
+type publishRecorder struct {
+	mu       sync.Mutex
+	messages []PublishedMessage
+	faults   *faultInjector
+}
+
+func (p *publishRecorder) Publish(topic string, payload []byte, opts mqtt.PublishOptions) error {
+	return p.record(PublishedMessage{Topic: topic, Payload: string(payload), QoS: opts.QoS, Retain: opts.Retain})
+}
+
+func (p *publishRecorder) record(msg PublishedMessage) error {
+	if _, ok := p.faults.fail(FailPublish, msg.Topic); ok {
+		return errInjected
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+func (p *publishRecorder) snapshot() []PublishedMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]PublishedMessage{}, p.messages...)
+}
+
+// recordingSink stands in for a connector during dry runs
+type recordingSink struct {
+	name     string
+	recorder *publishRecorder
+}
+
+func (s *recordingSink) Name() string { return s.name }
+
+func (s *recordingSink) Publish(subject string, payload []byte) error {
+	return s.recorder.record(PublishedMessage{Topic: subject, Payload: string(payload), Sink: s.name})
+}
+
+func (s *recordingSink) Close() error { return nil }
@@ -0,0 +1,248 @@
+package runner
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/connector"
+	"github.com/homebrain/engine/internal/state"
+)
+
+func TestDryRun(t *testing.T) {
+	r := newTestRunner()
+	code := `
+def on_message(topic, payload, ctx):
+    count = (ctx.get_state("count") or 0) + 1
+    ctx.set_state("count", count)
+    if ctx.flags.is_enabled("announce"):
+        ctx.publish("home/announce", "motion %d at %d" % (count, ctx.now()))
+    ctx.set_global("presence.hallway", True)
+    ctx.set_global("presence.kitchen", True)
+    ctx.log("done")
+    return count
+
+config = {
+    "name": "Counter",
+    "subscribe": ["motion"],
+    "global_state_writes": ["presence.hallway"],
+}
+`
+	trigger := Trigger{Type: TriggerMQTT, Topic: "motion", Time: time.Unix(1700000000, 0)}
+	result, err := r.DryRun(DryRunRequest{
+		AutomationID: "counter",
+		Code:         code,
+		Trigger:      trigger,
+		Payload:      "{}",
+		State:        map[string]any{"count": int64(4)},
+		Flags:        map[string]state.Flag{"announce": {Name: "announce", Enabled: true, Percentage: 100}},
+	})
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+
+	if !result.Success || result.Handler != "on_message" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if result.Result != int64(5) {
+		t.Errorf("Result = %v, want 5", result.Result)
+	}
+	if len(result.Published) != 1 || result.Published[0].Payload != "motion 5 at 1700000000" {
+		t.Errorf("Published = %+v", result.Published)
+	}
+	if result.State["count"] != int64(5) {
+		t.Errorf("State = %+v", result.State)
+	}
+	if result.Global["presence.hallway"] != true {
+		t.Errorf("permitted global write missing: %+v", result.Global)
+	}
+	if _, ok := result.Global["presence.kitchen"]; ok {
+		t.Errorf("undeclared global write was applied: %+v", result.Global)
+	}
+	if len(result.Logs) != 2 || result.Logs[1] != "done" {
+		t.Errorf("Logs = %q", result.Logs)
+	}
+	if len(r.GetRuns("")) != 0 {
+		t.Error("dry runs must not be recorded as runs")
+	}
+}
+
+func TestDryRun_HandlerErrorIsReported(t *testing.T) {
+	r := newTestRunner()
+	result, err := r.DryRun(DryRunRequest{Code: `
+def on_schedule(ctx):
+    fail("boom")
+
+config = {"name": "Broken"}
+`})
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	if result.Success || result.Error == "" || result.Handler != "on_schedule" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestDryRun_InvalidRequests(t *testing.T) {
+	r := newTestRunner()
+	requests := []DryRunRequest{
+		{},
+		{AutomationID: "missing"},
+		{Code: "def broken("},
+		{Code: "config = {}", Handler: "on_message"},
+		{Code: "def on_schedule(ctx):\n    pass", Failures: []InjectedFailure{{Action: "explode"}}},
+		{Code: "def on_schedule(ctx):\n    pass", Failures: []InjectedFailure{{Action: FailHTTP, Status: 999}}},
+	}
+	for _, req := range requests {
+		if _, err := r.DryRun(req); err == nil {
+			t.Errorf("expected error for %+v", req)
+		}
+	}
+}
+
+func TestDryRun_RecordsNotifications(t *testing.T) {
+	r := newTestRunner()
+	result, err := r.DryRun(DryRunRequest{
+		AutomationID: "weekly_report",
+		Code: `
+def on_schedule(ctx):
+    ctx.notify("Weekly energy", "Used 42 kWh", channel = "email", priority = "low")
+
+config = {"name": "Weekly Report", "schedule": "0 8 * * 1"}
+`,
+	})
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	if !result.Success || len(result.Notifications) != 1 {
+		t.Fatalf("result = %+v, want one recorded notification", result)
+	}
+	n := result.Notifications[0]
+	if n.Channel != "email" || n.Title != "Weekly energy" || n.Body != "Used 42 kWh" || n.Priority != "low" || n.Source != "weekly_report" {
+		t.Errorf("notification = %+v", n)
+	}
+}
+
+func TestDryRun_InjectedFailures(t *testing.T) {
+	r := newTestRunner()
+	code := `
+def on_schedule(ctx):
+    outcomes = {
+        "light": ctx.publish("lights/hallway/set", "ON"),
+        "other": ctx.publish("lights/kitchen/set", "ON"),
+        "state": ctx.set_state("last_run", 1),
+        "notify": ctx.notify("Heating", "Boiler offline"),
+    }
+    r = ctx.http_post("https://api.example.com/v1/boiler", body = "restart")
+    outcomes["http"] = r.status
+    if not outcomes["light"]:
+        ctx.log("fallback")
+    return outcomes
+
+config = {"name": "Heating", "schedule": "@every 5m", "http_allow": ["api.example.com"]}
+`
+	result, err := r.DryRun(DryRunRequest{
+		AutomationID: "heating",
+		Code:         code,
+		Failures: []InjectedFailure{
+			{Action: FailPublish, Match: "lights/hallway/*"},
+			{Action: FailStateWrite, Match: "last_run"},
+			{Action: FailNotify},
+			{Action: FailHTTP, Match: "https://api.example.com/v1/*", Status: 503},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("handler failed: %s", result.Error)
+	}
+
+	want := map[string]any{"light": false, "other": true, "state": false, "notify": false, "http": int64(503)}
+	got := result.Result.(map[string]any)
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if len(result.Published) != 1 || result.Published[0].Topic != "lights/kitchen/set" {
+		t.Errorf("Published = %+v, want only the kitchen publish", result.Published)
+	}
+	if _, ok := result.State["last_run"]; ok || len(result.Notifications) != 0 {
+		t.Errorf("failed writes were applied: state %+v, notifications %+v", result.State, result.Notifications)
+	}
+	wantInjected := []string{"publish lights/hallway/set", "state_write last_run", "notify", "http https://api.example.com/v1/boiler"}
+	if !slices.Equal(result.Injected, wantInjected) {
+		t.Errorf("Injected = %q, want %q", result.Injected, wantInjected)
+	}
+	if !slices.Contains(result.Logs, "fallback") {
+		t.Errorf("Logs = %q, want the fallback path taken", result.Logs)
+	}
+}
+
+func TestDryRun_GlobalHistory(t *testing.T) {
+	r := newTestRunner()
+	code := `
+def on_message(topic, payload, ctx):
+    ctx.set_global("doors.front", "open")
+    ctx.set_global("doors.front", "closed")
+    ctx.clear_global("doors.front")
+    history = ctx.get_global_history("doors.front", limit=2)
+    opened = [e for e in ctx.get_global_history("doors.front") if e.value == "open"]
+    return [[e.value, e.cleared, e.time] for e in history] + [len(opened)]
+
+config = {"name": "Door Log", "subscribe": ["doors"], "global_state_writes": ["doors.*"]}
+`
+	trigger := Trigger{Type: TriggerMQTT, Topic: "doors", Time: time.Unix(1700000000, 0)}
+	result, err := r.DryRun(DryRunRequest{AutomationID: "door_log", Code: code, Trigger: trigger, Payload: "{}"})
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	want := []any{[]any{nil, true, 1700000000.0}, []any{"closed", false, 1700000000.0}, int64(1)}
+	if !result.Success || fmt.Sprint(result.Result) != fmt.Sprint(want) {
+		t.Errorf("Result = %v, want %v (error %q)", result.Result, want, result.Error)
+	}
+
+	bad := `
+def on_message(topic, payload, ctx):
+    ctx.get_global_history("doors.front", limit=0)
+
+config = {"name": "Bad", "subscribe": ["doors"]}
+`
+	if result, _ := r.DryRun(DryRunRequest{AutomationID: "bad", Code: bad, Payload: "{}"}); result.Success {
+		t.Error("limit=0 should fail the run")
+	}
+}
+
+func TestDryRun_PublishOptions(t *testing.T) {
+	r := newTestRunner()
+	code := `
+def on_message(topic, payload, ctx):
+    ctx.publish("home/mode", "away", retain=True)
+    ctx.publish("telemetry/power", "42", qos=0)
+    ctx.publish("zigbee2mqtt/lamp/set", "ON")
+
+config = {"name": "Publisher", "subscribe": ["trigger"]}
+`
+	result, err := r.DryRun(DryRunRequest{AutomationID: "publisher", Code: code, Payload: "{}"})
+	if err != nil || !result.Success {
+		t.Fatalf("DryRun failed: %v %s", err, result.Error)
+	}
+	want := []PublishedMessage{
+		{Topic: "home/mode", Payload: "away", QoS: 1, Retain: true},
+		{Topic: "telemetry/power", Payload: "42", QoS: 0},
+		{Topic: "zigbee2mqtt/lamp/set", Payload: "ON", QoS: 1},
+	}
+	if !slices.Equal(result.Published, want) {
+		t.Errorf("Published = %+v, want %+v", result.Published, want)
+	}
+
+	r.sinks = map[string]connector.Connector{"kafka": nil}
+	for _, call := range []string{`ctx.publish("a", "b", qos=3)`, `ctx.publish("a", "b", sink="kafka", retain=True)`} {
+		bad := "def on_message(topic, payload, ctx):\n    " + call + "\n\nconfig = {\"name\": \"Bad\", \"subscribe\": [\"trigger\"]}\n"
+		if result, _ := r.DryRun(DryRunRequest{AutomationID: "bad", Code: bad, Payload: "{}"}); result.Success {
+			t.Errorf("%s should fail", call)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser accepts standard 5-field cron, an optional leading seconds field
+// ("*/15 * * * * *") and descriptors such as @hourly or @every 30s
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ResolvedSchedule is a config schedule translated into something the engine
+// can run: a cron spec, or a solar event like "@sunset" or "@sunrise+30m"
+type ResolvedSchedule struct {
+	Cron        string `json:"cron,omitempty"`
+	Solar       string `json:"solar,omitempty"`
+	Description string `json:"description"` // How the schedule was understood
+}
+
+// ResolveSchedule accepts cron specs with or without a seconds field, cron
+// descriptors (@daily, @every 30s), solar events (@sunset) and friendly
+// phrases such as "every weekday at 7:15", "every 30 seconds" or "jeden
+// Montag um 8 Uhr". Errors echo how much of the phrase was understood.
+func ResolveSchedule(spec string) (ResolvedSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return ResolvedSchedule{}, fmt.Errorf("schedule is empty")
+	}
+
+	if strings.HasPrefix(spec, "@sunrise") || strings.HasPrefix(spec, "@sunset") {
+		return ResolvedSchedule{Solar: spec, Description: spec}, nil
+	}
+	if _, err := cronParser.Parse(spec); err == nil {
+		return ResolvedSchedule{Cron: spec, Description: "cron " + spec}, nil
+	}
+
+	p := &scheduleParser{spec: spec, tokens: lexSchedule(spec)}
+	return p.parse()
+}
+
+// resolveRunnableSchedule resolves a schedule and checks that the scheduler
+// can run it
+func resolveRunnableSchedule(spec string) (ResolvedSchedule, error) {
+	resolved, err := ResolveSchedule(spec)
+	if err != nil {
+		return resolved, err
+	}
+	if resolved.Solar != "" {
+		if _, _, err := parseSolarSpec(resolved.Solar); err != nil {
+			return resolved, err
+		}
+	}
+	return resolved, nil
+}
+
+// Canonical schedule words; aliases below map English, German, Spanish and
+// French words onto them
+const (
+	tokEvery    = "every"
+	tokDaily    = "daily"
+	tokHourly   = "hourly"
+	tokSecond   = "second"
+	tokMinute   = "minute"
+	tokHour     = "hour"
+	tokDay      = "day"
+	tokWeekday  = "weekday"
+	tokWeekend  = "weekend"
+	tokAt       = "at"
+	tokAnd      = "and"
+	tokNoon     = "noon"
+	tokMidnight = "midnight"
+	tokSunrise  = "sunrise"
+	tokSunset   = "sunset"
+	tokBefore   = "before"
+	tokAfter    = "after"
+	tokFiller   = "filler"
+	tokNumber   = "number"
+	tokTime     = "time"
+	tokDow      = "dow"
+	tokUnknown  = "unknown"
+)
+
+var scheduleAliases = map[string]string{
+	// every
+	"every": tokEvery, "each": tokEvery, "jeden": tokEvery, "jede": tokEvery, "jeder": tokEvery,
+	"alle": tokEvery, "cada": tokEvery, "todos": tokEvery, "todas": tokEvery,
+	"chaque": tokEvery, "tous": tokEvery, "toutes": tokEvery,
+	// daily / hourly
+	"daily": tokDaily, "täglich": tokDaily, "taeglich": tokDaily, "diario": tokDaily,
+	"diariamente": tokDaily, "quotidien": tokDaily,
+	"hourly": tokHourly, "stündlich": tokHourly, "stuendlich": tokHourly,
+	// units
+	"second": tokSecond, "seconds": tokSecond, "sec": tokSecond, "secs": tokSecond,
+	"sekunde": tokSecond, "sekunden": tokSecond, "segundo": tokSecond, "segundos": tokSecond,
+	"seconde": tokSecond, "secondes": tokSecond,
+	"minute": tokMinute, "minutes": tokMinute, "min": tokMinute, "mins": tokMinute,
+	"minuten": tokMinute, "minuto": tokMinute, "minutos": tokMinute,
+	"hour": tokHour, "hours": tokHour, "stunde": tokHour, "stunden": tokHour,
+	"hora": tokHour, "horas": tokHour, "heure": tokHour, "heures": tokHour,
+	"day": tokDay, "days": tokDay, "tag": tokDay, "tage": tokDay, "día": tokDay,
+	"dia": tokDay, "días": tokDay, "dias": tokDay, "jour": tokDay, "jours": tokDay,
+	// day groups
+	"weekday": tokWeekday, "weekdays": tokWeekday, "werktag": tokWeekday, "werktags": tokWeekday,
+	"werktage": tokWeekday, "laborable": tokWeekday, "laborables": tokWeekday, "ouvrable": tokWeekday,
+	"weekend": tokWeekend, "weekends": tokWeekend, "wochenende": tokWeekend, "finde": tokWeekend,
+	// connectors
+	"at": tokAt, "um": tokAt, "bei": tokAt, "beim": tokAt, "à": tokAt, "a": tokAt, "al": tokAt, "au": tokAt,
+	"and": tokAnd, "und": tokAnd, "y": tokAnd, "et": tokAnd, "&": tokAnd,
+	"on": tokFiller, "am": tokFiller, "the": tokFiller, "el": tokFiller, "los": tokFiller,
+	"las": tokFiller, "la": tokFiller, "le": tokFiller, "les": tokFiller, "de": tokFiller,
+	"du": tokFiller, "des": tokFiller, "der": tokFiller, "den": tokFiller, "dem": tokFiller,
+	// times of day
+	"noon": tokNoon, "midday": tokNoon, "mittag": tokNoon, "mediodía": tokNoon,
+	"mediodia": tokNoon, "midi": tokNoon,
+	"midnight": tokMidnight, "mitternacht": tokMidnight, "medianoche": tokMidnight, "minuit": tokMidnight,
+	// solar
+	"sunrise": tokSunrise, "dawn": tokSunrise, "sonnenaufgang": tokSunrise, "amanecer": tokSunrise,
+	"sunset": tokSunset, "dusk": tokSunset, "sonnenuntergang": tokSunset, "atardecer": tokSunset,
+	"anochecer": tokSunset, "crépuscule": tokSunset, "crepuscule": tokSunset,
+	"before": tokBefore, "vor": tokBefore, "antes": tokBefore, "avant": tokBefore,
+	"after": tokAfter, "nach": tokAfter, "después": tokAfter, "despues": tokAfter,
+	"après": tokAfter, "apres": tokAfter,
+}
+
+var dayNames = map[string]int{
+	"sunday": 0, "sun": 0, "sonntag": 0, "domingo": 0, "dimanche": 0,
+	"monday": 1, "mon": 1, "montag": 1, "lunes": 1, "lundi": 1,
+	"tuesday": 2, "tue": 2, "tues": 2, "dienstag": 2, "martes": 2, "mardi": 2,
+	"wednesday": 3, "wed": 3, "mittwoch": 3, "miércoles": 3, "miercoles": 3, "mercredi": 3,
+	"thursday": 4, "thu": 4, "thurs": 4, "donnerstag": 4, "jueves": 4, "jeudi": 4,
+	"friday": 5, "fri": 5, "freitag": 5, "viernes": 5, "vendredi": 5,
+	"saturday": 6, "sat": 6, "samstag": 6, "sábado": 6, "sabado": 6, "samedi": 6,
+}
+
+var dayLabels = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+
+var (
+	clockPattern = regexp.MustCompile(`^(\d{1,2})(?:[:.h](\d{2}))?(am|pm|a\.m\.|p\.m\.)?$`)
+	hourSuffixes = map[string]bool{"uhr": true, "h": true, "o'clock": true, "oclock": true}
+)
+
+type scheduleToken struct {
+	raw   string
+	kind  string
+	value int // Number, day of week, or minutes since midnight for times
+}
+
+// lexSchedule splits a phrase into canonical tokens
+func lexSchedule(spec string) []scheduleToken {
+	words := strings.Fields(strings.NewReplacer(",", " ", ";", " ").Replace(strings.ToLower(spec)))
+
+	var tokens []scheduleToken
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		tok := scheduleToken{raw: word, kind: tokUnknown}
+
+		switch {
+		case scheduleAliases[word] != "":
+			tok.kind = scheduleAliases[word]
+		case isDayName(word):
+			tok.kind, tok.value = tokDow, dayNumber(word)
+		case clockPattern.MatchString(word):
+			m := clockPattern.FindStringSubmatch(word)
+			hour, _ := strconv.Atoi(m[1])
+			minute, _ := strconv.Atoi(m[2])
+			suffix := m[3]
+			// Join "7 am", "7 pm", "8 Uhr", "19 h"
+			if suffix == "" && m[2] == "" && i+1 < len(words) {
+				switch next := words[i+1]; {
+				case next == "am" || next == "pm" || next == "a.m." || next == "p.m.":
+					suffix = next
+					tok.raw += " " + next
+					i++
+				case hourSuffixes[next]:
+					tok.raw += " " + next
+					i++
+					tok.kind, tok.value = tokTime, hour*60
+					tokens = append(tokens, tok)
+					continue
+				}
+			}
+			if suffix == "" && m[2] == "" {
+				tok.kind, tok.value = tokNumber, hour
+				break
+			}
+			tok.kind, tok.value = tokTime, -1
+			if suffix != "" {
+				if hour < 1 || hour > 12 {
+					break
+				}
+				hour %= 12
+				if strings.HasPrefix(suffix, "p") {
+					hour += 12
+				}
+			}
+			if hour < 24 && minute < 60 {
+				tok.value = hour*60 + minute
+			}
+		default:
+			if n, err := strconv.Atoi(word); err == nil {
+				tok.kind, tok.value = tokNumber, n
+			}
+		}
+		tokens = append(tokens, tok)
+	}
+	return tokens
+}
+
+// isDayName matches day names, including plurals such as "mondays"
+func isDayName(word string) bool {
+	_, ok := dayNames[word]
+	_, plural := dayNames[strings.TrimSuffix(word, "s")]
+	return ok || plural
+}
+
+func dayNumber(word string) int {
+	if day, ok := dayNames[word]; ok {
+		return day
+	}
+	return dayNames[strings.TrimSuffix(word, "s")]
+}
+
+type scheduleParser struct {
+	spec   string
+	tokens []scheduleToken
+	pos    int
+}
+
+func (p *scheduleParser) peek() scheduleToken {
+	for p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokFiller {
+		p.pos++
+	}
+	if p.pos >= len(p.tokens) {
+		return scheduleToken{kind: "end"}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *scheduleParser) next() scheduleToken {
+	tok := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return tok
+}
+
+// fail reports what was understood so far and what was expected next
+func (p *scheduleParser) fail(expected string) error {
+	var understood []string
+	for _, tok := range p.tokens[:p.pos] {
+		understood = append(understood, tok.raw)
+	}
+	found := "end of schedule"
+	if tok := p.peek(); tok.kind != "end" {
+		found = fmt.Sprintf("%q", tok.raw)
+	}
+	if len(understood) == 0 {
+		return fmt.Errorf("could not interpret schedule %q: expected %s, found %s", p.spec, expected, found)
+	}
+	return fmt.Errorf("could not interpret schedule %q: understood %q, then expected %s but found %s",
+		p.spec, strings.Join(understood, " "), expected, found)
+}
+
+func (p *scheduleParser) parse() (ResolvedSchedule, error) {
+	var days []int // nil means every day
+	daysLabel := "every day"
+
+	switch tok := p.peek(); tok.kind {
+	case tokHourly:
+		p.next()
+		return p.finish(ResolvedSchedule{Cron: "0 * * * *", Description: "every hour"})
+	case tokDaily:
+		p.next()
+	case tokEvery:
+		p.next()
+		switch tok := p.peek(); tok.kind {
+		case tokNumber, tokSecond, tokMinute, tokHour:
+			return p.parseInterval()
+		case tokDay:
+			p.next()
+		case tokWeekday, tokWeekend, tokDow:
+			days, daysLabel = p.parseDays()
+		default:
+			return ResolvedSchedule{}, p.fail("a number, \"second\", \"minute\", \"hour\", \"day\", \"weekday\" or a day name")
+		}
+	case tokWeekday, tokWeekend, tokDow:
+		days, daysLabel = p.parseDays()
+	}
+
+	if p.peek().kind == tokAt {
+		p.next()
+	}
+	return p.parseTimeOfDay(days, daysLabel)
+}
+
+func (p *scheduleParser) parseInterval() (ResolvedSchedule, error) {
+	n := 1
+	if p.peek().kind == tokNumber {
+		n = p.next().value
+		if n < 1 {
+			return ResolvedSchedule{}, p.fail("a positive interval")
+		}
+	}
+
+	switch p.peek().kind {
+	case tokSecond:
+		p.next()
+		if n == 1 {
+			return p.finish(ResolvedSchedule{Cron: "* * * * * *", Description: "every second"})
+		}
+		desc := fmt.Sprintf("every %d seconds", n)
+		if 60%n == 0 {
+			return p.finish(ResolvedSchedule{Cron: fmt.Sprintf("*/%d * * * * *", n), Description: desc})
+		}
+		return p.finish(ResolvedSchedule{Cron: fmt.Sprintf("@every %ds", n), Description: desc})
+	case tokMinute:
+		p.next()
+		if n == 1 {
+			return p.finish(ResolvedSchedule{Cron: "* * * * *", Description: "every minute"})
+		}
+		desc := fmt.Sprintf("every %d minutes", n)
+		if 60%n == 0 {
+			return p.finish(ResolvedSchedule{Cron: fmt.Sprintf("*/%d * * * *", n), Description: desc})
+		}
+		return p.finish(ResolvedSchedule{Cron: fmt.Sprintf("@every %dm", n), Description: desc})
+	case tokHour:
+		p.next()
+		if n == 1 {
+			return p.finish(ResolvedSchedule{Cron: "0 * * * *", Description: "every hour"})
+		}
+		desc := fmt.Sprintf("every %d hours", n)
+		if 24%n == 0 {
+			return p.finish(ResolvedSchedule{Cron: fmt.Sprintf("0 */%d * * *", n), Description: desc})
+		}
+		return p.finish(ResolvedSchedule{Cron: fmt.Sprintf("@every %dh", n), Description: desc})
+	}
+	return ResolvedSchedule{}, p.fail("\"seconds\", \"minutes\" or \"hours\"")
+}
+
+// parseDays reads "weekday", "weekend" or a list of day names
+func (p *scheduleParser) parseDays() ([]int, string) {
+	switch tok := p.peek(); tok.kind {
+	case tokWeekday:
+		p.next()
+		return []int{1, 2, 3, 4, 5}, "on weekdays"
+	case tokWeekend:
+		p.next()
+		return []int{0, 6}, "on weekends"
+	}
+
+	var days []int
+	var labels []string
+	for p.peek().kind == tokDow {
+		day := p.next().value
+		days = append(days, day)
+		labels = append(labels, dayLabels[day])
+		if p.peek().kind == tokAnd {
+			p.next()
+		}
+	}
+	return days, "on " + strings.Join(labels, ", ")
+}
+
+func (p *scheduleParser) parseTimeOfDay(days []int, daysLabel string) (ResolvedSchedule, error) {
+	minutes := -1
+	switch tok := p.peek(); tok.kind {
+	case tokTime:
+		p.next()
+		if tok.value < 0 {
+			p.pos--
+			return ResolvedSchedule{}, p.fail("a valid time of day")
+		}
+		minutes = tok.value
+	case tokNoon:
+		p.next()
+		minutes = 12 * 60
+	case tokMidnight:
+		p.next()
+		minutes = 0
+	case tokSunrise, tokSunset, tokNumber:
+		solar, desc, err := p.parseSolar()
+		if err != nil {
+			return ResolvedSchedule{}, err
+		}
+		if days != nil {
+			return ResolvedSchedule{}, fmt.Errorf("could not interpret schedule %q: understood %s %s, but solar schedules can't be limited to specific days", p.spec, daysLabel, desc)
+		}
+		return p.finish(ResolvedSchedule{Solar: solar, Description: "every day " + desc})
+	default:
+		return ResolvedSchedule{}, p.fail("a time such as 7:15, 7pm, noon or sunset")
+	}
+
+	dow := "*"
+	if days != nil {
+		parts := make([]string, len(days))
+		for i, d := range days {
+			parts[i] = strconv.Itoa(d)
+		}
+		dow = strings.Join(parts, ",")
+		if dow == "1,2,3,4,5" {
+			dow = "1-5"
+		}
+	}
+	return p.finish(ResolvedSchedule{
+		Cron:        fmt.Sprintf("%d %d * * %s", minutes%60, minutes/60, dow),
+		Description: fmt.Sprintf("%s at %02d:%02d", daysLabel, minutes/60, minutes%60),
+	})
+}
+
+// parseSolar reads "sunset" or "30 minutes before sunrise"
+func (p *scheduleParser) parseSolar() (string, string, error) {
+	offset := 0
+	if p.peek().kind == tokNumber {
+		n := p.next().value
+		unit := p.next()
+		switch unit.kind {
+		case tokMinute:
+			offset = n
+		case tokHour:
+			offset = n * 60
+		default:
+			p.pos--
+			return "", "", p.fail("\"minutes\" or \"hours\"")
+		}
+		switch p.next().kind {
+		case tokBefore:
+			offset = -offset
+		case tokAfter:
+		default:
+			p.pos--
+			return "", "", p.fail("\"before\" or \"after\"")
+		}
+	}
+
+	event := p.next()
+	if event.kind != tokSunrise && event.kind != tokSunset {
+		p.pos--
+		return "", "", p.fail("\"sunrise\" or \"sunset\"")
+	}
+
+	solar, desc := "@"+event.kind, "at "+event.kind
+	switch {
+	case offset > 0:
+		solar += fmt.Sprintf("+%dm", offset)
+		desc = fmt.Sprintf("%d minutes after %s", offset, event.kind)
+	case offset < 0:
+		solar += fmt.Sprintf("-%dm", -offset)
+		desc = fmt.Sprintf("%d minutes before %s", -offset, event.kind)
+	}
+	return solar, desc, nil
+}
+
+// finish checks that the whole phrase was consumed
+func (p *scheduleParser) finish(result ResolvedSchedule) (ResolvedSchedule, error) {
+	if p.peek().kind != "end" {
+		return ResolvedSchedule{}, p.fail("end of schedule")
+	}
+	if result.Cron != "" {
+		if _, err := cronParser.Parse(result.Cron); err != nil {
+			return ResolvedSchedule{}, fmt.Errorf("schedule %q was understood as %s but produced invalid cron %q: %w", p.spec, result.Description, result.Cron, err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveSchedule(t *testing.T) {
+	tests := []struct {
+		spec  string
+		cron  string
+		solar string
+		desc  string
+	}{
+		// Cron passthrough
+		{"*/5 * * * *", "*/5 * * * *", "", "cron */5 * * * *"},
+		{"@daily", "@daily", "", "cron @daily"},
+		{"*/15 * * * * *", "*/15 * * * * *", "", "cron */15 * * * * *"},
+		{"@every 30s", "@every 30s", "", "cron @every 30s"},
+		{"@sunrise+30m", "", "@sunrise+30m", "@sunrise+30m"},
+
+		// English
+		{"every weekday at 7:15", "15 7 * * 1-5", "", "on weekdays at 07:15"},
+		{"daily at 6:30pm", "30 18 * * *", "", "every day at 18:30"},
+		{"every day at noon", "0 12 * * *", "", "every day at 12:00"},
+		{"at midnight", "0 0 * * *", "", "every day at 00:00"},
+		{"every weekend at 9 am", "0 9 * * 0,6", "", "on weekends at 09:00"},
+		{"every Monday, Wednesday and Friday at 7:00", "0 7 * * 1,3,5", "", "on Monday, Wednesday, Friday at 07:00"},
+		{"on Sundays at 10:00", "0 10 * * 0", "", "on Sunday at 10:00"},
+		{"every 5 minutes", "*/5 * * * *", "", "every 5 minutes"},
+		{"every 7 minutes", "@every 7m", "", "every 7 minutes"},
+		{"every minute", "* * * * *", "", "every minute"},
+		{"every 30 seconds", "*/30 * * * * *", "", "every 30 seconds"},
+		{"every 45 seconds", "@every 45s", "", "every 45 seconds"},
+		{"every 2 hours", "0 */2 * * *", "", "every 2 hours"},
+		{"hourly", "0 * * * *", "", "every hour"},
+		{"12am", "0 0 * * *", "", "every day at 00:00"},
+
+		// Solar
+		{"daily at sunset", "", "@sunset", "every day at sunset"},
+		{"30 minutes before sunrise", "", "@sunrise-30m", "every day 30 minutes before sunrise"},
+		{"every day 1 hour after sunset", "", "@sunset+60m", "every day 60 minutes after sunset"},
+
+		// Other languages
+		{"jeden Werktag um 7:15", "15 7 * * 1-5", "", "on weekdays at 07:15"},
+		{"täglich um 8 Uhr", "0 8 * * *", "", "every day at 08:00"},
+		{"täglich bei Sonnenuntergang", "", "@sunset", "every day at sunset"},
+		{"todos los días a las 7:30", "30 7 * * *", "", "every day at 07:30"},
+		{"tous les jours à 7h15", "15 7 * * *", "", "every day at 07:15"},
+		{"lunes y jueves a las 20:00", "0 20 * * 1,4", "", "on Monday, Thursday at 20:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ResolveSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("ResolveSchedule(%q) error: %v", tt.spec, err)
+			}
+			if got.Cron != tt.cron || got.Solar != tt.solar || got.Description != tt.desc {
+				t.Errorf("ResolveSchedule(%q) = %+v, want cron=%q solar=%q desc=%q", tt.spec, got, tt.cron, tt.solar, tt.desc)
+			}
+		})
+	}
+}
+
+func TestResolveSchedule_ErrorsEchoInterpretation(t *testing.T) {
+	tests := []struct {
+		spec     string
+		contains []string
+	}{
+		{"every weekday at 25:15", []string{`understood "every weekday at"`, "valid time of day", `"25:15"`}},
+		{"every weekday at 7:15 sharp", []string{`understood "every weekday at 7:15"`, "end of schedule", `"sharp"`}},
+		{"every fortnight", []string{`understood "every"`, `"fortnight"`}},
+		{"whenever", []string{"expected a time", `"whenever"`}},
+		{"every weekday at sunset", []string{"on weekdays at sunset", "can't be limited"}},
+		{"10 minutes around sunset", []string{`understood "10 minutes"`, `"before" or "after"`}},
+		{"", []string{"empty"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ResolveSchedule(tt.spec)
+			if err == nil {
+				t.Fatalf("ResolveSchedule(%q) expected error", tt.spec)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
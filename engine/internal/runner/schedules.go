@@ -0,0 +1,154 @@
+package runner
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ErrNoSchedule is returned when pausing or resuming an automation without a schedule
+var ErrNoSchedule = errors.New("automation has no schedule")
+
+// ScheduleInfo describes one cron entry of an automation; automations with a
+// list of schedules have one per entry
+type ScheduleInfo struct {
+	AutomationID string     `json:"automation_id"`
+	Schedule     string     `json:"schedule"`       // As written in config.schedule
+	Cron         string     `json:"cron,omitempty"` // Resolved expression; empty for solar events
+	Next         *time.Time `json:"next,omitempty"` // When the schedule next comes due
+	Prev         *time.Time `json:"prev,omitempty"` // When it last came due since loading, paused or not
+	Paused       bool       `json:"paused"`
+	PausedAt     *time.Time `json:"paused_at,omitempty"`
+}
+
+// cronEntry is one registered config.schedule entry of an automation
+type cronEntry struct {
+	spec     string
+	resolved ResolvedSchedule
+	schedule cron.Schedule
+	id       cron.EntryID
+}
+
+// cronSchedule builds the scheduler entry for a resolved schedule
+func (r *Runner) cronSchedule(resolved ResolvedSchedule) (cron.Schedule, error) {
+	if resolved.Solar != "" {
+		return r.newSolarSchedule(resolved.Solar)
+	}
+	return cronParser.Parse(resolved.Cron)
+}
+
+// schedulePauses holds the automations whose on_schedule is suspended. Pauses
+// are kept in the state store so they survive reloads and restarts.
+type schedulePauses struct {
+	mu sync.Mutex
+	at map[string]time.Time
+}
+
+func (p *schedulePauses) get(automationID string) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	at, ok := p.at[automationID]
+	return at, ok
+}
+
+// loadPausedSchedules restores pauses from the state store
+func (r *Runner) loadPausedSchedules() {
+	if r.stateStore == nil {
+		return
+	}
+	paused, err := r.stateStore.PausedSchedules()
+	if err != nil {
+		slog.Error("Failed to load paused schedules", "error", err)
+		return
+	}
+	r.pauses.mu.Lock()
+	r.pauses.at = paused
+	r.pauses.mu.Unlock()
+}
+
+// Schedules lists the cron entries of all loaded automations, ordered by ID
+// and then as written in config.schedule
+func (r *Runner) Schedules() []ScheduleInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schedules := make([]ScheduleInfo, 0)
+	for id, a := range r.automations {
+		pausedAt, paused := r.pauses.get(id)
+		for _, e := range a.cronEntries {
+			info := ScheduleInfo{AutomationID: id, Schedule: e.spec, Cron: e.resolved.Cron}
+			entry := r.cron.Entry(e.id)
+			if !entry.Next.IsZero() {
+				info.Next = &entry.Next
+			}
+			if !entry.Prev.IsZero() {
+				info.Prev = &entry.Prev
+			}
+			if paused {
+				info.Paused = true
+				info.PausedAt = &pausedAt
+			}
+			schedules = append(schedules, info)
+		}
+	}
+	sort.SliceStable(schedules, func(i, j int) bool { return schedules[i].AutomationID < schedules[j].AutomationID })
+	return schedules
+}
+
+// PauseSchedule stops an automation's on_schedule runs until ResumeSchedule.
+// Its MQTT, timer and manual triggers keep working.
+func (r *Runner) PauseSchedule(automationID string) error {
+	if err := r.checkScheduled(automationID); err != nil {
+		return err
+	}
+	now := time.Now()
+	if r.stateStore != nil {
+		if err := r.stateStore.PauseSchedule(automationID, now); err != nil {
+			return err
+		}
+	}
+	r.pauses.mu.Lock()
+	if r.pauses.at == nil {
+		r.pauses.at = make(map[string]time.Time)
+	}
+	if _, ok := r.pauses.at[automationID]; !ok {
+		r.pauses.at[automationID] = now
+	}
+	r.pauses.mu.Unlock()
+	slog.Info("Schedule paused", "id", automationID)
+	return nil
+}
+
+// ResumeSchedule lets a paused schedule run again from its next due time
+func (r *Runner) ResumeSchedule(automationID string) error {
+	if err := r.checkScheduled(automationID); err != nil {
+		return err
+	}
+	if r.stateStore != nil {
+		if err := r.stateStore.ResumeSchedule(automationID); err != nil {
+			return err
+		}
+	}
+	r.pauses.mu.Lock()
+	delete(r.pauses.at, automationID)
+	r.pauses.mu.Unlock()
+	slog.Info("Schedule resumed", "id", automationID)
+	return nil
+}
+
+func (r *Runner) checkScheduled(automationID string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	a, ok := r.automations[automationID]
+	if !ok {
+		return ErrAutomationNotFound
+	}
+	if len(a.cronEntries) == 0 {
+		return ErrNoSchedule
+	}
+	return nil
+}
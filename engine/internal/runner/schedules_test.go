@@ -0,0 +1,159 @@
+package runner
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+func TestPauseSchedule(t *testing.T) {
+	store, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	r := newTestRunner()
+	r.stateStore = store
+	r.cron = cron.New()
+	r.cron.Start()
+	defer r.cron.Stop()
+	a := addTestAutomation(t, r, "morning_lights", `
+def on_schedule(ctx):
+    ctx.log("lights on")
+
+def on_message(topic, payload, ctx):
+    ctx.log("motion")
+
+config = {"name": "Morning Lights", "schedule": "0 7 * * *"}
+`)
+	id, _ := r.cron.AddFunc("0 7 * * *", func() {})
+	a.cronEntries = []cronEntry{{spec: "0 7 * * *", resolved: ResolvedSchedule{Cron: "0 7 * * *"}, id: id}}
+	addTestAutomation(t, r, "motion", `
+def on_message(topic, payload, ctx):
+    pass
+
+config = {"name": "Motion", "subscribe": ["zigbee2mqtt/hallway_motion"]}
+`)
+
+	schedules := r.Schedules()
+	if len(schedules) != 1 || schedules[0].AutomationID != "morning_lights" || schedules[0].Next == nil || schedules[0].Paused {
+		t.Fatalf("Schedules() = %+v", schedules)
+	}
+
+	if err := r.PauseSchedule("motion"); !errors.Is(err, ErrNoSchedule) {
+		t.Errorf("PauseSchedule without schedule = %v, want ErrNoSchedule", err)
+	}
+	if err := r.PauseSchedule("missing"); !errors.Is(err, ErrAutomationNotFound) {
+		t.Errorf("PauseSchedule of unknown automation = %v, want ErrAutomationNotFound", err)
+	}
+	if err := r.PauseSchedule("morning_lights"); err != nil {
+		t.Fatalf("PauseSchedule failed: %v", err)
+	}
+	if s := r.Schedules(); !s[0].Paused || s[0].PausedAt == nil {
+		t.Errorf("after pause: %+v", s[0])
+	}
+
+	// Paused schedules don't run; other triggers still do
+	r.enqueueSchedule(a, "0 7 * * *")
+	r.enqueueMessage(a, Trigger{Type: TriggerMQTT, Topic: "zigbee2mqtt/hallway_motion"}, []byte("{}"))
+	runs := waitForRuns(t, r, "morning_lights", 1)
+	time.Sleep(20 * time.Millisecond)
+	if runs = r.GetRuns("morning_lights"); len(runs) != 1 || runs[0].Handler != "on_message" {
+		t.Fatalf("runs while paused = %+v", runs)
+	}
+
+	// The pause survives a restart
+	restarted := newTestRunner()
+	restarted.stateStore = store
+	restarted.loadPausedSchedules()
+	if _, paused := restarted.pauses.get("morning_lights"); !paused {
+		t.Error("pause was not restored from the state store")
+	}
+
+	if err := r.ResumeSchedule("morning_lights"); err != nil {
+		t.Fatalf("ResumeSchedule failed: %v", err)
+	}
+	r.enqueueSchedule(a, "0 7 * * *")
+	if runs := waitForRuns(t, r, "morning_lights", 2); runs[1].Handler != "on_schedule" {
+		t.Errorf("runs after resume = %+v", runs)
+	}
+	if paused, _ := store.PausedSchedules(); len(paused) != 0 {
+		t.Errorf("stored pauses after resume = %v", paused)
+	}
+}
+
+func TestMultipleSchedules(t *testing.T) {
+	r := New(nil, nil)
+	dir := t.TempDir()
+	r.SetAutomationsDir(dir)
+
+	if err := r.LoadAutomation(writeWebhookAutomation(t, dir, "poller", `
+config = {"name": "Poller", "schedule": ["* * * * * *", "every weekday at 7:15"]}
+
+def on_schedule(ctx):
+    ctx.log("fired by " + ctx.trigger.schedule)
+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	schedules := r.Schedules()
+	if len(schedules) != 2 || schedules[0].Schedule != "* * * * * *" || schedules[1].Cron != "15 7 * * 1-5" || schedules[0].Next == nil {
+		t.Fatalf("Schedules() = %+v", schedules)
+	}
+	if a := r.ListAutomations(); a[0].Schedule != nil || len(a[0].Schedules) != 2 {
+		t.Errorf("automation schedules = %+v / %+v", a[0].Schedule, a[0].Schedules)
+	}
+	waitForLog(t, r, "fired by * * * * * *")
+
+	// Pausing covers every entry
+	if err := r.PauseSchedule("poller"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range r.Schedules() {
+		if !s.Paused {
+			t.Errorf("entry not paused: %+v", s)
+		}
+	}
+
+	r.UnloadAutomation("poller")
+	if entries := r.cron.Entries(); len(entries) != 0 {
+		t.Errorf("cron entries after unload = %d", len(entries))
+	}
+}
+
+func TestExtractConfig_ScheduleList(t *testing.T) {
+	for _, tt := range []struct {
+		src     string
+		specs   []string
+		wantErr string
+	}{
+		{`{"schedule": "@every 30s"}`, []string{"@every 30s"}, ""},
+		{`{"schedule": ["0 7 * * *", "@sunset"]}`, []string{"0 7 * * *", "@sunset"}, ""},
+		{`{"schedule": ["0 7 * * *", 5]}`, nil, "schedule[1]"},
+		{`{"schedule": [""]}`, nil, "schedule[0]"},
+	} {
+		val, err := starlark.Eval(&starlark.Thread{}, "config", tt.src, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := extractConfig(val)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.src, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(config.ScheduleSpecs(), tt.specs) {
+			t.Errorf("%s: specs = %v, %v", tt.src, config.ScheduleSpecs(), err)
+		}
+	}
+}
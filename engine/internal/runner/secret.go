@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/homebrain/engine/internal/secrets"
+	"go.starlark.net/starlark"
+)
+
+// threadLocalSecrets holds the secret values a run has read, redacted from its logs
+const threadLocalSecrets = "homebrain.secrets"
+
+// SetSecrets makes the store's secrets available to automations loaded
+// afterwards via ctx.secret, limited to the names in each config's secrets list
+func (r *Runner) SetSecrets(store *secrets.Store) {
+	r.secrets = store
+}
+
+// SecretNames lists the secrets automations can be given; values are never exposed
+func (r *Runner) SecretNames() []string {
+	return r.secrets.Names()
+}
+
+// secretBuiltin implements ctx.secret(name). Undeclared or undefined secrets
+// return None and log an error.
+func (c *Context) secretBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+
+	allowed := false
+	for _, pattern := range c.allowedSecrets {
+		if matchPattern(pattern, name) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: Attempted to read secret '%s' without permission. Add to secrets in config.", name))
+		c.audit.record(c.automationID, AuditSecretDenied, name)
+		return starlark.None, nil
+	}
+
+	var value string
+	ok := false
+	if c.secret != nil {
+		value, ok = c.secret(name)
+	}
+	if !ok {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: secret '%s' is not defined", name))
+		return starlark.None, nil
+	}
+	c.audit.record(c.automationID, AuditSecretRead, name)
+	if value != "" {
+		revealed, _ := thread.Local(threadLocalSecrets).([]string)
+		thread.SetLocal(threadLocalSecrets, append(revealed, value))
+	}
+	return starlark.String(value), nil
+}
+
+// redactSecrets masks secret values the run has read
+func redactSecrets(thread *starlark.Thread, message string) string {
+	if thread == nil {
+		return message
+	}
+	revealed, _ := thread.Local(threadLocalSecrets).([]string)
+	for _, value := range revealed {
+		message = strings.ReplaceAll(message, value, "***")
+	}
+	return message
+}
+
+// redactedError is a handler error with the run's secrets masked in its
+// message. The wrapped error stays reachable for errors.Is and errors.As.
+type redactedError struct {
+	err     error
+	msg     string
+	secrets []string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redact masks the secrets in other text about the same error, such as its backtrace
+func (e *redactedError) redact(text string) string {
+	for _, value := range e.secrets {
+		text = strings.ReplaceAll(text, value, "***")
+	}
+	return text
+}
+
+// redactError masks the secrets the run has read in err's message, so the
+// logs, run records, replays and on_error never see them
+func redactError(thread *starlark.Thread, err error) error {
+	revealed, _ := thread.Local(threadLocalSecrets).([]string)
+	if err == nil || len(revealed) == 0 {
+		return err
+	}
+	e := &redactedError{err: err, secrets: revealed}
+	e.msg = e.redact(err.Error())
+	return e
+}
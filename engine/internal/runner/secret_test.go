@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/secrets"
+)
+
+func TestSecret(t *testing.T) {
+	store, err := secrets.Load("", []string{"HOMEBRAIN_SECRET_WEATHER_API_KEY=abc123", "HOMEBRAIN_SECRET_ALARM_PIN=4711"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRunner()
+	r.SetSecrets(store)
+	a := addTestAutomation(t, r, "weather", `
+config = {"name": "Weather", "secrets": ["weather_*"]}
+
+def on_schedule(ctx):
+    key = ctx.secret("weather_api_key")
+    ctx.log("using key %s" % key)
+    return [key == "abc123", ctx.secret("alarm_pin"), ctx.secret("weather_backup_key")]
+`)
+	a.context.allowedSecrets = a.Config.Secrets
+	a.context.secret = store.Get
+
+	record, err := r.RunManual("weather", ManualTrigger{})
+	if err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	if got, ok := record.Result.([]any); !ok || len(got) != 3 || got[0] != true || got[1] != nil || got[2] != nil {
+		t.Errorf("result = %#v, want [true, None, None]", record.Result)
+	}
+
+	var logs []string
+	for _, entry := range r.GetLogs() {
+		logs = append(logs, entry.Message)
+	}
+	joined := strings.Join(logs, "\n")
+	for _, want := range []string{
+		"using key ***",
+		"read secret 'alarm_pin' without permission",
+		"secret 'weather_backup_key' is not defined",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("logs missing %q:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "abc123") {
+		t.Errorf("secret value leaked into logs:\n%s", joined)
+	}
+
+	violations := r.GetViolations()
+	if len(violations) != 1 || violations[0].Kind != AuditSecretDenied || violations[0].Target != "alarm_pin" {
+		t.Errorf("violations = %+v", violations)
+	}
+}
+
+func TestSecret_RedactedFromErrors(t *testing.T) {
+	store, _ := secrets.Load("", []string{"HOMEBRAIN_SECRET_WEATHER_API_KEY=abc123"})
+	r := newTestRunner()
+	r.SetSecrets(store)
+	a := addTestAutomation(t, r, "weather", `
+config = {"name": "Weather", "secrets": ["weather_api_key"]}
+
+def on_schedule(ctx):
+    fail("rejected key " + ctx.secret("weather_api_key"))
+
+def on_error(error, info, ctx):
+    ctx.log("on_error: %s %s" % (error, info["backtrace"]))
+`)
+	a.context.allowedSecrets = a.Config.Secrets
+	a.context.secret = store.Get
+	a.onError, _ = a.globals["on_error"].(starlark.Callable)
+
+	record, err := r.RunManual("weather", ManualTrigger{})
+	if err == nil || !strings.Contains(record.Error, "rejected key ***") {
+		t.Fatalf("RunManual = %+v, %v", record, err)
+	}
+	var logs []string
+	for _, entry := range r.GetLogs() {
+		logs = append(logs, entry.Message)
+	}
+	joined := strings.Join(logs, "\n")
+	if !strings.Contains(joined, "on_error: ") || strings.Contains(joined+err.Error()+record.Error, "abc123") {
+		t.Errorf("secret value leaked: %v\n%s", err, joined)
+	}
+}
+
+func TestSecret_DryRunPlaceholder(t *testing.T) {
+	store, _ := secrets.Load("", []string{"HOMEBRAIN_SECRET_WEATHER_API_KEY=abc123"})
+	r := newTestRunner()
+	r.SetSecrets(store)
+
+	result, err := r.DryRun(DryRunRequest{Code: `
+config = {"name": "Weather", "secrets": ["weather_api_key"]}
+
+def on_schedule(ctx):
+    return ctx.secret("weather_api_key")
+`})
+	if err != nil || !result.Success {
+		t.Fatalf("DryRun = %+v, %v", result, err)
+	}
+	if result.Result != "<secret:weather_api_key>" {
+		t.Errorf("result = %v, want the placeholder", result.Result)
+	}
+}
@@ -0,0 +1,145 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+// StateSeed copies a retained MQTT topic into a global state key at startup,
+// so handlers see the last known value instead of None after a reboot
+type StateSeed struct {
+	Topic string
+	Field string // Top-level field of a JSON object payload; empty stores the whole payload
+	Key   string
+}
+
+// ParseStateSeeds parses "topic=key" and "topic:field=key" entries separated by
+// commas, e.g. "zigbee2mqtt/living_room_temp:temperature=sensors.living_room.temp"
+func ParseStateSeeds(spec string) ([]StateSeed, error) {
+	var seeds []StateSeed
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		source, key, ok := strings.Cut(part, "=")
+		topic, field, _ := strings.Cut(strings.TrimSpace(source), ":")
+		key = strings.TrimSpace(key)
+		if !ok || topic == "" || key == "" {
+			return nil, fmt.Errorf("invalid state seed %q (want topic=key or topic:field=key)", part)
+		}
+		if strings.ContainsAny(topic, "+#") {
+			return nil, fmt.Errorf("state seed topic %q must not contain wildcards", topic)
+		}
+		seeds = append(seeds, StateSeed{Topic: topic, Field: strings.TrimSpace(field), Key: key})
+	}
+	return seeds, nil
+}
+
+// seedWriter is reported as the writer of seeded keys to on_state_change
+const seedWriter = "seed"
+
+// retainedSource is the part of the MQTT client used for seeding
+type retainedSource interface {
+	Subscribe(topic string, handler mqtt.MessageHandler) error
+	Unsubscribe(topic string) error
+}
+
+// SeedGlobalState subscribes to the seed topics, waits up to timeout for their
+// retained messages and writes them to global state. Keys whose topic has no
+// retained message keep their stored value. Call it before loading automations.
+func (r *Runner) SeedGlobalState(seeds []StateSeed, timeout time.Duration) int {
+	if r.mqttClient == nil || r.stateStore == nil {
+		return 0
+	}
+	return seedGlobalState(r.mqttClient, func(key string, value any) error {
+		return r.setGlobal(nil, seedWriter, key, value)
+	}, seeds, timeout)
+}
+
+// seedGlobalState writes the seeds received from source with write
+func seedGlobalState(source retainedSource, write func(key string, value any) error, seeds []StateSeed, timeout time.Duration) int {
+	var mu sync.Mutex
+	received := make(map[string][]byte)
+	done := make(chan struct{})
+
+	topics := make(map[string]bool)
+	for _, seed := range seeds {
+		topics[seed.Topic] = true
+	}
+	for topic := range topics {
+		err := source.Subscribe(topic, func(topic string, payload []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := received[topic]; ok {
+				return
+			}
+			received[topic] = payload
+			if len(received) == len(topics) {
+				close(done)
+			}
+		})
+		if err != nil {
+			slog.Error("Failed to subscribe to state seed topic", "topic", topic, "error", err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+	for topic := range topics {
+		source.Unsubscribe(topic)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	seeded := 0
+	var missing []string
+	for _, seed := range seeds {
+		payload, ok := received[seed.Topic]
+		if !ok {
+			missing = append(missing, seed.Topic)
+			continue
+		}
+		value, err := seedValue(payload, seed.Field)
+		if err != nil {
+			slog.Warn("Skipping state seed", "topic", seed.Topic, "key", seed.Key, "error", err)
+			continue
+		}
+		if err := write(seed.Key, value); err != nil {
+			slog.Error("Failed to seed global state", "key", seed.Key, "error", err)
+			continue
+		}
+		seeded++
+	}
+	slog.Info("Seeded global state from retained topics", "seeded", seeded, "missing", missing)
+	return seeded
+}
+
+// seedValue decodes a JSON payload (keeping non-JSON payloads as strings) and
+// picks field from it if one is set
+func seedValue(payload []byte, field string) (any, error) {
+	var value any
+	if err := json.Unmarshal(payload, &value); err != nil {
+		value = string(payload)
+	}
+	if field == "" {
+		return value, nil
+	}
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("payload is not a JSON object")
+	}
+	v, ok := object[field]
+	if !ok {
+		return nil, fmt.Errorf("payload has no field %q", field)
+	}
+	return v, nil
+}
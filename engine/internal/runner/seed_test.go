@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+// retainedBroker delivers a stored message for each subscribed topic, as a
+// broker does with retained messages
+type retainedBroker struct {
+	mu           sync.Mutex
+	retained     map[string]string
+	unsubscribed []string
+}
+
+func (b *retainedBroker) Subscribe(topic string, handler mqtt.MessageHandler) error {
+	if payload, ok := b.retained[topic]; ok {
+		go handler(topic, []byte(payload))
+	}
+	return nil
+}
+
+func (b *retainedBroker) Unsubscribe(topic string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unsubscribed = append(b.unsubscribed, topic)
+	return nil
+}
+
+func TestParseStateSeeds(t *testing.T) {
+	seeds, err := ParseStateSeeds("zigbee2mqtt/living_room_temp:temperature=sensors.living_room.temp, alarm/state = alarm.state")
+	if err != nil {
+		t.Fatalf("ParseStateSeeds failed: %v", err)
+	}
+	want := []StateSeed{
+		{Topic: "zigbee2mqtt/living_room_temp", Field: "temperature", Key: "sensors.living_room.temp"},
+		{Topic: "alarm/state", Key: "alarm.state"},
+	}
+	if !reflect.DeepEqual(seeds, want) {
+		t.Errorf("seeds = %+v, want %+v", seeds, want)
+	}
+
+	for _, bad := range []string{"alarm/state", "=alarm.state", "alarm/state=", "zigbee2mqtt/+=sensors"} {
+		if _, err := ParseStateSeeds(bad); err == nil {
+			t.Errorf("ParseStateSeeds(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSeedGlobalState(t *testing.T) {
+	broker := &retainedBroker{retained: map[string]string{
+		"zigbee2mqtt/living_room_temp": `{"temperature": 21.5, "humidity": 40}`,
+		"alarm/state":                  "armed_away",
+	}}
+	store := newMemoryState(nil, map[string]any{"presence.home": true}, nil)
+	seeds := []StateSeed{
+		{Topic: "zigbee2mqtt/living_room_temp", Field: "temperature", Key: "sensors.living_room.temp"},
+		{Topic: "zigbee2mqtt/living_room_temp", Field: "humidity", Key: "sensors.living_room.humidity"},
+		{Topic: "zigbee2mqtt/living_room_temp", Field: "battery", Key: "sensors.living_room.battery"},
+		{Topic: "alarm/state", Key: "alarm.state"},
+		{Topic: "presence/home", Key: "presence.home"}, // Nothing retained
+	}
+
+	start := time.Now()
+	write := func(key string, value any) error {
+		_, err := storeGlobal(store, key, value, false, time.Now())
+		return err
+	}
+	if n := seedGlobalState(broker, write, seeds, 50*time.Millisecond); n != 3 {
+		t.Errorf("seeded %d keys, want 3", n)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("seeding should wait for the missing topic until the timeout")
+	}
+
+	_, global := store.snapshot()
+	want := map[string]any{
+		"sensors.living_room.temp":     21.5,
+		"sensors.living_room.humidity": float64(40),
+		"alarm.state":                  "armed_away",
+		"presence.home":                true,
+	}
+	if !reflect.DeepEqual(global, want) {
+		t.Errorf("global = %v, want %v", global, want)
+	}
+	if len(broker.unsubscribed) != 3 {
+		t.Errorf("unsubscribed = %v, want all three seed topics", broker.unsubscribed)
+	}
+}
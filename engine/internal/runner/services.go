@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// validServiceName is the form of service names, as in "announce"
+var validServiceName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// extractServices reads the optional top-level services dict, which maps
+// service names to functions other automations may call with
+// ctx.call(automation_id, service, args)
+func extractServices(globals starlark.StringDict) (map[string]starlark.Callable, error) {
+	v, ok := globals["services"]
+	if !ok {
+		return nil, nil
+	}
+	dict, ok := v.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("services must be a dict of name to function")
+	}
+	services := make(map[string]starlark.Callable, dict.Len())
+	for _, item := range dict.Items() {
+		name, ok := item[0].(starlark.String)
+		if !ok || !validServiceName.MatchString(string(name)) {
+			return nil, fmt.Errorf("service name %s must be letters, digits and underscores", item[0])
+		}
+		fn, ok := item[1].(starlark.Callable)
+		if !ok {
+			return nil, fmt.Errorf("service %s must be a function", name)
+		}
+		services[string(name)] = fn
+	}
+	return services, nil
+}
+
+// serviceNames lists an automation's services, sorted
+func serviceNames(services map[string]starlark.Callable) []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// callService backs ctx.call with a service: it runs service(args, ctx) in the
+// target automation, with the target's own context and permissions,
+// synchronously on the caller's worker and under the target's run lock like
+// any call. Values cross as plain data, so neither side can mutate the
+// other's. Both automations log the call.
+func (r *Runner) callService(thread *starlark.Thread, caller, id, service string, args any) (any, error) {
+	depth, _ := thread.Local(threadLocalCallDepth).(int)
+	if depth >= maxCallDepth {
+		return nil, fmt.Errorf("call depth limit (%d) exceeded", maxCallDepth)
+	}
+
+	automation, err := r.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	if !automation.Config.Enabled {
+		return nil, fmt.Errorf("automation %s is disabled", id)
+	}
+	fn, ok := automation.services[service]
+	if !ok {
+		available := "none"
+		if len(automation.services) > 0 {
+			available = strings.Join(serviceNames(automation.services), ", ")
+		}
+		return nil, fmt.Errorf("%s has no service %q (available: %s)", id, service, available)
+	}
+
+	r.audit.record(caller, AuditServiceCall, id+":"+service)
+	r.addLog(caller, LogLevelInfo, fmt.Sprintf("calling service %s.%s", id, service))
+	r.addLog(automation.ID, LogLevelInfo, fmt.Sprintf("service %s called by %s", service, caller))
+	priority, _ := thread.Local(threadLocalPriority).(string)
+	chain, _ := thread.Local(threadLocalRunChain).(*runChain)
+	trigger := Trigger{
+		Type:      TriggerCall,
+		Caller:    caller,
+		Service:   service,
+		Time:      time.Now(),
+		depth:     loopDepth(thread),
+		callDepth: depth + 1,
+		priority:  priority,
+		chain:     chain,
+	}
+	record, err := r.execute(automation, trigger, "services."+service, fn, goToStarlark(args))
+	if err != nil {
+		return nil, err
+	}
+	return record.Result, nil
+}
@@ -0,0 +1,169 @@
+package runner
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// serviceTestAutomation registers src with its services and ctx.call
+// wired up the way loadAutomation does it
+func serviceTestAutomation(t *testing.T, r *Runner, id, src string) *Automation {
+	t.Helper()
+	a := addTestAutomation(t, r, id, src)
+	services, err := extractServices(a.globals)
+	if err != nil {
+		t.Fatalf("invalid services in %s: %v", id, err)
+	}
+	a.services = services
+	a.Services = serviceNames(services)
+	a.context.callService = r.callService
+	return a
+}
+
+func TestCallService(t *testing.T) {
+	r := newTestRunner()
+	tts := serviceTestAutomation(t, r, "tts", `
+config = {"name": "TTS"}
+
+def announce(args, ctx):
+    args["rooms"].append("hallway")
+    ctx.log("announcing %s in %s" % (args["text"], ", ".join(args["rooms"])))
+    return {"spoken": args["text"], "caller": ctx.trigger.caller, "service": ctx.trigger.service}
+
+def _private(args, ctx):
+    pass
+
+services = {"announce": announce}
+`)
+	serviceTestAutomation(t, r, "doorbell", `
+config = {"name": "Doorbell"}
+
+def on_schedule(ctx):
+    rooms = ["kitchen"]
+    result = ctx.call("tts", "announce", {"text": "ding dong", "rooms": rooms})
+    ctx.log("%s %s %s %d" % (result["spoken"], result["caller"], result["service"], len(rooms)))
+    return result["spoken"]
+`)
+
+	if got := tts.Services; len(got) != 1 || got[0] != "announce" {
+		t.Errorf("Services = %v", got)
+	}
+	for _, a := range r.ListAutomations() {
+		if a.ID == "tts" && !slices.Equal(a.Services, []string{"announce"}) {
+			t.Errorf("listed services = %v", a.Services)
+		}
+	}
+	run, err := r.RunManual("doorbell", ManualTrigger{})
+	if err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	if run.Result != "ding dong" {
+		t.Errorf("result = %v", run.Result)
+	}
+
+	var logs []string
+	for _, entry := range r.GetLogs() {
+		logs = append(logs, entry.AutomationID+": "+entry.Message)
+	}
+	want := []string{
+		"doorbell: calling service tts.announce",
+		"tts: service announce called by doorbell",
+		"tts: announcing ding dong in kitchen, hallway",
+		// The caller's list is not changed by the service
+		"doorbell: ding dong doorbell announce 1",
+	}
+	if strings.Join(logs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("logs:\n%s\nwant:\n%s", strings.Join(logs, "\n"), strings.Join(want, "\n"))
+	}
+	if runs := r.GetRuns("tts"); len(runs) != 1 || runs[0].Handler != "services.announce" || runs[0].Trigger.Service != "announce" {
+		t.Errorf("tts runs = %+v", runs)
+	}
+
+	graph := r.Graph()
+	found := false
+	for _, e := range graph.Edges {
+		if e.From == "automation:doorbell" && e.To == "automation:tts" && e.Type == EdgeCalls && e.Observed == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no calls edge in %+v", graph.Edges)
+	}
+}
+
+func TestCallService_Errors(t *testing.T) {
+	r := newTestRunner()
+	serviceTestAutomation(t, r, "tts", `
+config = {"name": "TTS"}
+
+def announce(args, ctx):
+    return ctx.call("tts", "announce", args)
+
+services = {"announce": announce}
+`)
+	serviceTestAutomation(t, r, "caller", `
+config = {"name": "Caller"}
+
+def on_message(topic, payload, ctx):
+    ctx.call(topic, payload)
+`)
+
+	tests := []struct {
+		topic, service string
+		want           string
+	}{
+		{"tts", "shout", `tts has no service "shout" (available: announce)`},
+		{"caller", "announce", `caller has no service "announce" (available: none)`},
+		{"missing", "announce", "automation not found"},
+		{"tts", "announce", "call cycle"},
+	}
+	for _, tt := range tests {
+		_, err := r.RunManual("caller", ManualTrigger{Topic: tt.topic, Payload: tt.service})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("call(%s, %s) error = %v, want %q", tt.topic, tt.service, err, tt.want)
+		}
+	}
+}
+
+func TestCallService_Arguments(t *testing.T) {
+	r := newTestRunner()
+	serviceTestAutomation(t, r, "tts", `
+config = {"name": "TTS"}
+
+def announce(args, ctx):
+    return args
+
+services = {"announce": announce}
+`)
+	tests := []struct {
+		name string
+		call string
+		want string
+	}{
+		{"Payload with service", `ctx.call("tts", "announce", payload = "x")`, "payload and topic don't apply to service calls"},
+		{"Args without service", `ctx.call("tts", args = {"text": "x"})`, "args needs a service"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceTestAutomation(t, r, "caller", "config = {\"name\": \"Caller\"}\n\ndef on_schedule(ctx):\n    "+tt.call+"\n")
+			if _, err := r.RunManual("caller", ManualTrigger{}); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractServices_Invalid(t *testing.T) {
+	r := newTestRunner()
+	for _, src := range []string{
+		`services = ["announce"]`,
+		`services = {"announce": "not a function"}`,
+		"def f(args, ctx):\n    pass\nservices = {\"bad name\": f}",
+	} {
+		a := addTestAutomation(t, r, "bad", src+"\nconfig = {\"name\": \"Bad\"}\n")
+		if _, err := extractServices(a.globals); err == nil {
+			t.Errorf("extractServices accepted %q", src)
+		}
+	}
+}
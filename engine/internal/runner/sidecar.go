@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"gopkg.in/yaml.v3"
+)
+
+// SidecarExtensions are the config sidecar extensions checked next to an automation file
+var SidecarExtensions = []string{".yaml", ".yml"}
+
+// sidecarPath returns the config sidecar for an automation file, or "" if none exists.
+// For "automations/hallway.star" this is "automations/hallway.yaml" (or .yml).
+func sidecarPath(filePath string) string {
+	base := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	for _, ext := range SidecarExtensions {
+		candidate := base + ext
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// loadSidecar parses a YAML sidecar into a Starlark dict with the same shape
+// as the in-code config dict, so extractConfig handles both.
+func loadSidecar(path string) (*starlark.Dict, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config sidecar: %w", err)
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid config sidecar %s: %w", filepath.Base(path), err)
+	}
+
+	dict, ok := goToStarlark(raw).(*starlark.Dict)
+	if !ok {
+		return starlark.NewDict(0), nil
+	}
+	return dict, nil
+}
+
+// mergeConfig overlays sidecar values onto the in-code config dict.
+// Either may be nil; sidecar keys win.
+func mergeConfig(code starlark.Value, sidecar *starlark.Dict) (starlark.Value, error) {
+	if sidecar == nil {
+		return code, nil
+	}
+	if code == nil {
+		return sidecar, nil
+	}
+
+	codeDict, ok := code.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("config must be a dict")
+	}
+	merged := starlark.NewDict(codeDict.Len() + sidecar.Len())
+	for _, item := range codeDict.Items() {
+		merged.SetKey(item[0], item[1])
+	}
+	for _, item := range sidecar.Items() {
+		merged.SetKey(item[0], item[1])
+	}
+	return merged, nil
+}
@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestSidecarPath(t *testing.T) {
+	dir := t.TempDir()
+	automation := filepath.Join(dir, "hallway.star")
+	os.WriteFile(automation, []byte(""), 0644)
+
+	if got := sidecarPath(automation); got != "" {
+		t.Errorf("sidecarPath without sidecar = %q, want empty", got)
+	}
+
+	sidecar := filepath.Join(dir, "hallway.yml")
+	os.WriteFile(sidecar, []byte("name: Hallway\n"), 0644)
+	if got := sidecarPath(automation); got != sidecar {
+		t.Errorf("sidecarPath = %q, want %q", got, sidecar)
+	}
+}
+
+func TestLoadSidecar_MergesOverCodeConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hallway.yaml")
+	os.WriteFile(path, []byte(`
+subscribe:
+  - zigbee2mqtt/hallway_motion
+schedule: "*/5 * * * *"
+priority: high
+`), 0644)
+
+	sidecar, err := loadSidecar(path)
+	if err != nil {
+		t.Fatalf("loadSidecar failed: %v", err)
+	}
+
+	thread := &starlark.Thread{Name: "test"}
+	globals, err := starlark.ExecFile(thread, "test.star", `config = {"name": "Hallway", "subscribe": ["old/topic"]}`, nil)
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+
+	merged, err := mergeConfig(globals["config"], sidecar)
+	if err != nil {
+		t.Fatalf("mergeConfig failed: %v", err)
+	}
+	config, err := extractConfig(merged)
+	if err != nil {
+		t.Fatalf("extractConfig failed: %v", err)
+	}
+
+	if config.Name != "Hallway" {
+		t.Errorf("Name = %q, want Hallway (from code)", config.Name)
+	}
+	if len(config.Subscribe) != 1 || config.Subscribe[0] != "zigbee2mqtt/hallway_motion" {
+		t.Errorf("Subscribe = %v, want sidecar topic", config.Subscribe)
+	}
+	if config.Schedule != "*/5 * * * *" || config.Priority != PriorityHigh {
+		t.Errorf("Schedule/Priority = %q/%q, want sidecar values", config.Schedule, config.Priority)
+	}
+}
+
+func TestMergeConfig_SidecarOnly(t *testing.T) {
+	sidecar := starlark.NewDict(1)
+	sidecar.SetKey(starlark.String("name"), starlark.String("From YAML"))
+
+	merged, err := mergeConfig(nil, sidecar)
+	if err != nil {
+		t.Fatalf("mergeConfig failed: %v", err)
+	}
+	config, err := extractConfig(merged)
+	if err != nil || config.Name != "From YAML" {
+		t.Errorf("extractConfig = %+v, %v; want name from sidecar", config, err)
+	}
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// maxSleep caps a single ctx.sleep call; longer waits belong in ctx.set_timer
+const maxSleep = 30 * time.Second
+
+// sleepBuiltin implements ctx.sleep(seconds): pause the handler, e.g. between
+// two commands to the same device. Sleeps past the handler's timeout fail
+// right away instead of being cut short; a run cancelled while asleep fails
+// as soon as it is.
+func (c *Context) sleepBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var seconds starlark.Value
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "seconds", &seconds); err != nil {
+		return nil, err
+	}
+	f, ok := starlark.AsFloat(seconds)
+	if !ok || f < 0 || f > maxSleep.Seconds() {
+		return nil, fmt.Errorf("%s: seconds must be between 0 and %d (use ctx.set_timer for longer waits)", fn.Name(), int(maxSleep.Seconds()))
+	}
+	d := time.Duration(f * float64(time.Second))
+	if deadline, ok := thread.Local(threadLocalDeadline).(time.Time); ok && time.Now().Add(d).After(deadline) {
+		return nil, fmt.Errorf("%s: sleeping %s would exceed the handler timeout", fn.Name(), d)
+	}
+
+	if c.sleep != nil {
+		c.sleep(thread, d)
+	} else {
+		sleepRun(thread, d)
+	}
+	if runContext(thread).Err() != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), errRunCancelled)
+	}
+	return starlark.None, nil
+}
+
+// sleepRun waits for d, or until thread's run is cancelled
+func sleepRun(thread *starlark.Thread, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-runContext(thread).Done():
+	}
+}
+
+// sleep backs ctx.sleep for loaded automations. A stand-in worker serves the
+// handler's pool while it sleeps, so sequences with pauses don't hold up
+// other automations. Background jobs have their own slots and just sleep.
+func (r *Runner) sleep(thread *starlark.Thread, d time.Duration) {
+	if thread.Local(threadLocalJob) == nil {
+		priority, _ := thread.Local(threadLocalPriority).(string)
+		defer r.dispatcher.standIn(priority)()
+	}
+	sleepRun(thread, d)
+}
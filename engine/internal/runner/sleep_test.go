@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSleep_FreesWorker(t *testing.T) {
+	r := newTestRunner()
+	r.dispatcher = newDispatcher(1, 1)
+	sequence := addTestAutomation(t, r, "sequence", `
+config = {"name": "Sequence"}
+
+def on_schedule(ctx):
+    ctx.sleep(0.3)
+    ctx.log("second command")
+`)
+	sequence.context.sleep = r.sleep
+	addTestAutomation(t, r, "motion", `
+config = {"name": "Motion"}
+
+def on_schedule(ctx):
+    ctx.log("motion handled")
+`)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.RunManual("sequence", ManualTrigger{})
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The only normal worker is asleep in sequence; motion still runs
+	start := time.Now()
+	if _, err := r.RunManual("motion", ManualTrigger{}); err != nil {
+		t.Fatalf("RunManual(motion) failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("motion waited %s for the sleeping handler", elapsed)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RunManual(sequence) failed: %v", err)
+	}
+
+	logs := r.GetLogs()
+	if len(logs) != 2 || logs[0].Message != "motion handled" || logs[1].Message != "second command" {
+		t.Errorf("logs = %+v", logs)
+	}
+}
+
+func TestSleep_EndsWithTheAutomation(t *testing.T) {
+	r := newTestRunner()
+	blinds := addTestAutomation(t, r, "blinds", `
+config = {"name": "Blinds"}
+
+def on_schedule(ctx):
+    ctx.sleep(20)
+    ctx.log("still running")
+`)
+	blinds.context.sleep = r.sleep
+	blinds.done, blinds.stop = context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.RunManual("blinds", ManualTrigger{})
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	blinds.stop()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "run cancelled") {
+			t.Errorf("RunManual = %v, want the sleep cancelled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ctx.sleep kept sleeping after the automation was unloaded")
+	}
+}
+
+func TestSleep_Limits(t *testing.T) {
+	r := newTestRunner()
+
+	tests := []struct {
+		name, code, wantErr string
+	}{
+		{"too long", `ctx.sleep(31)`, "seconds must be between 0 and 30"},
+		{"negative", `ctx.sleep(-1)`, "seconds must be between 0 and 30"},
+		{"not a number", `ctx.sleep("2")`, "seconds must be between 0 and 30"},
+		{"past the timeout", `ctx.sleep(2)`, "sleeping 2s would exceed the handler timeout"},
+	}
+	for _, tt := range tests {
+		result, err := r.DryRun(DryRunRequest{Code: `
+config = {"name": "Sequence", "timeout_seconds": 1}
+
+def on_schedule(ctx):
+    ` + tt.code + `
+`})
+		if err != nil {
+			t.Fatalf("%s: DryRun failed: %v", tt.name, err)
+		}
+		if result.Success || !strings.Contains(result.Error, tt.wantErr) {
+			t.Errorf("%s: result = %+v, want error %q", tt.name, result, tt.wantErr)
+		}
+	}
+}
+
+func TestSleep_DryRunAdvancesClock(t *testing.T) {
+	r := newTestRunner()
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	result, err := r.DryRun(DryRunRequest{
+		Trigger: Trigger{Time: start},
+		Code: `
+config = {"name": "Sequence"}
+
+def on_schedule(ctx):
+    before = ctx.now()
+    ctx.publish("zigbee2mqtt/blinds/set", "OPEN")
+    ctx.sleep(2.5)
+    ctx.publish("zigbee2mqtt/blinds/set", "STOP")
+    return ctx.now() - before
+`})
+	if err != nil || !result.Success {
+		t.Fatalf("DryRun = %+v, %v", result, err)
+	}
+	if len(result.Published) != 2 {
+		t.Errorf("published = %+v", result.Published)
+	}
+	if result.Result != float64(2) {
+		t.Errorf("clock advanced %v seconds, want 2 (whole seconds)", result.Result)
+	}
+}
@@ -0,0 +1,129 @@
+package runner
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// maxSolarOffset bounds "@sunset+<offset>" so an event stays near its day
+const maxSolarOffset = 12 * time.Hour
+
+// SetHomeLocation enables solar schedules ("@sunset", "@sunrise+30m") for
+// automations loaded afterwards
+func (r *Runner) SetHomeLocation(latitude, longitude float64) error {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return fmt.Errorf("invalid coordinates %g,%g", latitude, longitude)
+	}
+	r.home = &homeLocation{latitude: latitude, longitude: longitude}
+	return nil
+}
+
+type homeLocation struct {
+	latitude  float64
+	longitude float64
+}
+
+// solarSchedule is a cron.Schedule firing at sunrise or sunset (plus an
+// offset) at the home location
+type solarSchedule struct {
+	event     string // tokSunrise or tokSunset
+	offset    time.Duration
+	latitude  float64
+	longitude float64
+}
+
+// parseSolarSpec reads "@sunset", "@sunrise+30m" or "@sunset-1h30m"
+func parseSolarSpec(spec string) (event string, offset time.Duration, err error) {
+	rest, ok := strings.CutPrefix(spec, "@")
+	switch {
+	case ok && strings.HasPrefix(rest, tokSunrise):
+		event = tokSunrise
+	case ok && strings.HasPrefix(rest, tokSunset):
+		event = tokSunset
+	default:
+		return "", 0, fmt.Errorf("solar schedule %q must start with @sunrise or @sunset", spec)
+	}
+
+	if rest = strings.TrimPrefix(rest, event); rest != "" {
+		if rest[0] != '+' && rest[0] != '-' {
+			return "", 0, fmt.Errorf("solar schedule %q: expected an offset like +30m or -1h", spec)
+		}
+		offset, err = time.ParseDuration(rest)
+		if err != nil {
+			return "", 0, fmt.Errorf("solar schedule %q: %w", spec, err)
+		}
+		if offset > maxSolarOffset || offset < -maxSolarOffset {
+			return "", 0, fmt.Errorf("solar schedule %q: offset must be within %s", spec, maxSolarOffset)
+		}
+	}
+	return event, offset, nil
+}
+
+// newSolarSchedule builds the schedule for a solar spec at the home location
+func (r *Runner) newSolarSchedule(spec string) (cron.Schedule, error) {
+	if r.home == nil {
+		return nil, fmt.Errorf("solar schedule %q needs the home location (HOME_LATITUDE and HOME_LONGITUDE)", spec)
+	}
+	event, offset, err := parseSolarSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &solarSchedule{event: event, offset: offset, latitude: r.home.latitude, longitude: r.home.longitude}, nil
+}
+
+// Next returns the first event after t. Near the poles there can be weeks
+// without sunrise or sunset; after a year without one the schedule gives up
+// (a zero time stops cron from running it).
+func (s *solarSchedule) Next(t time.Time) time.Time {
+	year, month, day := t.Date()
+	for i := -1; i <= 366; i++ {
+		noon := time.Date(year, month, day+i, 12, 0, 0, 0, t.Location())
+		sunrise, sunset, ok := sunTimes(noon, s.latitude, s.longitude)
+		if !ok {
+			continue
+		}
+		next := sunrise
+		if s.event == tokSunset {
+			next = sunset
+		}
+		next = next.Add(s.offset).In(t.Location()).Truncate(time.Second)
+		if next.After(t) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// sunTimes computes sunrise and sunset for the day around noon with the
+// sunrise equation (accurate to about a minute). ok is false during polar
+// day or night.
+func sunTimes(noon time.Time, latitude, longitude float64) (sunrise, sunset time.Time, ok bool) {
+	const j2000 = 2451545.0
+	rad := math.Pi / 180
+
+	julian := float64(noon.Unix())/86400 + 2440587.5
+	n := math.Round(julian - j2000 + longitude/360)
+	meanSolarTime := n - longitude/360
+
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.02*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+	eclipticLongitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := j2000 + meanSolarTime + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*eclipticLongitude*rad)
+
+	declination := math.Asin(math.Sin(eclipticLongitude*rad) * math.Sin(23.4397*rad))
+	cosHourAngle := (math.Sin(-0.833*rad) - math.Sin(latitude*rad)*math.Sin(declination)) /
+		(math.Cos(latitude*rad) * math.Cos(declination))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	hourAngle := math.Acos(cosHourAngle) / rad
+
+	toTime := func(j float64) time.Time {
+		return time.Unix(0, int64((j-2440587.5)*86400*float64(time.Second))).UTC()
+	}
+	return toTime(transit - hourAngle/360), toTime(transit + hourAngle/360), true
+}
@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSolarSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		event   string
+		offset  time.Duration
+		wantErr bool
+	}{
+		{"@sunset", tokSunset, 0, false},
+		{"@sunrise+30m", tokSunrise, 30 * time.Minute, false},
+		{"@sunset-1h30m", tokSunset, -90 * time.Minute, false},
+		{"@sunset+60m", tokSunset, time.Hour, false},
+		{"@sunset30m", "", 0, true},
+		{"@sunset+soon", "", 0, true},
+		{"@sunrise+13h", "", 0, true},
+		{"@noon", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		event, offset, err := parseSolarSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSolarSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if event != tt.event || offset != tt.offset {
+			t.Errorf("parseSolarSpec(%q) = %s %s, want %s %s", tt.spec, event, offset, tt.event, tt.offset)
+		}
+	}
+}
+
+func TestSunTimes(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+
+	tests := []struct {
+		date            time.Time
+		sunrise, sunset string
+	}{
+		{time.Date(2026, 6, 21, 12, 0, 0, 0, berlin), "04:43", "21:33"},
+		{time.Date(2026, 12, 21, 12, 0, 0, 0, berlin), "08:15", "15:54"},
+	}
+
+	for _, tt := range tests {
+		sunrise, sunset, ok := sunTimes(tt.date, 52.52, 13.405)
+		if !ok {
+			t.Fatalf("%s: no sunrise/sunset", tt.date.Format(time.DateOnly))
+		}
+		for _, check := range []struct {
+			got  time.Time
+			want string
+		}{{sunrise, tt.sunrise}, {sunset, tt.sunset}} {
+			want, _ := time.ParseInLocation(time.DateOnly+" 15:04", tt.date.Format(time.DateOnly)+" "+check.want, berlin)
+			if diff := check.got.Sub(want).Abs(); diff > 3*time.Minute {
+				t.Errorf("%s: got %s, want about %s", tt.date.Format(time.DateOnly), check.got.In(berlin).Format("15:04"), check.want)
+			}
+		}
+	}
+}
+
+func TestSolarScheduleNext(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	sunset := &solarSchedule{event: tokSunset, offset: 30 * time.Minute, latitude: 52.52, longitude: 13.405}
+
+	next := sunset.Next(time.Date(2026, 6, 21, 20, 0, 0, 0, berlin))
+	if next.Day() != 21 || next.Hour() != 22 {
+		t.Errorf("Next before sunset = %s, want 21 June around 22:03", next)
+	}
+	next = sunset.Next(time.Date(2026, 6, 21, 23, 0, 0, 0, berlin))
+	if next.Day() != 22 {
+		t.Errorf("Next after sunset = %s, want 22 June", next)
+	}
+
+	// Polar night in Tromsø: the next sunrise is in January
+	sunrise := &solarSchedule{event: tokSunrise, latitude: 69.65, longitude: 18.96}
+	next = sunrise.Next(time.Date(2026, 12, 10, 12, 0, 0, 0, time.UTC))
+	if next.Year() != 2027 || next.Month() != time.January {
+		t.Errorf("Next sunrise during polar night = %s, want January 2027", next)
+	}
+}
+
+func TestNewSolarSchedule_RequiresHomeLocation(t *testing.T) {
+	r := newTestRunner()
+	if _, err := r.newSolarSchedule("@sunset"); err == nil {
+		t.Error("expected an error without a home location")
+	}
+
+	if err := r.SetHomeLocation(95, 0); err == nil {
+		t.Error("expected an error for an invalid latitude")
+	}
+	if err := r.SetHomeLocation(52.52, 13.405); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.newSolarSchedule("@sunrise-15m"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
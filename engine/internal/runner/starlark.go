@@ -1,18 +1,29 @@
 package runner
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/robfig/cron/v3"
 	"go.starlark.net/starlark"
 
+	"github.com/homebrain/engine/internal/connector"
+	"github.com/homebrain/engine/internal/gpio"
 	"github.com/homebrain/engine/internal/mqtt"
+	"github.com/homebrain/engine/internal/notify"
+	"github.com/homebrain/engine/internal/secrets"
 	"github.com/homebrain/engine/internal/state"
 )
 
@@ -22,27 +33,85 @@ type AutomationConfig struct {
 	Description       string   `json:"description"`
 	Subscribe         []string `json:"subscribe"`
 	Schedule          string   `json:"schedule,omitempty"`
+	Schedules         []string `json:"schedules,omitempty"` // When config.schedule is a list
 	Enabled           bool     `json:"enabled"`
 	GlobalStateWrites []string `json:"global_state_writes,omitempty"`
+	GlobalStateReads  []string `json:"global_state_reads,omitempty"` // Enforced in strict mode
+	Publishes         []string `json:"publishes,omitempty"`          // Topic filters; enforced in strict mode
+	Libraries         []string `json:"libraries,omitempty"`          // Library modules; enforced in strict mode
+	WatchGlobal       []string `json:"watch_global,omitempty"`       // Global key patterns triggering on_state_change
+	Profiles          []string `json:"profiles,omitempty"`           // Profiles the automation reacts in; empty for all
+	Secrets           []string `json:"secrets,omitempty"`            // Secret names ctx.secret may read
+	Requires          []string `json:"requires,omitempty"`           // Automation IDs that must be loaded first
+	Priority          string   `json:"priority"`
+	MaxRunsPerDay     int      `json:"max_runs_per_day,omitempty"`
+	TimeoutSeconds    float64  `json:"timeout_seconds,omitempty"` // Handler execution limit; 0 uses the engine default
+	MaxSteps          int64    `json:"max_steps,omitempty"`       // Handler step limit; 0 uses the engine default
+
+	HTTPAllow []string       `json:"http_allow,omitempty"` // Hosts ctx.http_* and streams may call
+	Streams   []StreamConfig `json:"streams,omitempty"`
+	Retry     *RetryPolicy   `json:"retry,omitempty"`   // Retries for failed publish/notify/http calls
+	Webhook   *WebhookConfig `json:"webhook,omitempty"` // POST /hooks/{name} runs on_webhook
+
+	// Subscriptions that only trigger when the payload changes, by topic
+	// pattern. The value is the compared JSON field ("" compares the whole payload).
+	OnChangeOnly map[string]string `json:"on_change_only,omitempty"`
+
+	// Expected payloads by topic pattern; see parsePayloadSchema
+	Schemas map[string]*PayloadSchema `json:"schemas,omitempty"`
+}
+
+// ScheduleSpecs returns config.schedule as a list, whether it was written as
+// one schedule or several
+func (c AutomationConfig) ScheduleSpecs() []string {
+	if c.Schedule != "" {
+		return []string{c.Schedule}
+	}
+	return c.Schedules
 }
 
 // Automation represents a loaded automation
 type Automation struct {
-	ID           string           `json:"id"`
-	FilePath     string           `json:"file_path"`
-	Config       AutomationConfig `json:"config"`
-	globals      starlark.StringDict
-	onMessage    starlark.Callable
-	onSchedule   starlark.Callable
-	cronEntryID  cron.EntryID
-	context      *Context
+	ID              string             `json:"id"`
+	FilePath        string             `json:"file_path"`
+	Config          AutomationConfig   `json:"config"`
+	StaticPublishes []string           `json:"static_publishes,omitempty"` // Literal ctx.publish topics found in the source
+	Schedule        *ResolvedSchedule  `json:"schedule,omitempty"`         // How config.schedule was interpreted
+	Schedules       []ResolvedSchedule `json:"schedules,omitempty"`        // Same, for each entry of a config.schedule list
+	Annotations     []state.Annotation `json:"annotations,omitempty"`      // Notes attached via the API
+	Inactive        bool               `json:"inactive,omitempty"`         // Not among config.profiles for the active profile
+	Services        []string           `json:"services,omitempty"`         // Functions other automations may call via ctx.call
+	DynamicTopics   []string           `json:"dynamic_topics,omitempty"`   // Topics added at runtime with ctx.subscribe
+	Errors          *HandlerErrors     `json:"errors,omitempty"`           // Failed handler runs since the engine started
+	Blueprint       string             `json:"blueprint,omitempty"`        // The blueprint this automation instantiates
+	globals         starlark.StringDict
+	onMessage       starlark.Callable
+	onSchedule      starlark.Callable
+	onTimer         starlark.Callable
+	onStateChange   starlark.Callable
+	onPresence      starlark.Callable
+	onWebhook       starlark.Callable
+	onError         starlark.Callable
+	services        map[string]starlark.Callable
+	cronEntries     []cronEntry
+	dynamic         *dynamicTopics // Topics added with ctx.subscribe
+	context         *Context
+	doc             string              // Module docstring
+	source          string              // Starlark source as loaded (compiled for declarative files)
+	common          starlark.StringDict // Predeclared names from the directory's _common.star
+	changes         *changeTracker
+	stopStreams     context.CancelFunc
+	done            context.Context // Cancelled when this version is unloaded or replaced
+	stop            context.CancelFunc
 }
 
 // LogEntry represents a log message from an automation
 type LogEntry struct {
 	Timestamp    time.Time `json:"timestamp"`
 	AutomationID string    `json:"automation_id"`
+	Level        string    `json:"level"` // LogLevelInfo for ctx.log, warning/error for engine reports
 	Message      string    `json:"message"`
+	Seq          uint64    `json:"-"` // Increasing sequence number, the cursor for paging
 }
 
 // Runner manages and executes Starlark automations
@@ -51,11 +120,56 @@ type Runner struct {
 	stateStore     *state.Store
 	automations    map[string]*Automation
 	libraryManager *LibraryManager
+	gpio           *gpio.Controller
+	sinks          map[string]connector.Connector
+	subscriptions  *subscriptions
+	watchdog       *watchdog // See StartWatchdog
+	throttle       *publishThrottle
+	home           *homeLocation // For solar schedules
+	pauses         schedulePauses
+	timers         timers
+	overrides      overrides
+	expirations    expirations
+	stateStream    stateStream
+	profiles       profiles
+	persons        []string // See SetPresence
+	jobs           jobQueue
+	strict         bool          // See SetStrictMode
+	programs       *programCache // Nil unless SetProgramCache was called
+	loadErrors     loadErrors
+	handlerErrors  handlerErrors
+	notifier       *notify.Notifier
+	secrets        *secrets.Store // See SetSecrets
+	httpClient     *http.Client
+	idempotency    *idempotencyCache
+	dataDir        string
+	automationsDir string        // See SetAutomationsDir
+	handlerTimeout time.Duration // Default execution limit; see SetHandlerTimeout
+	maxSteps       uint64        // Default step limit; see SetMaxSteps
+	dataLimit      int64
+	payloadLimit   atomic.Int64 // See SetPayloadLimit
 	mu             sync.RWMutex
 	cron           *cron.Cron
+	dispatcher     *dispatcher
+	runLocks       runLocks // One run chain per automation at a time
+	warmup         warmup
+	audit          *audit
+	loops          *loopDetector
 	logs           []LogEntry
 	logsMu         sync.RWMutex
 	maxLogs        int
+	storedLogs     int           // Entries kept in the state store; 0 unless PersistLogs was called
+	pendingLogs    []LogEntry    // Not yet written to the state store
+	logSeq         uint64        // Sequence number of the newest entry
+	flushMu        sync.Mutex    // Keeps flushes in order
+	stopFlush      chan struct{} // Closed by StopLogs to end the flush loop
+	runs           []RunRecord
+	retries        map[string][]RetryOutcome // By run ID
+	runsMu         sync.RWMutex
+	maxRuns        int
+	replays        []ReplayBundle
+	replaysMu      sync.RWMutex
+	maxReplays     int
 }
 
 // New creates a new automation runner
@@ -65,10 +179,29 @@ func New(mqttClient *mqtt.Client, stateStore *state.Store) *Runner {
 		stateStore:     stateStore,
 		automations:    make(map[string]*Automation),
 		libraryManager: NewLibraryManager(),
-		cron:           cron.New(),
+		sinks:          make(map[string]connector.Connector),
+		subscriptions:  newSubscriptions(mqttClient),
+		httpClient:     newHTTPClient(),
+		idempotency:    newIdempotencyCache(idempotencyWindow),
+		audit:          newAudit(),
+		loops:          newLoopDetector(),
+		cron:           cron.New(cron.WithParser(cronParser)),
+		dispatcher:     newDispatcher(defaultNormalWorkers, defaultHighWorkers),
 		logs:           make([]LogEntry, 0, 1000),
 		maxLogs:        1000,
+		maxRuns:        defaultMaxRuns,
+		maxReplays:     defaultMaxReplays,
+		handlerTimeout: defaultHandlerTimeout,
+		maxSteps:       defaultMaxSteps,
 	}
+	r.audit.conflicts.onConflict = func(c Conflict) {
+		msg := fmt.Sprintf("WARNING: competing writes to %s by %s and %s within %s", c.Target, c.Automations[0], c.Automations[1], c.Interval)
+		r.addLog(c.Automations[0], LogLevelWarning, msg)
+		r.addLog(c.Automations[1], LogLevelWarning, msg)
+	}
+	r.loadPausedSchedules()
+	r.restoreOverrides()
+	r.restoreExpirations()
 	r.cron.Start()
 	return r
 }
@@ -78,48 +211,95 @@ func (r *Runner) LoadLibraries(automationsPath string) error {
 	return r.libraryManager.LoadLibraries(automationsPath)
 }
 
+// SetAutomationsDir sets the directory automation IDs are relative to, so
+// automations/lighting/hallway.star is "lighting/hallway". Call before loading
+// automations; without it an automation's ID is its file name.
+func (r *Runner) SetAutomationsDir(dir string) {
+	r.automationsDir = dir
+}
+
+// SetNotifier enables ctx.notify delivery for automations loaded afterwards
+func (r *Runner) SetNotifier(notifier *notify.Notifier) {
+	r.notifier = notifier
+}
+
+// SetGPIO enables ctx.gpio for automations loaded afterwards
+func (r *Runner) SetGPIO(controller *gpio.Controller) {
+	r.gpio = controller
+}
+
+// ConfigureWorkers resizes the normal and high-priority worker pools.
+// Call before loading automations.
+func (r *Runner) ConfigureWorkers(normalWorkers, highWorkers int) {
+	old := r.dispatcher
+	r.dispatcher = newDispatcher(normalWorkers, highWorkers)
+	old.stop()
+}
+
+// AddSink registers an external connector usable via ctx.publish(..., sink=name)
+func (r *Runner) AddSink(c connector.Connector) {
+	r.sinks[c.Name()] = c
+}
+
 // GetLibraryManager returns the library manager
 func (r *Runner) GetLibraryManager() *LibraryManager {
 	return r.libraryManager
 }
 
-// LoadAutomation loads a Starlark automation from a file
+// LoadAutomation loads a Starlark automation from a file, replacing the
+// loaded version only once the new one is fully built. If loading fails, the
+// previous version keeps running. A failure is kept for GetLoadErrors until
+// the file loads or is removed.
 func (r *Runner) LoadAutomation(filePath string) error {
-	id := automationIDFromPath(filePath)
-
-	// Unload existing automation if present
-	r.UnloadAutomation(id)
-
-	slog.Info("Loading automation", "id", id, "path", filePath)
-
-	// Read file
-	data, err := os.ReadFile(filePath)
+	id := AutomationID(r.automationsDir, filePath)
+	err := r.loadAutomation(id, filePath)
+	previous := false
 	if err != nil {
-		return fmt.Errorf("failed to read automation file: %w", err)
+		r.mu.RLock()
+		_, previous = r.automations[id]
+		r.mu.RUnlock()
 	}
-
-	// Parse and execute Starlark
-	thread := &starlark.Thread{Name: id}
-	globals, err := starlark.ExecFile(thread, filePath, data, nil)
-	if err != nil {
-		return fmt.Errorf("failed to execute automation: %w", err)
+	var missing *missingDependencyError
+	unloaded := previous && errors.As(err, &missing)
+	if unloaded {
+		// An automation doesn't keep running without the ones it requires
+		r.unloadAutomation(id)
+		previous = false
+		r.addLog(id, LogLevelError, fmt.Sprintf("ERROR: unloaded: %s", err))
+	} else if previous {
+		r.addLog(id, LogLevelError, fmt.Sprintf("ERROR: reload failed, keeping the previous version: %s", err))
 	}
-
-	// Extract config
-	configVal, ok := globals["config"]
-	if !ok {
-		return fmt.Errorf("automation missing 'config' variable")
+	r.loadErrors.set(id, filePath, err, previous)
+	if err == nil || unloaded {
+		r.reloadDependents(id)
 	}
+	return err
+}
 
-	config, err := extractConfig(configVal)
+func (r *Runner) loadAutomation(id, filePath string) error {
+	slog.Info("Loading automation", "id", id, "path", filePath)
+
+	file, err := r.readAutomation(id, filePath)
 	if err != nil {
-		return fmt.Errorf("invalid config: %w", err)
+		return err
 	}
+	source, globals, config := file.source, file.globals, file.config
+	data, common := source.code, source.predeclared
 
 	if !config.Enabled {
 		slog.Info("Automation disabled, skipping", "id", id)
+		r.unloadAutomation(id)
 		return nil
 	}
+	if err := r.checkRequires(id, config.Requires); err != nil {
+		return err
+	}
+	available := r.Profiles()
+	for _, profile := range config.Profiles {
+		if !slices.Contains(available, profile) {
+			r.addLog(id, LogLevelWarning, fmt.Sprintf("WARNING: profile %q is not configured (available: %s)", profile, strings.Join(available, ", ")))
+		}
+	}
 
 	// Extract handlers
 	var onMessage, onSchedule starlark.Callable
@@ -134,45 +314,208 @@ func (r *Runner) LoadAutomation(filePath string) error {
 		}
 	}
 
-	if onMessage == nil && onSchedule == nil {
-		return fmt.Errorf("automation must define on_message or on_schedule function")
+	var onTimer starlark.Callable
+	if fn, ok := globals["on_timer"]; ok {
+		if callable, ok := fn.(starlark.Callable); ok {
+			onTimer = callable
+		}
+	}
+
+	var onStateChange starlark.Callable
+	if fn, ok := globals["on_state_change"]; ok {
+		if callable, ok := fn.(starlark.Callable); ok {
+			onStateChange = callable
+		}
+	}
+
+	var onPresence starlark.Callable
+	if fn, ok := globals["on_presence_change"]; ok {
+		if callable, ok := fn.(starlark.Callable); ok {
+			onPresence = callable
+		}
 	}
 
+	var onWebhook starlark.Callable
+	if fn, ok := globals["on_webhook"]; ok {
+		if callable, ok := fn.(starlark.Callable); ok {
+			onWebhook = callable
+		}
+	}
+
+	var onError starlark.Callable
+	if fn, ok := globals["on_error"]; ok {
+		if callable, ok := fn.(starlark.Callable); ok {
+			onError = callable
+		}
+	}
+
+	services, err := extractServices(globals)
+	if err != nil {
+		return err
+	}
+	if onMessage == nil && onSchedule == nil && onStateChange == nil && onPresence == nil && onWebhook == nil && len(services) == 0 {
+		return fmt.Errorf("automation must define on_message, on_schedule, on_state_change, on_presence_change or on_webhook function, or services")
+	}
+	if config.Webhook != nil {
+		if onWebhook == nil {
+			return fmt.Errorf("webhook %s requires an on_webhook function", config.Webhook.Name)
+		}
+		if owner := r.webhookOwner(config.Webhook.Name, id); owner != nil {
+			return fmt.Errorf("webhook %s is already handled by %s", config.Webhook.Name, owner.ID)
+		}
+	}
+
+	// Friendly schedules ("every weekday at 7:15") resolve to cron; solar
+	// events use their own cron.Schedule
+	specs := config.ScheduleSpecs()
+	entries := make([]cronEntry, len(specs))
+	for i, spec := range specs {
+		entries[i].spec = spec
+		if entries[i].resolved, err = resolveRunnableSchedule(spec); err != nil {
+			return fmt.Errorf("invalid schedule: %w", err)
+		}
+		if entries[i].schedule, err = r.cronSchedule(entries[i].resolved); err != nil {
+			return fmt.Errorf("invalid schedule: %w", err)
+		}
+	}
+	var schedule *ResolvedSchedule
+	var schedules []ResolvedSchedule
+	if config.Schedule != "" {
+		schedule = &entries[0].resolved
+	} else {
+		for _, entry := range entries {
+			schedules = append(schedules, entry.resolved)
+		}
+	}
+
+	// Background work started by this version (retries) ends with it
+	done, stop := context.WithCancel(context.Background())
+
 	// Create automation context
 	ctx := NewContext(id, r.mqttClient, r.stateStore, r.addLog, config.GlobalStateWrites, r.libraryManager)
+	ctx.gpio = r.gpio
+	ctx.sinks = r.sinks
+	ctx.isWarmingUp = r.IsWarmingUp
+	ctx.audit = r.audit
+	ctx.loops = r.loops
+	ctx.call = r.callAutomation
+	ctx.callService = r.callService
+	ctx.setTimer = func(timerID string, delay time.Duration, data json.RawMessage, priority string) error {
+		return r.setTimer(id, timerID, delay, data, priority)
+	}
+	ctx.writeGlobal = func(thread *starlark.Thread, key string, value any, clear bool) error {
+		return r.writeGlobal(thread, id, key, value, clear)
+	}
+	ctx.cancelTimer = func(timerID string) (bool, error) {
+		return r.cancelTimer(id, timerID)
+	}
+	ctx.timerPending = func(timerID string) bool {
+		return r.timerPending(id, timerID)
+	}
+	// Runtime subscriptions stay with this version, even when a handler still
+	// running after a reload calls ctx.subscribe
+	var self *Automation
+	ctx.subscribe = func(topic string) (bool, error) {
+		return r.subscribeTopic(self, topic)
+	}
+	ctx.unsubscribe = func(topic string) bool {
+		return r.unsubscribeTopic(self, topic)
+	}
+	ctx.expire = func(key string, global bool, ttl time.Duration, silent bool) error {
+		return r.setExpiry(id, key, global, ttl, silent)
+	}
+	ctx.setOverride = r.setOverride
+	ctx.cancelOverride = r.cancelOverride
+	ctx.sleep = r.sleep
+	ctx.await = r.await
+	if r.mqttClient != nil {
+		ctx.watch = func(filter string, fn func(topic string, payload []byte)) func() {
+			return r.mqttClient.Watch(filter, fn)
+		}
+	}
+	ctx.startJob = func(name, fnName string, data any) (string, error) {
+		return r.StartJob(id, name, fnName, data)
+	}
+	ctx.cancelJob = func(name string) bool {
+		return r.cancelJobs(id, name)
+	}
+	if policy := config.Retry; policy != nil && policy.Attempts > 1 {
+		ctx.retry = func(runID, action string, attempt func() error, gaveUp func()) {
+			r.retrySideEffect(done, id, runID, *policy, action, attempt, gaveUp)
+		}
+	}
+	if r.throttle != nil {
+		ctx.mqttClient = r.throttle
+	}
+	if r.notifier != nil {
+		ctx.notify = r.notifier.Send
+	}
+	ctx.httpClient = r.httpClient
+	ctx.httpAllow = config.HTTPAllow
+	ctx.profiles = available
+	ctx.persons = r.persons
+	ctx.allowedSecrets = config.Secrets
+	if r.secrets != nil {
+		ctx.secret = r.secrets.Get
+	}
+	ctx.strict = r.strictFor(config)
+	ctx.idempotency = r.idempotency
+	if r.dataDir != "" {
+		ctx.files = &fileStore{dir: filepath.Join(r.dataDir, id), limit: r.dataLimit}
+	}
 
 	automation := &Automation{
-		ID:         id,
-		FilePath:   filePath,
-		Config:     config,
-		globals:    globals,
-		onMessage:  onMessage,
-		onSchedule: onSchedule,
-		context:    ctx,
+		ID:              id,
+		FilePath:        filePath,
+		Config:          config,
+		globals:         globals,
+		onMessage:       onMessage,
+		onSchedule:      onSchedule,
+		onTimer:         onTimer,
+		onStateChange:   onStateChange,
+		onPresence:      onPresence,
+		onWebhook:       onWebhook,
+		onError:         onError,
+		services:        services,
+		Services:        serviceNames(services),
+		context:         ctx,
+		StaticPublishes: staticPublishes(source.path, data),
+		Schedule:        schedule,
+		Schedules:       schedules,
+		Blueprint:       source.blueprint,
+		doc:             moduleDocstring(source.path, data),
+		source:          string(data),
+		common:          common,
+		changes:         newChangeTracker(config.OnChangeOnly),
+		dynamic:         &dynamicTopics{},
+		done:            done,
+		stop:            stop,
 	}
+	self = automation
+
+	// The new version is complete; only now replace the running one
+	r.unloadAutomation(id)
 
 	// Subscribe to MQTT topics
 	if onMessage != nil && len(config.Subscribe) > 0 {
 		for _, topic := range config.Subscribe {
-			topicCopy := topic
-			err := r.mqttClient.Subscribe(topic, func(t string, payload []byte) {
-				r.handleMessage(automation, t, payload)
-			})
-			if err != nil {
-				slog.Error("Failed to subscribe to topic", "topic", topicCopy, "error", err)
+			if err := r.subscriptions.add(automation, topic, r.deliverMessage); err != nil {
+				slog.Error("Failed to subscribe to topic", "topic", topic, "error", err)
 			}
 		}
 	}
 
-	// Setup cron schedule
-	if onSchedule != nil && config.Schedule != "" {
-		entryID, err := r.cron.AddFunc(config.Schedule, func() {
-			r.handleSchedule(automation)
-		})
-		if err != nil {
-			slog.Error("Failed to add cron schedule", "schedule", config.Schedule, "error", err)
-		} else {
-			automation.cronEntryID = entryID
+	// Connect SSE/long-poll streams
+	if onMessage != nil && len(config.Streams) > 0 {
+		automation.stopStreams = r.startStreams(automation)
+	}
+
+	// Setup cron schedules, one entry per config.schedule item
+	if onSchedule != nil {
+		for _, entry := range entries {
+			spec := entry.spec
+			entry.id = r.cron.Schedule(entry.schedule, cron.FuncJob(func() { r.enqueueSchedule(automation, spec) }))
+			automation.cronEntries = append(automation.cronEntries, entry)
 		}
 	}
 
@@ -180,22 +523,98 @@ func (r *Runner) LoadAutomation(filePath string) error {
 	r.automations[id] = automation
 	r.mu.Unlock()
 
-	slog.Info("Automation loaded", "id", id, "name", config.Name, "topics", config.Subscribe)
+	r.restoreTimers(id)
+
+	r.warnStaticLoop(automation)
+
+	slog.Info("Automation loaded", "id", id, "name", config.Name, "topics", config.Subscribe, "priority", config.Priority)
 	return nil
 }
 
-// UnloadAutomation unloads an automation
+// automationFile is an automation file run far enough to read its config
+type automationFile struct {
+	source  automationSource
+	globals starlark.StringDict
+	config  AutomationConfig
+}
+
+// readAutomation runs the automation in filePath and reads its config, the
+// part of loading it that doesn't touch the runner
+func (r *Runner) readAutomation(id, filePath string) (*automationFile, error) {
+	// Read file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read automation file: %w", err)
+	}
+
+	// Declarative YAML automations compile to Starlark source, and blueprint
+	// instances run their blueprint
+	source, err := r.loadSource(filePath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse and execute Starlark with the directory's common module predeclared
+	thread := &starlark.Thread{Name: id}
+	globals, err := r.programs.exec(thread, source.path, source.code, source.predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute automation: %w", err)
+	}
+
+	// Extract config, overlaying an optional YAML sidecar (hallway.star + hallway.yaml)
+	var sidecar *starlark.Dict
+	if path := sidecarPath(filePath); path != "" && !IsDeclarativeFile(filePath) {
+		sidecar, err = loadSidecar(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	configVal, err := mergeConfig(globals["config"], sidecar)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if configVal == nil {
+		return nil, fmt.Errorf("automation missing 'config' variable")
+	}
+
+	config, err := extractConfig(configVal)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &automationFile{source: source, globals: globals, config: config}, nil
+}
+
+// UnloadAutomation unloads an automation, and with it the automations
+// requiring it
 func (r *Runner) UnloadAutomation(id string) {
+	r.unloadAutomation(id)
+	r.reloadDependents(id)
+}
+
+func (r *Runner) unloadAutomation(id string) {
+	r.loadErrors.set(id, "", nil, false)
 	r.mu.Lock()
 	automation, exists := r.automations[id]
 	if exists {
-		// Unsubscribe from topics
-		for _, topic := range automation.Config.Subscribe {
-			r.mqttClient.Unsubscribe(topic)
+		// Unsubscribe from topics (kept on the broker while other automations use them)
+		if automation.onMessage != nil {
+			for _, topic := range automation.Config.Subscribe {
+				r.subscriptions.remove(automation, topic)
+			}
+		}
+		r.removeDynamicTopics(automation)
+		if automation.stopStreams != nil {
+			automation.stopStreams()
 		}
-		// Remove cron job
-		if automation.cronEntryID != 0 {
-			r.cron.Remove(automation.cronEntryID)
+		if automation.stop != nil {
+			automation.stop()
+		}
+		r.stopTimers(id)
+		r.cancelJobs(id, "")
+		// Remove cron jobs
+		for _, entry := range automation.cronEntries {
+			r.cron.Remove(entry.id)
 		}
 		delete(r.automations, id)
 		slog.Info("Automation unloaded", "id", id)
@@ -203,19 +622,37 @@ func (r *Runner) UnloadAutomation(id string) {
 	r.mu.Unlock()
 }
 
-// ListAutomations returns all loaded automations
+// ListAutomations returns all loaded automations with their annotations
 func (r *Runner) ListAutomations() []Automation {
 	r.mu.RLock()
-	defer r.mu.RUnlock()
-
 	result := make([]Automation, 0, len(r.automations))
 	for _, a := range r.automations {
 		result = append(result, Automation{
-			ID:       a.ID,
-			FilePath: a.FilePath,
-			Config:   a.Config,
+			ID:              a.ID,
+			FilePath:        a.FilePath,
+			Config:          a.Config,
+			StaticPublishes: a.StaticPublishes,
+			Schedule:        a.Schedule,
+			Schedules:       a.Schedules,
+			Services:        a.Services,
+			DynamicTopics:   a.dynamic.list(),
+			Errors:          r.handlerErrors.get(a.ID),
+			Blueprint:       a.Blueprint,
 		})
 	}
+	r.mu.RUnlock()
+
+	profile := r.ActiveProfile()
+	for i := range result {
+		if profiles := result[i].Config.Profiles; len(profiles) > 0 {
+			result[i].Inactive = !slices.Contains(profiles, profile)
+		}
+		notes, err := r.GetAnnotations(result[i].ID)
+		if err != nil {
+			slog.Error("Failed to load annotations", "id", result[i].ID, "error", err)
+		}
+		result[i].Annotations = notes
+	}
 	return result
 }
 
@@ -229,63 +666,193 @@ func (r *Runner) GetLogs() []LogEntry {
 	return result
 }
 
-func (r *Runner) addLog(automationID, message string) {
+// addLog records a message in an automation's log at level, one of the
+// LogLevel constants
+func (r *Runner) addLog(automationID, level, message string) {
 	r.logsMu.Lock()
 	defer r.logsMu.Unlock()
 
+	r.logSeq++
 	entry := LogEntry{
 		Timestamp:    time.Now(),
 		AutomationID: automationID,
-		Message:      message,
+		Level:        level,
+		Message:      truncateText(message, r.maxPayload()),
+		Seq:          r.logSeq,
 	}
 
 	r.logs = append(r.logs, entry)
 	if len(r.logs) > r.maxLogs {
 		r.logs = r.logs[len(r.logs)-r.maxLogs:]
 	}
+	if r.storedLogs > 0 {
+		r.pendingLogs = append(r.pendingLogs, entry)
+		if len(r.pendingLogs) > r.storedLogs {
+			r.pendingLogs = r.pendingLogs[len(r.pendingLogs)-r.storedLogs:]
+		}
+	}
 
 	slog.Info("Automation log", "automation", automationID, "message", message)
 }
 
-func (r *Runner) handleMessage(automation *Automation, topic string, payload []byte) {
-	if automation.onMessage == nil {
+// deliverMessage hands a message from a subscription to an automation,
+// dropping repeats on on_change_only subscriptions
+func (r *Runner) deliverMessage(automation *Automation, pattern, topic string, payload []byte, decoded *payloadJSON) {
+	if !automation.changes.changed(pattern, topic, payload, decoded) {
 		return
 	}
+	r.enqueueMessage(automation, Trigger{Type: TriggerMQTT, Topic: topic, json: decoded}, payload)
+}
 
-	thread := &starlark.Thread{Name: automation.ID}
-	ctx := automation.context.ToStarlark()
+// enqueueMessage queues an on_message invocation for a message trigger,
+// deferring it during warm-up
+func (r *Runner) enqueueMessage(automation *Automation, trigger Trigger, payload []byte) {
+	topic := trigger.Topic
+	depth, ok := r.checkLoop(automation, topic)
+	if !ok {
+		return
+	}
+
+	trigger.Time, trigger.depth = time.Now(), depth
+	job := func() {
+		r.dispatcher.submitSerial(automation.ID, automation.Config.Priority, func() {
+			r.handleMessage(automation, trigger, payload)
+		})
+	}
+	if r.warmup.hold(automation.ID+"|"+topic, true, job) {
+		return
+	}
+	job()
+}
 
-	_, err := starlark.Call(thread, automation.onMessage, starlark.Tuple{
-		starlark.String(topic),
-		starlark.String(payload),
-		ctx,
-	}, nil)
+// enqueueSchedule queues an on_schedule invocation, deferring it during warm-up
+func (r *Runner) enqueueSchedule(automation *Automation, spec string) {
+	if _, paused := r.pauses.get(automation.ID); paused {
+		slog.Debug("Skipping paused schedule", "id", automation.ID)
+		return
+	}
+	trigger := Trigger{Type: TriggerSchedule, Schedule: spec, Time: time.Now()}
+	job := func() {
+		r.dispatcher.submitSerial(automation.ID, automation.Config.Priority, func() {
+			r.handleSchedule(automation, trigger)
+		})
+	}
+	if r.warmup.hold(automation.ID+"|@schedule", false, job) {
+		return
+	}
+	job()
+}
 
+func (r *Runner) handleMessage(automation *Automation, trigger Trigger, payload []byte) (RunRecord, error) {
+	if automation.onMessage == nil {
+		return RunRecord{}, errNoHandler
+	}
+	trigger.payload = string(payload)
+	if trigger.json == nil {
+		trigger.json = newPayloadJSON(payload)
+	}
+	arg, err := messagePayload(automation.Config, trigger.Topic, payload, trigger.json)
 	if err != nil {
-		slog.Error("Automation on_message error", "automation", automation.ID, "error", err)
-		r.addLog(automation.ID, fmt.Sprintf("ERROR: %s", err))
+		slog.Warn("Message rejected", "automation", automation.ID, "topic", trigger.Topic, "error", err)
+		r.addLog(automation.ID, LogLevelWarning, fmt.Sprintf("WARNING: %s: %s", trigger.Topic, err))
+		return RunRecord{}, err
 	}
+	return r.execute(automation, trigger, "on_message", automation.onMessage, starlark.String(trigger.Topic), arg)
 }
 
-func (r *Runner) handleSchedule(automation *Automation) {
+func (r *Runner) handleSchedule(automation *Automation, trigger Trigger) (RunRecord, error) {
 	if automation.onSchedule == nil {
-		return
+		return RunRecord{}, errNoHandler
+	}
+	return r.execute(automation, trigger, "on_schedule", automation.onSchedule)
+}
+
+// execute runs one handler invocation with ctx appended as the last argument
+// and records the run, including the handler's return value
+func (r *Runner) execute(automation *Automation, trigger Trigger, handler string, fn starlark.Callable, args ...starlark.Value) (RunRecord, error) {
+	if !r.activeInProfile(automation, trigger) {
+		return RunRecord{}, errInactiveProfile
+	}
+	if !r.withinBudget(automation) {
+		return RunRecord{}, errBudgetExhausted
 	}
 
 	thread := &starlark.Thread{Name: automation.ID}
-	ctx := automation.context.ToStarlark()
+	thread.SetLocal(threadLocalDepth, trigger.depth)
+	thread.SetLocal(threadLocalCallDepth, trigger.callDepth)
+	thread.SetLocal(threadLocalPriority, higherPriority(trigger.priority, automation.Config.Priority))
+	capture := newStateCapture()
+	thread.SetLocal(threadLocalCapture, capture)
+	artifacts := &runArtifacts{}
+	thread.SetLocal(threadLocalArtifacts, artifacts)
+	expectations := &runExpectations{}
+	thread.SetLocal(threadLocalExpectations, expectations)
+	ctx := automation.context.ToStarlark(trigger)
 
-	_, err := starlark.Call(thread, automation.onSchedule, starlark.Tuple{ctx}, nil)
+	record := RunRecord{AutomationID: automation.ID, Handler: handler, Trigger: trigger, Start: time.Now()}
+	record.ID = fmt.Sprintf("%s-%d", automation.ID, record.Start.UnixNano())
+	thread.SetLocal(threadLocalRunID, record.ID)
+	if automation.done != nil {
+		thread.SetLocal(threadLocalContext, automation.done)
+	}
+	timeout := r.timeoutFor(automation.Config)
+	timedOut := cancelAfter(thread, timeout)
+	steps := r.stepsFor(automation.Config)
+	outOfSteps := limitSteps(thread, steps)
+	chain := trigger.chain
+	if chain == nil {
+		chain = &runChain{root: automation.ID}
+	}
+	thread.SetLocal(threadLocalRunChain, chain)
+	var result starlark.Value
+	release, err := r.runLocks.acquire(runContext(thread), chain, automation.ID)
+	if err == nil {
+		result, err = starlark.Call(thread, fn, append(starlark.Tuple(args), ctx), nil)
+		release()
+	}
+	if timedOut() && err != nil {
+		err = fmt.Errorf("%s %w after %s", handler, errHandlerTimeout, timeout)
+	} else if outOfSteps() && err != nil {
+		err = fmt.Errorf("%s %w of %d", handler, errStepLimit, steps)
+	}
+	err = redactError(thread, err)
+	record.DurationMs = float64(time.Since(record.Start).Microseconds()) / 1000
+	record.Artifacts = artifacts.list
+	record.Expectations = expectations.list
+	if err != nil {
+		slog.Error("Automation "+handler+" error", "automation", automation.ID, "error", err)
+		r.addLog(automation.ID, LogLevelError, fmt.Sprintf("ERROR: %s", err))
+		record.Error = err.Error()
+		r.captureReplay(automation, trigger, handler, capture, err)
+	} else if result != starlark.None {
+		record.Result = starlarkToGo(result)
+	}
 
+	r.addRun(r.limitRecord(record))
 	if err != nil {
-		slog.Error("Automation on_schedule error", "automation", automation.ID, "error", err)
-		r.addLog(automation.ID, fmt.Sprintf("ERROR: %s", err))
+		r.handlerFailed(automation, trigger, record, err)
+	}
+	return record, err
+}
+
+// AutomationID returns the ID of the automation in filePath: its path relative
+// to dir without the extension, with subdirectories as "/"-separated
+// namespaces. Files outside dir (or with dir empty) are named by their base
+// name alone.
+func AutomationID(dir, filePath string) string {
+	rel := filepath.Base(filePath)
+	if dir != "" {
+		if r, err := filepath.Rel(dir, filePath); err == nil && r != ".." && !strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			rel = r
+		}
 	}
+	return fileStem(filepath.ToSlash(rel))
 }
 
-func automationIDFromPath(filePath string) string {
-	base := filepath.Base(filePath)
-	return strings.TrimSuffix(base, filepath.Ext(base))
+// fileStem strips an automation file's extension, including DeclarativeExtension
+func fileStem(name string) string {
+	name = strings.TrimSuffix(name, DeclarativeExtension)
+	return strings.TrimSuffix(name, path.Ext(name))
 }
 
 func extractConfig(val starlark.Value) (AutomationConfig, error) {
@@ -294,7 +861,7 @@ func extractConfig(val starlark.Value) (AutomationConfig, error) {
 		return AutomationConfig{}, fmt.Errorf("config must be a dict")
 	}
 
-	config := AutomationConfig{Enabled: true}
+	config := AutomationConfig{Enabled: true, Priority: PriorityNormal}
 
 	if v, found, _ := dict.Get(starlark.String("name")); found {
 		if s, ok := v.(starlark.String); ok {
@@ -311,16 +878,30 @@ func extractConfig(val starlark.Value) (AutomationConfig, error) {
 	if v, found, _ := dict.Get(starlark.String("subscribe")); found {
 		if list, ok := v.(*starlark.List); ok {
 			for i := 0; i < list.Len(); i++ {
-				if s, ok := list.Index(i).(starlark.String); ok {
-					config.Subscribe = append(config.Subscribe, string(s))
+				switch entry := list.Index(i).(type) {
+				case starlark.String:
+					config.Subscribe = append(config.Subscribe, string(entry))
+				case *starlark.Dict:
+					if err := addSubscription(&config, entry); err != nil {
+						return AutomationConfig{}, fmt.Errorf("subscribe[%d]: %w", i, err)
+					}
 				}
 			}
 		}
 	}
 
 	if v, found, _ := dict.Get(starlark.String("schedule")); found {
-		if s, ok := v.(starlark.String); ok {
-			config.Schedule = string(s)
+		switch v := v.(type) {
+		case starlark.String:
+			config.Schedule = string(v)
+		case *starlark.List:
+			for i := 0; i < v.Len(); i++ {
+				s, ok := v.Index(i).(starlark.String)
+				if !ok || s == "" {
+					return AutomationConfig{}, fmt.Errorf("schedule[%d] must be a non-empty string", i)
+				}
+				config.Schedules = append(config.Schedules, string(s))
+			}
 		}
 	}
 
@@ -340,5 +921,164 @@ func extractConfig(val starlark.Value) (AutomationConfig, error) {
 		}
 	}
 
+	for _, declared := range []struct {
+		key  string
+		dest *[]string
+	}{
+		{"global_state_reads", &config.GlobalStateReads},
+		{"publishes", &config.Publishes},
+		{"libraries", &config.Libraries},
+		{"watch_global", &config.WatchGlobal},
+		{"profiles", &config.Profiles},
+		{"secrets", &config.Secrets},
+		{"requires", &config.Requires},
+	} {
+		if v, found, _ := dict.Get(starlark.String(declared.key)); found {
+			list, err := stringList(v)
+			if err != nil {
+				return AutomationConfig{}, fmt.Errorf("%s %w", declared.key, err)
+			}
+			*declared.dest = list
+		}
+	}
+
+	if v, found, _ := dict.Get(starlark.String("http_allow")); found {
+		list, ok := v.(*starlark.List)
+		if !ok {
+			return AutomationConfig{}, fmt.Errorf("http_allow must be a list of hosts")
+		}
+		for i := 0; i < list.Len(); i++ {
+			s, ok := list.Index(i).(starlark.String)
+			if !ok || s == "" {
+				return AutomationConfig{}, fmt.Errorf("http_allow must be a list of hosts")
+			}
+			config.HTTPAllow = append(config.HTTPAllow, string(s))
+		}
+	}
+
+	if v, found, _ := dict.Get(starlark.String("streams")); found {
+		streams, err := parseStreams(v)
+		if err != nil {
+			return AutomationConfig{}, err
+		}
+		config.Streams = streams
+		if err := checkStreamHosts(config); err != nil {
+			return AutomationConfig{}, err
+		}
+	}
+
+	if v, found, _ := dict.Get(starlark.String("webhook")); found {
+		hook, err := parseWebhook(v)
+		if err != nil {
+			return AutomationConfig{}, err
+		}
+		config.Webhook = hook
+	}
+
+	if v, found, _ := dict.Get(starlark.String("retry")); found {
+		policy, err := parseRetryPolicy(v)
+		if err != nil {
+			return AutomationConfig{}, err
+		}
+		config.Retry = policy
+	}
+
+	if v, found, _ := dict.Get(starlark.String("priority")); found {
+		s, ok := v.(starlark.String)
+		if !ok || (string(s) != PriorityNormal && string(s) != PriorityHigh) {
+			return AutomationConfig{}, fmt.Errorf("priority must be %q or %q", PriorityNormal, PriorityHigh)
+		}
+		config.Priority = string(s)
+	}
+
+	if v, found, _ := dict.Get(starlark.String("max_runs_per_day")); found {
+		n, err := starlark.AsInt32(v)
+		if err != nil || n < 0 {
+			return AutomationConfig{}, fmt.Errorf("max_runs_per_day must be a non-negative int")
+		}
+		config.MaxRunsPerDay = n
+	}
+
+	if v, found, _ := dict.Get(starlark.String("timeout_seconds")); found {
+		seconds, err := parseTimeout(v)
+		if err != nil {
+			return AutomationConfig{}, err
+		}
+		config.TimeoutSeconds = seconds
+	}
+
+	if v, found, _ := dict.Get(starlark.String("max_steps")); found {
+		steps, err := parseMaxSteps(v)
+		if err != nil {
+			return AutomationConfig{}, err
+		}
+		config.MaxSteps = steps
+	}
+
 	return config, nil
 }
+
+// stringList reads a list of non-empty strings
+func stringList(v starlark.Value) ([]string, error) {
+	list, ok := v.(*starlark.List)
+	if !ok {
+		return nil, fmt.Errorf("must be a list of strings")
+	}
+	result := make([]string, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		s, ok := list.Index(i).(starlark.String)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("must be a list of non-empty strings")
+		}
+		result = append(result, string(s))
+	}
+	return result, nil
+}
+
+// addSubscription parses a subscription written as a dict:
+// {"topic": ..., "on_change_only": True, "change_field": "state", "schema": {...}}
+func addSubscription(config *AutomationConfig, entry *starlark.Dict) error {
+	v, _, _ := entry.Get(starlark.String("topic"))
+	topic, ok := v.(starlark.String)
+	if !ok || topic == "" {
+		return fmt.Errorf("topic must be a non-empty string")
+	}
+	config.Subscribe = append(config.Subscribe, string(topic))
+
+	onChange := false
+	if v, found, _ := entry.Get(starlark.String("on_change_only")); found {
+		b, ok := v.(starlark.Bool)
+		if !ok {
+			return fmt.Errorf("on_change_only must be a bool")
+		}
+		onChange = bool(b)
+	}
+	field := ""
+	if v, found, _ := entry.Get(starlark.String("change_field")); found {
+		s, ok := v.(starlark.String)
+		if !ok {
+			return fmt.Errorf("change_field must be a string")
+		}
+		field = string(s)
+		onChange = true
+	}
+
+	if v, found, _ := entry.Get(starlark.String("schema")); found {
+		schema, err := parsePayloadSchema(v)
+		if err != nil {
+			return fmt.Errorf("schema: %w", err)
+		}
+		if config.Schemas == nil {
+			config.Schemas = make(map[string]*PayloadSchema)
+		}
+		config.Schemas[string(topic)] = schema
+	}
+
+	if onChange {
+		if config.OnChangeOnly == nil {
+			config.OnChangeOnly = make(map[string]string)
+		}
+		config.OnChangeOnly[string(topic)] = field
+	}
+	return nil
+}
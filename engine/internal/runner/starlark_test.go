@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+// execConfig runs a Starlark snippet and extracts its config dict
+func execConfig(t *testing.T, code string) (AutomationConfig, error) {
+	t.Helper()
+	thread := &starlark.Thread{Name: "test"}
+	globals, err := starlark.ExecFile(thread, "test.star", code, nil)
+	if err != nil {
+		t.Fatalf("failed to execute test code: %v", err)
+	}
+	return extractConfig(globals["config"])
+}
+
+func TestExtractConfig_Defaults(t *testing.T) {
+	config, err := execConfig(t, `config = {"name": "Test", "subscribe": ["a/b"]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !config.Enabled {
+		t.Error("expected enabled by default")
+	}
+	if config.Priority != PriorityNormal {
+		t.Errorf("Priority = %q, want %q", config.Priority, PriorityNormal)
+	}
+	if len(config.Subscribe) != 1 || config.Subscribe[0] != "a/b" {
+		t.Errorf("Subscribe = %v, want [a/b]", config.Subscribe)
+	}
+}
+
+func TestExtractConfig_Priority(t *testing.T) {
+	config, err := execConfig(t, `config = {"name": "Doorbell", "priority": "high"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Priority != PriorityHigh {
+		t.Errorf("Priority = %q, want %q", config.Priority, PriorityHigh)
+	}
+
+	if _, err := execConfig(t, `config = {"name": "Bad", "priority": "urgent"}`); err == nil {
+		t.Error("expected error for invalid priority")
+	}
+}
+
+func TestExtractConfig_MaxRunsPerDay(t *testing.T) {
+	config, err := execConfig(t, `config = {"name": "Loop-prone", "max_runs_per_day": 20}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.MaxRunsPerDay != 20 {
+		t.Errorf("MaxRunsPerDay = %d, want 20", config.MaxRunsPerDay)
+	}
+
+	if _, err := execConfig(t, `config = {"name": "Bad", "max_runs_per_day": "lots"}`); err == nil {
+		t.Error("expected error for non-int max_runs_per_day")
+	}
+}
+
+func TestExtractConfig_OnChangeOnly(t *testing.T) {
+	config, err := execConfig(t, `config = {"name": "Sensors", "subscribe": [
+    "a/b",
+    {"topic": "zigbee2mqtt/+", "on_change_only": True},
+    {"topic": "zigbee2mqtt/thermostat", "change_field": "temperature"},
+]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.Subscribe) != 3 || config.Subscribe[1] != "zigbee2mqtt/+" {
+		t.Errorf("Subscribe = %v", config.Subscribe)
+	}
+	want := map[string]string{"zigbee2mqtt/+": "", "zigbee2mqtt/thermostat": "temperature"}
+	if len(config.OnChangeOnly) != 2 || config.OnChangeOnly["zigbee2mqtt/+"] != "" || config.OnChangeOnly["zigbee2mqtt/thermostat"] != "temperature" {
+		t.Errorf("OnChangeOnly = %v, want %v", config.OnChangeOnly, want)
+	}
+
+	if _, err := execConfig(t, `config = {"name": "Bad", "subscribe": [{"on_change_only": True}]}`); err == nil {
+		t.Error("expected error for subscription without topic")
+	}
+}
+
+func TestExtractConfig_HTTPAllow(t *testing.T) {
+	config, err := execConfig(t, `config = {"name": "Weather", "http_allow": ["api.open-meteo.com", "*.example.com"]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.HTTPAllow) != 2 || config.HTTPAllow[1] != "*.example.com" {
+		t.Errorf("HTTPAllow = %v", config.HTTPAllow)
+	}
+
+	if _, err := execConfig(t, `config = {"name": "Bad", "http_allow": "api.open-meteo.com"}`); err == nil {
+		t.Error("expected error for non-list http_allow")
+	}
+}
@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// watches reports whether the automation's watch_global patterns cover key
+func (a *Automation) watches(key string) bool {
+	for _, pattern := range a.Config.WatchGlobal {
+		if matchPattern(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// globalStateChanged streams a global key change to subscribers and, with
+// notify set, queues on_state_change(key, old, new, ctx) for every
+// automation watching key, except the writer itself. Writes that leave the
+// value unchanged trigger nothing. Each run counts one hop deeper than the
+// writing run, so automations reacting to each other's writes are caught by
+// the loop guard like publish chains.
+func (r *Runner) globalStateChanged(thread *starlark.Thread, writer, key string, old, new any, notify bool) {
+	if sameValue(old, new) {
+		return
+	}
+	r.streamGlobalChange(GlobalStateChange{Key: key, Old: old, New: new, Automation: writer, Time: time.Now()})
+	if key == ProfileKey {
+		r.profileSwitched(writer, new)
+	}
+	if !notify {
+		return
+	}
+
+	r.mu.RLock()
+	var watchers []*Automation
+	for _, a := range sortedAutomations(r.automations) {
+		if a.ID != writer && a.onStateChange != nil && a.watches(key) {
+			watchers = append(watchers, a)
+		}
+	}
+	r.mu.RUnlock()
+	if len(watchers) == 0 {
+		return
+	}
+
+	depth := loopDepth(thread) + 1
+	r.loops.mu.Lock()
+	maxDepth, breakLoops := r.loops.maxDepth, r.loops.breakLoops
+	r.loops.mu.Unlock()
+	if depth > maxDepth {
+		if depth == maxDepth+1 {
+			slog.Warn("Global state loop detected", "writer", writer, "key", key, "depth", depth, "break", breakLoops)
+			r.addLog(writer, LogLevelWarning, fmt.Sprintf("WARNING: global state loop detected on %s (%d chained triggers)", key, depth))
+		}
+		if breakLoops {
+			return
+		}
+	}
+
+	trigger := Trigger{Type: TriggerState, Key: key, Caller: writer, Time: time.Now(), depth: depth}
+	for _, a := range watchers {
+		a := a
+		r.dispatcher.submitSerial(a.ID, a.Config.Priority, func() {
+			r.execute(a, trigger, "on_state_change", a.onStateChange, starlark.String(key), goToStarlark(old), goToStarlark(new))
+		})
+	}
+}
+
+// sameValue compares global state values by their stored JSON form, so an
+// int written by Starlark equals the float64 read back from the store
+func sameValue(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
@@ -0,0 +1,132 @@
+package runner
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// stateTestAutomation registers src with the runner's store and
+// on_state_change wired up the way loadAutomation does it
+func stateTestAutomation(t *testing.T, r *Runner, id, src string) {
+	t.Helper()
+	a := addTestAutomation(t, r, id, src)
+	a.onStateChange, _ = a.globals["on_state_change"].(starlark.Callable)
+	a.context.stateStore = r.stateStore
+	a.context.writeGlobal = func(thread *starlark.Thread, key string, value any, clear bool) error {
+		return r.writeGlobal(thread, id, key, value, clear)
+	}
+}
+
+// waitForLog polls the automation logs until one contains want
+func waitForLog(t *testing.T, r *Runner, want string) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var logs []string
+		for _, entry := range r.GetLogs() {
+			logs = append(logs, entry.Message)
+		}
+		if strings.Contains(strings.Join(logs, "\n"), want) {
+			return logs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no log containing %q in:\n%s", want, strings.Join(logs, "\n"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOnStateChange(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	stateTestAutomation(t, r, "presence", `
+config = {"name": "Presence", "global_state_writes": ["presence.*", "mode"], "watch_global": ["presence.*"]}
+
+def on_schedule(ctx):
+    ctx.set_global("presence.hallway", True)
+    ctx.set_global("presence.hallway", True)
+    ctx.set_global("mode", "away")
+    ctx.clear_global("presence.hallway")
+
+def on_state_change(key, old, new, ctx):
+    ctx.log("presence saw its own write")
+`)
+	stateTestAutomation(t, r, "lights", `
+config = {"name": "Lights", "watch_global": ["presence.*"]}
+
+def on_state_change(key, old, new, ctx):
+    ctx.log("%s %s: %s -> %s by %s" % (ctx.trigger.type, key, old, new, ctx.trigger.caller))
+`)
+
+	if _, err := r.RunManual("presence", ManualTrigger{}); err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	waitForLog(t, r, "None -> True")
+	waitForLog(t, r, "True -> None")
+	time.Sleep(50 * time.Millisecond)
+
+	// Runs are queued on the worker pool, so they may finish in either order
+	logs := waitForLog(t, r, "by presence")
+	sort.Strings(logs)
+	want := []string{
+		"state_change presence.hallway: None -> True by presence",
+		"state_change presence.hallway: True -> None by presence",
+	}
+	if strings.Join(logs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("logs = %q, want %q", logs, want)
+	}
+}
+
+func TestOnStateChange_LoopGuard(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	r.SetLoopGuard(0, 0, true)
+	stateTestAutomation(t, r, "ping", `
+config = {"name": "Ping", "global_state_writes": ["ping"], "watch_global": ["pong"]}
+
+def on_schedule(ctx):
+    ctx.set_global("ping", 0)
+
+def on_state_change(key, old, new, ctx):
+    ctx.set_global("ping", new + 1)
+`)
+	stateTestAutomation(t, r, "pong", `
+config = {"name": "Pong", "global_state_writes": ["pong"], "watch_global": ["ping"]}
+
+def on_state_change(key, old, new, ctx):
+    ctx.set_global("pong", new + 1)
+`)
+
+	if _, err := r.RunManual("ping", ManualTrigger{}); err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	waitForLog(t, r, "global state loop detected on pong")
+	time.Sleep(50 * time.Millisecond)
+
+	// Writes at depths 0 to 5 go through; the run at depth 6 is dropped
+	ping, _ := r.stateStore.GetGlobalState("ping")
+	pong, _ := r.stateStore.GetGlobalState("pong")
+	if !sameValue(ping, 4) || !sameValue(pong, 5) {
+		t.Errorf("ping = %v, pong = %v; want 4, 5", ping, pong)
+	}
+}
+
+func TestSameValue(t *testing.T) {
+	tests := []struct {
+		a, b any
+		want bool
+	}{
+		{int64(3), float64(3), true},
+		{nil, nil, true},
+		{nil, false, false},
+		{map[string]any{"a": 1, "b": 2}, map[string]any{"b": 2, "a": 1}, true},
+		{"on", "off", false},
+	}
+	for _, tt := range tests {
+		if got := sameValue(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameValue(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
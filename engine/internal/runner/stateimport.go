@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// importWriter is reported as the writer of imported keys to on_state_change
+const importWriter = "import"
+
+// ImportState writes a snapshot, state and annotations, with
+// state.Store.Import in one transaction, then handles each global key it changed like any other global write: the
+// change goes to the key's history, the state stream and on_state_change.
+// Pending expiries of the keys it overwrote or, with replace, cleared are
+// cancelled, so a TTL set for an old value can't clear an imported one.
+func (r *Runner) ImportState(snapshot state.Snapshot, replace bool) (state.ImportResult, error) {
+	if r.stateStore == nil {
+		return state.ImportResult{}, errors.New("no state store")
+	}
+	before, err := r.stateStore.Export()
+	if err != nil {
+		return state.ImportResult{}, err
+	}
+	pending, err := r.stateStore.ListExpirations()
+	if err != nil {
+		return state.ImportResult{}, err
+	}
+
+	// Stop the timers first, so none fires between the import and dropping
+	// its expiration; a failed import re-arms them
+	var touched []state.Expiration
+	for _, expiration := range pending {
+		if replace || importsKey(snapshot, expiration) {
+			r.disarmExpiry(expiration.AutomationID, expiration.Key, expiration.Global)
+			touched = append(touched, expiration)
+		}
+	}
+	result, err := r.stateStore.Import(snapshot, replace)
+	if err != nil {
+		for _, expiration := range touched {
+			r.armExpiry(expiration)
+		}
+		return result, err
+	}
+	for _, expiration := range touched {
+		if err := r.stateStore.DeleteExpiration(expiration.AutomationID, expiration.Key, expiration.Global); err != nil {
+			slog.Warn("Failed to delete expiration of imported key", "automation", expiration.AutomationID, "key", expiration.Key, "error", err)
+		}
+	}
+
+	keys := make([]string, 0, len(snapshot.Global))
+	for key := range snapshot.Global {
+		keys = append(keys, key)
+	}
+	if replace {
+		for key := range before.Global {
+			if _, ok := snapshot.Global[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	now := time.Now()
+	for _, key := range keys {
+		old := before.Global[key]
+		value, ok := snapshot.Global[key]
+		if sameValue(old, value) {
+			continue
+		}
+		entry := state.HistoryEntry{Value: value, Time: now}
+		if !ok {
+			entry = state.HistoryEntry{Time: now, Cleared: true}
+		}
+		if err := r.stateStore.RecordGlobalHistory(key, entry); err != nil {
+			slog.Warn("Failed to record history of global key", "key", key, "error", err)
+		}
+		r.globalStateChanged(nil, importWriter, key, old, value, true)
+	}
+	return result, nil
+}
+
+// importsKey reports whether snapshot writes the key of expiration
+func importsKey(snapshot state.Snapshot, expiration state.Expiration) bool {
+	if expiration.Global {
+		_, ok := snapshot.Global[expiration.Key]
+		return ok
+	}
+	_, ok := snapshot.Automations[expiration.AutomationID][expiration.Key]
+	return ok
+}
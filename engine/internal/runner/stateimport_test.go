@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+func TestImportState(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	expiryTestAutomation(t, r, "motion", `
+config = {"name": "Motion", "global_state_writes": ["presence.*", "mode"]}
+
+def on_message(topic, payload, ctx):
+    ctx.set_state("count", 1, ttl = 0.05)
+    ctx.set_global("presence.hallway", True, ttl = 0.05)
+    ctx.set_global("mode", "away")
+`)
+	expiryTestAutomation(t, r, "lights", `
+config = {"name": "Lights", "watch_global": ["presence.*", "mode"]}
+
+def on_state_change(key, old, new, ctx):
+    ctx.log("%s: %s -> %s" % (key, old, new))
+`)
+	if _, err := r.handleMessage(r.automations["motion"], Trigger{Type: TriggerMQTT, Topic: "hallway/motion"}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, r, "mode: None -> away")
+	changes, stop := r.SubscribeGlobalState(nil)
+	defer stop()
+
+	snapshot := state.Snapshot{
+		Version:     state.SnapshotVersion,
+		Automations: map[string]map[string]any{"motion": {"count": 5.0}},
+		Global:      map[string]any{"presence.hallway": "imported"},
+	}
+	if _, err := r.ImportState(snapshot, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The TTLs set for the old values don't clear the imported ones
+	time.Sleep(100 * time.Millisecond)
+	if v, _ := r.stateStore.GetGlobalState("presence.hallway"); v != "imported" {
+		t.Errorf("presence.hallway = %v, want imported", v)
+	}
+	if v, _ := r.stateStore.GetState("motion", "count"); v != 5.0 {
+		t.Errorf("count = %v, want 5", v)
+	}
+	if pending, _ := r.stateStore.ListExpirations(); len(pending) != 0 {
+		t.Errorf("expirations left behind: %+v", pending)
+	}
+
+	waitForLog(t, r, "mode: away -> None")
+	waitForLog(t, r, "presence.hallway: True -> imported")
+	for _, want := range []GlobalStateChange{{Key: "mode", Old: "away"}, {Key: "presence.hallway", Old: true, New: "imported"}} {
+		select {
+		case got := <-changes:
+			if got.Key != want.Key || got.Old != want.Old || got.New != want.New || got.Automation != importWriter {
+				t.Errorf("change = %+v, want %+v by %s", got, want, importWriter)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no change streamed for %s", want.Key)
+		}
+	}
+	if history, _ := r.stateStore.GetGlobalHistory("mode", 1); len(history) != 1 || !history[0].Cleared {
+		t.Errorf("mode history = %+v, want it cleared", history)
+	}
+	if history, _ := r.stateStore.GetGlobalHistory("presence.hallway", 1); len(history) != 1 || history[0].Value != "imported" {
+		t.Errorf("presence.hallway history = %+v", history)
+	}
+}
+
+func TestImportState_FailureKeepsExpiries(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	expiryTestAutomation(t, r, "motion", `
+config = {"name": "Motion", "global_state_writes": ["presence.*"]}
+
+def on_message(topic, payload, ctx):
+    ctx.set_global("presence.hallway", True, ttl = 0.05)
+`)
+	if _, err := r.handleMessage(r.automations["motion"], Trigger{Type: TriggerMQTT, Topic: "hallway/motion"}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ImportState(state.Snapshot{Version: state.SnapshotVersion + 1}, true); err == nil {
+		t.Fatal("import of an unsupported version succeeded")
+	}
+	waitFor(t, "presence.hallway to expire", func() bool {
+		v, _ := r.stateStore.GetGlobalState("presence.hallway")
+		return v == nil
+	})
+}
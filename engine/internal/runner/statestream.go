@@ -0,0 +1,84 @@
+package runner
+
+import (
+	"sync"
+	"time"
+)
+
+// GlobalStateChange is one change of a global key, as streamed to UIs
+type GlobalStateChange struct {
+	Key        string    `json:"key"`
+	Old        any       `json:"old"`
+	New        any       `json:"new"`                  // nil when the key was cleared or expired
+	Automation string    `json:"automation,omitempty"` // Writer; empty for expired keys
+	Time       time.Time `json:"time"`
+}
+
+// stateStream fans global state changes out to subscribers
+type stateStream struct {
+	mu          sync.Mutex
+	subscribers map[chan GlobalStateChange][]string // Key patterns by subscriber; none means all keys
+}
+
+// SubscribeGlobalState returns a channel receiving changes of global keys
+// matching any of patterns (all keys if there are none) and a func that ends
+// the subscription. A subscriber that falls behind misses changes rather than
+// holding up the writer.
+func (r *Runner) SubscribeGlobalState(patterns []string) (<-chan GlobalStateChange, func()) {
+	ch := make(chan GlobalStateChange, 64)
+	r.stateStream.mu.Lock()
+	if r.stateStream.subscribers == nil {
+		r.stateStream.subscribers = make(map[chan GlobalStateChange][]string)
+	}
+	r.stateStream.subscribers[ch] = patterns
+	r.stateStream.mu.Unlock()
+
+	return ch, func() {
+		r.stateStream.mu.Lock()
+		delete(r.stateStream.subscribers, ch)
+		r.stateStream.mu.Unlock()
+	}
+}
+
+// streamGlobalChange sends a change to the subscribers
+func (r *Runner) streamGlobalChange(change GlobalStateChange) {
+	r.stateStream.mu.Lock()
+	defer r.stateStream.mu.Unlock()
+	for ch, patterns := range r.stateStream.subscribers {
+		if !matchesAny(patterns, change.Key) {
+			continue
+		}
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
+
+// GlobalStateSnapshot returns the current values of the global keys matching
+// any of patterns, or all of them if there are none
+func (r *Runner) GlobalStateSnapshot(patterns []string) (map[string]any, error) {
+	all, err := r.stateStore.GetAllGlobalState()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(map[string]any)
+	for key, value := range all {
+		if matchesAny(patterns, key) {
+			snapshot[key] = value
+		}
+	}
+	return snapshot, nil
+}
+
+func matchesAny(patterns []string, key string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchPattern(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
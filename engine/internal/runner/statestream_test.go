@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribeGlobalState(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	expiryTestAutomation(t, r, "presence", `
+config = {"name": "Presence", "global_state_writes": ["presence.*", "mode"]}
+
+def on_message(topic, payload, ctx):
+    ctx.set_global("presence.hallway", True)
+    ctx.set_global("presence.hallway", True)
+    ctx.set_global("mode", "away")
+    ctx.clear_global("presence.hallway")
+`)
+	all, stopAll := r.SubscribeGlobalState(nil)
+	defer stopAll()
+	presence, stopPresence := r.SubscribeGlobalState([]string{"presence.*"})
+	defer stopPresence()
+
+	if _, err := r.handleMessage(r.automations["presence"], Trigger{Type: TriggerMQTT, Topic: "hallway/motion"}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	receive := func(ch <-chan GlobalStateChange, n int) []GlobalStateChange {
+		t.Helper()
+		var changes []GlobalStateChange
+		for len(changes) < n {
+			select {
+			case c := <-ch:
+				changes = append(changes, c)
+			case <-time.After(time.Second):
+				t.Fatalf("got %d changes, want %d: %+v", len(changes), n, changes)
+			}
+		}
+		select {
+		case c := <-ch:
+			t.Fatalf("unexpected change %+v", c)
+		default:
+		}
+		return changes
+	}
+
+	// The repeated write stores the same value and is not a change
+	changes := receive(all, 3)
+	if c := changes[0]; c.Key != "presence.hallway" || c.Old != nil || c.New != true || c.Automation != "presence" || c.Time.IsZero() {
+		t.Errorf("first change = %+v", c)
+	}
+	if c := changes[1]; c.Key != "mode" || c.New != "away" {
+		t.Errorf("second change = %+v", c)
+	}
+	if c := changes[2]; c.Key != "presence.hallway" || c.Old != true || c.New != nil {
+		t.Errorf("third change = %+v", c)
+	}
+
+	if changes := receive(presence, 2); changes[0].Key != "presence.hallway" || changes[1].Key != "presence.hallway" {
+		t.Errorf("filtered changes = %+v", changes)
+	}
+
+	stopAll()
+	r.streamGlobalChange(GlobalStateChange{Key: "mode"})
+	select {
+	case c := <-all:
+		t.Errorf("change after unsubscribing: %+v", c)
+	default:
+	}
+}
+
+func TestGlobalStateSnapshot(t *testing.T) {
+	r := newExpiryTestRunner(t)
+	r.stateStore.SetGlobalState("presence.hallway", true)
+	r.stateStore.SetGlobalState("mode", "home")
+
+	snapshot, err := r.GlobalStateSnapshot([]string{"presence.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot) != 1 || snapshot["presence.hallway"] != true {
+		t.Errorf("snapshot = %v", snapshot)
+	}
+	if all, _ := r.GlobalStateSnapshot(nil); len(all) != 2 {
+		t.Errorf("unfiltered snapshot = %v", all)
+	}
+}
@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+
+	"go.starlark.net/starlark"
+)
+
+// defaultMaxSteps bounds a handler run to a few seconds of interpreter time.
+// Steps are Starlark bytecode instructions: they bound CPU use, and with it
+// how much a run can allocate, though not the size of single values. There
+// is no separate allocation limit: starlark-go doesn't count the memory a
+// thread allocates, so one couldn't be enforced per run.
+const defaultMaxSteps = 100_000_000
+
+var errStepLimit = errors.New("exceeded the step limit")
+
+// SetMaxSteps sets how many Starlark steps a handler run may execute before
+// it is cancelled, unless its config sets max_steps. Zero disables the limit.
+func (r *Runner) SetMaxSteps(steps uint64) {
+	r.maxSteps = steps
+}
+
+// stepsFor returns the step limit for an automation's handler runs
+func (r *Runner) stepsFor(config AutomationConfig) uint64 {
+	if config.MaxSteps > 0 {
+		return uint64(config.MaxSteps)
+	}
+	return r.maxSteps
+}
+
+// limitSteps cancels thread once it has executed steps more instructions.
+// Calling the returned func reports whether it was cancelled for that.
+func limitSteps(thread *starlark.Thread, steps uint64) func() bool {
+	if steps == 0 {
+		return func() bool { return false }
+	}
+	thread.Steps = 0
+	thread.SetMaxExecutionSteps(steps)
+	return func() bool { return thread.ExecutionSteps() >= steps }
+}
+
+// parseMaxSteps reads config["max_steps"]
+func parseMaxSteps(v starlark.Value) (int64, error) {
+	var steps int64
+	if err := starlark.AsInt(v, &steps); err != nil || steps <= 0 {
+		return 0, fmt.Errorf("max_steps must be a positive int")
+	}
+	return steps, nil
+}
@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractConfig_MaxSteps(t *testing.T) {
+	config, err := execConfig(t, `config = {"name": "Test", "max_steps": 5000}`)
+	if err != nil || config.MaxSteps != 5000 {
+		t.Errorf("MaxSteps = %v, %v; want 5000", config.MaxSteps, err)
+	}
+	for _, bad := range []string{"0", "-1", "1.5", `"many"`} {
+		if _, err := execConfig(t, `config = {"name": "Bad", "max_steps": `+bad+`}`); err == nil {
+			t.Errorf("max_steps %s should be rejected", bad)
+		}
+	}
+}
+
+func TestStepsFor(t *testing.T) {
+	r := New(nil, nil)
+	if got := r.stepsFor(AutomationConfig{}); got != defaultMaxSteps {
+		t.Errorf("default steps = %d, want %d", got, defaultMaxSteps)
+	}
+	r.SetMaxSteps(1000)
+	if got := r.stepsFor(AutomationConfig{MaxSteps: 50}); got != 50 {
+		t.Errorf("config steps = %d, want 50", got)
+	}
+}
+
+func TestStepLimit_CancelsRunawayLoop(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "runaway", `
+config = {"name": "Runaway", "schedule": "@every 1m", "max_steps": 10000}
+
+def on_schedule(ctx):
+    total = 0
+    for i in range(1000000000000):
+        total += i
+    return total
+`)
+
+	record, err := r.RunManual("runaway", ManualTrigger{})
+	if err == nil || record.Error != "on_schedule exceeded the step limit of 10000" {
+		t.Errorf("Error = %q", record.Error)
+	}
+	logs := r.GetLogs()
+	if len(logs) != 1 || !strings.Contains(logs[0].Message, "ERROR: on_schedule exceeded the step limit") {
+		t.Errorf("logs = %+v", logs)
+	}
+
+	// The limit applies to each run, not the automation's lifetime
+	addTestAutomation(t, r, "counter", `
+config = {"name": "Counter", "schedule": "@every 1m", "max_steps": 10000}
+
+def on_schedule(ctx):
+    for i in range(1000):
+        pass
+`)
+	for i := 0; i < 20; i++ {
+		if _, err := r.RunManual("counter", ManualTrigger{}); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+}
+
+func TestDryRun_StepLimit(t *testing.T) {
+	r := newTestRunner()
+	r.SetMaxSteps(10000)
+	result, err := r.DryRun(DryRunRequest{Code: `
+def on_schedule(ctx):
+    for i in range(1000000000000):
+        pass
+
+config = {"name": "Runaway"}
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || result.Error != "on_schedule exceeded the step limit of 10000" {
+		t.Errorf("result = %+v", result)
+	}
+}
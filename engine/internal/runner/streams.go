@@ -0,0 +1,263 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// Stream modes for config["streams"]
+const (
+	StreamSSE      = "sse"      // Server-sent events (text/event-stream)
+	StreamLongPoll = "longpoll" // Repeated GETs; each non-empty response is one event
+)
+
+const (
+	minStreamRetry = time.Second
+	maxStreamRetry = time.Minute
+)
+
+var validStreamName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// StreamConfig is an engine-managed push source declared in config["streams"].
+// Events are delivered to on_message as "stream/<name>/<event>".
+type StreamConfig struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Mode    string            `json:"mode"`
+	Headers map[string]string `json:"-"` // Usually carries credentials, so never exposed by the API
+}
+
+// StreamTopic returns the topic on_message sees for events of a stream
+func StreamTopic(name, event string) string {
+	return "stream/" + name + "/" + event
+}
+
+// parseStreams reads config["streams"]:
+// [{"name": "car", "url": "https://...", "mode": "sse", "headers": {...}}]
+func parseStreams(v starlark.Value) ([]StreamConfig, error) {
+	list, ok := v.(*starlark.List)
+	if !ok {
+		return nil, fmt.Errorf("streams must be a list of dicts")
+	}
+	var streams []StreamConfig
+	seen := make(map[string]bool)
+	for i := 0; i < list.Len(); i++ {
+		entry, ok := list.Index(i).(*starlark.Dict)
+		if !ok {
+			return nil, fmt.Errorf("streams[%d] must be a dict", i)
+		}
+		stream := StreamConfig{Mode: StreamSSE}
+		for key, dst := range map[string]*string{"name": &stream.Name, "url": &stream.URL, "mode": &stream.Mode} {
+			if v, found, _ := entry.Get(starlark.String(key)); found {
+				s, ok := v.(starlark.String)
+				if !ok {
+					return nil, fmt.Errorf("streams[%d]: %s must be a string", i, key)
+				}
+				*dst = string(s)
+			}
+		}
+		if !validStreamName.MatchString(stream.Name) {
+			return nil, fmt.Errorf("streams[%d]: name must contain only letters, digits, '_' and '-'", i)
+		}
+		if seen[stream.Name] {
+			return nil, fmt.Errorf("streams[%d]: duplicate name %q", i, stream.Name)
+		}
+		seen[stream.Name] = true
+		if u, err := url.Parse(stream.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("streams[%d]: invalid url %q", i, stream.URL)
+		}
+		if stream.Mode != StreamSSE && stream.Mode != StreamLongPoll {
+			return nil, fmt.Errorf("streams[%d]: mode must be %q or %q", i, StreamSSE, StreamLongPoll)
+		}
+		if v, found, _ := entry.Get(starlark.String("headers")); found {
+			headers, ok := v.(*starlark.Dict)
+			if !ok {
+				return nil, fmt.Errorf("streams[%d]: headers must be a dict", i)
+			}
+			stream.Headers = make(map[string]string, headers.Len())
+			for _, item := range headers.Items() {
+				k, kok := item[0].(starlark.String)
+				v, vok := item[1].(starlark.String)
+				if !kok || !vok {
+					return nil, fmt.Errorf("streams[%d]: headers must map strings to strings", i)
+				}
+				stream.Headers[string(k)] = string(v)
+			}
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+// checkStreamHosts requires every stream URL to be covered by http_allow
+func checkStreamHosts(config AutomationConfig) error {
+	for _, stream := range config.Streams {
+		u, _ := url.Parse(stream.URL)
+		if !hostAllowed(config.HTTPAllow, u) {
+			return fmt.Errorf("stream %s: host %s is not in http_allow", stream.Name, u.Host)
+		}
+	}
+	return nil
+}
+
+// startStreams connects an automation's streams and returns the function
+// that disconnects them again
+func (r *Runner) startStreams(automation *Automation) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), httpAllowKey{}, automation.Config.HTTPAllow))
+	for _, config := range automation.Config.Streams {
+		stream := &streamConsumer{
+			config: config,
+			client: r.httpClient,
+			deliver: func(event, data string) {
+				payload := []byte(data)
+				r.enqueueMessage(automation, Trigger{Type: TriggerMQTT, Topic: StreamTopic(config.Name, event), json: newPayloadJSON(payload)}, payload)
+			},
+			logf: func(msg string) {
+				r.addLog(automation.ID, LogLevelError, msg)
+			},
+		}
+		go stream.run(ctx)
+	}
+	return cancel
+}
+
+// streamConsumer keeps one stream connected, reconnecting with backoff
+type streamConsumer struct {
+	config      StreamConfig
+	client      *http.Client
+	deliver     func(event, data string)
+	logf        func(msg string) // Reports errors to the automation log
+	lastEventID string
+}
+
+func (s *streamConsumer) run(ctx context.Context) {
+	backoff := minStreamRetry
+	for {
+		received, err := s.connect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if received {
+			backoff = minStreamRetry
+		}
+		delay := minStreamRetry
+		switch {
+		case err != nil:
+			s.logf(fmt.Sprintf("ERROR: stream %s: %s (retrying in %s)", s.config.Name, err, backoff))
+			delay = backoff
+			backoff = min(backoff*2, maxStreamRetry)
+		case received:
+			delay = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// connect makes one request and delivers its events. It reports whether any
+// event arrived so run can reset its backoff.
+func (s *streamConsumer) connect(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	for k, v := range s.config.Headers {
+		req.Header.Set(k, v)
+	}
+	if s.config.Mode == StreamSSE {
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Cache-Control", "no-cache")
+		if s.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", s.lastEventID)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if s.config.Mode == StreamLongPoll {
+		if resp.StatusCode == http.StatusNoContent {
+			return false, nil
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return false, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponse))
+		if err != nil || len(data) == 0 {
+			return false, err
+		}
+		s.deliver("message", string(data))
+		return true, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	received := false
+	err = parseSSE(resp.Body, func(event, data, id string) {
+		received = true
+		if id != "" {
+			s.lastEventID = id
+		}
+		s.deliver(event, data)
+	})
+	if err != nil {
+		return received, fmt.Errorf("disconnected: %w", err)
+	}
+	// The server ended the stream normally; run reconnects without an error
+	return received, nil
+}
+
+// parseSSE reads a text/event-stream until EOF, calling emit for each event.
+// Events without data are dropped; the event type defaults to "message".
+func parseSSE(r io.Reader, emit func(event, data, id string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxHTTPResponse)
+
+	var event, id string
+	var data []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			if len(data) > 0 {
+				if event == "" {
+					event = "message"
+				}
+				emit(event, strings.Join(data, "\n"), id)
+			}
+			event, data = "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			id = value
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,140 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSSE(t *testing.T) {
+	input := ": keep-alive\n" +
+		"data: plain\n\n" +
+		"event: charge\r\nid: 7\r\ndata: {\"soc\": 80}\r\n\r\n" +
+		"data: line one\ndata:line two\n\n" +
+		"event: empty\n\n" +
+		"retry: 5000\n\n"
+
+	var got []string
+	if err := parseSSE(strings.NewReader(input), func(event, data, id string) {
+		got = append(got, fmt.Sprintf("%s|%s|%s", event, data, id))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"message|plain|", `charge|{"soc": 80}|7`, "message|line one\nline two|7"}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestStreamConsumer(t *testing.T) {
+	lastIDs := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer t0ken" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/events":
+			lastIDs <- req.Header.Get("Last-Event-ID")
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "id: 1\nevent: charge\ndata: {\"soc\": 80}\n\n")
+		case "/poll":
+			fmt.Fprint(w, `{"door": "open"}`)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		mode string
+		path string
+		want string
+	}{
+		{"sse", StreamSSE, "/events", `charge {"soc": 80}`},
+		{"longpoll", StreamLongPoll, "/poll", `message {"door": "open"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(chan string, 10)
+			logs := make(chan string, 10)
+			stream := &streamConsumer{
+				config:  StreamConfig{Name: tt.name, URL: server.URL + tt.path, Mode: tt.mode, Headers: map[string]string{"Authorization": "Bearer t0ken"}},
+				client:  newHTTPClient(),
+				deliver: func(event, data string) { events <- event + " " + data },
+				logf:    func(msg string) { logs <- msg },
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go stream.run(ctx)
+
+			// Two events prove the consumer reconnects after the server closes
+			for i := 0; i < 2; i++ {
+				select {
+				case got := <-events:
+					if got != tt.want {
+						t.Errorf("event = %q, want %q", got, tt.want)
+					}
+				case <-time.After(3 * time.Second):
+					t.Fatal("timed out waiting for event")
+				}
+			}
+			// The server closing the response is a normal disconnect
+			select {
+			case msg := <-logs:
+				t.Errorf("unexpected log %q", msg)
+			default:
+			}
+		})
+	}
+
+	// The SSE reconnect resumes from the last event ID
+	if first, second := <-lastIDs, <-lastIDs; first != "" || second != "1" {
+		t.Errorf("Last-Event-ID = %q then %q, want \"\" then \"1\"", first, second)
+	}
+}
+
+func TestExtractConfig_Streams(t *testing.T) {
+	config, err := execConfig(t, `config = {
+    "name": "Car",
+    "http_allow": ["api.example-ev.com"],
+    "streams": [
+        {"name": "car", "url": "https://api.example-ev.com/v1/events", "headers": {"Authorization": "Bearer x"}},
+        {"name": "poll", "url": "https://api.example-ev.com/v1/poll", "mode": "longpoll"},
+    ],
+}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.Streams) != 2 || config.Streams[0].Mode != StreamSSE || config.Streams[0].Headers["Authorization"] != "Bearer x" || config.Streams[1].Mode != StreamLongPoll {
+		t.Errorf("Streams = %+v", config.Streams)
+	}
+
+	bad := []struct {
+		name    string
+		streams string
+		wantErr string
+	}{
+		{"host not allowed", `[{"name": "a", "url": "https://other.example.com/"}]`, "http_allow"},
+		{"bad url", `[{"name": "a", "url": "ftp://api.example-ev.com/"}]`, "invalid url"},
+		{"bad name", `[{"name": "a/b", "url": "https://api.example-ev.com/"}]`, "name"},
+		{"duplicate", `[{"name": "a", "url": "https://api.example-ev.com/"}, {"name": "a", "url": "https://api.example-ev.com/"}]`, "duplicate"},
+		{"bad mode", `[{"name": "a", "url": "https://api.example-ev.com/", "mode": "ws"}]`, "mode"},
+	}
+	for _, tt := range bad {
+		_, err := execConfig(t, `config = {"name": "Bad", "http_allow": ["api.example-ev.com"], "streams": `+tt.streams+`}`)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/homebrain/engine/internal/mqtt"
+	"go.starlark.net/starlark"
+)
+
+// strictPermissions are the config declarations enforced in strict mode, on
+// top of global_state_writes which is always enforced
+type strictPermissions struct {
+	reads     []string // global_state_reads and watch_global; keys matching global_state_writes are readable too
+	publishes []string // MQTT topic filters, or "sink:filter" for connector sinks
+	libraries []string
+}
+
+// SetStrictMode makes automations loaded afterwards declare every global key
+// they read (global_state_reads), topic they publish to (publishes) and
+// library they use (libraries). Anything undeclared is denied and shows up in
+// GetViolations.
+func (r *Runner) SetStrictMode(enabled bool) {
+	r.strict = enabled
+}
+
+// strictFor returns the permissions to enforce for config, nil outside strict mode
+func (r *Runner) strictFor(config AutomationConfig) *strictPermissions {
+	if !r.strict {
+		return nil
+	}
+	// Watched keys are readable: on_state_change receives their values anyway
+	reads := append(append([]string{}, config.GlobalStateReads...), config.WatchGlobal...)
+	return &strictPermissions{reads: reads, publishes: config.Publishes, libraries: config.Libraries}
+}
+
+// denyRead reports whether strict mode forbids reading key, logging and
+// auditing the denial
+func (c *Context) denyRead(key string) bool {
+	if c.strict == nil || c.canWriteGlobalKey(key) {
+		return false
+	}
+	for _, pattern := range c.strict.reads {
+		if matchPattern(pattern, key) {
+			return false
+		}
+	}
+	c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: Attempted to read global key '%s' without permission (strict mode). Add to global_state_reads in config.", key))
+	c.audit.record(c.automationID, AuditReadDenied, key)
+	return true
+}
+
+// denyPublish reports whether strict mode forbids publishing to topic (on
+// sink, if set), logging and auditing the denial
+func (c *Context) denyPublish(sink, topic string) bool {
+	if c.strict == nil {
+		return false
+	}
+	target := topic
+	if sink != "" {
+		target = sink + ":" + topic
+	}
+	for _, pattern := range c.strict.publishes {
+		filter := pattern
+		if sink != "" {
+			var ok bool
+			if filter, ok = strings.CutPrefix(pattern, sink+":"); !ok {
+				continue
+			}
+		}
+		if mqtt.MatchTopic(filter, topic) {
+			return false
+		}
+	}
+	c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: Attempted to publish to '%s' without permission (strict mode). Add to publishes in config.", target))
+	c.audit.record(c.automationID, AuditPublishDenied, target)
+	return true
+}
+
+// strictLibrary is ctx.lib in strict mode: a read-only mapping of library
+// modules in which only the declared ones can be looked up
+type strictLibrary struct {
+	modules *libraryNamespace
+	allowed map[string]bool
+	deny    func(name string)
+}
+
+var (
+	_ starlark.IterableMapping = (*strictLibrary)(nil)
+	_ starlark.HasAttrs        = (*strictLibrary)(nil)
+)
+
+// strictLibrary wraps the library modules for an automation declaring libraries
+func (c *Context) strictLibrary(modules *libraryNamespace) *strictLibrary {
+	allowed := make(map[string]bool, len(c.strict.libraries))
+	for _, name := range c.strict.libraries {
+		allowed[name] = true
+	}
+	return &strictLibrary{modules: modules, allowed: allowed, deny: func(name string) {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: Attempted to use library '%s' without permission (strict mode). Add to libraries in config.", name))
+		c.audit.record(c.automationID, AuditLibraryDenied, name)
+	}}
+}
+
+func (l *strictLibrary) String() string        { return "<library modules>" }
+func (l *strictLibrary) Type() string          { return "library" }
+func (l *strictLibrary) Freeze()               {}
+func (l *strictLibrary) Truth() starlark.Bool  { return len(l.allowed) > 0 }
+func (l *strictLibrary) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: library") }
+
+// Get looks up a declared module; undeclared modules are denied
+func (l *strictLibrary) Get(k starlark.Value) (starlark.Value, bool, error) {
+	name, ok := k.(starlark.String)
+	if !ok {
+		return nil, false, nil
+	}
+	v, found, err := l.modules.Get(k)
+	if !found || err != nil || l.allowed[string(name)] {
+		return v, found, err
+	}
+	l.deny(string(name))
+	return nil, false, fmt.Errorf("library %q is not declared in config libraries (strict mode)", string(name))
+}
+
+// Attr looks up a declared module as ctx.lib.name
+func (l *strictLibrary) Attr(name string) (starlark.Value, error) {
+	v, found, err := l.Get(starlark.String(name))
+	if !found {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (l *strictLibrary) AttrNames() []string {
+	names := make([]string, 0, len(l.allowed))
+	for _, item := range l.Items() {
+		names = append(names, string(item[0].(starlark.String)))
+	}
+	return names
+}
+
+// Items lists the declared modules that exist
+func (l *strictLibrary) Items() []starlark.Tuple {
+	var items []starlark.Tuple
+	for _, item := range l.modules.Items() {
+		if name, ok := item[0].(starlark.String); ok && l.allowed[string(name)] {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i][0].(starlark.String) < items[j][0].(starlark.String) })
+	return items
+}
+
+func (l *strictLibrary) Iterate() starlark.Iterator {
+	items := l.Items()
+	keys := make([]starlark.Value, len(items))
+	for i, item := range items {
+		keys[i] = item[0]
+	}
+	return starlark.NewList(keys).Iterate()
+}
+
+// GetViolations returns what automations were denied: global writes outside
+// global_state_writes, secrets outside secrets and, in strict mode,
+// undeclared reads, publishes and library use
+func (r *Runner) GetViolations() []AuditEntry {
+	result := []AuditEntry{}
+	for _, entry := range r.GetAudit() {
+		if isDenial(entry.Kind) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func isDenial(kind string) bool {
+	switch kind {
+	case AuditGlobalDenied, AuditReadDenied, AuditPublishDenied, AuditLibraryDenied, AuditSecretDenied:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// strictTestAutomation registers src as an automation running in strict mode
+// with a recording publisher, in-memory state and the "timers" and "presence"
+// library modules
+func strictTestAutomation(t *testing.T, r *Runner, id, src string) (*publishRecorder, *memoryState) {
+	t.Helper()
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lib"), 0755)
+	for _, name := range []string{"timers", "presence"} {
+		code := "def ping():\n    return \"" + name + "\"\n"
+		if err := os.WriteFile(filepath.Join(dir, "lib", name+".lib.star"), []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	libraries := NewLibraryManager()
+	if err := libraries.LoadLibraries(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	r.strict = true
+	a := addTestAutomation(t, r, id, src)
+	published := &publishRecorder{}
+	store := newMemoryState(nil, map[string]any{"mode": "home", "presence.hallway": true}, nil)
+	a.context.mqttClient = published
+	a.context.stateStore = store
+	a.context.libraryManager = libraries
+	a.context.strict = r.strictFor(a.Config)
+	return published, store
+}
+
+func TestStrictMode_DeniesUndeclared(t *testing.T) {
+	r := newTestRunner()
+	published, _ := strictTestAutomation(t, r, "hallway", `
+config = {
+    "name": "Hallway",
+    "global_state_writes": ["presence.*"],
+    "global_state_reads": ["mode"],
+    "publishes": ["zigbee2mqtt/+/set"],
+    "libraries": ["timers"],
+}
+
+def on_schedule(ctx):
+    ctx.log("mode=%s" % ctx.get_global("mode"))
+    ctx.log("presence=%s" % ctx.get_global("presence.hallway"))
+    ctx.log("alarm=%s" % ctx.get_global("alarm.state"))
+    ctx.log("light=%s" % ctx.publish("zigbee2mqtt/hallway_light/set", "ON"))
+    ctx.log("siren=%s" % ctx.publish("alarm/siren", "ON"))
+    ctx.log("lib=%s" % ctx.lib["timers"]["ping"]())
+    ctx.log("attr=%s" % ctx.lib.timers.ping())
+    ctx.lib["presence"]
+`)
+
+	_, err := r.RunManual("hallway", ManualTrigger{})
+	if err == nil || !strings.Contains(err.Error(), `library "presence" is not declared`) {
+		t.Fatalf("RunManual error = %v, want the undeclared library to fail the run", err)
+	}
+
+	var logs []string
+	for _, entry := range r.GetLogs() {
+		logs = append(logs, entry.Message)
+	}
+	joined := strings.Join(logs, "\n")
+	for _, want := range []string{
+		"mode=home",
+		"presence=True", // Readable because it is writable
+		"alarm=None",
+		"light=True",
+		"siren=False",
+		"lib=timers",
+		"attr=timers",
+		"read global key 'alarm.state' without permission",
+		"publish to 'alarm/siren' without permission",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("logs missing %q:\n%s", want, joined)
+		}
+	}
+	if len(published.messages) != 1 || published.messages[0].Topic != "zigbee2mqtt/hallway_light/set" {
+		t.Errorf("published = %+v", published.messages)
+	}
+
+	violations := map[string]string{}
+	for _, v := range r.GetViolations() {
+		violations[v.Kind] = v.Target
+	}
+	want := map[string]string{
+		AuditReadDenied:    "alarm.state",
+		AuditPublishDenied: "alarm/siren",
+		AuditLibraryDenied: "presence",
+	}
+	if len(violations) != len(want) {
+		t.Errorf("violations = %v, want %v", violations, want)
+	}
+	for kind, target := range want {
+		if violations[kind] != target {
+			t.Errorf("violation %s = %q, want %q", kind, violations[kind], target)
+		}
+	}
+}
+
+func TestStrictMode_Off(t *testing.T) {
+	r := newTestRunner()
+	published, _ := strictTestAutomation(t, r, "hallway", `
+config = {"name": "Hallway"}
+
+def on_schedule(ctx):
+    ctx.get_global("alarm.state")
+    ctx.publish("alarm/siren", "ON")
+    ctx.lib["presence"]["ping"]()
+`)
+	r.automations["hallway"].context.strict = nil
+
+	if _, err := r.RunManual("hallway", ManualTrigger{}); err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	if len(published.messages) != 1 {
+		t.Errorf("published = %+v", published.messages)
+	}
+	if v := r.GetViolations(); len(v) != 0 {
+		t.Errorf("violations = %+v", v)
+	}
+}
+
+func TestDenyPublish_Sinks(t *testing.T) {
+	c := &Context{
+		automationID: "energy",
+		logFunc:      func(string, string, string) {},
+		strict:       &strictPermissions{publishes: []string{"kafka:energy/#", "home/#"}},
+	}
+
+	tests := []struct {
+		sink, topic string
+		denied      bool
+	}{
+		{"kafka", "energy/readings", false},
+		{"kafka", "home/readings", true},
+		{"nats", "energy/readings", true},
+		{"", "home/kitchen/light", false},
+		{"", "energy/readings", true},
+	}
+	for _, tt := range tests {
+		if got := c.denyPublish(tt.sink, tt.topic); got != tt.denied {
+			t.Errorf("denyPublish(%q, %q) = %v, want %v", tt.sink, tt.topic, got, tt.denied)
+		}
+	}
+}
+
+func TestExtractConfig_StrictDeclarations(t *testing.T) {
+	config, err := execConfig(t, `config = {"name": "T", "global_state_reads": ["mode"], "publishes": ["a/#"], "libraries": ["timers"]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.GlobalStateReads) != 1 || len(config.Publishes) != 1 || config.Libraries[0] != "timers" {
+		t.Errorf("config = %+v", config)
+	}
+
+	if _, err := execConfig(t, `config = {"name": "T", "publishes": "a/#"}`); err == nil {
+		t.Error("expected an error for a non-list publishes")
+	}
+}
@@ -0,0 +1,304 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+// subscriptions shares one MQTT subscription per topic pattern between all
+// automations subscribed to it. Each message is fanned out from a single
+// callback, so its JSON payload is decoded at most once. An automation whose
+// patterns overlap ("a/+" and "a/#") gets a message once, through the first
+// of its patterns that matches.
+type subscriptions struct {
+	mu          sync.Mutex
+	topics      map[string][]*Automation
+	patterns    map[*Automation][]string // Each automation's patterns, in the order added
+	subscribe   func(topic string, handler mqtt.MessageHandler) error
+	unsubscribe func(topic string) error
+	track       func() (done func()) // Set by the watchdog to time callbacks
+}
+
+func newSubscriptions(client *mqtt.Client) *subscriptions {
+	s := &subscriptions{topics: make(map[string][]*Automation), patterns: make(map[*Automation][]string)}
+	if client != nil {
+		s.subscribe = client.Subscribe
+		s.unsubscribe = client.Unsubscribe
+	}
+	return s
+}
+
+// add subscribes an automation to a topic pattern, subscribing on the broker
+// only for the first automation
+func (s *subscriptions) add(automation *Automation, topic string, deliver func(a *Automation, pattern, topic string, payload []byte, decoded *payloadJSON)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.topics[topic]) > 0 {
+		s.topics[topic] = append(s.topics[topic], automation)
+		s.patterns[automation] = append(s.patterns[automation], topic)
+		return nil
+	}
+
+	err := s.subscribe(topic, func(t string, payload []byte) {
+		s.mu.Lock()
+		var targets []*Automation
+		for _, a := range s.topics[topic] {
+			if s.firstMatch(a, t) == topic {
+				targets = append(targets, a)
+			}
+		}
+		track := s.track
+		s.mu.Unlock()
+		if track != nil {
+			defer track()()
+		}
+
+		decoded := newPayloadJSON(payload)
+		for _, a := range targets {
+			deliver(a, topic, t, payload, decoded)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	s.topics[topic] = []*Automation{automation}
+	s.patterns[automation] = append(s.patterns[automation], topic)
+	return nil
+}
+
+// firstMatch returns the first of automation's patterns matching topic,
+// which delivers it. Caller holds s.mu.
+func (s *subscriptions) firstMatch(automation *Automation, topic string) string {
+	for _, pattern := range s.patterns[automation] {
+		if mqtt.MatchTopic(pattern, topic) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// each calls fn for every automation subscribed to a pattern matching topic,
+// for messages that don't come through the broker
+func (s *subscriptions) each(topic string, fn func(automation *Automation, pattern string)) {
+	type target struct {
+		automation *Automation
+		pattern    string
+	}
+	var targets []target
+	s.mu.Lock()
+	for a := range s.patterns {
+		if pattern := s.firstMatch(a, topic); pattern != "" {
+			targets = append(targets, target{a, pattern})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, t := range targets {
+		fn(t.automation, t.pattern)
+	}
+}
+
+// remove drops an automation from a topic pattern, unsubscribing on the
+// broker once nobody else needs it
+func (s *subscriptions) remove(automation *Automation, topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := s.topics[topic]
+	for i, a := range list {
+		if a == automation {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if patterns := s.patterns[automation]; len(patterns) > 0 {
+		if i := slices.Index(patterns, topic); i >= 0 {
+			patterns = slices.Delete(slices.Clone(patterns), i, i+1)
+		}
+		if len(patterns) > 0 {
+			s.patterns[automation] = patterns
+		} else {
+			delete(s.patterns, automation)
+		}
+	}
+	if len(list) > 0 {
+		s.topics[topic] = list
+		return
+	}
+
+	delete(s.topics, topic)
+	if err := s.unsubscribe(topic); err != nil {
+		slog.Error("Failed to unsubscribe from topic", "topic", topic, "error", err)
+	}
+}
+
+// maxDynamicTopics caps the topics one automation may add with ctx.subscribe
+const maxDynamicTopics = 200
+
+// dynamicTopics are the topics an automation subscribed to at runtime. They
+// last until the automation is unloaded or reloaded.
+type dynamicTopics struct {
+	mu       sync.Mutex
+	topics   []string
+	unloaded bool // Set on unload so a still running handler can't add more
+}
+
+// list returns the dynamic topics in the order they were added
+func (d *dynamicTopics) list() []string {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.topics)
+}
+
+// subscribeTopic implements ctx.subscribe: it delivers topic to the
+// automation's on_message from now on. It reports false if the automation
+// already subscribes to exactly this topic. The subscription belongs to this
+// version of the automation: once it is unloaded or replaced, it fails.
+func (r *Runner) subscribeTopic(automation *Automation, topic string) (bool, error) {
+	if err := validateTopicFilter(topic); err != nil {
+		return false, err
+	}
+	if automation == nil || automation.dynamic == nil {
+		return false, ErrAutomationNotFound
+	}
+	if automation.onMessage == nil {
+		return false, fmt.Errorf("automation has no on_message function")
+	}
+	if slices.Contains(automation.Config.Subscribe, topic) {
+		return false, nil
+	}
+
+	d := automation.dynamic
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.unloaded {
+		return false, ErrAutomationNotFound
+	}
+	if slices.Contains(d.topics, topic) {
+		return false, nil
+	}
+	if len(d.topics) >= maxDynamicTopics {
+		return false, fmt.Errorf("at most %d topics can be added with subscribe", maxDynamicTopics)
+	}
+	if err := r.subscriptions.add(automation, topic, r.deliverMessage); err != nil {
+		return false, err
+	}
+	d.topics = append(d.topics, topic)
+	slog.Info("Automation subscribed at runtime", "id", automation.ID, "topic", topic)
+	return true, nil
+}
+
+// unsubscribeTopic implements ctx.unsubscribe. Only topics added with
+// ctx.subscribe can be removed; it reports whether topic was one of them.
+func (r *Runner) unsubscribeTopic(automation *Automation, topic string) bool {
+	if automation == nil || automation.dynamic == nil {
+		return false
+	}
+
+	d := automation.dynamic
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i := slices.Index(d.topics, topic)
+	if i < 0 || d.unloaded {
+		return false
+	}
+	d.topics = slices.Delete(d.topics, i, i+1)
+	r.subscriptions.remove(automation, topic)
+	slog.Info("Automation unsubscribed at runtime", "id", automation.ID, "topic", topic)
+	return true
+}
+
+// subscribeBuiltin implements ctx.subscribe(topic)
+func (c *Context) subscribeBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var topic string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "topic", &topic); err != nil {
+		return nil, err
+	}
+	if c.subscribe == nil {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	added, err := c.subscribe(topic)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	return starlark.Bool(added), nil
+}
+
+// unsubscribeBuiltin implements ctx.unsubscribe(topic)
+func (c *Context) unsubscribeBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var topic string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "topic", &topic); err != nil {
+		return nil, err
+	}
+	if c.unsubscribe == nil {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	return starlark.Bool(c.unsubscribe(topic)), nil
+}
+
+// removeDynamicTopics drops an unloaded automation's runtime subscriptions
+func (r *Runner) removeDynamicTopics(automation *Automation) {
+	d := automation.dynamic
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, topic := range d.topics {
+		r.subscriptions.remove(automation, topic)
+	}
+	d.topics = nil
+	d.unloaded = true
+}
+
+// validateTopicFilter checks an MQTT topic filter: "+" and "#" must fill a
+// whole level, and "#" must be the last one
+func validateTopicFilter(topic string) error {
+	if topic == "" {
+		return fmt.Errorf("topic is empty")
+	}
+	_, brokerTopic := mqtt.SplitBroker(topic)
+	levels := strings.Split(brokerTopic, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("invalid topic %q: \"#\" must be the whole last level", topic)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("invalid topic %q: \"+\" must be a whole level", topic)
+		}
+	}
+	return nil
+}
+
+// payloadJSON decodes a message payload on first use and shares the result
+// between every automation the message is delivered to
+type payloadJSON struct {
+	once  sync.Once
+	data  []byte
+	value any
+	valid bool
+}
+
+func newPayloadJSON(data []byte) *payloadJSON {
+	return &payloadJSON{data: data}
+}
+
+// get returns the decoded payload, or false if it is not valid JSON
+func (p *payloadJSON) get() (any, bool) {
+	p.once.Do(func() {
+		p.valid = json.Unmarshal(p.data, &p.value) == nil
+	})
+	return p.value, p.valid
+}
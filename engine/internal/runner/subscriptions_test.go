@@ -0,0 +1,258 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+// fakeBroker records broker subscriptions for subscriptions tests
+type fakeBroker struct {
+	handlers     map[string]mqtt.MessageHandler
+	unsubscribed []string
+}
+
+func newFakeSubscriptions() (*subscriptions, *fakeBroker) {
+	broker := &fakeBroker{handlers: make(map[string]mqtt.MessageHandler)}
+	s := newSubscriptions(nil)
+	s.subscribe = func(topic string, handler mqtt.MessageHandler) error {
+		broker.handlers[topic] = handler
+		return nil
+	}
+	s.unsubscribe = func(topic string) error {
+		delete(broker.handlers, topic)
+		broker.unsubscribed = append(broker.unsubscribed, topic)
+		return nil
+	}
+	return s, broker
+}
+
+func TestSubscriptions_SharedAcrossAutomations(t *testing.T) {
+	s, broker := newFakeSubscriptions()
+	a, b := &Automation{ID: "a"}, &Automation{ID: "b"}
+
+	var delivered []string
+	var decodes []*payloadJSON
+	deliver := func(automation *Automation, pattern, topic string, payload []byte, decoded *payloadJSON) {
+		delivered = append(delivered, automation.ID)
+		decodes = append(decodes, decoded)
+	}
+
+	s.add(a, "sensors/temp", deliver)
+	s.add(b, "sensors/temp", deliver)
+	if len(broker.handlers) != 1 {
+		t.Fatalf("expected one broker subscription, got %d", len(broker.handlers))
+	}
+
+	broker.handlers["sensors/temp"]("sensors/temp", []byte(`{"temperature": 21.5}`))
+	if len(delivered) != 2 || delivered[0] != "a" || delivered[1] != "b" {
+		t.Fatalf("delivered = %v, want [a b]", delivered)
+	}
+	if decodes[0] != decodes[1] {
+		t.Error("automations should share one decoded payload per message")
+	}
+
+	// Unloading one automation keeps the broker subscription for the other
+	s.remove(a, "sensors/temp")
+	if len(broker.unsubscribed) != 0 {
+		t.Fatalf("unsubscribed too early: %v", broker.unsubscribed)
+	}
+	s.remove(b, "sensors/temp")
+	if len(broker.unsubscribed) != 1 || broker.unsubscribed[0] != "sensors/temp" {
+		t.Errorf("unsubscribed = %v, want [sensors/temp]", broker.unsubscribed)
+	}
+}
+
+func TestSubscriptions_OverlappingPatterns(t *testing.T) {
+	s, broker := newFakeSubscriptions()
+	a, b := &Automation{ID: "a"}, &Automation{ID: "b"}
+
+	var delivered []string
+	deliver := func(automation *Automation, pattern, topic string, payload []byte, decoded *payloadJSON) {
+		delivered = append(delivered, automation.ID+" "+pattern)
+	}
+	s.add(a, "sensors/+", deliver)
+	s.add(a, "sensors/#", deliver)
+	s.add(b, "sensors/#", deliver)
+
+	// The client calls every matching subscription for one message
+	for _, pattern := range []string{"sensors/+", "sensors/#"} {
+		broker.handlers[pattern]("sensors/temp", []byte("21"))
+	}
+	slices.Sort(delivered)
+	if want := []string{"a sensors/+", "b sensors/#"}; !slices.Equal(delivered, want) {
+		t.Errorf("delivered = %v, want %v", delivered, want)
+	}
+
+	delivered = nil
+	s.each("sensors/temp", func(automation *Automation, pattern string) {
+		delivered = append(delivered, automation.ID+" "+pattern)
+	})
+	slices.Sort(delivered)
+	if want := []string{"a sensors/+", "b sensors/#"}; !slices.Equal(delivered, want) {
+		t.Errorf("each delivered = %v, want %v", delivered, want)
+	}
+
+	// Without the narrower pattern, the wider one takes over
+	s.remove(a, "sensors/+")
+	delivered = nil
+	broker.handlers["sensors/#"]("sensors/temp", []byte("21"))
+	if want := []string{"a sensors/#", "b sensors/#"}; !slices.Equal(delivered, want) {
+		t.Errorf("after remove delivered = %v, want %v", delivered, want)
+	}
+}
+
+func TestPayloadJSON(t *testing.T) {
+	tests := []struct {
+		payload string
+		valid   bool
+	}{
+		{`{"state": "ON"}`, true},
+		{`[1, 2]`, true},
+		{`42`, true},
+		{`ON`, false},
+		{``, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			if _, valid := newPayloadJSON([]byte(tt.payload)).get(); valid != tt.valid {
+				t.Errorf("valid = %v, want %v", valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestPayloadJSON_ReturnsFreshValues(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "reader", `
+def on_message(topic, payload, ctx):
+    data = ctx.payload_json()
+    data["seen"] = True
+    again = ctx.payload_json()
+    return [data["state"], "seen" in again, ctx.payload_json() == None]
+
+config = {"name": "Reader"}
+`)
+	run, err := r.RunManual("reader", ManualTrigger{Topic: "lamp", Payload: `{"state": "ON"}`})
+	if err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	result, _ := run.Result.([]any)
+	if len(result) != 3 || result[0] != "ON" || result[1] != false || result[2] != false {
+		t.Errorf("result = %v, want [ON false false]", run.Result)
+	}
+
+	run, err = r.RunManual("reader", ManualTrigger{Topic: "lamp", Payload: "not json"})
+	if err == nil {
+		t.Errorf("expected error indexing None, got result %v", run.Result)
+	}
+}
+
+func TestDynamicSubscriptions(t *testing.T) {
+	r := newTestRunner()
+	var broker *fakeBroker
+	r.subscriptions, broker = newFakeSubscriptions()
+	a := addTestAutomation(t, r, "discovery", `
+config = {"name": "Discovery", "subscribe": ["zigbee2mqtt/bridge/devices"]}
+
+def on_message(topic, payload, ctx):
+    if topic == "zigbee2mqtt/bridge/devices":
+        for device in ctx.payload_json():
+            ctx.log("subscribe %s: %s" % (device, ctx.subscribe("zigbee2mqtt/" + device)))
+        ctx.log("config topic: %s %s" % (ctx.subscribe(topic), ctx.unsubscribe(topic)))
+    elif topic == "remove":
+        ctx.log("unsubscribe lamp: %s" % ctx.unsubscribe("zigbee2mqtt/lamp"))
+    else:
+        ctx.log("device message on " + topic)
+`)
+	a.dynamic = &dynamicTopics{}
+	a.context.subscribe = func(topic string) (bool, error) { return r.subscribeTopic(a, topic) }
+	a.context.unsubscribe = func(topic string) bool { return r.unsubscribeTopic(a, topic) }
+	r.subscriptions.add(a, "zigbee2mqtt/bridge/devices", r.deliverMessage)
+
+	if _, err := r.RunManual("discovery", ManualTrigger{Topic: "zigbee2mqtt/bridge/devices", Payload: `["lamp", "plug", "lamp"]`}); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, r, "subscribe plug: True")
+	logs := waitForLog(t, r, "config topic: False False")
+	if logs[0] != "subscribe lamp: True" || logs[2] != "subscribe lamp: False" {
+		t.Errorf("logs = %v", logs)
+	}
+	if got := r.ListAutomations()[0].DynamicTopics; !slices.Equal(got, []string{"zigbee2mqtt/lamp", "zigbee2mqtt/plug"}) {
+		t.Errorf("DynamicTopics = %v", got)
+	}
+
+	// Messages on added topics reach on_message
+	broker.handlers["zigbee2mqtt/plug"]("zigbee2mqtt/plug", []byte(`{"power": 12}`))
+	waitForLog(t, r, "device message on zigbee2mqtt/plug")
+
+	if _, err := r.RunManual("discovery", ManualTrigger{Topic: "remove"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, r, "unsubscribe lamp: True")
+	if _, ok := broker.handlers["zigbee2mqtt/lamp"]; ok {
+		t.Error("zigbee2mqtt/lamp still subscribed on the broker")
+	}
+
+	// Unloading drops the remaining runtime subscriptions
+	r.UnloadAutomation("discovery")
+	if _, ok := broker.handlers["zigbee2mqtt/plug"]; ok {
+		t.Error("zigbee2mqtt/plug still subscribed after unload")
+	}
+	if added, err := r.subscribeTopic(a, "zigbee2mqtt/lamp"); added || err == nil {
+		t.Errorf("subscribe after unload = %v, %v", added, err)
+	}
+}
+
+func TestDynamicSubscriptions_BoundToVersion(t *testing.T) {
+	r := New(nil, nil)
+	s, broker := newFakeSubscriptions()
+	r.subscriptions = s
+	dir := t.TempDir()
+	r.SetAutomationsDir(dir)
+	path := filepath.Join(dir, "discovery.star")
+	write := func(version string) {
+		code := "config = {\"name\": \"Discovery " + version + "\"}\n\ndef on_message(topic, payload, ctx):\n    pass\n"
+		if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.LoadAutomation(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("v1")
+	old := r.automations["discovery"].context
+	write("v2")
+
+	// A handler of the replaced version can't subscribe the new one
+	if added, err := old.subscribe("zigbee2mqtt/lamp"); added || err == nil {
+		t.Errorf("old version subscribe = %v, %v", added, err)
+	}
+	if len(broker.handlers) != 0 || len(r.automations["discovery"].dynamic.list()) != 0 {
+		t.Errorf("subscribed %v", broker.handlers)
+	}
+	if added, err := r.automations["discovery"].context.subscribe("zigbee2mqtt/lamp"); !added || err != nil {
+		t.Errorf("new version subscribe = %v, %v", added, err)
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	for topic, valid := range map[string]bool{
+		"zigbee2mqtt/lamp":    true,
+		"zigbee2mqtt/+/state": true,
+		"zigbee2mqtt/#":       true,
+		"#":                   true,
+		"":                    false,
+		"zigbee2mqtt/#/state": false,
+		"zigbee2mqtt/lamp#":   false,
+		"zigbee2mqtt/lamp+":   false,
+	} {
+		if err := validateTopicFilter(topic); (err == nil) != valid {
+			t.Errorf("validateTopicFilter(%q) = %v, want valid %v", topic, err, valid)
+		}
+	}
+}
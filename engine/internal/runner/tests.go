@@ -0,0 +1,354 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// TestFileSuffix marks an automation's test file: motion_light_test.star
+// holds the tests of motion_light.star. Test files are never loaded as automations.
+const TestFileSuffix = "_test.star"
+
+// ErrNoTests is returned when an automation has no test file or no test functions
+var ErrNoTests = errors.New("no tests found")
+
+// IsTestFile reports whether path is an automation test file
+func IsTestFile(path string) bool {
+	return strings.HasSuffix(filepath.Base(path), TestFileSuffix)
+}
+
+// TestFilePath returns the test file belonging to an automation file
+func TestFilePath(automationPath string) string {
+	dir := filepath.Dir(automationPath)
+	return filepath.Join(dir, fileStem(filepath.Base(automationPath))+TestFileSuffix)
+}
+
+// TestCase is the outcome of one test_* function
+type TestCase struct {
+	Name       string   `json:"name"`
+	Passed     bool     `json:"passed"`
+	Failures   []string `json:"failures,omitempty"` // Failed t.eq/t.true/t.fail checks
+	Error      string   `json:"error,omitempty"`    // The test itself raised an error
+	DurationMs float64  `json:"duration_ms"`
+}
+
+// TestReport is the outcome of an automation's test file
+type TestReport struct {
+	AutomationID string     `json:"automation_id"`
+	Passed       bool       `json:"passed"`
+	Tests        []TestCase `json:"tests"`
+}
+
+// RunTests runs a loaded automation's tests against its deployed source.
+// testCode overrides the automation's test file.
+func (r *Runner) RunTests(automationID, testCode string) (TestReport, error) {
+	automation, err := r.lookup(automationID)
+	if err != nil {
+		return TestReport{}, err
+	}
+	if testCode == "" {
+		data, err := os.ReadFile(TestFilePath(automation.FilePath))
+		if errors.Is(err, os.ErrNotExist) {
+			return TestReport{}, fmt.Errorf("%w: %s has no %s file", ErrNoTests, automationID, TestFileSuffix)
+		}
+		if err != nil {
+			return TestReport{}, err
+		}
+		testCode = string(data)
+	}
+	return r.runTests(automationID, DryRunRequest{AutomationID: automationID}, testCode)
+}
+
+// RunTestFile runs the tests of an automation file that doesn't need to be
+// loaded, using the common module of its directory
+func (r *Runner) RunTestFile(automationPath string) (TestReport, error) {
+	id := AutomationID(r.automationsDir, automationPath)
+	source, err := os.ReadFile(automationPath)
+	if err != nil {
+		return TestReport{}, err
+	}
+	loaded, err := r.loadSource(automationPath, source)
+	if err != nil {
+		return TestReport{}, err
+	}
+	testCode, err := os.ReadFile(TestFilePath(automationPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return TestReport{}, fmt.Errorf("%w: no %s next to %s", ErrNoTests, TestFileSuffix, automationPath)
+	}
+	if err != nil {
+		return TestReport{}, err
+	}
+	return r.runTests(id, DryRunRequest{AutomationID: id, Code: string(loaded.code), common: loaded.predeclared}, string(testCode))
+}
+
+// runTests executes every test_* function of testCode, in name order. Each
+// test gets a harness t whose on_message/on_schedule dry-run the automation
+// described by base.
+func (r *Runner) runTests(id string, base DryRunRequest, testCode string) (TestReport, error) {
+	thread := &starlark.Thread{Name: id + TestFileSuffix}
+	globals, err := starlark.ExecFile(thread, id+TestFileSuffix, testCode, nil)
+	if err != nil {
+		return TestReport{}, fmt.Errorf("failed to execute test file: %w", err)
+	}
+
+	var names []string
+	for name, value := range globals {
+		if _, ok := value.(starlark.Callable); ok && strings.HasPrefix(name, "test_") {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return TestReport{}, fmt.Errorf("%w: define functions named test_*", ErrNoTests)
+	}
+	sort.Strings(names)
+
+	report := TestReport{AutomationID: id, Passed: true, Tests: make([]TestCase, 0, len(names))}
+	for _, name := range names {
+		h := &testHarness{runner: r, base: base}
+		thread := &starlark.Thread{Name: name}
+		timedOut := cancelAfter(thread, r.handlerTimeout)
+		limitSteps(thread, r.maxSteps)
+		start := time.Now()
+		_, err := starlark.Call(thread, globals[name].(starlark.Callable), starlark.Tuple{h.toStarlark()}, nil)
+		timedOut()
+		tc := TestCase{Name: name, Failures: h.failures, DurationMs: float64(time.Since(start).Microseconds()) / 1000}
+		if err != nil {
+			tc.Error = err.Error()
+		}
+		tc.Passed = err == nil && len(h.failures) == 0
+		report.Passed = report.Passed && tc.Passed
+		report.Tests = append(report.Tests, tc)
+	}
+	return report, nil
+}
+
+// testHarness is the t argument of a test function
+type testHarness struct {
+	runner   *Runner
+	base     DryRunRequest
+	failures []string
+}
+
+func (h *testHarness) toStarlark() *starlarkstruct.Struct {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"on_message":  starlark.NewBuiltin("on_message", h.onMessage),
+		"on_schedule": starlark.NewBuiltin("on_schedule", h.onSchedule),
+		"eq":          starlark.NewBuiltin("eq", h.eq),
+		"true":        starlark.NewBuiltin("true", h.isTrue),
+		"fail":        starlark.NewBuiltin("fail", h.fail),
+	})
+}
+
+func (h *testHarness) failf(format string, args ...any) {
+	h.failures = append(h.failures, fmt.Sprintf(format, args...))
+}
+
+// onMessage implements t.on_message(topic, payload, state=None, global_state=None, flags=None).
+// Non-string payloads are JSON-encoded.
+func (h *testHarness) onMessage(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var topic string
+	var payload, stateVal, globalVal, flagsVal starlark.Value = starlark.String(""), starlark.None, starlark.None, starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "topic", &topic, "payload?", &payload, "state?", &stateVal, "global_state?", &globalVal, "flags?", &flagsVal); err != nil {
+		return nil, err
+	}
+	text, ok := starlark.AsString(payload)
+	if !ok {
+		var buf bytes.Buffer
+		if err := encodeJSON(&buf, payload, -1); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		text = buf.String()
+	}
+	req := h.base
+	req.Handler = "on_message"
+	req.Trigger = Trigger{Type: TriggerMQTT, Topic: topic}
+	req.Payload = text
+	return h.run(fn, req, stateVal, globalVal, flagsVal)
+}
+
+// onSchedule implements t.on_schedule(state=None, global_state=None, flags=None)
+func (h *testHarness) onSchedule(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var stateVal, globalVal, flagsVal starlark.Value = starlark.None, starlark.None, starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "state?", &stateVal, "global_state?", &globalVal, "flags?", &flagsVal); err != nil {
+		return nil, err
+	}
+	req := h.base
+	req.Handler = "on_schedule"
+	req.Trigger = Trigger{Type: TriggerSchedule}
+	return h.run(fn, req, stateVal, globalVal, flagsVal)
+}
+
+// run dry-runs the handler with the given initial state and returns what it
+// did: published, state, global_state, logs, notifications, timers,
+// overrides, expectations (failed ctx.expect calls), result and error (None if the
+// handler succeeded)
+func (h *testHarness) run(fn *starlark.Builtin, req DryRunRequest, stateVal, globalVal, flagsVal starlark.Value) (starlark.Value, error) {
+	var err error
+	if req.State, err = testStateArg(stateVal); err != nil {
+		return nil, fmt.Errorf("%s: state %w", fn.Name(), err)
+	}
+	if req.Global, err = testStateArg(globalVal); err != nil {
+		return nil, fmt.Errorf("%s: global_state %w", fn.Name(), err)
+	}
+	flags, err := testStateArg(flagsVal)
+	if err != nil {
+		return nil, fmt.Errorf("%s: flags %w", fn.Name(), err)
+	}
+	for name, enabled := range flags {
+		if req.Flags == nil {
+			req.Flags = make(map[string]state.Flag)
+		}
+		req.Flags[name] = state.Flag{Name: name, Enabled: enabled == true, Percentage: 100}
+	}
+
+	result, err := h.runner.DryRun(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	published := make([]starlark.Value, len(result.Published))
+	for i, msg := range result.Published {
+		published[i] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"topic":   starlark.String(msg.Topic),
+			"payload": starlark.String(msg.Payload),
+			"sink":    starlark.String(msg.Sink),
+			"qos":     starlark.MakeInt(int(msg.QoS)),
+			"retain":  starlark.Bool(msg.Retain),
+		})
+	}
+	notifications := make([]starlark.Value, len(result.Notifications))
+	for i, n := range result.Notifications {
+		notifications[i] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"title":    starlark.String(n.Title),
+			"message":  starlark.String(n.Body),
+			"priority": starlark.String(n.Priority),
+			"channel":  starlark.String(n.Channel),
+		})
+	}
+	timers := make([]starlark.Value, len(result.Timers))
+	for i, timer := range result.Timers {
+		var data any
+		json.Unmarshal(timer.Data, &data)
+		timers[i] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"id":      starlark.String(timer.ID),
+			"seconds": starlark.Float(timer.Seconds),
+			"data":    goToStarlark(data),
+		})
+	}
+	overrides := make([]starlark.Value, len(result.Overrides))
+	for i, override := range result.Overrides {
+		var value, restore any
+		json.Unmarshal(override.Value, &value)
+		json.Unmarshal(override.Restore, &restore)
+		overrides[i] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"target":  starlark.String(override.Target),
+			"seconds": starlark.Float(override.Seconds),
+			"value":   goToStarlark(value),
+			"restore": goToStarlark(restore),
+		})
+	}
+	expectations := make([]starlark.Value, len(result.Expectations))
+	for i, failure := range result.Expectations {
+		expectations[i] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"message":  starlark.String(failure.Message),
+			"location": starlark.String(failure.Location),
+		})
+	}
+	logs := make([]any, len(result.Logs))
+	for i, line := range result.Logs {
+		logs[i] = line
+	}
+	handlerErr := starlark.Value(starlark.None)
+	if !result.Success {
+		handlerErr = starlark.String(result.Error)
+	}
+
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"published":     starlark.NewList(published),
+		"state":         goToStarlark(result.State),
+		"global_state":  goToStarlark(result.Global),
+		"logs":          goToStarlark(logs),
+		"notifications": starlark.NewList(notifications),
+		"timers":        starlark.NewList(timers),
+		"overrides":     starlark.NewList(overrides),
+		"expectations":  starlark.NewList(expectations),
+		"result":        goToStarlark(result.Result),
+		"error":         handlerErr,
+	}), nil
+}
+
+// testStateArg converts an optional dict argument of the harness
+func testStateArg(v starlark.Value) (map[string]any, error) {
+	if v == starlark.None {
+		return nil, nil
+	}
+	dict, ok := v.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("must be a dict, got %s", v.Type())
+	}
+	return starlarkToGo(dict).(map[string]any), nil
+}
+
+// eq implements t.eq(got, want, msg=""); a mismatch fails the test but lets it continue
+func (h *testHarness) eq(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var got, want starlark.Value
+	var msg string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "got", &got, "want", &want, "msg?", &msg); err != nil {
+		return nil, err
+	}
+	equal, err := starlark.Equal(got, want)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	if !equal {
+		h.failf("%sgot %s, want %s", failurePrefix(thread, msg), got, want)
+	}
+	return starlark.Bool(equal), nil
+}
+
+// isTrue implements t.true(cond, msg="")
+func (h *testHarness) isTrue(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var cond starlark.Value
+	var msg string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "cond", &cond, "msg?", &msg); err != nil {
+		return nil, err
+	}
+	if !cond.Truth() {
+		h.failf("%sgot %s, want a true value", failurePrefix(thread, msg), cond)
+	}
+	return cond.Truth(), nil
+}
+
+// fail implements t.fail(msg)
+func (h *testHarness) fail(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg); err != nil {
+		return nil, err
+	}
+	h.failf("%s%s", failurePrefix(thread, ""), msg)
+	return starlark.None, nil
+}
+
+// failurePrefix locates a failed check in the test file, e.g. "line 12: msg: "
+func failurePrefix(thread *starlark.Thread, msg string) string {
+	prefix := ""
+	if thread.CallStackDepth() > 1 {
+		prefix = fmt.Sprintf("line %d: ", thread.CallFrame(1).Pos.Line)
+	}
+	if msg != "" {
+		prefix += msg + ": "
+	}
+	return prefix
+}
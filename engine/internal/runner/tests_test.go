@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMotionLight = `
+config = {
+    "name": "Motion Light",
+    "subscribe": ["zigbee2mqtt/hallway_motion"],
+    "global_state_writes": ["presence.hallway"],
+}
+
+def on_message(topic, payload, ctx):
+    if not ctx.json_decode(payload).get("occupancy"):
+        return
+    if ctx.get_global("mode") == "away":
+        ctx.log("ignored: away")
+        return
+    ctx.publish(light_topic("hallway_light"), ctx.json_encode({"state": "ON"}))
+    ctx.set_state("count", (ctx.get_state("count") or 0) + 1)
+    ctx.set_global("presence.hallway", True)
+    ctx.set_timer("off", 300)
+`
+
+const testMotionLightTests = `
+def test_turns_on_light(t):
+    r = t.on_message("zigbee2mqtt/hallway_motion", {"occupancy": True}, state={"count": 2})
+    t.eq(r.error, None)
+    t.eq(len(r.published), 1)
+    t.eq(r.published[0].topic, "zigbee2mqtt/hallway_light/set")
+    t.eq(r.state["count"], 3)
+    t.true(r.global_state["presence.hallway"])
+    t.eq(r.timers[0].seconds, 300)
+
+def test_away_mode(t):
+    r = t.on_message("zigbee2mqtt/hallway_motion", '{"occupancy": true}', global_state={"mode": "away"})
+    t.eq(r.published, [], "nothing published while away")
+    t.eq(r.logs, ["ignored: away"])
+
+def test_wrong_expectation(t):
+    r = t.on_message("zigbee2mqtt/hallway_motion", {"occupancy": False})
+    t.eq(len(r.published), 1, "publishes")
+    t.fail("reached the end")
+
+def test_raises(t):
+    fail("boom")
+
+def helper(t):
+    t.fail("not a test")
+`
+
+func TestRunTestFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, CommonFile), []byte(`def light_topic(name):
+    return "zigbee2mqtt/%s/set" % name
+`), 0644)
+	path := filepath.Join(dir, "motion_light.star")
+	os.WriteFile(path, []byte(testMotionLight), 0644)
+
+	r := newTestRunner()
+	if _, err := r.RunTestFile(path); !errors.Is(err, ErrNoTests) {
+		t.Fatalf("RunTestFile without a test file = %v, want ErrNoTests", err)
+	}
+
+	os.WriteFile(TestFilePath(path), []byte(testMotionLightTests), 0644)
+	report, err := r.RunTestFile(path)
+	if err != nil {
+		t.Fatalf("RunTestFile failed: %v", err)
+	}
+	if report.AutomationID != "motion_light" || report.Passed || len(report.Tests) != 4 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	byName := make(map[string]TestCase)
+	for _, tc := range report.Tests {
+		byName[tc.Name] = tc
+	}
+	for _, name := range []string{"test_turns_on_light", "test_away_mode"} {
+		if tc := byName[name]; !tc.Passed {
+			t.Errorf("%s = %+v, want passed", name, tc)
+		}
+	}
+	wrong := byName["test_wrong_expectation"]
+	if wrong.Passed || len(wrong.Failures) != 2 || !strings.Contains(wrong.Failures[0], "publishes: got 0, want 1") {
+		t.Errorf("test_wrong_expectation = %+v", wrong)
+	}
+	if raised := byName["test_raises"]; raised.Passed || !strings.Contains(raised.Error, "boom") {
+		t.Errorf("test_raises = %+v", raised)
+	}
+}
+
+func TestRunTests_LoadedAutomation(t *testing.T) {
+	r := newTestRunner()
+	a := addTestAutomation(t, r, "motion_light", "def light_topic(name):\n    return \"zigbee2mqtt/%s/set\" % name\n"+testMotionLight)
+	a.FilePath = filepath.Join(t.TempDir(), "motion_light.star")
+
+	if _, err := r.RunTests("motion_light", ""); !errors.Is(err, ErrNoTests) {
+		t.Errorf("RunTests without a test file = %v, want ErrNoTests", err)
+	}
+	report, err := r.RunTests("motion_light", "def test_turns_on_light(t):\n    t.eq(len(t.on_message(\"zigbee2mqtt/hallway_motion\", {\"occupancy\": True}).published), 1)\n")
+	if err != nil || !report.Passed {
+		t.Errorf("RunTests = %+v, %v", report, err)
+	}
+	if _, err := r.RunTests("missing", "def test_x(t):\n    pass\n"); !errors.Is(err, ErrAutomationNotFound) {
+		t.Errorf("RunTests of unknown automation = %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+// ThrottleRule limits how often commands are published to each topic matching
+// Pattern. Publishes arriving faster are coalesced into one trailing publish.
+type ThrottleRule struct {
+	Pattern  string        // "+" or "*" match one topic level, a trailing "#" the rest
+	Interval time.Duration // Minimum gap between publishes to the same topic
+}
+
+// ParseThrottleRules parses "pattern=interval" pairs separated by commas,
+// e.g. "zigbee2mqtt/+/set=500ms,tasmota/#=1s"
+func ParseThrottleRules(spec string) ([]ThrottleRule, error) {
+	var rules []ThrottleRule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, interval, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("invalid throttle rule %q (want pattern=interval)", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid throttle interval in %q", part)
+		}
+		rules = append(rules, ThrottleRule{Pattern: strings.TrimSpace(pattern), Interval: d})
+	}
+	return rules, nil
+}
+
+// SetPublishThrottle rate-limits ctx.publish for automations loaded afterwards
+func (r *Runner) SetPublishThrottle(rules []ThrottleRule) {
+	if len(rules) == 0 {
+		r.throttle = nil
+		return
+	}
+	r.throttle = newPublishThrottle(r.mqttClient, rules)
+}
+
+// publishThrottle is a Publisher that enforces ThrottleRules per topic. The
+// first publish goes out immediately; publishes inside the interval are held
+// and merged, and the result is sent when the interval ends. JSON object
+// payloads are merged key by key (later values win), so {"state": "ON"}
+// followed by {"brightness": 200} becomes one command; anything else is
+// replaced by the newest payload.
+type publishThrottle struct {
+	next   Publisher
+	rules  []ThrottleRule
+	mu     sync.Mutex
+	topics map[string]*throttledTopic
+}
+
+type throttledTopic struct {
+	last    time.Time
+	pending []byte
+	opts    mqtt.PublishOptions // Of the newest held publish
+	held    bool                // A trailing publish is scheduled
+}
+
+func newPublishThrottle(next Publisher, rules []ThrottleRule) *publishThrottle {
+	return &publishThrottle{next: next, rules: rules, topics: make(map[string]*throttledTopic)}
+}
+
+// Publish sends or holds a message. Held messages report success; a failed
+// trailing publish is logged.
+func (p *publishThrottle) Publish(topic string, payload []byte, opts mqtt.PublishOptions) error {
+	interval, ok := p.interval(topic)
+	if !ok {
+		return p.next.Publish(topic, payload, opts)
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	t, ok := p.topics[topic]
+	if !ok {
+		t = &throttledTopic{}
+		p.topics[topic] = t
+		p.prune(now, interval)
+	}
+
+	if !t.held && now.Sub(t.last) >= interval {
+		t.last = now
+		p.mu.Unlock()
+		return p.next.Publish(topic, payload, opts)
+	}
+
+	t.pending = coalescePayloads(t.pending, payload)
+	t.opts = opts
+	if !t.held {
+		t.held = true
+		time.AfterFunc(interval-now.Sub(t.last), func() { p.flush(topic) })
+	}
+	p.mu.Unlock()
+	slog.Debug("Publish throttled", "topic", topic)
+	return nil
+}
+
+func (p *publishThrottle) flush(topic string) {
+	p.mu.Lock()
+	t := p.topics[topic]
+	payload, opts := t.pending, t.opts
+	t.pending = nil
+	t.held = false
+	t.last = time.Now()
+	p.mu.Unlock()
+
+	if err := p.next.Publish(topic, payload, opts); err != nil {
+		slog.Error("Throttled publish failed", "topic", topic, "error", err)
+	}
+}
+
+// prune drops idle topics so the map doesn't grow with every device ever
+// commanded. Called with p.mu held.
+func (p *publishThrottle) prune(now time.Time, interval time.Duration) {
+	if len(p.topics) <= 1000 {
+		return
+	}
+	for topic, t := range p.topics {
+		if !t.held && now.Sub(t.last) > interval {
+			delete(p.topics, topic)
+		}
+	}
+}
+
+// interval returns the interval of the first rule matching topic
+func (p *publishThrottle) interval(topic string) (time.Duration, bool) {
+	for _, rule := range p.rules {
+		if matchThrottlePattern(rule.Pattern, topic) {
+			return rule.Interval, true
+		}
+	}
+	return 0, false
+}
+
+// coalescePayloads merges two JSON object payloads, otherwise keeps the newer one
+func coalescePayloads(older, newer []byte) []byte {
+	if older == nil {
+		return newer
+	}
+	var a, b map[string]json.RawMessage
+	if json.Unmarshal(older, &a) != nil || json.Unmarshal(newer, &b) != nil || a == nil || b == nil {
+		return newer
+	}
+	for k, v := range b {
+		a[k] = v
+	}
+	merged, err := json.Marshal(a)
+	if err != nil {
+		return newer
+	}
+	return merged
+}
+
+// matchThrottlePattern matches topic like an MQTT filter, also accepting "*"
+// for a single level
+func matchThrottlePattern(pattern, topic string) bool {
+	levels := strings.Split(pattern, "/")
+	for i, level := range levels {
+		if level == "*" {
+			levels[i] = "+"
+		}
+	}
+	return mqtt.MatchTopic(strings.Join(levels, "/"), topic)
+}
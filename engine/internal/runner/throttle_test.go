@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/mqtt"
+)
+
+func TestParseThrottleRules(t *testing.T) {
+	rules, err := ParseThrottleRules("zigbee2mqtt/+/set=500ms, tasmota/#=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Pattern != "zigbee2mqtt/+/set" || rules[1].Interval != time.Second {
+		t.Errorf("ParseThrottleRules() = %+v", rules)
+	}
+
+	for _, spec := range []string{"zigbee2mqtt/+/set", "a=fast", "=1s", "a=-1s"} {
+		if _, err := ParseThrottleRules(spec); err == nil {
+			t.Errorf("ParseThrottleRules(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestMatchThrottlePattern(t *testing.T) {
+	tests := []struct {
+		pattern, topic string
+		expected       bool
+	}{
+		{"zigbee2mqtt/+/set", "zigbee2mqtt/lamp/set", true},
+		{"zigbee2mqtt/*/set", "zigbee2mqtt/lamp/set", true},
+		{"zigbee2mqtt/+/set", "zigbee2mqtt/lamp", false},
+		{"zigbee2mqtt/+/set", "zigbee2mqtt/lamp/set/extra", false},
+		{"tasmota/#", "tasmota/plug/cmnd/POWER", true},
+		{"tasmota/#", "zigbee2mqtt/lamp", false},
+		{"a/b", "a/b", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchThrottlePattern(tt.pattern, tt.topic); got != tt.expected {
+			t.Errorf("matchThrottlePattern(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.expected)
+		}
+	}
+}
+
+func TestCoalescePayloads(t *testing.T) {
+	tests := []struct {
+		older, newer, expected string
+	}{
+		{`{"state":"ON"}`, `{"brightness":200}`, `{"brightness":200,"state":"ON"}`},
+		{`{"state":"ON"}`, `{"state":"OFF"}`, `{"state":"OFF"}`},
+		{"ON", "OFF", "OFF"},
+		{`{"state":"ON"}`, "TOGGLE", "TOGGLE"},
+	}
+
+	for _, tt := range tests {
+		if got := string(coalescePayloads([]byte(tt.older), []byte(tt.newer))); got != tt.expected {
+			t.Errorf("coalescePayloads(%s, %s) = %s, want %s", tt.older, tt.newer, got, tt.expected)
+		}
+	}
+}
+
+func TestPublishThrottleCoalesces(t *testing.T) {
+	recorder := &publishRecorder{}
+	throttle := newPublishThrottle(recorder, []ThrottleRule{{Pattern: "zigbee2mqtt/+/set", Interval: 50 * time.Millisecond}})
+
+	opts := mqtt.PublishOptions{QoS: mqtt.DefaultQoS}
+	throttle.Publish("zigbee2mqtt/lamp/set", []byte(`{"state":"ON"}`), opts)
+	throttle.Publish("zigbee2mqtt/lamp/set", []byte(`{"brightness":100}`), opts)
+	throttle.Publish("zigbee2mqtt/lamp/set", []byte(`{"brightness":200}`), mqtt.PublishOptions{QoS: 2, Retain: true})
+	throttle.Publish("zigbee2mqtt/other/set", []byte(`{"state":"OFF"}`), opts)
+	throttle.Publish("zigbee2mqtt/lamp", []byte("unthrottled"), opts)
+
+	if got := len(recorder.snapshot()); got != 3 {
+		t.Fatalf("published %d messages immediately, want 3", got)
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	messages := recorder.snapshot()
+	if len(messages) != 4 {
+		t.Fatalf("published %d messages, want 4: %+v", len(messages), messages)
+	}
+	last := messages[3]
+	if last.Topic != "zigbee2mqtt/lamp/set" || last.Payload != `{"brightness":200}` || last.QoS != 2 || !last.Retain {
+		t.Errorf("trailing publish = %+v, want merged brightness 200 with the newest options", last)
+	}
+}
@@ -0,0 +1,440 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	starlarktime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// timeModule is ctx.time. Times are in the engine's local time zone (TZ)
+// unless converted, and durations are starlark-go's time.duration.
+func (c *Context) timeModule() *starlarkstruct.Struct {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"now":            starlark.NewBuiltin("time.now", c.timeNow),
+		"parse":          starlark.NewBuiltin("time.parse", timeParse),
+		"from_timestamp": starlark.NewBuiltin("time.from_timestamp", timeFromTimestamp),
+		"time":           starlark.NewBuiltin("time.time", timeMake),
+		"duration":       starlark.NewBuiltin("time.duration", timeDuration),
+		"between":        starlark.NewBuiltin("time.between", c.timeBetween),
+		"is_valid_tz":    starlark.NewBuiltin("time.is_valid_tz", timeIsValidTZ),
+		"second":         starlarktime.Duration(time.Second),
+		"minute":         starlarktime.Duration(time.Minute),
+		"hour":           starlarktime.Duration(time.Hour),
+		"day":            starlarktime.Duration(24 * time.Hour),
+	})
+}
+
+// starTime is a ctx.time value. It prints (and is stored by set_state and
+// json_encode) as RFC 3339, which ctx.time.parse reads back.
+type starTime time.Time
+
+var weekdayNames = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+func (t starTime) String() string       { return time.Time(t).Format(time.RFC3339) }
+func (t starTime) Type() string         { return "time" }
+func (t starTime) Freeze()              {}
+func (t starTime) Truth() starlark.Bool { return starlark.Bool(!time.Time(t).IsZero()) }
+
+func (t starTime) Hash() (uint32, error) {
+	n := time.Time(t).UnixNano()
+	return uint32(n) ^ uint32(n>>32), nil
+}
+
+func (t starTime) Attr(name string) (starlark.Value, error) {
+	tt := time.Time(t)
+	switch name {
+	case "year":
+		return starlark.MakeInt(tt.Year()), nil
+	case "month":
+		return starlark.MakeInt(int(tt.Month())), nil
+	case "day":
+		return starlark.MakeInt(tt.Day()), nil
+	case "hour":
+		return starlark.MakeInt(tt.Hour()), nil
+	case "minute":
+		return starlark.MakeInt(tt.Minute()), nil
+	case "second":
+		return starlark.MakeInt(tt.Second()), nil
+	case "weekday":
+		return starlark.MakeInt(weekday(tt)), nil
+	case "weekday_name":
+		return starlark.String(weekdayNames[weekday(tt)]), nil
+	case "yearday":
+		return starlark.MakeInt(tt.YearDay()), nil
+	case "unix":
+		return starlark.Float(float64(tt.UnixNano()) / 1e9), nil
+	case "tz":
+		return starlark.String(tt.Location().String()), nil
+	case "format":
+		return starlark.NewBuiltin("format", t.format), nil
+	case "in_tz":
+		return starlark.NewBuiltin("in_tz", t.inTZ), nil
+	case "replace":
+		return starlark.NewBuiltin("replace", t.replace), nil
+	}
+	return nil, nil
+}
+
+func (t starTime) AttrNames() []string {
+	return []string{"day", "format", "hour", "in_tz", "minute", "month", "replace", "second", "tz", "unix", "weekday", "weekday_name", "year", "yearday"}
+}
+
+func (t starTime) Cmp(y starlark.Value, depth int) (int, error) {
+	return time.Time(t).Compare(time.Time(y.(starTime))), nil
+}
+
+// Binary implements time + duration, time - duration and time - time
+func (t starTime) Binary(op syntax.Token, y starlark.Value, side starlark.Side) (starlark.Value, error) {
+	switch y := y.(type) {
+	case starlarktime.Duration:
+		switch {
+		case op == syntax.PLUS:
+			return starTime(time.Time(t).Add(time.Duration(y))), nil
+		case op == syntax.MINUS && side == starlark.Left:
+			return starTime(time.Time(t).Add(-time.Duration(y))), nil
+		}
+	case starTime:
+		if op == syntax.MINUS {
+			if side == starlark.Left {
+				return starlarktime.Duration(time.Time(t).Sub(time.Time(y))), nil
+			}
+			return starlarktime.Duration(time.Time(y).Sub(time.Time(t))), nil
+		}
+	}
+	return nil, nil
+}
+
+// weekday numbers days from Monday (0) to Sunday (6), as Python does
+func weekday(t time.Time) int {
+	return (int(t.Weekday()) + 6) % 7
+}
+
+func (t starTime) format(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var layout string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "format?", &layout); err != nil {
+		return nil, err
+	}
+	if layout == "" {
+		return starlark.String(t.String()), nil
+	}
+	s, err := strftime(time.Time(t), layout)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	return starlark.String(s), nil
+}
+
+func (t starTime) inTZ(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var tz string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "tz", &tz); err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unknown time zone %q", fn.Name(), tz)
+	}
+	return starTime(time.Time(t).In(loc)), nil
+}
+
+// replace returns the time with some fields changed, e.g. today at 07:00 is
+// now.replace(hour = 7, minute = 0, second = 0)
+func (t starTime) replace(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	tt := time.Time(t)
+	year, month, day, hour, minute, second := tt.Year(), int(tt.Month()), tt.Day(), tt.Hour(), tt.Minute(), tt.Second()
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "year?", &year, "month?", &month, "day?", &day, "hour?", &hour, "minute?", &minute, "second?", &second); err != nil {
+		return nil, err
+	}
+	result, err := makeTime(year, month, day, hour, minute, second, tt.Location())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	return result, nil
+}
+
+// timeNow implements ctx.time.now(tz=None); dry runs see the trigger time
+func (c *Context) timeNow(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var tz string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "tz?", &tz); err != nil {
+		return nil, err
+	}
+	loc, err := location(tz)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	return starTime(c.now().In(loc)), nil
+}
+
+// defaultParseLayouts are tried in order when ctx.time.parse gets no format
+var defaultParseLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	time.DateOnly,
+}
+
+// timeParse implements ctx.time.parse(text, format=None, tz=None). Without a
+// format it reads ISO 8601 dates and times. Text without an offset is in tz.
+func timeParse(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var text, format, tz string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "text", &text, "format?", &format, "tz?", &tz); err != nil {
+		return nil, err
+	}
+	loc, err := location(tz)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	if format != "" {
+		layout, err := strptimeLayout(format)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		t, err := time.ParseInLocation(layout, text, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q does not match %q", fn.Name(), text, format)
+		}
+		return starTime(t), nil
+	}
+	for _, layout := range defaultParseLayouts {
+		if t, err := time.ParseInLocation(layout, text, loc); err == nil {
+			return starTime(t), nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %q is not an ISO 8601 date or time; pass a format", fn.Name(), text)
+}
+
+// timeFromTimestamp implements ctx.time.from_timestamp(seconds), e.g. of ctx.now()
+func timeFromTimestamp(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var secondsVal starlark.Value
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "seconds", &secondsVal); err != nil {
+		return nil, err
+	}
+	seconds, ok := starlark.AsFloat(secondsVal)
+	if !ok {
+		return nil, fmt.Errorf("%s: seconds must be a number, got %s", fn.Name(), secondsVal.Type())
+	}
+	whole, frac := math.Modf(seconds)
+	return starTime(time.Unix(int64(whole), int64(frac*1e9)).In(time.Local)), nil
+}
+
+// timeMake implements ctx.time.time(year, month, day, hour=0, minute=0, second=0, tz=None)
+func timeMake(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var year, month, day, hour, minute, second int
+	var tz string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "year", &year, "month", &month, "day", &day, "hour?", &hour, "minute?", &minute, "second?", &second, "tz?", &tz); err != nil {
+		return nil, err
+	}
+	loc, err := location(tz)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	result, err := makeTime(year, month, day, hour, minute, second, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	return result, nil
+}
+
+// makeTime builds a time, rejecting out-of-range fields that time.Date
+// would silently roll over (February 30th)
+func makeTime(year, month, day, hour, minute, second int, loc *time.Location) (starTime, error) {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 || second < 0 || second > 59 {
+		return starTime{}, fmt.Errorf("invalid time of day %02d:%02d:%02d", hour, minute, second)
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, second, 0, loc)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day {
+		return starTime{}, fmt.Errorf("invalid date %04d-%02d-%02d", year, month, day)
+	}
+	return starTime(t), nil
+}
+
+// timeDuration implements ctx.time.duration(value): a Go duration string
+// ("1h30m") or a number of seconds
+func timeDuration(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var value starlark.Value
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "value", &value); err != nil {
+		return nil, err
+	}
+	if s, ok := value.(starlark.String); ok {
+		d, err := time.ParseDuration(string(s))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid duration %q (e.g. \"90s\", \"1h30m\")", fn.Name(), string(s))
+		}
+		return starlarktime.Duration(d), nil
+	}
+	seconds, ok := starlark.AsFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("%s: want a duration string or seconds, got %s", fn.Name(), value.Type())
+	}
+	return starlarktime.Duration(seconds * float64(time.Second)), nil
+}
+
+// timeBetween implements ctx.time.between(start, end, at=None): whether the
+// time of day of at (default now) is in [start, end). Windows that end before
+// they start span midnight, so between("22:00", "06:00") covers the night.
+func (c *Context) timeBetween(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var start, end string
+	var at starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "start", &start, "end", &end, "at?", &at); err != nil {
+		return nil, err
+	}
+	from, err := parseClock(start)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	to, err := parseClock(end)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	t := c.now().In(time.Local)
+	switch at := at.(type) {
+	case starlark.NoneType:
+	case starTime:
+		t = time.Time(at)
+	default:
+		return nil, fmt.Errorf("%s: at must be a time, got %s", fn.Name(), at.Type())
+	}
+
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if from <= to {
+		return starlark.Bool(now >= from && now < to), nil
+	}
+	return starlark.Bool(now >= from || now < to), nil
+}
+
+// parseClock parses a 24-hour "HH:MM" or "HH:MM:SS" time of day
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time of day %q (want \"HH:MM\")", s)
+	}
+	limits := []int{23, 59, 59}
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || n > limits[i] || len(part) > 2 {
+			return 0, fmt.Errorf("invalid time of day %q (want \"HH:MM\")", s)
+		}
+		d += time.Duration(n) * units[i]
+	}
+	return d, nil
+}
+
+func timeIsValidTZ(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var tz string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "tz", &tz); err != nil {
+		return nil, err
+	}
+	_, err := time.LoadLocation(tz)
+	return starlark.Bool(tz != "" && err == nil), nil
+}
+
+// location resolves a time zone name; empty means the engine's local zone
+func location(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", tz)
+	}
+	return loc, nil
+}
+
+// strftime formats t with Python-style directives
+func strftime(t time.Time, format string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		if i++; i == len(format) {
+			return "", errors.New("format ends with a lone %")
+		}
+		switch format[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'y':
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&b, "%02d", (t.Hour()+11)%12+1)
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'p':
+			b.WriteString(t.Format("PM"))
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case 'A':
+			b.WriteString(t.Format("Monday"))
+		case 'b':
+			b.WriteString(t.Format("Jan"))
+		case 'B':
+			b.WriteString(t.Format("January"))
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'z':
+			b.WriteString(t.Format("-0700"))
+		case 'Z':
+			b.WriteString(t.Format("MST"))
+		case '%':
+			b.WriteByte('%')
+		default:
+			return "", fmt.Errorf("unsupported directive %%%c", format[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// strptimeLayouts maps the directives strftime supports to Go layout elements
+var strptimeLayouts = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'H': "15", 'I': "03", 'M': "04", 'S': "05",
+	'p': "PM", 'a': "Mon", 'A': "Monday", 'b': "Jan", 'B': "January", 'j': "002", 'z': "-0700", 'Z': "MST",
+}
+
+// strptimeLayout turns a strftime format into a Go layout for parsing.
+// Literal digits would be read as layout elements, so they are rejected.
+func strptimeLayout(format string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		ch := format[i]
+		if ch != '%' {
+			if ch >= '0' && ch <= '9' {
+				return "", fmt.Errorf("format %q: literal digits are not supported", format)
+			}
+			b.WriteByte(ch)
+			continue
+		}
+		if i++; i == len(format) {
+			return "", errors.New("format ends with a lone %")
+		}
+		if format[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		layout, ok := strptimeLayouts[format[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported directive %%%c", format[i])
+		}
+		b.WriteString(layout)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// runTimeScript calls run(ctx) with the context's clock pinned to now
+func runTimeScript(t *testing.T, now time.Time, src string) (starlark.Value, error) {
+	t.Helper()
+	ctx := NewContext("clock", nil, nil, func(string, string, string) {}, nil, nil)
+	ctx.clock = func() time.Time { return now }
+	globals, err := starlark.ExecFile(&starlark.Thread{Name: "test"}, "test.star", src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return starlark.Call(&starlark.Thread{Name: "test"}, globals["run"], starlark.Tuple{ctx.ToStarlark(Trigger{Time: now})}, nil)
+}
+
+func TestTimeModule(t *testing.T) {
+	utc := time.Date(2026, 3, 14, 23, 30, 5, 0, time.UTC) // A Saturday
+	result, err := runTimeScript(t, utc, `
+def run(ctx):
+    now = ctx.time.now(tz = "UTC")
+    paris = now.in_tz("Europe/Paris")
+    later = now + ctx.time.duration("1h30m")
+    parsed = ctx.time.parse("14/03/2026 07:15", format = "%d/%m/%Y %H:%M", tz = "UTC")
+    return [
+        now.weekday, now.weekday_name, paris.hour, paris.day, paris.format("%a %d %b %H:%M"),
+        later.format("%Y-%m-%d %H:%M"), (later - now).minutes, later > now,
+        str(ctx.time.parse("2026-03-14T23:30:05Z")), (now - parsed) // ctx.time.hour,
+        now.replace(hour = 7, minute = 0, second = 0).format("%I:%M %p"),
+        ctx.time.from_timestamp(ctx.now()) == now, ctx.time.time(2026, 2, 28, tz = "UTC").yearday,
+        ctx.time.between("22:00", "06:00", at = now), ctx.time.between("06:00", "22:00", at = now),
+        ctx.time.between("08:00", "23:00", at = paris), ctx.time.is_valid_tz("Mars/Olympus"),
+    ]
+`)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	want := `[5, "saturday", 0, 15, "Sun 15 Mar 00:30", "2026-03-15 01:00", 90.0, True, "2026-03-14T23:30:05Z", 16, "07:00 AM", True, 59, True, False, False, False]`
+	if result.String() != want {
+		t.Errorf("result =\n%s\nwant\n%s", result, want)
+	}
+}
+
+func TestTimeModule_Errors(t *testing.T) {
+	for _, expr := range []string{
+		`ctx.time.time(2026, 2, 30)`,
+		`ctx.time.parse("yesterday")`,
+		`ctx.time.parse("2026-03-14", format = "%Y-%m-%d 2pm")`,
+		`ctx.time.now().format("%Q")`,
+		`ctx.time.now(tz = "Mars/Olympus")`,
+		`ctx.time.between("25:00", "06:00")`,
+		`ctx.time.duration("soon")`,
+	} {
+		if _, err := runTimeScript(t, time.Now(), "def run(ctx):\n    return "+expr+"\n"); err == nil {
+			t.Errorf("%s succeeded, want an error", expr)
+		}
+	}
+}
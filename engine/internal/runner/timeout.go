@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	defaultHandlerTimeout = time.Minute
+	maxHandlerTimeout     = time.Hour
+)
+
+var (
+	errHandlerTimeout = errors.New("timed out")
+	errRunCancelled   = errors.New("run cancelled")
+)
+
+const (
+	// threadLocalDeadline holds when a thread with an execution limit is cancelled
+	threadLocalDeadline = "homebrain.deadline"
+
+	// threadLocalContext holds a context that ends with the run: when it times
+	// out, its job is cancelled or its automation is unloaded
+	threadLocalContext = "homebrain.context"
+)
+
+// runContext returns the context of thread's run, which builtins that block
+// (ctx.sleep, ctx.publish_and_wait) wait on
+func runContext(thread *starlark.Thread) context.Context {
+	if ctx, ok := thread.Local(threadLocalContext).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// SetHandlerTimeout sets how long a handler may run before it is cancelled,
+// unless its config sets timeout_seconds. Zero disables the limit.
+func (r *Runner) SetHandlerTimeout(timeout time.Duration) {
+	r.handlerTimeout = timeout
+}
+
+// timeoutFor returns the execution limit for an automation's handlers
+func (r *Runner) timeoutFor(config AutomationConfig) time.Duration {
+	if config.TimeoutSeconds > 0 {
+		return time.Duration(config.TimeoutSeconds * float64(time.Second))
+	}
+	return r.handlerTimeout
+}
+
+// cancelAfter cancels thread and its run context once timeout has passed.
+// Calling the returned func stops the timer and reports whether the thread
+// was cancelled.
+func cancelAfter(thread *starlark.Thread, timeout time.Duration) func() bool {
+	if timeout <= 0 {
+		return func() bool { return false }
+	}
+	thread.SetLocal(threadLocalDeadline, time.Now().Add(timeout))
+	ctx, cancel := context.WithCancel(runContext(thread))
+	thread.SetLocal(threadLocalContext, ctx)
+	var fired atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		fired.Store(true)
+		cancel()
+		thread.Cancel(fmt.Sprintf("timed out after %s", timeout))
+	})
+	return func() bool {
+		timer.Stop()
+		cancel()
+		return fired.Load()
+	}
+}
+
+// parseTimeout reads config["timeout_seconds"]
+func parseTimeout(v starlark.Value) (float64, error) {
+	seconds, ok := starlark.AsFloat(v)
+	if !ok || seconds <= 0 || seconds > maxHandlerTimeout.Seconds() {
+		return 0, fmt.Errorf("timeout_seconds must be a positive number of seconds, at most %d", int(maxHandlerTimeout.Seconds()))
+	}
+	return seconds, nil
+}
@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractConfig_TimeoutSeconds(t *testing.T) {
+	config, err := execConfig(t, `config = {"name": "Test", "timeout_seconds": 2.5}`)
+	if err != nil || config.TimeoutSeconds != 2.5 {
+		t.Errorf("TimeoutSeconds = %v, %v; want 2.5", config.TimeoutSeconds, err)
+	}
+
+	for _, bad := range []string{`0`, `-1`, `"10"`, `7200`} {
+		if _, err := execConfig(t, `config = {"name": "Bad", "timeout_seconds": `+bad+`}`); err == nil {
+			t.Errorf("timeout_seconds %s should be rejected", bad)
+		}
+	}
+}
+
+func TestTimeoutFor(t *testing.T) {
+	r := newTestRunner()
+	r.SetHandlerTimeout(30 * time.Second)
+	if got := r.timeoutFor(AutomationConfig{}); got != 30*time.Second {
+		t.Errorf("default timeout = %s, want 30s", got)
+	}
+	if got := r.timeoutFor(AutomationConfig{TimeoutSeconds: 0.5}); got != 500*time.Millisecond {
+		t.Errorf("config timeout = %s, want 500ms", got)
+	}
+}
+
+func TestHandlerTimeout_CancelsRunawayLoop(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "runaway", `
+config = {"name": "Runaway", "schedule": "@every 1m", "timeout_seconds": 0.05}
+
+def on_schedule(ctx):
+    total = 0
+    for i in range(1000000000000):
+        total += i
+    return total
+`)
+
+	done := make(chan RunRecord, 1)
+	go func() {
+		record, _ := r.RunManual("runaway", ManualTrigger{})
+		done <- record
+	}()
+
+	select {
+	case record := <-done:
+		if record.Error != "on_schedule timed out after 50ms" {
+			t.Errorf("Error = %q", record.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler was not cancelled")
+	}
+
+	logs := r.GetLogs()
+	if len(logs) != 1 || !strings.Contains(logs[0].Message, "ERROR: on_schedule timed out") {
+		t.Errorf("logs = %+v", logs)
+	}
+}
+
+func TestDryRun_Timeout(t *testing.T) {
+	r := newTestRunner()
+	r.SetHandlerTimeout(50 * time.Millisecond)
+	result, err := r.DryRun(DryRunRequest{Code: `
+def on_schedule(ctx):
+    for i in range(1000000000000):
+        pass
+
+config = {"name": "Runaway"}
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || result.Error != "on_schedule timed out after 50ms" {
+		t.Errorf("result = %+v", result)
+	}
+}
@@ -0,0 +1,216 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// maxTimerDelay keeps ctx.set_timer for short delays; use a schedule for longer ones
+const maxTimerDelay = 7 * 24 * time.Hour
+
+// timers holds the armed ctx.set_timer callbacks. Pending timers are also
+// kept in the state store and re-armed when their automation loads, so they
+// survive reloads and restarts.
+type timers struct {
+	mu      sync.Mutex
+	pending map[string]*time.Timer // Keyed by timerKey
+}
+
+// timerKey joins automation and timer ID with a byte neither can contain, so
+// nested automation IDs ("lighting/hallway") can't be mistaken for timers of
+// another automation
+func timerKey(automationID, id string) string {
+	return automationID + "\x00" + id
+}
+
+// setTimer (re)starts a timer: setting an ID that is already pending replaces
+// it. The callback runs at priority, the priority of the run that armed it.
+func (r *Runner) setTimer(automationID, id string, delay time.Duration, data json.RawMessage, priority string) error {
+	timer := state.Timer{AutomationID: automationID, ID: id, FireAt: time.Now().Add(delay), Data: data, Priority: priority}
+	if r.stateStore != nil {
+		if err := r.stateStore.SaveTimer(timer); err != nil {
+			return err
+		}
+	}
+	r.armTimer(timer)
+	return nil
+}
+
+// cancelTimer stops a pending timer and reports whether there was one
+func (r *Runner) cancelTimer(automationID, id string) (bool, error) {
+	key := timerKey(automationID, id)
+	r.timers.mu.Lock()
+	t, ok := r.timers.pending[key]
+	if ok {
+		t.Stop()
+		delete(r.timers.pending, key)
+	}
+	r.timers.mu.Unlock()
+
+	if r.stateStore != nil {
+		if err := r.stateStore.DeleteTimer(automationID, id); err != nil {
+			return ok, err
+		}
+	}
+	return ok, nil
+}
+
+// timerPending reports whether a timer is armed
+func (r *Runner) timerPending(automationID, id string) bool {
+	r.timers.mu.Lock()
+	defer r.timers.mu.Unlock()
+	_, ok := r.timers.pending[timerKey(automationID, id)]
+	return ok
+}
+
+func (r *Runner) armTimer(timer state.Timer) {
+	key := timerKey(timer.AutomationID, timer.ID)
+
+	r.timers.mu.Lock()
+	defer r.timers.mu.Unlock()
+	if r.timers.pending == nil {
+		r.timers.pending = make(map[string]*time.Timer)
+	}
+	if existing, ok := r.timers.pending[key]; ok {
+		existing.Stop()
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(time.Until(timer.FireAt), func() {
+		r.timers.mu.Lock()
+		current := r.timers.pending[key] == t
+		if current {
+			delete(r.timers.pending, key)
+		}
+		r.timers.mu.Unlock()
+		// A replaced or cancelled timer may already be running
+		if current {
+			r.fireTimer(timer)
+		}
+	})
+	r.timers.pending[key] = t
+}
+
+// fireTimer removes the persisted timer and queues on_timer on the pool of the
+// run that armed it, or the automation's own if that is higher
+func (r *Runner) fireTimer(timer state.Timer) {
+	if r.stateStore != nil {
+		if err := r.stateStore.DeleteTimer(timer.AutomationID, timer.ID); err != nil {
+			slog.Error("Failed to delete fired timer", "automation", timer.AutomationID, "timer", timer.ID, "error", err)
+		}
+	}
+
+	automation, err := r.lookup(timer.AutomationID)
+	if err != nil {
+		return
+	}
+	if automation.onTimer == nil {
+		r.addLog(automation.ID, LogLevelError, fmt.Sprintf("ERROR: timer %s fired but the automation has no on_timer handler", timer.ID))
+		return
+	}
+
+	var data any
+	if len(timer.Data) > 0 {
+		json.Unmarshal(timer.Data, &data)
+	}
+	priority := higherPriority(timer.Priority, automation.Config.Priority)
+	trigger := Trigger{Type: TriggerTimer, Time: time.Now(), priority: priority}
+	r.dispatcher.submitSerial(automation.ID, priority, func() {
+		r.execute(automation, trigger, "on_timer", automation.onTimer, starlark.String(timer.ID), goToStarlark(data))
+	})
+}
+
+// restoreTimers re-arms an automation's persisted timers. Timers that came
+// due while the engine was down fire right away.
+func (r *Runner) restoreTimers(automationID string) {
+	if r.stateStore == nil {
+		return
+	}
+	pending, err := r.stateStore.ListTimers(automationID)
+	if err != nil {
+		slog.Error("Failed to restore timers", "automation", automationID, "error", err)
+		return
+	}
+	for _, timer := range pending {
+		r.armTimer(timer)
+	}
+}
+
+// stopTimers disarms an automation's timers without forgetting them
+func (r *Runner) stopTimers(automationID string) {
+	r.timers.mu.Lock()
+	defer r.timers.mu.Unlock()
+	for key, t := range r.timers.pending {
+		if owner, _, _ := strings.Cut(key, "\x00"); owner == automationID {
+			t.Stop()
+			delete(r.timers.pending, key)
+		}
+	}
+}
+
+// setTimerBuiltin implements ctx.set_timer(timer_id, delay, data=None): after
+// delay seconds on_timer(timer_id, data, ctx) runs. Setting a pending ID
+// restarts it.
+func (c *Context) setTimerBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var id string
+	var delayVal starlark.Value
+	var data starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "timer_id", &id, "delay", &delayVal, "data?", &data); err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, fmt.Errorf("%s: timer_id must not be empty", fn.Name())
+	}
+	seconds, ok := starlark.AsFloat(delayVal)
+	if !ok || seconds < 0 {
+		return nil, fmt.Errorf("%s: delay must be a non-negative number of seconds", fn.Name())
+	}
+	delay := time.Duration(seconds * float64(time.Second))
+	if delay > maxTimerDelay {
+		return nil, fmt.Errorf("%s: delay must be at most %s", fn.Name(), maxTimerDelay)
+	}
+
+	var encoded json.RawMessage
+	if data != starlark.None {
+		var buf bytes.Buffer
+		if err := encodeJSON(&buf, data, -1); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+		}
+		encoded = buf.Bytes()
+	}
+
+	if c.setTimer == nil {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	priority, _ := thread.Local(threadLocalPriority).(string)
+	if err := c.setTimer(id, delay, encoded, priority); err != nil {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: %s", fn.Name(), id, err))
+		return failed(thread, fn, errCodeStorage, id, err)
+	}
+	return starlark.True, nil
+}
+
+// cancelTimerBuiltin implements ctx.cancel_timer(timer_id); True if it was pending
+func (c *Context) cancelTimerBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var id string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "timer_id", &id); err != nil {
+		return nil, err
+	}
+	if c.cancelTimer == nil {
+		return nil, fmt.Errorf("%s: not available", fn.Name())
+	}
+	cancelled, err := c.cancelTimer(id)
+	if err != nil {
+		c.logFunc(c.automationID, LogLevelError, fmt.Sprintf("ERROR: %s %s: %s", fn.Name(), id, err))
+	}
+	return starlark.Bool(cancelled), nil
+}
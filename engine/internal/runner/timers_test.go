@@ -0,0 +1,161 @@
+package runner
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+// waitForRuns polls until an automation has recorded n runs
+func waitForRuns(t *testing.T, r *Runner, id string, n int) []RunRecord {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if runs := r.GetRuns(id); len(runs) >= n {
+			return runs
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d runs of %s, got %d", n, id, len(r.GetRuns(id)))
+	return nil
+}
+
+func TestTimers(t *testing.T) {
+	store, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	r := newTestRunner()
+	r.stateStore = store
+	a := addTestAutomation(t, r, "hallway", `
+config = {"name": "Hallway", "subscribe": ["motion"]}
+
+def on_message(topic, payload, ctx):
+    ctx.set_timer("lights_off", 0.02, {"room": "hallway", "level": 0})
+    ctx.set_timer("fan_off", 0.02)
+    return ctx.cancel_timer("fan_off")
+
+def on_timer(timer_id, data, ctx):
+    return [timer_id, data]
+`)
+	a.onTimer, _ = a.globals["on_timer"].(starlark.Callable)
+	a.context.setTimer = func(id string, delay time.Duration, data json.RawMessage, priority string) error {
+		return r.setTimer("hallway", id, delay, data, priority)
+	}
+	a.context.cancelTimer = func(id string) (bool, error) { return r.cancelTimer("hallway", id) }
+
+	record, err := r.handleMessage(a, Trigger{Type: TriggerMQTT, Time: time.Now()}, nil)
+	if err != nil || record.Result != true {
+		t.Fatalf("on_message = %v, %v; want cancel_timer to return True", record.Result, err)
+	}
+
+	runs := waitForRuns(t, r, "hallway", 2)
+	timerRun := runs[len(runs)-1]
+	if timerRun.Handler != "on_timer" || timerRun.Trigger.Type != TriggerTimer {
+		t.Fatalf("run = %+v, want an on_timer run", timerRun)
+	}
+	result, _ := timerRun.Result.([]any)
+	if len(result) != 2 || result[0] != "lights_off" || result[1].(map[string]any)["room"] != "hallway" {
+		t.Errorf("on_timer result = %v", timerRun.Result)
+	}
+	if pending, _ := store.ListTimers("hallway"); len(pending) != 0 {
+		t.Errorf("fired and cancelled timers still persisted: %+v", pending)
+	}
+
+	// A timer that came due while the engine was down fires on restore
+	store.SaveTimer(state.Timer{AutomationID: "hallway", ID: "missed", FireAt: time.Now().Add(-time.Minute)})
+	r.restoreTimers("hallway")
+	runs = waitForRuns(t, r, "hallway", 3)
+	if result, _ := runs[len(runs)-1].Result.([]any); len(result) != 2 || result[0] != "missed" || result[1] != nil {
+		t.Errorf("restored timer result = %v", runs[len(runs)-1].Result)
+	}
+
+	// Unloading disarms timers but keeps them for the next load. A nested
+	// automation under hallway/ keeps its own.
+	if err := r.setTimer("hallway", "later", time.Hour, nil, PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.setTimer("hallway/stairs", "later", time.Hour, nil, PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+	r.stopTimers("hallway")
+	if len(r.timers.pending) != 1 || !r.timerPending("hallway/stairs", "later") {
+		t.Errorf("pending after stop = %v, want only hallway/stairs", r.timers.pending)
+	}
+	if pending, _ := store.ListTimers("hallway"); len(pending) != 1 || pending[0].ID != "later" {
+		t.Errorf("persisted = %+v, want the later timer", pending)
+	}
+}
+
+func TestDryRun_RecordsTimers(t *testing.T) {
+	r := newTestRunner()
+	result, err := r.DryRun(DryRunRequest{
+		AutomationID: "hallway",
+		Code: `
+def on_message(topic, payload, ctx):
+    ctx.set_timer("lights_off", 300, {"room": "hallway"})
+
+config = {"name": "Hallway", "subscribe": ["motion"]}
+`,
+		Trigger: Trigger{Type: TriggerMQTT, Topic: "motion"},
+	})
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	if !result.Success || len(result.Timers) != 1 {
+		t.Fatalf("result = %+v, want one recorded timer", result)
+	}
+	if timer := result.Timers[0]; timer.ID != "lights_off" || timer.Seconds != 300 || string(timer.Data) != `{"room":"hallway"}` {
+		t.Errorf("timer = %+v", timer)
+	}
+}
+
+func TestTimers_InheritPriority(t *testing.T) {
+	r := newTestRunner()
+	alarm := addTestAutomation(t, r, "alarm", `
+config = {"name": "Alarm", "subscribe": ["door/open"], "priority": "high"}
+
+def on_message(topic, payload, ctx):
+    return ctx.call("siren", payload = "armed")
+`)
+	alarm.context.call = r.callAutomation
+
+	siren := addTestAutomation(t, r, "siren", `
+config = {"name": "Siren", "subscribe": ["siren/test"]}
+
+def on_message(topic, payload, ctx):
+    return ctx.set_timer("stop", 0.01)
+
+def on_timer(timer_id, data, ctx):
+    return timer_id
+`)
+	siren.onTimer, _ = siren.globals["on_timer"].(starlark.Callable)
+	siren.context.setTimer = func(id string, delay time.Duration, data json.RawMessage, priority string) error {
+		return r.setTimer("siren", id, delay, data, priority)
+	}
+
+	// Armed directly, the timer runs at the siren's own priority
+	if _, err := r.handleMessage(siren, Trigger{Type: TriggerMQTT, Time: time.Now()}, nil); err != nil {
+		t.Fatal(err)
+	}
+	runs := waitForRuns(t, r, "siren", 2)
+	if p := runs[len(runs)-1].Trigger.priority; p != PriorityNormal {
+		t.Errorf("direct timer priority = %q, want normal", p)
+	}
+
+	// Armed during a call from the high-priority alarm, it inherits high priority
+	if record, err := r.handleMessage(alarm, Trigger{Type: TriggerMQTT, Time: time.Now()}, nil); err != nil || record.Result != true {
+		t.Fatalf("alarm run = %+v, %v", record, err)
+	}
+	runs = waitForRuns(t, r, "siren", 4)
+	if last := runs[len(runs)-1]; last.Handler != "on_timer" || last.Trigger.priority != PriorityHigh {
+		t.Errorf("inherited timer run = %s at %q, want on_timer at high", last.Handler, last.Trigger.priority)
+	}
+}
@@ -0,0 +1,201 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Trigger types exposed as ctx.trigger.type
+const (
+	TriggerMQTT     = "mqtt"
+	TriggerSchedule = "schedule"
+	TriggerTimer    = "timer"
+	TriggerWebhook  = "webhook"
+	TriggerManual   = "manual"
+	TriggerCall     = "call"
+	TriggerJob      = "job"
+	TriggerState    = "state_change"
+	TriggerPresence = "presence"
+)
+
+const (
+	// maxCallDepth bounds nested ctx.call chains (A calls B calls C ...)
+	maxCallDepth = 8
+
+	// threadLocalCallDepth holds how many ctx.call hops led to the current run
+	threadLocalCallDepth = "homebrain.call_depth"
+)
+
+var (
+	// ErrAutomationNotFound is returned for operations on unknown automation IDs
+	ErrAutomationNotFound = errors.New("automation not found")
+
+	// ErrQueueFull is returned when a run can't be queued because the
+	// automation's queue or the worker pool is full
+	ErrQueueFull = errors.New("queue full")
+
+	errBudgetExhausted = errors.New("daily run budget exhausted")
+	errInactiveProfile = errors.New("automation is not active in the current profile")
+	errNoHandler       = errors.New("automation has no handler for this trigger")
+)
+
+// Trigger describes what caused a handler run
+type Trigger struct {
+	Type      string            `json:"type"`
+	Topic     string            `json:"topic,omitempty"`
+	Schedule  string            `json:"schedule,omitempty"`
+	Token     string            `json:"token,omitempty"`   // Name of the API token behind a manual run
+	Caller    string            `json:"caller,omitempty"`  // Automation that invoked this run via ctx.call, or wrote the watched key
+	Key       string            `json:"key,omitempty"`     // Global key whose change triggered on_state_change
+	Webhook   string            `json:"webhook,omitempty"` // Hook name behind an on_webhook run
+	Service   string            `json:"service,omitempty"` // Service called via ctx.call
+	Person    string            `json:"person,omitempty"`  // Person whose arrival or departure ran on_presence_change
+	Headers   map[string]string `json:"headers,omitempty"` // Webhook request headers, lowercased
+	Time      time.Time         `json:"time"`
+	depth     int               // Chained publish→trigger hops (loop detection)
+	callDepth int               // Nested ctx.call hops
+	priority  string            // Inherited priority (ctx.call caller, timer); empty uses the automation's
+	chain     *runChain         // Run chain of the ctx.call caller; nil starts a new one
+	payload   string            // Message payload, kept for replay bundles
+	json      *payloadJSON      // Payload decoded once per message, shared across automations
+}
+
+// toStarlark converts the trigger to the ctx.trigger struct
+func (t Trigger) toStarlark() *starlarkstruct.Struct {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"type":     starlark.String(t.Type),
+		"topic":    starlark.String(t.Topic),
+		"schedule": starlark.String(t.Schedule),
+		"token":    starlark.String(t.Token),
+		"caller":   starlark.String(t.Caller),
+		"key":      starlark.String(t.Key),
+		"webhook":  starlark.String(t.Webhook),
+		"service":  starlark.String(t.Service),
+		"person":   starlark.String(t.Person),
+		"time":     starlark.Float(float64(t.Time.UnixMilli()) / 1000),
+	})
+}
+
+// payloadJSON backs ctx.payload_json(): the triggering payload decoded as JSON
+// (None if it isn't JSON). The decode is shared between all automations that
+// received the message; each call returns a fresh, mutable value.
+func (t Trigger) payloadJSON(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	if t.json == nil {
+		return starlark.None, nil
+	}
+	value, ok := t.json.get()
+	if !ok {
+		return starlark.None, nil
+	}
+	return goToStarlark(value), nil
+}
+
+// ManualTrigger is a request to run an automation on demand. With a topic or
+// payload it calls on_message, otherwise on_schedule.
+type ManualTrigger struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+	Token   string `json:"-"`
+}
+
+// RunManual runs an automation on its priority's worker pool, after any of its
+// handlers already queued or running, and waits for the handler to finish. The returned record carries the handler's
+// return value.
+func (r *Runner) RunManual(id string, req ManualTrigger) (RunRecord, error) {
+	return r.RunManualContext(context.Background(), id, req)
+}
+
+// RunManualContext is RunManual, but stops waiting when ctx is done. The run
+// still happens once queued. It fails with ErrQueueFull if the run can't be
+// queued.
+func (r *Runner) RunManualContext(ctx context.Context, id string, req ManualTrigger) (RunRecord, error) {
+	automation, err := r.lookup(id)
+	if err != nil {
+		return RunRecord{}, err
+	}
+
+	trigger := Trigger{Type: TriggerManual, Topic: req.Topic, Token: req.Token, Time: time.Now()}
+	useMessage := req.Topic != "" || req.Payload != ""
+
+	type outcome struct {
+		record RunRecord
+		err    error
+	}
+	done := make(chan outcome, 1)
+	queued := r.dispatcher.submitSerial(automation.ID, automation.Config.Priority, func() {
+		record, err := r.invoke(automation, trigger, []byte(req.Payload), useMessage)
+		done <- outcome{record, err}
+	})
+	if !queued {
+		return RunRecord{}, fmt.Errorf("%w: %s", ErrQueueFull, automation.ID)
+	}
+	select {
+	case result := <-done:
+		return result.record, result.err
+	case <-ctx.Done():
+		return RunRecord{}, ctx.Err()
+	}
+}
+
+// callAutomation backs ctx.call: it runs the target synchronously on the
+// caller's worker (queueing could deadlock a saturated pool) and returns the
+// target handler's result
+func (r *Runner) callAutomation(thread *starlark.Thread, caller, id, topic, payload string) (any, error) {
+	depth, _ := thread.Local(threadLocalCallDepth).(int)
+	if depth >= maxCallDepth {
+		return nil, fmt.Errorf("call depth limit (%d) exceeded", maxCallDepth)
+	}
+
+	automation, err := r.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	if !automation.Config.Enabled {
+		return nil, fmt.Errorf("automation %s is disabled", id)
+	}
+
+	priority, _ := thread.Local(threadLocalPriority).(string)
+	chain, _ := thread.Local(threadLocalRunChain).(*runChain)
+	trigger := Trigger{
+		Type:      TriggerCall,
+		Topic:     topic,
+		Caller:    caller,
+		Time:      time.Now(),
+		depth:     loopDepth(thread),
+		callDepth: depth + 1,
+		priority:  priority,
+		chain:     chain,
+	}
+	record, err := r.invoke(automation, trigger, []byte(payload), topic != "" || payload != "")
+	if err != nil {
+		return nil, err
+	}
+	return record.Result, nil
+}
+
+// invoke calls on_message when preferMessage is set (or on_schedule is
+// missing), otherwise on_schedule
+func (r *Runner) invoke(automation *Automation, trigger Trigger, payload []byte, preferMessage bool) (RunRecord, error) {
+	if automation.onMessage != nil && (preferMessage || automation.onSchedule == nil) {
+		return r.handleMessage(automation, trigger, payload)
+	}
+	return r.handleSchedule(automation, trigger)
+}
+
+func (r *Runner) lookup(id string) (*Automation, error) {
+	r.mu.RLock()
+	automation, ok := r.automations[id]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAutomationNotFound, id)
+	}
+	return automation, nil
+}
@@ -0,0 +1,283 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// newTestRunner returns a Runner without MQTT or state store, for exercising
+// handler execution paths
+func newTestRunner() *Runner {
+	return &Runner{
+		automations: make(map[string]*Automation),
+		dispatcher:  newDispatcher(2, 1),
+		audit:       newAudit(),
+		loops:       newLoopDetector(),
+		maxLogs:     100,
+		maxRuns:     100,
+		maxReplays:  10,
+	}
+}
+
+// addTestAutomation executes source and registers it as a loaded automation
+func addTestAutomation(t *testing.T, r *Runner, id, src string) *Automation {
+	t.Helper()
+	thread := &starlark.Thread{Name: id}
+	globals, err := starlark.ExecFile(thread, id+".star", src, nil)
+	if err != nil {
+		t.Fatalf("failed to execute %s: %v", id, err)
+	}
+	config, err := extractConfig(globals["config"])
+	if err != nil {
+		t.Fatalf("invalid config in %s: %v", id, err)
+	}
+
+	a := &Automation{ID: id, Config: config, globals: globals, doc: moduleDocstring(id+".star", []byte(src)), source: src}
+	a.onMessage, _ = globals["on_message"].(starlark.Callable)
+	a.onSchedule, _ = globals["on_schedule"].(starlark.Callable)
+	a.context = NewContext(id, nil, nil, r.addLog, config.GlobalStateWrites, nil)
+	a.context.audit = r.audit
+	a.context.loops = r.loops
+	a.context.call = r.callAutomation
+
+	r.mu.Lock()
+	r.automations[id] = a
+	r.mu.Unlock()
+	return a
+}
+
+func TestRunManual_ExposesTriggerMetadata(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "probe", `
+def on_message(topic, payload, ctx):
+    ctx.log("%s %s %s" % (ctx.trigger.type, ctx.trigger.topic, payload))
+
+def on_schedule(ctx):
+    ctx.log("%s %s" % (ctx.trigger.type, ctx.trigger.token))
+
+config = {"name": "Probe"}
+`)
+
+	if _, err := r.RunManual("probe", ManualTrigger{Token: "admin"}); err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	if _, err := r.RunManual("probe", ManualTrigger{Topic: "test/topic", Payload: "42"}); err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+
+	logs := r.GetLogs()
+	if len(logs) != 2 {
+		t.Fatalf("got %d log entries, want 2", len(logs))
+	}
+	if logs[0].Message != "manual admin" {
+		t.Errorf("schedule run logged %q, want %q", logs[0].Message, "manual admin")
+	}
+	if logs[1].Message != "manual test/topic 42" {
+		t.Errorf("message run logged %q, want %q", logs[1].Message, "manual test/topic 42")
+	}
+}
+
+func TestRunManual_UnknownAutomation(t *testing.T) {
+	r := newTestRunner()
+	if _, err := r.RunManual("missing", ManualTrigger{}); !errors.Is(err, ErrAutomationNotFound) {
+		t.Errorf("RunManual error = %v, want ErrAutomationNotFound", err)
+	}
+}
+
+func TestRunManual_QueueFullAndCancelled(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "probe", `
+def on_schedule(ctx):
+    return "ran"
+
+config = {"name": "Probe"}
+`)
+
+	// Hold the automation's queue with a running job
+	started := make(chan struct{})
+	release := make(chan struct{})
+	r.dispatcher.submitSerial("probe", PriorityNormal, func() {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.RunManualContext(ctx, "probe", ManualTrigger{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunManualContext error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The cancelled run is still queued; fill the rest of the queue
+	for i := 1; i < dispatchQueueSize; i++ {
+		if !r.dispatcher.submitSerial("probe", PriorityNormal, func() {}) {
+			t.Fatalf("job %d was dropped", i)
+		}
+	}
+	if _, err := r.RunManual("probe", ManualTrigger{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("RunManual error = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestRunManual_HandlerErrorIsReturned(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "broken", `
+def on_schedule(ctx):
+    fail("boom")
+
+config = {"name": "Broken"}
+`)
+	run, err := r.RunManual("broken", ManualTrigger{})
+	if err == nil {
+		t.Fatal("expected handler error to be returned")
+	}
+	if run.Error == "" {
+		t.Error("expected error to be recorded in the run record")
+	}
+}
+
+func TestRunManual_ReturnsHandlerResult(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "plan", `
+def on_schedule(ctx):
+    return {"target": 21.5, "rooms": ["living", "office"]}
+
+config = {"name": "Heating Plan"}
+`)
+
+	run, err := r.RunManual("plan", ManualTrigger{})
+	if err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	result, ok := run.Result.(map[string]any)
+	if !ok {
+		t.Fatalf("result = %#v, want a dict", run.Result)
+	}
+	if result["target"] != 21.5 {
+		t.Errorf("target = %v, want 21.5", result["target"])
+	}
+	if runs := r.GetRuns("plan"); len(runs) != 1 || runs[0].Result == nil {
+		t.Errorf("expected one recorded run with a result, got %+v", runs)
+	}
+}
+
+func TestCall_PassesResultBetweenAutomations(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "plan", `
+def on_message(topic, payload, ctx):
+    return {"room": payload, "caller": ctx.trigger.caller, "type": ctx.trigger.type}
+
+config = {"name": "Heating Plan"}
+`)
+	addTestAutomation(t, r, "heating", `
+def on_schedule(ctx):
+    plan = ctx.call("plan", payload="office")
+    ctx.log("%s %s %s" % (plan["room"], plan["caller"], plan["type"]))
+    return plan["room"]
+
+config = {"name": "Heating"}
+`)
+
+	run, err := r.RunManual("heating", ManualTrigger{})
+	if err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	if run.Result != "office" {
+		t.Errorf("result = %v, want office", run.Result)
+	}
+	logs := r.GetLogs()
+	if len(logs) != 1 || logs[0].Message != "office heating call" {
+		t.Errorf("unexpected logs: %+v", logs)
+	}
+}
+
+func TestCall_DepthLimit(t *testing.T) {
+	r := newTestRunner()
+	for i := 0; i <= maxCallDepth; i++ {
+		addTestAutomation(t, r, fmt.Sprintf("step%d", i), fmt.Sprintf(`
+def on_schedule(ctx):
+    return ctx.call("step%d")
+
+config = {"name": "Step %d"}
+`, i+1, i))
+	}
+	_, err := r.RunManual("step0", ManualTrigger{})
+	if err == nil || !strings.Contains(err.Error(), "call depth limit") {
+		t.Errorf("error = %v, want the call depth limit", err)
+	}
+}
+
+func TestCall_Cycle(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "a", `
+def on_schedule(ctx):
+    return ctx.call("b")
+
+config = {"name": "A"}
+`)
+	addTestAutomation(t, r, "b", `
+def on_schedule(ctx):
+    return ctx.call("a")
+
+config = {"name": "B"}
+`)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.RunManual("a", ManualTrigger{})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errCallCycle) {
+			t.Errorf("error = %v, want a call cycle", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("A → B → A deadlocked")
+	}
+}
+
+func TestCall_WaitsForTargetsOwnRun(t *testing.T) {
+	r := newTestRunner()
+	addTestAutomation(t, r, "target", `
+def on_message(topic, payload, ctx):
+    return payload
+
+config = {"name": "Target"}
+`)
+	addTestAutomation(t, r, "caller", `
+def on_schedule(ctx):
+    return ctx.call("target", payload="x")
+
+config = {"name": "Caller"}
+`)
+
+	// Hold target's lock as its own queued run would
+	release, err := r.runLocks.acquire(context.Background(), &runChain{root: "target"}, "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		r.RunManual("caller", ManualTrigger{})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("ctx.call ran while the target was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ctx.call didn't run after the target finished")
+	}
+}
@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// SetPayloadLimit caps how many bytes of a log message, run result, run error
+// or expectation payload are kept in memory; longer ones are cut and marked.
+// Zero keeps everything.
+func (r *Runner) SetPayloadLimit(limit int) {
+	r.payloadLimit.Store(int64(limit))
+}
+
+// maxPayload returns the payload limit. SetPayloadLimit may run while
+// handlers are already logging.
+func (r *Runner) maxPayload() int {
+	return int(r.payloadLimit.Load())
+}
+
+// truncateText cuts s to at most limit bytes (on a rune boundary) and appends
+// a marker with the original size
+func truncateText(s string, limit int) string {
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s… [truncated, %d bytes]", s[:cut], len(s))
+}
+
+// limitRecord applies the payload limit to a run before it goes into the history
+func (r *Runner) limitRecord(record RunRecord) RunRecord {
+	limit := r.maxPayload()
+	if limit <= 0 {
+		return record
+	}
+	record.Error = truncateText(record.Error, limit)
+	if record.Result != nil {
+		if data, err := json.Marshal(record.Result); err == nil && len(data) > limit {
+			record.Result = truncateText(string(data), limit)
+		}
+	}
+	if len(record.Expectations) > 0 {
+		expectations := make([]ExpectationFailure, len(record.Expectations))
+		for i, failure := range record.Expectations {
+			failure.Payload = truncateText(failure.Payload, limit)
+			expectations[i] = failure
+		}
+		record.Expectations = expectations
+	}
+	return record
+}
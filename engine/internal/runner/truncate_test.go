@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		s     string
+		limit int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"a longer message", 8, "a longer… [truncated, 16 bytes]"},
+		{"grüße", 3, "gr… [truncated, 7 bytes]"},
+		{"unlimited", 0, "unlimited"},
+	}
+	for _, tt := range tests {
+		if got := truncateText(tt.s, tt.limit); got != tt.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", tt.s, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestPayloadLimit(t *testing.T) {
+	r := newTestRunner()
+	r.SetPayloadLimit(64)
+	addTestAutomation(t, r, "camera", `
+config = {"name": "Camera"}
+
+def on_schedule(ctx):
+    snapshot = "x" * 1000
+    ctx.log("snapshot " + snapshot)
+    return {"image": snapshot}
+`)
+
+	record, err := r.RunManual("camera", ManualTrigger{})
+	if err != nil {
+		t.Fatalf("RunManual failed: %v", err)
+	}
+	if result, ok := record.Result.(map[string]any); !ok || len(result["image"].(string)) != 1000 {
+		t.Errorf("the caller should get the whole result, got %v", record.Result)
+	}
+
+	runs := r.GetRuns("camera")
+	if result, ok := runs[0].Result.(string); !ok || !strings.HasSuffix(result, "… [truncated, 1012 bytes]") {
+		t.Errorf("stored result = %v, want a truncated string", runs[0].Result)
+	}
+	logs := r.GetLogs()
+	if msg := logs[0].Message; !strings.HasPrefix(msg, "snapshot xxx") || !strings.HasSuffix(msg, "… [truncated, 1009 bytes]") || len(msg) > 100 {
+		t.Errorf("log message = %q", msg)
+	}
+}
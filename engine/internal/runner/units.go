@@ -0,0 +1,155 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// unit converts to its dimension's base unit: base = value*factor + offset
+type unit struct {
+	dimension string
+	factor    float64
+	offset    float64
+}
+
+// units are keyed by lowercase name, except that an SI prefix keeps its case
+// ("Mwh"); "°" is stripped before lookup. Bases are °C, Wh, W and Pa.
+var units = map[string]unit{
+	"c": {"temperature", 1, 0},
+	"f": {"temperature", 5.0 / 9, -32 * 5.0 / 9},
+	"k": {"temperature", 1, -273.15},
+
+	"wh":  {"energy", 1, 0},
+	"kwh": {"energy", 1e3, 0},
+	"Mwh": {"energy", 1e6, 0},
+
+	"w":  {"power", 1, 0},
+	"kw": {"power", 1e3, 0},
+
+	"pa":   {"pressure", 1, 0},
+	"hpa":  {"pressure", 100, 0},
+	"kpa":  {"pressure", 1e3, 0},
+	"mbar": {"pressure", 100, 0},
+	"bar":  {"pressure", 1e5, 0},
+	"psi":  {"pressure", 6894.757293168, 0},
+	"mmhg": {"pressure", 133.322387415, 0},
+	"inhg": {"pressure", 3386.389, 0},
+}
+
+// siPrefixed are the lowercase base units that take an SI prefix. The prefix
+// is case-sensitive, since "MWh" and "mWh" differ by a factor of 10⁹.
+var siPrefixed = map[string]bool{"wh": true, "w": true, "pa": true, "bar": true}
+
+func lookupUnit(name string) (unit, bool) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "°")
+	key := strings.ToLower(name)
+	if len(key) > 1 && siPrefixed[key[1:]] {
+		key = name[:1] + key[1:]
+	}
+	u, ok := units[key]
+	return u, ok
+}
+
+// convertUnit converts value between two units of the same dimension
+func convertUnit(value float64, from, to string) (float64, error) {
+	fromUnit, ok := lookupUnit(from)
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	toUnit, ok := lookupUnit(to)
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	if fromUnit.dimension != toUnit.dimension {
+		return 0, fmt.Errorf("cannot convert %s (%s) to %s (%s)", from, fromUnit.dimension, to, toUnit.dimension)
+	}
+	return (value*fromUnit.factor + fromUnit.offset - toUnit.offset) / toUnit.factor, nil
+}
+
+// numberPattern finds the first number in a device value, with "." or ","
+// as the decimal separator
+var numberPattern = regexp.MustCompile(`[-+]?(?:\d+(?:[.,]\d+)*|[.,]\d+)(?:[eE][-+]?\d+)?`)
+
+// parseNumber returns the first number in s and the text after it, which is
+// usually a unit. A single comma is a decimal separator ("21,5"); commas next
+// to a decimal point, or several of them, separate thousands.
+func parseNumber(s string) (float64, string, bool) {
+	loc := numberPattern.FindStringIndex(s)
+	if loc == nil {
+		return 0, "", false
+	}
+	text := s[loc[0]:loc[1]]
+	if strings.Contains(text, ".") || strings.Count(text, ",") > 1 {
+		text = strings.ReplaceAll(text, ",", "")
+	} else {
+		text = strings.Replace(text, ",", ".", 1)
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return value, strings.TrimSpace(s[loc[1]:]), true
+}
+
+// parseNumberBuiltin implements ctx.parse_number(value, unit=None,
+// default=None). With unit, a unit after the number is converted to it and a
+// bare number is taken to be in it already. Values without a number, or with
+// a unit that doesn't convert, return default.
+func parseNumberBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var value starlark.Value
+	var target string
+	var fallback starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "value", &value, "unit?", &target, "default?", &fallback); err != nil {
+		return nil, err
+	}
+	if target != "" {
+		if _, ok := lookupUnit(target); !ok {
+			return nil, fmt.Errorf("%s: unknown unit %q", fn.Name(), target)
+		}
+	}
+
+	var number float64
+	var suffix string
+	switch v := value.(type) {
+	case starlark.Int, starlark.Float:
+		number, _ = starlark.AsFloat(v)
+	case starlark.String:
+		var ok bool
+		if number, suffix, ok = parseNumber(string(v)); !ok {
+			return fallback, nil
+		}
+	default:
+		return fallback, nil
+	}
+
+	if target != "" && suffix != "" {
+		converted, err := convertUnit(number, suffix, target)
+		if err != nil {
+			return fallback, nil
+		}
+		number = converted
+	}
+	return starlark.Float(number), nil
+}
+
+// convertBuiltin implements ctx.convert(value, from_unit, to_unit)
+func convertBuiltin(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var value starlark.Value
+	var from, to string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "value", &value, "from_unit", &from, "to_unit", &to); err != nil {
+		return nil, err
+	}
+	number, ok := starlark.AsFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("%s: value must be a number, got %s", fn.Name(), value.Type())
+	}
+	converted, err := convertUnit(number, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+	return starlark.Float(converted), nil
+}
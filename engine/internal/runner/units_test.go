@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestUnitBuiltins(t *testing.T) {
+	predeclared := starlark.StringDict{
+		"parse_number": starlark.NewBuiltin("parse_number", parseNumberBuiltin),
+		"convert":      starlark.NewBuiltin("convert", convertBuiltin),
+	}
+
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr string
+	}{
+		{`convert(1, "MWh", "kWh")`, "1000.0", ""},
+		{`convert(1, "kwh", "WH")`, "1000.0", ""},
+		{`convert(1, "mWh", "Wh")`, "", `unknown unit "mWh"`},
+		{`convert(1, "KW", "W")`, "", `unknown unit "KW"`},
+		{`convert(1, "°f", "k")`, "255.92777777777775", ""},
+		{`parse_number("21.5")`, "21.5", ""},
+		{`parse_number(" -3 ")`, "-3.0", ""},
+		{`parse_number(7)`, "7.0", ""},
+		{`parse_number("21,5 °C")`, "21.5", ""},
+		{`parse_number("1,234.5 W")`, "1234.5", ""},
+		{`parse_number("temp: 18.25C")`, "18.25", ""},
+		{`parse_number("unavailable")`, "None", ""},
+		{`parse_number(None, default=0)`, "0", ""},
+		{`parse_number("72F", unit="C")`, "22.22222222222222", ""},
+		{`parse_number("1.5 kWh", unit="Wh")`, "1500.0", ""},
+		{`parse_number("300", unit="K")`, "300.0", ""},
+		{`parse_number("87%", unit="C", default=-1)`, "-1", ""},
+		{`parse_number("1", unit="furlong")`, "", `unknown unit "furlong"`},
+		{`convert(0, "C", "F")`, "32.0", ""},
+		{`convert(1013.25, "hPa", "bar")`, "1.01325", ""},
+		{`convert(2500, "W", "kW")`, "2.5", ""},
+		{`convert(1, "kWh", "kW")`, "", "cannot convert kWh (energy) to kW (power)"},
+		{`convert("1", "W", "kW")`, "", "value must be a number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := starlark.Eval(&starlark.Thread{}, "test", tt.expr, predeclared)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
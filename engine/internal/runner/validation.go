@@ -10,19 +10,40 @@ import (
 // ValidationRequest represents a request to validate Starlark code
 type ValidationRequest struct {
 	Code string `json:"code"`
-	Type string `json:"type"` // "automation" or "library"
+	Type string `json:"type"` // "automation", "library" or "declarative"
+	Lint bool   `json:"lint"` // Also run homebrain lint rules (automations only)
 }
 
 // ValidationResult represents the result of code validation
 type ValidationResult struct {
-	Valid  bool     `json:"valid"`
-	Errors []string `json:"errors,omitempty"`
+	Valid    bool          `json:"valid"`
+	Errors   []string      `json:"errors,omitempty"`
+	Findings []LintFinding `json:"findings,omitempty"` // Lint findings when requested
 }
 
 // ValidateCode validates Starlark code without writing to disk
 // For automations: checks syntax, config, and handler functions
 // For libraries: checks syntax only
 func ValidateCode(code string, fileType string) ValidationResult {
+	return validateCode(code, fileType, nil)
+}
+
+// ValidateCodeIn validates code as if it were placed in dir, so names from the
+// directory's _common.star are defined
+func ValidateCodeIn(code, fileType, dir string) ValidationResult {
+	if fileType == "declarative" {
+		if instance, err := parseInstance([]byte(code)); err == nil && instance != nil {
+			return validateInstance(instance, dir)
+		}
+	}
+	common, err := LoadCommon(dir)
+	if err != nil {
+		return ValidationResult{Valid: false, Errors: []string{err.Error()}}
+	}
+	return validateCode(code, fileType, common)
+}
+
+func validateCode(code, fileType string, predeclared starlark.StringDict) ValidationResult {
 	// Check for empty code
 	if strings.TrimSpace(code) == "" {
 		return ValidationResult{
@@ -31,6 +52,18 @@ func ValidateCode(code string, fileType string) ValidationResult {
 		}
 	}
 
+	// Declarative YAML automations are validated as the Starlark they compile to
+	if fileType == "declarative" {
+		source, err := CompileDeclarative([]byte(code))
+		if err != nil {
+			return ValidationResult{
+				Valid:  false,
+				Errors: []string{err.Error()},
+			}
+		}
+		code = source
+	}
+
 	// Default to automation validation if type is unknown
 	if fileType != "library" {
 		fileType = "automation"
@@ -38,7 +71,7 @@ func ValidateCode(code string, fileType string) ValidationResult {
 
 	// Execute the Starlark code to check for syntax errors
 	thread := &starlark.Thread{Name: "validation"}
-	globals, err := starlark.ExecFile(thread, "validation.star", []byte(code), nil)
+	globals, err := starlark.ExecFile(thread, "validation.star", []byte(code), predeclared)
 	if err != nil {
 		return ValidationResult{
 			Valid:  false,
@@ -73,9 +106,6 @@ func validateAutomation(globals starlark.StringDict) ValidationResult {
 		return ValidationResult{Valid: false, Errors: errors}
 	}
 
-	// Note: We could validate config structure here using extractConfig
-	// but that would require exporting it. For now, we just check it's a dict.
-
 	// Check for handler functions
 	var hasOnMessage, hasOnSchedule bool
 
@@ -95,8 +125,62 @@ func validateAutomation(globals starlark.StringDict) ValidationResult {
 		}
 	}
 
-	if !hasOnMessage && !hasOnSchedule {
-		errors = append(errors, "automation must define on_message or on_schedule function")
+	if fn, ok := globals["on_timer"]; ok {
+		if _, isCallable := fn.(starlark.Callable); !isCallable {
+			errors = append(errors, "on_timer must be a callable function")
+		}
+	}
+
+	if fn, ok := globals["on_error"]; ok {
+		if _, isCallable := fn.(starlark.Callable); !isCallable {
+			errors = append(errors, "on_error must be a callable function")
+		}
+	}
+
+	var hasOnStateChange bool
+	if fn, ok := globals["on_state_change"]; ok {
+		if _, isCallable := fn.(starlark.Callable); isCallable {
+			hasOnStateChange = true
+		} else {
+			errors = append(errors, "on_state_change must be a callable function")
+		}
+	}
+
+	var hasOnPresenceChange bool
+	if fn, ok := globals["on_presence_change"]; ok {
+		if _, isCallable := fn.(starlark.Callable); isCallable {
+			hasOnPresenceChange = true
+		} else {
+			errors = append(errors, "on_presence_change must be a callable function")
+		}
+	}
+
+	var hasOnWebhook bool
+	if fn, ok := globals["on_webhook"]; ok {
+		if _, isCallable := fn.(starlark.Callable); isCallable {
+			hasOnWebhook = true
+		} else {
+			errors = append(errors, "on_webhook must be a callable function")
+		}
+	}
+
+	services, err := extractServices(globals)
+	if err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if !hasOnMessage && !hasOnSchedule && !hasOnStateChange && !hasOnPresenceChange && !hasOnWebhook && len(services) == 0 {
+		errors = append(errors, "automation must define on_message, on_schedule, on_state_change, on_presence_change or on_webhook function, or services")
+	}
+
+	if config, err := extractConfig(configVal); err != nil {
+		errors = append(errors, err.Error())
+	} else {
+		for _, spec := range config.ScheduleSpecs() {
+			if _, err := resolveRunnableSchedule(spec); err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
 	}
 
 	if len(errors) > 0 {
@@ -321,3 +321,32 @@ config = {
 		t.Errorf("Expected valid code with global_state_writes, got errors: %v", result.Errors)
 	}
 }
+
+func TestValidateCode_Schedule(t *testing.T) {
+	tests := []struct {
+		schedule string
+		valid    bool
+	}{
+		{"*/5 * * * *", true},
+		{"every weekday at 7:15", true},
+		{"every weekday at 25:15", false},
+		{"daily at sunset", true},
+		{"@sunset+30m", true},
+		{"@sunset+2 days", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			code := `
+def on_schedule(ctx):
+    pass
+
+config = {"name": "Scheduled", "schedule": "` + tt.schedule + `"}
+`
+			result := ValidateCode(code, "automation")
+			if result.Valid != tt.valid {
+				t.Errorf("Valid = %v, want %v (errors: %v)", result.Valid, tt.valid, result.Errors)
+			}
+		})
+	}
+}
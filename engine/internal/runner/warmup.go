@@ -0,0 +1,105 @@
+package runner
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// warmup holds back handler invocations right after startup, while retained
+// messages flood in, until traffic has been quiet for a while or a deadline
+// passes. In defer mode only the latest trigger per automation/topic is kept
+// and replayed once warm-up ends; otherwise handlers run immediately and can
+// check ctx.is_warmup().
+type warmup struct {
+	mu          sync.Mutex
+	active      bool
+	deferRuns   bool
+	quiet       time.Duration
+	deadline    time.Time
+	lastMessage time.Time
+	pending     map[string]func()
+	order       []string
+}
+
+// StartWarmup begins the warm-up phase. It ends after no subscribed message
+// has arrived for quiet, or after max at the latest.
+func (r *Runner) StartWarmup(quiet, max time.Duration, deferRuns bool) {
+	now := time.Now()
+	r.warmup.mu.Lock()
+	r.warmup.active = true
+	r.warmup.deferRuns = deferRuns
+	r.warmup.quiet = quiet
+	r.warmup.deadline = now.Add(max)
+	r.warmup.lastMessage = now
+	r.warmup.pending = make(map[string]func())
+	r.warmup.order = nil
+	r.warmup.mu.Unlock()
+
+	slog.Info("Warm-up started", "quiet", quiet, "max", max, "defer", deferRuns)
+	go r.watchWarmup()
+}
+
+// IsWarmingUp reports whether the engine is still in its warm-up phase
+func (r *Runner) IsWarmingUp() bool {
+	r.warmup.mu.Lock()
+	defer r.warmup.mu.Unlock()
+	return r.warmup.active
+}
+
+func (r *Runner) watchWarmup() {
+	interval := r.warmup.quiet / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.warmup.mu.Lock()
+		now := time.Now()
+		settled := now.Sub(r.warmup.lastMessage) >= r.warmup.quiet || now.After(r.warmup.deadline)
+		if !settled {
+			r.warmup.mu.Unlock()
+			continue
+		}
+
+		r.warmup.active = false
+		jobs := make([]func(), 0, len(r.warmup.order))
+		for _, key := range r.warmup.order {
+			jobs = append(jobs, r.warmup.pending[key])
+		}
+		r.warmup.pending = nil
+		r.warmup.order = nil
+		r.warmup.mu.Unlock()
+
+		slog.Info("Warm-up finished, running deferred triggers", "count", len(jobs))
+		for _, job := range jobs {
+			job()
+		}
+		return
+	}
+}
+
+// hold records trigger activity and, in defer mode, keeps the job for later.
+// Returns true when the job was deferred. Later jobs with the same key
+// replace earlier ones so only the settled value is processed.
+func (w *warmup) hold(key string, isMessage bool, job func()) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.active {
+		return false
+	}
+	if isMessage {
+		w.lastMessage = time.Now()
+	}
+	if !w.deferRuns {
+		return false
+	}
+	if _, exists := w.pending[key]; !exists {
+		w.order = append(w.order, key)
+	}
+	w.pending[key] = job
+	return true
+}
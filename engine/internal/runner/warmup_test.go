@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWarmup_DefersAndCoalesces(t *testing.T) {
+	r := &Runner{}
+	r.StartWarmup(30*time.Millisecond, time.Second, true)
+
+	var mu sync.Mutex
+	var ran []string
+	record := func(name string) func() {
+		return func() {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+		}
+	}
+
+	if !r.warmup.hold("a|topic", true, record("first")) {
+		t.Fatal("expected job to be deferred during warm-up")
+	}
+	r.warmup.hold("a|topic", true, record("second"))
+	r.warmup.hold("b|topic", true, record("other"))
+
+	if !r.IsWarmingUp() {
+		t.Fatal("expected warm-up to be active")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for r.IsWarmingUp() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if r.IsWarmingUp() {
+		t.Fatal("warm-up did not finish after quiet period")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ran) != 2 || ran[0] != "second" || ran[1] != "other" {
+		t.Errorf("deferred jobs ran = %v, want [second other]", ran)
+	}
+
+	if r.warmup.hold("a|topic", true, record("late")) {
+		t.Error("jobs should not be deferred after warm-up")
+	}
+}
+
+func TestWarmup_FlagModeDoesNotDefer(t *testing.T) {
+	r := &Runner{}
+	r.StartWarmup(time.Second, time.Second, false)
+
+	if r.warmup.hold("a|topic", true, func() {}) {
+		t.Error("flag mode should not defer jobs")
+	}
+	if !r.IsWarmingUp() {
+		t.Error("expected warm-up to be active in flag mode")
+	}
+}
@@ -0,0 +1,323 @@
+package runner
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Subsystems watched by the watchdog
+const (
+	WatchNormalDispatch = "dispatch_normal"
+	WatchHighDispatch   = "dispatch_high"
+	WatchCron           = "cron"
+	WatchMQTTCallbacks  = "mqtt_callbacks"
+)
+
+const (
+	defaultWatchdogInterval  = 5 * time.Second
+	defaultWatchdogThreshold = 30 * time.Second
+	maxWatchdogEvents        = 20
+	maxTraceBytes            = 4 << 20
+	cronStopTimeout          = 5 * time.Second
+)
+
+// Stall is a subsystem the watchdog found stuck
+type Stall struct {
+	Subsystem string     `json:"subsystem"`
+	Detail    string     `json:"detail"`
+	Since     time.Time  `json:"since"`
+	Recovered *time.Time `json:"recovered,omitempty"`
+	Restarted bool       `json:"restarted"`       // A restart was attempted
+	Trace     string     `json:"trace,omitempty"` // All goroutine stacks when detected
+}
+
+// WatchdogStatus is what the watchdog last saw
+type WatchdogStatus struct {
+	Enabled          bool               `json:"enabled"`
+	Restart          bool               `json:"restart"`
+	Threshold        string             `json:"threshold"`
+	DispatchLatency  map[string]float64 `json:"dispatch_latency_ms"` // Last probe pickup time by pool
+	LastCronTick     time.Time          `json:"last_cron_tick"`
+	CallbacksRunning int                `json:"mqtt_callbacks_running"`
+	LastCallbackMs   float64            `json:"mqtt_last_callback_ms"`
+	MaxCallbackMs    float64            `json:"mqtt_max_callback_ms"`
+	Stalls           []Stall            `json:"stalls"`  // Current
+	History          []Stall            `json:"history"` // Recent, newest first
+}
+
+// dispatchProbe is a heartbeat job waiting on one worker pool
+type dispatchProbe struct {
+	sent   time.Time // Zero when none is outstanding
+	queued bool      // False while the queue was too full to take it
+}
+
+// watchdog checks that the dispatch pools pick up jobs, cron keeps ticking and
+// MQTT callbacks return, dumping goroutine stacks when one of them stalls
+type watchdog struct {
+	mu           sync.Mutex
+	interval     time.Duration
+	threshold    time.Duration
+	restart      bool
+	probes       map[string]*dispatchProbe
+	latency      map[string]time.Duration
+	cronTick     time.Time
+	callbacks    map[uint64]time.Time // In-flight MQTT callbacks by start time
+	nextCallback uint64
+	lastCallback time.Duration
+	maxCallback  time.Duration
+	stalls       map[string]*Stall
+	history      []Stall
+}
+
+// StartWatchdog starts checking every interval for a dispatch pool, the cron
+// scheduler or an MQTT callback stuck for longer than threshold (non-positive
+// values use the defaults). With restart, workers of a stalled pool that are
+// stuck in one job are replaced and a stalled scheduler is restarted; stuck
+// MQTT callbacks are only reported. Call once, after ConfigureWorkers.
+func (r *Runner) StartWatchdog(interval, threshold time.Duration, restart bool) {
+	if interval <= 0 {
+		interval = defaultWatchdogInterval
+	}
+	if threshold <= 0 {
+		threshold = defaultWatchdogThreshold
+	}
+	now := time.Now()
+	w := &watchdog{
+		interval:  interval,
+		threshold: threshold,
+		restart:   restart,
+		probes:    map[string]*dispatchProbe{PriorityNormal: {}, PriorityHigh: {}},
+		latency:   make(map[string]time.Duration),
+		cronTick:  now,
+		callbacks: make(map[uint64]time.Time),
+		stalls:    make(map[string]*Stall),
+	}
+	r.watchdog = w
+
+	r.subscriptions.mu.Lock()
+	r.subscriptions.track = w.callbackStarted
+	r.subscriptions.mu.Unlock()
+
+	tick := interval.Round(time.Second)
+	if tick < time.Second {
+		tick = time.Second
+	}
+	r.cron.Schedule(cron.Every(tick), cron.FuncJob(func() {
+		w.mu.Lock()
+		w.cronTick = time.Now()
+		w.mu.Unlock()
+	}))
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			r.checkWatchdog(now)
+		}
+	}()
+	slog.Info("Watchdog started", "interval", interval, "threshold", threshold, "restart", restart)
+}
+
+// callbackStarted records an MQTT callback entering the engine and returns
+// the func that marks it done
+func (w *watchdog) callbackStarted() func() {
+	start := time.Now()
+	w.mu.Lock()
+	w.nextCallback++
+	id := w.nextCallback
+	w.callbacks[id] = start
+	w.mu.Unlock()
+
+	return func() {
+		elapsed := time.Since(start)
+		w.mu.Lock()
+		delete(w.callbacks, id)
+		w.lastCallback = elapsed
+		if elapsed > w.maxCallback {
+			w.maxCallback = elapsed
+		}
+		w.mu.Unlock()
+	}
+}
+
+// checkWatchdog runs one round of checks
+func (r *Runner) checkWatchdog(now time.Time) {
+	w := r.watchdog
+	d := r.dispatcher
+
+	w.mu.Lock()
+	stalled := make(map[string]string)
+	for _, priority := range []string{PriorityNormal, PriorityHigh} {
+		probe := w.probes[priority]
+		if probe.sent.IsZero() {
+			probe.sent = now
+			probe.queued = false
+		}
+		if !probe.queued {
+			sent := probe.sent
+			probe.queued = d.trySubmit(priority, func() {
+				w.mu.Lock()
+				defer w.mu.Unlock()
+				w.latency[priority] = time.Since(sent)
+				w.probes[priority].sent = time.Time{}
+			})
+		}
+		if waited := now.Sub(probe.sent); waited > w.threshold {
+			name := WatchNormalDispatch
+			if priority == PriorityHigh {
+				name = WatchHighDispatch
+			}
+			if probe.queued {
+				stalled[name] = fmt.Sprintf("no %s-priority worker picked up a job for %s", priority, waited.Round(time.Second))
+			} else {
+				stalled[name] = fmt.Sprintf("%s-priority queue full for %s", priority, waited.Round(time.Second))
+			}
+		}
+	}
+	if since := now.Sub(w.cronTick); since > w.interval+w.threshold {
+		stalled[WatchCron] = fmt.Sprintf("scheduler hasn't ticked for %s", since.Round(time.Second))
+	}
+	stuck := 0
+	var oldest time.Time
+	for _, start := range w.callbacks {
+		if now.Sub(start) > w.threshold {
+			stuck++
+			if oldest.IsZero() || start.Before(oldest) {
+				oldest = start
+			}
+		}
+	}
+	if stuck > 0 {
+		stalled[WatchMQTTCallbacks] = fmt.Sprintf("%d MQTT callback(s) running, the oldest for %s", stuck, now.Sub(oldest).Round(time.Second))
+	}
+
+	var detected []*Stall
+	for name, detail := range stalled {
+		if stall, ok := w.stalls[name]; ok {
+			stall.Detail = detail
+			continue
+		}
+		stall := &Stall{Subsystem: name, Detail: detail, Since: now}
+		w.stalls[name] = stall
+		detected = append(detected, stall)
+	}
+	for name, stall := range w.stalls {
+		if _, ok := stalled[name]; ok {
+			continue
+		}
+		recovered := now
+		stall.Recovered = &recovered
+		w.record(*stall)
+		delete(w.stalls, name)
+		slog.Info("Watchdog: subsystem recovered", "subsystem", name, "stalled_for", now.Sub(stall.Since).Round(time.Second))
+	}
+	restart := w.restart
+	w.mu.Unlock()
+
+	if len(detected) == 0 {
+		return
+	}
+	trace := goroutineTraces()
+	for _, stall := range detected {
+		slog.Error("Watchdog: subsystem stalled", "subsystem", stall.Subsystem, "detail", stall.Detail)
+		restarted := restart && r.restartSubsystem(stall.Subsystem, now)
+		w.mu.Lock()
+		stall.Trace = trace
+		stall.Restarted = restarted
+		w.mu.Unlock()
+	}
+}
+
+// restartSubsystem tries to get a stalled subsystem going again, reporting
+// whether it could
+func (r *Runner) restartSubsystem(name string, now time.Time) bool {
+	switch name {
+	case WatchNormalDispatch, WatchHighDispatch:
+		pool := PriorityNormal
+		if name == WatchHighDispatch {
+			pool = PriorityHigh
+		}
+		// Workers that aren't stuck are only slow; more of them wouldn't help
+		n := r.dispatcher.replaceStuck(pool, r.watchdog.threshold, now)
+		if n == 0 {
+			return false
+		}
+		slog.Warn("Watchdog: replaced stuck workers", "pool", pool, "count", n)
+	case WatchCron:
+		// Stop waits for the scheduler loop, which may be the stuck part
+		stopped := make(chan struct{})
+		go func() {
+			r.cron.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(cronStopTimeout):
+			slog.Error("Watchdog: scheduler didn't stop; not restarting it", "timeout", cronStopTimeout)
+			return false
+		}
+		r.cron.Start()
+		slog.Warn("Watchdog: restarted the scheduler")
+	default:
+		return false
+	}
+	return true
+}
+
+// record adds a finished stall to the history. Caller holds w.mu.
+func (w *watchdog) record(stall Stall) {
+	w.history = append([]Stall{stall}, w.history...)
+	if len(w.history) > maxWatchdogEvents {
+		w.history = w.history[:maxWatchdogEvents]
+	}
+}
+
+// goroutineTraces returns the stacks of all goroutines
+func goroutineTraces() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxTraceBytes {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// GetWatchdogStatus returns what the watchdog last saw. Enabled is false if
+// StartWatchdog wasn't called.
+func (r *Runner) GetWatchdogStatus() WatchdogStatus {
+	w := r.watchdog
+	if w == nil {
+		return WatchdogStatus{Stalls: []Stall{}, History: []Stall{}}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := WatchdogStatus{
+		Enabled:          true,
+		Restart:          w.restart,
+		Threshold:        w.threshold.String(),
+		DispatchLatency:  make(map[string]float64),
+		LastCronTick:     w.cronTick,
+		CallbacksRunning: len(w.callbacks),
+		LastCallbackMs:   float64(w.lastCallback.Microseconds()) / 1000,
+		MaxCallbackMs:    float64(w.maxCallback.Microseconds()) / 1000,
+		Stalls:           make([]Stall, 0, len(w.stalls)),
+		History:          append([]Stall{}, w.history...),
+	}
+	for priority, latency := range w.latency {
+		status.DispatchLatency[priority] = float64(latency.Microseconds()) / 1000
+	}
+	for _, stall := range w.stalls {
+		status.Stalls = append(status.Stalls, *stall)
+	}
+	sort.Slice(status.Stalls, func(i, j int) bool { return status.Stalls[i].Subsystem < status.Stalls[j].Subsystem })
+	return status
+}
@@ -0,0 +1,105 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdog_DispatchStall(t *testing.T) {
+	tests := []struct {
+		name    string
+		restart bool
+	}{
+		{"report only", false},
+		{"restart", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(nil, nil)
+			r.ConfigureWorkers(1, 1)
+			r.StartWatchdog(time.Hour, time.Minute, tt.restart)
+
+			// Occupy the only normal worker
+			release := make(chan struct{})
+			defer close(release)
+			r.dispatcher.submit(PriorityNormal, func() { <-release })
+
+			start := time.Now()
+			r.checkWatchdog(start)
+			if stalls := r.GetWatchdogStatus().Stalls; len(stalls) != 0 {
+				t.Fatalf("stalls before threshold = %+v", stalls)
+			}
+			waitForProbe(t, r, PriorityHigh)
+
+			r.checkWatchdog(start.Add(2 * time.Minute))
+			stalls := r.GetWatchdogStatus().Stalls
+			if len(stalls) != 1 || stalls[0].Subsystem != WatchNormalDispatch {
+				t.Fatalf("stalls = %+v", stalls)
+			}
+			if stalls[0].Restarted != tt.restart {
+				t.Errorf("restarted = %v, want %v", stalls[0].Restarted, tt.restart)
+			}
+			if !strings.Contains(stalls[0].Trace, "goroutine") {
+				t.Errorf("trace = %q", stalls[0].Trace)
+			}
+
+			if !tt.restart {
+				return
+			}
+			// A replacement worker picks up the probe
+			waitForProbe(t, r, PriorityNormal)
+			r.checkWatchdog(start.Add(3 * time.Minute))
+			status := r.GetWatchdogStatus()
+			if len(status.Stalls) != 0 {
+				t.Fatalf("stalls after restart = %+v", status.Stalls)
+			}
+			if len(status.History) != 1 || status.History[0].Recovered == nil {
+				t.Errorf("history = %+v", status.History)
+			}
+		})
+	}
+}
+
+// waitForProbe waits until a worker of the pool has picked up a watchdog probe
+func waitForProbe(t *testing.T, r *Runner, priority string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := r.GetWatchdogStatus().DispatchLatency[priority]; ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s worker picked up the probe", priority)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatchdog_CronAndCallbacks(t *testing.T) {
+	r := New(nil, nil)
+	r.StartWatchdog(time.Hour, time.Minute, false)
+
+	done := r.watchdog.callbackStarted()
+	r.checkWatchdog(time.Now().Add(2 * time.Hour))
+
+	var names []string
+	for _, stall := range r.GetWatchdogStatus().Stalls {
+		names = append(names, stall.Subsystem)
+	}
+	if got := strings.Join(names, ","); got != WatchCron+","+WatchMQTTCallbacks {
+		t.Errorf("stalled = %s", got)
+	}
+
+	done()
+	if status := r.GetWatchdogStatus(); status.CallbacksRunning != 0 || status.LastCallbackMs < 0 {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestWatchdog_Disabled(t *testing.T) {
+	r := New(nil, nil)
+	if status := r.GetWatchdogStatus(); status.Enabled || status.Stalls == nil {
+		t.Errorf("status = %+v", status)
+	}
+}
@@ -0,0 +1,172 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/homebrain/engine/internal/connector"
+	"github.com/homebrain/engine/internal/webhook"
+	"go.starlark.net/starlark"
+)
+
+var (
+	// ErrWebhookNotFound is returned for hooks no loaded automation declares
+	ErrWebhookNotFound = errors.New("no automation handles this webhook")
+
+	// ErrWebhookSecretMissing is returned when a hook's secret isn't defined
+	ErrWebhookSecretMissing = errors.New("webhook secret is not defined")
+)
+
+// validWebhookName is the form of config.webhook names, used in /hooks/{name}
+var validWebhookName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// WebhookConfig is an automation's HTTP hook. With a secret, requests must be
+// signed; see the webhook package for the styles.
+type WebhookConfig struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret,omitempty"` // Name of the secret holding the HMAC key
+	Style  string `json:"style,omitempty"`  // Signature style; defaults to github
+}
+
+// parseWebhook reads config.webhook, either a name or a dict:
+// {"name": "doorbell", "secret": "doorbell_hook", "style": "github"}
+func parseWebhook(v starlark.Value) (*WebhookConfig, error) {
+	hook := &WebhookConfig{}
+	switch v := v.(type) {
+	case starlark.String:
+		hook.Name = string(v)
+	case *starlark.Dict:
+		for _, field := range []struct {
+			key  string
+			dest *string
+		}{{"name", &hook.Name}, {"secret", &hook.Secret}, {"style", &hook.Style}} {
+			if value, found, _ := v.Get(starlark.String(field.key)); found {
+				s, ok := value.(starlark.String)
+				if !ok {
+					return nil, fmt.Errorf("webhook %s must be a string", field.key)
+				}
+				*field.dest = string(s)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("webhook must be a name or a dict")
+	}
+
+	if !validWebhookName.MatchString(hook.Name) {
+		return nil, fmt.Errorf("invalid webhook name %q (letters, digits, '_' and '-')", hook.Name)
+	}
+	switch hook.Style {
+	case "":
+		if hook.Secret != "" {
+			hook.Style = webhook.StyleGitHub
+		}
+	case webhook.StyleGitHub, webhook.StyleStripe, webhook.StyleIFTTT:
+		if hook.Secret == "" {
+			return nil, fmt.Errorf("webhook style requires a secret")
+		}
+	default:
+		return nil, fmt.Errorf("unknown webhook style %q (want %s, %s or %s)", hook.Style, webhook.StyleGitHub, webhook.StyleStripe, webhook.StyleIFTTT)
+	}
+	return hook, nil
+}
+
+// webhookOwner returns the loaded automation other than exclude that declares
+// the hook name, or nil
+func (r *Runner) webhookOwner(name, exclude string) *Automation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, a := range r.automations {
+		if a.ID != exclude && a.Config.Webhook != nil && a.Config.Webhook.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Webhook returns the hook declared under name
+func (r *Runner) Webhook(name string) (WebhookConfig, bool) {
+	a := r.webhookOwner(name, "")
+	if a == nil {
+		return WebhookConfig{}, false
+	}
+	return *a.Config.Webhook, true
+}
+
+// credentialHeaders are kept from on_webhook handlers: they carry the API
+// token or browser session of whoever sent the request
+var credentialHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// HandleWebhook verifies a request to a hook and queues
+// on_webhook(payload, headers, ctx) in the automation declaring it.
+// Credential headers are never passed to the handler.
+func (r *Runner) HandleWebhook(name string, header http.Header, body []byte) error {
+	automation := r.webhookOwner(name, "")
+	if automation == nil {
+		return fmt.Errorf("%w: %s", ErrWebhookNotFound, name)
+	}
+	hook := automation.Config.Webhook
+	if hook.Secret != "" {
+		secret, ok := r.secrets.Get(hook.Secret)
+		if !ok {
+			r.addLog(automation.ID, LogLevelError, fmt.Sprintf("ERROR: webhook %s rejected a request: secret '%s' is not defined", name, hook.Secret))
+			return fmt.Errorf("%w: %s", ErrWebhookSecretMissing, hook.Secret)
+		}
+		if err := (webhook.Verifier{Style: hook.Style, Secret: secret}).Verify(header, body); err != nil {
+			r.addLog(automation.ID, LogLevelWarning, fmt.Sprintf("WARNING: webhook %s rejected a request: %s", name, err))
+			return err
+		}
+	}
+
+	headers := make(map[string]string, len(header))
+	for key, values := range header {
+		if credentialHeaders[http.CanonicalHeaderKey(key)] {
+			continue
+		}
+		headers[strings.ToLower(key)] = strings.Join(values, ", ")
+	}
+	trigger := Trigger{
+		Type:    TriggerWebhook,
+		Webhook: name,
+		Headers: headers,
+		Time:    time.Now(),
+		payload: string(body),
+		json:    newPayloadJSON(body),
+	}
+	queued := r.dispatcher.submitSerial(automation.ID, automation.Config.Priority, func() {
+		r.execute(automation, trigger, "on_webhook", automation.onWebhook, starlark.String(body), webhookHeaders(headers))
+	})
+	if !queued {
+		return fmt.Errorf("%w: %s", ErrQueueFull, automation.ID)
+	}
+	return nil
+}
+
+// DispatchWebhook delivers the body of a verified POST /webhooks/{name} to the
+// automations subscribed to webhook/<name>. The on_message runs have trigger
+// type "webhook" rather than "mqtt".
+func (r *Runner) DispatchWebhook(name string, body []byte) {
+	topic := connector.InternalTopic("webhook", name)
+	decoded := newPayloadJSON(body)
+	r.subscriptions.each(topic, func(automation *Automation, pattern string) {
+		if automation.changes.changed(pattern, topic, body, decoded) {
+			r.enqueueMessage(automation, Trigger{Type: TriggerWebhook, Topic: topic, Webhook: name, json: decoded}, body)
+		}
+	})
+}
+
+// webhookHeaders converts request headers to the dict passed to on_webhook
+func webhookHeaders(headers map[string]string) *starlark.Dict {
+	dict := starlark.NewDict(len(headers))
+	for key, value := range headers {
+		dict.SetKey(starlark.String(key), starlark.String(value))
+	}
+	return dict
+}
@@ -0,0 +1,185 @@
+package runner
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/homebrain/engine/internal/secrets"
+	"github.com/homebrain/engine/internal/webhook"
+)
+
+func TestParseWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    WebhookConfig
+		wantErr string
+	}{
+		{name: "name only", src: `"doorbell"`, want: WebhookConfig{Name: "doorbell"}},
+		{name: "secret defaults to github", src: `{"name": "doorbell", "secret": "doorbell_hook"}`, want: WebhookConfig{Name: "doorbell", Secret: "doorbell_hook", Style: webhook.StyleGitHub}},
+		{name: "style", src: `{"name": "ifttt-away", "secret": "s", "style": "ifttt"}`, want: WebhookConfig{Name: "ifttt-away", Secret: "s", Style: webhook.StyleIFTTT}},
+		{name: "bad name", src: `"door/bell"`, wantErr: "invalid webhook name"},
+		{name: "empty name", src: `{"secret": "s"}`, wantErr: "invalid webhook name"},
+		{name: "style without secret", src: `{"name": "d", "style": "github"}`, wantErr: "requires a secret"},
+		{name: "unknown style", src: `{"name": "d", "secret": "s", "style": "basic"}`, wantErr: "unknown webhook style"},
+		{name: "wrong type", src: `42`, wantErr: "must be a name or a dict"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := starlark.Eval(&starlark.Thread{}, "config", tt.src, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseWebhook(v)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("parseWebhook = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func writeWebhookAutomation(t *testing.T, dir, id, src string) string {
+	t.Helper()
+	path := filepath.Join(dir, id+".star")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHandleWebhook(t *testing.T) {
+	r := New(nil, nil)
+	store, _ := secrets.Load("", []string{"HOMEBRAIN_SECRET_DOORBELL_HOOK=s3cret"})
+	r.SetSecrets(store)
+	dir := t.TempDir()
+	r.SetAutomationsDir(dir)
+
+	if err := r.LoadAutomation(writeWebhookAutomation(t, dir, "doorbell", `
+config = {"name": "Doorbell", "webhook": {"name": "doorbell", "secret": "doorbell_hook"}}
+
+def on_webhook(payload, headers, ctx):
+    ctx.log("%s %s %s %s %s" % (ctx.trigger.type, ctx.trigger.webhook, ctx.payload_json()["button"], headers.get("x-camera"), headers.get("authorization") or headers.get("cookie")))
+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if hook, ok := r.Webhook("doorbell"); !ok || hook.Secret != "doorbell_hook" {
+		t.Fatalf("Webhook = %+v, %v", hook, ok)
+	}
+	body := []byte(`{"button": "front"}`)
+
+	unsigned := http.Header{}
+	if err := r.HandleWebhook("doorbell", unsigned, body); !errors.Is(err, webhook.ErrMissingSignature) {
+		t.Errorf("unsigned request error = %v", err)
+	}
+	waitForLog(t, r, "WARNING: webhook doorbell rejected a request")
+
+	signed := http.Header{}
+	signed.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(webhook.Sign("s3cret", body)))
+	signed.Set("X-Camera", "porch")
+	signed.Set("Authorization", "Bearer token")
+	signed.Set("Cookie", "session=abc")
+	if err := r.HandleWebhook("doorbell", signed, body); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, r, "webhook doorbell front porch None")
+
+	if err := r.HandleWebhook("garage", signed, body); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("unknown hook error = %v", err)
+	}
+}
+
+func TestLoadAutomation_WebhookRules(t *testing.T) {
+	r := New(nil, nil)
+	dir := t.TempDir()
+	r.SetAutomationsDir(dir)
+
+	if err := r.LoadAutomation(writeWebhookAutomation(t, dir, "first", `
+config = {"name": "First", "webhook": "doorbell"}
+
+def on_webhook(payload, headers, ctx):
+    pass
+`)); err != nil {
+		t.Fatal(err)
+	}
+	// Reloading the owner keeps its hook
+	if err := r.LoadAutomation(filepath.Join(dir, "first.star")); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	err := r.LoadAutomation(writeWebhookAutomation(t, dir, "second", `
+config = {"name": "Second", "webhook": "doorbell"}
+
+def on_webhook(payload, headers, ctx):
+    pass
+`))
+	if err == nil || !strings.Contains(err.Error(), "already handled by first") {
+		t.Errorf("duplicate hook error = %v", err)
+	}
+
+	err = r.LoadAutomation(writeWebhookAutomation(t, dir, "third", `
+config = {"name": "Third", "webhook": "garage"}
+
+def on_message(topic, payload, ctx):
+    pass
+`))
+	if err == nil || !strings.Contains(err.Error(), "requires an on_webhook function") {
+		t.Errorf("missing handler error = %v", err)
+	}
+}
+
+func TestDryRun_OnWebhook(t *testing.T) {
+	r := newTestRunner()
+	result, err := r.DryRun(DryRunRequest{
+		AutomationID: "doorbell",
+		Code: `
+config = {"name": "Doorbell", "webhook": "doorbell"}
+
+def on_webhook(payload, headers, ctx):
+    return "%s from %s" % (payload, headers["x-camera"])
+`,
+		Handler: "on_webhook",
+		Trigger: Trigger{Type: TriggerWebhook, Webhook: "doorbell", Headers: map[string]string{"x-camera": "porch"}},
+		Payload: "ring",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || result.Result != "ring from porch" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestDispatchWebhook(t *testing.T) {
+	r := New(nil, nil)
+	r.subscriptions, _ = newFakeSubscriptions()
+	dir := t.TempDir()
+	r.SetAutomationsDir(dir)
+	if err := r.LoadAutomation(writeWebhookAutomation(t, dir, "deploy", `
+config = {"name": "Deploy Notice", "subscribe": ["webhook/+"]}
+
+def on_message(topic, payload, ctx):
+    ctx.log("%s %s %s %s" % (ctx.trigger.type, ctx.trigger.webhook, topic, ctx.payload_json()["ref"]))
+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	r.DispatchWebhook("github_push", []byte(`{"ref": "main"}`))
+	waitForLog(t, r, "webhook github_push webhook/github_push main")
+}
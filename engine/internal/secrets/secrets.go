@@ -0,0 +1,81 @@
+// Package secrets holds API tokens and passwords for automations, so they
+// don't have to be written into Starlark files.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix marks environment variables holding secrets:
+// HOMEBRAIN_SECRET_WEATHER_API_KEY defines the secret "weather_api_key"
+const EnvPrefix = "HOMEBRAIN_SECRET_"
+
+// Store is a read-only set of named secrets
+type Store struct {
+	values map[string]string
+}
+
+// Load reads secrets from a flat YAML file of name: value pairs and from
+// environment entries ("KEY=value") starting with EnvPrefix. A missing file
+// is not an error. Environment secrets override file secrets of the same name.
+func Load(path string, environ []string) (*Store, error) {
+	s := &Store{values: make(map[string]string)}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read secrets: %w", err)
+		}
+		if err == nil {
+			var file map[string]any
+			if err := yaml.Unmarshal(data, &file); err != nil {
+				return nil, fmt.Errorf("invalid secrets file %s: %w", path, err)
+			}
+			for name, value := range file {
+				switch value.(type) {
+				case map[string]any, []any, nil:
+					return nil, fmt.Errorf("secret %s must be a string", name)
+				}
+				s.values[name] = fmt.Sprint(value)
+			}
+		}
+	}
+
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		name, isSecret := strings.CutPrefix(key, EnvPrefix)
+		if ok && isSecret && name != "" {
+			s.values[strings.ToLower(name)] = value
+		}
+	}
+	return s, nil
+}
+
+// Get returns the named secret
+func (s *Store) Get(name string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	value, ok := s.values[name]
+	return value, ok
+}
+
+// Names lists the defined secrets, sorted; values are never exposed
+func (s *Store) Names() []string {
+	if s == nil {
+		return []string{}
+	}
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
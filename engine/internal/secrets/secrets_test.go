@@ -0,0 +1,55 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	os.WriteFile(path, []byte("weather_api_key: abc123\nalarm_pin: 4711\ntelegram_token: from-file\n"), 0600)
+
+	s, err := Load(path, []string{
+		"HOMEBRAIN_SECRET_TELEGRAM_TOKEN=from-env",
+		"HOMEBRAIN_SECRET_=ignored",
+		"PATH=/usr/bin",
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"weather_api_key", "abc123", true},
+		{"alarm_pin", "4711", true},
+		{"telegram_token", "from-env", true},
+		{"path", "", false},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := s.Get(tt.name); got != tt.want || ok != tt.ok {
+			t.Errorf("Get(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+	if names := s.Names(); !reflect.DeepEqual(names, []string{"alarm_pin", "telegram_token", "weather_api_key"}) {
+		t.Errorf("Names() = %v", names)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	if s, err := Load(filepath.Join(t.TempDir(), "missing.yaml"), nil); err != nil || len(s.Names()) != 0 {
+		t.Errorf("missing file: %v, %v", s, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	for _, content := range []string{"not: [valid", "nested:\n  key: value\n", "empty:\n"} {
+		os.WriteFile(path, []byte(content), 0600)
+		if _, err := Load(path, nil); err == nil {
+			t.Errorf("Load(%q) should fail", content)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var annotationBucket = []byte("annotations")
+
+// Annotation is a timestamped note attached to an automation by a person or
+// an agent, such as why it was disabled
+type Annotation struct {
+	ID     uint64    `json:"id"`
+	Time   time.Time `json:"time"`
+	Author string    `json:"author,omitempty"`
+	Text   string    `json:"text"`
+}
+
+// AddAnnotation stores a note for an automation and returns it with its ID
+func (s *Store) AddAnnotation(automationID string, note Annotation) (Annotation, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(annotationBucket)
+		if err != nil {
+			return err
+		}
+		b, err := root.CreateBucketIfNotExists([]byte(automationID))
+		if err != nil {
+			return err
+		}
+		if note.ID, err = b.NextSequence(); err != nil {
+			return err
+		}
+		data, err := json.Marshal(note)
+		if err != nil {
+			return err
+		}
+		return b.Put(binary.BigEndian.AppendUint64(nil, note.ID), data)
+	})
+	return note, err
+}
+
+// DeleteAnnotation removes a note, reporting whether it existed
+func (s *Store) DeleteAnnotation(automationID string, id uint64) (bool, error) {
+	found := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(annotationBucket)
+		if root == nil {
+			return nil
+		}
+		b := root.Bucket([]byte(automationID))
+		if b == nil {
+			return nil
+		}
+		key := binary.BigEndian.AppendUint64(nil, id)
+		found = b.Get(key) != nil
+		return b.Delete(key)
+	})
+	return found, err
+}
+
+// Annotations returns an automation's notes, oldest first
+func (s *Store) Annotations(automationID string) ([]Annotation, error) {
+	notes := []Annotation{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(annotationBucket)
+		if root == nil {
+			return nil
+		}
+		b := root.Bucket([]byte(automationID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var note Annotation
+			if err := json.Unmarshal(v, &note); err != nil {
+				return nil
+			}
+			notes = append(notes, note)
+			return nil
+		})
+	})
+	return notes, err
+}
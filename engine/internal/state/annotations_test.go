@@ -0,0 +1,42 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnnotations(t *testing.T) {
+	s := newTestStore(t)
+	at := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	first, err := s.AddAnnotation("garden_pump", Annotation{Time: at, Author: "alex", Text: "Disabled while the valve is broken"})
+	if err != nil {
+		t.Fatalf("AddAnnotation failed: %v", err)
+	}
+	second, _ := s.AddAnnotation("garden_pump", Annotation{Time: at.Add(time.Hour), Text: "Valve replaced"})
+	s.AddAnnotation("hallway_motion", Annotation{Time: at, Text: "Sensor moved to the stairs"})
+	if first.ID == 0 || second.ID == first.ID {
+		t.Errorf("IDs = %d, %d", first.ID, second.ID)
+	}
+
+	notes, err := s.Annotations("garden_pump")
+	if err != nil {
+		t.Fatalf("Annotations failed: %v", err)
+	}
+	if len(notes) != 2 || notes[0].Text != "Disabled while the valve is broken" || notes[0].Author != "alex" || !notes[1].Time.Equal(at.Add(time.Hour)) {
+		t.Errorf("Annotations = %+v", notes)
+	}
+
+	if found, err := s.DeleteAnnotation("garden_pump", first.ID); err != nil || !found {
+		t.Fatalf("DeleteAnnotation = %v, %v", found, err)
+	}
+	if found, _ := s.DeleteAnnotation("garden_pump", first.ID); found {
+		t.Error("deleting twice should report not found")
+	}
+	if notes, _ := s.Annotations("garden_pump"); len(notes) != 1 || notes[0].ID != second.ID {
+		t.Errorf("after delete: %+v", notes)
+	}
+	if notes, _ := s.Annotations("missing"); len(notes) != 0 {
+		t.Errorf("Annotations(missing) = %+v", notes)
+	}
+}
@@ -0,0 +1,67 @@
+package state
+
+import (
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var counterBucket = []byte("counters")
+
+type counter struct {
+	Period string `json:"period"`
+	Count  int    `json:"count"`
+}
+
+// IncrementCounter adds one to a named counter and returns the new value.
+// Counters are scoped to a period (e.g. a date): a new period restarts at 1.
+func (s *Store) IncrementCounter(name, period string) (int, error) {
+	var result int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(counterBucket)
+		if err != nil {
+			return err
+		}
+
+		c := counter{Period: period}
+		if data := b.Get([]byte(name)); data != nil {
+			var stored counter
+			if err := json.Unmarshal(data, &stored); err == nil && stored.Period == period {
+				c = stored
+			}
+		}
+		c.Count++
+		result = c.Count
+
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(name), data)
+	})
+	return result, err
+}
+
+// GetCounter returns a counter's value for the given period (0 if unset or stale)
+func (s *Store) GetCounter(name, period string) (int, error) {
+	var result int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(counterBucket)
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		var stored counter
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		if stored.Period == period {
+			result = stored.Count
+		}
+		return nil
+	})
+	return result, err
+}
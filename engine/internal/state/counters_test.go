@@ -0,0 +1,45 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestCounters(t *testing.T) {
+	s := newTestStore(t)
+
+	for i := 1; i <= 3; i++ {
+		n, err := s.IncrementCounter("runs:hallway", "2024-05-01")
+		if err != nil {
+			t.Fatalf("IncrementCounter failed: %v", err)
+		}
+		if n != i {
+			t.Errorf("IncrementCounter = %d, want %d", n, i)
+		}
+	}
+
+	if n, _ := s.GetCounter("runs:hallway", "2024-05-01"); n != 3 {
+		t.Errorf("GetCounter = %d, want 3", n)
+	}
+
+	// New period restarts the count
+	if n, _ := s.IncrementCounter("runs:hallway", "2024-05-02"); n != 1 {
+		t.Errorf("IncrementCounter in new period = %d, want 1", n)
+	}
+	if n, _ := s.GetCounter("runs:hallway", "2024-05-01"); n != 0 {
+		t.Errorf("GetCounter for stale period = %d, want 0", n)
+	}
+	if n, _ := s.GetCounter("runs:unknown", "2024-05-02"); n != 0 {
+		t.Errorf("GetCounter for unknown counter = %d, want 0", n)
+	}
+}
@@ -0,0 +1,74 @@
+package state
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var expirationBucket = []byte("expirations")
+
+// Expiration is the time a state key set with a TTL is cleared, persisted so
+// the key still expires if the engine restarts first
+type Expiration struct {
+	AutomationID string    `json:"automation_id"` // Owner of the key, or the writer of a global key
+	Key          string    `json:"key"`
+	Global       bool      `json:"global,omitempty"`
+	Silent       bool      `json:"silent,omitempty"` // Clearing the global key runs no on_state_change
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func expirationKey(automationID, key string, global bool) []byte {
+	if global {
+		return []byte("global\x00" + key)
+	}
+	return []byte("automation\x00" + automationID + "\x00" + key)
+}
+
+// SaveExpiration stores an expiration, replacing the one of the same key
+func (s *Store) SaveExpiration(expiration Expiration) error {
+	data, err := json.Marshal(expiration)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(expirationBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put(expirationKey(expiration.AutomationID, expiration.Key, expiration.Global), data)
+	})
+}
+
+// DeleteExpiration removes a key's expiration; automationID is ignored for
+// global keys. Deleting a missing one is not an error.
+func (s *Store) DeleteExpiration(automationID, key string, global bool) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(expirationBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete(expirationKey(automationID, key, global))
+	})
+}
+
+// ListExpirations returns all pending expirations
+func (s *Store) ListExpirations() ([]Expiration, error) {
+	var expirations []Expiration
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(expirationBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var expiration Expiration
+			if err := json.Unmarshal(v, &expiration); err != nil {
+				return nil
+			}
+			expirations = append(expirations, expiration)
+			return nil
+		})
+	})
+	return expirations, err
+}
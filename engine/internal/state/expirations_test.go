@@ -0,0 +1,45 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpirations(t *testing.T) {
+	s := newTestStore(t)
+	at := time.Now().Add(5 * time.Minute).Round(0)
+
+	for _, expiration := range []Expiration{
+		{AutomationID: "hallway", Key: "motion", ExpiresAt: at},
+		{AutomationID: "hallway", Key: "presence.hallway", Global: true, ExpiresAt: at},
+		// Same global key from another writer replaces it
+		{AutomationID: "kitchen", Key: "presence.hallway", Global: true, ExpiresAt: at.Add(time.Minute)},
+	} {
+		if err := s.SaveExpiration(expiration); err != nil {
+			t.Fatalf("SaveExpiration failed: %v", err)
+		}
+	}
+
+	expirations, err := s.ListExpirations()
+	if err != nil {
+		t.Fatalf("ListExpirations failed: %v", err)
+	}
+	if len(expirations) != 2 {
+		t.Fatalf("ListExpirations = %+v", expirations)
+	}
+	for _, e := range expirations {
+		if e.Global && (e.AutomationID != "kitchen" || !e.ExpiresAt.Equal(at.Add(time.Minute))) {
+			t.Errorf("global expiration = %+v", e)
+		}
+	}
+
+	if err := s.DeleteExpiration("", "presence.hallway", true); err != nil {
+		t.Fatalf("DeleteExpiration failed: %v", err)
+	}
+	if err := s.DeleteExpiration("hallway", "missing", false); err != nil {
+		t.Fatalf("DeleteExpiration on missing key failed: %v", err)
+	}
+	if expirations, _ := s.ListExpirations(); len(expirations) != 1 || expirations[0].Key != "motion" || expirations[0].Global {
+		t.Errorf("after delete: %+v", expirations)
+	}
+}
@@ -0,0 +1,219 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// SnapshotVersion is the format version of exported state
+const SnapshotVersion = 1
+
+// Snapshot is the per-automation and global state of a store and the
+// automations' annotations, for moving them to another engine. Timers, TTLs,
+// history and flags are not included.
+type Snapshot struct {
+	Version     int                       `json:"version"`
+	ExportedAt  time.Time                 `json:"exported_at"`
+	Automations map[string]map[string]any `json:"automations"` // Automation ID → key → value
+	Global      map[string]any            `json:"global"`
+	Annotations map[string][]Annotation   `json:"annotations,omitempty"` // Automation ID → notes, oldest first
+}
+
+// ImportResult counts what an import wrote
+type ImportResult struct {
+	Automations    int `json:"automations"`
+	AutomationKeys int `json:"automation_keys"`
+	GlobalKeys     int `json:"global_keys"`
+	Annotations    int `json:"annotations"`
+}
+
+// Export returns all per-automation and global state and all annotations,
+// read in one transaction
+func (s *Store) Export() (Snapshot, error) {
+	snapshot := Snapshot{
+		Version:     SnapshotVersion,
+		ExportedAt:  time.Now().UTC(),
+		Automations: make(map[string]map[string]any),
+		Global:      make(map[string]any),
+		Annotations: make(map[string][]Annotation),
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if root := tx.Bucket(automationBucket); root != nil {
+			err := root.ForEachBucket(func(id []byte) error {
+				values, err := decodeValues(root.Bucket(id))
+				if err != nil {
+					return fmt.Errorf("automation %s: %w", id, err)
+				}
+				if len(values) > 0 {
+					snapshot.Automations[string(id)] = values
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if b := tx.Bucket(globalBucket); b != nil {
+			values, err := decodeValues(b)
+			if err != nil {
+				return fmt.Errorf("global state: %w", err)
+			}
+			snapshot.Global = values
+		}
+		if root := tx.Bucket(annotationBucket); root != nil {
+			return root.ForEachBucket(func(id []byte) error {
+				var notes []Annotation
+				err := root.Bucket(id).ForEach(func(k, v []byte) error {
+					var note Annotation
+					if err := json.Unmarshal(v, &note); err != nil {
+						return fmt.Errorf("annotations of %s: %w", id, err)
+					}
+					notes = append(notes, note)
+					return nil
+				})
+				if len(notes) > 0 {
+					snapshot.Annotations[string(id)] = notes
+				}
+				return err
+			})
+		}
+		return nil
+	})
+	return snapshot, err
+}
+
+func decodeValues(b *bolt.Bucket) (map[string]any, error) {
+	values := make(map[string]any)
+	err := b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+		var value any
+		if err := json.Unmarshal(v, &value); err != nil {
+			return fmt.Errorf("key %s: %w", k, err)
+		}
+		values[string(k)] = value
+		return nil
+	})
+	return values, err
+}
+
+// Import writes a snapshot in one transaction, so a failed import changes
+// nothing. Keys in the snapshot overwrite existing ones and other keys are
+// kept, and an automation's annotations in the snapshot replace the ones it
+// had; with replace, state of the same kind missing from the snapshot is
+// cleared first: all global keys, the keys of every automation and all
+// annotations.
+func (s *Store) Import(snapshot Snapshot, replace bool) (ImportResult, error) {
+	var result ImportResult
+	if snapshot.Version != SnapshotVersion {
+		return result, fmt.Errorf("unsupported state snapshot version %d (want %d)", snapshot.Version, SnapshotVersion)
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if replace {
+			for _, name := range [][]byte{automationBucket, globalBucket, annotationBucket} {
+				if tx.Bucket(name) == nil {
+					continue
+				}
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+		}
+		root, err := tx.CreateBucketIfNotExists(automationBucket)
+		if err != nil {
+			return err
+		}
+		for id, values := range snapshot.Automations {
+			if id == "" {
+				return fmt.Errorf("automation state without an automation ID")
+			}
+			b, err := root.CreateBucketIfNotExists([]byte(id))
+			if err != nil {
+				return err
+			}
+			if err := encodeValues(b, values); err != nil {
+				return fmt.Errorf("automation %s: %w", id, err)
+			}
+			result.Automations++
+			result.AutomationKeys += len(values)
+		}
+
+		global, err := tx.CreateBucketIfNotExists(globalBucket)
+		if err != nil {
+			return err
+		}
+		if err := encodeValues(global, snapshot.Global); err != nil {
+			return fmt.Errorf("global state: %w", err)
+		}
+		result.GlobalKeys = len(snapshot.Global)
+
+		for id, notes := range snapshot.Annotations {
+			if id == "" {
+				return fmt.Errorf("annotations without an automation ID")
+			}
+			if err := importAnnotations(tx, id, notes); err != nil {
+				return fmt.Errorf("annotations of %s: %w", id, err)
+			}
+			result.Annotations += len(notes)
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return result, nil
+}
+
+func encodeValues(b *bolt.Bucket, values map[string]any) error {
+	for key, value := range values {
+		if key == "" {
+			return fmt.Errorf("empty key")
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+		if err := b.Put([]byte(key), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importAnnotations replaces the notes of automation id, keeping their IDs.
+// Notes added later are numbered after the highest one.
+func importAnnotations(tx *bolt.Tx, id string, notes []Annotation) error {
+	root, err := tx.CreateBucketIfNotExists(annotationBucket)
+	if err != nil {
+		return err
+	}
+	if root.Bucket([]byte(id)) != nil {
+		if err := root.DeleteBucket([]byte(id)); err != nil {
+			return err
+		}
+	}
+	b, err := root.CreateBucket([]byte(id))
+	if err != nil {
+		return err
+	}
+	var last uint64
+	for _, note := range notes {
+		if note.ID == 0 {
+			return fmt.Errorf("annotation without an ID")
+		}
+		data, err := json.Marshal(note)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(binary.BigEndian.AppendUint64(nil, note.ID), data); err != nil {
+			return err
+		}
+		last = max(last, note.ID)
+	}
+	return b.SetSequence(last)
+}
@@ -0,0 +1,103 @@
+package state
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src := newTestStore(t)
+	src.SetState("hallway", "last_motion", 1767254400.5)
+	src.SetState("hallway", "count", 3)
+	src.SetState("alarm", "armed", true)
+	src.SetGlobalState("presence.person.alice", "home")
+	src.SetGlobalState("sensors.living_room", map[string]any{"temp": 21.5})
+	src.AddAnnotation("hallway", Annotation{Text: "motion sensor replaced"})
+	src.AddAnnotation("hallway", Annotation{Text: "timeout raised to 5 minutes"})
+
+	snapshot, err := src.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Version != SnapshotVersion || len(snapshot.Automations) != 2 || snapshot.Automations["hallway"]["count"] != 3.0 ||
+		snapshot.Global["presence.person.alice"] != "home" || len(snapshot.Annotations["hallway"]) != 2 {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+
+	// Snapshots go through JSON between engines
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Snapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestStore(t)
+	dst.SetState("hallway", "count", 10)
+	dst.SetState("garage", "open", true)
+	dst.SetGlobalState("mode", "away")
+	dst.AddAnnotation("hallway", Annotation{Text: "replaced by the import"})
+	dst.AddAnnotation("garage", Annotation{Text: "kept by a merge"})
+	result, err := dst.Import(decoded, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ImportResult{Automations: 2, AutomationKeys: 3, GlobalKeys: 2, Annotations: 2}); result != want {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+	if v, _ := dst.GetState("hallway", "count"); v != 3.0 {
+		t.Errorf("imported count = %v, want 3", v)
+	}
+	if v, _ := dst.GetState("garage", "open"); v != true {
+		t.Errorf("merge dropped garage state: %v", v)
+	}
+	if v, _ := dst.GetGlobalState("mode"); v != "away" {
+		t.Errorf("merge dropped global mode: %v", v)
+	}
+	if notes, _ := dst.Annotations("hallway"); !reflect.DeepEqual(notes, decoded.Annotations["hallway"]) {
+		t.Errorf("imported annotations = %+v, want %+v", notes, decoded.Annotations["hallway"])
+	}
+	if note, _ := dst.AddAnnotation("hallway", Annotation{Text: "after the import"}); note.ID != 3 {
+		t.Errorf("next annotation ID = %d, want 3", note.ID)
+	}
+	if notes, _ := dst.Annotations("garage"); len(notes) != 1 {
+		t.Errorf("merge dropped garage annotations: %+v", notes)
+	}
+
+	if _, err := dst.Import(decoded, true); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := dst.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replaced.Automations, decoded.Automations) || !reflect.DeepEqual(replaced.Global, decoded.Global) ||
+		!reflect.DeepEqual(replaced.Annotations, decoded.Annotations) {
+		t.Errorf("after replace = %+v, want %+v", replaced, decoded)
+	}
+}
+
+func TestImport_Invalid(t *testing.T) {
+	s := newTestStore(t)
+	s.SetGlobalState("mode", "home")
+	tests := []struct {
+		name     string
+		snapshot Snapshot
+	}{
+		{"unknown version", Snapshot{Version: 99}},
+		{"empty automation ID", Snapshot{Version: SnapshotVersion, Automations: map[string]map[string]any{"": {"a": 1}}}},
+		{"empty global key", Snapshot{Version: SnapshotVersion, Global: map[string]any{"": 1}}},
+		{"annotation without an ID", Snapshot{Version: SnapshotVersion, Annotations: map[string][]Annotation{"hallway": {{Text: "note"}}}}},
+	}
+	for _, tt := range tests {
+		if _, err := s.Import(tt.snapshot, true); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+	if v, _ := s.GetGlobalState("mode"); v != "home" {
+		t.Errorf("failed import changed state: mode = %v", v)
+	}
+}
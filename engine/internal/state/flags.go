@@ -0,0 +1,126 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var flagBucket = []byte("flags")
+
+// Flag is an engine-managed feature flag read by automations via ctx.flags
+type Flag struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Enabled     bool       `json:"enabled"`
+	Percentage  int        `json:"percentage"`             // Rollout share 0-100, bucketed by key
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`  // Off before this time
+	ActiveUntil *time.Time `json:"active_until,omitempty"` // Off from this time on
+}
+
+// Validate checks the flag's fields
+func (f Flag) Validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("flag name is required")
+	}
+	if f.Percentage < 0 || f.Percentage > 100 {
+		return fmt.Errorf("percentage must be between 0 and 100")
+	}
+	if f.ActiveFrom != nil && f.ActiveUntil != nil && !f.ActiveUntil.After(*f.ActiveFrom) {
+		return fmt.Errorf("active_until must be after active_from")
+	}
+	return nil
+}
+
+// IsEnabled evaluates the flag for a rollout key (usually an automation ID).
+// The same key always lands in the same percentage bucket.
+func (f Flag) IsEnabled(key string, now time.Time) bool {
+	if !f.Enabled {
+		return false
+	}
+	if f.ActiveFrom != nil && now.Before(*f.ActiveFrom) {
+		return false
+	}
+	if f.ActiveUntil != nil && !now.Before(*f.ActiveUntil) {
+		return false
+	}
+	if f.Percentage >= 100 {
+		return true
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(f.Name + ":" + key))
+	return int(h.Sum32()%100) < f.Percentage
+}
+
+// GetFlag returns a feature flag, or nil if it does not exist
+func (s *Store) GetFlag(name string) (*Flag, error) {
+	var flag *Flag
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(flagBucket)
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		flag = &Flag{}
+		return json.Unmarshal(data, flag)
+	})
+	return flag, err
+}
+
+// ListFlags returns all feature flags ordered by name
+func (s *Store) ListFlags() ([]Flag, error) {
+	flags := []Flag{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(flagBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var flag Flag
+			if err := json.Unmarshal(v, &flag); err != nil {
+				return err
+			}
+			flags = append(flags, flag)
+			return nil
+		})
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags, err
+}
+
+// SetFlag creates or replaces a feature flag
+func (s *Store) SetFlag(flag Flag) error {
+	if err := flag.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(flag)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(flagBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(flag.Name), data)
+	})
+}
+
+// DeleteFlag removes a feature flag
+func (s *Store) DeleteFlag(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(flagBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(name))
+	})
+}
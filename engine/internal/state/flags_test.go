@@ -0,0 +1,105 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlagIsEnabled(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	later := now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		flag     Flag
+		expected bool
+	}{
+		{"disabled", Flag{Name: "f", Enabled: false, Percentage: 100}, false},
+		{"fully rolled out", Flag{Name: "f", Enabled: true, Percentage: 100}, true},
+		{"zero percent", Flag{Name: "f", Enabled: true, Percentage: 0}, false},
+		{"not yet active", Flag{Name: "f", Enabled: true, Percentage: 100, ActiveFrom: &later}, false},
+		{"inside window", Flag{Name: "f", Enabled: true, Percentage: 100, ActiveFrom: &earlier, ActiveUntil: &later}, true},
+		{"expired", Flag{Name: "f", Enabled: true, Percentage: 100, ActiveUntil: &earlier}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.flag.IsEnabled("heating", now); got != tt.expected {
+				t.Errorf("IsEnabled() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFlagPercentageRollout(t *testing.T) {
+	flag := Flag{Name: "new_heating_logic", Enabled: true, Percentage: 30}
+	now := time.Now()
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		key := "automation_" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		if flag.IsEnabled(key, now) {
+			enabled++
+		}
+		// Bucketing is stable for a key
+		if flag.IsEnabled(key, now) != flag.IsEnabled(key, now.Add(time.Hour)) {
+			t.Fatalf("rollout for %s changed between evaluations", key)
+		}
+	}
+	if enabled < 200 || enabled > 400 {
+		t.Errorf("%d of 1000 keys enabled at 30%%, expected roughly 300", enabled)
+	}
+}
+
+func TestFlagValidate(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-time.Minute)
+
+	invalid := []Flag{
+		{Name: ""},
+		{Name: "f", Percentage: 101},
+		{Name: "f", Percentage: -1},
+		{Name: "f", ActiveFrom: &now, ActiveUntil: &before},
+	}
+	for _, f := range invalid {
+		if err := f.Validate(); err == nil {
+			t.Errorf("expected validation error for %+v", f)
+		}
+	}
+}
+
+func TestFlagStorage(t *testing.T) {
+	s := newTestStore(t)
+
+	if flag, err := s.GetFlag("missing"); err != nil || flag != nil {
+		t.Fatalf("GetFlag(missing) = %v, %v", flag, err)
+	}
+
+	if err := s.SetFlag(Flag{Name: "b", Enabled: true, Percentage: 50}); err != nil {
+		t.Fatalf("SetFlag failed: %v", err)
+	}
+	if err := s.SetFlag(Flag{Name: "a", Percentage: 100}); err != nil {
+		t.Fatalf("SetFlag failed: %v", err)
+	}
+	if err := s.SetFlag(Flag{Name: "bad", Percentage: 200}); err == nil {
+		t.Error("expected SetFlag to reject invalid flag")
+	}
+
+	flag, err := s.GetFlag("b")
+	if err != nil || flag == nil || flag.Percentage != 50 || !flag.Enabled {
+		t.Fatalf("GetFlag(b) = %+v, %v", flag, err)
+	}
+
+	flags, err := s.ListFlags()
+	if err != nil || len(flags) != 2 || flags[0].Name != "a" || flags[1].Name != "b" {
+		t.Fatalf("ListFlags() = %+v, %v", flags, err)
+	}
+
+	if err := s.DeleteFlag("a"); err != nil {
+		t.Fatalf("DeleteFlag failed: %v", err)
+	}
+	if flags, _ := s.ListFlags(); len(flags) != 1 {
+		t.Errorf("expected 1 flag after delete, got %d", len(flags))
+	}
+}
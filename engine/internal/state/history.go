@@ -0,0 +1,81 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var historyBucket = []byte("global_history")
+
+// MaxHistory is how many entries are kept per global key; older ones are dropped
+const MaxHistory = 100
+
+// HistoryEntry is one recorded write of a global state key
+type HistoryEntry struct {
+	Value   any       `json:"value"`
+	Time    time.Time `json:"time"`
+	Cleared bool      `json:"cleared,omitempty"` // The key was cleared rather than set
+}
+
+// RecordGlobalHistory appends a write of key to its history, dropping the
+// oldest entries beyond MaxHistory
+func (s *Store) RecordGlobalHistory(key string, entry HistoryEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(historyBucket)
+		if err != nil {
+			return err
+		}
+		b, err := root.CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		// Sequence numbers keep entries ordered even when timestamps collide
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := b.Put(binary.BigEndian.AppendUint64(nil, seq), data); err != nil {
+			return err
+		}
+
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k)+MaxHistory <= seq; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetGlobalHistory returns up to limit recorded writes of key, newest first
+func (s *Store) GetGlobalHistory(key string, limit int) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(historyBucket)
+		if root == nil {
+			return nil
+		}
+		b := root.Bucket([]byte(key))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil && len(entries) < limit; k, v = c.Prev() {
+			var entry HistoryEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,40 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGlobalHistory(t *testing.T) {
+	s := newTestStore(t)
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	if entries, err := s.GetGlobalHistory("doors.front", 10); err != nil || len(entries) != 0 {
+		t.Fatalf("GetGlobalHistory of unknown key = %v, %v", entries, err)
+	}
+
+	for i := 0; i < MaxHistory+5; i++ {
+		entry := HistoryEntry{Value: i%2 == 0, Time: start.Add(time.Duration(i) * time.Minute)}
+		if err := s.RecordGlobalHistory("doors.front", entry); err != nil {
+			t.Fatalf("RecordGlobalHistory failed: %v", err)
+		}
+	}
+	s.RecordGlobalHistory("doors.front", HistoryEntry{Time: start.Add(time.Hour * 3), Cleared: true})
+	s.RecordGlobalHistory("doors.back", HistoryEntry{Value: "open", Time: start})
+
+	entries, err := s.GetGlobalHistory("doors.front", 3)
+	if err != nil {
+		t.Fatalf("GetGlobalHistory failed: %v", err)
+	}
+	if len(entries) != 3 || !entries[0].Cleared || entries[1].Value != true || !entries[1].Time.Equal(start.Add(104*time.Minute)) {
+		t.Errorf("newest entries = %+v", entries)
+	}
+
+	all, _ := s.GetGlobalHistory("doors.front", 1000)
+	if len(all) != MaxHistory {
+		t.Fatalf("kept %d entries, want %d", len(all), MaxHistory)
+	}
+	if oldest := all[len(all)-1]; !oldest.Time.Equal(start.Add(6 * time.Minute)) {
+		t.Errorf("oldest kept entry = %+v, want the one from minute 6", oldest)
+	}
+}
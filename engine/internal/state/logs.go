@@ -0,0 +1,132 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var logBucket = []byte("automation_logs")
+
+// LogEntry is a persisted automation log entry
+type LogEntry struct {
+	Timestamp    time.Time `json:"timestamp"`
+	AutomationID string    `json:"automation_id"`
+	Level        string    `json:"level"`
+	Message      string    `json:"message"`
+	Seq          uint64    `json:"-"` // Increasing sequence number, the entry's key
+}
+
+// AppendLogs stores entries in one transaction under their sequence numbers,
+// dropping the oldest beyond max. Sequence numbers must increase.
+func (s *Store) AppendLogs(entries []LogEntry, max int) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(logBucket)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(logKey(entry.Seq), data); err != nil {
+				return err
+			}
+		}
+		seq := entries[len(entries)-1].Seq
+
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k)+uint64(max) <= seq; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RecentLogs returns up to limit of the newest stored entries, oldest first
+func (s *Store) RecentLogs(limit int) ([]LogEntry, error) {
+	var entries []LogEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(logBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil && len(entries) < limit; k, v = c.Prev() {
+			entry, err := decodeLog(k, v)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, err
+}
+
+// QueryLogs returns up to limit stored entries accepted by match, newest
+// first, starting below the sequence number before (0 starts at the newest;
+// limit 0 returns all). Entries are stored in order, so the scan stops at the
+// first one older than since. At most scan entries are read (0 reads all).
+// next is the cursor to pass as before for the following page, 0 once the
+// scan reached the oldest entry or since.
+func (s *Store) QueryLogs(before uint64, since time.Time, limit, scan int, match func(LogEntry) bool) (entries []LogEntry, next uint64, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(logBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		k, v := c.Last()
+		if before > 0 {
+			if k, v = c.Seek(logKey(before)); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+		for read := 0; k != nil; k, v = c.Prev() {
+			if (limit > 0 && len(entries) >= limit) || (scan > 0 && read >= scan) {
+				next = binary.BigEndian.Uint64(k) + 1
+				return nil
+			}
+			read++
+			entry, err := decodeLog(k, v)
+			if err != nil {
+				continue
+			}
+			if !since.IsZero() && entry.Timestamp.Before(since) {
+				return nil
+			}
+			if match == nil || match(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	return entries, next, err
+}
+
+func logKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+func decodeLog(k, v []byte) (LogEntry, error) {
+	var entry LogEntry
+	if err := json.Unmarshal(v, &entry); err != nil {
+		return entry, err
+	}
+	entry.Seq = binary.BigEndian.Uint64(k)
+	return entry, nil
+}
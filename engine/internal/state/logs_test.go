@@ -0,0 +1,83 @@
+package state
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAppendLogs(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now().Round(0)
+
+	var batch []LogEntry
+	for i := 0; i < 5; i++ {
+		batch = append(batch, LogEntry{Timestamp: now.Add(time.Duration(i) * time.Second), AutomationID: "hallway", Level: "info", Message: fmt.Sprintf("entry %d", i), Seq: uint64(i + 1)})
+	}
+	if err := s.AppendLogs(batch[:3], 4); err != nil {
+		t.Fatalf("AppendLogs failed: %v", err)
+	}
+	if err := s.AppendLogs(batch[3:], 4); err != nil {
+		t.Fatalf("AppendLogs failed: %v", err)
+	}
+
+	logs, err := s.RecentLogs(10)
+	if err != nil {
+		t.Fatalf("RecentLogs failed: %v", err)
+	}
+	if len(logs) != 4 || logs[0].Message != "entry 1" || logs[3].Message != "entry 4" || logs[3].Seq != 5 || !logs[3].Timestamp.Equal(batch[4].Timestamp) {
+		t.Fatalf("RecentLogs = %+v", logs)
+	}
+	if logs, _ := s.RecentLogs(2); len(logs) != 2 || logs[0].Message != "entry 3" {
+		t.Errorf("RecentLogs(2) = %+v", logs)
+	}
+}
+
+func TestQueryLogs(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now().Round(0)
+
+	var batch []LogEntry
+	for i := 0; i < 6; i++ {
+		batch = append(batch, LogEntry{Timestamp: now.Add(time.Duration(i) * time.Minute), AutomationID: fmt.Sprintf("room%d", i%2), Level: "info", Message: fmt.Sprintf("entry %d", i), Seq: uint64(i + 1)})
+	}
+	if err := s.AppendLogs(batch, 100); err != nil {
+		t.Fatalf("AppendLogs failed: %v", err)
+	}
+
+	room1 := func(e LogEntry) bool { return e.AutomationID == "room1" }
+	tests := []struct {
+		name     string
+		before   uint64
+		since    time.Time
+		limit    int
+		scan     int
+		match    func(LogEntry) bool
+		want     []string
+		wantNext uint64
+	}{
+		{"all", 0, time.Time{}, 0, 0, nil, []string{"entry 5", "entry 4", "entry 3", "entry 2", "entry 1", "entry 0"}, 0},
+		{"limit", 0, time.Time{}, 2, 0, room1, []string{"entry 5", "entry 3"}, 4},
+		{"since", 0, now.Add(3 * time.Minute), 0, 0, room1, []string{"entry 5", "entry 3"}, 0},
+		{"since excludes older", 0, now.Add(4 * time.Minute), 0, 0, nil, []string{"entry 5", "entry 4"}, 0},
+		{"before", 4, time.Time{}, 0, 0, nil, []string{"entry 2", "entry 1", "entry 0"}, 0},
+		{"before the next page", 4, time.Time{}, 2, 0, room1, []string{"entry 1"}, 0},
+		{"before beyond the newest", 100, time.Time{}, 1, 0, nil, []string{"entry 5"}, 6},
+		{"scan bound", 0, time.Time{}, 0, 3, room1, []string{"entry 5", "entry 3"}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, next, err := s.QueryLogs(tt.before, tt.since, tt.limit, tt.scan, tt.match)
+			if err != nil {
+				t.Fatalf("QueryLogs failed: %v", err)
+			}
+			var got []string
+			for _, e := range logs {
+				got = append(got, e.Message)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) || next != tt.wantNext {
+				t.Errorf("got %v, next %d; want %v, next %d", got, next, tt.want, tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package state
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metaBucket       = []byte("meta")
+	schemaVersionKey = []byte("schema_version")
+)
+
+// Migration upgrades the database by one schema version. Apply runs in its
+// own write transaction together with the version bump.
+type Migration struct {
+	Version int
+	Name    string
+	Apply   func(tx *bolt.Tx) error
+}
+
+// migrations is the ordered list of schema changes. Append new entries with
+// the next version number; never edit or reorder released ones.
+var migrations = []Migration{
+	// The buckets the store had before schema versions were recorded; the
+	// state and global buckets are the store's own
+	{Version: 1, Name: "baseline buckets", Apply: func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{automationBucket, globalBucket, counterBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{Version: 2, Name: "feature flags", Apply: func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(flagBucket)
+		return err
+	}},
+	{Version: 3, Name: "discovered topics", Apply: func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(topicBucket)
+		return err
+	}},
+	{Version: 4, Name: "timers", Apply: func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(timerBucket)
+		return err
+	}},
+	{Version: 5, Name: "paused schedules", Apply: func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(pausedScheduleBucket)
+		return err
+	}},
+	{Version: 6, Name: "global state history", Apply: func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	}},
+}
+
+// SchemaVersion returns the schema version recorded in the database (0 if none)
+func (s *Store) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+		return nil
+	})
+	return version, err
+}
+
+// Migrate applies pending schema migrations. When the database already holds
+// data it is copied to <path>.v<version>-<timestamp>.bak first.
+func (s *Store) Migrate() error {
+	return s.migrate(migrations)
+}
+
+func (s *Store) migrate(list []Migration) error {
+	latest := 0
+	for i, m := range list {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %q has version %d, expected %d", m.Name, m.Version, i+1)
+		}
+		latest = m.Version
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("database schema v%d is newer than this engine supports (v%d)", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	if err := s.backupBeforeMigrate(current); err != nil {
+		return fmt.Errorf("backup before migration failed: %w", err)
+	}
+
+	for _, m := range list[current:] {
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			if err := m.Apply(tx); err != nil {
+				return err
+			}
+			return setSchemaVersion(tx, m.Version)
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		slog.Info("Applied state migration", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
+
+// backupBeforeMigrate snapshots the database file unless it holds no data yet
+func (s *Store) backupBeforeMigrate(version int) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if version == 0 && isEmpty(tx) {
+			return nil
+		}
+		path := fmt.Sprintf("%s.v%d-%s.bak", s.db.Path(), version, time.Now().Format("20060102-150405"))
+		if err := tx.CopyFile(path, 0600); err != nil {
+			return err
+		}
+		slog.Info("Backed up state before migration", "path", path)
+		return nil
+	})
+}
+
+func schemaVersion(tx *bolt.Tx) int {
+	b := tx.Bucket(metaBucket)
+	if b == nil {
+		return 0
+	}
+	data := b.Get(schemaVersionKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(data))
+}
+
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	b, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(version))
+	return b.Put(schemaVersionKey, data)
+}
+
+// isEmpty reports whether no bucket contains any keys or nested buckets
+func isEmpty(tx *bolt.Tx) bool {
+	empty := true
+	tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+		if k, _ := b.Cursor().First(); k != nil {
+			empty = false
+		}
+		return nil
+	})
+	return empty
+}
@@ -0,0 +1,100 @@
+package state
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMigrate(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.Migrate(); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	version, err := s.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if version != len(migrations) {
+		t.Errorf("version = %d, want %d", version, len(migrations))
+	}
+
+	// A fresh database has nothing worth backing up
+	if backups, _ := filepath.Glob(s.db.Path() + ".*.bak"); len(backups) != 0 {
+		t.Errorf("unexpected backups for empty database: %v", backups)
+	}
+
+	// Running again is a no-op
+	if err := s.Migrate(); err != nil {
+		t.Errorf("second Migrate failed: %v", err)
+	}
+}
+
+func TestMigrate_BacksUpAndAppliesInOrder(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.SetGlobalState("presence.home", true); err != nil {
+		t.Fatalf("SetGlobalState failed: %v", err)
+	}
+
+	var applied []int
+	list := []Migration{
+		{Version: 1, Name: "first", Apply: func(tx *bolt.Tx) error { applied = append(applied, 1); return nil }},
+		{Version: 2, Name: "second", Apply: func(tx *bolt.Tx) error { applied = append(applied, 2); return nil }},
+	}
+	if err := s.migrate(list); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if len(applied) != 2 || applied[0] != 1 || applied[1] != 2 {
+		t.Errorf("applied = %v, want [1 2]", applied)
+	}
+	if backups, _ := filepath.Glob(s.db.Path() + ".v0-*.bak"); len(backups) != 1 {
+		t.Errorf("expected one backup, got %v", backups)
+	}
+
+	// Only the new migration runs on upgrade
+	applied = nil
+	list = append(list, Migration{Version: 3, Name: "third", Apply: func(tx *bolt.Tx) error { applied = append(applied, 3); return nil }})
+	if err := s.migrate(list); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if len(applied) != 1 || applied[0] != 3 {
+		t.Errorf("applied = %v, want [3]", applied)
+	}
+}
+
+func TestMigrate_FailureKeepsVersion(t *testing.T) {
+	s := newTestStore(t)
+	list := []Migration{
+		{Version: 1, Name: "ok", Apply: func(tx *bolt.Tx) error { return nil }},
+		{Version: 2, Name: "broken", Apply: func(tx *bolt.Tx) error { return errors.New("boom") }},
+	}
+	if err := s.migrate(list); err == nil {
+		t.Fatal("expected migration error")
+	}
+	if version, _ := s.SchemaVersion(); version != 1 {
+		t.Errorf("version = %d, want 1", version)
+	}
+}
+
+func TestMigrate_RejectsNewerSchema(t *testing.T) {
+	s := newTestStore(t)
+	s.db.Update(func(tx *bolt.Tx) error { return setSchemaVersion(tx, 99) })
+
+	if err := s.Migrate(); err == nil {
+		t.Error("expected error for newer schema")
+	}
+}
+
+func TestMigrate_RejectsGaps(t *testing.T) {
+	s := newTestStore(t)
+	list := []Migration{
+		{Version: 1, Name: "one", Apply: func(tx *bolt.Tx) error { return nil }},
+		{Version: 3, Name: "three", Apply: func(tx *bolt.Tx) error { return nil }},
+	}
+	if err := s.migrate(list); err == nil {
+		t.Error("expected error for non-sequential versions")
+	}
+}
@@ -0,0 +1,67 @@
+package state
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var overrideBucket = []byte("overrides")
+
+// Override is a temporary value applied by ctx.override, persisted so it is
+// reverted even if the engine restarts before it expires
+type Override struct {
+	Target       string          `json:"target"` // Global key or MQTT topic
+	Device       bool            `json:"device,omitempty"`
+	AutomationID string          `json:"automation_id"`
+	Value        json.RawMessage `json:"value"`
+	Restore      json.RawMessage `json:"restore,omitempty"` // Empty clears the global key
+	Until        time.Time       `json:"until"`
+}
+
+// SaveOverride stores an override, replacing one with the same target
+func (s *Store) SaveOverride(override Override) error {
+	data, err := json.Marshal(override)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(overrideBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(override.Target), data)
+	})
+}
+
+// DeleteOverride removes an override; deleting a missing one is not an error
+func (s *Store) DeleteOverride(target string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(overrideBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(target))
+	})
+}
+
+// ListOverrides returns all pending overrides, ordered by target
+func (s *Store) ListOverrides() ([]Override, error) {
+	var overrides []Override
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(overrideBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var override Override
+			if err := json.Unmarshal(v, &override); err != nil {
+				return nil
+			}
+			overrides = append(overrides, override)
+			return nil
+		})
+	})
+	return overrides, err
+}
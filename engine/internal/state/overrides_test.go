@@ -0,0 +1,46 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOverrides(t *testing.T) {
+	s := newTestStore(t)
+	until := time.Now().Add(time.Hour).Round(0)
+
+	for _, override := range []Override{
+		{Target: "heating.boost", AutomationID: "boost_button", Value: []byte(`true`), Restore: []byte(`false`), Until: until},
+		{Target: "zigbee2mqtt/heater/set", Device: true, AutomationID: "boost_button", Value: []byte(`"{\"state\":\"ON\"}"`), Restore: []byte(`"{\"state\":\"OFF\"}"`), Until: until},
+	} {
+		if err := s.SaveOverride(override); err != nil {
+			t.Fatalf("SaveOverride failed: %v", err)
+		}
+	}
+
+	// Saving again replaces the pending override
+	if err := s.SaveOverride(Override{Target: "heating.boost", AutomationID: "boost_button", Value: []byte(`true`), Until: until.Add(time.Hour)}); err != nil {
+		t.Fatalf("SaveOverride failed: %v", err)
+	}
+
+	overrides, err := s.ListOverrides()
+	if err != nil {
+		t.Fatalf("ListOverrides failed: %v", err)
+	}
+	if len(overrides) != 2 || overrides[0].Target != "heating.boost" || !overrides[0].Until.Equal(until.Add(time.Hour)) || overrides[0].Restore != nil {
+		t.Fatalf("ListOverrides = %+v", overrides)
+	}
+	if !overrides[1].Device || string(overrides[1].Restore) != `"{\"state\":\"OFF\"}"` {
+		t.Errorf("device override = %+v", overrides[1])
+	}
+
+	if err := s.DeleteOverride("heating.boost"); err != nil {
+		t.Fatalf("DeleteOverride failed: %v", err)
+	}
+	if err := s.DeleteOverride("missing"); err != nil {
+		t.Fatalf("DeleteOverride on missing override failed: %v", err)
+	}
+	if overrides, _ := s.ListOverrides(); len(overrides) != 1 || overrides[0].Target != "zigbee2mqtt/heater/set" {
+		t.Errorf("after delete: %+v", overrides)
+	}
+}
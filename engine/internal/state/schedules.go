@@ -0,0 +1,59 @@
+package state
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var pausedScheduleBucket = []byte("paused_schedules")
+
+// PauseSchedule records that an automation's schedule is paused, keeping the
+// original pause time if it already was
+func (s *Store) PauseSchedule(automationID string, at time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(pausedScheduleBucket)
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(automationID)) != nil {
+			return nil
+		}
+		data, err := at.MarshalText()
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(automationID), data)
+	})
+}
+
+// ResumeSchedule clears a pause; resuming a schedule that isn't paused is not an error
+func (s *Store) ResumeSchedule(automationID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(pausedScheduleBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(automationID))
+	})
+}
+
+// PausedSchedules returns when each paused schedule was paused, by automation ID
+func (s *Store) PausedSchedules() (map[string]time.Time, error) {
+	paused := make(map[string]time.Time)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(pausedScheduleBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var at time.Time
+			if err := at.UnmarshalText(v); err != nil {
+				return nil
+			}
+			paused[string(k)] = at
+			return nil
+		})
+	})
+	return paused, err
+}
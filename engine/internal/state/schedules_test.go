@@ -0,0 +1,38 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPausedSchedules(t *testing.T) {
+	s := newTestStore(t)
+	at := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	if err := s.PauseSchedule("morning_lights", at); err != nil {
+		t.Fatalf("PauseSchedule failed: %v", err)
+	}
+	// Pausing again keeps the original pause time
+	if err := s.PauseSchedule("morning_lights", at.Add(time.Hour)); err != nil {
+		t.Fatalf("PauseSchedule failed: %v", err)
+	}
+	s.PauseSchedule("garden_watering", at)
+
+	paused, err := s.PausedSchedules()
+	if err != nil {
+		t.Fatalf("PausedSchedules failed: %v", err)
+	}
+	if len(paused) != 2 || !paused["morning_lights"].Equal(at) {
+		t.Errorf("PausedSchedules = %v", paused)
+	}
+
+	if err := s.ResumeSchedule("morning_lights"); err != nil {
+		t.Fatalf("ResumeSchedule failed: %v", err)
+	}
+	if err := s.ResumeSchedule("missing"); err != nil {
+		t.Fatalf("ResumeSchedule on missing schedule failed: %v", err)
+	}
+	if paused, _ := s.PausedSchedules(); len(paused) != 1 || paused["garden_watering"].IsZero() {
+		t.Errorf("after resume: %v", paused)
+	}
+}
@@ -0,0 +1,114 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var throttleBucket = []byte("throttles")
+
+// legacyThrottleAge is how long a throttle stored without its interval, as
+// older versions did, is kept after its last allowed call
+const legacyThrottleAge = 7 * 24 * time.Hour
+
+// throttle is the stored state of a ctx.throttle key
+type throttle struct {
+	Last  time.Time `json:"last"`  // Last allowed call
+	Until time.Time `json:"until"` // Last plus that call's interval; pruned after
+}
+
+func decodeThrottle(data []byte) (throttle, bool) {
+	var t throttle
+	if json.Unmarshal(data, &t) == nil {
+		return t, true
+	}
+	if t.Last.UnmarshalText(data) != nil {
+		return t, false
+	}
+	t.Until = t.Last.Add(legacyThrottleAge)
+	return t, true
+}
+
+// Throttle decides a ctx.throttle call: it allows key of automationID at now
+// unless the last allowed call was less than interval earlier, and records
+// allowed calls. Denied calls only read the store; the check is repeated in
+// the transaction that records an allowed call, so concurrent calls can't
+// both pass. That transaction also prunes the automation's throttles whose
+// interval has passed.
+func (s *Store) Throttle(automationID, key string, now time.Time, interval time.Duration) (bool, error) {
+	id := []byte(automationID + "\x00" + key)
+	throttled := func(tx *bolt.Tx) bool {
+		b := tx.Bucket(throttleBucket)
+		if b == nil {
+			return false
+		}
+		t, ok := decodeThrottle(b.Get(id))
+		return ok && now.Sub(t.Last) < interval
+	}
+
+	denied := false
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		denied = throttled(tx)
+		return nil
+	}); err != nil || denied {
+		return false, err
+	}
+
+	allowed := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if throttled(tx) {
+			return nil
+		}
+		b, err := tx.CreateBucketIfNotExists(throttleBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := pruneThrottles(b, []byte(automationID+"\x00"), now); err != nil {
+			return err
+		}
+		allowed = true
+		data, err := json.Marshal(throttle{Last: now, Until: now.Add(interval)})
+		if err != nil {
+			return err
+		}
+		return b.Put(id, data)
+	})
+	return allowed, err
+}
+
+// PruneThrottles deletes the throttles of all automations whose interval has
+// passed at now and returns how many
+func (s *Store) PruneThrottles(now time.Time) (int, error) {
+	pruned := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(throttleBucket)
+		if b == nil {
+			return nil
+		}
+		var err error
+		pruned, err = pruneThrottles(b, nil, now)
+		return err
+	})
+	return pruned, err
+}
+
+// pruneThrottles deletes the throttles under prefix whose interval has passed
+func pruneThrottles(b *bolt.Bucket, prefix []byte, now time.Time) (int, error) {
+	// Collect first: deleting while iterating makes the cursor skip keys
+	var stale [][]byte
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if t, ok := decodeThrottle(v); !ok || !now.Before(t.Until) {
+			stale = append(stale, bytes.Clone(k))
+		}
+	}
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
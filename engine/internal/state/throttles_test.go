@@ -0,0 +1,92 @@
+package state
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestThrottle(t *testing.T) {
+	s := newTestStore(t)
+	start := time.Now()
+
+	steps := []struct {
+		automationID, key string
+		at                time.Duration
+		want              bool
+	}{
+		{"hallway", "notify", 0, true},
+		{"hallway", "notify", 30 * time.Second, false},
+		{"hallway", "publish", 30 * time.Second, true},
+		{"kitchen", "notify", 30 * time.Second, true},
+		{"hallway", "notify", 59 * time.Second, false},
+		{"hallway", "notify", 60 * time.Second, true},
+		{"hallway", "notify", 90 * time.Second, false},
+	}
+	for _, step := range steps {
+		allowed, err := s.Throttle(step.automationID, step.key, start.Add(step.at), time.Minute)
+		if err != nil {
+			t.Fatalf("Throttle failed: %v", err)
+		}
+		if allowed != step.want {
+			t.Errorf("Throttle(%s, %s) at %s = %v, want %v", step.automationID, step.key, step.at, allowed, step.want)
+		}
+	}
+}
+
+func TestPruneThrottles(t *testing.T) {
+	s := newTestStore(t)
+	start := time.Now()
+
+	for _, step := range []struct {
+		automationID, key string
+		interval          time.Duration
+	}{
+		{"hallway", "notify", time.Minute},
+		{"hallway", "publish", time.Hour},
+		{"kitchen", "notify", time.Minute},
+	} {
+		if allowed, err := s.Throttle(step.automationID, step.key, start, step.interval); err != nil || !allowed {
+			t.Fatalf("Throttle(%s, %s) = %v, %v", step.automationID, step.key, allowed, err)
+		}
+	}
+	// Older versions stored only the time of the last allowed call
+	legacy, _ := start.MarshalText()
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(throttleBucket).Put([]byte("porch\x00notify"), legacy)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, _ := s.Throttle("porch", "notify", start.Add(time.Minute), time.Hour); allowed {
+		t.Error("legacy throttle was not honoured")
+	}
+
+	// An allowed call prunes its own automation's expired throttles only
+	if allowed, _ := s.Throttle("hallway", "other", start.Add(2*time.Minute), time.Minute); !allowed {
+		t.Fatal("Throttle(hallway, other) was denied")
+	}
+	keys := func() []string {
+		var keys []string
+		s.db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(throttleBucket).ForEach(func(k, _ []byte) error {
+				keys = append(keys, strings.ReplaceAll(string(k), "\x00", "/"))
+				return nil
+			})
+		})
+		return keys
+	}
+	if got, want := keys(), []string{"hallway/other", "hallway/publish", "kitchen/notify", "porch/notify"}; !slices.Equal(got, want) {
+		t.Errorf("after allowed call: %v, want %v", got, want)
+	}
+
+	pruned, err := s.PruneThrottles(start.Add(2 * time.Hour))
+	if err != nil || pruned != 3 {
+		t.Errorf("PruneThrottles() = %d, %v; want 3", pruned, err)
+	}
+	if got, want := keys(), []string{"porch/notify"}; !slices.Equal(got, want) {
+		t.Errorf("after pruning: %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var timerBucket = []byte("timers")
+
+// Timer is a pending ctx.set_timer callback, persisted so it survives restarts
+type Timer struct {
+	AutomationID string          `json:"automation_id"`
+	ID           string          `json:"id"`
+	FireAt       time.Time       `json:"fire_at"`
+	Data         json.RawMessage `json:"data,omitempty"`
+	Priority     string          `json:"priority,omitempty"` // Priority of the run that armed it
+}
+
+func timerKey(automationID, id string) []byte {
+	return []byte(automationID + "\x00" + id)
+}
+
+// SaveTimer stores a timer, replacing one with the same automation and ID
+func (s *Store) SaveTimer(timer Timer) error {
+	data, err := json.Marshal(timer)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(timerBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put(timerKey(timer.AutomationID, timer.ID), data)
+	})
+}
+
+// DeleteTimer removes a timer; deleting a missing timer is not an error
+func (s *Store) DeleteTimer(automationID, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(timerBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete(timerKey(automationID, id))
+	})
+}
+
+// ListTimers returns the pending timers of one automation
+func (s *Store) ListTimers(automationID string) ([]Timer, error) {
+	var timers []Timer
+	prefix := timerKey(automationID, "")
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(timerBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var timer Timer
+			if err := json.Unmarshal(v, &timer); err != nil {
+				continue
+			}
+			timers = append(timers, timer)
+		}
+		return nil
+	})
+	return timers, err
+}
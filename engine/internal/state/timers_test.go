@@ -0,0 +1,47 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimers(t *testing.T) {
+	s := newTestStore(t)
+	fireAt := time.Now().Add(5 * time.Minute).Round(0)
+
+	for _, timer := range []Timer{
+		{AutomationID: "hallway", ID: "lights_off", FireAt: fireAt, Data: []byte(`{"room":"hallway"}`)},
+		{AutomationID: "hallway", ID: "fan_off", FireAt: fireAt},
+		{AutomationID: "hallway_2", ID: "lights_off", FireAt: fireAt},
+	} {
+		if err := s.SaveTimer(timer); err != nil {
+			t.Fatalf("SaveTimer failed: %v", err)
+		}
+	}
+
+	// Saving again replaces the pending timer
+	if err := s.SaveTimer(Timer{AutomationID: "hallway", ID: "lights_off", FireAt: fireAt.Add(time.Minute), Data: []byte(`{"room":"hallway"}`)}); err != nil {
+		t.Fatalf("SaveTimer failed: %v", err)
+	}
+
+	timers, err := s.ListTimers("hallway")
+	if err != nil {
+		t.Fatalf("ListTimers failed: %v", err)
+	}
+	if len(timers) != 2 {
+		t.Fatalf("ListTimers = %+v, want 2 timers (other automations excluded)", timers)
+	}
+	if timers[1].ID != "lights_off" || !timers[1].FireAt.Equal(fireAt.Add(time.Minute)) || string(timers[1].Data) != `{"room":"hallway"}` {
+		t.Errorf("lights_off = %+v", timers[1])
+	}
+
+	if err := s.DeleteTimer("hallway", "lights_off"); err != nil {
+		t.Fatalf("DeleteTimer failed: %v", err)
+	}
+	if err := s.DeleteTimer("hallway", "missing"); err != nil {
+		t.Fatalf("DeleteTimer on missing timer failed: %v", err)
+	}
+	if timers, _ := s.ListTimers("hallway"); len(timers) != 1 || timers[0].ID != "fan_off" {
+		t.Errorf("after delete: %+v", timers)
+	}
+}
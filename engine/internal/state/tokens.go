@@ -0,0 +1,69 @@
+package state
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var apiTokenBucket = []byte("api_tokens")
+
+// APIToken is an API token issued through the API. Only a hash of the secret
+// is kept.
+type APIToken struct {
+	Name    string     `json:"name"`
+	Scope   string     `json:"scope"`
+	Hash    string     `json:"hash"` // Hex SHA-256 of the secret
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// SaveAPIToken stores a token, replacing one with the same name
+func (s *Store) SaveAPIToken(token APIToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(apiTokenBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(token.Name), data)
+	})
+}
+
+// DeleteAPIToken removes a token, reporting whether it existed
+func (s *Store) DeleteAPIToken(name string) (bool, error) {
+	found := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(apiTokenBucket)
+		if b == nil {
+			return nil
+		}
+		found = b.Get([]byte(name)) != nil
+		return b.Delete([]byte(name))
+	})
+	return found, err
+}
+
+// ListAPITokens returns the issued tokens, ordered by name
+func (s *Store) ListAPITokens() ([]APIToken, error) {
+	var tokens []APIToken
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(apiTokenBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var token APIToken
+			if err := json.Unmarshal(v, &token); err != nil {
+				return nil
+			}
+			tokens = append(tokens, token)
+			return nil
+		})
+	})
+	return tokens, err
+}
@@ -0,0 +1,38 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPITokens(t *testing.T) {
+	s := newTestStore(t)
+	expires := time.Now().Add(time.Hour).Round(0)
+
+	for _, token := range []APIToken{
+		{Name: "dashboard", Scope: "read", Hash: "aa", Created: time.Now().Round(0)},
+		{Name: "ci", Scope: "admin", Hash: "bb", Created: time.Now().Round(0), Expires: &expires},
+	} {
+		if err := s.SaveAPIToken(token); err != nil {
+			t.Fatalf("SaveAPIToken failed: %v", err)
+		}
+	}
+
+	tokens, err := s.ListAPITokens()
+	if err != nil {
+		t.Fatalf("ListAPITokens failed: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0].Name != "ci" || tokens[0].Expires == nil || !tokens[0].Expires.Equal(expires) || tokens[1].Scope != "read" {
+		t.Fatalf("ListAPITokens = %+v", tokens)
+	}
+
+	if found, err := s.DeleteAPIToken("ci"); err != nil || !found {
+		t.Fatalf("DeleteAPIToken = %v, %v", found, err)
+	}
+	if found, err := s.DeleteAPIToken("ci"); err != nil || found {
+		t.Errorf("DeleteAPIToken on missing token = %v, %v", found, err)
+	}
+	if tokens, _ := s.ListAPITokens(); len(tokens) != 1 || tokens[0].Name != "dashboard" {
+		t.Errorf("after delete: %+v", tokens)
+	}
+}
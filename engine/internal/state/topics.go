@@ -0,0 +1,96 @@
+package state
+
+import (
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var topicBucket = []byte("topics")
+
+// LoadTopics returns all persisted discovered topics with their last-seen time
+func (s *Store) LoadTopics() (map[string]time.Time, error) {
+	topics := make(map[string]time.Time)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(topicBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if len(v) == 8 {
+				topics[string(k)] = time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+			}
+			return nil
+		})
+	})
+	return topics, err
+}
+
+// SaveTopics records last-seen times, keeping the newer time for topics
+// already stored
+func (s *Store) SaveTopics(topics map[string]time.Time) error {
+	if len(topics) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(topicBucket)
+		if err != nil {
+			return err
+		}
+		for topic, seen := range topics {
+			if v := b.Get([]byte(topic)); len(v) == 8 && int64(binary.BigEndian.Uint64(v)) >= seen.UnixNano() {
+				continue
+			}
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], uint64(seen.UnixNano()))
+			if err := b.Put([]byte(topic), buf[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteTopics removes persisted topics
+func (s *Store) DeleteTopics(topics ...string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(topicBucket)
+		if b == nil {
+			return nil
+		}
+		for _, topic := range topics {
+			if err := b.Delete([]byte(topic)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PruneTopics deletes topics last seen before cutoff and returns how many
+func (s *Store) PruneTopics(cutoff time.Time) (int, error) {
+	pruned := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(topicBucket)
+		if b == nil {
+			return nil
+		}
+		// Collect first: deleting while iterating makes the cursor skip keys
+		var stale [][]byte
+		b.ForEach(func(k, v []byte) error {
+			if len(v) != 8 || int64(binary.BigEndian.Uint64(v)) < cutoff.UnixNano() {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		pruned = len(stale)
+		return nil
+	})
+	return pruned, err
+}
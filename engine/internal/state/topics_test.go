@@ -0,0 +1,45 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopics(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Now()
+
+	if err := s.SaveTopics(map[string]time.Time{
+		"zigbee2mqtt/lamp":   now,
+		"zigbee2mqtt/old":    now.Add(-48 * time.Hour),
+		"zigbee2mqtt/switch": now.Add(-time.Hour),
+	}); err != nil {
+		t.Fatalf("SaveTopics failed: %v", err)
+	}
+
+	// An older sighting never moves last-seen backwards
+	if err := s.SaveTopics(map[string]time.Time{"zigbee2mqtt/lamp": now.Add(-time.Hour)}); err != nil {
+		t.Fatalf("SaveTopics failed: %v", err)
+	}
+
+	topics, err := s.LoadTopics()
+	if err != nil {
+		t.Fatalf("LoadTopics failed: %v", err)
+	}
+	if len(topics) != 3 || !topics["zigbee2mqtt/lamp"].Equal(now) {
+		t.Errorf("LoadTopics = %v", topics)
+	}
+
+	pruned, err := s.PruneTopics(now.Add(-24 * time.Hour))
+	if err != nil || pruned != 1 {
+		t.Fatalf("PruneTopics = %d, %v; want 1", pruned, err)
+	}
+
+	if err := s.DeleteTopics("zigbee2mqtt/switch"); err != nil {
+		t.Fatalf("DeleteTopics failed: %v", err)
+	}
+	topics, _ = s.LoadTopics()
+	if len(topics) != 1 {
+		t.Errorf("topics after prune and delete = %v, want only lamp", topics)
+	}
+}
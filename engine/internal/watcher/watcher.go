@@ -1,6 +1,7 @@
 package watcher
 
 import (
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/fsnotify/fsnotify"
 
+	"github.com/homebrain/engine/internal/approval"
 	"github.com/homebrain/engine/internal/runner"
 )
 
@@ -16,10 +18,11 @@ type Watcher struct {
 	dir     string
 	watcher *fsnotify.Watcher
 	runner  *runner.Runner
+	files   []*fsnotify.Watcher // See WatchFile
 }
 
 // New creates a new file watcher
-func New(dir string, runner *runner.Runner) (*Watcher, error) {
+func New(dir string, r *runner.Runner) (*Watcher, error) {
 	fsWatcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
@@ -28,7 +31,7 @@ func New(dir string, runner *runner.Runner) (*Watcher, error) {
 	w := &Watcher{
 		dir:     dir,
 		watcher: fsWatcher,
-		runner:  runner,
+		runner:  r,
 	}
 
 	// Create directory if it doesn't exist
@@ -51,36 +54,125 @@ func New(dir string, runner *runner.Runner) (*Watcher, error) {
 		slog.Error("Failed to watch lib directory", "error", err)
 	}
 
+	// Watch the blueprints directory; changed blueprints reload their instances
+	blueprintsDir := filepath.Join(dir, runner.BlueprintsDir)
+	if err := os.MkdirAll(blueprintsDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := fsWatcher.Add(blueprintsDir); err != nil {
+		slog.Error("Failed to watch blueprints directory", "error", err)
+	}
+
+	// Watch group subdirectories at any depth (namespaces of related
+	// automations, optionally sharing a _common.star)
+	for _, groupDir := range w.groupDirs(dir) {
+		if err := fsWatcher.Add(groupDir); err != nil {
+			slog.Error("Failed to watch automation group", "dir", groupDir, "error", err)
+		}
+	}
+
 	return w, nil
 }
 
-// Close stops the watcher
+// Close stops the watcher, including the files passed to WatchFile
 func (w *Watcher) Close() error {
+	for _, fileWatcher := range w.files {
+		fileWatcher.Close()
+	}
 	return w.watcher.Close()
 }
 
-// LoadAll loads all existing automations
-func (w *Watcher) LoadAll() error {
-	entries, err := os.ReadDir(w.dir)
+// WatchFile calls onChange whenever the file at path is created, written or
+// replaced. Its directory is watched apart from the automations, so editors
+// saving through a rename are noticed and other files there are ignored. The
+// directory must exist; the file may be created later.
+func (w *Watcher) WatchFile(path string, onChange func()) error {
+	path = filepath.Clean(path)
+	fileWatcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
 	}
+	if err := fileWatcher.Add(filepath.Dir(path)); err != nil {
+		fileWatcher.Close()
+		return err
+	}
+	w.files = append(w.files, fileWatcher)
+	go watchFile(fileWatcher, path, onChange)
+	return nil
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+func watchFile(fileWatcher *fsnotify.Watcher, path string, onChange func()) {
+	for {
+		select {
+		case event, ok := <-fileWatcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == path && event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+				onChange()
+			}
+		case err, ok := <-fileWatcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("Watcher error", "file", path, "error", err)
 		}
-		if !isStarlarkFile(entry.Name()) {
+	}
+}
+
+// LoadAll loads all existing automations, including those in group
+// directories, each after the automations it requires
+func (w *Watcher) LoadAll() error {
+	files, err := automationFiles(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, groupDir := range w.groupDirs(w.dir) {
+		groupFiles, err := automationFiles(groupDir)
+		if err != nil {
+			slog.Error("Failed to load automation group", "dir", groupDir, "error", err)
 			continue
 		}
+		files = append(files, groupFiles...)
+	}
+	w.load(files)
+	return nil
+}
 
-		filePath := filepath.Join(w.dir, entry.Name())
-		if err := w.runner.LoadAutomation(filePath); err != nil {
-			slog.Error("Failed to load automation", "file", filePath, "error", err)
+// loadDir loads the automations directly inside dir
+func (w *Watcher) loadDir(dir string) error {
+	files, err := automationFiles(dir)
+	if err != nil {
+		return err
+	}
+	w.load(files)
+	return nil
+}
+
+// load loads automation files in dependency order
+func (w *Watcher) load(files []string) {
+	errs := w.runner.LoadAutomations(files)
+	for _, file := range files {
+		if err := errs[file]; err != nil {
+			slog.Error("Failed to load automation", "file", file, "error", err)
 		}
 	}
+}
 
-	return nil
+// automationFiles lists the automation files directly inside dir
+func automationFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isAutomationFile(entry.Name()) || runner.IsCommonFile(entry.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	return files, nil
 }
 
 // Watch starts watching for file changes
@@ -94,7 +186,37 @@ func (w *Watcher) Watch() {
 				return
 			}
 
-			if !isStarlarkFile(event.Name) {
+			if !w.inDir(event.Name) {
+				continue
+			}
+
+			if filepath.Dir(event.Name) == filepath.Join(w.dir, runner.BlueprintsDir) {
+				w.handleBlueprint(event.Name)
+				continue
+			}
+
+			// Common module changes reload every automation in its directory
+			if runner.IsCommonFile(event.Name) {
+				w.handleCommon(event.Name)
+				continue
+			}
+
+			if event.Op&fsnotify.Create == fsnotify.Create && w.isGroupPath(event.Name) {
+				w.handleNewGroup(event.Name)
+				continue
+			}
+
+			// Config sidecar changes reload the automation they belong to
+			if isSidecarFile(event.Name) && !runner.IsDeclarativeFile(event.Name) {
+				w.handleSidecar(event.Name)
+				continue
+			}
+
+			if !isAutomationFile(event.Name) {
+				// A removed or renamed group takes its automations with it
+				if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					w.handleRemoveGroup(event.Name)
+				}
 				continue
 			}
 
@@ -157,10 +279,165 @@ func (w *Watcher) handleRemove(filePath string) {
 	}
 	
 	slog.Info("Automation removed", "file", filePath)
-	id := automationIDFromPath(filePath)
+	id := automationIDFromPath(w.dir, filePath)
 	w.runner.UnloadAutomation(id)
 }
 
+// handleRemoveGroup unloads the automations of a group directory that was
+// removed or moved away. Their files may not get events of their own.
+func (w *Watcher) handleRemoveGroup(dir string) {
+	if !w.inGroup(dir) {
+		return
+	}
+	prefix := automationIDFromPath(w.dir, dir) + "/"
+	for _, automation := range w.runner.ListAutomations() {
+		if strings.HasPrefix(automation.ID, prefix) {
+			slog.Info("Automation removed with its group", "id", automation.ID, "dir", dir)
+			w.runner.UnloadAutomation(automation.ID)
+		}
+	}
+}
+
+// handleBlueprint reloads the instances of a changed blueprint, or of every
+// blueprint when their _common.star changes. Instances of a removed blueprint
+// fail to load and show up in the load errors.
+func (w *Watcher) handleBlueprint(filePath string) {
+	name := filepath.Base(filePath)
+	var blueprints []string
+	switch {
+	case runner.IsCommonFile(name):
+		list, err := w.runner.ListBlueprints()
+		if err != nil {
+			slog.Error("Failed to list blueprints", "error", err)
+			return
+		}
+		for _, blueprint := range list {
+			blueprints = append(blueprints, blueprint.Name)
+		}
+	case strings.HasSuffix(name, ".star") && !runner.IsTestFile(name):
+		blueprints = []string{strings.TrimSuffix(name, ".star")}
+	}
+
+	for _, blueprint := range blueprints {
+		for _, instance := range w.runner.BlueprintInstanceFiles(blueprint) {
+			slog.Info("Blueprint changed, reloading instance", "blueprint", blueprint, "file", instance)
+			if err := w.runner.LoadAutomation(instance); err != nil {
+				slog.Error("Failed to reload automation", "file", instance, "error", err)
+			}
+		}
+	}
+}
+
+func (w *Watcher) handleCommon(filePath string) {
+	dir := filepath.Dir(filePath)
+	slog.Info("Common module changed, reloading its automations", "file", filePath)
+	if err := w.loadDir(dir); err != nil {
+		slog.Error("Failed to reload automations", "dir", dir, "error", err)
+	}
+}
+
+// handleNewGroup watches and loads a new group directory and the groups
+// nested in it, which may have been created before the watch was added
+func (w *Watcher) handleNewGroup(dir string) {
+	slog.Info("New automation group detected", "dir", dir)
+	var files []string
+	for _, groupDir := range append([]string{dir}, w.groupDirs(dir)...) {
+		if err := w.watcher.Add(groupDir); err != nil {
+			slog.Error("Failed to watch automation group", "dir", groupDir, "error", err)
+			continue
+		}
+		groupFiles, err := automationFiles(groupDir)
+		if err != nil {
+			slog.Error("Failed to load automation group", "dir", groupDir, "error", err)
+			continue
+		}
+		files = append(files, groupFiles...)
+	}
+	w.load(files)
+}
+
+// groupDirs lists the group directories below dir, at any depth
+func (w *Watcher) groupDirs(dir string) []string {
+	var dirs []string
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() || path == dir {
+			return nil
+		}
+		if !isGroupDir(entry.Name()) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs
+}
+
+// isGroupPath reports whether path is a group directory inside the
+// automations directory
+func (w *Watcher) isGroupPath(path string) bool {
+	if !w.inGroup(path) {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// inDir reports whether path is the automations directory or below it
+func (w *Watcher) inDir(path string) bool {
+	rel, err := filepath.Rel(w.dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// inGroup reports whether path is below the automations directory without
+// passing through a directory that isn't a group. It only looks at the path,
+// so it also works for paths that were just removed.
+func (w *Watcher) inGroup(path string) bool {
+	rel, err := filepath.Rel(w.dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		if !isGroupDir(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// isGroupDir reports whether a subdirectory name holds grouped automations.
+// Libraries, blueprints, pending submissions and hidden directories are not
+// groups, at any depth.
+func isGroupDir(name string) bool {
+	return name != "lib" && name != runner.BlueprintsDir && name != approval.PendingDir && !strings.HasPrefix(name, ".")
+}
+
+func (w *Watcher) handleSidecar(filePath string) {
+	automationPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".star"
+	if _, err := os.Stat(automationPath); err != nil {
+		return
+	}
+
+	slog.Info("Automation config sidecar changed", "file", filePath)
+	if err := w.runner.LoadAutomation(automationPath); err != nil {
+		slog.Error("Failed to reload automation", "file", automationPath, "error", err)
+	}
+}
+
+func isSidecarFile(name string) bool {
+	for _, ext := range runner.SidecarExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAutomationFile matches Starlark sources and declarative YAML automations,
+// but not their _test.star files
+func isAutomationFile(name string) bool {
+	return (isStarlarkFile(name) && !runner.IsTestFile(name)) || runner.IsDeclarativeFile(name)
+}
+
 func isStarlarkFile(name string) bool {
 	return strings.HasSuffix(name, ".star") || strings.HasSuffix(name, ".lib.star")
 }
@@ -169,9 +446,8 @@ func isLibraryFile(filePath string) bool {
 	return strings.Contains(filePath, "/lib/") && strings.HasSuffix(filePath, ".lib.star")
 }
 
-func automationIDFromPath(filePath string) string {
-	base := filepath.Base(filePath)
-	return strings.TrimSuffix(base, filepath.Ext(base))
+func automationIDFromPath(dir, filePath string) string {
+	return runner.AutomationID(dir, filePath)
 }
 
 func (w *Watcher) reloadLibraries() {
@@ -1,7 +1,14 @@
 package watcher
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/homebrain/engine/internal/runner"
 )
 
 func TestIsStarlarkFile(t *testing.T) {
@@ -69,10 +76,287 @@ func TestAutomationIDFromPath(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := automationIDFromPath(tt.filepath)
+			result := automationIDFromPath("", tt.filepath)
 			if result != tt.expected {
 				t.Errorf("automationIDFromPath(%q) = %q, want %q", tt.filepath, result, tt.expected)
 			}
 		})
 	}
 }
+
+func TestAutomationIDFromPath_Groups(t *testing.T) {
+	tests := []struct {
+		name     string
+		filepath string
+		expected string
+	}{
+		{"Top level", "/app/automations/temperature_sensor.star", "temperature_sensor"},
+		{"Outside automations directory", "/path/to/my_cool_automation.star", "my_cool_automation"},
+		{"Group", "/app/automations/lighting/hallway.star", "lighting/hallway"},
+		{"Nested group", "/app/automations/lighting/upstairs/hallway.star", "lighting/upstairs/hallway"},
+		{"Declarative in group", "/app/automations/lighting/porch.auto.yaml", "lighting/porch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := automationIDFromPath("/app/automations", tt.filepath)
+			if result != tt.expected {
+				t.Errorf("automationIDFromPath(%q) = %q, want %q", tt.filepath, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsSidecarFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		expected bool
+	}{
+		{"YAML sidecar", "/app/automations/hallway.yaml", true},
+		{"YML sidecar", "/app/automations/hallway.yml", true},
+		{"Automation file", "/app/automations/hallway.star", false},
+		{"JSON file", "/app/automations/hallway.json", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := isSidecarFile(tt.filename)
+			if result != tt.expected {
+				t.Errorf("isSidecarFile(%q) = %v, want %v", tt.filename, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAutomationIDFromPath_Declarative(t *testing.T) {
+	if got := automationIDFromPath("", "/app/automations/hallway.auto.yaml"); got != "hallway" {
+		t.Errorf("automationIDFromPath = %q, want hallway", got)
+	}
+}
+
+func TestIsGroupDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		dir      string
+		expected bool
+	}{
+		{"Room group", "bedroom", true},
+		{"Library directory", "lib", false},
+		{"Blueprints", "blueprints", false},
+		{"Pending submissions", "pending", false},
+		{"Hidden directory", ".git", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := isGroupDir(tt.dir); result != tt.expected {
+				t.Errorf("isGroupDir(%q) = %v, want %v", tt.dir, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsAutomationFile_SkipsTests(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		expected bool
+	}{
+		{"Automation", "motion_light.star", true},
+		{"Declarative automation", "hallway.auto.yaml", true},
+		{"Test file", "motion_light_test.star", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := isAutomationFile(tt.file); result != tt.expected {
+				t.Errorf("isAutomationFile(%q) = %v, want %v", tt.file, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadAll_Nested(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"hallway.star":                   `config = {"name": "Hallway"}`,
+		"lighting/hallway.star":          `config = {"name": "Lighting Hallway"}`,
+		"lighting/upstairs/hallway.star": `config = {"name": "Upstairs Hallway"}`,
+		".hidden/ignored.star":           `config = {"name": "Hidden"}`,
+		"lighting/.git/ignored.star":     `config = {"name": "Hidden"}`,
+	}
+	for name, code := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(code+"\n\ndef on_message(topic, payload, ctx):\n    pass\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := runner.New(nil, nil)
+	r.SetAutomationsDir(dir)
+	w, err := New(dir, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, automation := range r.ListAutomations() {
+		ids = append(ids, automation.ID)
+	}
+	slices.Sort(ids)
+	if want := []string{"hallway", "lighting/hallway", "lighting/upstairs/hallway"}; !slices.Equal(ids, want) {
+		t.Errorf("loaded %v, want %v", ids, want)
+	}
+
+	// Removing a group unloads everything below it
+	w.handleRemoveGroup(filepath.Join(dir, "lighting"))
+	if list := r.ListAutomations(); len(list) != 1 || list[0].ID != "hallway" {
+		t.Errorf("after removing lighting/: %+v", list)
+	}
+}
+
+func TestLoadAll_DependencyOrder(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"alarm.star":          `config = {"name": "Alarm", "requires": ["rooms/presence"]}`,
+		"rooms/presence.star": `config = {"name": "Presence"}`,
+		"ping.star":           `config = {"name": "Ping", "requires": ["pong"]}`,
+		"pong.star":           `config = {"name": "Pong", "requires": ["ping"]}`,
+	}
+	for name, code := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(code+"\n\ndef on_message(topic, payload, ctx):\n    pass\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := runner.New(nil, nil)
+	r.SetAutomationsDir(dir)
+	w, err := New(dir, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+	// The group loads first although the top level is read first, and a
+	// cycle is reported as one
+	errs := r.GetLoadErrors()
+	if len(errs) != 2 || errs[0].AutomationID != "ping" || !strings.HasPrefix(errs[0].Error, "dependency cycle: ") {
+		t.Errorf("load errors = %+v", errs)
+	}
+	if list := r.ListAutomations(); len(list) != 2 {
+		t.Errorf("loaded %+v", list)
+	}
+}
+
+func TestBlueprintReload(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, code string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blueprint := func(prefix string) string {
+		return `config = {"name": "` + prefix + `" + params["room"], "description": params["topic"]}
+
+def on_message(topic, payload, ctx):
+    pass
+`
+	}
+	write("blueprints/motion_light.star", blueprint("Motion "))
+	write("kitchen.auto.yaml", "blueprint: motion_light\nparams: {room: Kitchen, topic: kitchen/motion}\n")
+	write("lighting/hall.auto.yaml", "blueprint: motion_light\nparams: {room: Hall, topic: hall/motion}\n")
+
+	r := runner.New(nil, nil)
+	r.SetAutomationsDir(dir)
+	w, err := New(dir, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+	names := func() []string {
+		var names []string
+		for _, automation := range r.ListAutomations() {
+			names = append(names, automation.ID+"="+automation.Config.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+	if got, want := names(), []string{"kitchen=Motion Kitchen", "lighting/hall=Motion Hall"}; !slices.Equal(got, want) {
+		t.Fatalf("loaded %v, want %v", got, want)
+	}
+
+	write("blueprints/motion_light.star", blueprint("Motion light: "))
+	w.handleBlueprint(filepath.Join(dir, "blueprints/motion_light.star"))
+	if got, want := names(), []string{"kitchen=Motion light: Kitchen", "lighting/hall=Motion light: Hall"}; !slices.Equal(got, want) {
+		t.Errorf("after change %v, want %v", got, want)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir := t.TempDir()
+	r := runner.New(nil, nil)
+	w, err := New(filepath.Join(dir, "automations"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	changed := make(chan struct{}, 10)
+	configFile := filepath.Join(dir, "config.yaml")
+	if err := w.WatchFile(configFile, func() { changed <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+	go w.Watch()
+
+	// Other files next to it reach neither onChange nor the automations
+	if err := os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stray.star"), []byte("def on_message(topic, payload, ctx):\n    pass\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-changed:
+		t.Fatal("change reported for another file")
+	default:
+	}
+	if automations := r.ListAutomations(); len(automations) != 0 {
+		t.Errorf("automations = %d, want the stray file ignored", len(automations))
+	}
+
+	// The file doesn't exist yet; editors often save to a temporary file and
+	// rename it over the original
+	tmp := filepath.Join(dir, ".config.yaml.swp")
+	if err := os.WriteFile(tmp, []byte("log_level: debug\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, configFile); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("config file change not reported")
+	}
+}
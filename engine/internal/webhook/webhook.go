@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature styles accepted in WEBHOOK_SECRETS
+const (
+	StyleGitHub = "github" // X-Hub-Signature-256: sha256=<hex HMAC of body>
+	StyleStripe = "stripe" // Stripe-Signature: t=<unix>,v1=<hex HMAC of "t.body">
+	StyleIFTTT  = "ifttt"  // X-Webhook-Secret: <secret> (IFTTT applets can't compute an HMAC)
+)
+
+// stripeTolerance bounds how old a Stripe signature timestamp may be, against replays
+const stripeTolerance = 5 * time.Minute
+
+var (
+	// ErrMissingSignature is returned for requests without the style's signature header
+	ErrMissingSignature = errors.New("missing webhook signature")
+
+	// ErrInvalidSignature is returned when the signature doesn't match the body
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Verifier checks the signature of requests to one webhook
+type Verifier struct {
+	Style  string
+	Secret string
+	now    func() time.Time
+}
+
+// ParseConfig parses "name=style:secret,..." into verifiers by webhook name
+func ParseConfig(s string) (map[string]Verifier, error) {
+	verifiers := make(map[string]Verifier)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(item, "=")
+		style, secret, ok2 := strings.Cut(spec, ":")
+		name, style = strings.TrimSpace(name), strings.TrimSpace(style)
+		if !ok || !ok2 || name == "" || secret == "" {
+			return nil, fmt.Errorf("invalid webhook %q (want name=style:secret)", item)
+		}
+		switch style {
+		case StyleGitHub, StyleStripe, StyleIFTTT:
+		default:
+			return nil, fmt.Errorf("webhook %s: unknown style %q (want %s, %s or %s)", name, style, StyleGitHub, StyleStripe, StyleIFTTT)
+		}
+		verifiers[name] = Verifier{Style: style, Secret: secret}
+	}
+	return verifiers, nil
+}
+
+// Verify checks the request's signature headers against its body
+func (v Verifier) Verify(header http.Header, body []byte) error {
+	switch v.Style {
+	case StyleGitHub:
+		sig := header.Get("X-Hub-Signature-256")
+		if sig == "" {
+			return ErrMissingSignature
+		}
+		hexSig, ok := strings.CutPrefix(sig, "sha256=")
+		if !ok || !v.matches(hexSig, body) {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	case StyleStripe:
+		sig := header.Get("Stripe-Signature")
+		if sig == "" {
+			return ErrMissingSignature
+		}
+		var timestamp string
+		var candidates []string
+		for _, part := range strings.Split(sig, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				candidates = append(candidates, value)
+			}
+		}
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || len(candidates) == 0 {
+			return ErrInvalidSignature
+		}
+		if age := v.clock().Sub(time.Unix(ts, 0)); age > stripeTolerance || age < -stripeTolerance {
+			return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+		}
+		signed := append([]byte(timestamp+"."), body...)
+		for _, candidate := range candidates {
+			if v.matches(candidate, signed) {
+				return nil
+			}
+		}
+		return ErrInvalidSignature
+
+	case StyleIFTTT:
+		secret := header.Get("X-Webhook-Secret")
+		if secret == "" {
+			return ErrMissingSignature
+		}
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(v.Secret)) != 1 {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown signature style %q", v.Style)
+}
+
+// matches reports whether hexSig is the HMAC-SHA256 of data
+func (v Verifier) matches(hexSig string, data []byte) bool {
+	got, err := hex.DecodeString(hexSig)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(got, Sign(v.Secret, data))
+}
+
+func (v Verifier) clock() time.Time {
+	if v.now != nil {
+		return v.now()
+	}
+	return time.Now()
+}
+
+// Sign returns the HMAC-SHA256 of data, as used by the GitHub and Stripe styles
+func Sign(secret string, data []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
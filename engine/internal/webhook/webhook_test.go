@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	verifiers, err := ParseConfig("github_push=github:s3cret, payments=stripe:whsec_abc,,doorbell=ifttt:a:b")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(verifiers) != 3 {
+		t.Fatalf("got %d verifiers, want 3", len(verifiers))
+	}
+	if v := verifiers["doorbell"]; v.Style != StyleIFTTT || v.Secret != "a:b" {
+		t.Errorf("doorbell = %+v", v)
+	}
+
+	for _, bad := range []string{"noequals", "x=github", "x=github:", "x=gitlab:s", "=github:s"} {
+		if _, err := ParseConfig(bad); err == nil {
+			t.Errorf("ParseConfig(%q) should fail", bad)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"action":"opened"}`)
+	now := time.Unix(1760000000, 0)
+	sig := func(data string) string { return hex.EncodeToString(Sign("s3cret", []byte(data))) }
+	stripeHeader := func(ts time.Time, data string) string {
+		return fmt.Sprintf("t=%d,v1=%s", ts.Unix(), sig(fmt.Sprintf("%d.%s", ts.Unix(), data)))
+	}
+
+	tests := []struct {
+		name    string
+		style   string
+		header  map[string]string
+		wantErr error
+	}{
+		{"github valid", StyleGitHub, map[string]string{"X-Hub-Signature-256": "sha256=" + sig(string(body))}, nil},
+		{"github missing", StyleGitHub, nil, ErrMissingSignature},
+		{"github wrong body", StyleGitHub, map[string]string{"X-Hub-Signature-256": "sha256=" + sig("other")}, ErrInvalidSignature},
+		{"github no prefix", StyleGitHub, map[string]string{"X-Hub-Signature-256": sig(string(body))}, ErrInvalidSignature},
+		{"stripe valid", StyleStripe, map[string]string{"Stripe-Signature": stripeHeader(now, string(body))}, nil},
+		{"stripe rotated secret", StyleStripe, map[string]string{"Stripe-Signature": stripeHeader(now, string(body)) + ",v1=00ff"}, nil},
+		{"stripe stale", StyleStripe, map[string]string{"Stripe-Signature": stripeHeader(now.Add(-10*time.Minute), string(body))}, ErrInvalidSignature},
+		{"stripe missing", StyleStripe, nil, ErrMissingSignature},
+		{"stripe no timestamp", StyleStripe, map[string]string{"Stripe-Signature": "v1=" + sig(string(body))}, ErrInvalidSignature},
+		{"ifttt valid", StyleIFTTT, map[string]string{"X-Webhook-Secret": "s3cret"}, nil},
+		{"ifttt wrong", StyleIFTTT, map[string]string{"X-Webhook-Secret": "guess"}, ErrInvalidSignature},
+		{"ifttt missing", StyleIFTTT, nil, ErrMissingSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			v := Verifier{Style: tt.style, Secret: "s3cret", now: func() time.Time { return now }}
+			err := v.Verify(header, body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,58 +1,174 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/homebrain/engine/internal/approval"
+	"github.com/homebrain/engine/internal/auth"
+	"github.com/homebrain/engine/internal/connector"
+	"github.com/homebrain/engine/internal/diagnostics"
+	"github.com/homebrain/engine/internal/enginelog"
+	"github.com/homebrain/engine/internal/gitsync"
+	"github.com/homebrain/engine/internal/gpio"
+	"github.com/homebrain/engine/internal/grafana"
 	"github.com/homebrain/engine/internal/mqtt"
+	"github.com/homebrain/engine/internal/notify"
+	"github.com/homebrain/engine/internal/presence"
 	"github.com/homebrain/engine/internal/runner"
+	"github.com/homebrain/engine/internal/secrets"
 	"github.com/homebrain/engine/internal/state"
 	"github.com/homebrain/engine/internal/watcher"
+	"github.com/homebrain/engine/internal/webhook"
 )
 
+// diagnosticsTimeout bounds a GET /diagnostics run
+const diagnosticsTimeout = 10 * time.Second
+
 func main() {
-	// Setup logging
-	logLevel := os.Getenv("LOG_LEVEL")
-	var level slog.Level
-	switch logLevel {
-	case "debug":
-		level = slog.LevelDebug
-	case "warn":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	default:
-		level = slog.LevelInfo
-	}
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	// "engine test <file.star>..." runs automation tests instead of the engine
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Exit(runTestCommand(os.Args[2:]))
+	}
+	// "engine state export|import" copies state out of or into a running engine
+	if len(os.Args) > 1 && os.Args[1] == "state" {
+		os.Exit(runStateCommand(os.Args[2:], os.Getenv, os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	// Settings come from the environment, then the config file
+	configFile := defaultConfigFile
+	if v := os.Getenv("CONFIG_FILE"); v != "" {
+		configFile = v
+	}
+	settings, err := loadSettings(configFile, os.Getenv, os.Environ())
+	if err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(2)
+	}
+	getenv := settings.Getenv
+
+	// Setup logging; the level follows config file changes
+	var level slog.LevelVar
+	level.Set(parseLogLevel(getenv("LOG_LEVEL")))
+	// LOG_FILE also writes logs to a file, rotated by size (LOG_FILE_MAX_MB,
+	// LOG_FILE_BACKUPS); LOG_FORMAT=json writes one JSON object per line for
+	// shipping to Loki or ELK
+	var output io.Writer = os.Stdout
+	if path := getenv("LOG_FILE"); path != "" {
+		maxSize := int64(enginelog.DefaultMaxFileSize)
+		if mb, err := strconv.Atoi(getenv("LOG_FILE_MAX_MB")); err == nil && mb > 0 {
+			maxSize = int64(mb) << 20
+		}
+		backups := enginelog.DefaultFileBackups
+		if n, err := strconv.Atoi(getenv("LOG_FILE_BACKUPS")); err == nil && n >= 0 {
+			backups = n
+		}
+		logFile, err := enginelog.OpenRotatingFile(path, maxSize, backups)
+		if err != nil {
+			slog.Error("Failed to open LOG_FILE", "path", path, "error", err)
+			os.Exit(1)
+		}
+		defer logFile.Close()
+		output = io.MultiWriter(os.Stdout, logFile)
+	}
+	handlerOptions := &slog.HandlerOptions{Level: &level}
+	var handler slog.Handler = slog.NewTextHandler(output, handlerOptions)
+	if getenv("LOG_FORMAT") == "json" {
+		handler = slog.NewJSONHandler(output, handlerOptions)
+	}
+	// Engine logs are also kept in memory for GET /engine-logs
+	engineLogs := enginelog.NewBuffer(enginelog.DefaultSize)
+	logger := slog.New(enginelog.NewHandler(handler, engineLogs))
 	slog.SetDefault(logger)
 
-	slog.Info("Starting Homebrain Automation Engine")
+	if settings.found {
+		slog.Info("Config file loaded", "path", settings.path)
+	}
+
+	cfg, err := loadConfig(os.Args[1:], getenv)
+	if err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(2)
+	}
+
+	slog.Info("Starting Homebrain Automation Engine", "automations", cfg.AutomationsPath, "state", cfg.StatePath)
 
 	// Initialize state store
-	stateStore, err := state.New("/app/state/homebrain.db")
+	stateStore, err := state.New(cfg.StatePath)
 	if err != nil {
 		slog.Error("Failed to initialize state store", "error", err)
 		os.Exit(1)
 	}
 	defer stateStore.Close()
 
+	// Bring the state schema up to date (backs up the DB first if needed)
+	if err := stateStore.Migrate(); err != nil {
+		slog.Error("Failed to migrate state store", "error", err)
+		os.Exit(1)
+	}
+
+	// Throttles of removed automations are never pruned by their own calls
+	if pruned, err := stateStore.PruneThrottles(time.Now()); err != nil {
+		slog.Warn("Failed to prune throttles", "error", err)
+	} else if pruned > 0 {
+		slog.Info("Pruned expired throttles", "count", pruned)
+	}
+
 	// Initialize MQTT client
-	broker := os.Getenv("MQTT_BROKER")
+	broker := getenv("MQTT_BROKER")
 	if broker == "" {
 		slog.Error("MQTT_BROKER environment variable is required")
 		os.Exit(1)
 	}
 
+	// Retained availability on MQTT_STATUS_TOPIC ("off" disables it), with
+	// the offline payload as the last will
+	statusTopic := mqtt.DefaultStatusTopic
+	if v := getenv("MQTT_STATUS_TOPIC"); v != "" {
+		statusTopic = v
+	}
+	if statusTopic == "off" {
+		statusTopic = ""
+	}
+
+	// Additional brokers, addressed by automations as "<name>:<topic>"
+	brokers, err := mqttBrokers(getenv)
+	if err != nil {
+		slog.Error("Invalid MQTT_BROKERS", "error", err)
+		os.Exit(1)
+	}
+
 	mqttClient, err := mqtt.New(mqtt.Config{
 		Broker:   broker,
-		Username: os.Getenv("MQTT_USERNAME"),
-		Password: os.Getenv("MQTT_PASSWORD"),
+		Username: getenv("MQTT_USERNAME"),
+		Password: getenv("MQTT_PASSWORD"),
 		ClientID: "homebrain-engine",
+
+		CACert:             getenv("MQTT_CA_CERT"),
+		ClientCert:         getenv("MQTT_CLIENT_CERT"),
+		ClientKey:          getenv("MQTT_CLIENT_KEY"),
+		InsecureSkipVerify: getenv("MQTT_TLS_INSECURE") == "true",
+
+		StatusTopic:    statusTopic,
+		OnlinePayload:  getenv("MQTT_STATUS_ONLINE"),
+		OfflinePayload: getenv("MQTT_STATUS_OFFLINE"),
+
+		Brokers: brokers,
 	})
 	if err != nil {
 		slog.Error("Failed to connect to MQTT broker", "error", err)
@@ -61,35 +177,488 @@ func main() {
 	defer mqttClient.Disconnect()
 
 	slog.Info("Connected to MQTT broker", "broker", broker)
+	for name, b := range brokers {
+		slog.Info("Connecting to additional MQTT broker", "name", name, "broker", b.Broker)
+	}
+
+	// Discovered topics survive restarts; TOPIC_RETENTION (default 30 days,
+	// 0 = forever) prunes topics that have gone quiet
+	topicRetention := 30 * 24 * time.Hour
+	if v := getenv("TOPIC_RETENTION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			topicRetention = d
+		} else {
+			slog.Error("Invalid TOPIC_RETENTION", "error", err)
+		}
+	}
+	if err := mqttClient.PersistTopics(stateStore, time.Minute, topicRetention); err != nil {
+		slog.Error("Failed to load discovered topics", "error", err)
+	}
 
 	// Initialize automation runner
 	automationRunner := runner.New(mqttClient, stateStore)
+	if getenv("WORKERS") != "" || getenv("HIGH_PRIORITY_WORKERS") != "" {
+		normalWorkers, _ := strconv.Atoi(getenv("WORKERS"))
+		highWorkers, _ := strconv.Atoi(getenv("HIGH_PRIORITY_WORKERS"))
+		automationRunner.ConfigureWorkers(normalWorkers, highWorkers)
+	}
+
+	// LOG_PERSIST=true keeps automation logs in the state database across
+	// restarts, up to LOG_PERSIST_MAX entries (default 100000)
+	if getenv("LOG_PERSIST") == "true" {
+		limit := runner.DefaultStoredLogs
+		if v := getenv("LOG_PERSIST_MAX"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				limit = n
+			} else {
+				slog.Error("Invalid LOG_PERSIST_MAX", "value", v)
+			}
+		}
+		if err := automationRunner.PersistLogs(limit); err != nil {
+			slog.Error("Failed to restore automation logs", "error", err)
+		}
+	}
+
+	// Watchdog for stalled dispatch pools, scheduler and MQTT callbacks
+	// (WATCHDOG=off disables it); WATCHDOG_RESTART=true also self-heals
+	watchdogEnabled := getenv("WATCHDOG") != "off"
+	if watchdogEnabled {
+		interval, _ := time.ParseDuration(getenv("WATCHDOG_INTERVAL"))
+		threshold, _ := time.ParseDuration(getenv("WATCHDOG_THRESHOLD"))
+		automationRunner.StartWatchdog(interval, threshold, getenv("WATCHDOG_RESTART") == "true")
+	}
+
+	// Optional GPIO subsystem for directly wired buttons and relays
+	if getenv("GPIO_INPUTS") != "" || getenv("GPIO_OUTPUTS") != "" {
+		gpioController, err := setupGPIO(mqttClient, getenv)
+		if err != nil {
+			slog.Error("Failed to initialize GPIO", "error", err)
+		} else {
+			defer gpioController.Close()
+			automationRunner.SetGPIO(gpioController)
+			slog.Info("GPIO enabled")
+		}
+	}
+
+	// Optional NATS/Kafka connectors. Incoming messages are injected as
+	// "nats/<subject>" and "kafka/<topic>"; publishing uses ctx.publish(..., sink=...)
+	if url := getenv("NATS_URL"); url != "" {
+		natsConn, err := connector.NewNATS(url, connector.ParseList(getenv("NATS_SUBJECTS")), mqttClient.Inject)
+		if err != nil {
+			slog.Error("Failed to initialize NATS connector", "error", err)
+		} else {
+			defer natsConn.Close()
+			automationRunner.AddSink(natsConn)
+			slog.Info("NATS connector enabled", "url", url)
+		}
+	}
+	if brokers := connector.ParseList(getenv("KAFKA_BROKERS")); len(brokers) > 0 {
+		groupID := getenv("KAFKA_GROUP_ID")
+		if groupID == "" {
+			groupID = "homebrain-engine"
+		}
+		kafkaConn, err := connector.NewKafka(brokers, groupID, connector.ParseList(getenv("KAFKA_TOPICS")), mqttClient.Inject)
+		if err != nil {
+			slog.Error("Failed to initialize Kafka connector", "error", err)
+		} else {
+			defer kafkaConn.Close()
+			automationRunner.AddSink(kafkaConn)
+			slog.Info("Kafka connector enabled", "brokers", brokers)
+		}
+	}
+
+	// Compiled Starlark programs are cached on disk so restarts skip recompiling
+	// unchanged automations and libraries. STARLARK_CACHE_DIR=off disables it.
+	programCacheDir := filepath.Join(cfg.StateDir(), "starlark-cache")
+	if v := getenv("STARLARK_CACHE_DIR"); v != "" {
+		programCacheDir = v
+	}
+	if programCacheDir != "off" {
+		if err := automationRunner.SetProgramCache(programCacheDir); err != nil {
+			slog.Warn("Starlark program cache disabled", "error", err)
+		}
+	}
+
+	// Secrets for ctx.secret: SECRETS_FILE (YAML name: value pairs) and
+	// HOMEBRAIN_SECRET_<NAME> environment variables
+	secretsFile := "/app/secrets.yaml"
+	if v := getenv("SECRETS_FILE"); v != "" {
+		secretsFile = v
+	}
+	if store, err := secrets.Load(secretsFile, os.Environ()); err != nil {
+		slog.Error("Failed to load secrets", "error", err)
+	} else {
+		automationRunner.SetSecrets(store)
+		if names := store.Names(); len(names) > 0 {
+			slog.Info("Secrets loaded", "count", len(names))
+		}
+	}
+
+	// Profiles (home, away, ...): PROFILES lists them, default first. The
+	// active one is switched with PUT /profile, ctx.set_profile or a message
+	// on PROFILE_TOPIC/set, and published retained on PROFILE_TOPIC.
+	if v := getenv("PROFILES"); v != "" {
+		if err := automationRunner.SetProfiles(connector.ParseList(v)); err != nil {
+			slog.Error("Invalid PROFILES", "error", err)
+		}
+	}
+	profileTopic := "homebrain/profile"
+	if v := getenv("PROFILE_TOPIC"); v != "" {
+		profileTopic = v
+	}
+	if profileTopic != "off" {
+		publishProfile := func(profile string) {
+			if err := mqttClient.Publish(profileTopic, []byte(profile), mqtt.PublishOptions{QoS: mqtt.DefaultQoS, Retain: true}); err != nil {
+				slog.Error("Failed to publish profile", "error", err)
+			}
+		}
+		automationRunner.OnProfileSwitch(publishProfile)
+		publishProfile(automationRunner.ActiveProfile())
+		err := mqttClient.Subscribe(profileTopic+"/set", func(_ string, payload []byte) {
+			if err := automationRunner.SetActiveProfile(strings.TrimSpace(string(payload)), "mqtt"); err != nil {
+				slog.Warn("Rejected profile switch", "error", err)
+			}
+		})
+		if err != nil {
+			slog.Error("Failed to subscribe to profile topic", "error", err)
+		}
+	}
+	slog.Info("Active profile", "profile", automationRunner.ActiveProfile())
+
+	// Automation IDs are paths relative to the automations directory
+	automationRunner.SetAutomationsDir(cfg.AutomationsPath)
 
 	// Load library modules
-	if err := automationRunner.LoadLibraries("/app/automations"); err != nil {
+	if err := automationRunner.LoadLibraries(cfg.AutomationsPath); err != nil {
 		slog.Error("Failed to load library modules", "error", err)
 	} else {
 		slog.Info("Library modules loaded successfully")
 	}
 
 	// Initialize file watcher
-	fileWatcher, err := watcher.New("/app/automations", automationRunner)
+	fileWatcher, err := watcher.New(cfg.AutomationsPath, automationRunner)
 	if err != nil {
 		slog.Error("Failed to initialize file watcher", "error", err)
 		os.Exit(1)
 	}
 	defer fileWatcher.Close()
 
+	// Conflict window and loop guard; also applied when the config file changes
+	applyReloadable(getenv, &level, automationRunner)
+
+	// Bytes of each payload, log message and run result kept in memory
+	// (RETAINED_PAYLOAD_BYTES, default 64 KiB, 0 = no limit); longer ones are truncated
+	payloadLimit := 64 << 10
+	if v := getenv("RETAINED_PAYLOAD_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			payloadLimit = n
+		} else {
+			slog.Error("Invalid RETAINED_PAYLOAD_BYTES", "value", v)
+		}
+	}
+	mqttClient.SetMessagePayloadLimit(payloadLimit)
+	automationRunner.SetPayloadLimit(payloadLimit)
+
+	// Default handler execution limit; automations override it with timeout_seconds
+	if v := getenv("HANDLER_TIMEOUT"); v != "" {
+		if timeout, err := time.ParseDuration(v); err == nil && timeout >= 0 {
+			automationRunner.SetHandlerTimeout(timeout)
+		} else {
+			slog.Error("Invalid HANDLER_TIMEOUT", "value", v)
+		}
+	}
+
+	// Default handler step limit; automations override it with max_steps
+	if v := getenv("HANDLER_MAX_STEPS"); v != "" {
+		if steps, err := strconv.ParseUint(v, 10, 64); err == nil {
+			automationRunner.SetMaxSteps(steps)
+		} else {
+			slog.Error("Invalid HANDLER_MAX_STEPS", "value", v)
+		}
+	}
+
+	// Strict permissions: undeclared global reads, publishes and library use are denied
+	if getenv("STRICT_PERMISSIONS") == "true" {
+		automationRunner.SetStrictMode(true)
+		slog.Info("Strict permission mode enabled")
+	}
+
+	// Notification channels for ctx.notify
+	notifier := notify.New()
+	if host := getenv("SMTP_HOST"); host != "" {
+		port, _ := strconv.Atoi(getenv("SMTP_PORT"))
+		email, err := notify.NewEmail(notify.EmailConfig{
+			Host:     host,
+			Port:     port,
+			Username: getenv("SMTP_USERNAME"),
+			Password: getenv("SMTP_PASSWORD"),
+			From:     getenv("SMTP_FROM"),
+			To:       connector.ParseList(getenv("SMTP_TO")),
+			TLS:      getenv("SMTP_TLS"),
+		})
+		if err != nil {
+			slog.Error("Failed to configure email notifications", "error", err)
+		} else {
+			notifier.Register(email)
+			slog.Info("Email notifications enabled", "host", host)
+		}
+	}
+	if topic := getenv("NTFY_TOPIC"); topic != "" {
+		ntfy, err := notify.NewNtfy(notify.NtfyConfig{
+			URL:   getenv("NTFY_URL"),
+			Topic: topic,
+			Token: getenv("NTFY_TOKEN"),
+		})
+		if err != nil {
+			slog.Error("Failed to configure ntfy notifications", "error", err)
+		} else {
+			notifier.Register(ntfy)
+			slog.Info("ntfy notifications enabled", "topic", topic)
+		}
+	}
+	if token := getenv("TELEGRAM_BOT_TOKEN"); token != "" {
+		telegram, err := notify.NewTelegram(notify.TelegramConfig{
+			BotToken: token,
+			ChatID:   getenv("TELEGRAM_CHAT_ID"),
+		})
+		if err != nil {
+			slog.Error("Failed to configure Telegram notifications", "error", err)
+		} else {
+			notifier.Register(telegram)
+			slog.Info("Telegram notifications enabled")
+		}
+	}
+	if token := getenv("PUSHOVER_TOKEN"); token != "" {
+		pushover, err := notify.NewPushover(notify.PushoverConfig{
+			Token: token,
+			User:  getenv("PUSHOVER_USER"),
+		})
+		if err != nil {
+			slog.Error("Failed to configure Pushover notifications", "error", err)
+		} else {
+			notifier.Register(pushover)
+			slog.Info("Pushover notifications enabled")
+		}
+	}
+	if channel := getenv("NOTIFY_DEFAULT"); channel != "" {
+		if err := notifier.SetDefault(channel); err != nil {
+			slog.Error("Invalid NOTIFY_DEFAULT", "error", err)
+		}
+	}
+	automationRunner.SetNotifier(notifier)
+
+	// Per-automation data directories behind ctx.file
+	dataDir := getenv("AUTOMATION_DATA_DIR")
+	if dataDir == "" {
+		dataDir = filepath.Join(cfg.StateDir(), "files")
+	}
+	dataLimit, _ := strconv.ParseInt(getenv("AUTOMATION_DATA_LIMIT"), 10, 64)
+	automationRunner.SetDataDir(dataDir, dataLimit)
+
+	// Home location for solar schedules ("@sunset", "daily 30 minutes before sunrise")
+	if lat, lon := getenv("HOME_LATITUDE"), getenv("HOME_LONGITUDE"); lat != "" && lon != "" {
+		latitude, latErr := strconv.ParseFloat(lat, 64)
+		longitude, lonErr := strconv.ParseFloat(lon, 64)
+		if err := errors.Join(latErr, lonErr); err != nil {
+			slog.Error("Invalid HOME_LATITUDE/HOME_LONGITUDE", "error", err)
+		} else if err := automationRunner.SetHomeLocation(latitude, longitude); err != nil {
+			slog.Error("Invalid HOME_LATITUDE/HOME_LONGITUDE", "error", err)
+		}
+	}
+
+	// Optional per-topic publish throttle, e.g. PUBLISH_THROTTLE=zigbee2mqtt/+/set=500ms
+	if v := getenv("PUBLISH_THROTTLE"); v != "" {
+		rules, err := runner.ParseThrottleRules(v)
+		if err != nil {
+			slog.Error("Invalid PUBLISH_THROTTLE", "error", err)
+		} else {
+			automationRunner.SetPublishThrottle(rules)
+		}
+	}
+
+	// Optional warm-up: hold back triggers while retained messages flood in
+	if v := getenv("WARMUP_MAX"); v != "" {
+		maxWarmup, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Error("Invalid WARMUP_MAX", "error", err)
+		} else {
+			quiet := 2 * time.Second
+			if q, err := time.ParseDuration(getenv("WARMUP_QUIET")); err == nil {
+				quiet = q
+			}
+			automationRunner.StartWarmup(quiet, maxWarmup, getenv("WARMUP_MODE") != "flag")
+		}
+	}
+
+	// Code submitted through the API; AGENT_APPROVAL=true stages agent-authored
+	// automations until a human approves them
+	approvalQueue, err := approval.New(cfg.AutomationsPath, getenv("AGENT_APPROVAL") == "true")
+	if err != nil {
+		slog.Error("Failed to initialize approval queue", "error", err)
+		os.Exit(1)
+	}
+
+	// Incoming webhooks, e.g. WEBHOOK_SECRETS=github_push=github:<secret>.
+	// Only listed webhooks are accepted and every request must be signed.
+	webhooks, err := webhook.ParseConfig(getenv("WEBHOOK_SECRETS"))
+	if err != nil {
+		slog.Error("Invalid WEBHOOK_SECRETS", "error", err)
+	}
+
+	// API authentication, e.g. API_TOKENS=agent=admin:<secret>,grafana=read:<secret>.
+	// Without static tokens the API stays open.
+	apiTokens, err := auth.ParseTokens(getenv("API_TOKENS"))
+	if err != nil {
+		slog.Error("Invalid API_TOKENS", "error", err)
+		os.Exit(1)
+	}
+	authenticator, err := auth.New(apiTokens, stateStore)
+	if err != nil {
+		slog.Error("Failed to load API tokens", "error", err)
+		os.Exit(1)
+	}
+	if authenticator.Enabled() {
+		slog.Info("API authentication enabled", "static_tokens", len(apiTokens))
+	} else {
+		slog.Warn("API authentication disabled; set API_TOKENS to require tokens")
+	}
+
+	// Optional cold-start seeding: copy retained topics into global state before
+	// automations start, e.g. STATE_SEED=zigbee2mqtt/living_room_temp:temperature=sensors.living_room.temp
+	if v := getenv("STATE_SEED"); v != "" {
+		seeds, err := runner.ParseStateSeeds(v)
+		if err != nil {
+			slog.Error("Invalid STATE_SEED", "error", err)
+		} else {
+			wait := 5 * time.Second
+			if d, err := time.ParseDuration(getenv("STATE_SEED_TIMEOUT")); err == nil {
+				wait = d
+			}
+			automationRunner.SeedGlobalState(seeds, wait)
+		}
+	}
+
+	// Presence: PRESENCE_FILE lists persons and their device trackers
+	presenceFile := "/app/presence.yaml"
+	if v := getenv("PRESENCE_FILE"); v != "" {
+		presenceFile = v
+	}
+	var presenceMonitor *presence.Monitor
+	if presenceCfg, err := presence.Load(presenceFile); err != nil {
+		slog.Error("Presence tracking disabled", "error", err)
+	} else if presenceCfg != nil {
+		automationRunner.SetPresence(presenceCfg.Names())
+		presenceMonitor = presence.NewMonitor(presenceCfg, automationRunner.PresenceChanged)
+		slog.Info("Presence tracking enabled", "persons", presenceCfg.Names())
+	}
+
+	// Optional Git sync: GIT_SYNC_REPO is pulled into the automations directory
+	// at startup, every GIT_SYNC_INTERVAL and on POST /sync
+	syncer, err := setupGitSync(cfg.AutomationsPath, getenv)
+	if err != nil {
+		slog.Error("Git sync disabled", "error", err)
+	} else if syncer != nil {
+		syncer.Sync(context.Background())
+		syncer.Start(context.Background())
+	}
+
 	// Load existing automations
 	if err := fileWatcher.LoadAll(); err != nil {
 		slog.Error("Failed to load automations", "error", err)
 	}
+	if stats := automationRunner.ProgramCacheStats(); stats.Hits+stats.Misses > 0 {
+		slog.Info("Starlark program cache", "hits", stats.Hits, "compiled", stats.Misses)
+	}
+
+	// Config file changes apply the settings that can change at runtime. The
+	// file is watched even if it doesn't exist yet, so creating it applies it;
+	// only a missing directory leaves it unwatched.
+	if err := fileWatcher.WatchFile(settings.path, func() {
+		settings = settings.reload(&level, automationRunner)
+	}); errors.Is(err, fs.ErrNotExist) && !settings.found {
+		slog.Debug("Config file directory missing, not watching", "path", settings.path)
+	} else if err != nil {
+		slog.Error("Failed to watch config file", "path", settings.path, "error", err)
+	}
 
 	// Start file watcher
 	go fileWatcher.Watch()
 
+	// Presence tracking starts once automations are loaded, so their
+	// on_presence_change handlers see the first changes. Tracker states
+	// retained by the broker arrived on connect and come from the buffer.
+	if presenceMonitor != nil {
+		presenceMonitor.Start(mqttClient.Watch, mqttClient.GetMessages)
+		defer presenceMonitor.Close()
+	}
+
+	// Self-test behind /diagnostics, also run once at startup.
+	// NTP_SERVER (default pool.ntp.org, "off" to skip) is used for the clock check.
+	ntpServer := diagnostics.DefaultNTPServer
+	if v := getenv("NTP_SERVER"); v != "" {
+		ntpServer = v
+	}
+	if ntpServer == "off" {
+		ntpServer = ""
+	}
+	checks := []diagnostics.Check{
+		diagnostics.BrokerRoundTrip(mqttClient),
+		diagnostics.StateReadWrite(stateStore),
+		diagnostics.ClockSkew(ntpServer),
+		diagnostics.DiskSpace(cfg.StateDir()),
+		diagnostics.AutomationLoadErrors(func() []diagnostics.LoadError {
+			var errs []diagnostics.LoadError
+			for _, e := range automationRunner.GetLoadErrors() {
+				errs = append(errs, diagnostics.LoadError{File: e.File, Error: e.Error})
+			}
+			return errs
+		}),
+	}
+	if len(brokers) > 0 {
+		checks = append(checks, diagnostics.AdditionalBrokers(mqttClient.Brokers))
+	}
+	if watchdogEnabled {
+		checks = append(checks, diagnostics.WatchdogStalls(func() []runner.Stall {
+			return automationRunner.GetWatchdogStatus().Stalls
+		}))
+	}
+	go func() {
+		report := diagnostics.Run(context.Background(), checks, diagnosticsTimeout)
+		for _, result := range report.Checks {
+			switch result.Status {
+			case diagnostics.StatusFail:
+				slog.Error("Startup self-test failed", "check", result.Name, "detail", result.Detail)
+			case diagnostics.StatusWarn:
+				slog.Warn("Startup self-test warning", "check", result.Name, "detail", result.Detail)
+			}
+		}
+		slog.Info("Startup self-test finished", "status", report.Status)
+	}()
+
+	// HTTPS for the API: a configured certificate, or one generated on first
+	// boot and kept next to the state database
+	if cfg.TLSSelfSigned {
+		certPath, keyPath, generated, err := ensureSelfSignedCert(filepath.Join(cfg.StateDir(), "tls"), time.Now())
+		if err != nil {
+			slog.Error("Failed to create self-signed certificate", "error", err)
+			os.Exit(1)
+		}
+		if generated {
+			slog.Info("Generated self-signed API certificate", "cert", certPath)
+		}
+		cfg.TLSCertPath, cfg.TLSKeyPath = certPath, keyPath
+	}
+	if cfg.TLS() {
+		cert, err := loadCertificate(cfg.TLSCertPath, cfg.TLSKeyPath)
+		if err != nil {
+			slog.Error("Invalid API TLS certificate", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Serving the API over HTTPS", "cert", cfg.TLSCertPath, "expires", cert.NotAfter.Format(time.DateOnly), "sha256", certFingerprint(cert))
+	}
+
 	// Start HTTP API for agent communication
-	go startAPI(automationRunner, mqttClient, stateStore)
+	go startAPI(cfg, automationRunner, mqttClient, stateStore, approvalQueue, webhooks, engineLogs, checks, authenticator, syncer)
 
 	// Wait for shutdown signal
 	sigChan := make(chan os.Signal, 1)
@@ -97,9 +666,86 @@ func main() {
 	<-sigChan
 
 	slog.Info("Shutting down Homebrain Automation Engine")
+	if err := automationRunner.StopLogs(); err != nil {
+		slog.Error("Failed to persist automation logs", "error", err)
+	}
+}
+
+// setupGitSync configures the automations Git sync from GIT_SYNC_* environment
+// variables. It returns nil when GIT_SYNC_REPO is unset.
+func setupGitSync(dir string, getenv func(string) string) (*gitsync.Syncer, error) {
+	repo := getenv("GIT_SYNC_REPO")
+	if repo == "" {
+		return nil, nil
+	}
+	cfg := gitsync.Config{Repo: repo, Branch: getenv("GIT_SYNC_BRANCH"), Interval: gitsync.DefaultInterval}
+	if v := getenv("GIT_SYNC_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GIT_SYNC_INTERVAL: %w", err)
+		}
+		cfg.Interval = interval
+	}
+
+	// Report why changed files won't load; the watcher reloads them either way
+	check := func(path string) error {
+		name := filepath.Base(path)
+		declarative := runner.IsDeclarativeFile(name)
+		if !declarative && !strings.HasSuffix(name, ".star") || runner.IsTestFile(name) || runner.IsCommonFile(name) {
+			return nil
+		}
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// Blueprint instances look their blueprint up from the top directory
+		fileType, codeDir := "automation", filepath.Dir(path)
+		switch {
+		case declarative:
+			fileType, codeDir = "declarative", dir
+		case strings.HasSuffix(name, ".lib.star"):
+			fileType = "library"
+		}
+		if result := runner.ValidateCodeIn(string(code), fileType, codeDir); !result.Valid {
+			return errors.New(strings.Join(result.Errors, "; "))
+		}
+		return nil
+	}
+	return gitsync.New(dir, cfg, check)
 }
 
-func startAPI(r *runner.Runner, mqttClient *mqtt.Client, stateStore *state.Store) {
+// setupGPIO configures pins from GPIO_* environment variables. Input changes
+// are injected into MQTT dispatch so automations subscribe to them like any topic.
+func setupGPIO(mqttClient *mqtt.Client, getenv func(string) string) (*gpio.Controller, error) {
+	inputs, err := gpio.ParsePinMap(getenv("GPIO_INPUTS"))
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := gpio.ParsePins(getenv("GPIO_OUTPUTS"))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := gpio.Config{Inputs: inputs, Outputs: outputs}
+	if v := getenv("GPIO_POLL_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.PollInterval = interval
+	}
+	if v := getenv("GPIO_BASE"); v != "" {
+		base, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Base = base
+	}
+
+	return gpio.New(cfg, mqttClient.Inject)
+}
+
+func startAPI(cfg Config, r *runner.Runner, mqttClient *mqtt.Client, stateStore *state.Store, approvalQueue *approval.Queue, webhooks map[string]webhook.Verifier, engineLogs *enginelog.Buffer, checks []diagnostics.Check, authenticator *auth.Authenticator, syncer *gitsync.Syncer) {
 	mux := http.NewServeMux()
 
 	// Health check
@@ -112,28 +758,544 @@ func startAPI(r *runner.Runner, mqttClient *mqtt.Client, stateStore *state.Store
 	mux.HandleFunc("GET /automations", func(w http.ResponseWriter, req *http.Request) {
 		automations := r.ListAutomations()
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(automations)
+		json.NewEncoder(w).Encode(automations)
+	})
+
+	// Create or update an automation. Requests from the agent are staged for
+	// approval when AGENT_APPROVAL is enabled.
+	mux.HandleFunc("POST /automations", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Filename string `json:"filename"`
+			Code     string `json:"code"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		submitAutomation(w, approvalQueue, cfg.AutomationsPath, body.Filename, body.Code, requestRole(req))
+	})
+
+	// Replace the code of automation {id} ({id}.star), subject to the same approval rules
+	mux.HandleFunc("PUT /automations/{id}", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		submitAutomation(w, approvalQueue, cfg.AutomationsPath, req.PathValue("id")+".star", body.Code, requestRole(req))
+	})
+
+	// Delete an automation file; the watcher unloads it
+	mux.HandleFunc("DELETE /automations/{id}", func(w http.ResponseWriter, req *http.Request) {
+		err := approvalQueue.Delete(req.PathValue("id"), requestRole(req))
+		switch {
+		case errors.Is(err, approval.ErrNotDeployed):
+			http.Error(w, "Automation not found", http.StatusNotFound)
+		case errors.Is(err, approval.ErrApprovalRequired):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			slog.Info("Automation deleted via API", "id", req.PathValue("id"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	// Blueprints (automation templates in automations/blueprints) and their instances
+	mux.HandleFunc("GET /blueprints", func(w http.ResponseWriter, req *http.Request) {
+		blueprints, err := r.ListBlueprints()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blueprints)
+	})
+
+	// Instantiate a blueprint as automation {id} ({id}.auto.yaml), subject to
+	// the same approval rules as other automations
+	mux.HandleFunc("POST /blueprints/{name}/instances", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			ID     string         `json:"id"`
+			Params map[string]any `json:"params"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.ID == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		code, err := runner.BlueprintInstanceYAML(req.PathValue("name"), body.Params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		submitAutomation(w, approvalQueue, cfg.AutomationsPath, body.ID+runner.DeclarativeExtension, code, requestRole(req))
+	})
+
+	// Agent-authored automations awaiting approval
+	mux.HandleFunc("GET /pending", func(w http.ResponseWriter, req *http.Request) {
+		submissions, err := approvalQueue.List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(submissions)
+	})
+
+	mux.HandleFunc("GET /pending/{id}", func(w http.ResponseWriter, req *http.Request) {
+		submission, err := approvalQueue.Get(req.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), pendingErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(submission)
+	})
+
+	// Approve deploys the staged code; agents can't approve their own work
+	mux.HandleFunc("POST /pending/{id}/approve", func(w http.ResponseWriter, req *http.Request) {
+		if requestRole(req) == approval.RoleAgent {
+			http.Error(w, "agents cannot approve automations", http.StatusForbidden)
+			return
+		}
+		submission, err := approvalQueue.Approve(req.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), pendingErrorStatus(err))
+			return
+		}
+		slog.Info("Pending automation approved", "id", submission.ID, "filename", submission.Filename)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(submission)
+	})
+
+	mux.HandleFunc("DELETE /pending/{id}", func(w http.ResponseWriter, req *http.Request) {
+		if err := approvalQueue.Reject(req.PathValue("id")); err != nil {
+			http.Error(w, err.Error(), pendingErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Documentation generated from docstrings and config (?format=markdown|text|json)
+	mux.HandleFunc("GET /automations/{id}/docs", func(w http.ResponseWriter, req *http.Request) {
+		docs, err := r.GetDocs(req.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Automation not found", http.StatusNotFound)
+			return
+		}
+
+		switch req.URL.Query().Get("format") {
+		case "json":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(docs)
+		case "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(docs.PlainText()))
+		default:
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			w.Write([]byte(docs.Markdown()))
+		}
+	})
+
+	// Notes attached to an automation, oldest first
+	mux.HandleFunc("GET /automations/{id}/annotations", func(w http.ResponseWriter, req *http.Request) {
+		notes, err := r.GetAnnotations(req.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(notes)
+	})
+
+	// Attach a timestamped note ({"text": ..., "author": ...}); the author
+	// defaults to the name of the request's token
+	mux.HandleFunc("POST /automations/{id}/annotations", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Text   string `json:"text"`
+			Author string `json:"author"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if body.Author == "" {
+			body.Author = requestAuthor(req)
+		}
+
+		note, err := r.Annotate(req.PathValue("id"), body.Author, body.Text)
+		switch {
+		case errors.Is(err, runner.ErrAutomationNotFound):
+			http.Error(w, "Automation not found", http.StatusNotFound)
+			return
+		case errors.Is(err, runner.ErrInvalidAnnotation):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(note)
+	})
+
+	mux.HandleFunc("DELETE /automations/{id}/annotations/{note}", func(w http.ResponseWriter, req *http.Request) {
+		id, err := strconv.ParseUint(req.PathValue("note"), 10, 64)
+		if err != nil {
+			http.Error(w, "Annotation not found", http.StatusNotFound)
+			return
+		}
+		err = r.DeleteAnnotation(req.PathValue("id"), id)
+		switch {
+		case errors.Is(err, runner.ErrAnnotationNotFound):
+			http.Error(w, "Annotation not found", http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	// Run an automation manually (ctx.trigger.type == "manual")
+	mux.HandleFunc("POST /automations/{id}/trigger", func(w http.ResponseWriter, req *http.Request) {
+		var trigger runner.ManualTrigger
+		if req.ContentLength != 0 {
+			if err := json.NewDecoder(req.Body).Decode(&trigger); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		if token, ok := auth.FromContext(req.Context()); ok {
+			trigger.Token = token.Name
+		}
+
+		run, err := r.RunManualContext(req.Context(), req.PathValue("id"), trigger)
+		switch {
+		case errors.Is(err, runner.ErrAutomationNotFound):
+			http.Error(w, "Automation not found", http.StatusNotFound)
+			return
+		case errors.Is(err, runner.ErrQueueFull):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case req.Context().Err() != nil:
+			return
+		}
+
+		response := map[string]any{"success": err == nil, "result": run.Result}
+		if err != nil {
+			response["error"] = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+
+	// Run an automation's *_test.star tests; a {"code": ...} body replaces the test file
+	mux.HandleFunc("POST /automations/{id}/test", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Code string `json:"code"`
+		}
+		if req.ContentLength != 0 {
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		report, err := r.RunTests(req.PathValue("id"), body.Code)
+		switch {
+		case errors.Is(err, runner.ErrAutomationNotFound):
+			http.Error(w, "Automation not found", http.StatusNotFound)
+			return
+		case errors.Is(err, runner.ErrNoTests):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+
+	// Incoming webhook, delivered to automations subscribed to "webhook/<name>".
+	// Requests are rejected before dispatch unless their signature checks out.
+	mux.HandleFunc("POST /webhooks/{name}", func(w http.ResponseWriter, req *http.Request) {
+		name := req.PathValue("name")
+		verifier, ok := webhooks[name]
+		if !ok {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := verifier.Verify(req.Header, body); err != nil {
+			slog.Warn("Rejected webhook", "webhook", name, "error", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		r.DispatchWebhook(name, body)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	// Get discovered topics
+	mux.HandleFunc("GET /topics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Query().Get("details") == "true" {
+			json.NewEncoder(w).Encode(mqttClient.GetDiscoveredTopicInfo())
+			return
+		}
+		json.NewEncoder(w).Encode(mqttClient.GetDiscoveredTopics())
+	})
+
+	// Automation hooks (config.webhook) run on_webhook directly. Hooks with a
+	// secret are verified by signature; others need an admin token when
+	// authentication is on.
+	mux.HandleFunc("POST /hooks/{name}", func(w http.ResponseWriter, req *http.Request) {
+		name := req.PathValue("name")
+		hook, ok := r.Webhook(name)
+		if !ok {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		if hook.Secret == "" && !authenticator.Allows(req, auth.ScopeAdmin) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="homebrain"`)
+			http.Error(w, "Unsigned webhooks need an admin API token", http.StatusUnauthorized)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		err = r.HandleWebhook(name, req.Header, body)
+		switch {
+		case errors.Is(err, runner.ErrWebhookNotFound):
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		case errors.Is(err, runner.ErrWebhookSecretMissing), errors.Is(err, runner.ErrQueueFull):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case err != nil:
+			slog.Warn("Rejected webhook", "webhook", name, "error", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+
+	// Forget a discovered topic (the rest of the path is the topic)
+	mux.HandleFunc("DELETE /topics/{topic...}", func(w http.ResponseWriter, req *http.Request) {
+		found, err := mqttClient.DeleteTopic(req.PathValue("topic"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "topic not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Get recent MQTT messages, newest first. ?topic= filters by topic (MQTT
+	// wildcards allowed), ?limit= keeps that many messages per topic.
+	mux.HandleFunc("GET /messages", func(w http.ResponseWriter, req *http.Request) {
+		limit := 0
+		if v := req.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		messages := mqttClient.GetMessages(req.URL.Query().Get("topic"), limit)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(messages)
+	})
+
+	// Get logs (recent log entries, oldest first): ?automation_id=, ?level=
+	// (minimum), ?q= (words or "phrases"), ?since=, ?until= and ?limit= (the
+	// newest n). With LOG_PERSIST queries reaching past the buffer page
+	// through the stored history: ?before= takes the X-Next-Cursor header of
+	// the previous page. GET /logs/search is an alias.
+	getLogs := func(w http.ResponseWriter, req *http.Request) {
+		query, err := parseLogQuery(req.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.AutomationID = req.URL.Query().Get("automation_id")
+		entries, next := r.FilterLogs(query)
+		writeLogs(w, entries, next)
+	}
+	mux.HandleFunc("GET /logs", getLogs)
+	mux.HandleFunc("GET /logs/search", getLogs)
+
+	// One automation's logs, with the same filters as GET /logs
+	mux.HandleFunc("GET /automations/{id}/logs", func(w http.ResponseWriter, req *http.Request) {
+		query, err := parseLogQuery(req.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.AutomationID = req.PathValue("id")
+		entries, next := r.FilterLogs(query)
+		writeLogs(w, entries, next)
+	})
+
+	// Self-test report: broker round trip, state store, clock skew, disk space,
+	// automation load errors. 503 when a check failed. GET leaves the broker
+	// and state store alone; POST also runs the live probes.
+	writeReport := func(w http.ResponseWriter, report diagnostics.Report) {
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status == diagnostics.StatusFail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+	passiveChecks := diagnostics.WithoutProbes(checks)
+	mux.HandleFunc("GET /diagnostics", func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, diagnostics.Run(req.Context(), passiveChecks, diagnosticsTimeout))
+	})
+	mux.HandleFunc("POST /diagnostics", func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, diagnostics.Run(req.Context(), checks, diagnosticsTimeout))
+	})
+
+	// Watchdog state: probe latencies, current stalls with goroutine stacks,
+	// and recent recovered stalls
+	mux.HandleFunc("GET /diagnostics/watchdog", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.GetWatchdogStatus())
+	})
+
+	// Engine logs (load errors, MQTT reconnects, watcher events): ?level=&limit=,
+	// with ?follow=true streaming new records as server-sent events
+	mux.HandleFunc("GET /engine-logs", func(w http.ResponseWriter, req *http.Request) {
+		minLevel := slog.LevelDebug
+		if v := req.URL.Query().Get("level"); v != "" {
+			var err error
+			if minLevel, err = enginelog.ParseLevel(v); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		limit := 0
+		if v := req.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		if req.URL.Query().Get("follow") != "true" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(engineLogs.Entries(minLevel, limit))
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		entries, stop := engineLogs.Subscribe()
+		defer stop()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		writeEvent := func(e enginelog.Entry) {
+			data, _ := json.Marshal(e)
+			w.Write([]byte("data: "))
+			w.Write(data)
+			w.Write([]byte("\n\n"))
+		}
+		// Replay the tail first so a new client sees recent history. Records
+		// logged since subscribing are in both, so skip what was replayed.
+		var last uint64
+		for _, e := range engineLogs.Entries(minLevel, limit) {
+			writeEvent(e)
+			last = e.Seq
+		}
+		flusher.Flush()
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case e := <-entries:
+				if lvl, _ := enginelog.ParseLevel(e.Level); lvl < minLevel || e.Seq <= last {
+					continue
+				}
+				writeEvent(e)
+				flusher.Flush()
+			}
+		}
+	})
+
+	// Get recent handler runs (optionally ?automation=id)
+	mux.HandleFunc("GET /runs", func(w http.ResponseWriter, req *http.Request) {
+		runs := r.GetRuns(req.URL.Query().Get("automation"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runs)
+	})
+
+	// Background jobs started with ctx.job.start, newest first
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.GetJobs())
+	})
+
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, req *http.Request) {
+		job, err := r.GetJob(req.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
 	})
 
-	// Get discovered topics
-	mux.HandleFunc("GET /topics", func(w http.ResponseWriter, req *http.Request) {
-		topics := mqttClient.GetDiscoveredTopics()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(topics)
+	mux.HandleFunc("POST /jobs/{id}/cancel", func(w http.ResponseWriter, req *http.Request) {
+		err := r.CancelJob(req.PathValue("id"))
+		switch {
+		case errors.Is(err, runner.ErrJobNotFound):
+			http.Error(w, "Job not found", http.StatusNotFound)
+		case errors.Is(err, runner.ErrJobFinished):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
 	})
 
-	// Get recent MQTT messages for visualization
-	mux.HandleFunc("GET /messages", func(w http.ResponseWriter, req *http.Request) {
-		messages := mqttClient.GetRecentMessages()
+	// Failed ctx.expect calls from the run history (optionally ?automation=id)
+	mux.HandleFunc("GET /expectations", func(w http.ResponseWriter, req *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(messages)
+		json.NewEncoder(w).Encode(r.GetExpectationFailures(req.URL.Query().Get("automation")))
 	})
 
-	// Get logs (recent log entries)
-	mux.HandleFunc("GET /logs", func(w http.ResponseWriter, req *http.Request) {
-		logs := r.GetLogs()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(logs)
+	// Grafana JSON datasource over global state history and run history
+	mux.Handle("/grafana/", http.StripPrefix("/grafana", grafana.New(stateStore, r).Handler()))
+
+	// Download an artifact attached to a run with ctx.attach
+	mux.HandleFunc("GET /runs/{id}/artifacts/{name}", func(w http.ResponseWriter, req *http.Request) {
+		artifact, ok := r.GetRunArtifact(req.PathValue("id"), req.PathValue("name"))
+		if !ok {
+			http.Error(w, "Artifact not found", http.StatusNotFound)
+			return
+		}
+		// Artifacts hold automation-supplied content; never let a browser
+		// render them inline on the API's origin
+		w.Header().Set("Content-Type", artifact.ContentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": artifact.Name}))
+		w.Write(artifact.Data())
 	})
 
 	// List library modules
@@ -146,6 +1308,7 @@ func startAPI(r *runner.Runner, mqttClient *mqtt.Client, stateStore *state.Store
 			Name        string   `json:"name"`
 			Description string   `json:"description"`
 			Functions   []string `json:"functions"`
+			BindContext bool     `json:"bind_ctx,omitempty"`
 		}
 		
 		response := make([]LibraryModuleResponse, 0, len(modules))
@@ -158,6 +1321,7 @@ func startAPI(r *runner.Runner, mqttClient *mqtt.Client, stateStore *state.Store
 				Name:        module.Name,
 				Description: module.Description,
 				Functions:   funcNames,
+				BindContext: module.BindContext,
 			})
 		}
 		
@@ -198,8 +1362,155 @@ func startAPI(r *runner.Runner, mqttClient *mqtt.Client, stateStore *state.Store
 		json.NewEncoder(w).Encode(globalState)
 	})
 
+	// Per-automation and global state as one JSON document, for moving it to
+	// another engine with POST /state/import
+	mux.HandleFunc("GET /state/export", func(w http.ResponseWriter, req *http.Request) {
+		snapshot, err := stateStore.Export()
+		if err != nil {
+			http.Error(w, "Failed to export state: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"homebrain-state.json\"")
+		json.NewEncoder(w).Encode(snapshot)
+	})
+
+	// Writes an exported snapshot; ?replace=true clears existing state first.
+	// Changed global keys run on_state_change like any other write.
+	mux.HandleFunc("POST /state/import", func(w http.ResponseWriter, req *http.Request) {
+		var snapshot state.Snapshot
+		if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 64<<20)).Decode(&snapshot); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		replace := req.URL.Query().Get("replace") == "true"
+		result, err := r.ImportState(snapshot, replace)
+		if err != nil {
+			http.Error(w, "Failed to import state: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Info("Imported state", "automations", result.Automations, "automation_keys", result.AutomationKeys,
+			"global_keys", result.GlobalKeys, "annotations", result.Annotations, "replace", replace)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	// Live global state as server-sent events: a "snapshot" event with all
+	// values, then one event per change. ?key= (repeatable, wildcards as in
+	// watch_global) limits both to matching keys.
+	mux.HandleFunc("GET /global-state/stream", func(w http.ResponseWriter, req *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		// Subscribe before reading the snapshot so no change falls in between
+		patterns := req.URL.Query()["key"]
+		changes, stop := r.SubscribeGlobalState(patterns)
+		defer stop()
+		snapshot, err := r.GlobalStateSnapshot(patterns)
+		if err != nil {
+			http.Error(w, "Failed to get global state", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		data, _ := json.Marshal(snapshot)
+		w.Write([]byte("event: snapshot\ndata: "))
+		w.Write(data)
+		w.Write([]byte("\n\n"))
+		flusher.Flush()
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case change := <-changes:
+				data, _ := json.Marshal(change)
+				w.Write([]byte("data: "))
+				w.Write(data)
+				w.Write([]byte("\n\n"))
+				flusher.Flush()
+			}
+		}
+	})
+
+	// Previous values of a global key, newest first (?limit=, default 50)
+	mux.HandleFunc("GET /global-state/{key}/history", func(w http.ResponseWriter, req *http.Request) {
+		limit := 50
+		if v := req.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > state.MaxHistory {
+				http.Error(w, "limit must be between 1 and "+strconv.Itoa(state.MaxHistory), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		history, err := stateStore.GetGlobalHistory(req.PathValue("key"), limit)
+		if err != nil {
+			http.Error(w, "Failed to get global state history", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+	})
+
+	// Get the active profile and the available ones
+	mux.HandleFunc("GET /profile", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"profile": r.ActiveProfile(), "profiles": r.Profiles()})
+	})
+
+	// Switch profile: {"profile": "away"}
+	mux.HandleFunc("PUT /profile", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Profile string `json:"profile"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		err := r.SetActiveProfile(body.Profile, "api")
+		switch {
+		case errors.Is(err, runner.ErrUnknownProfile):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"profile": r.ActiveProfile(), "profiles": r.Profiles()})
+		}
+	})
+
+	// Get active ctx.override values, soonest to expire first
+	mux.HandleFunc("GET /overrides", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.GetOverrides())
+	})
+
+	// Cancel an override and revert it now (the rest of the path is the global
+	// key or mqtt:<topic> target)
+	mux.HandleFunc("DELETE /overrides/{target...}", func(w http.ResponseWriter, req *http.Request) {
+		err := r.CancelOverride(req.PathValue("target"))
+		switch {
+		case errors.Is(err, runner.ErrOverrideNotFound):
+			http.Error(w, "Override not found", http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
 	// Get global state schema (which automations write which keys)
 	mux.HandleFunc("GET /global-state-schema", func(w http.ResponseWriter, req *http.Request) {
+		// ?details=true merges in keys observed at runtime and flags undeclared writes
+		if req.URL.Query().Get("details") == "true" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(r.GetGlobalStateSchema())
+			return
+		}
+
 		automations := r.ListAutomations()
 		
 		// Build schema: key patterns -> automation IDs
@@ -214,6 +1525,212 @@ func startAPI(r *runner.Runner, mqttClient *mqtt.Client, stateStore *state.Store
 		json.NewEncoder(w).Encode(schema)
 	})
 
+	// Automation dependency graph (configs + runtime audit data)
+	mux.HandleFunc("GET /graph", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Graph())
+	})
+
+	// Denied actions: undeclared global writes and secrets and, in strict mode,
+	// undeclared reads, publishes and library use
+	mux.HandleFunc("GET /violations", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.GetViolations())
+	})
+
+	// Tracked persons and whether they are home
+	mux.HandleFunc("GET /presence", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Presence())
+	})
+
+	// Names of the secrets automations can declare (values are never returned)
+	mux.HandleFunc("GET /secrets", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.SecretNames())
+	})
+
+	// Recently detected competing writers (same topic/key, different values)
+	mux.HandleFunc("GET /conflicts", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.GetConflicts())
+	})
+
+	// Run automation code in the sandbox (no publishes, no state writes)
+	mux.HandleFunc("POST /dry-run", func(w http.ResponseWriter, req *http.Request) {
+		var dryRun runner.DryRunRequest
+		if err := json.NewDecoder(req.Body).Decode(&dryRun); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		result, err := r.DryRun(dryRun)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	// Replay a message sequence to local subscribers without publishing it.
+	// The replay outlives the request; DELETE /messages/replay stops it.
+	mux.HandleFunc("POST /messages/replay", func(w http.ResponseWriter, req *http.Request) {
+		var messages []mqtt.ReplayMessage
+		if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 4<<20)).Decode(&messages); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		duration, err := mqttClient.Replay(context.WithoutCancel(req.Context()), messages)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Info("Replaying messages", "count", len(messages), "duration", duration)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]any{"messages": len(messages), "duration_ms": duration.Milliseconds()})
+	})
+
+	// Stop running message replays
+	mux.HandleFunc("DELETE /messages/replay", func(w http.ResponseWriter, req *http.Request) {
+		stopped := mqttClient.StopReplays()
+		if stopped > 0 {
+			slog.Info("Stopped message replays", "count", stopped)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"stopped": stopped})
+	})
+
+	// Replay bundles captured from failed runs
+	mux.HandleFunc("GET /replays", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.GetReplays())
+	})
+
+	mux.HandleFunc("GET /replays/{id}", func(w http.ResponseWriter, req *http.Request) {
+		bundle, ok := r.GetReplay(req.PathValue("id"))
+		if !ok {
+			http.Error(w, "Replay bundle not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"replay-"+bundle.ID+".json\"")
+		json.NewEncoder(w).Encode(bundle)
+	})
+
+	mux.HandleFunc("POST /replays/{id}/run", func(w http.ResponseWriter, req *http.Request) {
+		result, err := r.Replay(req.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	// Feature flags read by automations via ctx.flags.is_enabled
+	mux.HandleFunc("GET /flags", func(w http.ResponseWriter, req *http.Request) {
+		flags, err := stateStore.ListFlags()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(flags)
+	})
+
+	mux.HandleFunc("PUT /flags/{name}", func(w http.ResponseWriter, req *http.Request) {
+		flag := state.Flag{Percentage: 100}
+		if err := json.NewDecoder(req.Body).Decode(&flag); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		flag.Name = req.PathValue("name")
+		if err := stateStore.SetFlag(flag); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(flag)
+	})
+
+	mux.HandleFunc("DELETE /flags/{name}", func(w http.ResponseWriter, req *http.Request) {
+		if err := stateStore.DeleteFlag(req.PathValue("name")); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Git sync of the automations directory: the last result, or pull now.
+	// Conflicts answer 409 and fetch failures 502, with the result as body.
+	mux.HandleFunc("GET /sync", func(w http.ResponseWriter, req *http.Request) {
+		if syncer == nil {
+			http.Error(w, "Git sync is not configured", http.StatusNotFound)
+			return
+		}
+		result, ok := syncer.Last()
+		if !ok {
+			http.Error(w, "No sync has run yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+	mux.HandleFunc("POST /sync", func(w http.ResponseWriter, req *http.Request) {
+		if syncer == nil {
+			http.Error(w, "Git sync is not configured", http.StatusNotFound)
+			return
+		}
+		// A client hanging up must not abort a merge halfway; Sync has its own timeout
+		result := syncer.Sync(context.WithoutCancel(req.Context()))
+		w.Header().Set("Content-Type", "application/json")
+		switch result.Status {
+		case gitsync.StatusConflict:
+			w.WriteHeader(http.StatusConflict)
+		case gitsync.StatusError:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+
+	// Cron entries of loaded automations with next/previous run and pause status
+	mux.HandleFunc("GET /schedules", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Schedules())
+	})
+
+	// Suspend or resume just the schedule; MQTT and other triggers keep running
+	scheduleAction := func(action func(string) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			err := action(req.PathValue("id"))
+			switch {
+			case errors.Is(err, runner.ErrAutomationNotFound):
+				http.Error(w, "Automation not found", http.StatusNotFound)
+			case errors.Is(err, runner.ErrNoSchedule):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}
+	}
+	mux.HandleFunc("POST /schedules/{id}/pause", scheduleAction(r.PauseSchedule))
+	mux.HandleFunc("POST /schedules/{id}/resume", scheduleAction(r.ResumeSchedule))
+
+	// Explain how a schedule string is interpreted (?schedule=every weekday at 7:15)
+	mux.HandleFunc("GET /schedule/explain", func(w http.ResponseWriter, req *http.Request) {
+		resolved, err := runner.ResolveSchedule(req.URL.Query().Get("schedule"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resolved)
+	})
+
 	// Validate Starlark code without deploying
 	mux.HandleFunc("POST /validate", func(w http.ResponseWriter, req *http.Request) {
 		var validationReq runner.ValidationRequest
@@ -222,14 +1739,272 @@ func startAPI(r *runner.Runner, mqttClient *mqtt.Client, stateStore *state.Store
 			return
 		}
 
-		result := runner.ValidateCode(validationReq.Code, validationReq.Type)
+		result := runner.ValidateCodeIn(validationReq.Code, validationReq.Type, cfg.AutomationsPath)
+		if validationReq.Lint && result.Valid && (validationReq.Type == "" || validationReq.Type == "automation") {
+			result.Findings = runner.LintIn(validationReq.Code, cfg.AutomationsPath).Findings
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(result)
 	})
 
-	slog.Info("Starting Engine API", "port", 9000)
-	if err := http.ListenAndServe(":9000", mux); err != nil {
+	// Lint automation code against homebrain style rules
+	mux.HandleFunc("POST /lint", func(w http.ResponseWriter, req *http.Request) {
+		var lintReq runner.ValidationRequest
+		if err := json.NewDecoder(req.Body).Decode(&lintReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runner.LintIn(lintReq.Code, cfg.AutomationsPath))
+	})
+
+	// API tokens. Secrets are only returned once, when issued.
+	mux.HandleFunc("GET /auth/tokens", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(authenticator.List())
+	})
+
+	mux.HandleFunc("POST /auth/tokens", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Name  string `json:"name"`
+			Scope string `json:"scope"`
+			TTL   string `json:"ttl"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		var ttl time.Duration
+		if body.TTL != "" {
+			d, err := time.ParseDuration(body.TTL)
+			if err != nil || d <= 0 {
+				http.Error(w, "Invalid ttl", http.StatusBadRequest)
+				return
+			}
+			ttl = d
+		}
+		token, secret, err := authenticator.Issue(body.Name, body.Scope, ttl)
+		switch {
+		case errors.Is(err, auth.ErrTokenExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			auth.Token
+			Secret string `json:"secret"`
+		}{token, secret})
+	})
+
+	mux.HandleFunc("DELETE /auth/tokens/{name}", func(w http.ResponseWriter, req *http.Request) {
+		err := authenticator.Revoke(req.PathValue("name"))
+		switch {
+		case errors.Is(err, auth.ErrTokenNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, auth.ErrStaticToken):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	slog.Info("Starting Engine API", "port", cfg.APIPort, "tls", cfg.TLS())
+	handler := authenticator.Middleware(mux)
+	var err error
+	if cfg.TLS() {
+		err = http.ListenAndServeTLS(cfg.APIAddr(), cfg.TLSCertPath, cfg.TLSKeyPath, handler)
+	} else {
+		err = http.ListenAndServe(cfg.APIAddr(), handler)
+	}
+	if err != nil {
 		slog.Error("API server failed", "error", err)
 	}
 }
+
+// parseLogQuery reads the level, since, until, limit and before parameters
+// shared by the log endpoints
+func parseLogQuery(params url.Values) (runner.LogQuery, error) {
+	query := runner.LogQuery{Text: params.Get("q")}
+	var err error
+	if v := params.Get("level"); v != "" {
+		if query.Level, err = runner.ParseLogLevel(v); err != nil {
+			return query, err
+		}
+	}
+	if query.Since, err = parseTimeParam(params.Get("since")); err != nil {
+		return query, fmt.Errorf("invalid since: %w", err)
+	}
+	if query.Until, err = parseTimeParam(params.Get("until")); err != nil {
+		return query, fmt.Errorf("invalid until: %w", err)
+	}
+	if v := params.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit < 0 {
+			return query, errors.New("invalid limit")
+		}
+	}
+	if v := params.Get("before"); v != "" {
+		if query.Before, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return query, errors.New("invalid before")
+		}
+	}
+	return query, nil
+}
+
+// writeLogs answers a log query, with the cursor for older entries in the
+// X-Next-Cursor header when there may be more
+func writeLogs(w http.ResponseWriter, entries []runner.LogEntry, next uint64) {
+	w.Header().Set("Content-Type", "application/json")
+	if next > 0 {
+		w.Header().Set("X-Next-Cursor", strconv.FormatUint(next, 10))
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a YYYY-MM-DD date (local
+// midnight). Empty values yield the zero time.
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, value, time.Local)
+}
+
+// requestRole is the approval role of an API request: approval.RoleAgent for
+// a token with the agent scope. The X-Role header is only honoured while
+// authentication is off, when anyone may use the API anyway.
+func requestRole(req *http.Request) string {
+	if token, ok := auth.FromContext(req.Context()); ok {
+		if token.Scope == auth.ScopeAgent {
+			return approval.RoleAgent
+		}
+		return ""
+	}
+	return req.Header.Get("X-Role")
+}
+
+// requestAuthor names who made an API request for annotations: its token,
+// or its role while authentication is off
+func requestAuthor(req *http.Request) string {
+	if token, ok := auth.FromContext(req.Context()); ok {
+		return token.Name
+	}
+	return requestRole(req)
+}
+
+// submitAutomation validates code and hands it to the approval queue. Invalid
+// code and bad filenames are answered with a JSON ValidationResult; otherwise
+// the status is 201 (created), 200 (replaced) or 202 (staged for approval).
+func submitAutomation(w http.ResponseWriter, approvalQueue *approval.Queue, automationsDir, filename, code, role string) {
+	w.Header().Set("Content-Type", "application/json")
+	fileType := "automation"
+	if runner.IsDeclarativeFile(filename) {
+		fileType = "declarative"
+	}
+	if result := runner.ValidateCodeIn(code, fileType, automationsDir); !result.Valid {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	submission, pending, err := approvalQueue.Submit(filename, code, role)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(runner.ValidationResult{Errors: []string{err.Error()}})
+		return
+	}
+
+	status := http.StatusCreated
+	switch {
+	case pending:
+		status = http.StatusAccepted
+	case submission.Replaces:
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":       submission.ID,
+		"pending":  pending,
+		"replaces": submission.Replaces,
+	})
+}
+
+func pendingErrorStatus(err error) int {
+	if errors.Is(err, approval.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// runTestCommand runs the tests of the given automation files without MQTT or
+// state and prints one line per test. It returns the process exit code.
+func runTestCommand(paths []string) int {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: engine test <automation.star>...")
+		return 2
+	}
+
+	failed := false
+	for _, path := range paths {
+		if runner.IsTestFile(path) {
+			path = strings.TrimSuffix(path, runner.TestFileSuffix) + ".star"
+		}
+		r := runner.New(nil, nil)
+		if root, ok := libraryRoot(filepath.Dir(path)); ok {
+			r.SetAutomationsDir(root)
+			if err := r.LoadLibraries(root); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: failed to load libraries: %v\n", path, err)
+			}
+		}
+		report, err := r.RunTestFile(path)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		for _, tc := range report.Tests {
+			if tc.Passed {
+				fmt.Printf("PASS %s %s (%.1fms)\n", report.AutomationID, tc.Name, tc.DurationMs)
+				continue
+			}
+			fmt.Printf("FAIL %s %s (%.1fms)\n", report.AutomationID, tc.Name, tc.DurationMs)
+			for _, failure := range tc.Failures {
+				fmt.Printf("    %s\n", failure)
+			}
+			if tc.Error != "" {
+				fmt.Printf("    error: %s\n", tc.Error)
+			}
+		}
+		if !report.Passed {
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// libraryRoot finds the automations directory holding lib/ for an automation
+// directory, which may be a group subdirectory
+func libraryRoot(dir string) (string, bool) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if info, err := os.Stat(filepath.Join(d, "lib")); err == nil && info.IsDir() {
+			return d, true
+		}
+		if filepath.Dir(d) == d {
+			return "", false
+		}
+	}
+}
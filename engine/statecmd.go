@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const stateUsage = `usage: engine state export [-url URL] [-token TOKEN] [-ca FILE] [-insecure] [-o FILE]
+       engine state import [-url URL] [-token TOKEN] [-ca FILE] [-insecure] [-replace] FILE
+
+Copies per-automation and global state out of or into a running engine
+through GET /state/export and POST /state/import. ENGINE_URL,
+ENGINE_API_TOKEN and ENGINE_CA_CERT set the defaults; FILE "-" is stdin or
+stdout.`
+
+// runStateCommand implements "engine state export|import", returning the
+// exit code
+func runStateCommand(args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		fmt.Fprintln(stderr, stateUsage)
+		return 2
+	}
+	command := args[0]
+
+	baseURL := getenv("ENGINE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:9000"
+	}
+	flags := flag.NewFlagSet("engine state "+command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&baseURL, "url", baseURL, "engine API URL")
+	token := flags.String("token", getenv("ENGINE_API_TOKEN"), "API token (admin scope for import)")
+	caCert := flags.String("ca", getenv("ENGINE_CA_CERT"), "CA certificate to trust for HTTPS, e.g. the engine's self-signed engine.crt")
+	insecure := flags.Bool("insecure", false, "skip HTTPS certificate verification")
+	output := flags.String("o", "-", "export: file to write")
+	replace := flags.Bool("replace", false, "import: clear existing state first")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	client, err := stateClient(*caCert, *insecure)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/state/" + command
+
+	var req *http.Request
+	if command == "export" {
+		req, err = http.NewRequest(http.MethodGet, endpoint, nil)
+	} else {
+		if flags.NArg() != 1 {
+			fmt.Fprintln(stderr, stateUsage)
+			return 2
+		}
+		var body []byte
+		if path := flags.Arg(0); path == "-" {
+			body, err = io.ReadAll(stdin)
+		} else {
+			body, err = os.ReadFile(path)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to read snapshot: %v\n", err)
+			return 1
+		}
+		if *replace {
+			endpoint += "?replace=true"
+		}
+		req, err = http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(stderr, "state %s failed: %v\n", command, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(stderr, "state %s failed: %v\n", command, err)
+		return 1
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(stderr, "state %s failed: %s: %s\n", command, resp.Status, strings.TrimSpace(string(body)))
+		return 1
+	}
+
+	if command == "export" && *output != "-" {
+		if err := os.WriteFile(*output, body, 0600); err != nil {
+			fmt.Fprintf(stderr, "failed to write snapshot: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	stdout.Write(body)
+	return 0
+}
+
+// stateClient returns the client for the engine API. caFile is a PEM
+// certificate to trust instead of the system roots, as needed for the
+// engine's self-signed one.
+func stateClient(caFile string, insecure bool) (*http.Client, error) {
+	client := &http.Client{Timeout: time.Minute}
+	if caFile == "" && !insecure {
+		return client, nil
+	}
+	conf := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		conf.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf
+	client.Transport = transport
+	return client, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/homebrain/engine/internal/state"
+)
+
+func TestRunStateCommand(t *testing.T) {
+	var imported state.Snapshot
+	var replace, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth = req.Header.Get("Authorization")
+		switch req.Method + " " + req.URL.Path {
+		case "GET /state/export":
+			json.NewEncoder(w).Encode(state.Snapshot{Version: state.SnapshotVersion, Global: map[string]any{"mode": "home"}})
+		case "POST /state/import":
+			if err := json.NewDecoder(req.Body).Decode(&imported); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			replace = req.URL.Query().Get("replace")
+			json.NewEncoder(w).Encode(state.ImportResult{GlobalKeys: len(imported.Global)})
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+	env := map[string]string{"ENGINE_URL": server.URL + "/", "ENGINE_API_TOKEN": "s3cret"}
+	getenv := func(key string) string { return env[key] }
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	var stdout, stderr bytes.Buffer
+	if code := runStateCommand([]string{"export", "-o", path}, getenv, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("export exited %d: %s", code, stderr.String())
+	}
+	if auth != "Bearer s3cret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), `"mode":"home"`) {
+		t.Fatalf("exported file = %s, %v", data, err)
+	}
+
+	if code := runStateCommand([]string{"import", "-replace", "-token", "other", path}, getenv, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("import exited %d: %s", code, stderr.String())
+	}
+	if imported.Global["mode"] != "home" || replace != "true" || auth != "Bearer other" {
+		t.Errorf("imported %+v, replace = %q, auth = %q", imported, replace, auth)
+	}
+	if !strings.Contains(stdout.String(), `"global_keys":1`) {
+		t.Errorf("import output = %q", stdout.String())
+	}
+
+	stderr.Reset()
+	if code := runStateCommand([]string{"import", "-"}, getenv, strings.NewReader("not json"), &stdout, &stderr); code != 1 ||
+		!strings.Contains(stderr.String(), "400 Bad Request") {
+		t.Errorf("bad import exited %d: %s", code, stderr.String())
+	}
+	if code := runStateCommand([]string{"import"}, getenv, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("import without a file exited %d", code)
+	}
+	if code := runStateCommand(nil, getenv, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("no subcommand exited %d", code)
+	}
+}
+
+func TestRunStateCommand_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(state.Snapshot{Version: state.SnapshotVersion})
+	}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "engine.crt")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	getenv := func(key string) string { return "" }
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"untrusted", []string{"export", "-url", server.URL}, 1},
+		{"ca", []string{"export", "-url", server.URL, "-ca", caFile}, 0},
+		{"insecure", []string{"export", "-url", server.URL, "-insecure"}, 0},
+		{"missing ca", []string{"export", "-url", server.URL, "-ca", caFile + ".missing"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runStateCommand(tt.args, getenv, nil, &stdout, &stderr); code != tt.code {
+				t.Errorf("exited %d, want %d: %s", code, tt.code, stderr.String())
+			}
+		})
+	}
+}
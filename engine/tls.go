@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// selfSignedValidity is how long a generated certificate is valid. It is
+// regenerated at startup once less than selfSignedRenewBefore remains.
+const (
+	selfSignedValidity    = 2 * 365 * 24 * time.Hour
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+)
+
+// ensureSelfSignedCert returns the certificate and key under dir, generating
+// them on first boot or when the certificate is about to expire
+func ensureSelfSignedCert(dir string, now time.Time) (certPath, keyPath string, generated bool, err error) {
+	certPath = filepath.Join(dir, "engine.crt")
+	keyPath = filepath.Join(dir, "engine.key")
+	if cert, err := loadCertificate(certPath, keyPath); err == nil && now.Before(cert.NotAfter.Add(-selfSignedRenewBefore)) {
+		return certPath, keyPath, false, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", "", false, err
+	}
+	certPEM, keyPEM, err := generateSelfSigned(now)
+	if err != nil {
+		return "", "", false, err
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return "", "", false, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return "", "", false, err
+	}
+	return certPath, keyPath, true, nil
+}
+
+// generateSelfSigned creates an ECDSA certificate for the names the engine is
+// usually reached by: its hostname, "engine" inside Docker and loopback
+func generateSelfSigned(now time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := []string{"localhost", "engine"}
+	if host, err := os.Hostname(); err == nil && host != "" && host != "localhost" && host != "engine" {
+		names = append(names, host)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "homebrain engine", Organization: []string{"homebrain"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              names,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// loadCertificate loads a certificate and key pair and parses the leaf
+func loadCertificate(certPath, keyPath string) (*x509.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(pair.Certificate) == 0 {
+		return nil, fmt.Errorf("no certificate in %s", certPath)
+	}
+	return x509.ParseCertificate(pair.Certificate[0])
+}
+
+// certFingerprint is the SHA-256 fingerprint of a certificate, for pinning it
+// in clients that don't trust it otherwise
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
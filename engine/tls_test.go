@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnsureSelfSignedCert(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	now := time.Now()
+
+	certPath, keyPath, generated, err := ensureSelfSignedCert(dir, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !generated {
+		t.Error("first boot should generate a certificate")
+	}
+	cert, err := loadCertificate(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.VerifyHostname("engine"); err != nil {
+		t.Errorf("certificate doesn't cover the Docker service name: %v", err)
+	}
+	if err := cert.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("certificate doesn't cover loopback: %v", err)
+	}
+	if info, err := os.Stat(keyPath); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, %v", info.Mode().Perm(), err)
+	}
+
+	// Reused on the next boot
+	_, _, generated, err = ensureSelfSignedCert(dir, now.Add(24*time.Hour))
+	if err != nil || generated {
+		t.Errorf("second boot: generated = %v, err = %v", generated, err)
+	}
+	if again, _ := loadCertificate(certPath, keyPath); certFingerprint(again) != certFingerprint(cert) {
+		t.Error("certificate changed on the second boot")
+	}
+
+	// Renewed shortly before it expires
+	_, _, generated, err = ensureSelfSignedCert(dir, cert.NotAfter.Add(-time.Hour))
+	if err != nil || !generated {
+		t.Errorf("near expiry: generated = %v, err = %v", generated, err)
+	}
+}